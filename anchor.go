@@ -0,0 +1,38 @@
+package gopiq
+
+import "image"
+
+// Anchor identifies one of nine reference points of a rectangle, used to
+// place overlays within the image.
+type Anchor int
+
+const (
+	AnchorTopLeft Anchor = iota
+	AnchorTop
+	AnchorTopRight
+	AnchorLeft
+	AnchorCenter
+	AnchorRight
+	AnchorBottomLeft
+	AnchorBottom
+	AnchorBottomRight
+)
+
+// place returns the rectangle of the given size aligned to the anchor point
+// of outer. The result may extend beyond outer if size is larger.
+func (a Anchor) place(outer image.Rectangle, size image.Point) image.Rectangle {
+	x, y := outer.Min.X, outer.Min.Y
+	switch a {
+	case AnchorTop, AnchorCenter, AnchorBottom:
+		x += (outer.Dx() - size.X) / 2
+	case AnchorTopRight, AnchorRight, AnchorBottomRight:
+		x = outer.Max.X - size.X
+	}
+	switch a {
+	case AnchorLeft, AnchorCenter, AnchorRight:
+		y += (outer.Dy() - size.Y) / 2
+	case AnchorBottomLeft, AnchorBottom, AnchorBottomRight:
+		y = outer.Max.Y - size.Y
+	}
+	return image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)}
+}
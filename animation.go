@@ -0,0 +1,256 @@
+package gopiq
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"runtime"
+	"slices"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/errgroup"
+)
+
+// FrameDisposal says what happens to the area of an animation frame before
+// the next frame is drawn. The values match those of image/gif.
+type FrameDisposal byte
+
+const (
+	DisposalUnspecified FrameDisposal = iota // Treated like DisposalNone
+	DisposalNone                             // Leave the frame in place
+	DisposalBackground                       // Clear the frame's area to transparent
+	DisposalPrevious                         // Restore the area to what it was before the frame
+)
+
+// FrameBlend says how an animation frame is combined with what the previous
+// frames left on the canvas.
+type FrameBlend byte
+
+const (
+	BlendOver   FrameBlend = iota // Draw the frame over the canvas, as in GIF
+	BlendSource                   // Replace the frame's area, transparency included
+)
+
+// Frame is one frame of an animation. Its image may cover only part of the
+// canvas, at the position given by its bounds, in which case the previous
+// frames show through around it, and behind it unless Blend is BlendSource.
+type Frame struct {
+	Image    image.Image
+	Delay    int // Time to show the frame, in hundredths of a second
+	Disposal FrameDisposal
+	Blend    FrameBlend
+}
+
+// AnimationProcessor holds the frames of an animated image, such as an
+// animated GIF or WebP, together with its canvas size and loop count. It is safe
+// for concurrent use by multiple goroutines.
+type AnimationProcessor struct {
+	mu        sync.RWMutex
+	frames    []Frame
+	canvas    image.Rectangle
+	loopCount int   // As in gif.GIF: 0 loops forever, -1 plays once, n > 0 plays n+1 times
+	err       error // Stores the first error in a chain
+}
+
+// FromBytesAnimated creates a new AnimationProcessor by decoding every frame
+// of an animated GIF or WebP with its delay, disposal and blending method,
+// where FromBytes keeps only the first frame of a GIF. Other formats
+// supported by FromBytes decode to a single frame, so stills and animations
+// can go through the same pipeline. Returns an error if decoding fails.
+func FromBytesAnimated(data []byte) *AnimationProcessor {
+	if len(data) == 0 {
+		return &AnimationProcessor{err: fmt.Errorf("input byte slice is empty")}
+	}
+	if isAnimatedWebP(data) {
+		return decodeAnimatedWebP(data)
+	}
+	if DetectFormat(data) != FormatGIF {
+		img, err := decodeImage(bytes.NewReader(data))
+		if err != nil {
+			return &AnimationProcessor{err: err}
+		}
+		return &AnimationProcessor{frames: []Frame{{Image: img}}, canvas: img.Bounds(), loopCount: -1}
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return &AnimationProcessor{err: fmt.Errorf("failed to decode animated GIF: %w", err)}
+	}
+	ap := &AnimationProcessor{
+		frames:    make([]Frame, len(g.Image)),
+		canvas:    image.Rect(0, 0, g.Config.Width, g.Config.Height),
+		loopCount: g.LoopCount,
+	}
+	for i, img := range g.Image {
+		ap.frames[i] = Frame{Image: img, Delay: g.Delay[i]}
+		if g.Disposal != nil {
+			ap.frames[i].Disposal = FrameDisposal(g.Disposal[i])
+		}
+	}
+	return ap
+}
+
+// coalesce renders the frames as they are shown: each one drawn over what
+// the previous frames and their disposal left on a transparent canvas.
+func coalesce(frames []Frame, canvas image.Rectangle) []*image.RGBA {
+	out := make([]*image.RGBA, len(frames))
+	cur := image.NewRGBA(canvas)
+	for i, f := range frames {
+		r := f.Image.Bounds().Intersect(canvas)
+		var saved *image.RGBA
+		if f.Disposal == DisposalPrevious {
+			saved = image.NewRGBA(r)
+			draw.Draw(saved, r, cur, r.Min, draw.Src)
+		}
+		op := draw.Over
+		if f.Blend == BlendSource {
+			op = draw.Src
+		}
+		draw.Draw(cur, r, f.Image, r.Min, op)
+		out[i] = image.NewRGBA(canvas)
+		copy(out[i].Pix, cur.Pix)
+
+		switch f.Disposal {
+		case DisposalBackground:
+			draw.Draw(cur, r, image.Transparent, image.Point{}, draw.Src)
+		case DisposalPrevious:
+			draw.Draw(cur, r, saved, r.Min, draw.Src)
+		}
+	}
+	return out
+}
+
+// coalescedFrames returns the frames as they are shown, see coalesce, with
+// each one cleared before the next.
+func coalescedFrames(frames []Frame, canvas image.Rectangle) []Frame {
+	out := make([]Frame, len(frames))
+	for i, img := range coalesce(frames, canvas) {
+		out[i] = Frame{Image: img, Delay: frames[i].Delay, Disposal: DisposalBackground}
+	}
+	return out
+}
+
+// Coalesce replaces every frame with the full canvas as it is shown at that
+// frame, so each frame can be used on its own, e.g. as a still or a
+// thumbnail. The frames are cleared before the next one, which keeps the
+// animation looking the same.
+// Returns the AnimationProcessor for chaining.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) Coalesce() *AnimationProcessor {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if ap.err != nil {
+		return ap
+	}
+	ap.frames = coalescedFrames(ap.frames, ap.canvas)
+	return ap
+}
+
+// Apply runs fn on every frame of the animation, e.g. a chain of Resize,
+// Crop, Grayscale or AddTextWatermark calls, so animations are processed
+// like stills. Each frame is first coalesced to the full canvas as it is
+// shown (see Coalesce), so partial frames and disposal methods come out
+// right; the frames are processed in parallel. The canvas takes the size
+// of the processed frames.
+// Returns the AnimationProcessor for chaining. An error is set if fn sets
+// an error on a frame or returns frames of different sizes.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) Apply(fn func(ip *ImageProcessor) *ImageProcessor) *AnimationProcessor {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if ap.err != nil {
+		return ap
+	}
+	if fn == nil {
+		ap.err = fmt.Errorf("frame function cannot be nil")
+		return ap
+	}
+	if len(ap.frames) == 0 {
+		ap.err = fmt.Errorf("animation has no frames")
+		return ap
+	}
+
+	full := coalesce(ap.frames, ap.canvas)
+	results := make([]image.Image, len(full))
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	for i, img := range full {
+		g.Go(func() error {
+			out, err := fn(New(img)).Image()
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", i, err)
+			}
+			results[i] = out
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		ap.err = err
+		return ap
+	}
+
+	size := results[0].Bounds().Size()
+	for i, img := range results {
+		if img.Bounds().Size() != size {
+			ap.err = fmt.Errorf("frame %d is %v after processing, but frame 0 is %v", i, img.Bounds().Size(), size)
+			return ap
+		}
+	}
+	for i, img := range results {
+		if img.Bounds().Min != (image.Point{}) {
+			// Frames are positioned on the canvas by their bounds.
+			moved := image.NewRGBA(image.Rectangle{Max: size})
+			draw.Draw(moved, moved.Rect, img, img.Bounds().Min, draw.Src)
+			img = moved
+		}
+		ap.frames[i] = Frame{Image: img, Delay: ap.frames[i].Delay, Disposal: DisposalBackground}
+	}
+	ap.canvas = image.Rectangle{Max: size}
+	return ap
+}
+
+// Frames returns the frames of the animation in order, and any error
+// encountered in the processing chain.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) Frames() ([]Frame, error) {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	return slices.Clone(ap.frames), ap.err
+}
+
+// FrameCount returns the number of frames of the animation.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) FrameCount() int {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	return len(ap.frames)
+}
+
+// Size returns the size of the canvas the frames are drawn on.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) Size() image.Point {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	return ap.canvas.Size()
+}
+
+// LoopCount returns how often the animation repeats, as in image/gif: 0
+// loops forever, -1 plays it once and n > 0 plays it n+1 times.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) LoopCount() int {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	return ap.loopCount
+}
+
+// Err returns the first error encountered in the processing chain.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) Err() error {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	return ap.err
+}
@@ -0,0 +1,253 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"sync"
+	"testing"
+)
+
+// testGIFPalette holds the colors of the frames of testAnimatedGIF.
+var testGIFPalette = color.Palette{
+	color.RGBA{0, 0, 0, 0},
+	color.RGBA{255, 0, 0, 255},
+	color.RGBA{0, 255, 0, 255},
+	color.RGBA{0, 0, 255, 255},
+}
+
+// testAnimatedGIF returns a 3-frame 20×10 GIF: a red full frame, a green
+// 5×5 frame at (10,5) that is cleared afterwards and a blue 4×4 frame at
+// (0,0) that is restored afterwards. It plays 3 times.
+func testAnimatedGIF(t *testing.T) []byte {
+	t.Helper()
+	frame := func(r image.Rectangle, index uint8) *image.Paletted {
+		img := image.NewPaletted(r, testGIFPalette)
+		for i := range img.Pix {
+			img.Pix[i] = index
+		}
+		return img
+	}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			frame(image.Rect(0, 0, 20, 10), 1),
+			frame(image.Rect(10, 5, 15, 10), 2),
+			frame(image.Rect(0, 0, 4, 4), 3),
+		},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious},
+		LoopCount: 2,
+		Config:    image.Config{ColorModel: testGIFPalette, Width: 20, Height: 10},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("failed to encode test GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFromBytesAnimated(t *testing.T) {
+	ap := FromBytesAnimated(testAnimatedGIF(t))
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("FromBytesAnimated() should not error, got: %v", err)
+	}
+	if len(frames) != 3 || ap.FrameCount() != 3 {
+		t.Fatalf("FromBytesAnimated() decoded %d frames, want 3", len(frames))
+	}
+	if got := ap.Size(); got != image.Pt(20, 10) {
+		t.Errorf("Size() = %v, want (20,10)", got)
+	}
+	if got := ap.LoopCount(); got != 2 {
+		t.Errorf("LoopCount() = %d, want 2", got)
+	}
+
+	wantDelays := []int{10, 20, 30}
+	wantDisposals := []FrameDisposal{DisposalNone, DisposalBackground, DisposalPrevious}
+	for i, f := range frames {
+		if f.Delay != wantDelays[i] || f.Disposal != wantDisposals[i] {
+			t.Errorf("frame %d delay %d disposal %d, want %d and %d", i, f.Delay, f.Disposal, wantDelays[i], wantDisposals[i])
+		}
+	}
+	if got := frames[1].Image.Bounds(); got != image.Rect(10, 5, 15, 10) {
+		t.Errorf("partial frame bounds = %v, want its position on the canvas", got)
+	}
+	if got := color.RGBAModel.Convert(frames[1].Image.At(12, 7)); got != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("frame 1 pixel = %v, want green", got)
+	}
+
+	// FromBytes still takes the first frame.
+	img, err := FromBytes(testAnimatedGIF(t)).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() on a GIF should not error, got: %v", err)
+	}
+	if got := color.RGBAModel.Convert(img.At(12, 7)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("FromBytes() on a GIF = %v at (12,7), want the red first frame", got)
+	}
+}
+
+func TestFromBytesAnimatedStill(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, createTestImage(8, 6)); err != nil {
+		t.Fatal(err)
+	}
+	ap := FromBytesAnimated(buf.Bytes())
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("FromBytesAnimated() on a PNG should not error, got: %v", err)
+	}
+	if len(frames) != 1 || frames[0].Image.Bounds().Size() != image.Pt(8, 6) {
+		t.Errorf("FromBytesAnimated() on a PNG should return the image as a single frame, got %d frames", len(frames))
+	}
+	if got := ap.LoopCount(); got != -1 {
+		t.Errorf("LoopCount() of a still = %d, want -1", got)
+	}
+}
+
+func TestFromBytesAnimatedInvalidInput(t *testing.T) {
+	// Test case: Invalid input
+	if err := FromBytesAnimated(nil).Err(); err == nil {
+		t.Error("FromBytesAnimated() with empty data should return an error")
+	}
+	if err := FromBytesAnimated([]byte("not an image")).Err(); err == nil {
+		t.Error("FromBytesAnimated() with invalid data should return an error")
+	}
+	truncated := testAnimatedGIF(t)
+	if err := FromBytesAnimated(truncated[:len(truncated)/2]).Err(); err == nil {
+		t.Error("FromBytesAnimated() with a truncated GIF should return an error")
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	frames, err := FromBytesAnimated(testAnimatedGIF(t)).Coalesce().Frames()
+	if err != nil {
+		t.Fatalf("Coalesce() should not error, got: %v", err)
+	}
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	transparent := color.RGBA{}
+	cases := []struct {
+		frame int
+		p     image.Point
+		want  color.RGBA
+	}{
+		{0, image.Pt(12, 7), red},
+		{1, image.Pt(12, 7), green},       // Partial frame over the first
+		{1, image.Pt(2, 2), red},          // First frame around it
+		{2, image.Pt(12, 7), transparent}, // Cleared by DisposalBackground
+		{2, image.Pt(2, 2), blue},         // Third frame
+		{2, image.Pt(6, 6), red},          // First frame around it
+	}
+	for _, c := range cases {
+		img := frames[c.frame].Image
+		if img.Bounds() != image.Rect(0, 0, 20, 10) {
+			t.Fatalf("coalesced frame %d bounds = %v, want the canvas", c.frame, img.Bounds())
+		}
+		if got := color.RGBAModel.Convert(img.At(c.p.X, c.p.Y)); got != c.want {
+			t.Errorf("coalesced frame %d at %v = %v, want %v", c.frame, c.p, got, c.want)
+		}
+	}
+	for i, f := range frames {
+		if f.Disposal != DisposalBackground {
+			t.Errorf("coalesced frame %d disposal = %d, want DisposalBackground", i, f.Disposal)
+		}
+	}
+
+	// DisposalPrevious restores what was there before the frame.
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 4, 4), testGIFPalette),
+			image.NewPaletted(image.Rect(0, 0, 2, 2), testGIFPalette),
+			image.NewPaletted(image.Rect(3, 3, 4, 4), testGIFPalette),
+		},
+		Delay:    []int{1, 1, 1},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{ColorModel: testGIFPalette, Width: 4, Height: 4},
+	}
+	for i, index := range []uint8{3, 2, 1} {
+		for j := range g.Image[i].Pix {
+			g.Image[i].Pix[j] = index
+		}
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	frames, _ = FromBytesAnimated(buf.Bytes()).Coalesce().Frames()
+	if got := color.RGBAModel.Convert(frames[2].Image.At(0, 0)); got != blue {
+		t.Errorf("frame after DisposalPrevious at (0,0) = %v, want the restored %v", got, blue)
+	}
+}
+
+func TestAnimationApply(t *testing.T) {
+	ap := FromBytesAnimated(testAnimatedGIF(t)).Apply(func(ip *ImageProcessor) *ImageProcessor {
+		return ip.Resize(10, 5).Grayscale()
+	})
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("Apply() should not error, got: %v", err)
+	}
+	if got := ap.Size(); got != image.Pt(10, 5) {
+		t.Errorf("Apply() canvas = %v, want the processed size (10,5)", got)
+	}
+	for i, f := range frames {
+		if f.Image.Bounds() != image.Rect(0, 0, 10, 5) {
+			t.Errorf("processed frame %d bounds = %v, want the full canvas", i, f.Image.Bounds())
+		}
+		if want := []int{10, 20, 30}[i]; f.Delay != want {
+			t.Errorf("processed frame %d delay = %d, want %d", i, f.Delay, want)
+		}
+	}
+	// The partial green frame is processed together with the red frame
+	// behind it, in gray.
+	r, g, b, _ := frames[1].Image.At(1, 1).RGBA()
+	if r != g || g != b || r == 0 {
+		t.Errorf("processed frame 1 at (1,1) = %d,%d,%d, want the gray of the red behind it", r>>8, g>>8, b>>8)
+	}
+
+	// Crops with offset bounds are moved to the canvas origin.
+	cropped := FromBytesAnimated(testAnimatedGIF(t)).Apply(func(ip *ImageProcessor) *ImageProcessor {
+		return ip.CropView(image.Rect(10, 5, 15, 10))
+	})
+	frames, err = cropped.Frames()
+	if err != nil {
+		t.Fatalf("Apply() with CropView should not error, got: %v", err)
+	}
+	if got := color.RGBAModel.Convert(frames[1].Image.At(0, 0)); frames[1].Image.Bounds().Min != (image.Point{}) || got != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("cropped frame 1 = %v at its origin %v, want green at (0,0)", got, frames[1].Image.Bounds().Min)
+	}
+}
+
+func TestAnimationApplyInvalidInput(t *testing.T) {
+	// Test case: Invalid input
+	if err := FromBytesAnimated(testAnimatedGIF(t)).Apply(nil).Err(); err == nil {
+		t.Error("Apply() with a nil function should return an error")
+	}
+	failing := FromBytesAnimated(testAnimatedGIF(t)).Apply(func(ip *ImageProcessor) *ImageProcessor {
+		return ip.Resize(-1, 5)
+	})
+	if failing.Err() == nil {
+		t.Error("Apply() should return the error of a frame")
+	}
+	n := 0
+	var mu sync.Mutex
+	uneven := FromBytesAnimated(testAnimatedGIF(t)).Apply(func(ip *ImageProcessor) *ImageProcessor {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return ip.Resize(5+n, 5)
+	})
+	if uneven.Err() == nil {
+		t.Error("Apply() producing frames of different sizes should return an error")
+	}
+	if got := uneven.Size(); got != image.Pt(20, 10) {
+		t.Errorf("Apply() with an error should leave the canvas alone, got %v", got)
+	}
+	// A previous error is kept.
+	if err := FromBytesAnimated(nil).Coalesce().Apply(func(ip *ImageProcessor) *ImageProcessor { return ip }).Err(); err == nil {
+		t.Error("Apply() should keep the previous error")
+	}
+}
@@ -0,0 +1,313 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+)
+
+// AnnotationShape selects what an Annotation draws.
+type AnnotationShape int
+
+const (
+	AnnotationArrow   AnnotationShape = iota // Arrow from From to To, with its head at To
+	AnnotationBox                            // Outline of Rect
+	AnnotationEllipse                        // Outline of the ellipse inscribed in Rect
+)
+
+// Annotation is a shape with an optional text label, e.g. an arrow pointing
+// at a button in a screenshot with an explanation at its tail.
+type Annotation struct {
+	Shape     AnnotationShape
+	From, To  image.Point     // Arrow tail and head, in pixels
+	Rect      image.Rectangle // Box or ellipse bounds
+	Label     string          // Text drawn on a background of Color; none if empty
+	Color     color.Color     // Defaults to red
+	LineWidth float64         // Defaults to 3 pixels
+}
+
+// defaultAnnotationColor is the color of annotations without one.
+var defaultAnnotationColor = color.RGBA{230, 30, 30, 255}
+
+const (
+	defaultAnnotationWidth = 3 // Line width of annotations without one
+	labelGap               = 2 // Pixels between a shape and its label
+)
+
+// validate returns an error if the annotation cannot be drawn.
+func (a *Annotation) validate() error {
+	switch a.Shape {
+	case AnnotationArrow:
+		if a.From == a.To {
+			return fmt.Errorf("arrow from %v to itself has no direction", a.From)
+		}
+	case AnnotationBox, AnnotationEllipse:
+		if a.Rect.Canon().Empty() {
+			return fmt.Errorf("rectangle %v is empty", a.Rect)
+		}
+	default:
+		return fmt.Errorf("unknown annotation shape: %d", a.Shape)
+	}
+	if a.LineWidth < 0 || math.IsNaN(a.LineWidth) || math.IsInf(a.LineWidth, 0) {
+		return fmt.Errorf("line width must not be negative (got: %g)", a.LineWidth)
+	}
+	return nil
+}
+
+func (a *Annotation) color() color.Color {
+	if a.Color == nil {
+		return defaultAnnotationColor
+	}
+	return a.Color
+}
+
+func (a *Annotation) lineWidth() float64 {
+	if a.LineWidth == 0 {
+		return defaultAnnotationWidth
+	}
+	return a.LineWidth
+}
+
+// contours returns the contours of the annotation's shape.
+func (a *Annotation) contours() [][]vec2 {
+	width := a.lineWidth()
+	switch a.Shape {
+	case AnnotationBox:
+		return rectOutline(a.Rect, width)
+	case AnnotationEllipse:
+		return ellipseOutline(a.Rect, width)
+	}
+	from, to := pixelCenter(a.From), pixelCenter(a.To)
+	d := to.sub(from)
+	l := d.length()
+	u := d.scale(1 / l)
+	// The head is a triangle half as wide as it is long, scaled with the
+	// line so it stays visible; the shaft ends where the head begins.
+	headLen := min(l, max(10, 4*width))
+	base := to.sub(u.scale(headLen))
+	normal := vec2{-u.Y, u.X}.scale(headLen / 2)
+	head := wound([]vec2{to, base.add(normal), base.sub(normal)})
+	return append(strokeContours([]vec2{from, base}, width, false), head)
+}
+
+// labelCandidates returns where a label of the given size may go next to the
+// shape, most preferred first: behind the tail of an arrow, or above or
+// below the corners of a box or ellipse and then inside its top left.
+func (a *Annotation) labelCandidates(size image.Point) []image.Rectangle {
+	at := func(x, y int) image.Rectangle {
+		return image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)}
+	}
+	if a.Shape == AnnotationArrow {
+		from := pixelCenter(a.From)
+		d := from.sub(pixelCenter(a.To))
+		u := d.scale(1 / d.length())
+		// Move the label's center back from the tail until its edge
+		// clears it.
+		reach := math.Inf(1)
+		if u.X != 0 {
+			reach = float64(size.X) / 2 / math.Abs(u.X)
+		}
+		if u.Y != 0 {
+			reach = min(reach, float64(size.Y)/2/math.Abs(u.Y))
+		}
+		c := from.add(u.scale(reach + labelGap))
+		return []image.Rectangle{at(int(math.Round(c.X-float64(size.X)/2)), int(math.Round(c.Y-float64(size.Y)/2)))}
+	}
+	pad := int(math.Ceil(a.lineWidth() / 2))
+	r := a.Rect.Canon()
+	outer := r.Inset(-pad)
+	return []image.Rectangle{
+		at(outer.Min.X, outer.Min.Y-labelGap-size.Y),
+		at(outer.Min.X, outer.Max.Y+labelGap),
+		at(outer.Max.X-size.X, outer.Min.Y-labelGap-size.Y),
+		at(outer.Max.X-size.X, outer.Max.Y+labelGap),
+		at(r.Min.X+pad+labelGap, r.Min.Y+pad+labelGap),
+	}
+}
+
+// labelAnchor returns the point of the shape a leader line from a label
+// centered at c should end at: the tail of an arrow, or the nearest point
+// of a box or the point of an ellipse in the direction of c.
+func (a *Annotation) labelAnchor(c vec2) vec2 {
+	if a.Shape == AnnotationArrow {
+		return pixelCenter(a.From)
+	}
+	r := a.Rect.Canon()
+	x0, y0 := float64(r.Min.X)+0.5, float64(r.Min.Y)+0.5
+	x1, y1 := float64(r.Max.X)-0.5, float64(r.Max.Y)-0.5
+	center := vec2{(x0 + x1) / 2, (y0 + y1) / 2}
+	if a.Shape == AnnotationEllipse {
+		rx, ry := (x1-x0)/2, (y1-y0)/2
+		sin, cos := math.Sincos(math.Atan2((c.Y-center.Y)*rx, (c.X-center.X)*ry))
+		return vec2{center.X + rx*cos, center.Y + ry*sin}
+	}
+	p := vec2{min(max(c.X, x0), x1), min(max(c.Y, y0), y1)}
+	if p.X > x0 && p.X < x1 && p.Y > y0 && p.Y < y1 {
+		// c is inside the box: go to the nearest edge.
+		dx, dy := min(p.X-x0, x1-p.X), min(p.Y-y0, y1-p.Y)
+		switch {
+		case dx < dy && p.X-x0 < x1-p.X:
+			p.X = x0
+		case dx < dy:
+			p.X = x1
+		case p.Y-y0 < y1-p.Y:
+			p.Y = y0
+		default:
+			p.Y = y1
+		}
+	}
+	return p
+}
+
+// placeLabel returns where a label of the given size goes for a, inside
+// area and clear of the labels already placed where possible. If it is not
+// next to the shape, a leader line from the label to the shape is returned
+// as well.
+func placeLabel(a *Annotation, size image.Point, area image.Rectangle, placed []image.Rectangle) (image.Rectangle, []vec2) {
+	free := func(r image.Rectangle) bool {
+		if !r.In(area) {
+			return false
+		}
+		for _, p := range placed {
+			if r.Overlaps(p) {
+				return false
+			}
+		}
+		return true
+	}
+	candidates := a.labelCandidates(size)
+	for _, r := range candidates {
+		if free(r) {
+			return r, nil
+		}
+	}
+
+	// Move the preferred place away in growing steps until it is free.
+	best := candidates[0]
+	step := image.Pt(size.X+4*labelGap, size.Y+4*labelGap)
+	found := false
+	for k := 1; k <= 8 && !found; k++ {
+		for _, d := range []image.Point{{0, -k * step.Y}, {0, k * step.Y}, {-k * step.X, 0}, {k * step.X, 0}} {
+			if r := best.Add(d); free(r) {
+				best, found = r, true
+				break
+			}
+		}
+	}
+	if !found {
+		// Keep the preferred place, just inside the area.
+		best = best.Add(image.Pt(
+			max(area.Min.X-best.Min.X, min(0, area.Max.X-best.Max.X)),
+			max(area.Min.Y-best.Min.Y, min(0, area.Max.Y-best.Max.Y)),
+		))
+	}
+
+	center := vec2{float64(best.Min.X+best.Max.X) / 2, float64(best.Min.Y+best.Max.Y) / 2}
+	anchor := a.labelAnchor(center)
+	start := vec2{
+		min(max(anchor.X, float64(best.Min.X)), float64(best.Max.X)),
+		min(max(anchor.Y, float64(best.Min.Y)), float64(best.Max.Y)),
+	}
+	if anchor.sub(start).length() <= 2*labelGap+a.lineWidth() {
+		return best, nil
+	}
+	return best, []vec2{start, anchor}
+}
+
+// Annotate draws annotations over the image in order, e.g. to mark up a
+// screenshot. Labels are drawn last, on a rounded background in the color
+// of their shape, next to it where there is room and clear of each other;
+// a label that has to move away is connected to its shape by a leader line.
+// Labels are styled with the AddTextWatermark options such as WithFontBytes,
+// WithFontSize, WithColor and WithBackgroundBox; they default to 14pt white.
+// Coordinates are relative to the image's top-left corner.
+// Returns the ImageProcessor for chaining. An error is set if annotations
+// is empty, an annotation is invalid or the label font cannot be loaded.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Annotate(annotations []Annotation, labelOpts ...WatermarkOption) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if len(annotations) == 0 {
+		ip.err = fmt.Errorf("annotations cannot be empty")
+		return ip
+	}
+	hasLabels := false
+	for i := range annotations {
+		if err := annotations[i].validate(); err != nil {
+			ip.err = fmt.Errorf("invalid annotation %d: %w", i, err)
+			return ip
+		}
+		hasLabels = hasLabels || annotations[i].Label != ""
+	}
+
+	cfg := defaultWatermarkConfig()
+	cfg.FontSize = 14
+	cfg.Color = color.White
+	for _, opt := range labelOpts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		ip.err = fmt.Errorf("invalid annotation label options: %w", err)
+		return ip
+	}
+	var face font.Face
+	if hasLabels {
+		var err error
+		if face, err = cfg.newFace(); err != nil {
+			ip.err = fmt.Errorf("failed to load annotation label font: %w", err)
+			return ip
+		}
+		defer face.Close()
+	}
+
+	bounds := ip.currentImage.Bounds()
+	dst := newRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	area := image.Rectangle{Max: bounds.Size()}
+
+	type label struct {
+		img    *image.RGBA
+		rect   image.Rectangle
+		leader []vec2
+		a      *Annotation
+	}
+	var labels []label
+	var placed []image.Rectangle
+	for i := range annotations {
+		a := &annotations[i]
+		fillContours(dst, translated(a.contours(), bounds.Min), a.color(), true)
+		if a.Label == "" {
+			continue
+		}
+		lc := *cfg
+		lc.Text = a.Label
+		if lc.Box == nil {
+			lc.Box = &textBox{Color: a.color(), PaddingX: 5, PaddingY: 3, Radius: 3}
+		}
+		img, _ := renderTextBlock(face, layoutText(face, &lc), &lc)
+		r, leader := placeLabel(a, img.Rect.Size(), area, placed)
+		placed = append(placed, r)
+		labels = append(labels, label{img: img, rect: r, leader: leader, a: a})
+	}
+	for _, l := range labels {
+		if l.leader != nil {
+			width := max(1, l.a.lineWidth()/2)
+			fillContours(dst, translated(strokeContours(l.leader, width, false), bounds.Min), l.a.color(), true)
+		}
+	}
+	for _, l := range labels {
+		draw.Draw(dst, l.rect.Add(bounds.Min), l.img, image.Point{}, draw.Over)
+	}
+
+	ip.currentImage = dst
+	ip.record("Annotate")
+	return ip
+}
@@ -0,0 +1,137 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// isAnnotationRed reports whether c is close to the default annotation color.
+func isAnnotationRed(c color.RGBA) bool {
+	return c.R > 200 && c.G < 80 && c.B < 80
+}
+
+func TestAnnotateBox(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	box := image.Rect(40, 60, 160, 120)
+
+	img := mustImage(t, New(createUniformImage(200, 160, white)).Annotate([]Annotation{
+		{Shape: AnnotationBox, Rect: box, Label: "Total"},
+	})).(*image.RGBA)
+	if got := img.RGBAAt(100, 60); !isAnnotationRed(got) {
+		t.Errorf("Annotate() box border pixel = %v, want the annotation color", got)
+	}
+	if got := img.RGBAAt(100, 90); got != white {
+		t.Errorf("Annotate() should leave the inside of the box untouched, got %v", got)
+	}
+
+	// The label sits above the top-left corner of the box, on a background
+	// of the box color with white text.
+	red := 0
+	for y := 30; y < 58; y++ {
+		for x := 38; x < 100; x++ {
+			if isAnnotationRed(img.RGBAAt(x, y)) {
+				red++
+			}
+		}
+	}
+	if red < 100 {
+		t.Errorf("Annotate() should draw the label background above the box, found %d red pixels", red)
+	}
+	if got := img.RGBAAt(100, 140); got != white {
+		t.Errorf("Annotate() should not draw the label below the box when there is room above, got %v", got)
+	}
+}
+
+func TestAnnotateArrow(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	img := mustImage(t, New(createUniformImage(200, 100, white)).Annotate([]Annotation{
+		{Shape: AnnotationArrow, From: image.Pt(100, 50), To: image.Pt(180, 50), Label: "Click"},
+	})).(*image.RGBA)
+	for _, p := range []image.Point{{178, 50}, {130, 50}, {101, 50}} {
+		if got := img.RGBAAt(p.X, p.Y); !isAnnotationRed(got) {
+			t.Errorf("Annotate() arrow pixel %v = %v, want the annotation color", p, got)
+		}
+	}
+	if got := img.RGBAAt(171, 47); !isAnnotationRed(got) {
+		t.Errorf("Annotate() arrow head should be wider than the shaft, got %v at (171,47)", got)
+	}
+	if got := img.RGBAAt(182, 50); got != white {
+		t.Errorf("Annotate() arrow should end at its head, got %v past it", got)
+	}
+
+	// The label is behind the tail, to the left of it.
+	if got := img.RGBAAt(94, 50); got == white {
+		t.Error("Annotate() should draw the label just behind the arrow's tail")
+	}
+	if got := img.RGBAAt(100, 40); got != white {
+		t.Errorf("Annotate() label should not cover the tail's surroundings, got %v", got)
+	}
+}
+
+func TestPlaceLabel(t *testing.T) {
+	area := image.Rect(0, 0, 200, 200)
+	size := image.Pt(40, 16)
+	a := &Annotation{Shape: AnnotationBox, Rect: image.Rect(50, 50, 150, 150)}
+
+	first, leader := placeLabel(a, size, area, nil)
+	if leader != nil || first.Max.Y > 50 || first.Min.X > 50 {
+		t.Errorf("placeLabel() = %v with leader %v, want above the top-left corner without one", first, leader)
+	}
+	second, leader := placeLabel(a, size, area, []image.Rectangle{first})
+	if leader != nil || second.Overlaps(first) || second.Min.Y < 150 {
+		t.Errorf("placeLabel() next to a taken place = %v with leader %v, want below the box", second, leader)
+	}
+
+	// Near the top edge the label goes below the box.
+	top := &Annotation{Shape: AnnotationBox, Rect: image.Rect(10, 2, 60, 40)}
+	if r, _ := placeLabel(top, size, area, nil); r.Min.Y < 40 {
+		t.Errorf("placeLabel() at the top edge = %v, want below the box", r)
+	}
+
+	// With every place next to the shape taken, the label moves away and
+	// gets a leader line back to the shape.
+	taken := a.labelCandidates(size)
+	moved, leader := placeLabel(a, size, area, taken)
+	for _, r := range taken {
+		if moved.Overlaps(r) {
+			t.Errorf("placeLabel() = %v overlaps the taken place %v", moved, r)
+		}
+	}
+	if !moved.In(area) {
+		t.Errorf("placeLabel() = %v outside of %v", moved, area)
+	}
+	if len(leader) != 2 {
+		t.Fatalf("placeLabel() away from the shape should return a leader line, got %v", leader)
+	}
+	if end := leader[1]; end.X < 50 || end.X > 150 || end.Y < 50 || end.Y > 150 {
+		t.Errorf("placeLabel() leader line should end on the box, got %v", end)
+	}
+}
+
+func TestAnnotateInvalidInput(t *testing.T) {
+	img := createTestImage(50, 50)
+	box := image.Rect(5, 5, 20, 20)
+
+	// Test case: Invalid input
+	cases := map[string]*ImageProcessor{
+		"no annotations":  New(img).Annotate(nil),
+		"zero arrow":      New(img).Annotate([]Annotation{{Shape: AnnotationArrow, From: image.Pt(3, 3), To: image.Pt(3, 3)}}),
+		"empty rectangle": New(img).Annotate([]Annotation{{Shape: AnnotationBox, Rect: image.Rect(5, 5, 5, 20)}}),
+		"unknown shape":   New(img).Annotate([]Annotation{{Shape: AnnotationShape(42), Rect: box}}),
+		"negative width":  New(img).Annotate([]Annotation{{Shape: AnnotationEllipse, Rect: box, LineWidth: -1}}),
+		"bad font":        New(img).Annotate([]Annotation{{Shape: AnnotationBox, Rect: box, Label: "x"}}, WithFontBytes([]byte("not a font"))),
+		"bad options":     New(img).Annotate([]Annotation{{Shape: AnnotationBox, Rect: box}}, WithMaxWidth(-1)),
+	}
+	for name, proc := range cases {
+		if proc.Err() == nil {
+			t.Errorf("Annotate() with %s should return an error", name)
+		}
+	}
+
+	// Without labels the font is not needed.
+	proc := New(img).Annotate([]Annotation{{Shape: AnnotationBox, Rect: box}}, WithFontBytes([]byte("not a font")))
+	if proc.Err() != nil {
+		t.Errorf("Annotate() without labels should not load the font, got: %v", proc.Err())
+	}
+}
@@ -0,0 +1,111 @@
+package gopiq
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ArchiveEntry is one image written by ExportArchive.
+type ArchiveEntry struct {
+	// Name is the path of the file within the archive, without extension;
+	// the extension of the encoded format (e.g. ".png") is appended.
+	Name      string
+	Processor *ImageProcessor
+}
+
+// archiveConfig holds configuration for ExportArchive.
+type archiveConfig struct {
+	Tar        bool
+	EncodeOpts []EncodeOption
+}
+
+// ArchiveOption is a functional option for configuring ExportArchive.
+type ArchiveOption func(*archiveConfig)
+
+// WithTarArchive writes an uncompressed tar archive instead of a zip file.
+func WithTarArchive() ArchiveOption {
+	return func(ac *archiveConfig) { ac.Tar = true }
+}
+
+// WithArchiveEncodeOptions applies the ToBytes options to every entry, e.g.
+// WithCodecFallback or WithProvenance.
+func WithArchiveEncodeOptions(options ...EncodeOption) ArchiveOption {
+	return func(ac *archiveConfig) { ac.EncodeOpts = append(ac.EncodeOpts, options...) }
+}
+
+// ExportArchive encodes every entry in format and writes them to w as a zip
+// file (or a tar archive with WithTarArchive) in one call, e.g. for
+// "download all sizes" endpoints. Entries are encoded one at a time as the
+// archive is written, so only one encoded image is held in memory. Entries
+// already in a compressed format are stored as is; other formats (e.g. PGM)
+// are deflated in zip files.
+// An error is returned if an entry has no processor, a name is empty or
+// duplicated, a processor has an error or encoding fails; the archive
+// written so far is then incomplete.
+func ExportArchive(w io.Writer, entries []ArchiveEntry, format ImageFormat, options ...ArchiveOption) error {
+	cfg := &archiveConfig{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	seen := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		if entry.Processor == nil {
+			return fmt.Errorf("archive entry %d has no processor", i)
+		}
+		if entry.Name == "" {
+			return fmt.Errorf("archive entry %d has no name", i)
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate archive entry name: %q", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+
+	modified := time.Now()
+	var zw *zip.Writer
+	var tw *tar.Writer
+	if cfg.Tar {
+		tw = tar.NewWriter(w)
+	} else {
+		zw = zip.NewWriter(w)
+	}
+	for _, entry := range entries {
+		data, err := entry.Processor.ToBytes(format, cfg.EncodeOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to encode archive entry %q: %w", entry.Name, err)
+		}
+		actual := DetectFormat(data)
+		name := entry.Name + "." + actual.String()
+
+		if tw != nil {
+			hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modified}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return fmt.Errorf("failed to write archive entry %q: %w", name, err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				return fmt.Errorf("failed to write archive entry %q: %w", name, err)
+			}
+			continue
+		}
+		hdr := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modified}
+		switch actual {
+		case FormatPGM, FormatPPM, FormatPBM, FormatTGA:
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to write archive entry %q: %w", name, err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			return fmt.Errorf("failed to write archive entry %q: %w", name, err)
+		}
+	}
+
+	if tw != nil {
+		return tw.Close()
+	}
+	return zw.Close()
+}
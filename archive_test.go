@@ -0,0 +1,70 @@
+package gopiq
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestExportArchive(t *testing.T) {
+	base := New(createTestImage(80, 60))
+	entries := []ArchiveEntry{
+		{Name: "large", Processor: base.Clone()},
+		{Name: "thumbs/small", Processor: base.Clone().Resize(20, 15)},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportArchive(&buf, entries, FormatPNG); err != nil {
+		t.Fatalf("ExportArchive() should not error, got: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ExportArchive() output should be a zip file, got: %v", err)
+	}
+	wantWidths := map[string]int{"large.png": 80, "thumbs/small.png": 20}
+	if len(zr.File) != len(wantWidths) {
+		t.Fatalf("zip has %d files, want %d", len(zr.File), len(wantWidths))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		img, err := FromBytes(data).Image()
+		if err != nil || img.Bounds().Dx() != wantWidths[f.Name] {
+			t.Errorf("zip entry %s should decode to width %d, got err %v", f.Name, wantWidths[f.Name], err)
+		}
+	}
+
+	// Tar archives and encode options; the extension follows the format produced.
+	buf.Reset()
+	err = ExportArchive(&buf, entries[:1], FormatAVIF,
+		WithTarArchive(), WithArchiveEncodeOptions(WithCodecFallback([]ImageFormat{FormatJPEG})))
+	if err != nil {
+		t.Fatalf("ExportArchive() with WithTarArchive should not error, got: %v", err)
+	}
+	hdr, err := tar.NewReader(&buf).Next()
+	if err != nil || hdr.Name != "large.jpeg" {
+		t.Errorf("tar entry = %v (err %v), want large.jpeg", hdr, err)
+	}
+
+	// Invalid input
+	invalid := map[string][]ArchiveEntry{
+		"nil processor":   {{Name: "a"}},
+		"empty name":      {{Processor: base}},
+		"duplicate name":  {{Name: "a", Processor: base}, {Name: "a", Processor: base}},
+		"processor error": {{Name: "a", Processor: New(nil)}},
+	}
+	for name, entries := range invalid {
+		if err := ExportArchive(io.Discard, entries, FormatPNG); err == nil {
+			t.Errorf("ExportArchive() with %s should return an error", name)
+		}
+	}
+	if err := ExportArchive(io.Discard, entries, FormatGIF); err == nil {
+		t.Error("ExportArchive() with an unsupported format should return an error")
+	}
+}
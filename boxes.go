@@ -0,0 +1,203 @@
+package gopiq
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+)
+
+// LabeledBox is a detected object to draw with DrawBoundingBoxes.
+type LabeledBox struct {
+	Rect       image.Rectangle // Box in pixels, relative to the image's top-left corner
+	Class      string          // Class label; also selects the box color
+	Confidence float64         // Detection score in [0, 1]
+}
+
+// boundingBoxConfig holds the options of DrawBoundingBoxes.
+type boundingBoxConfig struct {
+	LineWidth      float64
+	Colors         map[string]color.Color
+	ShowConfidence bool
+	MinConfidence  float64
+	LabelOpts      []WatermarkOption
+}
+
+// BoundingBoxOption is a functional option for DrawBoundingBoxes.
+type BoundingBoxOption func(*boundingBoxConfig)
+
+func defaultBoundingBoxConfig() *boundingBoxConfig {
+	return &boundingBoxConfig{LineWidth: 2, ShowConfidence: true}
+}
+
+// WithClassColors sets the colors of the given classes. Other classes get a
+// color from a built-in palette that is the same for the same class name.
+func WithClassColors(colors map[string]color.Color) BoundingBoxOption {
+	return func(bc *boundingBoxConfig) { bc.Colors = colors }
+}
+
+// WithBoxLineWidth sets the width of the box outlines in pixels (default 2).
+func WithBoxLineWidth(width float64) BoundingBoxOption {
+	return func(bc *boundingBoxConfig) { bc.LineWidth = width }
+}
+
+// WithConfidence controls whether labels show the confidence after the
+// class (the default).
+func WithConfidence(show bool) BoundingBoxOption {
+	return func(bc *boundingBoxConfig) { bc.ShowConfidence = show }
+}
+
+// WithMinConfidence skips boxes with a confidence below threshold, e.g. to
+// hide weak detections without filtering them beforehand.
+func WithMinConfidence(threshold float64) BoundingBoxOption {
+	return func(bc *boundingBoxConfig) { bc.MinConfidence = threshold }
+}
+
+// WithBoxLabelStyle styles the labels with AddTextWatermark options such as
+// WithFontBytes and WithFontSize. Labels default to 12pt in black or white,
+// whichever stands out from the box color.
+func WithBoxLabelStyle(opts ...WatermarkOption) BoundingBoxOption {
+	return func(bc *boundingBoxConfig) { bc.LabelOpts = opts }
+}
+
+// classPalette holds distinct colors for classes without one set with
+// WithClassColors.
+var classPalette = []color.RGBA{
+	{31, 119, 180, 255}, {255, 127, 14, 255}, {44, 160, 44, 255}, {214, 39, 40, 255},
+	{148, 103, 189, 255}, {140, 86, 75, 255}, {227, 119, 194, 255}, {127, 127, 127, 255},
+	{188, 189, 34, 255}, {23, 190, 207, 255}, {255, 215, 0, 255}, {0, 128, 128, 255},
+}
+
+// classColor returns the color of class.
+func (cfg *boundingBoxConfig) classColor(class string) color.Color {
+	if c, ok := cfg.Colors[class]; ok {
+		return c
+	}
+	h := fnv.New32a()
+	h.Write([]byte(class))
+	return classPalette[h.Sum32()%uint32(len(classPalette))]
+}
+
+// label returns the label text of b, or "" if it has none.
+func (cfg *boundingBoxConfig) label(b *LabeledBox) string {
+	switch {
+	case !cfg.ShowConfidence:
+		return b.Class
+	case b.Class == "":
+		return fmt.Sprintf("%.2f", b.Confidence)
+	default:
+		return fmt.Sprintf("%s %.2f", b.Class, b.Confidence)
+	}
+}
+
+// DrawBoundingBoxes draws object detection results over the image: the
+// outline of each box in the color of its class with a label bar holding
+// the class and confidence on top of it, or just inside the box if there
+// is no room above. Boxes are drawn in order, so later labels cover earlier
+// ones; pass them by ascending confidence to keep the strongest on top.
+// Returns the ImageProcessor for chaining. An error is set if a box is
+// empty, a confidence is not between 0 and 1, a class color is nil, the
+// line width is not positive or the label font cannot be loaded.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawBoundingBoxes(boxes []LabeledBox, opts ...BoundingBoxOption) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	cfg := defaultBoundingBoxConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.LineWidth <= 0 || math.IsNaN(cfg.LineWidth) || math.IsInf(cfg.LineWidth, 0) {
+		ip.err = fmt.Errorf("bounding box line width must be positive (got: %g)", cfg.LineWidth)
+		return ip
+	}
+	for class, c := range cfg.Colors {
+		if c == nil {
+			ip.err = fmt.Errorf("color of class %q cannot be nil", class)
+			return ip
+		}
+	}
+	var visible []*LabeledBox
+	for i := range boxes {
+		b := &boxes[i]
+		if b.Rect.Canon().Empty() {
+			ip.err = fmt.Errorf("bounding box %d is empty: %v", i, b.Rect)
+			return ip
+		}
+		if !(b.Confidence >= 0 && b.Confidence <= 1) {
+			ip.err = fmt.Errorf("bounding box %d confidence must be between 0 and 1 (got: %g)", i, b.Confidence)
+			return ip
+		}
+		if b.Confidence >= cfg.MinConfidence {
+			visible = append(visible, b)
+		}
+	}
+
+	label := defaultWatermarkConfig()
+	label.FontSize = 12
+	label.Color = nil
+	for _, opt := range cfg.LabelOpts {
+		opt(label)
+	}
+	if err := label.validate(); err != nil {
+		ip.err = fmt.Errorf("invalid bounding box label options: %w", err)
+		return ip
+	}
+	var face font.Face
+	for _, b := range visible {
+		if cfg.label(b) != "" {
+			var err error
+			if face, err = label.newFace(); err != nil {
+				ip.err = fmt.Errorf("failed to load bounding box label font: %w", err)
+				return ip
+			}
+			defer face.Close()
+			break
+		}
+	}
+
+	bounds := ip.currentImage.Bounds()
+	dst := newRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	pad := int(math.Ceil(cfg.LineWidth / 2))
+	for _, b := range visible {
+		c := cfg.classColor(b.Class)
+		fillContours(dst, translated(rectOutline(b.Rect, cfg.LineWidth), bounds.Min), c, true)
+
+		text := cfg.label(b)
+		if text == "" {
+			continue
+		}
+		lc := *label
+		lc.Text = text
+		if lc.Color == nil {
+			lc.Color = color.White
+			if r, g, bl := straightRGB(c); luminance(uint8(r), uint8(g), uint8(bl)) > 140 {
+				lc.Color = color.Black
+			}
+		}
+		lc.Box = &textBox{Color: c, PaddingX: 3, PaddingY: 1}
+		img, _ := renderTextBlock(face, layoutText(face, &lc), &lc)
+
+		// The bar sits on the outline's top-left corner, or over it inside
+		// the box at the top of the image.
+		outer := b.Rect.Canon().Inset(-pad)
+		at := image.Pt(outer.Min.X, outer.Min.Y-img.Rect.Dy())
+		if at.Y < 0 {
+			at.Y = max(0, outer.Min.Y)
+		}
+		at.X = max(0, min(at.X, bounds.Dx()-img.Rect.Dx()))
+		draw.Draw(dst, img.Rect.Add(at.Add(bounds.Min)), img, image.Point{}, draw.Over)
+	}
+
+	ip.currentImage = dst
+	ip.record("DrawBoundingBoxes")
+	return ip
+}
@@ -0,0 +1,107 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDrawBoundingBoxes(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	person := color.RGBA{0, 0, 200, 255}
+	boxes := []LabeledBox{
+		{Rect: image.Rect(20, 40, 100, 140), Class: "person", Confidence: 0.91},
+		{Rect: image.Rect(120, 2, 180, 60), Class: "dog", Confidence: 0.55},
+	}
+
+	img := mustImage(t, New(createUniformImage(200, 160, white)).DrawBoundingBoxes(boxes, WithClassColors(map[string]color.Color{"person": person}))).(*image.RGBA)
+	if got := img.RGBAAt(60, 139); got != person {
+		t.Errorf("DrawBoundingBoxes() border pixel = %v, want the class color %v", got, person)
+	}
+	if got := img.RGBAAt(60, 90); got != white {
+		t.Errorf("DrawBoundingBoxes() should leave the inside of the box untouched, got %v", got)
+	}
+
+	// The label bar sits on top of the box, starting at its left edge.
+	if got := img.RGBAAt(21, 36); got != person {
+		t.Errorf("DrawBoundingBoxes() label bar = %v, want the class color above the box", got)
+	}
+	textPixels := 0
+	for y := 25; y < 39; y++ {
+		for x := 20; x < 100; x++ {
+			if c := img.RGBAAt(x, y); c.R > 200 && c.G > 200 && c.B > 200 {
+				textPixels++
+			}
+		}
+	}
+	if textPixels == 0 {
+		t.Error("DrawBoundingBoxes() should draw white label text on a dark class color")
+	}
+
+	// Without room above, the label goes inside the top of the box.
+	dog := img.RGBAAt(122, 4)
+	if dog == white || dog != img.RGBAAt(150, 59) {
+		t.Errorf("DrawBoundingBoxes() label at the top edge = %v, want the dog class color %v", dog, img.RGBAAt(150, 59))
+	}
+}
+
+func TestDrawBoundingBoxesOptions(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	boxes := []LabeledBox{
+		{Rect: image.Rect(10, 30, 60, 80), Class: "cat", Confidence: 0.3},
+		{Rect: image.Rect(70, 30, 120, 80), Class: "cat", Confidence: 0.8},
+	}
+
+	img := mustImage(t, New(createUniformImage(130, 90, white)).DrawBoundingBoxes(boxes, WithMinConfidence(0.5))).(*image.RGBA)
+	if got := img.RGBAAt(10, 50); got != white {
+		t.Errorf("DrawBoundingBoxes() should skip boxes below the minimum confidence, got %v", got)
+	}
+	if got := img.RGBAAt(70, 50); got == white {
+		t.Error("DrawBoundingBoxes() should draw boxes above the minimum confidence")
+	}
+
+	// The same class always gets the same color.
+	cfg := defaultBoundingBoxConfig()
+	if cfg.classColor("cat") != cfg.classColor("cat") || cfg.classColor("cat") == cfg.classColor("car") {
+		t.Error("classColor() should be stable per class and differ between these classes")
+	}
+
+	if got := cfg.label(&boxes[0]); got != "cat 0.30" {
+		t.Errorf("label() = %q, want %q", got, "cat 0.30")
+	}
+	WithConfidence(false)(cfg)
+	if got := cfg.label(&boxes[0]); got != "cat" {
+		t.Errorf("label() without confidence = %q, want %q", got, "cat")
+	}
+
+	wide := mustImage(t, New(createUniformImage(130, 90, white)).DrawBoundingBoxes(boxes[1:], WithBoxLineWidth(5), WithConfidence(false))).(*image.RGBA)
+	if got := wide.RGBAAt(68, 50); got == white {
+		t.Error("DrawBoundingBoxes() with a 5px line should widen the outline outward")
+	}
+
+	// No detections leave the image as it is.
+	if err := New(createUniformImage(10, 10, white)).DrawBoundingBoxes(nil).Err(); err != nil {
+		t.Errorf("DrawBoundingBoxes() with no boxes should not error, got: %v", err)
+	}
+}
+
+func TestDrawBoundingBoxesInvalidInput(t *testing.T) {
+	img := createTestImage(50, 50)
+	box := LabeledBox{Rect: image.Rect(5, 5, 20, 20), Class: "a", Confidence: 0.5}
+
+	// Test case: Invalid input
+	cases := map[string]*ImageProcessor{
+		"empty box":       New(img).DrawBoundingBoxes([]LabeledBox{{Rect: image.Rect(5, 5, 5, 9), Confidence: 0.5}}),
+		"high confidence": New(img).DrawBoundingBoxes([]LabeledBox{{Rect: box.Rect, Confidence: 1.5}}),
+		"NaN confidence":  New(img).DrawBoundingBoxes([]LabeledBox{{Rect: box.Rect, Confidence: math.NaN()}}),
+		"zero width":      New(img).DrawBoundingBoxes([]LabeledBox{box}, WithBoxLineWidth(0)),
+		"nil class color": New(img).DrawBoundingBoxes([]LabeledBox{box}, WithClassColors(map[string]color.Color{"a": nil})),
+		"bad font":        New(img).DrawBoundingBoxes([]LabeledBox{box}, WithBoxLabelStyle(WithFontBytes([]byte("not a font")))),
+	}
+	for name, proc := range cases {
+		if proc.Err() == nil {
+			t.Errorf("DrawBoundingBoxes() with %s should return an error", name)
+		}
+	}
+}
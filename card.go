@@ -0,0 +1,223 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// CardTemplate describes the fixed layout and styling of a social card, e.g.
+// an Open Graph preview image. The zero value of any field falls back to the
+// corresponding field of DefaultCardTemplate.
+type CardTemplate struct {
+	Width, Height    int
+	Padding          int
+	Background       color.Color // Used when CardData has no background image
+	Overlay          color.Color // Drawn over the background image to keep text readable
+	AvatarSize       int
+	TitleFont        []byte
+	TitleFontSize    float64
+	TitleMinFontSize float64 // When set, the title shrinks towards this size to fit its area
+	TitleColor       color.Color
+	FooterFont       []byte
+	FooterFontSize   float64
+	FooterColor      color.Color
+	LogoHeight       int
+}
+
+// CardData holds the per-card content rendered into a CardTemplate.
+// All fields are optional except Title.
+type CardData struct {
+	Background image.Image // Scaled to cover the card
+	Avatar     image.Image // Cropped to a circle in the top-left corner
+	Title      string      // Word-wrapped to the card width
+	Footer     string      // Single line in the bottom-left corner
+	Logo       image.Image // Scaled to LogoHeight in the bottom-right corner
+}
+
+// DefaultCardTemplate returns a 1200x630 Open Graph card layout.
+func DefaultCardTemplate() CardTemplate {
+	return CardTemplate{
+		Width:          1200,
+		Height:         630,
+		Padding:        64,
+		Background:     color.RGBA{24, 26, 38, 255},
+		Overlay:        color.RGBA{0, 0, 0, 140},
+		AvatarSize:     120,
+		TitleFont:      gobold.TTF,
+		TitleFontSize:  64,
+		TitleColor:     color.White,
+		FooterFont:     goregular.TTF,
+		FooterFontSize: 28,
+		FooterColor:    color.RGBA{200, 200, 210, 255},
+		LogoHeight:     56,
+	}
+}
+
+// withDefaults fills zero fields of t from DefaultCardTemplate.
+func (t CardTemplate) withDefaults() CardTemplate {
+	d := DefaultCardTemplate()
+	if t.Width == 0 || t.Height == 0 {
+		t.Width, t.Height = d.Width, d.Height
+	}
+	if t.Padding == 0 {
+		t.Padding = d.Padding
+	}
+	if t.Background == nil {
+		t.Background = d.Background
+	}
+	if t.Overlay == nil {
+		t.Overlay = d.Overlay
+	}
+	if t.AvatarSize == 0 {
+		t.AvatarSize = d.AvatarSize
+	}
+	if t.TitleFont == nil {
+		t.TitleFont = d.TitleFont
+	}
+	if t.TitleFontSize == 0 {
+		t.TitleFontSize = d.TitleFontSize
+	}
+	if t.TitleColor == nil {
+		t.TitleColor = d.TitleColor
+	}
+	if t.FooterFont == nil {
+		t.FooterFont = d.FooterFont
+	}
+	if t.FooterFontSize == 0 {
+		t.FooterFontSize = d.FooterFontSize
+	}
+	if t.FooterColor == nil {
+		t.FooterColor = d.FooterColor
+	}
+	if t.LogoHeight == 0 {
+		t.LogoHeight = d.LogoHeight
+	}
+	return t
+}
+
+// ComposeCard renders a social card (background, avatar, wrapped title,
+// footer text and logo) and returns a new ImageProcessor holding it, so the
+// result can be further processed or encoded directly.
+// An error is set on the returned processor if the title is empty, the
+// dimensions are invalid, the padding is negative or a font cannot be
+// loaded.
+func ComposeCard(template CardTemplate, data CardData) *ImageProcessor {
+	tpl := template.withDefaults()
+	if tpl.Width < 0 || tpl.Height < 0 {
+		return &ImageProcessor{err: fmt.Errorf("card dimensions must be positive (width: %d, height: %d)", tpl.Width, tpl.Height)}
+	}
+	if tpl.Padding < 0 {
+		return &ImageProcessor{err: fmt.Errorf("card padding must not be negative (got: %d)", tpl.Padding)}
+	}
+	if data.Title == "" {
+		return &ImageProcessor{err: fmt.Errorf("card title cannot be empty")}
+	}
+
+	footerFace, err := newFontFace(tpl.FooterFont, tpl.FooterFontSize)
+	if err != nil {
+		return &ImageProcessor{err: fmt.Errorf("failed to load card footer font: %w", err)}
+	}
+	defer footerFace.Close()
+
+	pad := tpl.Padding
+	contentTop := pad
+	if data.Avatar != nil {
+		contentTop = pad + tpl.AvatarSize + pad/2
+	}
+	titleBottom := tpl.Height - pad - max(tpl.LogoHeight, footerFace.Metrics().Height.Ceil()) - pad/2
+
+	titleSize := tpl.TitleFontSize
+	if tpl.TitleMinFontSize > 0 && tpl.TitleMinFontSize < titleSize {
+		titleBox := image.Rect(pad, contentTop, tpl.Width-pad, titleBottom)
+		if size, err := FitText(data.Title, titleBox, tpl.TitleMinFontSize, titleSize, WithFontBytes(tpl.TitleFont)); err == nil {
+			titleSize = size
+		} else {
+			// Too long even at the minimum size: render at the minimum and truncate.
+			titleSize = tpl.TitleMinFontSize
+		}
+	}
+	titleFace, err := newFontFace(tpl.TitleFont, titleSize)
+	if err != nil {
+		return &ImageProcessor{err: fmt.Errorf("failed to load card title font: %w", err)}
+	}
+	defer titleFace.Close()
+
+	cardRect := image.Rect(0, 0, tpl.Width, tpl.Height)
+	card := newRGBA(cardRect)
+
+	// Background
+	if data.Background != nil {
+		bgBounds := data.Background.Bounds()
+		draw.CatmullRom.Scale(card, cardRect, data.Background, coverRect(bgBounds, cardRect.Size()), draw.Src, nil)
+		draw.Draw(card, cardRect, image.NewUniform(tpl.Overlay), image.Point{}, draw.Over)
+	} else {
+		draw.Draw(card, cardRect, image.NewUniform(tpl.Background), image.Point{}, draw.Src)
+	}
+
+	// Avatar
+	if data.Avatar != nil {
+		avatarRect := image.Rect(pad, pad, pad+tpl.AvatarSize, pad+tpl.AvatarSize)
+		avatar := newRGBA(image.Rect(0, 0, tpl.AvatarSize, tpl.AvatarSize))
+		draw.CatmullRom.Scale(avatar, avatar.Bounds(), data.Avatar, coverRect(data.Avatar.Bounds(), avatar.Bounds().Size()), draw.Src, nil)
+		draw.DrawMask(card, avatarRect, avatar, image.Point{}, circleMask(tpl.AvatarSize), image.Point{}, draw.Over)
+	}
+
+	// Footer row: logo on the right, text on the left.
+	footerBaseline := tpl.Height - pad
+	textRight := tpl.Width - pad
+	if data.Logo != nil {
+		lb := data.Logo.Bounds()
+		logoW := max(1, lb.Dx()*tpl.LogoHeight/max(1, lb.Dy()))
+		logoRect := image.Rect(tpl.Width-pad-logoW, tpl.Height-pad-tpl.LogoHeight, tpl.Width-pad, tpl.Height-pad)
+		draw.CatmullRom.Scale(card, logoRect, data.Logo, lb, draw.Over, nil)
+		textRight = logoRect.Min.X - pad/2
+	}
+	if data.Footer != "" {
+		dr := &font.Drawer{Dst: card, Src: image.NewUniform(tpl.FooterColor), Face: footerFace}
+		dr.Dot = fixed.P(pad, footerBaseline-footerFace.Metrics().Descent.Ceil())
+		dr.DrawString(truncateText(footerFace, data.Footer, float64(textRight-pad)))
+	}
+
+	// Title, wrapped to the card width between the avatar and the footer.
+	lines := wrapText(titleFace, data.Title, float64(tpl.Width-2*pad))
+	lineHeight := titleFace.Metrics().Height.Ceil()
+	if maxLines := (titleBottom - contentTop) / max(1, lineHeight); len(lines) > maxLines && maxLines > 0 {
+		lines = lines[:maxLines]
+		lines[maxLines-1] = truncateText(titleFace, lines[maxLines-1]+"…", float64(tpl.Width-2*pad))
+	}
+	dr := &font.Drawer{Dst: card, Src: image.NewUniform(tpl.TitleColor), Face: titleFace}
+	for i, line := range lines {
+		dr.Dot = fixed.P(pad, contentTop+i*lineHeight+titleFace.Metrics().Ascent.Ceil())
+		dr.DrawString(line)
+	}
+
+	return &ImageProcessor{
+		currentImage: card,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         card.Rect.Size(),
+	}
+}
+
+// circleMask returns a size x size alpha mask of an antialiased filled circle.
+func circleMask(size int) *image.Alpha {
+	r := size / 2
+	k := 0.5523 * float64(r) // Cubic Bézier control distance for a quarter circle
+	c := func(v float64) int { return int(v + 0.5) }
+	fr := float64(r)
+	path := []PathSegment{
+		MoveTo(size, r),
+		CubeTo(size, c(fr+k), c(fr+k), size, r, size),
+		CubeTo(c(fr-k), size, 0, c(fr+k), 0, r),
+		CubeTo(0, c(fr-k), c(fr-k), 0, r, 0),
+		CubeTo(c(fr+k), 0, size, c(fr-k), size, r),
+		ClosePath(),
+	}
+	return rasterizePath(path, image.Rect(0, 0, size, size), true)
+}
@@ -0,0 +1,61 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestComposeCard(t *testing.T) {
+	data := CardData{
+		Background: createTestImage(800, 600),
+		Avatar:     createTestImage(64, 64),
+		Title:      "A surprisingly long article title that certainly needs to wrap across several lines of the card",
+		Footer:     "example.com",
+		Logo:       createTestImage(100, 40),
+	}
+
+	proc := ComposeCard(CardTemplate{}, data)
+	if proc.Err() != nil {
+		t.Fatalf("ComposeCard() should not error, got: %v", proc.Err())
+	}
+	if size := proc.currentImage.Bounds().Size(); size != (image.Point{1200, 630}) {
+		t.Errorf("ComposeCard() default size = %v, want 1200x630", size)
+	}
+	if _, err := proc.ToBytes(FormatPNG); err != nil {
+		t.Errorf("Composed card should be encodable: %v", err)
+	}
+
+	// Title fitting shrinks the title instead of truncating it.
+	proc = ComposeCard(CardTemplate{TitleMinFontSize: 24}, data)
+	if proc.Err() != nil {
+		t.Fatalf("ComposeCard() with title fitting should not error, got: %v", proc.Err())
+	}
+
+	// Custom size and plain background, no optional parts.
+	bg := color.RGBA{10, 20, 30, 255}
+	proc = ComposeCard(CardTemplate{Width: 600, Height: 300, Background: bg}, CardData{Title: "Hi"})
+	if proc.Err() != nil {
+		t.Fatalf("ComposeCard() with minimal data should not error, got: %v", proc.Err())
+	}
+	if size := proc.currentImage.Bounds().Size(); size != (image.Point{600, 300}) {
+		t.Errorf("ComposeCard() custom size = %v, want 600x300", size)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(599, 0)); got != bg {
+		t.Errorf("ComposeCard() background = %v, want %v", got, bg)
+	}
+
+	// Invalid input
+	if ComposeCard(CardTemplate{}, CardData{}).Err() == nil {
+		t.Error("ComposeCard() without title should return an error")
+	}
+	if ComposeCard(CardTemplate{TitleFont: []byte{1, 2, 3}}, CardData{Title: "x"}).Err() == nil {
+		t.Error("ComposeCard() with invalid font should return an error")
+	}
+	if ComposeCard(CardTemplate{Width: -5, Height: 100}, CardData{Title: "x"}).Err() == nil {
+		t.Error("ComposeCard() with negative width should return an error")
+	}
+	if ComposeCard(CardTemplate{Padding: -10}, CardData{Title: "x"}).Err() == nil {
+		t.Error("ComposeCard() with negative padding should return an error")
+	}
+}
@@ -0,0 +1,74 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"sync"
+)
+
+// DecodeFunc decodes an image of a registered format. See RegisterDecoder.
+type DecodeFunc func(r io.Reader) (image.Image, error)
+
+// EncodeFunc encodes img in a registered format. See RegisterEncoder.
+type EncodeFunc func(w io.Writer, img image.Image) error
+
+var (
+	codecsMu sync.RWMutex
+	decoders = map[ImageFormat]DecodeFunc{}
+	encoders = map[ImageFormat]EncodeFunc{}
+)
+
+// RegisterDecoder makes FromBytes, FromReaderAt and ProbeReaderAt decode
+// data that DetectFormat identifies as format with fn, so a separate module
+// can add e.g. AVIF, HEIC or JPEG XL support, typically from its init
+// function. It replaces any decoder registered before, including the
+// built-in one. Returns an error if format is FormatUnknown or fn is nil.
+// This function is safe for concurrent use.
+func RegisterDecoder(format ImageFormat, fn DecodeFunc) error {
+	if format == FormatUnknown {
+		return fmt.Errorf("cannot register a decoder for an unknown format")
+	}
+	if fn == nil {
+		return fmt.Errorf("decoder for %s cannot be nil", format)
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	decoders[format] = fn
+	return nil
+}
+
+// RegisterEncoder makes ToBytes encode format with fn, replacing any encoder
+// registered before, including the built-in one. An encoder may return an
+// error wrapping ErrUnsupportedFormat, e.g. when a shared library it needs
+// is missing, for WithCodecFallback to try the next format. Returns an
+// error if format is FormatUnknown or fn is nil.
+// This function is safe for concurrent use.
+func RegisterEncoder(format ImageFormat, fn EncodeFunc) error {
+	if format == FormatUnknown {
+		return fmt.Errorf("cannot register an encoder for an unknown format")
+	}
+	if fn == nil {
+		return fmt.Errorf("encoder for %s cannot be nil", format)
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	encoders[format] = fn
+	return nil
+}
+
+// registeredDecoder returns the decoder registered for format.
+func registeredDecoder(format ImageFormat) (DecodeFunc, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	fn, ok := decoders[format]
+	return fn, ok
+}
+
+// registeredEncoder returns the encoder registered for format.
+func registeredEncoder(format ImageFormat) (EncodeFunc, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	fn, ok := encoders[format]
+	return fn, ok
+}
@@ -0,0 +1,105 @@
+package gopiq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// registerTestCodec registers a JPEG XL codec that stores the size and the
+// top-left gray level of an image after the codestream signature, and
+// removes it when the test ends.
+func registerTestCodec(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		defer codecsMu.Unlock()
+		delete(decoders, FormatJXL)
+		delete(encoders, FormatJXL)
+	})
+	err := RegisterEncoder(FormatJXL, func(w io.Writer, img image.Image) error {
+		b := img.Bounds()
+		y := color.GrayModel.Convert(img.At(b.Min.X, b.Min.Y)).(color.Gray).Y
+		_, err := w.Write([]byte{0xff, 0x0a, byte(b.Dx()), byte(b.Dy()), y})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RegisterDecoder(FormatJXL, func(r io.Reader) (image.Image, error) {
+		var data [5]byte
+		if _, err := io.ReadFull(r, data[:]); err != nil {
+			return nil, err
+		}
+		img := image.NewGray(image.Rect(0, 0, int(data[2]), int(data[3])))
+		for i := range img.Pix {
+			img.Pix[i] = data[4]
+		}
+		return img, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	registerTestCodec(t)
+	src := createUniformImage(30, 20, color.RGBA{200, 200, 200, 255})
+
+	data, err := New(src).ToBytes(FormatJXL)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatJXL) with a registered encoder should not error, got: %v", err)
+	}
+	if got := DetectFormat(data); got != FormatJXL {
+		t.Fatalf("registered encoder output detected as %s, want jxl", got)
+	}
+	img := mustImage(t, FromBytes(data))
+	if img.Bounds() != src.Bounds() || img.(*image.Gray).Pix[0] != 200 {
+		t.Errorf("FromBytes() with a registered decoder = %v, want the encoded image", img.Bounds())
+	}
+	img = mustImage(t, FromReaderAt(bytes.NewReader(data), int64(len(data)), WithGrayDecode()))
+	if img.Bounds() != src.Bounds() {
+		t.Errorf("FromReaderAt() with a registered decoder decoded %v, want %v", img.Bounds(), src.Bounds())
+	}
+	info, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil || info != (ImageInfo{Width: 30, Height: 20, Format: FormatJXL}) {
+		t.Errorf("ProbeReaderAt() = %+v, %v, want 30x20 jxl", info, err)
+	}
+
+	// A registered format can lead a fallback chain.
+	data, err = New(src).ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatJXL, FormatJPEG}))
+	if err != nil || DetectFormat(data) != FormatJXL {
+		t.Errorf("ToBytes() falling back to a registered format = %s, %v, want jxl", DetectFormat(data), err)
+	}
+	// An encoder can report itself unavailable to fall back further.
+	if err := RegisterEncoder(FormatJXL, func(io.Writer, image.Image) error {
+		return fmt.Errorf("%w: libjxl not found", ErrUnsupportedFormat)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data, err = New(src).ToBytes(FormatJXL, WithCodecFallback([]ImageFormat{FormatPNG}))
+	if err != nil || DetectFormat(data) != FormatPNG {
+		t.Errorf("ToBytes() with an unavailable registered encoder = %s, %v, want png", DetectFormat(data), err)
+	}
+
+	// Test case: Invalid input
+	if err := RegisterDecoder(FormatUnknown, func(io.Reader) (image.Image, error) { return nil, nil }); err == nil {
+		t.Error("RegisterDecoder(FormatUnknown) should return an error")
+	}
+	if err := RegisterDecoder(FormatHEIC, nil); err == nil {
+		t.Error("RegisterDecoder() with a nil decoder should return an error")
+	}
+	if err := RegisterEncoder(FormatUnknown, func(io.Writer, image.Image) error { return nil }); err == nil {
+		t.Error("RegisterEncoder(FormatUnknown) should return an error")
+	}
+	if err := RegisterEncoder(FormatHEIC, nil); err == nil {
+		t.Error("RegisterEncoder() with a nil encoder should return an error")
+	}
+	if err := FromBytes([]byte{0xff, 0x0a, 1}).Err(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("FromBytes() of truncated data = %v, want the registered decoder's error", err)
+	}
+}
@@ -0,0 +1,422 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// heatmapStops is the color ramp used by DiffHeatmap, from no difference
+// (black) through purple, red and orange to maximal difference (pale yellow).
+var heatmapStops = []color.RGBA{
+	{0, 0, 0, 255},
+	{80, 18, 123, 255},
+	{200, 40, 60, 255},
+	{250, 140, 20, 255},
+	{252, 255, 164, 255},
+}
+
+// heatmapIgnored is the DiffHeatmap color of blocks excluded from comparison.
+var heatmapIgnored = color.RGBA{96, 96, 96, 255}
+
+// heatColor maps t in [0, 1] onto the heatmap color ramp.
+func heatColor(t float64) color.RGBA {
+	t = min(max(t, 0), 1)
+	pos := t * float64(len(heatmapStops)-1)
+	i := min(int(pos), len(heatmapStops)-2)
+	f := pos - float64(i)
+	a, b := heatmapStops[i], heatmapStops[i+1]
+	lerp := func(x, y uint8) uint8 { return clampUint8(float64(x) + (float64(y)-float64(x))*f) }
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
+
+// compareConfig holds configuration shared by the comparison APIs.
+type compareConfig struct {
+	IgnoreRegions []image.Rectangle
+	Tolerance     uint8
+}
+
+// CompareOption is a functional option for configuring image comparisons.
+type CompareOption func(*compareConfig)
+
+// WithIgnoreRegions excludes the given rectangles (in the compared image's
+// coordinates) from comparison, e.g. clocks, ads or other volatile content
+// in screenshot tests.
+func WithIgnoreRegions(rects []image.Rectangle) CompareOption {
+	return func(cc *compareConfig) { cc.IgnoreRegions = append(cc.IgnoreRegions, rects...) }
+}
+
+// WithPerPixelTolerance treats channel differences of up to d as equal, so
+// antialiasing and compression noise do not register as changes.
+func WithPerPixelTolerance(d uint8) CompareOption {
+	return func(cc *compareConfig) { cc.Tolerance = d }
+}
+
+// newCompareConfig applies options to a default configuration.
+func newCompareConfig(options []CompareOption) *compareConfig {
+	cfg := &compareConfig{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// ignoreMask returns a width*height mask that is true for ignored pixels, or
+// nil if no regions are ignored. origin is the top-left corner of the
+// compared image in the coordinate space of the regions.
+func (cc *compareConfig) ignoreMask(width, height int, origin image.Point) []bool {
+	if len(cc.IgnoreRegions) == 0 {
+		return nil
+	}
+	mask := make([]bool, width*height)
+	for _, r := range cc.IgnoreRegions {
+		r = r.Sub(origin).Intersect(image.Rect(0, 0, width, height))
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				mask[y*width+x] = true
+			}
+		}
+	}
+	return mask
+}
+
+// channelDiff returns the difference of two channel values after applying
+// the tolerance.
+func (cc *compareConfig) channelDiff(a, b uint8) int {
+	d := absDiff(a, b)
+	if d <= int(cc.Tolerance) {
+		return 0
+	}
+	return d
+}
+
+// cellDifferences splits two equally sized images into cell x cell blocks and
+// returns the mean absolute channel difference (0-255) of every block,
+// indexed [row][column]. Edge blocks may be smaller than cell. Blocks that
+// are entirely ignored are reported as -1.
+func cellDifferences(a, b *image.RGBA, cell int, cfg *compareConfig, ignore []bool) [][]float64 {
+	width, height := a.Rect.Dx(), a.Rect.Dy()
+	rows, cols := (height+cell-1)/cell, (width+cell-1)/cell
+	grid := make([][]float64, rows)
+
+	for row := range grid {
+		grid[row] = make([]float64, cols)
+		for col := range grid[row] {
+			x0, y0 := col*cell, row*cell
+			x1, y1 := min(x0+cell, width), min(y0+cell, height)
+			sum, counted := 0, 0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					if ignore != nil && ignore[y*width+x] {
+						continue
+					}
+					ia := y*a.Stride + x*4
+					ib := y*b.Stride + x*4
+					for c := 0; c < 4; c++ {
+						sum += cfg.channelDiff(a.Pix[ia+c], b.Pix[ib+c])
+					}
+					counted++
+				}
+			}
+			if counted == 0 {
+				grid[row][col] = -1
+				continue
+			}
+			grid[row][col] = float64(sum) / float64(counted*4)
+		}
+	}
+	return grid
+}
+
+// CompareResult summarizes the difference between two images.
+type CompareResult struct {
+	ComparedPixels  int             // Pixels that were not ignored
+	DifferentPixels int             // Pixels with at least one channel beyond the tolerance
+	MaxDifference   uint8           // Largest channel difference found
+	MeanDifference  float64         // Mean channel difference over compared pixels (0-255)
+	DiffBounds      image.Rectangle // Bounding box of differing pixels, empty if none
+}
+
+// Equal reports whether no compared pixel differs beyond the tolerance.
+func (r *CompareResult) Equal() bool {
+	return r.DifferentPixels == 0
+}
+
+// DiffRatio returns the fraction of compared pixels that differ.
+func (r *CompareResult) DiffRatio() float64 {
+	if r.ComparedPixels == 0 {
+		return 0
+	}
+	return float64(r.DifferentPixels) / float64(r.ComparedPixels)
+}
+
+// Compare compares the current image with other pixel by pixel, honoring
+// ignored regions and the per-pixel tolerance, and summarizes the result.
+// Returns an error if a previous error in the chain exists, other is nil or
+// the dimensions differ.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Compare(other image.Image, options ...CompareOption) (*CompareResult, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	if err := checkComparable(ip.currentImage, other); err != nil {
+		return nil, err
+	}
+
+	cfg := newCompareConfig(options)
+	a, b := asRGBA(ip.currentImage), asRGBA(other)
+	width, height := a.Rect.Dx(), a.Rect.Dy()
+	ignore := cfg.ignoreMask(width, height, ip.currentImage.Bounds().Min)
+
+	res := &CompareResult{}
+	sum := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if ignore != nil && ignore[y*width+x] {
+				continue
+			}
+			res.ComparedPixels++
+			ia, ib := y*a.Stride+x*4, y*b.Stride+x*4
+			differs := false
+			for c := 0; c < 4; c++ {
+				d := cfg.channelDiff(a.Pix[ia+c], b.Pix[ib+c])
+				sum += d
+				res.MaxDifference = max(res.MaxDifference, uint8(d))
+				differs = differs || d > 0
+			}
+			if differs {
+				res.DifferentPixels++
+				res.DiffBounds = res.DiffBounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if res.ComparedPixels > 0 {
+		res.MeanDifference = float64(sum) / float64(res.ComparedPixels*4)
+	}
+	return res, nil
+}
+
+// checkComparable returns an error unless other is non-nil and has the same
+// size as img.
+func checkComparable(img, other image.Image) error {
+	if other == nil {
+		return fmt.Errorf("comparison image cannot be nil")
+	}
+	if img.Bounds().Size() != other.Bounds().Size() {
+		return fmt.Errorf("cannot compare images of different sizes: %v vs %v",
+			img.Bounds().Size(), other.Bounds().Size())
+	}
+	return nil
+}
+
+// DiffHeatmap replaces the image with a block-level heatmap of its difference
+// to other. The image is divided into cell x cell blocks and every block is
+// filled with a color for its mean absolute channel difference, from black
+// (identical) to pale yellow (maximal difference). Block averages make layout
+// shifts in screenshot tests much easier to spot than per-pixel diffs.
+// Compare options apply; blocks that are entirely ignored are drawn in gray.
+// Returns the ImageProcessor for chaining. An error is set if other is nil,
+// the dimensions differ or cell is not positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DiffHeatmap(other image.Image, cell int, options ...CompareOption) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if err := checkComparable(ip.currentImage, other); err != nil {
+		ip.err = err
+		return ip
+	}
+	if cell <= 0 {
+		ip.err = fmt.Errorf("heatmap cell size must be positive (got: %d)", cell)
+		return ip
+	}
+
+	cfg := newCompareConfig(options)
+	size := ip.currentImage.Bounds().Size()
+	ignore := cfg.ignoreMask(size.X, size.Y, ip.currentImage.Bounds().Min)
+	grid := cellDifferences(asRGBA(ip.currentImage), asRGBA(other), cell, cfg, ignore)
+
+	heatmap := newRGBA(image.Rect(0, 0, size.X, size.Y))
+	for row, cols := range grid {
+		for col, diff := range cols {
+			c := heatmapIgnored
+			if diff >= 0 {
+				c = heatColor(diff / 255)
+			}
+			r := image.Rect(col*cell, row*cell, (col+1)*cell, (row+1)*cell).Intersect(heatmap.Rect)
+			draw.Draw(heatmap, r, image.NewUniform(c), image.Point{}, draw.Src)
+		}
+	}
+
+	ip.currentImage = heatmap
+	ip.record("DiffHeatmap")
+	return ip
+}
+
+// absDiff returns |a - b|.
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// SplitOrientation selects how SplitCompare divides the image.
+type SplitOrientation int
+
+const (
+	// SplitLeftRight shows the image on the left and the other image on the
+	// right of a vertical divider.
+	SplitLeftRight SplitOrientation = iota
+	// SplitTopBottom shows the image above and the other image below a
+	// horizontal divider.
+	SplitTopBottom
+)
+
+// splitConfig holds configuration for SplitCompare.
+type splitConfig struct {
+	DividerColor color.Color
+	Before       string
+	After        string
+	LabelOpts    []WatermarkOption
+}
+
+// SplitOption is a functional option for configuring SplitCompare.
+type SplitOption func(*splitConfig)
+
+// WithDividerColor sets the color of the divider line. The default is white.
+func WithDividerColor(c color.Color) SplitOption {
+	return func(sc *splitConfig) { sc.DividerColor = c }
+}
+
+// WithSplitLabels captions the two halves, e.g. "Before" and "After". Each
+// label is drawn in the outer corner of its half on a translucent dark box.
+// Labels are styled with the AddTextWatermark options WithFontBytes,
+// WithFontSize and WithColor; they default to 16pt white. An empty label is
+// not drawn.
+func WithSplitLabels(before, after string, style ...WatermarkOption) SplitOption {
+	return func(sc *splitConfig) {
+		sc.Before, sc.After = before, after
+		sc.LabelOpts = style
+	}
+}
+
+// SplitCompare replaces the image with a half-and-half comparison: the first
+// half of the image is kept and the second half is taken from other, with a
+// divider of dividerWidth pixels (0 for none) centered on the split. This is
+// handy for documenting filter results and visual QA, e.g.
+// New(original).SplitCompare(filtered, SplitLeftRight, 2).
+// Returns the ImageProcessor for chaining. An error is set if other is nil,
+// the dimensions differ, orientation is unknown, dividerWidth is negative,
+// the divider color is nil or the label font cannot be loaded.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) SplitCompare(other image.Image, orientation SplitOrientation, dividerWidth int, options ...SplitOption) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if err := checkComparable(ip.currentImage, other); err != nil {
+		ip.err = err
+		return ip
+	}
+	if orientation != SplitLeftRight && orientation != SplitTopBottom {
+		ip.err = fmt.Errorf("unknown split orientation: %d", orientation)
+		return ip
+	}
+	if dividerWidth < 0 {
+		ip.err = fmt.Errorf("divider width cannot be negative (got: %d)", dividerWidth)
+		return ip
+	}
+	cfg := &splitConfig{DividerColor: color.White}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	if cfg.DividerColor == nil {
+		ip.err = fmt.Errorf("divider color cannot be nil")
+		return ip
+	}
+
+	a, b := ip.currentImage.Bounds(), other.Bounds()
+	w, h := a.Dx(), a.Dy()
+	dst := newRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Rect, ip.currentImage, a.Min, draw.Src)
+
+	first, second := image.Rect(0, 0, w/2, h), image.Rect(w/2, 0, w, h)
+	divider := image.Rect(w/2-dividerWidth/2, 0, w/2-dividerWidth/2+dividerWidth, h)
+	if orientation == SplitTopBottom {
+		first, second = image.Rect(0, 0, w, h/2), image.Rect(0, h/2, w, h)
+		divider = image.Rect(0, h/2-dividerWidth/2, w, h/2-dividerWidth/2+dividerWidth)
+	}
+	draw.Draw(dst, second, other, b.Min.Add(second.Min), draw.Src)
+	draw.Draw(dst, divider.Intersect(dst.Rect), image.NewUniform(cfg.DividerColor), image.Point{}, draw.Src)
+
+	if cfg.Before != "" || cfg.After != "" {
+		if err := drawSplitLabels(dst, first, second, orientation, cfg); err != nil {
+			ip.err = err
+			return ip
+		}
+	}
+
+	ip.currentImage = dst
+	ip.record("SplitCompare")
+	return ip
+}
+
+// drawSplitLabels draws the SplitCompare captions in the outer corners of
+// the two halves: top-left for the first and top-right (left/right) or
+// bottom-left (top/bottom) for the second.
+func drawSplitLabels(dst *image.RGBA, first, second image.Rectangle, orientation SplitOrientation, cfg *splitConfig) error {
+	wc := defaultWatermarkConfig()
+	wc.FontSize = 16
+	wc.Color = color.White
+	for _, opt := range cfg.LabelOpts {
+		opt(wc)
+	}
+	face, err := wc.newFace()
+	if err != nil {
+		return fmt.Errorf("failed to load split label font: %w", err)
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	pad := max(2, int(wc.FontSize/3))
+	dr := &font.Drawer{Dst: dst, Src: image.NewUniform(wc.Color), Face: face}
+	backing := image.NewUniform(color.NRGBA{0, 0, 0, 128})
+	for i, label := range []string{cfg.Before, cfg.After} {
+		half := first
+		if i == 1 {
+			half = second
+		}
+		label = truncateText(face, label, float64(half.Dx()-4*pad))
+		if label == "" {
+			continue
+		}
+		size := image.Pt(font.MeasureString(face, label).Ceil()+2*pad, metrics.Height.Ceil()+2*pad)
+		corner := half.Min.Add(image.Pt(pad, pad))
+		if i == 1 {
+			if orientation == SplitLeftRight {
+				corner.X = half.Max.X - pad - size.X
+			} else {
+				corner.Y = half.Max.Y - pad - size.Y
+			}
+		}
+		box := image.Rectangle{Min: corner, Max: corner.Add(size)}
+		draw.Draw(dst, box, backing, image.Point{}, draw.Over)
+		dr.Dot = fixed.P(box.Min.X+pad, box.Min.Y+pad)
+		dr.Dot.Y += metrics.Ascent
+		dr.DrawString(label)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestDiffHeatmap(t *testing.T) {
+	base := createTestImage(100, 80)
+	changed := image.NewRGBA(base.Bounds())
+	copy(changed.Pix, base.(*image.RGBA).Pix)
+	// Invert a block in the second row, third column of 20px cells.
+	for y := 20; y < 40; y++ {
+		for x := 40; x < 60; x++ {
+			r, g, b, _ := changed.At(x, y).RGBA()
+			changed.Set(x, y, color.RGBA{255 - uint8(r>>8), 255 - uint8(g>>8), 255 - uint8(b>>8), 255})
+		}
+	}
+
+	proc := New(base).DiffHeatmap(changed, 20)
+	if proc.Err() != nil {
+		t.Fatalf("DiffHeatmap() should not error, got: %v", proc.Err())
+	}
+	if proc.currentImage.Bounds().Size() != base.Bounds().Size() {
+		t.Errorf("DiffHeatmap() size = %v, want %v", proc.currentImage.Bounds().Size(), base.Bounds().Size())
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(5, 5)); got != heatColor(0) {
+		t.Errorf("Unchanged cell = %v, want %v", got, heatColor(0))
+	}
+	hot := color.RGBAModel.Convert(proc.currentImage.At(50, 30)).(color.RGBA)
+	if hot == heatColor(0) {
+		t.Error("Changed cell should not be colored as identical")
+	}
+
+	// Non-multiple dimensions produce partial edge cells.
+	if err := New(base).DiffHeatmap(changed, 30).Err(); err != nil {
+		t.Errorf("DiffHeatmap() with partial edge cells should not error, got: %v", err)
+	}
+
+	// Invalid input
+	if New(base).DiffHeatmap(nil, 10).Err() == nil {
+		t.Error("DiffHeatmap(nil) should return an error")
+	}
+	if New(base).DiffHeatmap(createTestImage(10, 10), 10).Err() == nil {
+		t.Error("DiffHeatmap() with mismatched sizes should return an error")
+	}
+	if New(base).DiffHeatmap(changed, 0).Err() == nil {
+		t.Error("DiffHeatmap() with zero cell size should return an error")
+	}
+	if New(nil).DiffHeatmap(changed, 10).Err() == nil {
+		t.Fatal("DiffHeatmap() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := createTestImage(60, 40)
+	changed := image.NewRGBA(base.Bounds())
+	copy(changed.Pix, base.(*image.RGBA).Pix)
+	// A "clock" region that changes between screenshots...
+	for y := 0; y < 10; y++ {
+		for x := 50; x < 60; x++ {
+			changed.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	// ...and slight noise everywhere else.
+	for i := 0; i < len(changed.Pix); i += 4 {
+		if changed.Pix[i] < 255 {
+			changed.Pix[i]++
+		}
+	}
+
+	res, err := New(base).Compare(changed)
+	if err != nil {
+		t.Fatalf("Compare() should not error, got: %v", err)
+	}
+	if res.Equal() || res.ComparedPixels != 60*40 {
+		t.Errorf("Compare() without options should find differences over all pixels, got %+v", res)
+	}
+
+	// Tolerance hides the noise but not the clock.
+	res, _ = New(base).Compare(changed, WithPerPixelTolerance(2))
+	if res.DifferentPixels == 0 || res.DiffBounds != image.Rect(50, 0, 60, 10) {
+		t.Errorf("Compare() with tolerance should only report the clock region, got bounds %v", res.DiffBounds)
+	}
+
+	// Ignoring the clock as well makes the images equal.
+	res, _ = New(base).Compare(changed, WithPerPixelTolerance(2), WithIgnoreRegions([]image.Rectangle{image.Rect(50, 0, 60, 10)}))
+	if !res.Equal() || res.ComparedPixels != 60*40-100 || res.DiffRatio() != 0 {
+		t.Errorf("Compare() with tolerance and ignored region should report equality, got %+v", res)
+	}
+
+	// The heatmap honors the same options.
+	proc := New(base).DiffHeatmap(changed, 10, WithPerPixelTolerance(2), WithIgnoreRegions([]image.Rectangle{image.Rect(50, 0, 60, 10)}))
+	if proc.Err() != nil {
+		t.Fatalf("DiffHeatmap() with options should not error, got: %v", proc.Err())
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(55, 5)); got != heatmapIgnored {
+		t.Errorf("Ignored heatmap cell = %v, want %v", got, heatmapIgnored)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(5, 5)); got != heatColor(0) {
+		t.Errorf("Heatmap cell within tolerance = %v, want %v", got, heatColor(0))
+	}
+
+	// Invalid input
+	if _, err := New(base).Compare(nil); err == nil {
+		t.Error("Compare(nil) should return an error")
+	}
+	if _, err := New(base).Compare(createTestImage(5, 5)); err == nil {
+		t.Error("Compare() with mismatched sizes should return an error")
+	}
+	if _, err := New(nil).Compare(base); err == nil {
+		t.Fatal("Compare() on a processor with prior error should return that error")
+	}
+}
+
+func TestSplitCompare(t *testing.T) {
+	red := image.NewUniform(color.RGBA{255, 0, 0, 255})
+	blue := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	for i := range blue.Pix {
+		blue.Pix[i] = []uint8{0, 0, 255, 255}[i%4]
+	}
+	before := image.NewRGBA(blue.Rect)
+	draw.Draw(before, before.Rect, red, image.Point{}, draw.Src)
+
+	rgbaAt := func(p *ImageProcessor, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(p.currentImage.At(x, y)).(color.RGBA)
+	}
+	redC, blueC, white := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{255, 255, 255, 255}
+
+	proc := New(before).SplitCompare(blue, SplitLeftRight, 4)
+	if proc.Err() != nil {
+		t.Fatalf("SplitCompare() should not error, got: %v", proc.Err())
+	}
+	if proc.currentImage.Bounds().Size() != blue.Rect.Size() {
+		t.Errorf("SplitCompare() size = %v, want %v", proc.currentImage.Bounds().Size(), blue.Rect.Size())
+	}
+	for _, c := range []struct {
+		x, y int
+		want color.RGBA
+	}{{10, 30, redC}, {47, 30, redC}, {48, 30, white}, {51, 30, white}, {52, 30, blueC}, {90, 30, blueC}} {
+		if got := rgbaAt(proc, c.x, c.y); got != c.want {
+			t.Errorf("SplitCompare(SplitLeftRight) pixel (%d, %d) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+
+	proc = New(before).SplitCompare(blue, SplitTopBottom, 0)
+	if rgbaAt(proc, 50, 29) != redC || rgbaAt(proc, 50, 30) != blueC {
+		t.Errorf("SplitCompare(SplitTopBottom) should split at row 30, got %v and %v", rgbaAt(proc, 50, 29), rgbaAt(proc, 50, 30))
+	}
+
+	// Labels darken the outer corners of both halves, and the divider color is configurable.
+	proc = New(before).SplitCompare(blue, SplitLeftRight, 2,
+		WithDividerColor(color.Black), WithSplitLabels("Before", "After", WithFontSize(12)))
+	if proc.Err() != nil {
+		t.Fatalf("SplitCompare() with labels should not error, got: %v", proc.Err())
+	}
+	if got := rgbaAt(proc, 50, 30); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("divider pixel = %v, want black", got)
+	}
+	if got := rgbaAt(proc, 5, 5); got == redC {
+		t.Error("Before label should be drawn in the top-left corner")
+	}
+	if got := rgbaAt(proc, 95, 5); got == blueC {
+		t.Error("After label should be drawn in the top-right corner")
+	}
+	if got := rgbaAt(proc, 5, 55); got != redC {
+		t.Errorf("pixel away from the labels = %v, want %v", got, redC)
+	}
+
+	// Invalid input
+	if New(before).SplitCompare(nil, SplitLeftRight, 0).Err() == nil {
+		t.Error("SplitCompare(nil) should return an error")
+	}
+	if New(before).SplitCompare(createTestImage(10, 10), SplitLeftRight, 0).Err() == nil {
+		t.Error("SplitCompare() with mismatched sizes should return an error")
+	}
+	if New(before).SplitCompare(blue, SplitOrientation(5), 0).Err() == nil {
+		t.Error("SplitCompare() with an unknown orientation should return an error")
+	}
+	if New(before).SplitCompare(blue, SplitLeftRight, -1).Err() == nil {
+		t.Error("SplitCompare() with a negative divider width should return an error")
+	}
+	if New(before).SplitCompare(blue, SplitLeftRight, 2, WithDividerColor(nil)).Err() == nil {
+		t.Error("SplitCompare() with a nil divider color should return an error")
+	}
+	if New(before).SplitCompare(blue, SplitLeftRight, 0, WithSplitLabels("a", "b", WithFontBytes([]byte("bad")))).Err() == nil {
+		t.Error("SplitCompare() with an invalid label font should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).SplitCompare(blue, SplitLeftRight, 0).Err() == nil {
+		t.Fatal("SplitCompare() on a processor with prior error should propagate that error")
+	}
+}
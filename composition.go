@@ -0,0 +1,146 @@
+package gopiq
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// saliencyMaxSide is the longest side of the downscaled image the saliency
+// map is computed on; composition heuristics do not need full resolution.
+const saliencyMaxSide = 96
+
+// compositionSigma is the distance (relative to the image size) from a power
+// point at which its score has fallen to about 60%.
+const compositionSigma = 0.1
+
+// saliencyMap is a coarse per-pixel estimate of visual importance.
+type saliencyMap struct {
+	Width, Height int
+	Scale         float64 // Source pixels per map pixel
+	Values        []float64
+}
+
+// computeSaliency estimates where the eye is drawn in img by combining local
+// contrast (luma gradient magnitude) with global color rarity (distance from
+// the mean color), on a downscaled copy of the image.
+func computeSaliency(img image.Image) *saliencyMap {
+	b := img.Bounds()
+	scale := max(1, float64(max(b.Dx(), b.Dy()))/saliencyMaxSide)
+	w, h := max(1, int(float64(b.Dx())/scale)), max(1, int(float64(b.Dy())/scale))
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(small, small.Rect, img, b, draw.Src, nil)
+
+	n := w * h
+	luma := make([]float64, n)
+	rgb := make([][3]float64, n)
+	var mean [3]float64
+	for i := 0; i < n; i++ {
+		p := small.Pix[i*4 : i*4+4]
+		r, g, bl := unpremultiply(p[0], p[3]), unpremultiply(p[1], p[3]), unpremultiply(p[2], p[3])
+		rgb[i] = [3]float64{float64(r), float64(g), float64(bl)}
+		luma[i] = luminance(r, g, bl)
+		for c := range mean {
+			mean[c] += rgb[i][c]
+		}
+	}
+	for c := range mean {
+		mean[c] /= float64(n)
+	}
+
+	sm := &saliencyMap{Width: w, Height: h, Scale: scale, Values: make([]float64, n)}
+	at := func(x, y int) float64 {
+		return luma[min(max(y, 0), h-1)*w+min(max(x, 0), w-1)]
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			gx, gy := at(x+1, y)-at(x-1, y), at(x, y+1)-at(x, y-1)
+			gradient := math.Hypot(gx, gy) / (2 * 255 * math.Sqrt2)
+			rarity := math.Sqrt(sq(rgb[i][0]-mean[0])+sq(rgb[i][1]-mean[1])+sq(rgb[i][2]-mean[2])) / (255 * math.Sqrt(3))
+			sm.Values[i] = gradient + rarity
+		}
+	}
+	return sm
+}
+
+// Composition rates how well the main subject of an image is placed.
+type Composition struct {
+	Score        float64     // Overall score in [0, 1], higher is better
+	RuleOfThirds float64     // Closeness of the subject to a rule-of-thirds intersection, in [0, 1]
+	GoldenRatio  float64     // Closeness of the subject to a golden-ratio intersection, in [0, 1]
+	EdgeWeight   float64     // Fraction of visual weight touching the image border
+	Subject      image.Point // Estimated subject center in image coordinates
+}
+
+// CompositionScore estimates the subject position from a saliency map (local
+// contrast and color rarity) and scores it against rule-of-thirds and
+// golden-ratio heuristics. Subjects cut off by the image border lower the
+// score. Comparing scores of several candidate crops of the same photo picks
+// the best-composed one.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) CompositionScore() (*Composition, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+
+	sm := computeSaliency(ip.currentImage)
+	border := max(1, min(sm.Width, sm.Height)/20)
+
+	// Weight by the squared saliency above average so that the subject
+	// dominates background and diffuse texture.
+	mean := 0.0
+	for _, v := range sm.Values {
+		mean += v
+	}
+	mean /= float64(len(sm.Values))
+	var total, cx, cy, edge float64
+	for y := 0; y < sm.Height; y++ {
+		for x := 0; x < sm.Width; x++ {
+			w := sq(max(0, sm.Values[y*sm.Width+x]-mean))
+			total += w
+			cx += w * (float64(x) + 0.5)
+			cy += w * (float64(y) + 0.5)
+			if x < border || y < border || x >= sm.Width-border || y >= sm.Height-border {
+				edge += w
+			}
+		}
+	}
+
+	b := ip.currentImage.Bounds()
+	if total == 0 {
+		// A featureless image has no subject to place.
+		return &Composition{Subject: image.Pt(b.Min.X+b.Dx()/2, b.Min.Y+b.Dy()/2)}, nil
+	}
+	fx, fy := cx/total/float64(sm.Width), cy/total/float64(sm.Height)
+
+	res := &Composition{
+		RuleOfThirds: powerPointScore(fx, fy, 1.0/3),
+		GoldenRatio:  powerPointScore(fx, fy, 1-1/math.Phi),
+		EdgeWeight:   edge / total,
+		Subject:      image.Pt(b.Min.X+int(fx*float64(b.Dx())), b.Min.Y+int(fy*float64(b.Dy()))),
+	}
+	res.Score = max(res.RuleOfThirds, res.GoldenRatio) * (1 - res.EdgeWeight)
+	return res, nil
+}
+
+// powerPointScore rates the relative position (x, y) by its distance to the
+// nearest of the four intersections of lines at p and 1-p.
+func powerPointScore(x, y, p float64) float64 {
+	d := math.Inf(1)
+	for _, px := range []float64{p, 1 - p} {
+		for _, py := range []float64{p, 1 - p} {
+			d = min(d, math.Hypot(x-px, y-py))
+		}
+	}
+	return math.Exp(-d * d / (2 * compositionSigma * compositionSigma))
+}
+
+// sq returns v².
+func sq(v float64) float64 {
+	return v * v
+}
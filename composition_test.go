@@ -0,0 +1,56 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createSubjectImage returns a gray image with a red square subject centered
+// on (cx, cy).
+func createSubjectImage(width, height, cx, cy, size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{120, 120, 120, 255}
+			if x >= cx-size/2 && x < cx+size/2 && y >= cy-size/2 && y < cy+size/2 {
+				c = color.RGBA{220, 30, 30, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestCompositionScore(t *testing.T) {
+	thirds, err := New(createSubjectImage(300, 200, 100, 67, 30)).CompositionScore()
+	if err != nil {
+		t.Fatalf("CompositionScore() should not error, got: %v", err)
+	}
+	if dx, dy := thirds.Subject.X-100, thirds.Subject.Y-67; dx*dx+dy*dy > 25 {
+		t.Errorf("CompositionScore() subject = %v, want near (100, 67)", thirds.Subject)
+	}
+	if thirds.RuleOfThirds < 0.9 || thirds.Score < 0.8 {
+		t.Errorf("CompositionScore() for a subject on a thirds intersection = %+v, want a high score", thirds)
+	}
+
+	centered, _ := New(createSubjectImage(300, 200, 150, 100, 30)).CompositionScore()
+	if centered.Score >= thirds.Score {
+		t.Errorf("centered subject scored %.3f, should be below thirds placement %.3f", centered.Score, thirds.Score)
+	}
+
+	cutOff, _ := New(createSubjectImage(300, 200, 0, 67, 30)).CompositionScore()
+	if cutOff.EdgeWeight < 0.3 || cutOff.Score >= thirds.Score {
+		t.Errorf("subject cut off by the border = %+v, want high edge weight and lower score", cutOff)
+	}
+
+	// Featureless images have nothing to score.
+	flat, err := New(createSubjectImage(50, 50, -100, -100, 10)).CompositionScore()
+	if err != nil || flat.Score != 0 {
+		t.Errorf("CompositionScore() of a flat image = %+v, %v, want zero score", flat, err)
+	}
+
+	if _, err := New(nil).CompositionScore(); err == nil {
+		t.Error("CompositionScore() on a processor with prior error should return that error")
+	}
+}
@@ -0,0 +1,124 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// ContactSheetItem is one photo on a contact sheet.
+type ContactSheetItem struct {
+	Image image.Image
+	Label string // Filename or caption shown beneath the thumbnail; may be empty
+}
+
+// ContactSheetLayout describes the grid of a contact sheet. The zero value
+// of any field falls back to the corresponding field of
+// DefaultContactSheetLayout.
+type ContactSheetLayout struct {
+	Columns    int
+	ThumbSize  int // Thumbnails are scaled to fit a ThumbSize square
+	Gap        int // Space between cells and around the edge
+	Background color.Color
+}
+
+// DefaultContactSheetLayout returns a five column layout of 200px thumbnails
+// on a white background.
+func DefaultContactSheetLayout() ContactSheetLayout {
+	return ContactSheetLayout{
+		Columns:    5,
+		ThumbSize:  200,
+		Gap:        16,
+		Background: color.White,
+	}
+}
+
+// withDefaults fills zero fields of l from DefaultContactSheetLayout.
+func (l ContactSheetLayout) withDefaults() ContactSheetLayout {
+	d := DefaultContactSheetLayout()
+	if l.Columns == 0 {
+		l.Columns = d.Columns
+	}
+	if l.ThumbSize == 0 {
+		l.ThumbSize = d.ThumbSize
+	}
+	if l.Gap == 0 {
+		l.Gap = d.Gap
+	}
+	if l.Background == nil {
+		l.Background = d.Background
+	}
+	return l
+}
+
+// ContactSheet arranges items as thumbnails in a grid with each label
+// rendered centered beneath its thumbnail, truncated with an ellipsis to the
+// thumbnail width, and returns a new ImageProcessor holding the sheet.
+// Labels are styled with the AddTextWatermark options WithFontBytes,
+// WithFontSize and WithColor; they default to 14pt black.
+// An error is set on the returned processor if items is empty or contains a
+// nil image, a layout field is negative or the font cannot be loaded.
+func ContactSheet(items []ContactSheetItem, layout ContactSheetLayout, labelOpts ...WatermarkOption) *ImageProcessor {
+	if len(items) == 0 {
+		return &ImageProcessor{err: fmt.Errorf("contact sheet needs at least one item")}
+	}
+	l := layout.withDefaults()
+	if l.Columns < 0 || l.ThumbSize < 0 || l.Gap < 0 {
+		return &ImageProcessor{err: fmt.Errorf("contact sheet layout must not be negative (columns: %d, thumb size: %d, gap: %d)", l.Columns, l.ThumbSize, l.Gap)}
+	}
+	for i, item := range items {
+		if item.Image == nil {
+			return &ImageProcessor{err: fmt.Errorf("contact sheet item %d has no image", i)}
+		}
+	}
+
+	cfg := defaultWatermarkConfig()
+	cfg.FontSize = 14
+	cfg.Color = color.Black
+	for _, opt := range labelOpts {
+		opt(cfg)
+	}
+	face, err := cfg.newFace()
+	if err != nil {
+		return &ImageProcessor{err: fmt.Errorf("failed to load contact sheet label font: %w", err)}
+	}
+	defer face.Close()
+
+	// Each cell holds a thumbnail square and a line of label text below it.
+	metrics := face.Metrics()
+	labelGap := max(2, l.Gap/4)
+	cell := image.Pt(l.ThumbSize, l.ThumbSize+labelGap+metrics.Height.Ceil())
+	cols := min(l.Columns, len(items))
+	rows := (len(items) + cols - 1) / cols
+
+	sheet := newRGBA(image.Rect(0, 0, cols*(cell.X+l.Gap)+l.Gap, rows*(cell.Y+l.Gap)+l.Gap))
+	draw.Draw(sheet, sheet.Rect, image.NewUniform(l.Background), image.Point{}, draw.Src)
+	dr := &font.Drawer{Dst: sheet, Src: image.NewUniform(cfg.Color), Face: face}
+	for i, item := range items {
+		origin := image.Pt(l.Gap+(i%cols)*(cell.X+l.Gap), l.Gap+(i/cols)*(cell.Y+l.Gap))
+		thumbRect := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(l.ThumbSize, l.ThumbSize))}
+		b := item.Image.Bounds()
+		draw.CatmullRom.Scale(sheet, fitRect(b.Size(), thumbRect), item.Image, b, draw.Over, nil)
+
+		if item.Label == "" {
+			continue
+		}
+		label := truncateText(face, item.Label, float64(l.ThumbSize))
+		width := font.MeasureString(face, label)
+		dr.Dot = fixed.Point26_6{
+			X: fixed.I(origin.X) + (fixed.I(l.ThumbSize)-width)/2,
+			Y: fixed.I(thumbRect.Max.Y+labelGap) + metrics.Ascent,
+		}
+		dr.DrawString(label)
+	}
+
+	return &ImageProcessor{
+		currentImage: sheet,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         sheet.Rect.Size(),
+	}
+}
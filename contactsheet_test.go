@@ -0,0 +1,94 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestContactSheet(t *testing.T) {
+	red := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	draw.Draw(red, red.Rect, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	items := []ContactSheetItem{
+		{Image: red, Label: "IMG_0001.jpg"},
+		{Image: red, Label: "A caption that is far too long to fit beneath a small thumbnail"},
+		{Image: red},
+	}
+
+	proc := ContactSheet(items, ContactSheetLayout{Columns: 2, ThumbSize: 80, Gap: 10})
+	if proc.Err() != nil {
+		t.Fatalf("ContactSheet() should not error, got: %v", proc.Err())
+	}
+	sheet := proc.currentImage
+	if w, h := sheet.Bounds().Dx(), sheet.Bounds().Dy(); w != 190 || h <= 190 {
+		t.Fatalf("ContactSheet() produced %dx%d, want 190 wide and taller than the thumbnails", w, h)
+	}
+	cellHeight := (sheet.Bounds().Dy() - 10) / 2
+
+	// Thumbnails are scaled to fit and centered in their square.
+	if got := color.RGBAModel.Convert(sheet.At(50, 50)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("ContactSheet() thumbnail pixel = %v, want red", got)
+	}
+	if got := color.RGBAModel.Convert(sheet.At(50, 15)); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("ContactSheet() letterbox pixel = %v, want the white background", got)
+	}
+
+	// darkPixels counts label ink in r.
+	darkPixels := func(r image.Rectangle) int {
+		n := 0
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if r, _, _, _ := sheet.At(x, y).RGBA(); r>>8 < 128 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	labelRow := func(col, row int) image.Rectangle {
+		y := 10 + row*cellHeight + 80
+		return image.Rect(10+col*90, y, 10+col*90+80, y+cellHeight-90)
+	}
+	if darkPixels(labelRow(0, 0)) == 0 || darkPixels(labelRow(1, 0)) == 0 {
+		t.Error("ContactSheet() should render labels beneath the thumbnails")
+	}
+	if n := darkPixels(labelRow(0, 1)); n != 0 {
+		t.Errorf("ContactSheet() item without label has %d label pixels", n)
+	}
+	// The long caption is truncated to its cell, leaving the gaps clear.
+	if n := darkPixels(image.Rect(180, 90, 190, cellHeight)); n != 0 {
+		t.Errorf("ContactSheet() label overflows its cell by %d pixels", n)
+	}
+
+	// Label styling uses the watermark options.
+	blue := color.RGBA{0, 0, 255, 255}
+	styled := ContactSheet(items[:1], ContactSheetLayout{ThumbSize: 80}, WithColor(blue), WithFontSize(20)).currentImage
+	found := false
+	for y := 96; y < styled.Bounds().Dy() && !found; y++ {
+		for x := 0; x < styled.Bounds().Dx(); x++ {
+			if color.RGBAModel.Convert(styled.At(x, y)) == blue {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		t.Error("ContactSheet() with WithColor should draw labels in that color")
+	}
+
+	// Test case: Invalid parameters
+	if ContactSheet(nil, ContactSheetLayout{}).Err() == nil {
+		t.Error("ContactSheet() with no items should return an error")
+	}
+	if ContactSheet([]ContactSheetItem{{Label: "x"}}, ContactSheetLayout{}).Err() == nil {
+		t.Error("ContactSheet() with a nil image should return an error")
+	}
+	if ContactSheet(items, ContactSheetLayout{Gap: -1}).Err() == nil {
+		t.Error("ContactSheet() with a negative gap should return an error")
+	}
+	if ContactSheet(items, ContactSheetLayout{}, WithFontBytes([]byte{1, 2, 3})).Err() == nil {
+		t.Error("ContactSheet() with an invalid font should return an error")
+	}
+}
@@ -0,0 +1,215 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// The converters below return new images owned by the caller, with the same
+// bounds as the current image. Conversions follow the standard library color
+// models, so results match drawing the image onto the target type with
+// draw.Draw (exactly for *image.RGBA sources, up to rounding of translucent
+// pixels otherwise), but take direct buffer paths that run in parallel
+// according to the processor's PerformanceOptions.
+
+// ToRGBA returns the current image as a new alpha-premultiplied *image.RGBA.
+// Returns an error if a previous error in the chain exists.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToRGBA() (*image.RGBA, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	b := ip.currentImage.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, ip.currentImage, b.Min, draw.Src)
+	return dst, nil
+}
+
+// ToNRGBA returns the current image as a new non-premultiplied *image.NRGBA,
+// the layout most GUI toolkits and game engines upload as textures.
+// Returns an error if a previous error in the chain exists.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToNRGBA() (*image.NRGBA, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	b := ip.currentImage.Bounds()
+	dst := image.NewNRGBA(b)
+	if src, ok := ip.currentImage.(*image.NRGBA); ok {
+		copyRows(dst.Pix, dst.Stride, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, b.Dx()*4, b.Dy())
+		return dst, nil
+	}
+
+	src := asRGBA(ip.currentImage)
+	if err := ip.processRowsErr(b.Dx(), b.Dy(), func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			s := src.Pix[y*src.Stride : y*src.Stride+b.Dx()*4]
+			d := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()*4]
+			for i := 0; i < len(s); i += 4 {
+				a := s[i+3]
+				switch a {
+				case 0xff:
+					copy(d[i:i+4], s[i:i+4])
+				case 0:
+					// Fully transparent pixels have no color.
+				default:
+					// Matches color.NRGBAModel on the 16-bit expansion.
+					for c := 0; c < 3; c++ {
+						d[i+c] = uint8((uint32(s[i+c]) * 0xffff / uint32(a)) >> 8)
+					}
+					d[i+3] = a
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ToGray returns the current image as a new 8-bit *image.Gray using the
+// color.GrayModel weights (ITU-R BT.601); alpha is discarded. For JPEG-decoded
+// images the luma plane is copied directly. Use Grayscale for the BT.709
+// conversion used elsewhere in this package.
+// Returns an error if a previous error in the chain exists.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToGray() (*image.Gray, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	b := ip.currentImage.Bounds()
+	dst := image.NewGray(b)
+	switch src := ip.currentImage.(type) {
+	case *image.Gray:
+		copyRows(dst.Pix, dst.Stride, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, b.Dx(), b.Dy())
+		return dst, nil
+	case *image.YCbCr:
+		copyRows(dst.Pix, dst.Stride, src.Y[src.YOffset(b.Min.X, b.Min.Y):], src.YStride, b.Dx(), b.Dy())
+		return dst, nil
+	}
+
+	src := asRGBA(ip.currentImage)
+	if err := ip.processRowsErr(b.Dx(), b.Dy(), func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			s := src.Pix[y*src.Stride:]
+			d := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()]
+			for x := range d {
+				d[x] = uint8(grayModelLuma(s[x*4], s[x*4+1], s[x*4+2]) >> 24)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ToGray16 returns the current image as a new 16-bit *image.Gray16 using the
+// color.Gray16Model weights (ITU-R BT.601); alpha is discarded.
+// Returns an error if a previous error in the chain exists.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToGray16() (*image.Gray16, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	b := ip.currentImage.Bounds()
+	dst := image.NewGray16(b)
+	switch src := ip.currentImage.(type) {
+	case *image.Gray16:
+		copyRows(dst.Pix, dst.Stride, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, b.Dx()*2, b.Dy())
+		return dst, nil
+	case *image.RGBA64, *image.NRGBA64:
+		// Keep the full precision of 16-bit sources.
+		draw.Draw(dst, b, src, b.Min, draw.Src)
+		return dst, nil
+	}
+
+	src := asRGBA(ip.currentImage)
+	if err := ip.processRowsErr(b.Dx(), b.Dy(), func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			s := src.Pix[y*src.Stride:]
+			d := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()*2]
+			for x := 0; x < b.Dx(); x++ {
+				v := grayModelLuma(s[x*4], s[x*4+1], s[x*4+2]) >> 16
+				d[x*2], d[x*2+1] = uint8(v>>8), uint8(v)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ToPaletted returns the current image as a new *image.Paletted with palette
+// p, mapping every pixel to the nearest palette color without dithering.
+// Returns an error if a previous error in the chain exists or p is empty or
+// has more than 256 colors.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToPaletted(p color.Palette) (*image.Paletted, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	if len(p) == 0 || len(p) > 256 {
+		return nil, fmt.Errorf("palette must have between 1 and 256 colors (got: %d)", len(p))
+	}
+
+	b := ip.currentImage.Bounds()
+	dst := image.NewPaletted(b, p)
+	src := asRGBA(ip.currentImage)
+	if err := ip.processRowsErr(b.Dx(), b.Dy(), func(startRow, endRow int) error {
+		// Photos repeat colors heavily, so remember the nearest match.
+		nearest := make(map[uint32]uint8)
+		for y := startRow; y < endRow; y++ {
+			s := src.Pix[y*src.Stride:]
+			d := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()]
+			for x := range d {
+				px := s[x*4 : x*4+4]
+				key := uint32(px[0])<<24 | uint32(px[1])<<16 | uint32(px[2])<<8 | uint32(px[3])
+				idx, ok := nearest[key]
+				if !ok {
+					idx = uint8(p.Index(color.RGBA{px[0], px[1], px[2], px[3]}))
+					nearest[key] = idx
+				}
+				d[x] = idx
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// grayModelLuma returns the luma of an 8-bit RGB triple as computed by
+// color.GrayModel before its final shift: shifting right by 24 yields the
+// 8-bit value and by 16 the 16-bit value.
+func grayModelLuma(r, g, b uint8) uint32 {
+	return 19595*uint32(r)*0x101 + 38470*uint32(g)*0x101 + 7471*uint32(b)*0x101 + 1<<15
+}
+
+// copyRows copies rows of n bytes between buffers with different strides.
+func copyRows(dst []uint8, dstStride int, src []uint8, srcStride, n, rows int) {
+	for y := 0; y < rows; y++ {
+		copy(dst[y*dstStride:y*dstStride+n], src[y*srcStride:y*srcStride+n])
+	}
+}
@@ -0,0 +1,156 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// createNoiseImage returns an RGBA image with random premultiplied pixels,
+// including translucent and fully transparent ones.
+func createNoiseImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := uint8(rng.Intn(256))
+		switch i % 5 {
+		case 0:
+			a = 255
+		case 1:
+			a = 0
+		}
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(rng.Intn(int(a) + 1))
+		}
+		img.Pix[i+3] = a
+	}
+	return img
+}
+
+func TestPixelFormatConverters(t *testing.T) {
+	src := createNoiseImage(37, 23)
+	opts := []PerformanceOptions{{}, {MaxGoroutines: 4, EnableParallelProcessing: true, MinSizeForParallel: 1}}
+
+	for _, opt := range opts {
+		proc := NewWithPerformanceOptions(src, opt)
+
+		rgba, err := proc.ToRGBA()
+		if err != nil {
+			t.Fatalf("ToRGBA() should not error, got: %v", err)
+		}
+		if rgba == src || string(rgba.Pix) != string(src.Pix) {
+			t.Error("ToRGBA() should return an identical copy")
+		}
+
+		nrgba, err := proc.ToNRGBA()
+		if err != nil {
+			t.Fatalf("ToNRGBA() should not error, got: %v", err)
+		}
+		wantNRGBA := image.NewNRGBA(src.Rect)
+		draw.Draw(wantNRGBA, src.Rect, src, image.Point{}, draw.Src)
+		if string(nrgba.Pix) != string(wantNRGBA.Pix) {
+			t.Error("ToNRGBA() differs from draw.Draw")
+		}
+
+		gray, err := proc.ToGray()
+		if err != nil {
+			t.Fatalf("ToGray() should not error, got: %v", err)
+		}
+		wantGray := image.NewGray(src.Rect)
+		draw.Draw(wantGray, src.Rect, src, image.Point{}, draw.Src)
+		if string(gray.Pix) != string(wantGray.Pix) {
+			t.Error("ToGray() differs from draw.Draw")
+		}
+
+		gray16, err := proc.ToGray16()
+		if err != nil {
+			t.Fatalf("ToGray16() should not error, got: %v", err)
+		}
+		wantGray16 := image.NewGray16(src.Rect)
+		draw.Draw(wantGray16, src.Rect, src, image.Point{}, draw.Src)
+		if string(gray16.Pix) != string(wantGray16.Pix) {
+			t.Error("ToGray16() differs from draw.Draw")
+		}
+
+		paletted, err := proc.ToPaletted(palette.WebSafe)
+		if err != nil {
+			t.Fatalf("ToPaletted() should not error, got: %v", err)
+		}
+		for y := 0; y < src.Rect.Dy(); y++ {
+			for x := 0; x < src.Rect.Dx(); x++ {
+				if want := color.Palette(palette.WebSafe).Convert(src.At(x, y)); paletted.At(x, y) != want {
+					t.Fatalf("ToPaletted() at (%d,%d) = %v, want %v", x, y, paletted.At(x, y), want)
+				}
+			}
+		}
+	}
+}
+
+func TestPixelFormatConvertersSourceTypes(t *testing.T) {
+	// Bounds that do not start at the origin are preserved.
+	bounds := image.Rect(5, 7, 25, 19)
+
+	nrgba := image.NewNRGBA(bounds)
+	nrgba.Set(10, 10, color.NRGBA{200, 100, 50, 128})
+	got, err := New(nrgba).ToNRGBA()
+	if err != nil || got.Bounds() != bounds || got.NRGBAAt(10, 10) != (color.NRGBA{200, 100, 50, 128}) {
+		t.Errorf("ToNRGBA() of an NRGBA image = %v at %v, %v", got.NRGBAAt(10, 10), got.Bounds(), err)
+	}
+
+	ycc := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+	for i := range ycc.Y {
+		ycc.Y[i] = uint8(i)
+	}
+	gray, err := New(ycc).ToGray()
+	if err != nil || gray.Bounds() != bounds {
+		t.Fatalf("ToGray() of a YCbCr image = %v, %v", gray.Bounds(), err)
+	}
+	if gray.GrayAt(6, 8).Y != ycc.Y[ycc.YOffset(6, 8)] {
+		t.Errorf("ToGray() of a YCbCr image = %d, want the luma %d", gray.GrayAt(6, 8).Y, ycc.Y[ycc.YOffset(6, 8)])
+	}
+
+	g16 := image.NewGray16(bounds)
+	g16.SetGray16(6, 8, color.Gray16{Y: 0x1234})
+	got16, err := New(g16).ToGray16()
+	if err != nil || got16.Gray16At(6, 8).Y != 0x1234 {
+		t.Errorf("ToGray16() of a Gray16 image = %v, %v", got16.Gray16At(6, 8), err)
+	}
+
+	rgba64 := image.NewRGBA64(bounds)
+	rgba64.SetRGBA64(6, 8, color.RGBA64{0x1234, 0x1234, 0x1234, 0xffff})
+	got16, err = New(rgba64).ToGray16()
+	if err != nil || got16.Gray16At(6, 8).Y != 0x1234 {
+		t.Errorf("ToGray16() of an RGBA64 image = %v, want full precision", got16.Gray16At(6, 8))
+	}
+}
+
+func TestPixelFormatConvertersErrors(t *testing.T) {
+	if _, err := New(createTestImage(4, 4)).ToPaletted(nil); err == nil {
+		t.Error("ToPaletted() with an empty palette should return an error")
+	}
+	if _, err := New(createTestImage(4, 4)).ToPaletted(make(color.Palette, 257)); err == nil {
+		t.Error("ToPaletted() with more than 256 colors should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	proc := New(nil)
+	if _, err := proc.ToRGBA(); err == nil {
+		t.Error("ToRGBA() on a processor with prior error should propagate that error")
+	}
+	if _, err := proc.ToNRGBA(); err == nil {
+		t.Error("ToNRGBA() on a processor with prior error should propagate that error")
+	}
+	if _, err := proc.ToGray(); err == nil {
+		t.Error("ToGray() on a processor with prior error should propagate that error")
+	}
+	if _, err := proc.ToGray16(); err == nil {
+		t.Error("ToGray16() on a processor with prior error should propagate that error")
+	}
+	if _, err := proc.ToPaletted(palette.Plan9); err == nil {
+		t.Error("ToPaletted() on a processor with prior error should propagate that error")
+	}
+}
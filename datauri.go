@@ -0,0 +1,78 @@
+package gopiq
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// FromDataURI creates a new ImageProcessor by decoding the image embedded in
+// a data URI, such as the src of an HTML img element or a field of a JSON
+// payload. Base64 and percent-encoded data are accepted; the format is
+// detected from the data rather than trusted from the media type.
+// Returns an error if s is not a data URI or decoding fails.
+func FromDataURI(s string, options ...DecodeOption) *ImageProcessor {
+	data, err := parseDataURI(s)
+	if err != nil {
+		return &ImageProcessor{err: err}
+	}
+	return FromBytes(data, options...)
+}
+
+// parseDataURI returns the data of a data URI (RFC 2397).
+func parseDataURI(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 5 || !strings.EqualFold(s[:5], "data:") {
+		return nil, fmt.Errorf("not a data URI")
+	}
+	header, payload, ok := strings.Cut(s[5:], ",")
+	if !ok {
+		return nil, fmt.Errorf("data URI has no comma before its data")
+	}
+	params := strings.Split(header, ";")
+	if !strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64") {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent-encoded data URI: %w", err)
+		}
+		return []byte(data), nil
+	}
+	// Long data URIs are often wrapped, and padding is sometimes left out.
+	payload = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n", r) {
+			return -1
+		}
+		return r
+	}, payload)
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 data URI: %w", err)
+	}
+	return data, nil
+}
+
+// ToDataURI encodes the current image like ToBytes and returns it as a
+// base64 data URI, e.g. to inline a thumbnail in HTML or JSON. The media
+// type is that of the format actually produced, which differs from format
+// when WithCodecFallback falls back.
+// Returns an error if encoding fails or if a previous error in the chain
+// exists.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToDataURI(format ImageFormat, options ...EncodeOption) (string, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return "", ip.err
+	}
+	if ip.currentImage == nil {
+		return "", fmt.Errorf("no image available to convert to a data URI")
+	}
+
+	data, actual, err := encodeWithOptions(ip.currentImage, format, newEncodeOptions(ip.encOpts, options), ip.history, ip.outputMetadata())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode image to a data URI: %w", err)
+	}
+	return "data:" + actual.MIMEType() + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,58 @@
+package gopiq
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestDataURI(t *testing.T) {
+	proc := New(createTestImage(20, 10))
+	uri, err := proc.ToDataURI(FormatPNG)
+	if err != nil {
+		t.Fatalf("ToDataURI(FormatPNG) should not error, got: %v", err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,iVBORw0KGgo") {
+		t.Errorf("ToDataURI(FormatPNG) = %.40q..., want a base64 PNG data URI", uri)
+	}
+	img := mustImage(t, FromDataURI(uri))
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 10 {
+		t.Errorf("FromDataURI() decoded %v, want 20x10", img.Bounds())
+	}
+
+	// The media type follows the format produced by a fallback.
+	uri, err = proc.ToDataURI(FormatAVIF, WithCodecFallback([]ImageFormat{FormatJPEG}))
+	if err != nil || !strings.HasPrefix(uri, "data:image/jpeg;base64,") {
+		t.Errorf("ToDataURI() with a fallback = %.30q..., %v, want a JPEG data URI", uri, err)
+	}
+
+	// URIs as found in HTML: wrapped, without padding, with parameters, or
+	// percent-encoded.
+	data, _ := imageToPNGBytes(createTestImage(3, 3))
+	encoded := base64.StdEncoding.EncodeToString(data)
+	percent := "data:," + strings.NewReplacer("%", "%25").Replace(string(data))
+	for _, uri := range []string{
+		"DATA:image/png;base64," + encoded[:20] + "\n  " + encoded[20:],
+		" data:image/png;base64," + strings.TrimRight(encoded, "=") + " ",
+		"data:image/png;name=dot.png;base64," + encoded,
+		percent,
+	} {
+		if err := FromDataURI(uri).Err(); err != nil {
+			t.Errorf("FromDataURI(%.30q...) should not error, got: %v", uri, err)
+		}
+	}
+
+	if FormatTGA.MIMEType() != "image/x-tga" || FormatWebP.MIMEType() != "image/webp" || FormatUnknown.MIMEType() != "application/octet-stream" {
+		t.Error("MIMEType() should return the media type of each format")
+	}
+
+	// Test case: Invalid input
+	for _, bad := range []string{"", "image/png;base64,AAAA", "data:image/png;base64", "data:image/png;base64,!!!!", "data:,%zz", "data:text/plain;base64,aGVsbG8="} {
+		if FromDataURI(bad).Err() == nil {
+			t.Errorf("FromDataURI(%q) should return an error", bad)
+		}
+	}
+	if _, err := New(nil).ToDataURI(FormatPNG); err == nil {
+		t.Error("ToDataURI() on a processor with prior error should return that error")
+	}
+}
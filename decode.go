@@ -0,0 +1,380 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// DecodeOptions holds configuration for decoding images.
+type DecodeOptions struct {
+	// Lenient salvages truncated or corrupt JPEGs instead of failing. See
+	// WithLenientDecode.
+	Lenient bool
+	// Fill is the color of the part of a salvaged JPEG that could not be
+	// decoded. Nil means mid gray.
+	Fill color.Color
+	// Gray converts the decoded image to an *image.Gray. See WithGrayDecode.
+	Gray bool
+}
+
+// DecodeOption is a functional option for configuring FromBytes and
+// FromReaderAt.
+type DecodeOption func(*DecodeOptions)
+
+// WithLenientDecode makes decoding salvage truncated or corrupt JPEGs, such
+// as interrupted uploads, instead of failing: everything up to the damage is
+// decoded and the rest of the image is filled with the WithDamageFill color.
+// Progressive JPEGs that lack some of their later scans decode completely at
+// the quality of the scans available. Files damaged before the image data
+// starts, and formats other than JPEG, still fail. Salvaging is slow: a
+// truncated file is decoded about twice, and a corrupt one up to 14 times
+// to find where the damage starts.
+func WithLenientDecode() DecodeOption {
+	return func(do *DecodeOptions) { do.Lenient = true }
+}
+
+// WithDamageFill sets the color WithLenientDecode uses for the part of a
+// damaged JPEG that could not be decoded. The default is mid gray.
+func WithDamageFill(c color.Color) DecodeOption {
+	return func(do *DecodeOptions) { do.Fill = c }
+}
+
+// WithGrayDecode converts the decoded image to an 8-bit *image.Gray, using
+// the luma plane of JPEGs directly, so document pipelines run at 1 byte per
+// pixel from the start instead of a quarter of their memory going to RGBA.
+// Gray PNG and PGM files decode to *image.Gray without this option.
+func WithGrayDecode() DecodeOption {
+	return func(do *DecodeOptions) { do.Gray = true }
+}
+
+// newDecodeOptions applies options on top of the defaults.
+func newDecodeOptions(options []DecodeOption) *DecodeOptions {
+	do := &DecodeOptions{}
+	for _, opt := range options {
+		opt(do)
+	}
+	if do.Fill == nil {
+		do.Fill = color.Gray{Y: 128}
+	}
+	return do
+}
+
+// decodeWithOptions decodes data, salvaging damaged JPEGs if do is lenient.
+func decodeWithOptions(data []byte, do *DecodeOptions) (image.Image, error) {
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil && do.Lenient && DetectFormat(data) == FormatJPEG {
+		if salvaged := salvageJPEG(data, do.Fill); salvaged != nil {
+			img, err = salvaged, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return do.apply(img), nil
+}
+
+// apply performs the conversions requested by do on a decoded image.
+func (do *DecodeOptions) apply(img image.Image) image.Image {
+	if !do.Gray {
+		return img
+	}
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+	gray, _ := New(img).ToGray()
+	return gray
+}
+
+// JPEG markers used while salvaging.
+const (
+	jpegSOF0 = 0xc0
+	jpegSOF1 = 0xc1
+	jpegSOF2 = 0xc2
+	jpegRST0 = 0xd0
+	jpegRST7 = 0xd7
+	jpegEOI  = 0xd9
+	jpegSOS  = 0xda
+	jpegDRI  = 0xdd
+)
+
+// salvageSearchSteps bounds the decodes spent finding the intact part of a
+// corrupt scan, each of which decodes the whole image: the search stops
+// within 1/1024 of the scan length, losing at most that much of it to the
+// fill.
+const salvageSearchSteps = 10
+
+// paddingPerBlock is the number of zero bytes budgeted for each missing 8x8
+// block. Zero bits always decode as the shortest Huffman code, so this is
+// generous for any table while costing little to skip.
+const paddingPerBlock = 128
+
+// jpegLayout describes the structure of a (possibly damaged) JPEG file.
+type jpegLayout struct {
+	progressive     bool
+	width, height   int
+	mcuW, mcuH      int // MCU size in pixels
+	blocksPerMCU    int
+	restartInterval int // MCUs per restart interval, 0 if none
+	scans           []jpegScan
+}
+
+// jpegScan locates one scan: the SOS marker and its entropy-coded data.
+type jpegScan struct {
+	marker, start, end int
+}
+
+// mcus returns the number of MCU columns and rows.
+func (l *jpegLayout) mcus() (int, int) {
+	return (l.width + l.mcuW - 1) / l.mcuW, (l.height + l.mcuH - 1) / l.mcuH
+}
+
+// parseJPEGLayout walks the segments of data up to the first damage. It
+// returns nil if no frame header and scan were found.
+func parseJPEGLayout(data []byte) *jpegLayout {
+	l := &jpegLayout{}
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		switch {
+		case marker == 0xff: // Fill byte
+			i++
+			continue
+		case marker == jpegEOI:
+			return l.valid()
+		case marker >= jpegRST0 && marker <= jpegRST7:
+			i += 2
+			continue
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			break
+		}
+		seg := data[i+4 : end]
+		switch marker {
+		case jpegSOF0, jpegSOF1, jpegSOF2:
+			if len(seg) < 6 || len(seg) < 6+3*int(seg[5]) {
+				return nil
+			}
+			l.progressive = marker == jpegSOF2
+			l.height = int(binary.BigEndian.Uint16(seg[1:]))
+			l.width = int(binary.BigEndian.Uint16(seg[3:]))
+			hMax, vMax, blocks := 1, 1, 0
+			for c := range int(seg[5]) {
+				h, v := int(seg[7+3*c]>>4), int(seg[7+3*c]&0x0f)
+				hMax, vMax, blocks = max(hMax, h), max(vMax, v), blocks+h*v
+			}
+			if seg[5] == 1 {
+				// Single component images have 8x8 MCUs regardless of sampling.
+				hMax, vMax, blocks = 1, 1, 1
+			}
+			l.mcuW, l.mcuH, l.blocksPerMCU = 8*hMax, 8*vMax, blocks
+		case jpegDRI:
+			if len(seg) >= 2 {
+				l.restartInterval = int(binary.BigEndian.Uint16(seg))
+			}
+		case jpegSOS:
+			// The entropy-coded data runs to the next marker other than a
+			// stuffed 0xff or a restart marker.
+			j := end
+			for ; j+1 < len(data); j++ {
+				if next := data[j+1]; data[j] == 0xff && next != 0 && next != 0xff && (next < jpegRST0 || next > jpegRST7) {
+					break
+				}
+			}
+			if j+1 >= len(data) {
+				j = len(data)
+			}
+			l.scans = append(l.scans, jpegScan{marker: i, start: end, end: j})
+			end = j
+		}
+		i = end
+	}
+	return l.valid()
+}
+
+// valid returns l if it has a frame header and at least one scan.
+func (l *jpegLayout) valid() *jpegLayout {
+	if l.width == 0 || l.height == 0 || l.mcuW == 0 || l.blocksPerMCU == 0 || len(l.scans) == 0 {
+		return nil
+	}
+	return l
+}
+
+// salvageJPEG decodes as much of a damaged JPEG as possible and fills the
+// rest with fill. It returns nil if nothing could be recovered.
+func salvageJPEG(data []byte, fill color.Color) image.Image {
+	l := parseJPEGLayout(data)
+	if l == nil {
+		return nil
+	}
+
+	// A progressive image is complete after its first scans, so dropping
+	// the damaged later ones only costs quality.
+	if l.progressive {
+		for k := len(l.scans) - 1; k > 0; k-- {
+			prefix := append(data[:l.scans[k].marker:l.scans[k].marker], 0xff, jpegEOI)
+			if img, err := decodeImage(bytes.NewReader(prefix)); err == nil {
+				return img
+			}
+		}
+	}
+
+	// Otherwise pad the damaged scan with zero bits, which decode as valid
+	// codes, and find how much of it is intact.
+	scan := l.scans[len(l.scans)-1]
+	if l.progressive {
+		scan = l.scans[0]
+	}
+	decodePadded := func(n int) image.Image {
+		img, err := decodeImage(io.MultiReader(
+			bytes.NewReader(data[:scan.start+n]),
+			newJPEGPadding(l, data[scan.start:scan.start+n]),
+		))
+		if err != nil {
+			return nil
+		}
+		return img
+	}
+
+	n := scan.end - scan.start
+	img := decodePadded(n)
+	if img == nil {
+		// Corrupt rather than truncated: find the longest prefix that
+		// decodes, to within 1/2^salvageSearchSteps of the scan.
+		lo, hi := 0, n
+		if img = decodePadded(lo); img == nil {
+			return nil
+		}
+		for hi-lo > max(1, n>>salvageSearchSteps) {
+			mid := (lo + hi) / 2
+			if m := decodePadded(mid); m != nil {
+				lo, img = mid, m
+			} else {
+				hi = mid
+			}
+		}
+		n = lo
+	}
+
+	// The padding decodes to noise. Replacing the last nonzero data byte
+	// with padding changes the output from the MCU holding it onwards, which
+	// marks where the intact data ends.
+	out := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	damaged := 0
+	m := n - 1
+	for m >= 0 && data[scan.start+m] == 0 {
+		m--
+	}
+	if m >= 0 {
+		draw.Draw(out, out.Rect, img, img.Bounds().Min, draw.Src)
+		if shorter := decodePadded(m); shorter != nil {
+			damaged = firstDifferingMCU(out, asRGBA(shorter), l)
+		}
+	}
+
+	mcusX, mcusY := l.mcus()
+	if damaged < mcusX*mcusY {
+		mx, my := damaged%mcusX, damaged/mcusX
+		src := image.NewUniform(fill)
+		draw.Draw(out, image.Rect(mx*l.mcuW, my*l.mcuH, l.width, (my+1)*l.mcuH).Intersect(out.Rect), src, image.Point{}, draw.Src)
+		draw.Draw(out, image.Rect(0, (my+1)*l.mcuH, l.width, l.height).Intersect(out.Rect), src, image.Point{}, draw.Src)
+	}
+	return out
+}
+
+// firstDifferingMCU returns the index, in decoding order, of the first MCU in
+// which a and b differ, or the number of MCUs if they are equal.
+func firstDifferingMCU(a, b *image.RGBA, l *jpegLayout) int {
+	mcusX, mcusY := l.mcus()
+	for my := range mcusY {
+		minX := -1
+		for y := my * l.mcuH; y < min((my+1)*l.mcuH, l.height); y++ {
+			rowA := a.Pix[y*a.Stride : y*a.Stride+4*l.width]
+			rowB := b.Pix[y*b.Stride : y*b.Stride+4*l.width]
+			if bytes.Equal(rowA, rowB) {
+				continue
+			}
+			for x := 0; x < l.width && (minX < 0 || x < minX); x++ {
+				if !bytes.Equal(rowA[4*x:4*x+4], rowB[4*x:4*x+4]) {
+					minX = x
+					break
+				}
+			}
+		}
+		if minX >= 0 {
+			return my*mcusX + minX/l.mcuW
+		}
+	}
+	return mcusX * mcusY
+}
+
+// jpegPadding supplies the zero bytes that complete a damaged scan, with the
+// restart markers the decoder expects if the image uses restart intervals,
+// followed by an EOI marker.
+type jpegPadding struct {
+	zeros    int    // Zero bytes left before the next marker
+	interval int    // Zero bytes per restart interval
+	restarts int    // Restart markers left
+	rst      byte   // Next restart marker
+	marker   []byte // Marker bytes being written
+	done     bool   // EOI has been queued
+}
+
+// newJPEGPadding returns the padding for layout l after the intact scan
+// bytes data.
+func newJPEGPadding(l *jpegLayout, data []byte) *jpegPadding {
+	mcusX, mcusY := l.mcus()
+	blocks := mcusX * mcusY * l.blocksPerMCU
+	if l.restartInterval == 0 {
+		return &jpegPadding{zeros: blocks * paddingPerBlock}
+	}
+	p := &jpegPadding{
+		interval: l.restartInterval * l.blocksPerMCU * paddingPerBlock,
+		restarts: blocks/l.restartInterval + 1,
+		rst:      jpegRST0,
+	}
+	p.zeros = p.interval
+	// Continue the restart marker sequence from the last intact marker.
+	for j := len(data) - 2; j >= 0; j-- {
+		if data[j] == 0xff && data[j+1] >= jpegRST0 && data[j+1] <= jpegRST7 {
+			p.rst = jpegRST0 + (data[j+1]-jpegRST0+1)%8
+			break
+		}
+	}
+	return p
+}
+
+func (p *jpegPadding) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		switch {
+		case len(p.marker) > 0:
+			c := copy(b[n:], p.marker)
+			p.marker = p.marker[c:]
+			n += c
+		case p.zeros > 0:
+			c := min(p.zeros, len(b)-n)
+			clear(b[n : n+c])
+			p.zeros -= c
+			n += c
+		case p.restarts > 0:
+			p.marker = []byte{0xff, p.rst}
+			p.rst = jpegRST0 + (p.rst-jpegRST0+1)%8
+			p.restarts--
+			p.zeros = p.interval
+		case !p.done:
+			p.marker = []byte{0xff, jpegEOI}
+			p.done = true
+		default:
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+	}
+	return n, nil
+}
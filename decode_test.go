@@ -0,0 +1,129 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWithLenientDecode(t *testing.T) {
+	data, _ := imageToJPEGBytes(createTestImage(160, 120))
+	intact, _ := FromBytes(data).Image()
+	sos := bytes.Index(data, []byte{0xff, 0xda})
+	gray := color.RGBA{128, 128, 128, 255}
+
+	// closeTo reports whether img matches the intact decode at (x, y).
+	closeTo := func(img image.Image, x, y int) bool {
+		r1, g1, b1, _ := img.At(x, y).RGBA()
+		r2, g2, b2, _ := intact.At(x, y).RGBA()
+		return abs(int(r1>>8)-int(r2>>8)) <= 2 && abs(int(g1>>8)-int(g2>>8)) <= 2 && abs(int(b1>>8)-int(b2>>8)) <= 2
+	}
+
+	// Test case: Truncated upload
+	truncated := data[:sos+(len(data)-sos)/2]
+	if FromBytes(truncated).Err() == nil {
+		t.Fatal("FromBytes() of a truncated JPEG should error without WithLenientDecode")
+	}
+	proc := FromBytes(truncated, WithLenientDecode())
+	if proc.Err() != nil {
+		t.Fatalf("FromBytes() with WithLenientDecode should salvage a truncated JPEG, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != intact.Bounds() {
+		t.Fatalf("salvaged image bounds = %v, want %v", img.Bounds(), intact.Bounds())
+	}
+	for _, p := range []image.Point{{5, 5}, {155, 5}, {80, 30}} {
+		if !closeTo(img, p.X, p.Y) {
+			t.Errorf("salvaged pixel %v = %v, want close to the intact %v", p, img.At(p.X, p.Y), intact.At(p.X, p.Y))
+		}
+	}
+	for _, p := range []image.Point{{5, 115}, {155, 115}} {
+		if got := color.RGBAModel.Convert(img.At(p.X, p.Y)); got != gray {
+			t.Errorf("missing pixel %v = %v, want the default gray fill", p, got)
+		}
+	}
+
+	// Test case: Custom fill color
+	red := color.RGBA{255, 0, 0, 255}
+	img, _ = FromBytes(truncated, WithLenientDecode(), WithDamageFill(red)).Image()
+	if got := color.RGBAModel.Convert(img.At(155, 115)); got != red {
+		t.Errorf("missing pixel with WithDamageFill = %v, want %v", got, red)
+	}
+
+	// Test case: Corrupt data in the middle of the scan
+	corrupt := bytes.Clone(data)
+	mid := sos + (len(data)-sos)/3
+	corrupt[mid], corrupt[mid+1] = 0xff, 0x99
+	img, err := FromBytes(corrupt, WithLenientDecode()).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() with WithLenientDecode should salvage a corrupt JPEG, got: %v", err)
+	}
+	if !closeTo(img, 5, 5) {
+		t.Errorf("salvaged corrupt pixel (5,5) = %v, want close to the intact %v", img.At(5, 5), intact.At(5, 5))
+	}
+	if got := color.RGBAModel.Convert(img.At(155, 115)); got != gray {
+		t.Errorf("pixel after corruption = %v, want the gray fill", got)
+	}
+
+	// Test case: Reader input
+	img, err = FromReaderAt(bytes.NewReader(truncated), int64(len(truncated)), WithLenientDecode()).Image()
+	if err != nil || !closeTo(img, 5, 5) {
+		t.Errorf("FromReaderAt() with WithLenientDecode = %v, want a salvaged image", err)
+	}
+
+	// Test case: Intact files are unaffected
+	img, err = FromBytes(data, WithLenientDecode()).Image()
+	if err != nil || img.Bounds() != intact.Bounds() || !closeTo(img, 155, 115) {
+		t.Errorf("FromBytes() of an intact JPEG with WithLenientDecode = %v, want the normal decode", err)
+	}
+
+	// Test case: Nothing to salvage
+	if FromBytes(data[:sos], WithLenientDecode()).Err() == nil {
+		t.Error("FromBytes() of a JPEG without image data should still error")
+	}
+	pngData, _ := imageToPNGBytes(createTestImage(40, 40))
+	if FromBytes(pngData[:len(pngData)/2], WithLenientDecode()).Err() == nil {
+		t.Error("FromBytes() of a truncated PNG should still error")
+	}
+}
+
+// testWebPLossless and testWebPLossy are 1×1 WebP images: a transparent
+// lossless pixel and a light gray lossy one.
+const (
+	testWebPLossless = "RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"
+	testWebPLossy    = "RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00\x30\x01\x00\x9d\x01\x2a\x01\x00\x01\x00\x02\x00\x34\x25\xa4\x00\x03\x70\x00\xfe\xfb\x94\x00\x00"
+)
+
+func TestFromBytesWebP(t *testing.T) {
+	for name, data := range map[string]string{"lossless": testWebPLossless, "lossy": testWebPLossy} {
+		if got := DetectFormat([]byte(data)); got != FormatWebP {
+			t.Errorf("DetectFormat() of %s WebP = %v, want FormatWebP", name, got)
+		}
+		img, err := FromBytes([]byte(data)).Image()
+		if err != nil {
+			t.Fatalf("FromBytes() of %s WebP should not error, got: %v", name, err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 1, 1) {
+			t.Errorf("%s WebP bounds = %v, want 1x1", name, img.Bounds())
+		}
+		info, err := ProbeReaderAt(bytes.NewReader([]byte(data)), int64(len(data)))
+		if err != nil || info.Format != FormatWebP || info.Width != 1 || info.Height != 1 {
+			t.Errorf("ProbeReaderAt() of %s WebP = %+v, %v; want a 1x1 FormatWebP", name, info, err)
+		}
+	}
+
+	lossless, _ := FromBytes([]byte(testWebPLossless)).Image()
+	if _, _, _, a := lossless.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("lossless WebP pixel alpha = %d, want transparent", a>>8)
+	}
+	lossy, _ := FromBytes([]byte(testWebPLossy)).Image()
+	if r, g, b, a := lossy.At(0, 0).RGBA(); a != 0xffff || r>>8 < 200 || abs(int(r>>8)-int(g>>8)) > 4 || abs(int(g>>8)-int(b>>8)) > 4 {
+		t.Errorf("lossy WebP pixel = %d,%d,%d,%d, want opaque light gray", r>>8, g>>8, b>>8, a>>8)
+	}
+
+	// Test case: Invalid input
+	if err := FromBytes([]byte(testWebPLossy[:30])).Err(); err == nil {
+		t.Error("FromBytes() of a truncated WebP should return an error")
+	}
+}
@@ -0,0 +1,324 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+const (
+	// docMaxSkew is the largest skew angle in degrees CleanDocument corrects.
+	docMaxSkew = 10.0
+	// docSkewAnalysisSide is the longest side of the image used for skew detection.
+	docSkewAnalysisSide = 800
+	// docBackgroundBlock is the block size in pixels over which the paper
+	// brightness is estimated.
+	docBackgroundBlock = 32
+	// docWhiteLevel is the normalized luma above which a pixel becomes paper.
+	docWhiteLevel = 0.85
+	// docSpeckleArea is the largest ink blob in pixels that counts as noise.
+	docSpeckleArea = 4
+	// docMargin is the margin kept around the content, relative to the
+	// shorter image side.
+	docMargin = 0.02
+	// whiteboardSaturation is the chroma gain applied to marker strokes.
+	whiteboardSaturation = 1.6
+	// whiteboardMaxChroma is the largest channel spread of a pixel that may
+	// still be whitened as board background, so light markers survive.
+	whiteboardMaxChroma = 48
+)
+
+// CleanDocument applies the standard scanner-app cleanup to a photographed or
+// scanned page in one step:
+//   - deskew: small rotations (up to 10 degrees) are detected from text-line
+//     projection profiles and undone
+//   - background whitening: uneven lighting is normalized against the local
+//     paper brightness and the paper is set to pure white, while ink keeps
+//     its color
+//   - despeckle: isolated dots of a few pixels are removed
+//   - margin trim: the page is cropped to its content plus a small margin
+//
+// The result is opaque; transparent areas are treated as paper.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) CleanDocument() *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+
+	page := whitenBackground(flattenOnto(ip.currentImage, color.RGBA{255, 255, 255, 255}))
+	if angle := detectSkew(page); math.Abs(angle) >= 0.1 {
+		page = rotateImage(page, -angle, color.RGBA{255, 255, 255, 255})
+		// Resampling leaves near-white fringes along the rotated page edges.
+		snapToWhite(page)
+	}
+	despeckle(page, docSpeckleArea)
+	ip.currentImage = trimMargins(page)
+	ip.record("CleanDocument")
+	return ip
+}
+
+// EnhanceWhiteboard cleans up a photo of a whiteboard: uneven lighting and
+// shadows are normalized against the local board brightness, the board is
+// whitened, and marker strokes get a saturation boost so colors stay
+// distinguishable. Bright but colorful strokes such as yellow highlighter are
+// not mistaken for background. The result is opaque.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) EnhanceWhiteboard() *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+
+	board := normalizeIllumination(flattenOnto(ip.currentImage, color.RGBA{255, 255, 255, 255}))
+	width, height := board.Rect.Dx(), board.Rect.Dy()
+	if err := ip.processRowsErr(width, height, func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			row := board.Pix[y*board.Stride : y*board.Stride+width*4]
+			for i := 0; i < len(row); i += 4 {
+				r, g, b := row[i], row[i+1], row[i+2]
+				l := luminance(r, g, b)
+				if l >= docWhiteLevel*255 && int(max(r, g, b))-int(min(r, g, b)) < whiteboardMaxChroma {
+					row[i], row[i+1], row[i+2] = 255, 255, 255
+					continue
+				}
+				for c := 0; c < 3; c++ {
+					row[i+c] = clampUint8(l + (float64(row[i+c])-l)*whiteboardSaturation)
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		ip.err = err
+		return ip
+	}
+
+	ip.currentImage = board
+	ip.record("EnhanceWhiteboard")
+	return ip
+}
+
+// flattenOnto returns an opaque origin-based copy of img composited over bg.
+func flattenOnto(img image.Image, bg color.Color) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Over)
+	return dst
+}
+
+// detectSkew returns the angle in degrees (counter-clockwise) by which the
+// text lines of img are rotated, found by maximizing the contrast of the
+// horizontal projection profile of ink pixels.
+func detectSkew(img *image.RGBA) float64 {
+	small := img
+	if side := max(img.Rect.Dx(), img.Rect.Dy()); side > docSkewAnalysisSide {
+		s := float64(docSkewAnalysisSide) / float64(side)
+		small = image.NewRGBA(image.Rect(0, 0, max(1, int(float64(img.Rect.Dx())*s)), max(1, int(float64(img.Rect.Dy())*s))))
+		draw.ApproxBiLinear.Scale(small, small.Rect, img, img.Rect, draw.Src, nil)
+	}
+	ink, w, h := binarize(small)
+	var points []image.Point
+	for i, v := range ink {
+		if v {
+			points = append(points, image.Pt(i%w, i/w))
+		}
+	}
+	if len(points) == 0 {
+		return 0
+	}
+
+	cx, cy := float64(w)/2, float64(h)/2
+	diag := int(math.Hypot(float64(w), float64(h))) + 2
+	profile := make([]float64, diag)
+	score := func(deg float64) float64 {
+		for i := range profile {
+			profile[i] = 0
+		}
+		sin, cos := math.Sincos(deg * math.Pi / 180)
+		for _, p := range points {
+			// Row of the point after rotating it clockwise by deg.
+			y := (float64(p.X)-cx)*sin + (float64(p.Y)-cy)*cos + float64(diag)/2
+			profile[min(max(int(y), 0), diag-1)]++
+		}
+		s := 0.0
+		for _, v := range profile {
+			s += v * v
+		}
+		return s
+	}
+
+	// Coarse search, then refine around the best angle.
+	best, bestScore := 0.0, score(0)
+	search := func(from, to, step float64) {
+		for a := from; a <= to+1e-9; a += step {
+			if s := score(a); s > bestScore {
+				best, bestScore = a, s
+			}
+		}
+	}
+	search(-docMaxSkew, docMaxSkew, 0.5)
+	search(best-0.5, best+0.5, 0.1)
+	return math.Round(best*10) / 10
+}
+
+// rotateImage rotates src counter-clockwise by degrees around its center,
+// keeping its size. Uncovered areas are filled with bg.
+func rotateImage(src *image.RGBA, degrees float64, bg color.Color) *image.RGBA {
+	dst := image.NewRGBA(src.Rect)
+	draw.Draw(dst, dst.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	cx, cy := float64(src.Rect.Dx())/2, float64(src.Rect.Dy())/2
+	m := f64.Aff3{
+		cos, sin, cx - cx*cos - cy*sin,
+		-sin, cos, cy + cx*sin - cy*cos,
+	}
+	draw.BiLinear.Transform(dst, m, src, src.Rect, draw.Over, nil)
+	return dst
+}
+
+// whitenBackground normalizes the illumination of img, then sets everything
+// brighter than docWhiteLevel to pure white. Darker pixels keep their
+// (normalized) color.
+func whitenBackground(img *image.RGBA) *image.RGBA {
+	dst := normalizeIllumination(img)
+	snapToWhite(dst)
+	return dst
+}
+
+// normalizeIllumination divides every pixel of an opaque image by the local
+// paper brightness so that shadows and uneven lighting disappear.
+func normalizeIllumination(img *image.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	bw, bh := (w+docBackgroundBlock-1)/docBackgroundBlock, (h+docBackgroundBlock-1)/docBackgroundBlock
+
+	// Paper brightness per block: the 90th percentile of its luma, which
+	// ignores ink as long as the block is not mostly ink.
+	blocks := make([]float64, bw*bh)
+	var values []float64
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			values = values[:0]
+			for y := by * docBackgroundBlock; y < min((by+1)*docBackgroundBlock, h); y++ {
+				for x := bx * docBackgroundBlock; x < min((bx+1)*docBackgroundBlock, w); x++ {
+					i := y*img.Stride + x*4
+					values = append(values, luminance(img.Pix[i], img.Pix[i+1], img.Pix[i+2]))
+				}
+			}
+			sort.Float64s(values)
+			blocks[by*bw+bx] = max(values[len(values)*9/10], 1)
+		}
+	}
+	// paper interpolates the block estimates bilinearly between block centers.
+	paper := func(x, y int) float64 {
+		fx := min(max((float64(x)+0.5)/docBackgroundBlock-0.5, 0), float64(bw-1))
+		fy := min(max((float64(y)+0.5)/docBackgroundBlock-0.5, 0), float64(bh-1))
+		x0, y0 := int(fx), int(fy)
+		x1, y1 := min(x0+1, bw-1), min(y0+1, bh-1)
+		tx, ty := fx-float64(x0), fy-float64(y0)
+		top := blocks[y0*bw+x0]*(1-tx) + blocks[y0*bw+x1]*tx
+		bottom := blocks[y1*bw+x0]*(1-tx) + blocks[y1*bw+x1]*tx
+		return top*(1-ty) + bottom*ty
+	}
+
+	dst := image.NewRGBA(img.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			gain := 255 / paper(x, y)
+			di := y*dst.Stride + x*4
+			dst.Pix[di] = clampUint8(float64(img.Pix[i]) * gain)
+			dst.Pix[di+1] = clampUint8(float64(img.Pix[i+1]) * gain)
+			dst.Pix[di+2] = clampUint8(float64(img.Pix[i+2]) * gain)
+			dst.Pix[di+3] = 255
+		}
+	}
+	return dst
+}
+
+// snapToWhite sets pixels of an opaque image whose luma is at least
+// docWhiteLevel to pure white.
+func snapToWhite(img *image.RGBA) {
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			if luminance(row[i], row[i+1], row[i+2]) >= docWhiteLevel*255 {
+				row[i], row[i+1], row[i+2] = 255, 255, 255
+			}
+		}
+	}
+}
+
+// despeckle whitens 8-connected groups of non-white pixels of at most
+// maxArea pixels in an opaque image.
+func despeckle(img *image.RGBA, maxArea int) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	isInk := func(x, y int) bool {
+		i := y*img.Stride + x*4
+		return img.Pix[i] != 255 || img.Pix[i+1] != 255 || img.Pix[i+2] != 255
+	}
+	visited := make([]bool, w*h)
+	var component, stack []image.Point
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if visited[y*w+x] || !isInk(x, y) {
+				continue
+			}
+			component = component[:0]
+			stack = append(stack[:0], image.Pt(x, y))
+			visited[y*w+x] = true
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				component = append(component, p)
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := p.X+dx, p.Y+dy
+						if nx < 0 || ny < 0 || nx >= w || ny >= h || visited[ny*w+nx] || !isInk(nx, ny) {
+							continue
+						}
+						visited[ny*w+nx] = true
+						stack = append(stack, image.Pt(nx, ny))
+					}
+				}
+			}
+			if len(component) <= maxArea {
+				for _, p := range component {
+					i := p.Y*img.Stride + p.X*4
+					copy(img.Pix[i:i+4], []uint8{255, 255, 255, 255})
+				}
+			}
+		}
+	}
+}
+
+// trimMargins crops an opaque image on a white background to the bounding
+// box of its non-white content plus docMargin. Blank images are returned
+// unchanged.
+func trimMargins(img *image.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var content image.Rectangle
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			if img.Pix[i] != 255 || img.Pix[i+1] != 255 || img.Pix[i+2] != 255 {
+				content = content.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if content.Empty() {
+		return img
+	}
+	margin := max(4, int(docMargin*float64(min(w, h))))
+	return asRGBA(img.SubImage(content.Inset(-margin).Intersect(img.Rect)))
+}
@@ -0,0 +1,132 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestCleanDocument(t *testing.T) {
+	page := createTextPage(t)
+
+	// Simulate a phone scan: skewed, unevenly lit and speckled.
+	scan := rotateImage(page, 3, color.White)
+	for y := 0; y < scan.Rect.Dy(); y++ {
+		for x := 0; x < scan.Rect.Dx(); x++ {
+			i := y*scan.Stride + x*4
+			shade := 1 - 0.35*float64(x)/float64(scan.Rect.Dx())
+			for c := 0; c < 3; c++ {
+				scan.Pix[i+c] = uint8(float64(scan.Pix[i+c]) * shade)
+			}
+		}
+	}
+	scan.SetRGBA(10, 290, color.RGBA{0, 0, 0, 255})
+	scan.SetRGBA(400, 5, color.RGBA{0, 0, 0, 255})
+
+	if angle := detectSkew(scan); math.Abs(angle-3) > 0.3 {
+		t.Errorf("detectSkew() = %.1f, want about 3", angle)
+	}
+
+	proc := New(scan).CleanDocument()
+	if proc.Err() != nil {
+		t.Fatalf("CleanDocument() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	cleaned := asRGBA(img)
+
+	if angle := detectSkew(cleaned); math.Abs(angle) > 0.3 {
+		t.Errorf("CleanDocument() left a skew of %.1f degrees", angle)
+	}
+	if b := cleaned.Bounds(); b.Dx() >= scan.Rect.Dx() || b.Dy() >= scan.Rect.Dy() {
+		t.Errorf("CleanDocument() should trim margins, got %v", b)
+	}
+
+	// Paper is pure white across the lighting gradient, ink remains.
+	b := cleaned.Bounds()
+	for _, p := range []image.Point{{1, 1}, {b.Dx() - 2, 1}, {b.Dx() - 2, b.Dy() - 2}} {
+		if c := cleaned.RGBAAt(p.X, p.Y); c != (color.RGBA{255, 255, 255, 255}) {
+			t.Errorf("CleanDocument() background at %v = %v, want white", p, c)
+		}
+	}
+	dark := 0
+	for i := 0; i < len(cleaned.Pix); i += 4 {
+		if cleaned.Pix[i] < 100 {
+			dark++
+		}
+	}
+	if dark < 1000 {
+		t.Errorf("CleanDocument() lost the text, only %d dark pixels", dark)
+	}
+
+	if New(nil).CleanDocument().Err() == nil {
+		t.Fatal("CleanDocument() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestDespeckle(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	black := color.RGBA{0, 0, 0, 255}
+	img.SetRGBA(2, 2, black) // Speck
+	img.SetRGBA(3, 3, black) // Diagonally connected to the speck
+	for x := 5; x < 15; x++ {
+		img.SetRGBA(x, 10, black) // Line
+	}
+
+	despeckle(img, 4)
+	if img.RGBAAt(2, 2) != (color.RGBA{255, 255, 255, 255}) || img.RGBAAt(3, 3) != (color.RGBA{255, 255, 255, 255}) {
+		t.Error("despeckle() should remove small specks")
+	}
+	if img.RGBAAt(10, 10) != black {
+		t.Error("despeckle() should keep larger components")
+	}
+}
+
+func TestEnhanceWhiteboard(t *testing.T) {
+	// A dim, unevenly lit board with a blue and a yellow stroke.
+	board := image.NewRGBA(image.Rect(0, 0, 200, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 200; x++ {
+			shade := 0.55 + 0.3*float64(x)/200
+			c := color.RGBA{uint8(235 * shade), uint8(235 * shade), uint8(228 * shade), 255}
+			switch {
+			case y >= 30 && y < 36 && x >= 20 && x < 180:
+				c = color.RGBA{uint8(40 * shade), uint8(70 * shade), uint8(200 * shade), 255}
+			case y >= 80 && y < 86 && x >= 20 && x < 180:
+				c = color.RGBA{uint8(235 * shade), uint8(225 * shade), uint8(60 * shade), 255}
+			}
+			board.SetRGBA(x, y, c)
+		}
+	}
+
+	proc := New(board).EnhanceWhiteboard()
+	if proc.Err() != nil {
+		t.Fatalf("EnhanceWhiteboard() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	out := asRGBA(img)
+	if out.Rect != board.Rect {
+		t.Errorf("EnhanceWhiteboard() changed bounds to %v", out.Rect)
+	}
+
+	white := color.RGBA{255, 255, 255, 255}
+	for _, p := range []image.Point{{5, 5}, {195, 5}, {100, 60}, {5, 115}} {
+		if c := out.RGBAAt(p.X, p.Y); c != white {
+			t.Errorf("EnhanceWhiteboard() board at %v = %v, want white", p, c)
+		}
+	}
+	saturation := func(c color.RGBA) int { return int(max(c.R, c.G, c.B)) - int(min(c.R, c.G, c.B)) }
+	for _, p := range []image.Point{{30, 33}, {170, 33}, {30, 83}, {170, 83}} {
+		before, after := board.RGBAAt(p.X, p.Y), out.RGBAAt(p.X, p.Y)
+		if after == white || saturation(after) <= saturation(before) {
+			t.Errorf("EnhanceWhiteboard() stroke at %v = %v (was %v), want kept and more saturated", p, after, before)
+		}
+	}
+
+	if New(nil).EnhanceWhiteboard().Err() == nil {
+		t.Fatal("EnhanceWhiteboard() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,103 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// WithDPI sets the pixel density of JPEG and PNG output in dots per inch,
+// so that print workflows size the image correctly instead of assuming
+// 72 DPI: a JFIF segment for JPEG, rounded to whole dots per inch, and a
+// pHYs chunk for PNG. With WithKeepMetadata, the EXIF resolution is set
+// too. Other formats ignore it. Encoding fails for densities that are not
+// positive or that the format cannot store.
+func WithDPI(x, y float64) EncodeOption {
+	return func(eo *EncodeOptions) { eo.XDPI, eo.YDPI = x, y }
+}
+
+// embedDPI stores a pixel density in encoded image data of format,
+// replacing any stored by the encoder.
+func embedDPI(data []byte, format ImageFormat, x, y float64) ([]byte, error) {
+	if !(x > 0 && y > 0) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return nil, fmt.Errorf("invalid DPI %vx%v: must be positive", x, y)
+	}
+	r, size := bytes.NewReader(data), int64(len(data))
+	switch format {
+	case FormatJPEG:
+		dx, dy := math.Round(x), math.Round(y)
+		if dx < 1 || dy < 1 || dx > math.MaxUint16 || dy > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid DPI %vx%v: JPEG stores 1 to 65535", x, y)
+		}
+		// JFIF 1.01 in dots per inch, without a thumbnail.
+		out := appendJPEGSegment(slices.Clone(data[:2]), 0xe0, 'J', 'F', 'I', 'F', 0, 1, 1, 1,
+			byte(int(dx)>>8), byte(dx), byte(int(dy)>>8), byte(dy), 0, 0)
+		end := jpegSegments(r, size, func(marker byte, off, n int64) {
+			if marker != 0xe0 || !bytes.HasPrefix(data[off+4:], []byte("JFIF\x00")) {
+				out = append(out, data[off:off+n]...)
+			}
+		})
+		return append(out, data[end:]...), nil
+	case FormatPNG:
+		px, py := math.Round(x/0.0254), math.Round(y/0.0254)
+		if px < 1 || py < 1 || px > math.MaxInt32 || py > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid DPI %vx%v: out of range for PNG", x, y)
+		}
+		phys := binary.BigEndian.AppendUint32(nil, uint32(px))
+		phys = binary.BigEndian.AppendUint32(phys, uint32(py))
+		out := appendPNGChunk(slices.Clone(data[:pngIHDREnd]), "pHYs", append(phys, 1)) // Per meter
+		end := pngChunks(r, size, func(typ string, off, n int64) {
+			if off >= pngIHDREnd && typ != "pHYs" {
+				out = append(out, data[off:off+n]...)
+			}
+		})
+		return append(out, data[end:]...), nil
+	default:
+		return data, nil
+	}
+}
+
+// exifWithResolution returns a copy of exif whose resolution tags, if it
+// has them, are set to x and y dots per inch.
+func exifWithResolution(exif []byte, x, y float64) []byte {
+	if len(exif) < 8 {
+		return exif
+	}
+	var order binary.ByteOrder
+	switch string(exif[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return exif
+	}
+	ifd := int64(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > int64(len(exif)) {
+		return exif
+	}
+	out := slices.Clone(exif)
+	for i := range int64(order.Uint16(exif[ifd:])) {
+		e := ifd + 2 + 12*i
+		if e+12 > int64(len(exif)) {
+			break
+		}
+		tag, typ := order.Uint16(exif[e:]), order.Uint16(exif[e+2:])
+		switch {
+		case (tag == exifXResolution || tag == exifYResolution) && typ == 5: // RATIONAL
+			v, at := x, int64(order.Uint32(exif[e+8:]))
+			if tag == exifYResolution {
+				v = y
+			}
+			if at+8 <= int64(len(exif)) {
+				order.PutUint32(out[at:], uint32(math.Round(v*100)))
+				order.PutUint32(out[at+4:], 100)
+			}
+		case tag == exifResolutionUnit && typ == 3: // SHORT
+			order.PutUint16(out[e+8:], 2) // Inches
+		}
+	}
+	return out
+}
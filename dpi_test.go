@@ -0,0 +1,73 @@
+package gopiq
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestDPI(t *testing.T) {
+	proc := New(gradientImage(16, 8))
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG} {
+		data := mustBytes(t, proc, format, WithDPI(300, 150))
+		md, err := FromBytes(data).Metadata()
+		if err != nil {
+			t.Fatalf("Metadata() of %s output should not error, got: %v", format, err)
+		}
+		// PNG stores whole pixels per meter.
+		if math.Abs(md.XDPI-300) > 0.02 || math.Abs(md.YDPI-150) > 0.02 {
+			t.Errorf("%s output with WithDPI(300, 150) has %vx%v DPI", format, md.XDPI, md.YDPI)
+		}
+		// Setting it again replaces the density rather than adding another.
+		again, err := embedDPI(data, format, 600, 600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md, _ := FromBytes(again).Metadata(); math.Abs(md.XDPI-600) > 0.02 {
+			t.Errorf("%s output with its density set twice has %v DPI, want 600", format, md.XDPI)
+		}
+		if n := bytes.Count(again, []byte("pHYs")) + bytes.Count(again, []byte("JFIF\x00")); n != 1 {
+			t.Errorf("%s output with its density set twice stores it %d times, want once", format, n)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(mustBytes(t, proc, FormatPNG, WithDPI(300, 300)))); err != nil {
+		t.Errorf("PNG with WithDPI does not decode: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(mustBytes(t, proc, FormatJPEG, WithDPI(300, 300), WithProgressiveJPEG()))); err != nil {
+		t.Errorf("progressive JPEG with WithDPI does not decode: %v", err)
+	}
+	// JFIF stores whole dots per inch.
+	if md, _ := FromBytes(mustBytes(t, proc, FormatJPEG, WithDPI(150.6, 72))).Metadata(); md.XDPI != 151 {
+		t.Errorf("JPEG output with WithDPI(150.6, 72) has %v DPI, want 151", md.XDPI)
+	}
+	// Formats without a density are written as they are.
+	if _, err := proc.ToBytes(FormatTGA, WithDPI(300, 300)); err != nil {
+		t.Errorf("ToBytes(FormatTGA) with WithDPI should not error, got: %v", err)
+	}
+
+	// Kept EXIF gets the density too, and it wins over JFIF when read.
+	exif := buildEXIF([]exifTestField{
+		exifRationals(exifXResolution, 72, 1),
+		exifRationals(exifYResolution, 72, 1),
+		exifShort(exifResolutionUnit, 3),
+	})
+	data := mustBytes(t, FromBytes(jpegWithEXIF(t, exif)), FormatJPEG, WithKeepMetadata(), WithDPI(300, 240))
+	if md, err := FromBytes(data).Metadata(); err != nil || md.XDPI != 300 || md.YDPI != 240 {
+		t.Errorf("JPEG output with kept EXIF and WithDPI(300, 240) has metadata %+v, %v", md, err)
+	}
+	if got := exifWithResolution([]byte("junk"), 300, 300); string(got) != "junk" {
+		t.Error("exifWithResolution() should leave data that is not EXIF alone")
+	}
+
+	// Test case: Invalid input
+	for _, dpi := range [][2]float64{{-300, 300}, {300, 0}, {math.NaN(), 300}, {math.Inf(1), 300}} {
+		if _, err := proc.ToBytes(FormatPNG, WithDPI(dpi[0], dpi[1])); err == nil {
+			t.Errorf("ToBytes() with WithDPI(%v, %v) should return an error", dpi[0], dpi[1])
+		}
+	}
+	if _, err := proc.ToBytes(FormatJPEG, WithDPI(70000, 300)); err == nil {
+		t.Error("ToBytes(FormatJPEG) with a density JFIF cannot store should return an error")
+	}
+}
@@ -0,0 +1,429 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/vector"
+)
+
+// drawConfig holds the options of the Draw and Fill operations.
+type drawConfig struct {
+	LineWidth float64 // Stroke width in pixels
+	Antialias bool    // Smooth edges with partial coverage
+}
+
+// DrawOption is a functional option for the Draw and Fill operations.
+type DrawOption func(*drawConfig)
+
+func defaultDrawConfig() *drawConfig {
+	return &drawConfig{LineWidth: 1, Antialias: true}
+}
+
+// WithLineWidth sets the width in pixels of lines and outlines (default 1).
+func WithLineWidth(width float64) DrawOption {
+	return func(dc *drawConfig) { dc.LineWidth = width }
+}
+
+// WithAntialiasing controls whether edges are smoothed with partially
+// covered pixels (the default) or drawn hard, e.g. for masks and pixel art.
+func WithAntialiasing(on bool) DrawOption {
+	return func(dc *drawConfig) { dc.Antialias = on }
+}
+
+// vec2 is a point in image pixel space with subpixel precision.
+type vec2 struct {
+	X, Y float64
+}
+
+func (v vec2) add(w vec2) vec2      { return vec2{v.X + w.X, v.Y + w.Y} }
+func (v vec2) sub(w vec2) vec2      { return vec2{v.X - w.X, v.Y - w.Y} }
+func (v vec2) scale(f float64) vec2 { return vec2{v.X * f, v.Y * f} }
+func (v vec2) dot(w vec2) float64   { return v.X*w.X + v.Y*w.Y }
+func (v vec2) length() float64      { return math.Hypot(v.X, v.Y) }
+
+// curveTolerance is the maximum distance in pixels between a curve and the
+// polygon that approximates it.
+const curveTolerance = 0.1
+
+// miterLimit is the longest a mitered join may be, relative to the line
+// width, before it is beveled instead (the SVG default).
+const miterLimit = 4.0
+
+// pixelCenter returns the center of the pixel at p.
+func pixelCenter(p image.Point) vec2 {
+	return vec2{float64(p.X) + 0.5, float64(p.Y) + 0.5}
+}
+
+// rectCorners returns the corners of a rectangle clockwise on screen,
+// starting at the top left.
+func rectCorners(x0, y0, x1, y1 float64) []vec2 {
+	return []vec2{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+// signedArea returns twice the area of contour, positive if it is wound
+// like rectCorners.
+func signedArea(contour []vec2) float64 {
+	var a float64
+	for i, p := range contour {
+		q := contour[(i+1)%len(contour)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a
+}
+
+// wound returns contour wound like rectCorners, reversing it if needed.
+func wound(contour []vec2) []vec2 {
+	if signedArea(contour) < 0 {
+		return reversed(contour)
+	}
+	return contour
+}
+
+// reversed returns the points of a contour in the opposite order, which
+// makes it cut a hole into the contours it overlaps.
+func reversed(contour []vec2) []vec2 {
+	out := make([]vec2, len(contour))
+	for i, p := range contour {
+		out[len(contour)-1-i] = p
+	}
+	return out
+}
+
+// ellipseContour returns a polygon approximating the ellipse with center c
+// and radii rx, ry to within curveTolerance, wound like rectCorners.
+func ellipseContour(c vec2, rx, ry float64) []vec2 {
+	r := max(rx, ry)
+	n := 8
+	if r > curveTolerance {
+		n = max(n, min(1024, int(math.Ceil(math.Pi/math.Acos(1-curveTolerance/r)))))
+	}
+	out := make([]vec2, n)
+	for i := range out {
+		sin, cos := math.Sincos(2 * math.Pi * float64(i) / float64(n))
+		out[i] = vec2{c.X + rx*cos, c.Y + ry*sin}
+	}
+	return out
+}
+
+// strokeContours returns contours covering the polyline through points
+// stroked width pixels wide, with butt ends and mitered joins. If closed is
+// set, the last point is joined back to the first.
+func strokeContours(points []vec2, width float64, closed bool) [][]vec2 {
+	// Repeated points have no direction to stroke or join along.
+	var pts []vec2
+	for _, p := range points {
+		if len(pts) == 0 || p != pts[len(pts)-1] {
+			pts = append(pts, p)
+		}
+	}
+	if closed && len(pts) > 1 && pts[0] == pts[len(pts)-1] {
+		pts = pts[:len(pts)-1]
+	}
+	n := len(pts)
+	if n < 2 {
+		return nil
+	}
+
+	half := width / 2
+	segments := n - 1
+	if closed {
+		segments = n
+	}
+	var out [][]vec2
+	for i := 0; i < segments; i++ {
+		p0, p1 := pts[i], pts[(i+1)%n]
+		d := p1.sub(p0)
+		// Quads are wound like rectCorners whatever their direction.
+		normal := vec2{-d.Y, d.X}.scale(half / d.length())
+		out = append(out, []vec2{p0.sub(normal), p1.sub(normal), p1.add(normal), p0.add(normal)})
+	}
+	for i := range pts {
+		if closed || (i > 0 && i < n-1) {
+			out = append(out, joinContour(pts[(i+n-1)%n], pts[i], pts[(i+1)%n], half))
+		}
+	}
+	return out
+}
+
+// joinContour returns the contour filling the gap on the outside of the
+// corner at p between the strokes from a to p and from p to b, half pixels
+// wide on either side: a miter, or a bevel if the miter would be longer than
+// miterLimit.
+func joinContour(a, p, b vec2, half float64) []vec2 {
+	d0, d1 := p.sub(a), b.sub(p)
+	n0 := vec2{-d0.Y, d0.X}.scale(1 / d0.length())
+	n1 := vec2{-d1.Y, d1.X}.scale(1 / d1.length())
+	if n0.dot(d1) > 0 {
+		// The normals point to the inside of the corner.
+		n0, n1 = n0.scale(-1), n1.scale(-1)
+	}
+	u := n0.add(n1)
+	l2 := u.dot(u)
+	contour := []vec2{p, p.add(n0.scale(half)), p.add(n1.scale(half))}
+	// The miter is 2/|u| times as long as half.
+	if l2 >= 4/(miterLimit*miterLimit) {
+		contour = []vec2{p, p.add(n0.scale(half)), p.add(u.scale(2 * half / l2)), p.add(n1.scale(half))}
+	}
+	return wound(contour)
+}
+
+// fillContours fills the union of contours wound like rectCorners (minus
+// those wound the other way) with c onto dst.
+func fillContours(dst *image.RGBA, contours [][]vec2, c color.Color, antialias bool) {
+	var r image.Rectangle
+	for _, contour := range contours {
+		for _, p := range contour {
+			pr := image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Floor(p.X))+1, int(math.Floor(p.Y))+1)
+			r = r.Union(pr)
+		}
+	}
+	r = r.Intersect(dst.Rect)
+	if r.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(r.Dx(), r.Dy())
+	for _, contour := range contours {
+		if len(contour) < 3 {
+			continue
+		}
+		z.MoveTo(float32(contour[0].X-float64(r.Min.X)), float32(contour[0].Y-float64(r.Min.Y)))
+		for _, p := range contour[1:] {
+			z.LineTo(float32(p.X-float64(r.Min.X)), float32(p.Y-float64(r.Min.Y)))
+		}
+		z.ClosePath()
+	}
+	mask := image.NewAlpha(r)
+	z.Draw(mask, r, image.Opaque, image.Point{})
+	if !antialias {
+		for i, a := range mask.Pix {
+			if a >= 128 {
+				mask.Pix[i] = 255
+			} else {
+				mask.Pix[i] = 0
+			}
+		}
+	}
+	draw.DrawMask(dst, r, image.NewUniform(c), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// translated moves contours by p in place and returns them.
+func translated(contours [][]vec2, p image.Point) [][]vec2 {
+	d := vec2{float64(p.X), float64(p.Y)}
+	for _, contour := range contours {
+		for i := range contour {
+			contour[i] = contour[i].add(d)
+		}
+	}
+	return contours
+}
+
+// rectOutline returns the contours of a width pixels wide outline of r
+// centered on its border pixels.
+func rectOutline(r image.Rectangle, width float64) [][]vec2 {
+	r = r.Canon()
+	if r.Empty() {
+		return nil
+	}
+	half := width / 2
+	x0, y0 := float64(r.Min.X)+0.5, float64(r.Min.Y)+0.5
+	x1, y1 := float64(r.Max.X)-0.5, float64(r.Max.Y)-0.5
+	contours := [][]vec2{rectCorners(x0-half, y0-half, x1+half, y1+half)}
+	if x1-x0 > 2*half && y1-y0 > 2*half {
+		contours = append(contours, reversed(rectCorners(x0+half, y0+half, x1-half, y1-half)))
+	}
+	return contours
+}
+
+// ellipseOutline returns the contours of a width pixels wide outline of the
+// ellipse inscribed in r, centered on its outermost pixels.
+func ellipseOutline(r image.Rectangle, width float64) [][]vec2 {
+	r = r.Canon()
+	if r.Empty() {
+		return nil
+	}
+	half := width / 2
+	center := vec2{float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2}
+	rx, ry := float64(r.Dx()-1)/2, float64(r.Dy()-1)/2
+	contours := [][]vec2{ellipseContour(center, rx+half, ry+half)}
+	if rx > half && ry > half {
+		contours = append(contours, reversed(ellipseContour(center, rx-half, ry-half)))
+	}
+	return contours
+}
+
+// drawShape draws the contours returned by shape for the options in opts
+// with color c over the image and records the operation under name. Shape
+// coordinates are relative to the image's top-left corner.
+func (ip *ImageProcessor) drawShape(name string, c color.Color, opts []DrawOption, shape func(cfg *drawConfig) ([][]vec2, error)) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if c == nil {
+		ip.err = fmt.Errorf("%s color cannot be nil", name)
+		return ip
+	}
+	cfg := defaultDrawConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.LineWidth <= 0 || math.IsNaN(cfg.LineWidth) || math.IsInf(cfg.LineWidth, 0) {
+		ip.err = fmt.Errorf("%s line width must be positive (got: %g)", name, cfg.LineWidth)
+		return ip
+	}
+
+	contours, err := shape(cfg)
+	if err != nil {
+		ip.err = fmt.Errorf("%s: %w", name, err)
+		return ip
+	}
+
+	bounds := ip.currentImage.Bounds()
+	dst := newRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	fillContours(dst, translated(contours, bounds.Min), c, cfg.Antialias)
+
+	ip.currentImage = dst
+	ip.record(name)
+	return ip
+}
+
+// DrawLine draws a straight line from one pixel to another in color c. The
+// line runs through the pixel centers, so a 1 pixel wide horizontal or
+// vertical line covers exactly one row or column of pixels. Use
+// WithLineWidth and WithAntialiasing to change its width and edges.
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// the line width is not positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawLine(from, to image.Point, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawLine", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		return strokeContours([]vec2{pixelCenter(from), pixelCenter(to)}, cfg.LineWidth, false), nil
+	})
+}
+
+// DrawRect draws the outline of r in color c along its border pixels, so a
+// 1 pixel wide outline stays inside r; wider outlines grow both ways.
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// the line width is not positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawRect(r image.Rectangle, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawRect", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		return rectOutline(r, cfg.LineWidth), nil
+	})
+}
+
+// FillRect fills the pixels of r with color c, blending it over the image
+// if c is translucent.
+// Returns the ImageProcessor for chaining. An error is set if c is nil.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) FillRect(r image.Rectangle, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("FillRect", c, opts, func(*drawConfig) ([][]vec2, error) {
+		r = r.Canon()
+		return [][]vec2{rectCorners(float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y))}, nil
+	})
+}
+
+// DrawEllipse draws the outline of the ellipse inscribed in r in color c
+// through the centers of its outermost pixels, like DrawRect.
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// the line width is not positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawEllipse(r image.Rectangle, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawEllipse", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		return ellipseOutline(r, cfg.LineWidth), nil
+	})
+}
+
+// FillEllipse fills the ellipse inscribed in r with color c.
+// Returns the ImageProcessor for chaining. An error is set if c is nil.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) FillEllipse(r image.Rectangle, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("FillEllipse", c, opts, func(*drawConfig) ([][]vec2, error) {
+		r = r.Canon()
+		center := vec2{float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2}
+		return [][]vec2{ellipseContour(center, float64(r.Dx())/2, float64(r.Dy())/2)}, nil
+	})
+}
+
+// DrawPolygon draws the closed outline through the given pixels in color c,
+// with mitered corners, like DrawRect.
+// Returns the ImageProcessor for chaining. An error is set if c is nil, the
+// line width is not positive or there are fewer than 3 points.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawPolygon(points []image.Point, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawPolygon", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		if len(points) < 3 {
+			return nil, fmt.Errorf("polygon needs at least 3 points (got: %d)", len(points))
+		}
+		pts := make([]vec2, len(points))
+		for i, p := range points {
+			pts[i] = pixelCenter(p)
+		}
+		return strokeContours(pts, cfg.LineWidth, true), nil
+	})
+}
+
+// FillPolygon fills the polygon with the given corners with color c. Like
+// FillRect and CropToPath, the corners are pixel edge coordinates, so the
+// polygon (0,0) (4,0) (4,4) (0,4) covers exactly 4×4 pixels. Overlapping
+// parts are filled once.
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// there are fewer than 3 points.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) FillPolygon(points []image.Point, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("FillPolygon", c, opts, func(*drawConfig) ([][]vec2, error) {
+		if len(points) < 3 {
+			return nil, fmt.Errorf("polygon needs at least 3 points (got: %d)", len(points))
+		}
+		pts := make([]vec2, len(points))
+		for i, p := range points {
+			pts[i] = vec2{float64(p.X), float64(p.Y)}
+		}
+		return [][]vec2{pts}, nil
+	})
+}
+
+// DrawPath draws path, e.g. an arrow or a callout outline, as a line
+// through the pixels it passes in color c. Bézier curves are drawn smooth;
+// only sub-paths ending in ClosePath are closed.
+// Returns the ImageProcessor for chaining. An error is set if c is nil, the
+// line width is not positive or the path is malformed.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawPath(path []PathSegment, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawPath", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		if err := validatePath(path); err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+		var contours [][]vec2
+		for _, sp := range flattenPath(path, vec2{0.5, 0.5}) {
+			contours = append(contours, strokeContours(sp.points, cfg.LineWidth, sp.closed)...)
+		}
+		return contours, nil
+	})
+}
+
+// FillPath fills the area enclosed by path with color c using the non-zero
+// winding rule, closing every sub-path. Coordinates are pixel edges, as in
+// CropToPath, and a sub-path wound against the others cuts a hole.
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// the path is malformed.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) FillPath(path []PathSegment, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("FillPath", c, opts, func(*drawConfig) ([][]vec2, error) {
+		if err := validatePath(path); err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+		var contours [][]vec2
+		for _, sp := range flattenPath(path, vec2{}) {
+			contours = append(contours, sp.points)
+		}
+		return contours, nil
+	})
+}
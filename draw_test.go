@@ -0,0 +1,296 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDrawLine(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	red := color.RGBA{255, 0, 0, 255}
+
+	img := mustImage(t, New(createUniformImage(20, 10, white)).DrawLine(image.Pt(2, 5), image.Pt(17, 5), red)).(*image.RGBA)
+	if got := img.RGBAAt(10, 5); got != red {
+		t.Errorf("DrawLine() pixel on the line = %v, want %v", got, red)
+	}
+	for _, y := range []int{4, 6} {
+		if got := img.RGBAAt(10, y); got != white {
+			t.Errorf("DrawLine() 1px line should not touch row %d, got %v", y, got)
+		}
+	}
+	if got := img.RGBAAt(1, 5); got != white {
+		t.Errorf("DrawLine() should not extend past its end points, got %v", got)
+	}
+
+	wide := mustImage(t, New(createUniformImage(20, 10, white)).DrawLine(image.Pt(2, 5), image.Pt(17, 5), red, WithLineWidth(3))).(*image.RGBA)
+	for _, y := range []int{4, 5, 6} {
+		if got := wide.RGBAAt(10, y); got != red {
+			t.Errorf("DrawLine() 3px line should cover row %d, got %v", y, got)
+		}
+	}
+
+	hard := mustImage(t, New(createUniformImage(20, 20, white)).DrawLine(image.Pt(1, 2), image.Pt(18, 15), red, WithLineWidth(2), WithAntialiasing(false))).(*image.RGBA)
+	for i := 0; i < len(hard.Pix); i += 4 {
+		if g := hard.Pix[i+1]; g != 0 && g != 255 {
+			t.Fatalf("DrawLine() without antialiasing produced blended pixel %v", hard.Pix[i:i+4])
+		}
+	}
+	soft := mustImage(t, New(createUniformImage(20, 20, white)).DrawLine(image.Pt(1, 2), image.Pt(18, 15), red, WithLineWidth(2))).(*image.RGBA)
+	partial := false
+	for i := 0; i < len(soft.Pix); i += 4 {
+		if g := soft.Pix[i+1]; g != 0 && g != 255 {
+			partial = true
+		}
+	}
+	if !partial {
+		t.Error("DrawLine() with antialiasing should blend the edges of a diagonal line")
+	}
+}
+
+func TestDrawRect(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	r := image.Rect(5, 5, 25, 15)
+
+	img := mustImage(t, New(createUniformImage(30, 20, white)).DrawRect(r, blue)).(*image.RGBA)
+	for _, p := range []image.Point{{5, 5}, {24, 14}, {15, 5}, {5, 10}} {
+		if got := img.RGBAAt(p.X, p.Y); got != blue {
+			t.Errorf("DrawRect() border pixel %v = %v, want %v", p, got, blue)
+		}
+	}
+	for _, p := range []image.Point{{4, 5}, {25, 14}, {15, 10}, {6, 6}} {
+		if got := img.RGBAAt(p.X, p.Y); got != white {
+			t.Errorf("DrawRect() pixel %v off the border = %v, want untouched", p, got)
+		}
+	}
+
+	wide := mustImage(t, New(createUniformImage(30, 20, white)).DrawRect(r, blue, WithLineWidth(3))).(*image.RGBA)
+	for _, p := range []image.Point{{4, 10}, {5, 10}, {6, 10}} {
+		if got := wide.RGBAAt(p.X, p.Y); got != blue {
+			t.Errorf("DrawRect() 3px border pixel %v = %v, want %v", p, got, blue)
+		}
+	}
+	if got := wide.RGBAAt(7, 10); got != white {
+		t.Errorf("DrawRect() 3px border should end at x=6, got %v at x=7", got)
+	}
+}
+
+func TestFillRect(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	r := image.Rect(2, 3, 8, 9)
+
+	img := mustImage(t, New(createUniformImage(10, 12, white)).FillRect(r, color.RGBA{0, 0, 0, 255})).(*image.RGBA)
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 10; x++ {
+			want := white
+			if image.Pt(x, y).In(r) {
+				want = color.RGBA{0, 0, 0, 255}
+			}
+			if got := img.RGBAAt(x, y); got != want {
+				t.Fatalf("FillRect() pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	// Half-transparent black over white blends to mid gray.
+	blended := mustImage(t, New(createUniformImage(10, 12, white)).FillRect(r, color.NRGBA{0, 0, 0, 128})).(*image.RGBA)
+	if got := blended.RGBAAt(5, 5); abs(int(got.R)-127) > 2 || got.A != 255 {
+		t.Errorf("FillRect() with a translucent color = %v, want gray blended over white", got)
+	}
+}
+
+func TestFillEllipse(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	r := image.Rect(10, 10, 50, 30)
+
+	img := mustImage(t, New(createUniformImage(60, 40, color.RGBA{255, 255, 255, 255})).FillEllipse(r, black)).(*image.RGBA)
+	if got := img.RGBAAt(30, 20); got != black {
+		t.Errorf("FillEllipse() center = %v, want %v", got, black)
+	}
+	if got := img.RGBAAt(10, 10); got.R < 250 {
+		t.Errorf("FillEllipse() should leave the corners of r untouched, got %v", got)
+	}
+
+	var area float64
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			area += 1 - float64(img.RGBAAt(x, y).R)/255
+		}
+	}
+	want := math.Pi / 4 * float64(r.Dx()*r.Dy())
+	if math.Abs(area-want) > want*0.01 {
+		t.Errorf("FillEllipse() area = %.1f, want about %.1f", area, want)
+	}
+}
+
+func TestDrawEllipse(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	r := image.Rect(0, 0, 41, 21)
+
+	img := mustImage(t, New(createUniformImage(41, 21, white)).DrawEllipse(r, green, WithLineWidth(2))).(*image.RGBA)
+	if got := img.RGBAAt(20, 10); got != white {
+		t.Errorf("DrawEllipse() should leave the center untouched, got %v", got)
+	}
+	for _, p := range []image.Point{{20, 0}, {20, 20}, {0, 10}, {40, 10}} {
+		if got := img.RGBAAt(p.X, p.Y); got.R > 128 {
+			t.Errorf("DrawEllipse() outline pixel %v = %v, want mostly green", p, got)
+		}
+	}
+}
+
+func TestDrawPolygon(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	// An axis-aligned polygon through the corner pixels matches DrawRect.
+	corners := []image.Point{{5, 5}, {24, 5}, {24, 14}, {5, 14}}
+	for _, width := range []float64{1, 3} {
+		poly := mustImage(t, New(createUniformImage(30, 20, white)).DrawPolygon(corners, blue, WithLineWidth(width))).(*image.RGBA)
+		rect := mustImage(t, New(createUniformImage(30, 20, white)).DrawRect(image.Rect(5, 5, 25, 15), blue, WithLineWidth(width))).(*image.RGBA)
+		for i := range poly.Pix {
+			if abs(int(poly.Pix[i])-int(rect.Pix[i])) > 1 {
+				t.Fatalf("DrawPolygon(width=%g) differs from DrawRect at byte %d: %d vs %d", width, i, poly.Pix[i], rect.Pix[i])
+			}
+		}
+	}
+
+	// A sharp spike is beveled instead of mitered far past its tip.
+	spike := mustImage(t, New(createUniformImage(40, 20, white)).DrawPolygon([]image.Point{{2, 8}, {30, 10}, {2, 12}}, blue, WithLineWidth(4))).(*image.RGBA)
+	if got := spike.RGBAAt(30, 10); got == white {
+		t.Error("DrawPolygon() should draw the spike's tip")
+	}
+	if got := spike.RGBAAt(36, 10); got != white {
+		t.Errorf("DrawPolygon() should bevel a sharp corner, got %v far past the tip", got)
+	}
+}
+
+func TestFillPolygon(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	square := mustImage(t, New(createUniformImage(10, 10, white)).FillPolygon([]image.Point{{2, 2}, {6, 2}, {6, 6}, {2, 6}}, black)).(*image.RGBA)
+	same := mustImage(t, New(createUniformImage(10, 10, white)).FillRect(image.Rect(2, 2, 6, 6), black)).(*image.RGBA)
+	for i := range square.Pix {
+		if square.Pix[i] != same.Pix[i] {
+			t.Fatalf("FillPolygon() of a square should match FillRect(), differs at byte %d", i)
+		}
+	}
+
+	triangle := []image.Point{{0, 0}, {20, 0}, {0, 20}}
+	img := mustImage(t, New(createUniformImage(20, 20, white)).FillPolygon(triangle, black, WithAntialiasing(false))).(*image.RGBA)
+	if got := img.RGBAAt(3, 3); got != black {
+		t.Errorf("FillPolygon() inside pixel = %v, want %v", got, black)
+	}
+	if got := img.RGBAAt(15, 15); got != white {
+		t.Errorf("FillPolygon() outside pixel = %v, want untouched", got)
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		if v := img.Pix[i]; v != 0 && v != 255 {
+			t.Fatalf("FillPolygon() without antialiasing produced blended pixel %v", img.Pix[i:i+4])
+		}
+	}
+}
+
+func TestFlattenPath(t *testing.T) {
+	path := []PathSegment{
+		MoveTo(0, 0), LineTo(10, 0), QuadTo(20, 0, 20, 10), ClosePath(),
+		LineTo(0, 20),
+		MoveTo(30, 30), CubeTo(40, 20, 50, 40, 60, 30),
+	}
+	subs := flattenPath(path, vec2{0.5, 0.5})
+	if len(subs) != 3 {
+		t.Fatalf("flattenPath() returned %d sub-paths, want 3", len(subs))
+	}
+	if !subs[0].closed || subs[1].closed || subs[2].closed {
+		t.Errorf("flattenPath() closed flags = %v %v %v, want only the first closed", subs[0].closed, subs[1].closed, subs[2].closed)
+	}
+	if got := subs[1].points[0]; got != (vec2{0.5, 0.5}) {
+		t.Errorf("flattenPath() segment after ClosePath should start at the sub-path start, got %v", got)
+	}
+	if got := subs[0].points[len(subs[0].points)-1]; got != (vec2{20.5, 10.5}) {
+		t.Errorf("flattenPath() curve should end at its end point, got %v", got)
+	}
+	if len(subs[0].points) < 5 || len(subs[2].points) < 5 {
+		t.Errorf("flattenPath() should split curves into several chords, got %d and %d points", len(subs[0].points), len(subs[2].points))
+	}
+}
+
+func TestDrawPath(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	red := color.RGBA{255, 0, 0, 255}
+
+	// An arc from (5,30) over the top to (35,30) peaks at y=17.5.
+	arc := []PathSegment{MoveTo(5, 30), QuadTo(20, 5, 35, 30)}
+	img := mustImage(t, New(createUniformImage(40, 40, white)).DrawPath(arc, red, WithLineWidth(2))).(*image.RGBA)
+	if got := img.RGBAAt(20, 17); got.G > 128 {
+		t.Errorf("DrawPath() should draw the top of the curve, got %v", got)
+	}
+	if got := img.RGBAAt(20, 5); got != white {
+		t.Errorf("DrawPath() should not draw the control point, got %v", got)
+	}
+	if got := img.RGBAAt(20, 30); got != white {
+		t.Errorf("DrawPath() should not close an open path, got %v", got)
+	}
+
+	closed := append(arc, ClosePath())
+	img = mustImage(t, New(createUniformImage(40, 40, white)).DrawPath(closed, red, WithLineWidth(2))).(*image.RGBA)
+	if got := img.RGBAAt(20, 30); got.G > 128 {
+		t.Errorf("DrawPath() should close a path ending in ClosePath, got %v", got)
+	}
+}
+
+func TestFillPath(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	// A square with a square hole wound the other way.
+	ring := []PathSegment{
+		MoveTo(0, 0), LineTo(20, 0), LineTo(20, 20), LineTo(0, 20), ClosePath(),
+		MoveTo(5, 5), LineTo(5, 15), LineTo(15, 15), LineTo(15, 5), ClosePath(),
+	}
+	img := mustImage(t, New(createUniformImage(20, 20, white)).FillPath(ring, black)).(*image.RGBA)
+	if got := img.RGBAAt(2, 2); got != black {
+		t.Errorf("FillPath() pixel in the ring = %v, want %v", got, black)
+	}
+	if got := img.RGBAAt(10, 10); got != white {
+		t.Errorf("FillPath() should leave the hole untouched, got %v", got)
+	}
+
+	// An unclosed sub-path is filled as if closed.
+	open := []PathSegment{MoveTo(0, 0), LineTo(20, 0), LineTo(0, 20)}
+	img = mustImage(t, New(createUniformImage(20, 20, white)).FillPath(open, black)).(*image.RGBA)
+	if got := img.RGBAAt(3, 3); got != black {
+		t.Errorf("FillPath() should close open sub-paths, got %v", got)
+	}
+}
+
+func TestDrawInvalidInput(t *testing.T) {
+	img := createTestImage(10, 10)
+
+	// Test case: Invalid input
+	cases := map[string]*ImageProcessor{
+		"nil color":      New(img).DrawLine(image.Pt(0, 0), image.Pt(5, 5), nil),
+		"nil fill color": New(img).FillRect(img.Bounds(), nil),
+		"zero width":     New(img).DrawRect(img.Bounds(), color.Black, WithLineWidth(0)),
+		"negative width": New(img).DrawEllipse(img.Bounds(), color.Black, WithLineWidth(-1)),
+		"NaN width":      New(img).DrawLine(image.Pt(0, 0), image.Pt(5, 5), color.Black, WithLineWidth(math.NaN())),
+		"two points":     New(img).DrawPolygon([]image.Point{{0, 0}, {5, 5}}, color.Black),
+		"no fill points": New(img).FillPolygon(nil, color.Black),
+		"empty path":     New(img).DrawPath(nil, color.Black),
+		"no move":        New(img).FillPath([]PathSegment{LineTo(5, 5)}, color.Black),
+	}
+	for name, proc := range cases {
+		if proc.Err() == nil {
+			t.Errorf("Draw with %s should return an error", name)
+		}
+	}
+
+	// A previous error is kept.
+	proc := New(img).DrawLine(image.Pt(0, 0), image.Pt(5, 5), nil).FillRect(img.Bounds(), color.Black)
+	if proc.Err() == nil {
+		t.Error("FillRect() should keep the previous error")
+	}
+}
@@ -0,0 +1,109 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createSquareImage returns a black image with a white square.
+func createSquareImage(size int, square image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := color.RGBA{0, 0, 0, 255}
+			if image.Pt(x, y).In(square) {
+				c = color.RGBA{255, 255, 255, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestSobelPrewitt(t *testing.T) {
+	originalImg := createSquareImage(40, image.Rect(10, 10, 30, 30))
+
+	for name, op := range map[string]func(*ImageProcessor) *ImageProcessor{
+		"Sobel":   (*ImageProcessor).Sobel,
+		"Prewitt": (*ImageProcessor).Prewitt,
+	} {
+		proc := op(New(originalImg))
+		if proc.Err() != nil {
+			t.Fatalf("%s() should not error, got: %v", name, proc.Err())
+		}
+		img, _ := proc.Image()
+		if img.Bounds() != originalImg.Bounds() {
+			t.Errorf("%s() changed bounds to %v", name, img.Bounds())
+		}
+
+		gray := func(x, y int) uint8 { return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y }
+		if v := gray(5, 5); v != 0 {
+			t.Errorf("%s() flat area = %d, want 0", name, v)
+		}
+		if v := gray(20, 20); v != 0 {
+			t.Errorf("%s() flat area inside the square = %d, want 0", name, v)
+		}
+		if v := gray(10, 20); v < 100 {
+			t.Errorf("%s() edge = %d, want a strong response", name, v)
+		}
+		if _, _, _, a := img.At(5, 5).RGBA(); a != 0xffff {
+			t.Errorf("%s() output should be opaque", name)
+		}
+
+		if op(New(nil)).Err() == nil {
+			t.Fatalf("%s() on a processor with prior error should propagate that error", name)
+		}
+	}
+}
+
+func TestCanny(t *testing.T) {
+	originalImg := createSquareImage(40, image.Rect(10, 10, 30, 30))
+
+	proc := New(originalImg).Canny(20, 60)
+	if proc.Err() != nil {
+		t.Fatalf("Canny() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+
+	edge := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0xffff
+	}
+	// Along the left side of the square exactly one pixel per row is an edge.
+	for y := 14; y < 26; y++ {
+		n := 0
+		for x := 5; x < 15; x++ {
+			if edge(x, y) {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("Canny() row %d has %d edge pixels near the left side, want 1", y, n)
+		}
+	}
+	if edge(20, 20) || edge(2, 2) {
+		t.Error("Canny() should not mark flat areas as edges")
+	}
+
+	// A high threshold above every gradient leaves no edges.
+	img, _ = New(originalImg).Canny(300, 400).Image()
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r != 0 {
+				t.Fatalf("Canny() with thresholds above all gradients found an edge at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	// Invalid input
+	if New(originalImg).Canny(50, 10).Err() == nil {
+		t.Error("Canny() with low > high should return an error")
+	}
+	if New(originalImg).Canny(-1, 10).Err() == nil {
+		t.Error("Canny() with a negative threshold should return an error")
+	}
+	if New(nil).Canny(10, 50).Err() == nil {
+		t.Fatal("Canny() on a processor with prior error should propagate that error")
+	}
+}
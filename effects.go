@@ -0,0 +1,473 @@
+package gopiq
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/errgroup"
+)
+
+// Solarize inverts every color channel whose value is above threshold, leaving
+// darker values untouched. This mimics the Sabattier effect of partially
+// re-exposed film. Alpha is preserved.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Solarize(threshold uint8) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+
+	solarize := func(v uint8) uint8 {
+		if v > threshold {
+			return 255 - v
+		}
+		return v
+	}
+
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		return solarize(r), solarize(g), solarize(b)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("Solarize")
+	return ip
+}
+
+// Duotone maps the luminance of every pixel onto a two-color ramp running from
+// shadow (black) to highlight (white), the classic two-ink print treatment.
+// Alpha is preserved.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Duotone(shadow, highlight color.Color) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if shadow == nil || highlight == nil {
+		ip.err = fmt.Errorf("duotone colors cannot be nil")
+		return ip
+	}
+
+	sr, sg, sb := straightRGB(shadow)
+	hr, hg, hb := straightRGB(highlight)
+
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		t := luminance(r, g, b) / 255
+		return clampUint8(sr + (hr-sr)*t), clampUint8(sg + (hg-sg)*t), clampUint8(sb + (hb-sb)*t)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("Duotone")
+	return ip
+}
+
+// Colorize tints the image with c while keeping its lightness: shadows stay
+// dark, highlights stay bright and the midtones take on c. Strength in [0, 1]
+// blends between the original (0) and the fully tinted image (1).
+// Returns the ImageProcessor for chaining. An error is set if c is nil or
+// strength is out of range.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Colorize(c color.Color, strength float64) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if c == nil {
+		ip.err = fmt.Errorf("colorize color cannot be nil")
+		return ip
+	}
+	if strength < 0 || strength > 1 {
+		ip.err = fmt.Errorf("colorize strength must be between 0 and 1 (got: %g)", strength)
+		return ip
+	}
+
+	cr, cg, cb := straightRGB(c)
+	tint := func(l, cv float64) float64 {
+		// Black -> c over the lower half of the range, c -> white over the upper half.
+		if l < 128 {
+			return cv * l / 128
+		}
+		return cv + (255-cv)*(l-128)/127
+	}
+
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		l := luminance(r, g, b)
+		tr, tg, tb := tint(l, cr), tint(l, cg), tint(l, cb)
+		return clampUint8(float64(r) + (tr-float64(r))*strength),
+			clampUint8(float64(g) + (tg-float64(g))*strength),
+			clampUint8(float64(b) + (tb-float64(b))*strength)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("Colorize")
+	return ip
+}
+
+// splitToneAmount scales how far SplitTone pushes colors towards the tints.
+const splitToneAmount = 0.35
+
+// SplitTone tints shadows and highlights with different colors, e.g. teal
+// shadows with orange highlights, a staple of film looks. Only the hue of the
+// tints is applied, so luminance is roughly preserved; less saturated tints
+// give subtler results. balance in [-1, 1] moves the crossover point: positive
+// values extend the highlight tint into the midtones, negative values the
+// shadow tint. Alpha is preserved.
+// Returns the ImageProcessor for chaining. An error is set if a tint is nil or
+// balance is out of range.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) SplitTone(shadowTint, highlightTint color.Color, balance float64) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if shadowTint == nil || highlightTint == nil {
+		ip.err = fmt.Errorf("split tone tints cannot be nil")
+		return ip
+	}
+	if balance < -1 || balance > 1 {
+		ip.err = fmt.Errorf("split tone balance must be between -1 and 1 (got: %g)", balance)
+		return ip
+	}
+
+	// Chroma offsets of the tints: their color minus their own luminance.
+	offsets := func(c color.Color) [3]float64 {
+		r, g, b := straightRGB(c)
+		l := 0.2126*r + 0.7152*g + 0.0722*b
+		return [3]float64{r - l, g - l, b - l}
+	}
+	shadow, highlight := offsets(shadowTint), offsets(highlightTint)
+	pivot := min(max(0.5-balance/2, 0.05), 0.95)
+
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		t := luminance(r, g, b) / 255
+		ws := (1 - smoothstep(0, pivot, t)) * splitToneAmount
+		wh := smoothstep(pivot, 1, t) * splitToneAmount
+		return clampUint8(float64(r) + shadow[0]*ws + highlight[0]*wh),
+			clampUint8(float64(g) + shadow[1]*ws + highlight[1]*wh),
+			clampUint8(float64(b) + shadow[2]*ws + highlight[2]*wh)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("SplitTone")
+	return ip
+}
+
+// smoothstep returns 0 below edge0, 1 above edge1 and a smooth Hermite
+// interpolation in between.
+func smoothstep(edge0, edge1, x float64) float64 {
+	t := min(max((x-edge0)/(edge1-edge0), 0), 1)
+	return t * t * (3 - 2*t)
+}
+
+// Low-light enhancement tuning.
+const (
+	lowLightMaxGain      = 4.0 // Cap on brightening so noise is not amplified without bound
+	lowLightContrast     = 0.4 // Local contrast amount at full strength
+	lowLightMinBlurSigma = 2.0
+	lowLightMaxBlurSigma = 16.0
+)
+
+// EnhanceLowLight brightens dark phone photos in one step: noise is first
+// reduced with an edge-preserving filter, then shadows are lifted with a
+// gamma curve on luminance (keeping hues) and local contrast is boosted to
+// recover detail flattened by the lift. strength in [0, 1] scales all three;
+// 0 leaves the image unchanged. Alpha is preserved.
+// Returns the ImageProcessor for chaining. An error is set if strength is out
+// of range.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) EnhanceLowLight(strength float64) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if strength < 0 || strength > 1 {
+		ip.err = fmt.Errorf("low-light strength must be between 0 and 1 (got: %g)", strength)
+		return ip
+	}
+	if strength == 0 {
+		return ip
+	}
+
+	src, err := ip.bilateral(asRGBA(ip.currentImage), 1+strength, 10+20*strength)
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	luma := lumaPlane(src)
+	sigma := min(max(float64(min(width, height))/50, lowLightMinBlurSigma), lowLightMaxBlurSigma)
+	blurred := gaussianSmooth(luma, width, height, sigma)
+	gamma := 1 / (1 + 1.5*strength)
+	amount := lowLightContrast * strength
+
+	dst := newRGBA(src.Rect)
+	if err := ip.processRowsErr(width, height, func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			for x := 0; x < width; x++ {
+				l := luma[y*width+x]
+				detail := min(max(l+amount*(l-blurred[y*width+x]), 0), 255)
+				gain := min(255*math.Pow(detail/255, gamma)/max(l, 1), lowLightMaxGain)
+				i := y*src.Stride + x*4
+				a := src.Pix[i+3]
+				di := y*dst.Stride + x*4
+				for c := 0; c < 3; c++ {
+					// Premultiplied color may not exceed alpha.
+					dst.Pix[di+c] = min(clampUint8(float64(src.Pix[i+c])*gain), a)
+				}
+				dst.Pix[di+3] = a
+			}
+		}
+		return nil
+	}); err != nil {
+		ip.err = err
+		return ip
+	}
+
+	ip.currentImage = dst
+	ip.record("EnhanceLowLight")
+	return ip
+}
+
+// mapColors applies fn to the straight (non-premultiplied) RGB values of every
+// pixel of the current image and returns the result as a new RGBA image with
+// the original alpha preserved. Large images are processed in parallel
+// according to the processor's PerformanceOptions.
+// It returns the error of a failing strip. The caller must hold the write lock.
+func (ip *ImageProcessor) mapColors(fn func(r, g, b uint8) (uint8, uint8, uint8)) (*image.RGBA, error) {
+	src := asRGBA(ip.currentImage)
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	width := bounds.Dx()
+
+	if err := ip.processRowsErr(bounds.Dx(), bounds.Dy(), func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			srcRow := src.Pix[y*src.Stride : y*src.Stride+width*4]
+			dstRow := dst.Pix[y*dst.Stride : y*dst.Stride+width*4]
+			for i := 0; i < len(srcRow); i += 4 {
+				a := srcRow[i+3]
+				if a == 0 {
+					continue
+				}
+				r, g, b := unpremultiply(srcRow[i], a), unpremultiply(srcRow[i+1], a), unpremultiply(srcRow[i+2], a)
+				r, g, b = fn(r, g, b)
+				dstRow[i] = premultiply(r, a)
+				dstRow[i+1] = premultiply(g, a)
+				dstRow[i+2] = premultiply(b, a)
+				dstRow[i+3] = a
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// stripsPerGoroutine is how many strips processRowsErr creates per worker.
+// Smaller strips let a failing strip cancel more of the remaining work.
+const stripsPerGoroutine = 4
+
+// processRowsErr splits rows [0, height) into horizontal strips and calls fn
+// for each strip. Strips run in parallel when parallel processing is enabled
+// and width*height reaches MinSizeForParallel; otherwise fn is called once
+// for the whole image. The strips run in an errgroup limited to
+// MaxGoroutines workers: the first error (a panic is turned into one, also
+// when fn runs in the calling goroutine) cancels the strips that have not
+// started and is returned once the running strips have finished. The
+// destination is then only partially written, so operations must discard
+// it, set the error and leave the current image unchanged.
+func (ip *ImageProcessor) processRowsErr(width, height int, fn func(startRow, endRow int) error) error {
+	if !ip.perfOpts.EnableParallelProcessing || width*height < ip.perfOpts.MinSizeForParallel || height < 2 {
+		return runStrip(fn, 0, height)
+	}
+
+	numGoroutines := ip.perfOpts.MaxGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = runtime.NumCPU()
+	}
+	numGoroutines = min(numGoroutines, height)
+	numStrips := min(numGoroutines*stripsPerGoroutine, height)
+	rowsPerStrip := height / numStrips
+	ip.mu.noteParallelism(numGoroutines)
+
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(numGoroutines)
+	for i := 0; i < numStrips && ctx.Err() == nil; i++ {
+		startRow := i * rowsPerStrip
+		endRow := startRow + rowsPerStrip
+		// Last strip handles remaining rows
+		if i == numStrips-1 {
+			endRow = height
+		}
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil // Another strip failed.
+			}
+			return runStrip(fn, startRow, endRow)
+		})
+	}
+	return g.Wait()
+}
+
+// runStrip calls fn for one strip, turning a panic into an error.
+func runStrip(fn func(startRow, endRow int) error, startRow, endRow int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic processing rows %d-%d: %v", startRow, endRow, r)
+		}
+	}()
+	return fn(startRow, endRow)
+}
+
+// asRGBA returns img as an *image.RGBA whose bounds start at the origin,
+// copying it only when necessary.
+func asRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// unpremultiply converts an alpha-premultiplied channel value to straight alpha.
+func unpremultiply(v, a uint8) uint8 {
+	switch a {
+	case 255:
+		return v
+	case 0:
+		return 0
+	}
+	return uint8(min((uint32(v)*255+uint32(a)/2)/uint32(a), 255))
+}
+
+// premultiply converts a straight-alpha channel value to premultiplied alpha.
+func premultiply(v, a uint8) uint8 {
+	if a == 255 {
+		return v
+	}
+	return uint8((uint32(v)*uint32(a) + 127) / 255)
+}
+
+// luminance returns the ITU-R BT.709 luma of an RGB triple in [0, 255].
+func luminance(r, g, b uint8) float64 {
+	return 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)
+}
+
+// straightRGB returns the non-premultiplied RGB components of c in [0, 255].
+func straightRGB(c color.Color) (r, g, b float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return float64(n.R), float64(n.G), float64(n.B)
+}
+
+// clampUint8 rounds v to the nearest integer and clamps it to [0, 255].
+func clampUint8(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// Pixelate divides the image into blockSize x blockSize blocks and fills each
+// with its average color, the classic mosaic look that also serves as coarse
+// anonymization. Edge blocks may be smaller. Block rows are processed in
+// parallel according to the processor's PerformanceOptions.
+// Returns the ImageProcessor for chaining. An error is set if blockSize is not
+// positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Pixelate(blockSize int) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if blockSize <= 0 {
+		ip.err = fmt.Errorf("pixelate block size must be positive (got: %d)", blockSize)
+		return ip
+	}
+
+	src := asRGBA(ip.currentImage)
+	dst := newRGBA(src.Rect)
+	// Copied row by row: src may be a view with a wider stride.
+	draw.Draw(dst, dst.Rect, src, image.Point{}, draw.Src)
+	if err := ip.pixelateRect(dst, dst.Rect, blockSize); err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("Pixelate")
+	return ip
+}
+
+// pixelateRect pixelates r of img in place with blocks aligned to r.Min,
+// returning the error of a failing strip.
+func (ip *ImageProcessor) pixelateRect(img *image.RGBA, r image.Rectangle, blockSize int) error {
+	r = r.Intersect(img.Rect)
+	blockRows := (r.Dy() + blockSize - 1) / blockSize
+	// Work is split by block rows; the pixel count still drives whether to
+	// parallelize at all.
+	return ip.processRowsErr(r.Dx()*blockSize, blockRows, func(startRow, endRow int) error {
+		for row := startRow; row < endRow; row++ {
+			y0 := r.Min.Y + row*blockSize
+			y1 := min(y0+blockSize, r.Max.Y)
+			for x0 := r.Min.X; x0 < r.Max.X; x0 += blockSize {
+				x1 := min(x0+blockSize, r.Max.X)
+				var sum [4]int
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						i := img.PixOffset(x, y)
+						for c := 0; c < 4; c++ {
+							sum[c] += int(img.Pix[i+c])
+						}
+					}
+				}
+				n := (x1 - x0) * (y1 - y0)
+				var avg [4]uint8
+				for c := range avg {
+					avg[c] = uint8((sum[c] + n/2) / n)
+				}
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						i := img.PixOffset(x, y)
+						copy(img.Pix[i:i+4], avg[:])
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,355 @@
+package gopiq
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSolarize(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	originalImg.Set(1, 1, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+
+	proc := New(originalImg).Solarize(128)
+	if proc.Err() != nil {
+		t.Fatalf("Solarize() should not return an error, got: %v", proc.Err())
+	}
+
+	// Channels above the threshold are inverted, the rest are kept.
+	r, g, b, a := proc.currentImage.At(1, 1).RGBA()
+	if r>>8 != 55 || g>>8 != 100 || b>>8 != 50 || a>>8 != 255 {
+		t.Errorf("Solarize(128) of (200,100,50) = (%d,%d,%d,%d), want (55,100,50,255)", r>>8, g>>8, b>>8, a>>8)
+	}
+
+	// Transparent pixels stay transparent.
+	if _, _, _, a := proc.currentImage.At(5, 5).RGBA(); a != 0 {
+		t.Errorf("Solarize() should preserve transparency, got alpha %d", a>>8)
+	}
+
+	// Parallel and sequential paths must agree.
+	large := createTestImage(200, 200)
+	seq := NewWithPerformanceOptions(large, PerformanceOptions{}).Solarize(100)
+	par := NewWithPerformanceOptions(large, PerformanceOptions{MaxGoroutines: 4, EnableParallelProcessing: true, MinSizeForParallel: 1}).Solarize(100)
+	seqImg, _ := seq.Image()
+	parImg, _ := par.Image()
+	if string(seqImg.(*image.RGBA).Pix) != string(parImg.(*image.RGBA).Pix) {
+		t.Error("Solarize() parallel and sequential results differ")
+	}
+
+	// Test case: Chaining with a prior error
+	procWithErr := New(nil)
+	if procWithErr.Solarize(128).Err() == nil {
+		t.Fatal("Solarize() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestDuotone(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	originalImg.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	originalImg.Set(1, 0, color.RGBA{255, 255, 255, 255})
+	originalImg.Set(2, 0, color.RGBA{128, 128, 128, 255})
+
+	shadow := color.RGBA{20, 0, 80, 255}
+	highlight := color.RGBA{255, 200, 0, 255}
+	proc := New(originalImg).Duotone(shadow, highlight)
+	if proc.Err() != nil {
+		t.Fatalf("Duotone() should not return an error, got: %v", proc.Err())
+	}
+
+	if got := color.RGBAModel.Convert(proc.currentImage.At(0, 0)); got != shadow {
+		t.Errorf("Duotone() black pixel = %v, want shadow %v", got, shadow)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(1, 0)); got != highlight {
+		t.Errorf("Duotone() white pixel = %v, want highlight %v", got, highlight)
+	}
+	mid := color.RGBAModel.Convert(proc.currentImage.At(2, 0)).(color.RGBA)
+	if mid.R <= shadow.R || mid.R >= highlight.R || mid.B <= highlight.B || mid.B >= shadow.B {
+		t.Errorf("Duotone() mid-gray pixel %v should lie between shadow and highlight", mid)
+	}
+
+	if New(originalImg).Duotone(nil, highlight).Err() == nil {
+		t.Error("Duotone() with nil color should return an error")
+	}
+	if New(nil).Duotone(shadow, highlight).Err() == nil {
+		t.Fatal("Duotone() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestColorize(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	originalImg.Set(0, 0, color.RGBA{100, 100, 100, 255})
+	red := color.RGBA{255, 0, 0, 255}
+
+	// Strength 0 leaves the image untouched.
+	proc := New(originalImg).Colorize(red, 0)
+	if proc.Err() != nil {
+		t.Fatalf("Colorize() should not return an error, got: %v", proc.Err())
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(0, 0)); got != (color.RGBA{100, 100, 100, 255}) {
+		t.Errorf("Colorize(strength 0) changed the pixel to %v", got)
+	}
+
+	// Full strength tints the gray towards red.
+	proc = New(originalImg).Colorize(red, 1)
+	px := color.RGBAModel.Convert(proc.currentImage.At(0, 0)).(color.RGBA)
+	if px.R <= px.G || px.G != px.B {
+		t.Errorf("Colorize(red, 1) of gray = %v, want a red tint", px)
+	}
+
+	// Invalid arguments
+	if New(originalImg).Colorize(red, 1.5).Err() == nil {
+		t.Error("Colorize() with strength > 1 should return an error")
+	}
+	if New(originalImg).Colorize(nil, 0.5).Err() == nil {
+		t.Error("Colorize() with nil color should return an error")
+	}
+	if New(nil).Colorize(red, 0.5).Err() == nil {
+		t.Fatal("Colorize() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestEnhanceLowLight(t *testing.T) {
+	// A dark, slightly noisy scene with a dim orange object.
+	dark := image.NewRGBA(image.Rect(0, 0, 60, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 60; x++ {
+			v := uint8(18 + (x*7+y*3)%6)
+			c := color.RGBA{v, v, v + 4, 255}
+			if x >= 20 && x < 40 && y >= 20 && y < 40 {
+				c = color.RGBA{60, 30, 10, 255}
+			}
+			dark.SetRGBA(x, y, c)
+		}
+	}
+
+	proc := New(dark).EnhanceLowLight(0.8)
+	if proc.Err() != nil {
+		t.Fatalf("EnhanceLowLight() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != dark.Bounds() {
+		t.Errorf("EnhanceLowLight() changed bounds to %v", img.Bounds())
+	}
+
+	meanLuma := func(img image.Image) float64 {
+		sum := 0.0
+		for y := 0; y < 60; y++ {
+			for x := 0; x < 60; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				sum += luminance(c.R, c.G, c.B)
+			}
+		}
+		return sum / 3600
+	}
+	if before, after := meanLuma(dark), meanLuma(img); after < 2*before {
+		t.Errorf("EnhanceLowLight() mean luma %.1f -> %.1f, want a clear lift", before, after)
+	}
+	// The object keeps its hue.
+	if c := color.RGBAModel.Convert(img.At(30, 30)).(color.RGBA); !(c.R > c.G && c.G > c.B) || c.R <= 60 {
+		t.Errorf("EnhanceLowLight() object = %v, want brighter orange", c)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0xffff {
+		t.Error("EnhanceLowLight() should preserve alpha")
+	}
+
+	// Strength zero is a no-op.
+	if img, _ := New(dark).EnhanceLowLight(0).Image(); img != dark {
+		t.Error("EnhanceLowLight() with strength 0 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(dark).EnhanceLowLight(1.5).Err() == nil {
+		t.Error("EnhanceLowLight() with strength > 1 should return an error")
+	}
+	if New(nil).EnhanceLowLight(0.5).Err() == nil {
+		t.Fatal("EnhanceLowLight() on a processor with prior error should propagate that error")
+	}
+}
+
+// wideStrideImage returns a w×h noise image at the origin whose rows are
+// wider than it, as SubImage and CropView return, and a compact copy of it.
+func wideStrideImage(w, h int) (wide, compact *image.RGBA) {
+	wide = createNoiseImage(w+20, h+10).SubImage(image.Rect(0, 0, w, h)).(*image.RGBA)
+	compact = image.NewRGBA(wide.Rect)
+	draw.Draw(compact, compact.Rect, wide, image.Point{}, draw.Src)
+	return wide, compact
+}
+
+func TestPixelate(t *testing.T) {
+	originalImg := createTestImage(100, 100)
+
+	proc := New(originalImg).Pixelate(20)
+	if proc.Err() != nil {
+		t.Fatalf("Pixelate() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != originalImg.Bounds() {
+		t.Errorf("Pixelate() changed bounds to %v", img.Bounds())
+	}
+
+	// Every 20px block of the 10px checkerboard averages to a uniform gray.
+	first := color.RGBAModel.Convert(img.At(0, 0))
+	for _, p := range []image.Point{{19, 19}, {20, 0}, {55, 73}, {99, 99}} {
+		if got := color.RGBAModel.Convert(img.At(p.X, p.Y)); got != first {
+			t.Errorf("Pixelate() pixel %v = %v, want uniform %v", p, got, first)
+		}
+	}
+	if c := first.(color.RGBA); c.R == 0 || c.R == 255 {
+		t.Errorf("Pixelate() block color = %v, want the checkerboard average", c)
+	}
+
+	// Edge blocks are smaller and average only their own pixels: the last
+	// 10x10 block covers exactly one checkerboard cell.
+	img, _ = New(originalImg).Pixelate(15).Image()
+	if got, want := color.RGBAModel.Convert(img.At(99, 99)), color.RGBAModel.Convert(originalImg.At(99, 99)); got != want {
+		t.Errorf("Pixelate() partial edge block = %v, want %v", got, want)
+	}
+
+	// Views whose rows are wider than the image give the same result.
+	wide, compact := wideStrideImage(60, 50)
+	if got, want := mustImage(t, New(wide).Pixelate(7)), mustImage(t, New(compact).Pixelate(7)); !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("Pixelate() of a wide-stride view differs from that of a compact copy")
+	}
+
+	// Invalid input
+	if New(originalImg).Pixelate(0).Err() == nil {
+		t.Error("Pixelate() with block size 0 should return an error")
+	}
+	if New(nil).Pixelate(8).Err() == nil {
+		t.Fatal("Pixelate() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestSplitTone(t *testing.T) {
+	// A horizontal gray ramp.
+	ramp := image.NewRGBA(image.Rect(0, 0, 256, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			ramp.SetRGBA(x, y, color.RGBA{uint8(x), uint8(x), uint8(x), 255})
+		}
+	}
+	teal, orange := color.RGBA{0, 128, 128, 255}, color.RGBA{255, 140, 0, 255}
+
+	proc := New(ramp).SplitTone(teal, orange, 0)
+	if proc.Err() != nil {
+		t.Fatalf("SplitTone() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	at := func(img image.Image, x int) color.RGBA { return color.RGBAModel.Convert(img.At(x, 0)).(color.RGBA) }
+
+	if c := at(img, 40); !(c.B > c.R && c.G > c.R) {
+		t.Errorf("SplitTone() shadow = %v, want teal cast", c)
+	}
+	if c := at(img, 215); !(c.R > c.B) {
+		t.Errorf("SplitTone() highlight = %v, want orange cast", c)
+	}
+	if c := at(img, 128); absDiff(c.R, c.B) > 8 {
+		t.Errorf("SplitTone() midtone at the pivot = %v, want nearly neutral", c)
+	}
+
+	// A positive balance pushes the highlight tint into the midtones.
+	img, _ = New(ramp).SplitTone(teal, orange, 0.8).Image()
+	if c := at(img, 128); !(c.R > c.B) {
+		t.Errorf("SplitTone() with positive balance midtone = %v, want orange cast", c)
+	}
+
+	// Invalid input
+	if New(ramp).SplitTone(nil, orange, 0).Err() == nil {
+		t.Error("SplitTone() with a nil tint should return an error")
+	}
+	if New(ramp).SplitTone(teal, orange, 2).Err() == nil {
+		t.Error("SplitTone() with balance > 1 should return an error")
+	}
+	if New(nil).SplitTone(teal, orange, 0).Err() == nil {
+		t.Fatal("SplitTone() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestProcessRowsErr(t *testing.T) {
+	ip := NewWithPerformanceOptions(createTestImage(10, 10), PerformanceOptions{
+		MaxGoroutines:            2,
+		EnableParallelProcessing: true,
+		MinSizeForParallel:       1,
+	})
+
+	// All rows are covered exactly once.
+	var mu sync.Mutex
+	seen := make([]int, 100)
+	if err := ip.processRowsErr(10, 100, func(startRow, endRow int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for y := startRow; y < endRow; y++ {
+			seen[y]++
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("processRowsErr() should not error, got: %v", err)
+	}
+	for y, n := range seen {
+		if n != 1 {
+			t.Fatalf("row %d processed %d times, want 1", y, n)
+		}
+	}
+
+	// The first error is returned and cancels strips that have not started.
+	failure := errors.New("strip failed")
+	var calls atomic.Int32
+	err := ip.processRowsErr(10, 100, func(startRow, endRow int) error {
+		calls.Add(1)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("processRowsErr() error = %v, want the strip error", err)
+	}
+	if n := calls.Load(); n >= 2*stripsPerGoroutine {
+		t.Errorf("processRowsErr() ran %d strips after a failure, want the rest cancelled", n)
+	}
+
+	// Panics become errors, also without parallel processing.
+	err = ip.processRowsErr(10, 100, func(startRow, endRow int) error {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("processRowsErr() with a panicking strip error = %v, want the panic", err)
+	} else if strings.Contains(err.Error(), "\n") {
+		t.Errorf("processRowsErr() with a panicking strip error = %q, want a single line without the stack", err)
+	}
+	ip.SetPerformanceOptions(PerformanceOptions{})
+	if err := ip.processRowsErr(10, 100, func(int, int) error { panic("boom") }); err == nil {
+		t.Error("processRowsErr() without parallel processing should turn a panic into an error")
+	}
+}
+
+func TestStripFailureSetsError(t *testing.T) {
+	for _, parallel := range []bool{true, false} {
+		// A damaged buffer whose last rows are missing makes one strip panic.
+		img := image.NewRGBA(image.Rect(0, 0, 10, 100))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(i)
+		}
+		img.Pix = slices.Clip(img.Pix[:img.Stride*90])
+		original := slices.Clone(img.Pix)
+		ip := NewWithPerformanceOptions(img, PerformanceOptions{
+			MaxGoroutines:            4,
+			EnableParallelProcessing: parallel,
+			MinSizeForParallel:       1,
+		})
+
+		ip.Solarize(128).Sharpen(1)
+		if ip.Err() == nil {
+			t.Fatalf("Solarize() with a failing strip (parallel: %v) should set an error", parallel)
+		}
+		if ip.currentImage != image.Image(img) || !slices.Equal(img.Pix, original) {
+			t.Errorf("Solarize() with a failing strip (parallel: %v) should leave the image unchanged", parallel)
+		}
+		if got := ip.history; len(got) != 0 {
+			t.Errorf("history after a failing strip = %v, want nothing recorded", got)
+		}
+	}
+}
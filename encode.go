@@ -0,0 +1,173 @@
+package gopiq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"slices"
+)
+
+// defaultJPEGQuality is the quality of JPEG output unless set with
+// WithJPEGQuality.
+const defaultJPEGQuality = 90
+
+// EncodeOptions holds configuration for encoding images.
+type EncodeOptions struct {
+	// Fallback lists formats to try in order when the requested format has
+	// no encoder available on this build.
+	Fallback []ImageFormat
+	// Provenance, if not empty, is the claim generator (software name and
+	// version) of a C2PA manifest describing the applied operations that is
+	// embedded in the output. See WithProvenance.
+	Provenance string
+	// Metadata is what happens to the EXIF and XMP metadata of the decoded
+	// image. See WithKeepMetadata and WithStripMetadata.
+	Metadata MetadataPolicy
+	// XDPI and YDPI are the pixel density of JPEG and PNG output in dots
+	// per inch; 0 leaves it unset. See WithDPI.
+	XDPI, YDPI float64
+	// JPEGQuality is the quality of JPEG output from 1 to 100; 0 means the
+	// default of 90. See WithJPEGQuality.
+	JPEGQuality int
+	// JPEGProgressive makes JPEG output progressive. See
+	// WithProgressiveJPEG.
+	JPEGProgressive bool
+	// JPEGSubsampling is the chroma subsampling of JPEG output; the zero
+	// value is 4:2:0. See WithJPEGSubsampling.
+	JPEGSubsampling JPEGSubsampling
+	// PNGCompression is the compression level of PNG output; the zero value
+	// is png.DefaultCompression. See WithPNGCompression.
+	PNGCompression png.CompressionLevel
+	// PNGFilter is the row filter of PNG output; the zero value leaves the
+	// choice to image/png. See WithPNGFilter.
+	PNGFilter PNGFilter
+	// PNGColors quantizes PNG output to an indexed PNG-8 of at most this
+	// many colors; 0 keeps the colors of the image. See WithPNGColors.
+	PNGColors int
+	// WebPQuality is the quality of lossy WebP output from 1 to 100; 0
+	// means the default of 75. See WithWebPQuality.
+	WebPQuality int
+	// WebPLossless makes WebP output lossless. See WithWebPLossless.
+	WebPLossless bool
+	// TIFFCompression is the compression of TIFF output; the zero value is
+	// TIFFDeflate. See WithTIFFCompression.
+	TIFFCompression TIFFCompression
+	// ICOSizes are the sizes of the images in ICO output; nil means the
+	// default of 16, 32 and 48. See WithICOSizes.
+	ICOSizes []int
+	// TGARLE makes TGA output run-length encoded. See WithTGARLE.
+	TGARLE bool
+}
+
+// EncodeOption is a functional option for configuring ToBytes. Options
+// override the processor's EncodeOptions (see WithOptions) for one call.
+type EncodeOption func(*EncodeOptions)
+
+// WithCodecFallback makes encoding fall back to the formats in order, e.g.
+// AVIF -> WebP -> JPEG, when the requested format (and any earlier fallback)
+// has no encoder available, so deployments with optional codecs keep working.
+// Only a missing encoder (ErrUnsupportedFormat) triggers the fallback; other
+// encoding errors are returned as is. DetectFormat reports which format was
+// produced.
+func WithCodecFallback(order []ImageFormat) EncodeOption {
+	return func(eo *EncodeOptions) { eo.Fallback = append([]ImageFormat(nil), order...) }
+}
+
+// WithJPEGQuality sets the quality of JPEG output from 1 (smallest file) to
+// 100 (best quality); the default is 90. Encoding fails for qualities
+// outside that range.
+func WithJPEGQuality(quality int) EncodeOption {
+	return func(eo *EncodeOptions) { eo.JPEGQuality = quality }
+}
+
+// WithPNGCompression sets the compression level of PNG output, trading
+// encoding time for size: png.BestSpeed for images served once,
+// png.BestCompression for assets encoded once and served often. PNG is
+// lossless, so the pixels are the same at every level. Encoding fails for
+// levels other than those of the image/png package.
+func WithPNGCompression(level png.CompressionLevel) EncodeOption {
+	return func(eo *EncodeOptions) { eo.PNGCompression = level }
+}
+
+// clone returns a copy of eo that shares no slices with it.
+func (eo EncodeOptions) clone() EncodeOptions {
+	eo.Fallback = append([]ImageFormat(nil), eo.Fallback...)
+	eo.ICOSizes = slices.Clone(eo.ICOSizes)
+	return eo
+}
+
+// newEncodeOptions applies options on top of a copy of base.
+func newEncodeOptions(base EncodeOptions, options []EncodeOption) *EncodeOptions {
+	eo := base.clone()
+	for _, opt := range options {
+		opt(&eo)
+	}
+	return &eo
+}
+
+// encodeWithOptions encodes img in format, with the RegisterEncoder codec
+// for it if there is one, trying the fallback formats of eo while encoders
+// are missing, and returns the encoded bytes and the format actually used.
+// history lists the operations applied to img for the provenance manifest,
+// and meta is the metadata of the decoded image, whose ICC profile is kept
+// unless the encoder wrote one.
+func encodeWithOptions(img image.Image, format ImageFormat, eo *EncodeOptions, history []string, meta imageMetadata) ([]byte, ImageFormat, error) {
+	var errs []error
+	for _, f := range append([]ImageFormat{format}, eo.Fallback...) {
+		var buf bytes.Buffer
+		var err error
+		encode, registered := registeredEncoder(f)
+		switch {
+		case registered:
+			err = encode(&buf, img)
+		case f == FormatJPEG:
+			err = encodeJPEG(&buf, img, eo.JPEGQuality, eo.JPEGProgressive, eo.JPEGSubsampling)
+		case f == FormatPNG:
+			err = encodePNG(&buf, img, eo.PNGCompression, eo.PNGFilter, eo.PNGColors)
+		case f == FormatWebP:
+			err = encodeWebP(&buf, img, eo.WebPQuality, eo.WebPLossless)
+		case f == FormatTIFF:
+			err = encodeTIFF(&buf, []image.Image{img}, eo.TIFFCompression)
+		case f == FormatICO:
+			err = encodeICO(&buf, img, eo.ICOSizes)
+		case f == FormatTGA:
+			err = encodeTGA(&buf, img, eo.TGARLE)
+		default:
+			err = encodeImage(&buf, img, f)
+		}
+		if err == nil {
+			data := buf.Bytes()
+			if meta.icc != nil && iccFits(meta.icc, img, f) && readMetadata(bytes.NewReader(data), int64(len(data))).icc == nil {
+				data, err = embedICC(data, f, meta.icc)
+			}
+			if err == nil && eo.Provenance != "" {
+				data, err = embedManifest(data, f, buildManifest(eo.Provenance, f, history))
+			}
+			if err == nil {
+				switch eo.Metadata {
+				case MetadataKeep:
+					if meta.exif != nil && (eo.XDPI != 0 || eo.YDPI != 0) {
+						meta.exif = exifWithResolution(meta.exif, eo.XDPI, eo.YDPI)
+					}
+					data, err = embedMetadata(data, f, meta)
+				case MetadataStrip:
+					data, err = stripMetadata(data, f, registered)
+				}
+			}
+			if err == nil && (eo.XDPI != 0 || eo.YDPI != 0) {
+				data, err = embedDPI(data, f, eo.XDPI, eo.YDPI)
+			}
+			return data, f, err
+		}
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			return nil, f, err
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return nil, format, errs[0]
+	}
+	return nil, format, fmt.Errorf("no encoder available for %s or its fallbacks: %w", format, errors.Join(errs...))
+}
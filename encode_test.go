@@ -0,0 +1,111 @@
+package gopiq
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestWithCodecFallback(t *testing.T) {
+	proc := New(createTestImage(20, 20))
+
+	data, err := proc.ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatGIF, FormatJPEG, FormatPNG}))
+	if err != nil {
+		t.Fatalf("ToBytes() with a fallback chain should not error, got: %v", err)
+	}
+	if got := DetectFormat(data); got != FormatJPEG {
+		t.Errorf("ToBytes() with fallback produced %s, want jpeg", got)
+	}
+
+	// An available format is used directly.
+	data, err = proc.ToBytes(FormatPNG, WithCodecFallback([]ImageFormat{FormatJPEG}))
+	if err != nil || DetectFormat(data) != FormatPNG {
+		t.Errorf("ToBytes(FormatPNG) with fallback = %s, %v, want png", DetectFormat(data), err)
+	}
+
+	// Without fallback, or with only unavailable fallbacks, the error says why.
+	if _, err := proc.ToBytes(FormatAVIF); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("ToBytes(FormatAVIF) error = %v, want ErrUnsupportedFormat", err)
+	}
+	_, err = proc.ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatGIF}))
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("ToBytes() with only unavailable fallbacks error = %v, want ErrUnsupportedFormat", err)
+	}
+
+	// Test case: Processor with a prior error
+	if _, err := New(nil).ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatPNG})); err == nil {
+		t.Fatal("ToBytes() on a processor with prior error should return that error")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	jpegData, _ := imageToJPEGBytes(createTestImage(8, 8))
+	pngData, _ := imageToPNGBytes(createTestImage(8, 8))
+	cases := map[string]ImageFormat{
+		string(jpegData):                   FormatJPEG,
+		string(pngData):                    FormatPNG,
+		"GIF89a\x01\x00\x01\x00":           FormatGIF,
+		"RIFF\x24\x00\x00\x00WEBPVP8 ":     FormatWebP,
+		"\x00\x00\x00\x1cftypavif\x00\x00": FormatAVIF,
+		"\x00\x00\x00\x18ftypheic\x00\x00": FormatHEIC,
+		"\xff\x0a\xfa\x3f":                 FormatJXL,
+		"not an image":                     FormatUnknown,
+		"":                                 FormatUnknown,
+	}
+	for data, want := range cases {
+		if got := DetectFormat([]byte(data)); got != want {
+			t.Errorf("DetectFormat(%q...) = %s, want %s", data[:min(len(data), 12)], got, want)
+		}
+	}
+
+	for _, f := range []ImageFormat{FormatJPEG, FormatPNG, FormatGIF, FormatWebP, FormatAVIF, FormatHEIC, FormatJXL} {
+		if got := FormatFromString(f.String()); got != f {
+			t.Errorf("FormatFromString(%q) = %s, want %s", f.String(), got, f)
+		}
+	}
+}
+
+func TestJPEGAndPNGOptions(t *testing.T) {
+	proc := New(gradientImage(64, 64))
+	sizes := map[int]int{}
+	for _, q := range []int{0, 20, 100} {
+		data, err := proc.ToBytes(FormatJPEG, WithJPEGQuality(q))
+		if err != nil {
+			t.Fatalf("ToBytes(FormatJPEG) with quality %d should not error, got: %v", q, err)
+		}
+		sizes[q] = len(data)
+	}
+	if !(sizes[20] < sizes[0] && sizes[0] < sizes[100]) {
+		t.Errorf("JPEG sizes at quality 20, default and 100 = %d, %d, %d, want increasing", sizes[20], sizes[0], sizes[100])
+	}
+	if data, _ := proc.ToBytes(FormatJPEG, WithJPEGQuality(90)); len(data) != sizes[0] {
+		t.Errorf("default JPEG quality gives %d bytes, want the %d of quality 90", sizes[0], len(data))
+	}
+
+	raw, err := proc.ToBytes(FormatPNG, WithPNGCompression(png.NoCompression))
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPNG) with no compression should not error, got: %v", err)
+	}
+	best, err := proc.ToBytes(FormatPNG, WithPNGCompression(png.BestCompression))
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPNG) with best compression should not error, got: %v", err)
+	}
+	if len(best) >= len(raw) {
+		t.Errorf("best PNG compression gives %d bytes, want less than the %d uncompressed", len(best), len(raw))
+	}
+	got, _ := FromBytes(best).ToRGBA()
+	if want, _ := FromBytes(raw).ToRGBA(); !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("PNG compression levels should decode to the same pixels")
+	}
+
+	// Test case: Invalid input
+	for _, q := range []int{-1, 101} {
+		if _, err := proc.ToBytes(FormatJPEG, WithJPEGQuality(q)); err == nil {
+			t.Errorf("ToBytes(FormatJPEG) with quality %d should return an error", q)
+		}
+	}
+	if _, err := proc.ToBytes(FormatPNG, WithPNGCompression(png.CompressionLevel(9))); err == nil {
+		t.Error("ToBytes(FormatPNG) with an unknown compression level should return an error")
+	}
+}
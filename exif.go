@@ -0,0 +1,268 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImageMetadata is what the camera or editor that wrote an image recorded
+// about it. Fields the image does not record are zero.
+type ImageMetadata struct {
+	// Orientation is the EXIF orientation, from 1 (upright) to 8, that
+	// viewers apply when displaying the image; see AutoOrient.
+	Orientation int
+	// DateTime is when the photo was taken, or else when the file was last
+	// changed, in the recorded time zone; without one it is the camera's
+	// clock reading in UTC.
+	DateTime time.Time
+	// Make, Model and LensModel describe the camera.
+	Make, Model, LensModel string
+	// GPS is where the photo was taken, or nil if it is not geotagged.
+	GPS *GPSPosition
+	// XDPI and YDPI are the pixel density in dots per inch, from EXIF, JFIF
+	// or a PNG pHYs chunk.
+	XDPI, YDPI float64
+}
+
+// GPSPosition is a position recorded by a camera.
+type GPSPosition struct {
+	Latitude, Longitude float64 // Degrees; south and west are negative
+	Altitude            float64 // Meters above sea level; 0 if not recorded
+}
+
+// Metadata returns the metadata of the image as read by FromBytes or
+// FromReaderAt from the original JPEG, PNG or WebP bytes, e.g. to strip
+// geotagged images with WithStripMetadata or sort photos by capture date.
+// Operations do not change it. Images not decoded from such bytes have
+// empty metadata.
+// Returns an error if a previous error in the chain exists or the EXIF
+// metadata is malformed.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Metadata() (*ImageMetadata, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	md := &ImageMetadata{XDPI: ip.meta.dpi[0], YDPI: ip.meta.dpi[1]}
+	if ip.meta.exif == nil {
+		return md, nil
+	}
+	if err := parseEXIF(ip.meta.exif, md); err != nil {
+		return nil, fmt.Errorf("invalid EXIF metadata: %w", err)
+	}
+	return md, nil
+}
+
+// outputMetadata returns the metadata to write with the current image:
+// once AutoOrient has made the pixels upright, the EXIF orientation is 1.
+// The caller must hold ip.mu.
+func (ip *ImageProcessor) outputMetadata() imageMetadata {
+	meta := ip.meta
+	if ip.upright && meta.exif != nil {
+		meta.exif = exifWithOrientation(meta.exif, 1)
+	}
+	return meta
+}
+
+// EXIF tags read by parseEXIF.
+const (
+	exifMake               = 0x010f
+	exifModel              = 0x0110
+	exifOrientation        = 0x0112
+	exifXResolution        = 0x011a
+	exifYResolution        = 0x011b
+	exifResolutionUnit     = 0x0128
+	exifDateTime           = 0x0132
+	exifIFDPointer         = 0x8769
+	exifGPSPointer         = 0x8825
+	exifDateTimeOriginal   = 0x9003
+	exifOffsetTime         = 0x9010
+	exifOffsetTimeOriginal = 0x9011
+	exifLensModel          = 0xa434
+	gpsLatitudeRef         = 1
+	gpsLatitude            = 2
+	gpsLongitudeRef        = 3
+	gpsLongitude           = 4
+	gpsAltitudeRef         = 5
+	gpsAltitude            = 6
+)
+
+// exifTypeSizes maps EXIF field types to the size of a value.
+var exifTypeSizes = map[uint16]int64{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+// exifField is a field of an EXIF directory with the bytes of its values.
+type exifField struct {
+	typ   uint16
+	count int64
+	data  []byte
+}
+
+// int returns value i of a BYTE, SHORT or LONG field, or 0.
+func (f exifField) int(order binary.ByteOrder, i int64) int {
+	if i >= f.count {
+		return 0
+	}
+	switch f.typ {
+	case 1:
+		return int(f.data[i])
+	case 3:
+		return int(order.Uint16(f.data[2*i:]))
+	case 4:
+		return int(order.Uint32(f.data[4*i:]))
+	}
+	return 0
+}
+
+// rational returns value i of a RATIONAL or SRATIONAL field, or 0.
+func (f exifField) rational(order binary.ByteOrder, i int64) float64 {
+	if i >= f.count || f.typ != 5 && f.typ != 10 {
+		return 0
+	}
+	n, d := order.Uint32(f.data[8*i:]), order.Uint32(f.data[8*i+4:])
+	if d == 0 {
+		return 0
+	}
+	if f.typ == 10 {
+		return float64(int32(n)) / float64(int32(d))
+	}
+	return float64(n) / float64(d)
+}
+
+// string returns the text of an ASCII field, or "".
+func (f exifField) string() string {
+	if f.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(f.data), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// readEXIFDirectory returns the fields of the directory at off by tag.
+// Fields of unknown types or with values out of bounds are left out.
+func readEXIFDirectory(exif []byte, order binary.ByteOrder, off int64) (map[uint16]exifField, error) {
+	if off+2 > int64(len(exif)) {
+		return nil, fmt.Errorf("directory at %d lies beyond the end", off)
+	}
+	n := int64(order.Uint16(exif[off:]))
+	if off+2+12*n > int64(len(exif)) {
+		return nil, fmt.Errorf("directory at %d is truncated", off)
+	}
+	fields := make(map[uint16]exifField, n)
+	for i := range n {
+		e := exif[off+2+12*i:]
+		typ, count := order.Uint16(e[2:]), int64(order.Uint32(e[4:]))
+		size, ok := exifTypeSizes[typ]
+		if !ok {
+			continue
+		}
+		data := e[8:12]
+		if total := size * count; total > 4 {
+			start := int64(order.Uint32(e[8:]))
+			if start+total > int64(len(exif)) {
+				continue
+			}
+			data = exif[start : start+total]
+		}
+		fields[order.Uint16(e)] = exifField{typ, count, data}
+	}
+	return fields, nil
+}
+
+// parseEXIF fills md with the fields of an EXIF structure. Its own
+// directory and that of GPS must be readable when they are referred to.
+func parseEXIF(exif []byte, md *ImageMetadata) error {
+	dirs, order, err := tiffDirectories(exif)
+	if err != nil {
+		return err
+	}
+	ifd0, err := readEXIFDirectory(exif, order, int64(dirs[0]))
+	if err != nil {
+		return err
+	}
+	md.Orientation = ifd0[exifOrientation].int(order, 0)
+	md.Make = ifd0[exifMake].string()
+	md.Model = ifd0[exifModel].string()
+	if x, y := ifd0[exifXResolution].rational(order, 0), ifd0[exifYResolution].rational(order, 0); x > 0 && y > 0 {
+		switch ifd0[exifResolutionUnit].int(order, 0) {
+		case 0, 2: // Inches, the default
+			md.XDPI, md.YDPI = x, y
+		case 3: // Centimeters
+			md.XDPI, md.YDPI = x*2.54, y*2.54
+		}
+	}
+
+	dateTime, offset := ifd0[exifDateTime].string(), ""
+	if ptr, ok := ifd0[exifIFDPointer]; ok {
+		sub, err := readEXIFDirectory(exif, order, int64(ptr.int(order, 0)))
+		if err != nil {
+			return err
+		}
+		offset = sub[exifOffsetTime].string()
+		if original := sub[exifDateTimeOriginal].string(); original != "" {
+			dateTime, offset = original, sub[exifOffsetTimeOriginal].string()
+		}
+		md.LensModel = sub[exifLensModel].string()
+	}
+	md.DateTime = parseEXIFTime(dateTime, offset)
+
+	if ptr, ok := ifd0[exifGPSPointer]; ok {
+		gps, err := readEXIFDirectory(exif, order, int64(ptr.int(order, 0)))
+		if err != nil {
+			return err
+		}
+		lat, lon := gps[gpsLatitude], gps[gpsLongitude]
+		if lat.count == 3 && lon.count == 3 {
+			pos := &GPSPosition{
+				Latitude:  exifDegrees(lat, order),
+				Longitude: exifDegrees(lon, order),
+				Altitude:  gps[gpsAltitude].rational(order, 0),
+			}
+			if gps[gpsLatitudeRef].string() == "S" {
+				pos.Latitude = -pos.Latitude
+			}
+			if gps[gpsLongitudeRef].string() == "W" {
+				pos.Longitude = -pos.Longitude
+			}
+			if gps[gpsAltitudeRef].int(order, 0) == 1 { // Below sea level
+				pos.Altitude = -pos.Altitude
+			}
+			md.GPS = pos
+		}
+	}
+	return nil
+}
+
+// exifDegrees returns the degrees of a GPS coordinate stored as degrees,
+// minutes and seconds.
+func exifDegrees(f exifField, order binary.ByteOrder) float64 {
+	return f.rational(order, 0) + f.rational(order, 1)/60 + f.rational(order, 2)/3600
+}
+
+// parseEXIFTime parses an EXIF date such as "2024:05:17 14:03:22" with a
+// time zone offset such as "+02:00", if any. It returns the zero time for
+// missing or blanked-out dates.
+func parseEXIFTime(s, offset string) time.Time {
+	loc := time.UTC
+	if zone, err := time.Parse("-07:00", offset); err == nil {
+		_, secs := zone.Zone()
+		loc = time.FixedZone("", secs)
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
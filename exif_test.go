@@ -0,0 +1,173 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// exifTestField is a field for buildEXIF. Pointers to other directories
+// set dir to their index instead of a value.
+type exifTestField struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+	dir      int
+}
+
+func exifASCII(tag uint16, s string) exifTestField {
+	return exifTestField{tag: tag, typ: 2, count: uint32(len(s) + 1), value: []byte(s + "\x00")}
+}
+
+func exifShort(tag uint16, v uint16) exifTestField {
+	return exifTestField{tag: tag, typ: 3, count: 1, value: binary.BigEndian.AppendUint16(nil, v)}
+}
+
+func exifRationals(tag uint16, fractions ...uint32) exifTestField {
+	f := exifTestField{tag: tag, typ: 5, count: uint32(len(fractions) / 2)}
+	for _, v := range fractions {
+		f.value = binary.BigEndian.AppendUint32(f.value, v)
+	}
+	return f
+}
+
+// buildEXIF returns a big-endian EXIF structure of directories, the first
+// being IFD0, each followed by its values that do not fit in the fields.
+func buildEXIF(dirs ...[]exifTestField) []byte {
+	offsets := make([]uint32, len(dirs))
+	off := uint32(8)
+	for i, d := range dirs {
+		offsets[i] = off
+		off += 2 + 12*uint32(len(d)) + 4
+		for _, f := range d {
+			if len(f.value) > 4 {
+				off += uint32(len(f.value))
+			}
+		}
+	}
+	out := []byte("MM\x00*\x00\x00\x00\x08")
+	for i, d := range dirs {
+		extraAt := offsets[i] + 2 + 12*uint32(len(d)) + 4
+		var extra []byte
+		out = binary.BigEndian.AppendUint16(out, uint16(len(d)))
+		for _, f := range d {
+			if f.dir > 0 {
+				f.typ, f.count, f.value = 4, 1, binary.BigEndian.AppendUint32(nil, offsets[f.dir])
+			}
+			out = binary.BigEndian.AppendUint16(out, f.tag)
+			out = binary.BigEndian.AppendUint16(out, f.typ)
+			out = binary.BigEndian.AppendUint32(out, f.count)
+			if len(f.value) <= 4 {
+				out = append(out, f.value...)
+				out = append(out, make([]byte, 4-len(f.value))...)
+				continue
+			}
+			out = binary.BigEndian.AppendUint32(out, extraAt+uint32(len(extra)))
+			extra = append(extra, f.value...)
+		}
+		out = append(out, 0, 0, 0, 0) // No next directory
+		out = append(out, extra...)
+	}
+	return out
+}
+
+// jpegWithEXIF returns a JPEG with exif in an APP1 segment.
+func jpegWithEXIF(t *testing.T, exif []byte) []byte {
+	t.Helper()
+	data, err := embedMetadata(mustBytes(t, New(gradientImage(8, 8)), FormatJPEG), FormatJPEG, imageMetadata{exif: exif})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMetadata(t *testing.T) {
+	exif := buildEXIF(
+		[]exifTestField{
+			exifASCII(exifMake, "Canon"),
+			exifASCII(exifModel, "Canon EOS R5"),
+			exifShort(exifOrientation, 6),
+			exifRationals(exifXResolution, 300, 1),
+			exifRationals(exifYResolution, 300, 1),
+			exifShort(exifResolutionUnit, 2),
+			exifASCII(exifDateTime, "2024:06:01 09:00:00"),
+			{tag: exifIFDPointer, dir: 1},
+			{tag: exifGPSPointer, dir: 2},
+		},
+		[]exifTestField{
+			exifASCII(exifDateTimeOriginal, "2024:05:17 14:03:22"),
+			exifASCII(exifOffsetTimeOriginal, "+02:00"),
+			exifASCII(exifLensModel, "RF24-105mm F4 L IS USM"),
+		},
+		[]exifTestField{
+			exifASCII(gpsLatitudeRef, "N"),
+			exifRationals(gpsLatitude, 47, 1, 30, 1, 0, 1),
+			exifASCII(gpsLongitudeRef, "W"),
+			exifRationals(gpsLongitude, 19, 1, 3, 1, 36, 1),
+			{tag: gpsAltitudeRef, typ: 1, count: 1, value: []byte{1}},
+			exifRationals(gpsAltitude, 1035, 10),
+		},
+	)
+	md, err := FromBytes(jpegWithEXIF(t, exif)).Resize(4, 4).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata() should not error, got: %v", err)
+	}
+	if md.Orientation != 6 || md.Make != "Canon" || md.Model != "Canon EOS R5" || md.LensModel != "RF24-105mm F4 L IS USM" {
+		t.Errorf("Metadata() = %+v, want orientation 6 and the camera and lens", md)
+	}
+	if md.XDPI != 300 || md.YDPI != 300 {
+		t.Errorf("Metadata() DPI = %vx%v, want 300x300", md.XDPI, md.YDPI)
+	}
+	want := time.Date(2024, 5, 17, 14, 3, 22, 0, time.FixedZone("", 2*3600))
+	if _, offset := md.DateTime.Zone(); !md.DateTime.Equal(want) || offset != 2*3600 {
+		t.Errorf("Metadata() DateTime = %v, want the original date %v", md.DateTime, want)
+	}
+	if g := md.GPS; g == nil || math.Abs(g.Latitude-47.5) > 1e-9 || math.Abs(g.Longitude+19.06) > 1e-9 || math.Abs(g.Altitude+103.5) > 1e-9 {
+		t.Errorf("Metadata() GPS = %+v, want 47.5, -19.06 at -103.5 m", md.GPS)
+	}
+
+	// Fallbacks: the date of the file without a time zone, and centimeters.
+	exif = buildEXIF([]exifTestField{
+		exifRationals(exifXResolution, 118, 1),
+		exifRationals(exifYResolution, 118, 1),
+		exifShort(exifResolutionUnit, 3),
+		exifASCII(exifDateTime, "2024:06:01 09:00:00"),
+	})
+	md, err = FromBytes(jpegWithEXIF(t, exif)).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata() should not error, got: %v", err)
+	}
+	if !md.DateTime.Equal(time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)) || md.GPS != nil || math.Abs(md.XDPI-299.72) > 1e-9 {
+		t.Errorf("Metadata() = %+v, want the file date in UTC, 299.72 DPI and no GPS", md)
+	}
+
+	// Density without EXIF, from JFIF and pHYs.
+	jpeg := mustBytes(t, New(gradientImage(8, 8)), FormatJPEG)
+	jfif := appendJPEGSegment(nil, 0xe0, 'J', 'F', 'I', 'F', 0, 1, 1, 1, 0, 72, 0, 96, 0, 0)
+	if md, _ := FromBytes(slices.Concat(jpeg[:2], jfif, jpeg[2:])).Metadata(); md.XDPI != 72 || md.YDPI != 96 {
+		t.Errorf("Metadata() of a JFIF JPEG has %vx%v DPI, want 72x96", md.XDPI, md.YDPI)
+	}
+	png := mustBytes(t, New(gradientImage(8, 8)), FormatPNG)
+	phys := appendPNGChunk(nil, "pHYs", []byte{0, 0, 0x0e, 0xc4, 0, 0, 0x0e, 0xc4, 1}) // 3780 pixels per meter
+	md, _ = FromBytes(slices.Concat(png[:pngIHDREnd], phys, png[pngIHDREnd:])).Metadata()
+	if math.Abs(md.XDPI-96.012) > 1e-9 || md.Orientation != 0 || !md.DateTime.IsZero() {
+		t.Errorf("Metadata() of a PNG with pHYs = %+v, want 96.012 DPI and nothing else", md)
+	}
+	if md, err := New(gradientImage(8, 8)).Metadata(); err != nil || *md != (ImageMetadata{}) {
+		t.Errorf("Metadata() of an image not decoded = %+v, %v, want empty metadata", md, err)
+	}
+
+	// Test case: Invalid input
+	if _, err := FromBytes(jpegWithEXIF(t, []byte("II*\x00\xff\x00\x00\x00"))).Metadata(); err == nil {
+		t.Error("Metadata() with a directory beyond the end of the EXIF should return an error")
+	}
+	beyond := exifTestField{tag: exifIFDPointer, typ: 4, count: 1, value: []byte{0, 0, 0xff, 0}}
+	if _, err := FromBytes(jpegWithEXIF(t, buildEXIF([]exifTestField{beyond}))).Metadata(); err == nil {
+		t.Error("Metadata() with an EXIF directory beyond the end should return an error")
+	}
+	if _, err := New(nil).Metadata(); err == nil {
+		t.Error("Metadata() on a processor with prior error should return that error")
+	}
+}
@@ -0,0 +1,352 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// createStripeImage returns a black image with a single white vertical line at x.
+func createStripeImage(width, height, x int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for i := 0; i < width; i++ {
+			c := color.RGBA{0, 0, 0, 255}
+			if i == x {
+				c = color.RGBA{255, 255, 255, 255}
+			}
+			img.SetRGBA(i, y, c)
+		}
+	}
+	return img
+}
+
+func TestMotionBlur(t *testing.T) {
+	originalImg := createStripeImage(40, 40, 20)
+
+	// A horizontal blur spreads the vertical line sideways.
+	proc := New(originalImg).MotionBlur(0, 9)
+	if proc.Err() != nil {
+		t.Fatalf("MotionBlur() should not error, got: %v", proc.Err())
+	}
+	r, _, _, _ := proc.currentImage.At(23, 20).RGBA()
+	if r == 0 {
+		t.Error("Horizontal MotionBlur() should spread the line sideways")
+	}
+	r, _, _, _ = proc.currentImage.At(20, 20).RGBA()
+	if r>>8 == 255 {
+		t.Error("Horizontal MotionBlur() should dim the line itself")
+	}
+
+	// A vertical blur along the line leaves it unchanged.
+	proc = New(originalImg).MotionBlur(90, 9)
+	if got := color.RGBAModel.Convert(proc.currentImage.At(20, 20)); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Vertical MotionBlur() along the line changed it to %v", got)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(22, 20)); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Vertical MotionBlur() should not spread sideways, got %v", got)
+	}
+
+	// Zero and one are no-ops.
+	if img, _ := New(originalImg).MotionBlur(45, 1).Image(); img != image.Image(originalImg) {
+		t.Error("MotionBlur() with distance 1 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(originalImg).MotionBlur(0, -1).Err() == nil {
+		t.Error("MotionBlur() with negative distance should return an error")
+	}
+	if New(nil).MotionBlur(0, 5).Err() == nil {
+		t.Fatal("MotionBlur() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestRadialBlur(t *testing.T) {
+	originalImg := createTestImage(100, 100)
+
+	proc := New(originalImg).RadialBlur(0.5, 0.5, 0.3)
+	if proc.Err() != nil {
+		t.Fatalf("RadialBlur() should not error, got: %v", proc.Err())
+	}
+	if proc.currentImage.Bounds() != originalImg.Bounds() {
+		t.Errorf("RadialBlur() changed bounds to %v", proc.currentImage.Bounds())
+	}
+
+	// The center stays sharp, the corners are blurred into gray.
+	if got, want := color.RGBAModel.Convert(proc.currentImage.At(50, 50)), color.RGBAModel.Convert(originalImg.At(50, 50)); got != want {
+		t.Errorf("RadialBlur() changed the center pixel from %v to %v", want, got)
+	}
+	changed := 0
+	for _, p := range []image.Point{{5, 5}, {95, 5}, {5, 95}, {95, 95}, {9, 9}, {90, 90}} {
+		if color.RGBAModel.Convert(proc.currentImage.At(p.X, p.Y)) != color.RGBAModel.Convert(originalImg.At(p.X, p.Y)) {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("RadialBlur() should blur pixels far from the center")
+	}
+
+	// Strength zero is a no-op.
+	if img, _ := New(originalImg).RadialBlur(0.5, 0.5, 0).Image(); img != originalImg {
+		t.Error("RadialBlur() with strength 0 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(originalImg).RadialBlur(0.5, 0.5, 2).Err() == nil {
+		t.Error("RadialBlur() with strength > 1 should return an error")
+	}
+	if New(nil).RadialBlur(0.5, 0.5, 0.5).Err() == nil {
+		t.Fatal("RadialBlur() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestSharpen(t *testing.T) {
+	originalImg := createStripeImage(40, 40, 20)
+
+	proc := New(originalImg).Sharpen(1)
+	if proc.Err() != nil {
+		t.Fatalf("Sharpen() should not error, got: %v", proc.Err())
+	}
+	if proc.currentImage.Bounds() != originalImg.Bounds() {
+		t.Errorf("Sharpen() changed bounds to %v", proc.currentImage.Bounds())
+	}
+
+	// A flat gray area is unchanged while the edge between light and dark
+	// gets more contrast.
+	flat := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := range flat.Pix {
+		flat.Pix[i] = 128
+		if i%4 == 3 {
+			flat.Pix[i] = 255
+		}
+	}
+	flat.Set(5, 5, color.RGBA{200, 200, 200, 255})
+	img, _ := New(flat).Sharpen(1).Image()
+	if got := color.RGBAModel.Convert(img.At(1, 1)).(color.RGBA); got != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("Sharpen() changed a flat area to %v", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(5, 5)).(color.RGBA); got.R <= 200 {
+		t.Errorf("Sharpen() should brighten a light spot, got %v", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(4, 5)).(color.RGBA); got.R >= 128 {
+		t.Errorf("Sharpen() should darken the neighbours of a light spot, got %v", got)
+	}
+
+	// Amount zero is a no-op.
+	if img, _ := New(originalImg).Sharpen(0).Image(); img != originalImg {
+		t.Error("Sharpen() with amount 0 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(originalImg).Sharpen(-1).Err() == nil {
+		t.Error("Sharpen() with a negative amount should return an error")
+	}
+	if New(nil).Sharpen(1).Err() == nil {
+		t.Fatal("Sharpen() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestMedianFilter(t *testing.T) {
+	// Mid-gray with isolated black and white specks.
+	noisy := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	for i := range noisy.Pix {
+		noisy.Pix[i] = 128
+		if i%4 == 3 {
+			noisy.Pix[i] = 255
+		}
+	}
+	noisy.Set(5, 5, color.White)
+	noisy.Set(20, 12, color.Black)
+	noisy.Set(0, 29, color.White)
+
+	proc := New(noisy).MedianFilter(1)
+	if proc.Err() != nil {
+		t.Fatalf("MedianFilter() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != noisy.Bounds() {
+		t.Errorf("MedianFilter() changed bounds to %v", img.Bounds())
+	}
+	for _, p := range []image.Point{{5, 5}, {20, 12}, {0, 29}} {
+		if got := color.RGBAModel.Convert(img.At(p.X, p.Y)).(color.RGBA); got != (color.RGBA{128, 128, 128, 255}) {
+			t.Errorf("MedianFilter() left speck at %v: %v", p, got)
+		}
+	}
+
+	// Straight edges survive unchanged, unlike with a blur.
+	halves := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				halves.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			} else {
+				halves.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	img, _ = New(halves).MedianFilter(2).Image()
+	for _, x := range []int{18, 19, 20, 21} {
+		if got, want := color.RGBAModel.Convert(img.At(x, 10)), color.RGBAModel.Convert(halves.At(x, 10)); got != want {
+			t.Errorf("MedianFilter() changed edge pixel x=%d from %v to %v", x, want, got)
+		}
+	}
+
+	// Radius zero is a no-op.
+	if img, _ := New(noisy).MedianFilter(0).Image(); img != noisy {
+		t.Error("MedianFilter() with radius 0 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(noisy).MedianFilter(-1).Err() == nil {
+		t.Error("MedianFilter() with a negative radius should return an error")
+	}
+	if New(nil).MedianFilter(1).Err() == nil {
+		t.Fatal("MedianFilter() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestBilateralFilter(t *testing.T) {
+	// Noisy dark and light halves.
+	noisy := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint8(40)
+			if x >= 20 {
+				v = 210
+			}
+			v += uint8((x*7 + y*11) % 9)
+			noisy.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	proc := New(noisy).BilateralFilter(2, 20)
+	if proc.Err() != nil {
+		t.Fatalf("BilateralFilter() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != noisy.Bounds() {
+		t.Errorf("BilateralFilter() changed bounds to %v", img.Bounds())
+	}
+
+	// Noise within each half is reduced...
+	spread := func(img image.Image, x0, x1 int) int {
+		lo, hi := 255, 0
+		for y := 5; y < 35; y++ {
+			for x := x0; x < x1; x++ {
+				r, _, _, _ := img.At(x, y).RGBA()
+				lo, hi = min(lo, int(r>>8)), max(hi, int(r>>8))
+			}
+		}
+		return hi - lo
+	}
+	if before, after := spread(noisy, 2, 16), spread(img, 2, 16); after >= before {
+		t.Errorf("BilateralFilter() should reduce noise, spread %d -> %d", before, after)
+	}
+	// ...while the edge between them stays sharp.
+	left, _, _, _ := img.At(19, 20).RGBA()
+	right, _, _, _ := img.At(20, 20).RGBA()
+	if left>>8 > 60 || right>>8 < 200 {
+		t.Errorf("BilateralFilter() blurred the edge: %d | %d", left>>8, right>>8)
+	}
+
+	// Invalid input
+	if New(noisy).BilateralFilter(0, 20).Err() == nil {
+		t.Error("BilateralFilter() with zero sigmaSpace should return an error")
+	}
+	if New(noisy).BilateralFilter(2, -1).Err() == nil {
+		t.Error("BilateralFilter() with negative sigmaColor should return an error")
+	}
+	if New(nil).BilateralFilter(2, 20).Err() == nil {
+		t.Fatal("BilateralFilter() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestEmboss(t *testing.T) {
+	originalImg := createStripeImage(40, 40, 20)
+
+	proc := New(originalImg).Emboss(1, 0)
+	if proc.Err() != nil {
+		t.Fatalf("Emboss() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != originalImg.Bounds() {
+		t.Errorf("Emboss() changed bounds to %v", img.Bounds())
+	}
+
+	gray := func(img image.Image, x, y int) uint8 { return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y }
+	// Flat areas are mid-gray; lit from the right, the right slope of the
+	// raised line faces the light and the left slope is in shadow.
+	if v := gray(img, 5, 20); v != 128 {
+		t.Errorf("Emboss() flat area = %d, want 128", v)
+	}
+	if left, right := gray(img, 19, 20), gray(img, 21, 20); left >= 128 || right <= 128 {
+		t.Errorf("Emboss() lit from the right: left %d, right %d", left, right)
+	}
+
+	// Light from the opposite side inverts the relief.
+	img, _ = New(originalImg).Emboss(1, 180).Image()
+	if left, right := gray(img, 19, 20), gray(img, 21, 20); left <= 128 || right >= 128 {
+		t.Errorf("Emboss() lit from the left: left %d, right %d", left, right)
+	}
+
+	// Invalid input
+	if New(originalImg).Emboss(-1, 0).Err() == nil {
+		t.Error("Emboss() with negative strength should return an error")
+	}
+	if New(nil).Emboss(1, 45).Err() == nil {
+		t.Fatal("Emboss() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestFocusRegion(t *testing.T) {
+	originalImg := createTestImage(60, 60)
+	focus := image.Rect(20, 20, 40, 40)
+
+	proc := New(originalImg).FocusRegion(focus, 3, 0)
+	if proc.Err() != nil {
+		t.Fatalf("FocusRegion() should not error, got: %v", proc.Err())
+	}
+	hard, _ := proc.Image()
+	for y := focus.Min.Y; y < focus.Max.Y; y++ {
+		for x := focus.Min.X; x < focus.Max.X; x++ {
+			if hard.At(x, y) != originalImg.At(x, y) {
+				t.Fatalf("FocusRegion() changed pixel (%d,%d) inside the focus region", x, y)
+			}
+		}
+	}
+	// Checker edges outside the region are blurred.
+	if hard.At(5, 10) == originalImg.At(5, 10) {
+		t.Error("FocusRegion() should blur outside the focus region")
+	}
+
+	// Feathering keeps pixels just outside the region closer to the original.
+	soft, _ := New(originalImg).FocusRegion(focus, 3, 8).Image()
+	orig, _, _, _ := originalImg.At(40, 30).RGBA()
+	hr, _, _, _ := hard.At(40, 30).RGBA()
+	sr, _, _, _ := soft.At(40, 30).RGBA()
+	if abs(int(sr)-int(orig)) >= abs(int(hr)-int(orig)) {
+		t.Errorf("FocusRegion() with feather should be closer to the original next to the region: soft %d, hard %d, original %d",
+			sr>>8, hr>>8, orig>>8)
+	}
+
+	// Views whose rows are wider than the image give the same result.
+	wide, compact := wideStrideImage(60, 50)
+	if got, want := mustImage(t, New(wide).FocusRegion(focus, 3, 8)), mustImage(t, New(compact).FocusRegion(focus, 3, 8)); !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("FocusRegion() of a wide-stride view differs from that of a compact copy")
+	}
+
+	// Invalid input
+	if New(originalImg).FocusRegion(focus, 0, 4).Err() == nil {
+		t.Error("FocusRegion() with non-positive sigma should return an error")
+	}
+	if New(originalImg).FocusRegion(focus, 3, -1).Err() == nil {
+		t.Error("FocusRegion() with negative feather should return an error")
+	}
+	if New(originalImg).FocusRegion(image.Rect(100, 100, 110, 110), 3, 4).Err() == nil {
+		t.Error("FocusRegion() with a region outside the image should return an error")
+	}
+	if New(nil).FocusRegion(focus, 3, 4).Err() == nil {
+		t.Fatal("FocusRegion() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,326 @@
+package gopiq
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"sync"
+
+	gotext "github.com/go-text/typesetting/font"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultFontName is the name under which the Go Regular font used for
+// watermarks by default is registered.
+const DefaultFontName = "goregular"
+
+// maxCachedFaceSizes bounds the number of face sizes cached per font, so
+// that continuously varying sizes (e.g. WithRelativeFontSize) do not grow
+// the cache without limit. Faces of further sizes are created uncached.
+const maxCachedFaceSizes = 32
+
+// cachedFont is a parsed font together with pools of faces created from it.
+// An opentype.Font may be shared between goroutines but its faces may not,
+// so faces are handed out from a pool per size and returned by Close.
+type cachedFont struct {
+	data []byte
+	font *opentype.Font
+
+	mu    sync.Mutex
+	faces map[faceKey]*sync.Pool // nil for fonts that are not registered
+
+	// The font parsed for text shaping on first use.
+	shapingOnce sync.Once
+	shaping     *gotext.Font
+	shapingErr  error
+}
+
+// faceKey identifies the faces of a font that can be used interchangeably.
+type faceKey struct {
+	size, dpi float64
+}
+
+// fontDataKey identifies font data by the memory it occupies, so fonts
+// passed with WithFontBytes are found in the registry without hashing them.
+type fontDataKey struct {
+	first *byte
+	n     int
+}
+
+func dataKey(data []byte) fontDataKey {
+	if len(data) == 0 {
+		return fontDataKey{}
+	}
+	return fontDataKey{first: &data[0], n: len(data)}
+}
+
+// fontRegistry holds the fonts registered with RegisterFont by name and by
+// their data.
+var fontRegistry = struct {
+	sync.RWMutex
+	byName map[string]*cachedFont
+	byData map[fontDataKey]*cachedFont
+}{
+	byName: map[string]*cachedFont{},
+	byData: map[fontDataKey]*cachedFont{},
+}
+
+func init() {
+	if err := RegisterFont(DefaultFontName, goregular.TTF); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterFont parses a TrueType or OpenType font and registers it under
+// name for WithFontName, replacing any font registered under the same name.
+// Registered fonts are parsed once and their faces are cached and reused
+// across watermarks, which also applies when the same data is passed with
+// WithFontBytes. data must not be modified after registration.
+// Returns an error if name is empty or the font cannot be parsed.
+// This function is safe for concurrent use.
+func RegisterFont(name string, data []byte) error {
+	if name == "" {
+		return fmt.Errorf("font name cannot be empty")
+	}
+	fnt, err := opentype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse font %q: %w", name, err)
+	}
+	f := &cachedFont{data: data, font: fnt, faces: map[faceKey]*sync.Pool{}}
+
+	fontRegistry.Lock()
+	defer fontRegistry.Unlock()
+	if old := fontRegistry.byName[name]; old != nil && fontRegistry.byData[dataKey(old.data)] == old {
+		delete(fontRegistry.byData, dataKey(old.data))
+	}
+	fontRegistry.byName[name] = f
+	fontRegistry.byData[dataKey(data)] = f
+	return nil
+}
+
+// WithFontName uses the font registered under name with RegisterFont, e.g.
+// DefaultFontName. Of WithFontName, WithFontBytes, WithFontPath and
+// WithFontFS the last one wins.
+func WithFontName(name string) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.FontName, wc.FontPath, wc.FontFS = name, "", nil }
+}
+
+// WithFontFallback draws glyphs missing from the watermark font (e.g. CJK
+// ideographs, symbols or emoji in user-generated captions) with the first of
+// fonts that has them instead of as missing-glyph boxes. Line metrics come
+// from the primary font. Only outline glyphs can be drawn, so emoji need a
+// monochrome emoji font such as Noto Emoji; color emoji fonts are not
+// supported. Fallback fonts are parsed for every watermark unless their
+// data is also registered with RegisterFont.
+func WithFontFallback(fonts ...[]byte) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Fallbacks = fonts }
+}
+
+// registeredFont returns the font registered under name, or nil.
+func registeredFont(name string) *cachedFont {
+	fontRegistry.RLock()
+	defer fontRegistry.RUnlock()
+	return fontRegistry.byName[name]
+}
+
+// fontFor returns the registered font with the given data, or else parses
+// the data into a font whose faces are not cached.
+func fontFor(data []byte) (*cachedFont, error) {
+	fontRegistry.RLock()
+	f := fontRegistry.byData[dataKey(data)]
+	fontRegistry.RUnlock()
+	if f != nil {
+		return f, nil
+	}
+	fnt, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font bytes: %w", err)
+	}
+	return &cachedFont{data: data, font: fnt}, nil
+}
+
+// face returns a face of the font of the given size at dpi. The caller must
+// Close the returned face, which returns it to the cache.
+func (f *cachedFont) face(size, dpi float64) (font.Face, error) {
+	var pool *sync.Pool
+	if f.faces != nil {
+		key := faceKey{size: size, dpi: dpi}
+		f.mu.Lock()
+		pool = f.faces[key]
+		if pool == nil && len(f.faces) < maxCachedFaceSizes {
+			pool = &sync.Pool{}
+			f.faces[key] = pool
+		}
+		f.mu.Unlock()
+	}
+	ppem := floatToFixed(size * dpi / 72)
+	if pool != nil {
+		if face, ok := pool.Get().(font.Face); ok {
+			return &fontFace{Face: face, src: f, ppem: ppem, pool: pool}, nil
+		}
+	}
+
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     dpi,
+		Hinting: font.HintingNone,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	return &fontFace{Face: face, src: f, ppem: ppem, pool: pool}, nil
+}
+
+// fontFace is a face of a cachedFont, which text shaping needs to get at
+// the font behind a face. Cached faces go back to their pool when closed.
+type fontFace struct {
+	font.Face
+	src  *cachedFont
+	ppem fixed.Int26_6 // Size in pixels
+	pool *sync.Pool    // nil for faces that are not cached
+}
+
+func (f *fontFace) Close() error {
+	if f.pool == nil {
+		return f.Face.Close()
+	}
+	f.pool.Put(f.Face)
+	return nil
+}
+
+// shapingFont returns the font parsed for text shaping.
+func (f *cachedFont) shapingFont() (*gotext.Font, error) {
+	f.shapingOnce.Do(func() {
+		face, err := gotext.ParseTTF(bytes.NewReader(f.data))
+		if err != nil {
+			f.shapingErr = fmt.Errorf("failed to parse font for shaping: %w", err)
+			return
+		}
+		f.shaping = face.Font
+	})
+	return f.shaping, f.shapingErr
+}
+
+// newFontFace creates a face of the given size at 72 DPI from font data,
+// reusing the parsed font and its faces if the data is registered.
+// The caller must Close the returned face.
+func newFontFace(data []byte, size float64) (font.Face, error) {
+	f, err := fontFor(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.face(size, 72)
+}
+
+// font returns the font of cfg: the registered font named by WithFontName,
+// the font file at FontPath or else the font in FontBytes.
+func (cfg *watermarkConfig) font() (*cachedFont, error) {
+	switch {
+	case cfg.FontName != "":
+		f := registeredFont(cfg.FontName)
+		if f == nil {
+			return nil, fmt.Errorf("font %q is not registered", cfg.FontName)
+		}
+		return f, nil
+	case cfg.FontPath != "":
+		var data []byte
+		var err error
+		if cfg.FontFS != nil {
+			data, err = fs.ReadFile(cfg.FontFS, cfg.FontPath)
+		} else {
+			data, err = os.ReadFile(cfg.FontPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font file: %w", err)
+		}
+		return fontFor(data)
+	default:
+		return fontFor(cfg.FontBytes)
+	}
+}
+
+// newFace creates a face of the font of cfg at cfg.FontSize and 72 DPI.
+// The caller must Close the returned face.
+func (cfg *watermarkConfig) newFace() (font.Face, error) {
+	f, err := cfg.font()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.faceWithFallbacks(f, cfg.FontSize)
+}
+
+// faceWithFallbacks creates a face of f of the given size at 72 DPI that
+// falls back to the fonts of WithFontFallback for missing glyphs.
+// The caller must Close the returned face.
+func (cfg *watermarkConfig) faceWithFallbacks(f *cachedFont, size float64) (font.Face, error) {
+	face, err := f.face(size, 72)
+	if err != nil || len(cfg.Fallbacks) == 0 {
+		return face, err
+	}
+	faces := []font.Face{face}
+	for i, data := range cfg.Fallbacks {
+		fallback, err := newFontFace(data, size)
+		if err != nil {
+			for _, face := range faces {
+				face.Close()
+			}
+			return nil, fmt.Errorf("fallback font %d: %w", i, err)
+		}
+		faces = append(faces, fallback)
+	}
+	return &fallbackFace{faces: faces}, nil
+}
+
+// fallbackFace draws each rune with the first of its faces that has a glyph
+// for it, or with the first face if none does. Metrics are those of the
+// first face.
+type fallbackFace struct {
+	faces []font.Face
+}
+
+func (f *fallbackFace) faceFor(r rune) font.Face {
+	for _, face := range f.faces {
+		if _, ok := face.GlyphAdvance(r); ok {
+			return face
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faceFor(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphAdvance(r)
+}
+
+// Kern returns the kerning of r0 and r1 if both are drawn with the same
+// face; there is no kerning between glyphs of different fonts.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.faceFor(r0)
+	if face != f.faceFor(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
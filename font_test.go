@@ -0,0 +1,218 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestRegisterFont(t *testing.T) {
+	if err := RegisterFont("test-bold", gobold.TTF); err != nil {
+		t.Fatalf("RegisterFont() should not error, got: %v", err)
+	}
+	img := createTestImage(160, 60)
+
+	// A registered font draws the same as passing its data directly.
+	byName, err := New(img).AddTextWatermark("Bold", WithFontName("test-bold")).Image()
+	if err != nil {
+		t.Fatalf("AddTextWatermark() with a registered font should not error, got: %v", err)
+	}
+	byBytes := mustImage(t, New(img).AddTextWatermark("Bold", WithFontBytes(gobold.TTF)))
+	if !bytes.Equal(asRGBA(byName).Pix, asRGBA(byBytes).Pix) {
+		t.Error("WithFontName() should draw like WithFontBytes() with the same font")
+	}
+	regular := mustImage(t, New(img).AddTextWatermark("Bold"))
+	if bytes.Equal(asRGBA(byName).Pix, asRGBA(regular).Pix) {
+		t.Error("WithFontName() should not draw with the default font")
+	}
+
+	// The last of WithFontName and WithFontBytes wins.
+	if New(img).AddTextWatermark("Bold", WithFontName("test-bold"), WithFontBytes([]byte("junk"))).Err() == nil {
+		t.Error("WithFontBytes() after WithFontName() should use the bytes")
+	}
+	if err := New(img).AddTextWatermark("Bold", WithFontBytes([]byte("junk")), WithFontName("test-bold")).Err(); err != nil {
+		t.Errorf("WithFontName() after WithFontBytes() should use the registered font, got: %v", err)
+	}
+
+	// Registered fonts are parsed once and their faces reused.
+	f1, _ := fontFor(gobold.TTF)
+	f2, _ := fontFor(gobold.TTF)
+	if f1 != f2 || f1 != registeredFont("test-bold") {
+		t.Error("fontFor() should return the registered font for its data")
+	}
+	face, err := f1.face(20, 72)
+	if err != nil {
+		t.Fatalf("face() should not error, got: %v", err)
+	}
+	face.Close()
+	if f1.faces[faceKey{size: 20, dpi: 72}] == nil {
+		t.Error("registered font should cache its faces by size")
+	}
+
+	// Cached faces may be used from many goroutines at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := New(img).AddTextWatermark("Bold", WithFontName("test-bold")).Err(); err != nil {
+				t.Errorf("concurrent AddTextWatermark() should not error, got: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Test case: Invalid input
+	if err := RegisterFont("", gobold.TTF); err == nil {
+		t.Error("RegisterFont() with an empty name should return an error")
+	}
+	if err := RegisterFont("junk", []byte("not a font")); err == nil {
+		t.Error("RegisterFont() with invalid data should return an error")
+	}
+	if New(img).AddTextWatermark("x", WithFontName("missing")).Err() == nil {
+		t.Error("AddTextWatermark() with an unregistered font should return an error")
+	}
+	if _, err := WatermarkBounds("x", image.Rect(0, 0, 10, 10), WithFontName("missing")); err == nil {
+		t.Error("WatermarkBounds() with an unregistered font should return an error")
+	}
+}
+
+func TestWithFontFS(t *testing.T) {
+	img := createTestImage(160, 60)
+	want := mustImage(t, New(img).AddTextWatermark("Bold", WithFontBytes(gobold.TTF)))
+
+	fsys := fstest.MapFS{"fonts/Go-Bold.ttf": {Data: gobold.TTF}}
+	got, err := New(img).AddTextWatermark("Bold", WithFontFS(fsys, "fonts/Go-Bold.ttf")).Image()
+	if err != nil {
+		t.Fatalf("AddTextWatermark() with WithFontFS() should not error, got: %v", err)
+	}
+	if !bytes.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("WithFontFS() should draw with the font from the file system")
+	}
+
+	// WithFontPath reads the font from disk.
+	path := filepath.Join(t.TempDir(), "Go-Bold.ttf")
+	if err := os.WriteFile(path, gobold.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = New(img).AddTextWatermark("Bold", WithFontPath(path)).Image()
+	if err != nil {
+		t.Fatalf("AddTextWatermark() with WithFontPath() should not error, got: %v", err)
+	}
+	if !bytes.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("WithFontPath() should draw with the font file")
+	}
+
+	// A later WithFontBytes replaces the file.
+	if err := New(img).AddTextWatermark("Bold", WithFontPath("missing.ttf"), WithFontBytes(gobold.TTF)).Err(); err != nil {
+		t.Errorf("WithFontBytes() after WithFontPath() should use the bytes, got: %v", err)
+	}
+
+	// Test case: Invalid input
+	if New(img).AddTextWatermark("x", WithFontFS(fsys, "fonts/missing.ttf")).Err() == nil {
+		t.Error("AddTextWatermark() with a missing font file should return an error")
+	}
+	if New(img).AddTextWatermark("x", WithFontPath(filepath.Join(t.TempDir(), "missing.ttf"))).Err() == nil {
+		t.Error("AddTextWatermark() with a missing font path should return an error")
+	}
+	junk := fstest.MapFS{"junk.ttf": {Data: []byte("not a font")}}
+	if New(img).AddTextWatermark("x", WithFontFS(junk, "junk.ttf")).Err() == nil {
+		t.Error("AddTextWatermark() with an invalid font file should return an error")
+	}
+}
+
+// restrictCmap returns a copy of a TrueType font whose character map only
+// covers the runes of chars, so the font lacks glyphs for all other text.
+func restrictCmap(t *testing.T, data []byte, chars string) []byte {
+	t.Helper()
+	fnt, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runes := []rune(chars)
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	var buf sfnt.Buffer
+	var starts, deltas []uint16
+	for _, r := range runes {
+		gid, err := fnt.GlyphIndex(&buf, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		starts = append(starts, uint16(r))
+		deltas = append(deltas, uint16(gid)-uint16(r))
+	}
+	starts, deltas = append(starts, 0xFFFF), append(deltas, 1)
+
+	// A format 4 subtable with one segment per rune and no glyph array.
+	segs := len(starts)
+	sub := binary.BigEndian.AppendUint16(nil, 4)
+	sub = binary.BigEndian.AppendUint16(sub, uint16(16+8*segs))
+	sub = binary.BigEndian.AppendUint16(sub, 0)
+	searchRange := 2
+	for searchRange*2 <= segs*2 {
+		searchRange *= 2
+	}
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= segs {
+		entrySelector++
+	}
+	for _, v := range []int{2 * segs, searchRange, entrySelector, 2*segs - searchRange} {
+		sub = binary.BigEndian.AppendUint16(sub, uint16(v))
+	}
+	for _, list := range [][]uint16{starts, {0}, starts, deltas, make([]uint16, segs)} {
+		for _, v := range list {
+			sub = binary.BigEndian.AppendUint16(sub, v)
+		}
+	}
+	cmap := []byte{0, 0, 0, 1, 0, 3, 0, 1, 0, 0, 0, 12}
+	tables, err := readSfntTables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables["cmap"] = &sfntTable{data: append(cmap, sub...)}
+	return writeSfnt(tables)
+}
+
+func TestWithFontFallback(t *testing.T) {
+	primary := restrictCmap(t, goregular.TTF, "abc ")
+	img := createTestImage(200, 60)
+	opts := []WatermarkOption{WithFontBytes(primary), WithPosition(PositionTopLeft), WithFontSize(28)}
+
+	// Without a fallback the missing glyphs are drawn as boxes.
+	want := mustImage(t, New(img).AddTextWatermark("xyz", WithPosition(PositionTopLeft), WithFontSize(28)))
+	tofu := mustImage(t, New(img).AddTextWatermark("xyz", opts...))
+	if bytes.Equal(asRGBA(tofu).Pix, asRGBA(want).Pix) {
+		t.Fatal("restricted font should lack the glyphs of the test text")
+	}
+
+	// The fallback supplies them.
+	got, err := New(img).AddTextWatermark("xyz", append(opts, WithFontFallback(goregular.TTF))...).Image()
+	if err != nil {
+		t.Fatalf("AddTextWatermark() with a fallback font should not error, got: %v", err)
+	}
+	if !bytes.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("missing glyphs should be drawn with the fallback font")
+	}
+
+	// Mixed text measures like the complete font.
+	full, _, _ := MeasureText("abc xyz", WithFontSize(28))
+	if w, _, _ := MeasureText("abc xyz", append(opts, WithFontFallback(goregular.TTF))...); math.Abs(w-full) > 0.5 {
+		t.Errorf("MeasureText() with a fallback = %g, want %g as with the complete font", w, full)
+	}
+
+	// Test case: Invalid input
+	if New(img).AddTextWatermark("x", WithFontFallback([]byte("not a font"))).Err() == nil {
+		t.Error("AddTextWatermark() with an invalid fallback font should return an error")
+	}
+}
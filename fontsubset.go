@@ -0,0 +1,273 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// droppedSubsetTables are removed from subset fonts: DSIG because the
+// signature no longer matches, and the device-metric caches because they
+// describe glyphs that are gone.
+var droppedSubsetTables = map[string]bool{"DSIG": true, "hdmx": true, "LTSH": true, "VDMX": true}
+
+// Composite glyph flags (TrueType 'glyf' table).
+const (
+	glyfArgsAreWords    = 0x0001
+	glyfHaveScale       = 0x0008
+	glyfMoreComponents  = 0x0020
+	glyfHaveXYScale     = 0x0040
+	glyfHaveTwoByTwo    = 0x0080
+	sfntVersionTrueType = 0x00010000
+	sfntVersionApple    = 0x74727565 // 'true'
+	headChecksumMagic   = 0xB1B0AFBA
+)
+
+// sfntTable is a table of an sfnt font file.
+type sfntTable struct {
+	data []byte
+}
+
+// SubsetFont returns a copy of a TrueType font that only contains outlines
+// for the glyphs needed to render text (plus .notdef and the components of
+// composite glyphs). Glyph IDs are kept stable, so character maps, metrics
+// and kerning remain valid, while unused outlines are emptied. This keeps
+// fonts embedded in generated assets small.
+// Only TrueType-flavored fonts (glyf outlines) are supported; CFF-based
+// OpenType fonts and font collections return an error.
+func SubsetFont(fontBytes []byte, text string) ([]byte, error) {
+	tables, err := readSfntTables(fontBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	head, loca, glyf, maxp := tables["head"], tables["loca"], tables["glyf"], tables["maxp"]
+	if head == nil || loca == nil || glyf == nil || maxp == nil {
+		return nil, fmt.Errorf("font subsetting requires head, maxp, loca and glyf tables")
+	}
+	if len(head.data) < 54 || len(maxp.data) < 6 {
+		return nil, fmt.Errorf("font has truncated head or maxp table")
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp.data[4:]))
+	offsets, err := parseLoca(loca.data, numGlyphs, binary.BigEndian.Uint16(head.data[50:]) == 1)
+	if err != nil {
+		return nil, err
+	}
+	glyph := func(gid int) ([]byte, error) {
+		start, end := offsets[gid], offsets[gid+1]
+		if start > end || end > len(glyf.data) {
+			return nil, fmt.Errorf("glyph %d has invalid location", gid)
+		}
+		return glyf.data[start:end], nil
+	}
+
+	// Collect the glyphs used by text, then the components they reference.
+	keep := map[int]bool{0: true}
+	parsed, err := sfnt.Parse(fontBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	var buf sfnt.Buffer
+	queue := []int{0}
+	for _, r := range text {
+		gid, err := parsed.GlyphIndex(&buf, r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map rune %q: %w", r, err)
+		}
+		if gid != 0 && !keep[int(gid)] {
+			keep[int(gid)] = true
+			queue = append(queue, int(gid))
+		}
+	}
+	for len(queue) > 0 {
+		gid := queue[0]
+		queue = queue[1:]
+		data, err := glyph(gid)
+		if err != nil {
+			return nil, err
+		}
+		components, err := compositeComponents(data)
+		if err != nil {
+			return nil, fmt.Errorf("glyph %d: %w", gid, err)
+		}
+		for _, c := range components {
+			if c >= numGlyphs {
+				return nil, fmt.Errorf("glyph %d references missing component %d", gid, c)
+			}
+			if !keep[c] {
+				keep[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	// Rebuild glyf and a long-format loca with empty entries for dropped glyphs.
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for gid := 0; gid < numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(newLoca[4*gid:], uint32(len(newGlyf)))
+		if keep[gid] {
+			data, _ := glyph(gid)
+			newGlyf = append(newGlyf, data...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+
+	newHead := append([]byte(nil), head.data...)
+	binary.BigEndian.PutUint16(newHead[50:], 1) // indexToLocFormat: long offsets
+	glyf.data, loca.data, head.data = newGlyf, newLoca, newHead
+
+	return writeSfnt(tables), nil
+}
+
+// readSfntTables parses the table directory of a TrueType font.
+func readSfntTables(data []byte) (map[string]*sfntTable, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font data too short")
+	}
+	switch version := binary.BigEndian.Uint32(data); version {
+	case sfntVersionTrueType, sfntVersionApple:
+	case 0x4F54544F: // 'OTTO'
+		return nil, fmt.Errorf("CFF-based OpenType fonts cannot be subset")
+	case 0x74746366: // 'ttcf'
+		return nil, fmt.Errorf("font collections cannot be subset")
+	default:
+		return nil, fmt.Errorf("unrecognized font format 0x%08x", version)
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*numTables {
+		return nil, fmt.Errorf("font table directory is truncated")
+	}
+	tables := make(map[string]*sfntTable, numTables)
+	for i := 0; i < numTables; i++ {
+		rec := data[12+16*i:]
+		tag := string(rec[:4])
+		offset, length := int(binary.BigEndian.Uint32(rec[8:])), int(binary.BigEndian.Uint32(rec[12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, fmt.Errorf("font table %q lies outside the file", tag)
+		}
+		tables[tag] = &sfntTable{data: data[offset : offset+length]}
+	}
+	return tables, nil
+}
+
+// parseLoca decodes the glyph offsets of a loca table.
+func parseLoca(loca []byte, numGlyphs int, long bool) ([]int, error) {
+	offsets := make([]int, numGlyphs+1)
+	if long {
+		if len(loca) < 4*(numGlyphs+1) {
+			return nil, fmt.Errorf("loca table is truncated")
+		}
+		for i := range offsets {
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		return offsets, nil
+	}
+	if len(loca) < 2*(numGlyphs+1) {
+		return nil, fmt.Errorf("loca table is truncated")
+	}
+	for i := range offsets {
+		offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+	}
+	return offsets, nil
+}
+
+// compositeComponents returns the glyph IDs referenced by a composite glyph,
+// or nil for simple and empty glyphs.
+func compositeComponents(data []byte) ([]int, error) {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil, nil
+	}
+	var components []int
+	p := 10
+	for {
+		if p+4 > len(data) {
+			return nil, fmt.Errorf("truncated composite glyph")
+		}
+		flags := binary.BigEndian.Uint16(data[p:])
+		components = append(components, int(binary.BigEndian.Uint16(data[p+2:])))
+		p += 4
+		if flags&glyfArgsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&glyfHaveScale != 0:
+			p += 2
+		case flags&glyfHaveXYScale != 0:
+			p += 4
+		case flags&glyfHaveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&glyfMoreComponents == 0 {
+			return components, nil
+		}
+	}
+}
+
+// writeSfnt serializes tables into a TrueType file with correct table
+// checksums and head.checkSumAdjustment.
+func writeSfnt(tables map[string]*sfntTable) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		if !droppedSubsetTables[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	out := make([]byte, 12+16*numTables)
+	binary.BigEndian.PutUint32(out, sfntVersionTrueType)
+	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	headOffset := 0
+	for i, tag := range tags {
+		data := tables[tag].data
+		if tag == "head" {
+			data = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(data[8:], 0) // checkSumAdjustment is computed last
+			headOffset = len(out)
+		}
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], sfntChecksum(data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	binary.BigEndian.PutUint32(out[headOffset+8:], headChecksumMagic-sfntChecksum(out))
+	return out
+}
+
+// sfntChecksum sums data as big-endian uint32 words, zero-padding the tail.
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,98 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestSubsetFont(t *testing.T) {
+	subset, err := SubsetFont(goregular.TTF, "Hello")
+	if err != nil {
+		t.Fatalf("SubsetFont() should not error, got: %v", err)
+	}
+	if len(subset) >= len(goregular.TTF) {
+		t.Errorf("SubsetFont() should shrink the font, got %d bytes from %d", len(subset), len(goregular.TTF))
+	}
+	if sum := sfntChecksum(subset); sum != headChecksumMagic {
+		t.Errorf("SubsetFont() whole-file checksum = %#x, want %#x", sum, uint32(headChecksumMagic))
+	}
+
+	f, err := sfnt.Parse(subset)
+	if err != nil {
+		t.Fatalf("subset font should parse, got: %v", err)
+	}
+	orig, _ := sfnt.Parse(goregular.TTF)
+	if f.NumGlyphs() != orig.NumGlyphs() {
+		t.Errorf("SubsetFont() should keep glyph IDs, got %d glyphs from %d", f.NumGlyphs(), orig.NumGlyphs())
+	}
+
+	var buf sfnt.Buffer
+	outline := func(r rune) int {
+		gid, err := f.GlyphIndex(&buf, r)
+		if err != nil || gid == 0 {
+			t.Fatalf("rune %q should still be mapped, got gid %d, err %v", r, gid, err)
+		}
+		segs, err := f.LoadGlyph(&buf, gid, fixed.I(20), nil)
+		if err != nil {
+			t.Fatalf("LoadGlyph(%q) should not error, got: %v", r, err)
+		}
+		return len(segs)
+	}
+	for _, r := range "Helo" {
+		if outline(r) == 0 {
+			t.Errorf("glyph %q used by the text should keep its outline", r)
+		}
+	}
+	if outline('Z') != 0 {
+		t.Error("glyph 'Z' not used by the text should be emptied")
+	}
+
+	// The subset renders the text like the original font.
+	img := image.NewRGBA(image.Rect(0, 0, 120, 40))
+	proc := New(img).AddTextWatermark("Hello", WithFontBytes(subset), WithColor(color.Black), WithFontSize(20))
+	if proc.Err() != nil {
+		t.Fatalf("subset font should render, got: %v", proc.Err())
+	}
+}
+
+func TestSubsetFontErrors(t *testing.T) {
+	if _, err := SubsetFont(nil, "a"); err == nil {
+		t.Error("SubsetFont() with no data should return an error")
+	}
+
+	cff := append([]byte(nil), goregular.TTF...)
+	binary.BigEndian.PutUint32(cff, 0x4F54544F)
+	if _, err := SubsetFont(cff, "a"); err == nil {
+		t.Error("SubsetFont() with a CFF font should return an error")
+	}
+}
+
+func TestCompositeComponents(t *testing.T) {
+	// Composite header followed by two components: the first with word
+	// arguments and a scale, the second with byte arguments.
+	glyph := []byte{
+		0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x00, glyfArgsAreWords | glyfHaveScale | glyfMoreComponents, 0x00, 0x07, 0, 0, 0, 0, 0x40, 0x00,
+		0x00, 0x00, 0x00, 0x09, 0, 0,
+	}
+	got, err := compositeComponents(glyph)
+	if err != nil {
+		t.Fatalf("compositeComponents() should not error, got: %v", err)
+	}
+	if len(got) != 2 || got[0] != 7 || got[1] != 9 {
+		t.Errorf("compositeComponents() = %v, want [7 9]", got)
+	}
+
+	if _, err := compositeComponents(glyph[:16]); err == nil {
+		t.Error("compositeComponents() with a truncated glyph should return an error")
+	}
+	if got, _ := compositeComponents([]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0}); got != nil {
+		t.Errorf("compositeComponents() of a simple glyph = %v, want nil", got)
+	}
+}
@@ -1,12 +1,18 @@
 package gopiq
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"strings"
+
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // Registers lossy and lossless WebP decoding
 )
 
 // ImageFormat represents supported image output formats.
@@ -16,9 +22,25 @@ const (
 	FormatUnknown ImageFormat = iota
 	FormatJPEG
 	FormatPNG
-	FormatGIF // Can decode, but encoding to Paletted/GIF requires more work than current scope.
+	FormatGIF  // Can decode; animations are encoded with ToAnimatedGIF, not ToBytes.
+	FormatWebP // Lossy and lossless; see WithWebPQuality and WithWebPLossless.
+	FormatAVIF // Detected, but no built-in codec; see RegisterEncoder and WithCodecFallback.
+	FormatPGM  // Netpbm graymap; keeps grayscale pipelines at 1 byte per pixel.
+	FormatTIFF // First page; see FromTIFFPage, ForEachTIFFPage and WithTIFFCompression.
+	FormatICO  // Decodes the largest image; encodes several sizes, see WithICOSizes.
+	FormatHEIC // Detected, but no built-in codec; see RegisterDecoder and RegisterEncoder.
+	FormatJXL  // JPEG XL; detected, but no built-in codec; see RegisterDecoder and RegisterEncoder.
+	FormatPPM  // Netpbm pixmap; 8 or 16 bits per sample, without alpha.
+	FormatPBM  // Netpbm bitmap; black and white, split at mid gray.
+	FormatTGA  // Targa; uncompressed or run-length encoded, see WithTGARLE.
 )
 
+// ErrUnsupportedFormat is returned (wrapped) when no encoder is available for
+// the requested format on this build, built in or registered with
+// RegisterEncoder. WithCodecFallback uses it to decide
+// when to try the next format.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
 // String returns the string representation of the ImageFormat.
 func (f ImageFormat) String() string {
 	switch f {
@@ -28,11 +50,53 @@ func (f ImageFormat) String() string {
 		return "png"
 	case FormatGIF:
 		return "gif"
+	case FormatWebP:
+		return "webp"
+	case FormatAVIF:
+		return "avif"
+	case FormatPGM:
+		return "pgm"
+	case FormatTIFF:
+		return "tiff"
+	case FormatICO:
+		return "ico"
+	case FormatHEIC:
+		return "heic"
+	case FormatJXL:
+		return "jxl"
+	case FormatPPM:
+		return "ppm"
+	case FormatPBM:
+		return "pbm"
+	case FormatTGA:
+		return "tga"
 	default:
 		return "unknown"
 	}
 }
 
+// MIMEType returns the media type of the ImageFormat, e.g. for a
+// Content-Type header or a data URI, or "application/octet-stream" for
+// FormatUnknown.
+func (f ImageFormat) MIMEType() string {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP, FormatAVIF, FormatTIFF, FormatHEIC, FormatJXL:
+		return "image/" + f.String()
+	case FormatPGM:
+		return "image/x-portable-graymap"
+	case FormatPPM:
+		return "image/x-portable-pixmap"
+	case FormatPBM:
+		return "image/x-portable-bitmap"
+	case FormatICO:
+		return "image/x-icon"
+	case FormatTGA:
+		return "image/x-tga"
+	default:
+		return "application/octet-stream"
+	}
+}
+
 // FormatFromString converts a string to an ImageFormat.
 func FormatFromString(s string) ImageFormat {
 	switch strings.ToLower(s) {
@@ -42,35 +106,237 @@ func FormatFromString(s string) ImageFormat {
 		return FormatPNG
 	case "gif":
 		return FormatGIF
+	case "webp":
+		return FormatWebP
+	case "avif":
+		return FormatAVIF
+	case "pgm":
+		return FormatPGM
+	case "tiff", "tif":
+		return FormatTIFF
+	case "ico":
+		return FormatICO
+	case "heic", "heif":
+		return FormatHEIC
+	case "jxl":
+		return FormatJXL
+	case "ppm":
+		return FormatPPM
+	case "pbm":
+		return FormatPBM
+	case "tga":
+		return FormatTGA
 	default:
 		return FormatUnknown
 	}
 }
 
-// decodeImage decodes an image from an io.Reader.
+// DetectFormat identifies the format of encoded image data from its
+// signature, e.g. to pick a Content-Type after encoding with
+// WithCodecFallback. Returns FormatUnknown if the signature is not
+// recognized.
+func DetectFormat(data []byte) ImageFormat {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return FormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return FormatGIF
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "avif" || string(data[8:12]) == "avis"):
+		return FormatAVIF
+	case len(data) >= 3 && data[0] == 'P' && data[1] >= '1' && data[1] <= '6' && strings.ContainsRune(" \t\r\n", rune(data[2])):
+		return [...]ImageFormat{FormatPBM, FormatPGM, FormatPPM}[(data[1]-'1')%3]
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return FormatTIFF
+	case len(data) >= 6 && string(data[:4]) == "\x00\x00\x01\x00" && (data[4] != 0 || data[5] != 0):
+		return FormatICO
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && strings.Contains("heic heix hevc hevx heim heis", string(data[8:12])):
+		return FormatHEIC
+	case bytes.HasPrefix(data, []byte("\xff\x0a")) || bytes.HasPrefix(data, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")):
+		return FormatJXL
+	case isTGA(data):
+		return FormatTGA
+	default:
+		return FormatUnknown
+	}
+}
+
+// ImageInfo describes an encoded image without decoding its pixels.
+type ImageInfo struct {
+	Width  int
+	Height int
+	Format ImageFormat
+}
+
+// ProbeReaderAt reads only the header of the size-byte image available
+// through r and reports its dimensions and format. Only the bytes up to the
+// image dimensions are requested (typically a few kilobytes), so remote
+// objects can be inspected with ranged reads before deciding to fetch them.
+// Formats decoded by a RegisterDecoder codec are read and decoded in full.
+// Returns an error if r is nil, size is not positive or the header cannot be
+// parsed.
+func ProbeReaderAt(r io.ReaderAt, size int64) (ImageInfo, error) {
+	if r == nil {
+		return ImageInfo{}, fmt.Errorf("reader cannot be nil")
+	}
+	if size <= 0 {
+		return ImageInfo{}, fmt.Errorf("input size must be positive (got: %d)", size)
+	}
+	head := make([]byte, min(size, 32))
+	n, _ := r.ReadAt(head, 0)
+	format := DetectFormat(head[:n])
+	if _, ok := registeredDecoder(format); ok {
+		img, err := decodeImage(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return ImageInfo{}, err
+		}
+		return ImageInfo{Width: img.Bounds().Dx(), Height: img.Bounds().Dy(), Format: format}, nil
+	}
+	if format == FormatTGA {
+		h, err := parseTGAHeader(head[:n])
+		if err != nil {
+			return ImageInfo{}, fmt.Errorf("failed to decode image header: %w", err)
+		}
+		return ImageInfo{Width: h.width, Height: h.height, Format: format}, nil
+	}
+	if format == FormatTIFF {
+		// The IFD can be anywhere in the file; read it in place rather than
+		// through image.DecodeConfig, which buffers everything up to it.
+		cfg, err := tiff.DecodeConfig(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return ImageInfo{}, fmt.Errorf("failed to decode image header: %w", err)
+		}
+		return ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+	}
+	cfg, name, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	return ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: FormatFromString(name)}, nil
+}
+
+// decodeImage decodes an image from an io.Reader, with the RegisterDecoder
+// codec for its format if there is one.
 func decodeImage(r io.Reader) (image.Image, error) {
-	img, _, err := image.Decode(r)
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(32)
+	format := DetectFormat(head)
+	decode, ok := registeredDecoder(format)
+	if !ok && format == FormatTGA {
+		// TGA has no signature for image.Decode to recognize.
+		decode, ok = decodeTGA, true
+	}
+	if ok {
+		img, err := decode(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s image: %w", format, err)
+		}
+		return img, nil
+	}
+	if format == FormatTIFF {
+		return decodeTIFF(r, br)
+	}
+	img, name, err := image.Decode(br)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	if name == "webp" {
+		if img, err = webpToRGBA(img); err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+	}
 	return img, nil
 }
 
-// encodeImage encodes an image to an io.Writer in the specified format.
+// decodeTIFF decodes a TIFF from r, or from everything in br if r has no
+// random access. x/image/tiff buffers a plain io.Reader up to each offset
+// it follows, so a corrupt offset would allocate gigabytes; with an
+// io.ReaderAt it fails with io.EOF instead.
+func decodeTIFF(r io.Reader, br *bufio.Reader) (image.Image, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image: %w", err)
+		}
+		ra = bytes.NewReader(data)
+	}
+	img, err := tiff.Decode(io.NewSectionReader(ra, 0, 1<<63-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// encodeImage encodes an image to an io.Writer in the specified format with
+// default settings.
 func encodeImage(w io.Writer, img image.Image, format ImageFormat) error {
 	switch format {
 	case FormatJPEG:
-		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90}) // Default JPEG quality 90
+		return encodeJPEG(w, img, 0, false, JPEGSubsampling420)
 	case FormatPNG:
-		return png.Encode(w, img)
+		return encodePNG(w, img, png.DefaultCompression, PNGFilterDefault, 0)
+	case FormatPGM:
+		return encodePGM(w, img)
+	case FormatPPM:
+		return encodePPM(w, img)
+	case FormatPBM:
+		return encodePBM(w, img)
 	case FormatGIF:
-		// GIF encoding requires image.Paletted. Converting an arbitrary image.Image
-		// to image.Paletted (e.g., quantizing colors) requires external libraries
-		// beyond golang.org/x, or a complex manual implementation of color quantization.
-		return fmt.Errorf("GIF encoding is not directly supported without 3rd-party color quantization")
+		// GIF encoding requires image.Paletted, and quantizing colors needs
+		// choices (palette size, dithering) ToBytes has no options for; GIFs
+		// are written with ToAnimatedGIF or AnimationProcessor.ToGIF instead.
+		return fmt.Errorf("%w: GIF encoding is not directly supported without 3rd-party color quantization", ErrUnsupportedFormat)
 	default:
-		return fmt.Errorf("unsupported image format for encoding: %s", format.String())
+		return fmt.Errorf("%w for encoding: %s", ErrUnsupportedFormat, format.String())
+	}
+}
+
+// encodeJPEG encodes img as a baseline or progressive JPEG with the given
+// chroma subsampling; a quality of 0 means the default.
+func encodeJPEG(w io.Writer, img image.Image, quality int, progressive bool, subsampling JPEGSubsampling) error {
+	if quality == 0 {
+		quality = defaultJPEGQuality
+	}
+	if quality < 1 || quality > 100 {
+		return fmt.Errorf("invalid JPEG quality %d: must be between 1 and 100", quality)
+	}
+	if subsampling < JPEGSubsampling420 || subsampling > JPEGSubsampling444 {
+		return fmt.Errorf("invalid JPEG chroma subsampling %d", subsampling)
+	}
+	// image/jpeg writes baseline 4:2:0 only.
+	if progressive || subsampling != JPEGSubsampling420 {
+		return encodeOwnJPEG(w, img, quality, subsampling, progressive)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// encodePNG encodes img as a PNG at a compression level of the image/png
+// package, with image/png unless a filter is chosen. A nonzero colors
+// quantizes it to an indexed PNG-8 first.
+func encodePNG(w io.Writer, img image.Image, level png.CompressionLevel, filter PNGFilter, colors int) error {
+	switch level {
+	case png.DefaultCompression, png.NoCompression, png.BestSpeed, png.BestCompression:
+	default:
+		return fmt.Errorf("invalid PNG compression level %d", level)
+	}
+	if filter < PNGFilterDefault || filter > PNGFilterAdaptive {
+		return fmt.Errorf("invalid PNG filter %d", filter)
+	}
+	if colors != 0 {
+		if colors < 2 || colors > 256 {
+			return fmt.Errorf("PNG colors must be between 2 and 256 (got: %d)", colors)
+		}
+		img = pngPaletted(img, colors)
+	}
+	if filter != PNGFilterDefault {
+		return encodeFilteredPNG(w, img, level, filter)
 	}
+	enc := png.Encoder{CompressionLevel: level}
+	return enc.Encode(w, img)
 }
 
 // newRGBA creates a new RGBA image with the given bounds.
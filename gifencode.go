@@ -0,0 +1,461 @@
+package gopiq
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// gifConfig holds the options of ToAnimatedGIF and AnimationProcessor.ToGIF.
+type gifConfig struct {
+	Colors        int
+	GlobalPalette bool
+	Palette       color.Palette
+	Dither        bool
+	LoopCount     int
+}
+
+// GIFOption is a functional option for GIF encoding.
+type GIFOption func(*gifConfig)
+
+func defaultGIFConfig() *gifConfig {
+	return &gifConfig{Colors: 256}
+}
+
+// WithGIFColors sets the largest number of colors in a palette, from 2 to
+// 256 (the default). Fewer colors give smaller files. One color is taken
+// for transparency if a frame has transparent pixels.
+func WithGIFColors(n int) GIFOption {
+	return func(gc *gifConfig) { gc.Colors = n }
+}
+
+// WithGlobalPalette quantizes all frames to one palette stored once in the
+// file, instead of a palette per frame (the default). It keeps files small
+// and avoids color shifts between frames when the frames look alike, such
+// as in a timelapse.
+func WithGlobalPalette() GIFOption {
+	return func(gc *gifConfig) { gc.GlobalPalette = true }
+}
+
+// WithGIFPalette uses p, e.g. palette.Plan9 or brand colors, as the global
+// palette instead of choosing colors from the frames.
+func WithGIFPalette(p color.Palette) GIFOption {
+	return func(gc *gifConfig) { gc.Palette = p }
+}
+
+// WithGIFDithering controls Floyd-Steinberg dithering, which hides banding
+// in gradients and photos with few colors. It is off by default, because it
+// makes still areas flicker between frames and compresses worse.
+func WithGIFDithering(on bool) GIFOption {
+	return func(gc *gifConfig) { gc.Dither = on }
+}
+
+// WithLoopCount sets how often the animation repeats, as in image/gif: 0
+// loops forever, -1 plays it once and n > 0 plays it n+1 times.
+// ToAnimatedGIF loops forever by default; AnimationProcessor.ToGIF keeps
+// the decoded loop count.
+func WithLoopCount(n int) GIFOption {
+	return func(gc *gifConfig) { gc.LoopCount = n }
+}
+
+// validate checks the GIF options.
+func (gc *gifConfig) validate() error {
+	if gc.Palette != nil {
+		if len(gc.Palette) == 0 || len(gc.Palette) > 256 {
+			return fmt.Errorf("GIF palette must have 1 to 256 colors (got: %d)", len(gc.Palette))
+		}
+		if slices.Contains(gc.Palette, nil) {
+			return fmt.Errorf("GIF palette cannot contain nil colors")
+		}
+		return nil
+	}
+	if gc.Colors < 2 || gc.Colors > 256 {
+		return fmt.Errorf("GIF colors must be between 2 and 256 (got: %d)", gc.Colors)
+	}
+	return nil
+}
+
+// gifTransparent is the alpha below which a pixel is written as transparent;
+// GIF has no partial transparency.
+const gifTransparent = 128
+
+// colorBox is a box of the RGB histogram split by median cut.
+type colorBox struct {
+	bins  []int // Histogram bins, as r<<10 | g<<5 | b of the top 5 bits
+	count uint64
+}
+
+// colorHistogram counts the opaque pixels of some images in bins of 5 bits
+// per channel, keeping the channel sums for the average of each bin.
+type colorHistogram struct {
+	count            [1 << 15]uint64
+	sumR, sumG, sumB [1 << 15]uint64
+}
+
+// add counts the opaque pixels of img, sampling large images. It reports
+// whether img has transparent pixels.
+func (h *colorHistogram) add(img *image.RGBA) (transparent bool) {
+	step := max(1, len(img.Pix)/4/(1<<18))
+	for i := 0; i < len(img.Pix); i += 4 * step {
+		p := img.Pix[i : i+4 : i+4]
+		if p[3] < gifTransparent {
+			transparent = true
+			continue
+		}
+		r, g, b := unpremultiply(p[0], p[3]), unpremultiply(p[1], p[3]), unpremultiply(p[2], p[3])
+		bin := int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+		h.count[bin]++
+		h.sumR[bin] += uint64(r)
+		h.sumG[bin] += uint64(g)
+		h.sumB[bin] += uint64(b)
+	}
+	if step > 1 && !transparent {
+		// Sampling can miss a few transparent pixels.
+		for i := 3; i < len(img.Pix); i += 4 {
+			if img.Pix[i] < gifTransparent {
+				return true
+			}
+		}
+	}
+	return transparent
+}
+
+// palette chooses at most n colors for the histogram by median cut: the box
+// with the most pixels is split at the median of its widest channel until
+// there are n boxes, and each box gives the average color of its pixels.
+func (h *colorHistogram) palette(n int) color.Palette {
+	root := colorBox{}
+	for bin, c := range h.count {
+		if c > 0 {
+			root.bins = append(root.bins, bin)
+			root.count += c
+		}
+	}
+	if len(root.bins) == 0 {
+		return nil
+	}
+	boxes := []colorBox{root}
+	for len(boxes) < n {
+		best := -1
+		for i, b := range boxes {
+			if len(b.bins) > 1 && (best < 0 || b.count > boxes[best].count) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		lo, hi := h.split(boxes[best])
+		boxes[best] = lo
+		boxes = append(boxes, hi)
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		var r, g, bl uint64
+		for _, bin := range b.bins {
+			r += h.sumR[bin]
+			g += h.sumG[bin]
+			bl += h.sumB[bin]
+		}
+		p[i] = color.RGBA{uint8((r + b.count/2) / b.count), uint8((g + b.count/2) / b.count), uint8((bl + b.count/2) / b.count), 255}
+	}
+	return p
+}
+
+// split divides b in two at the pixel median of its widest channel.
+func (h *colorHistogram) split(b colorBox) (colorBox, colorBox) {
+	shift := 0
+	widest := -1
+	for _, s := range []int{10, 5, 0} {
+		lo, hi := 31, 0
+		for _, bin := range b.bins {
+			v := bin >> s & 31
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > widest {
+			shift, widest = s, hi-lo
+		}
+	}
+	slices.SortFunc(b.bins, func(x, y int) int { return x>>shift&31 - y>>shift&31 })
+
+	// Cut after the bin holding the median pixel, leaving both halves with
+	// at least one bin.
+	var seen uint64
+	cut := 1
+	for i, bin := range b.bins[:len(b.bins)-1] {
+		seen += h.count[bin]
+		cut = i + 1
+		if seen*2 >= b.count {
+			break
+		}
+	}
+	lo := colorBox{bins: b.bins[:cut:cut], count: seen}
+	hi := colorBox{bins: b.bins[cut:], count: b.count - seen}
+	return lo, hi
+}
+
+// quantize returns a palette of at most n colors for the frames, with a
+// transparent color last if some frame has transparent pixels.
+func quantize(frames []*image.RGBA, n int) color.Palette {
+	h := new(colorHistogram)
+	transparent := false
+	for _, img := range frames {
+		transparent = h.add(img) || transparent
+	}
+	if transparent {
+		n--
+	}
+	p := h.palette(max(1, n))
+	if len(p) == 0 {
+		// A fully transparent image still needs an opaque color to dither to.
+		p = color.Palette{color.RGBA{0, 0, 0, 255}}
+	}
+	if transparent {
+		p = append(p, color.RGBA{})
+	}
+	return p
+}
+
+// paletted maps img to the palette p. Pixels below gifTransparent alpha take
+// the transparent color of p if it has one.
+func paletted(img *image.RGBA, p color.Palette, dither bool) *image.Paletted {
+	opaque, transparent := p, -1
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	if transparent >= 0 {
+		opaque = slices.Delete(slices.Clone(p), transparent, transparent+1)
+	}
+	if len(opaque) == 0 {
+		out := image.NewPaletted(img.Rect, p)
+		for i := range out.Pix {
+			out.Pix[i] = uint8(transparent)
+		}
+		return out
+	}
+
+	// Map against the opaque colors only, so transparency never stands in
+	// for a dark color; then fix up the indices to those of p.
+	out := image.NewPaletted(img.Rect, opaque)
+	if dither {
+		flat := newRGBA(img.Rect)
+		draw.Draw(flat, flat.Rect, img, img.Rect.Min, draw.Src)
+		for i := 0; i < len(flat.Pix); i += 4 {
+			px := flat.Pix[i : i+4 : i+4]
+			if a := px[3]; a != 255 {
+				px[0], px[1], px[2], px[3] = unpremultiply(px[0], a), unpremultiply(px[1], a), unpremultiply(px[2], a), 255
+			}
+		}
+		draw.FloydSteinberg.Draw(out, img.Rect, flat, img.Rect.Min)
+	} else {
+		cache := make(map[[3]uint8]uint8)
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+			dst := out.Pix[out.PixOffset(img.Rect.Min.X, y):]
+			for x := range img.Rect.Dx() {
+				px := row[4*x : 4*x+4 : 4*x+4]
+				key := [3]uint8{unpremultiply(px[0], px[3]), unpremultiply(px[1], px[3]), unpremultiply(px[2], px[3])}
+				index, ok := cache[key]
+				if !ok {
+					index = uint8(opaque.Index(color.RGBA{key[0], key[1], key[2], 255}))
+					cache[key] = index
+				}
+				dst[x] = index
+			}
+		}
+	}
+
+	out.Palette = p
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		dst := out.Pix[out.PixOffset(img.Rect.Min.X, y):]
+		for x := range img.Rect.Dx() {
+			switch {
+			case transparent >= 0 && row[4*x+3] < gifTransparent:
+				dst[x] = uint8(transparent)
+			case transparent >= 0 && int(dst[x]) >= transparent:
+				dst[x]++
+			}
+		}
+	}
+	return out
+}
+
+// commonPalette returns the palette used by the most frames, or nil if no
+// two frames share one.
+func commonPalette(frames []*image.Paletted) color.Palette {
+	var best color.Palette
+	bestCount := 1
+	for i, f := range frames {
+		count := 1
+		for _, other := range frames[i+1:] {
+			if slices.Equal(f.Palette, other.Palette) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = f.Palette, count
+		}
+	}
+	return best
+}
+
+// encodeGIF quantizes and encodes frames on a canvas of the given size.
+func encodeGIF(frames []Frame, size image.Point, loopCount int, cfg *gifConfig) ([]byte, error) {
+	canvas := image.Rectangle{Max: size}
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames)),
+		Delay:     make([]int, len(frames)),
+		Disposal:  make([]byte, len(frames)),
+		LoopCount: loopCount,
+		Config:    image.Config{Width: size.X, Height: size.Y},
+	}
+	rgba := make([]*image.RGBA, len(frames))
+	for i, f := range frames {
+		if !f.Image.Bounds().In(canvas) || f.Image.Bounds().Empty() {
+			return nil, fmt.Errorf("frame %d bounds %v are not within the canvas %v", i, f.Image.Bounds(), canvas)
+		}
+		if f.Delay < 0 {
+			return nil, fmt.Errorf("frame %d delay cannot be negative (got: %d)", i, f.Delay)
+		}
+		g.Delay[i] = f.Delay
+		g.Disposal[i] = byte(f.Disposal)
+		if p, ok := f.Image.(*image.Paletted); ok && cfg.Palette == nil && !cfg.GlobalPalette && len(p.Palette) <= cfg.Colors {
+			// Decoded GIF frames keep their palette and pixels as they are.
+			g.Image[i] = p
+			continue
+		}
+		img := newRGBA(f.Image.Bounds())
+		draw.Draw(img, img.Rect, f.Image, img.Rect.Min, draw.Src)
+		rgba[i] = img
+	}
+
+	var global color.Palette
+	switch {
+	case cfg.Palette != nil:
+		global = cfg.Palette
+	case cfg.GlobalPalette:
+		global = quantize(rgba, cfg.Colors)
+	}
+	for i, img := range rgba {
+		if img == nil {
+			continue
+		}
+		p := global
+		if p == nil {
+			p = quantize(rgba[i:i+1], cfg.Colors)
+		}
+		g.Image[i] = paletted(img, p, cfg.Dither)
+	}
+	if global == nil {
+		// Frames sharing a palette, such as those of a decoded GIF or of
+		// OptimizeGIF, leave it out of their own headers.
+		global = commonPalette(g.Image)
+	}
+	if global != nil {
+		g.Config.ColorModel = global
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ToAnimatedGIF encodes frames as an animated GIF, e.g. a slideshow or a
+// timelapse, showing frame i for delays[i] hundredths of a second; nil
+// delays show every frame for 0.1 s. The frames are drawn at their bounds
+// on a canvas as large as their union with the origin, each replacing the
+// one before. Their colors are reduced to GIF palettes by median cut, per
+// frame unless WithGlobalPalette or WithGIFPalette is given, and pixels
+// that are less than half opaque become transparent. The animation loops
+// forever unless WithLoopCount says otherwise.
+// Returns an error if there are no frames, a frame is nil or empty, the
+// number of delays does not match, a delay is negative or an option is
+// invalid.
+func ToAnimatedGIF(frames []image.Image, delays []int, opts ...GIFOption) ([]byte, error) {
+	cfg := defaultGIFConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("animation has no frames")
+	}
+	if delays != nil && len(delays) != len(frames) {
+		return nil, fmt.Errorf("got %d delays for %d frames", len(delays), len(frames))
+	}
+
+	var size image.Point
+	fs := make([]Frame, len(frames))
+	for i, img := range frames {
+		if img == nil {
+			return nil, fmt.Errorf("frame %d cannot be nil", i)
+		}
+		if img.Bounds().Min.X < 0 || img.Bounds().Min.Y < 0 {
+			return nil, fmt.Errorf("frame %d bounds %v cannot be negative", i, img.Bounds())
+		}
+		size = image.Pt(max(size.X, img.Bounds().Max.X), max(size.Y, img.Bounds().Max.Y))
+		fs[i] = Frame{Image: img, Delay: 10, Disposal: DisposalBackground}
+		if delays != nil {
+			fs[i].Delay = delays[i]
+		}
+	}
+	return encodeGIF(fs, size, cfg.LoopCount, cfg)
+}
+
+// ToGIF encodes the animation as a GIF with the delays, disposal methods
+// and loop count of its frames; see ToAnimatedGIF for the options.
+// Returns an error if any previous operation in the chain failed, the
+// animation has no frames or an option is invalid.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) ToGIF(opts ...GIFOption) ([]byte, error) {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+
+	if ap.err != nil {
+		return nil, ap.err
+	}
+	cfg := defaultGIFConfig()
+	cfg.LoopCount = ap.loopCount
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(ap.frames) == 0 {
+		return nil, fmt.Errorf("animation has no frames")
+	}
+
+	frames := ap.frames
+	if slices.ContainsFunc(frames, func(f Frame) bool { return f.Blend == BlendSource }) {
+		// GIF frames are always drawn over the ones before, so frames that
+		// replace their area, as in WebP, are drawn in full.
+		frames = coalescedFrames(frames, ap.canvas)
+	}
+	// Frames are stored at their canvas position, which starts at the origin
+	// after decoding and processing.
+	if ap.canvas.Min != (image.Point{}) {
+		moved := make([]Frame, len(frames))
+		for i, f := range frames {
+			img := newRGBA(f.Image.Bounds().Sub(ap.canvas.Min))
+			draw.Draw(img, img.Rect, f.Image, f.Image.Bounds().Min, draw.Src)
+			moved[i] = Frame{Image: img, Delay: f.Delay, Disposal: f.Disposal}
+		}
+		frames = moved
+	}
+	return encodeGIF(frames, ap.canvas.Size(), cfg.LoopCount, cfg)
+}
@@ -0,0 +1,209 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// gradientImage returns a w×h image that runs from black to red across and
+// from black to blue down.
+func gradientImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / max(1, w-1)), 64, uint8(y * 255 / max(1, h-1)), 255})
+		}
+	}
+	return img
+}
+
+func TestToAnimatedGIF(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	frames := []image.Image{createUniformImage(16, 8, red), createUniformImage(16, 8, blue), gradientImage(16, 8)}
+
+	data, err := ToAnimatedGIF(frames, []int{5, 10, 15}, WithLoopCount(3))
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() should not error, got: %v", err)
+	}
+	ap := FromBytesAnimated(data)
+	decoded, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("FromBytesAnimated() on the encoded GIF should not error, got: %v", err)
+	}
+	if len(decoded) != 3 || ap.Size() != image.Pt(16, 8) || ap.LoopCount() != 3 {
+		t.Fatalf("encoded GIF has %d frames of %v looping %d times, want 3 of (16,8) looping 3 times", len(decoded), ap.Size(), ap.LoopCount())
+	}
+	for i, want := range []int{5, 10, 15} {
+		if decoded[i].Delay != want {
+			t.Errorf("frame %d delay = %d, want %d", i, decoded[i].Delay, want)
+		}
+	}
+	if got := color.RGBAModel.Convert(decoded[0].Image.At(3, 3)); got != red {
+		t.Errorf("frame 0 = %v, want %v", got, red)
+	}
+	if got := color.RGBAModel.Convert(decoded[1].Image.At(3, 3)); got != blue {
+		t.Errorf("frame 1 = %v, want %v", got, blue)
+	}
+	// The gradient has few enough colors to come through nearly unchanged.
+	src := frames[2].(*image.RGBA)
+	r, g, b, _ := decoded[2].Image.At(15, 7).RGBA()
+	want := src.RGBAAt(15, 7)
+	if abs(int(r>>8)-int(want.R)) > 12 || abs(int(g>>8)-int(want.G)) > 12 || abs(int(b>>8)-int(want.B)) > 12 {
+		t.Errorf("frame 2 at (15,7) = %d,%d,%d, want close to %v", r>>8, g>>8, b>>8, want)
+	}
+
+	// Nil delays show each frame for 0.1 s and loop forever.
+	data, err = ToAnimatedGIF(frames[:2], nil)
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() with nil delays should not error, got: %v", err)
+	}
+	g2, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g2.Delay[0] != 10 || g2.LoopCount != 0 {
+		t.Errorf("default delay %d and loop count %d, want 10 and 0", g2.Delay[0], g2.LoopCount)
+	}
+}
+
+func TestToAnimatedGIFPalettes(t *testing.T) {
+	greener := gradientImage(64, 64)
+	for i := 1; i < len(greener.Pix); i += 4 {
+		greener.Pix[i] = 160
+	}
+	frames := []image.Image{gradientImage(64, 64), greener}
+
+	data, err := ToAnimatedGIF(frames, nil, WithGIFColors(16))
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() with 16 colors should not error, got: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range g.Image {
+		if n := len(img.Palette); n > 16 || n < 8 {
+			t.Errorf("frame %d has %d colors, want up to 16 chosen from the frame", i, n)
+		}
+	}
+
+	global, err := ToAnimatedGIF(frames, nil, WithGIFColors(16), WithGlobalPalette())
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() with a global palette should not error, got: %v", err)
+	}
+	if len(global) >= len(data) {
+		t.Errorf("global palette GIF is %d bytes, want smaller than %d with a palette per frame", len(global), len(data))
+	}
+	g, err = gif.DecodeAll(bytes.NewReader(global))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := g.Config.ColorModel.(color.Palette); !ok || len(p) > 16 {
+		t.Errorf("global palette = %v, want up to 16 colors", g.Config.ColorModel)
+	}
+
+	dithered, err := ToAnimatedGIF(frames, nil, WithGIFPalette(palette.Plan9), WithGIFDithering(true))
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() with a fixed palette should not error, got: %v", err)
+	}
+	g, err = gif.DecodeAll(bytes.NewReader(dithered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image[0].Palette) != len(palette.Plan9) {
+		t.Errorf("fixed palette frame has %d colors, want %d", len(g.Image[0].Palette), len(palette.Plan9))
+	}
+}
+
+func TestToAnimatedGIFTransparency(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := range 10 {
+		for x := range 5 {
+			img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255}) // Opaque black next to transparent
+		}
+	}
+	data, err := ToAnimatedGIF([]image.Image{img}, nil, WithGIFColors(2))
+	if err != nil {
+		t.Fatalf("ToAnimatedGIF() with transparency should not error, got: %v", err)
+	}
+	frames, err := FromBytesAnimated(data).Frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := frames[0].Image.At(2, 2).RGBA(); a != 0xffff {
+		t.Errorf("opaque black pixel has alpha %d, want opaque", a>>8)
+	}
+	if _, _, _, a := frames[0].Image.At(7, 2).RGBA(); a != 0 {
+		t.Errorf("transparent pixel has alpha %d, want transparent", a>>8)
+	}
+}
+
+func TestAnimationToGIF(t *testing.T) {
+	data, err := FromBytesAnimated(testAnimatedGIF(t)).Apply(func(ip *ImageProcessor) *ImageProcessor {
+		return ip.Grayscale()
+	}).ToGIF()
+	if err != nil {
+		t.Fatalf("ToGIF() should not error, got: %v", err)
+	}
+	ap := FromBytesAnimated(data)
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || ap.LoopCount() != 2 || ap.Size() != image.Pt(20, 10) {
+		t.Fatalf("re-encoded GIF has %d frames of %v looping %d times, want the original 3, (20,10) and 2", len(frames), ap.Size(), ap.LoopCount())
+	}
+	for i, want := range []int{10, 20, 30} {
+		if frames[i].Delay != want {
+			t.Errorf("frame %d delay = %d, want %d", i, frames[i].Delay, want)
+		}
+	}
+	if r, g, b, _ := frames[1].Image.At(12, 7).RGBA(); r != g || g != b {
+		t.Errorf("re-encoded frame 1 = %d,%d,%d, want gray", r>>8, g>>8, b>>8)
+	}
+
+	// Decoded frames keep their partial bounds and disposal.
+	data, err = FromBytesAnimated(testAnimatedGIF(t)).ToGIF(WithLoopCount(0))
+	if err != nil {
+		t.Fatalf("ToGIF() of decoded frames should not error, got: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Image[1].Rect != image.Rect(10, 5, 15, 10) || g.Disposal[2] != gif.DisposalPrevious || g.LoopCount != 0 {
+		t.Errorf("re-encoded frame 1 at %v, frame 2 disposal %d, loop count %d; want the originals and 0", g.Image[1].Rect, g.Disposal[2], g.LoopCount)
+	}
+}
+
+func TestToAnimatedGIFInvalidInput(t *testing.T) {
+	img := createTestImage(8, 8)
+
+	// Test case: Invalid input
+	cases := map[string]func() ([]byte, error){
+		"no frames": func() ([]byte, error) { return ToAnimatedGIF(nil, nil) },
+		"nil frame": func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img, nil}, nil) },
+		"empty frame": func() ([]byte, error) {
+			return ToAnimatedGIF([]image.Image{image.NewRGBA(image.Rect(0, 0, 0, 0))}, nil)
+		},
+		"delay mismatch":  func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img}, []int{1, 2}) },
+		"negative delay":  func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img}, []int{-1}) },
+		"one color":       func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img}, nil, WithGIFColors(1)) },
+		"too many colors": func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img}, nil, WithGIFColors(257)) },
+		"empty palette":   func() ([]byte, error) { return ToAnimatedGIF([]image.Image{img}, nil, WithGIFPalette(color.Palette{})) },
+		"nil palette color": func() ([]byte, error) {
+			return ToAnimatedGIF([]image.Image{img}, nil, WithGIFPalette(color.Palette{color.Black, nil}))
+		},
+		"previous error": func() ([]byte, error) { return FromBytesAnimated(nil).ToGIF() },
+	}
+	for name, encode := range cases {
+		if _, err := encode(); err == nil {
+			t.Errorf("%s should return an error", name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package gopiq
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// gifBinarize makes every pixel of img either transparent or opaque, as GIF
+// stores them.
+func gifBinarize(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		px := img.Pix[i : i+4 : i+4]
+		switch a := px[3]; {
+		case a < gifTransparent:
+			px[0], px[1], px[2], px[3] = 0, 0, 0, 0
+		case a != 255:
+			px[0], px[1], px[2], px[3] = unpremultiply(px[0], a), unpremultiply(px[1], a), unpremultiply(px[2], a), 255
+		}
+	}
+}
+
+// changedRect returns the bounds of the pixels that differ between prev and
+// cur, which have the same bounds, and of those among them that cur makes
+// transparent. Both images are binarized.
+func changedRect(prev, cur *image.RGBA) (changed, cleared image.Rectangle) {
+	r := cur.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := cur.PixOffset(r.Min.X, y)
+		a, b := prev.Pix[i:i+4*r.Dx()], cur.Pix[i:i+4*r.Dx()]
+		if bytes.Equal(a, b) {
+			continue
+		}
+		for x := range r.Dx() {
+			if bytes.Equal(a[4*x:4*x+4], b[4*x:4*x+4]) {
+				continue
+			}
+			px := image.Rect(r.Min.X+x, y, r.Min.X+x+1, y+1)
+			changed = changed.Union(px)
+			if b[4*x+3] == 0 {
+				cleared = cleared.Union(px)
+			}
+		}
+	}
+	return changed, cleared
+}
+
+// cropRGBA returns a copy of the part r of img.
+func cropRGBA(img *image.RGBA, r image.Rectangle) *image.RGBA {
+	out := newRGBA(r)
+	draw.Draw(out, r, img, r.Min, draw.Src)
+	return out
+}
+
+// exactPalette returns a palette holding every color of the images, or nil
+// if they have more than n colors.
+func exactPalette(imgs []*image.RGBA, n int) color.Palette {
+	seen := make(map[color.RGBA]bool)
+	var opaque color.Palette
+	transparent := false
+	for _, img := range imgs {
+		for i := 0; i < len(img.Pix); i += 4 {
+			c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			if c.A == 0 {
+				transparent = true
+			} else {
+				opaque = append(opaque, c)
+			}
+			if len(seen) > n {
+				return nil
+			}
+		}
+	}
+	if transparent {
+		opaque = append(opaque, color.RGBA{})
+	}
+	return opaque
+}
+
+// coversColors reports whether p holds every color of img exactly.
+func coversColors(p color.Palette, img *image.RGBA) bool {
+	colors := make(map[color.RGBA]bool, len(p))
+	for _, c := range p {
+		colors[color.RGBAModel.Convert(c).(color.RGBA)] = true
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		if !colors[color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}] {
+			return false
+		}
+	}
+	return true
+}
+
+// OptimizeGIF makes the animation smaller when written with ToGIF, e.g.
+// after Apply turned every frame into a full canvas: frames the same as the
+// one before are dropped and their delay added to it, every other frame is
+// cropped to the area that changed and drawn over the one before, and the
+// frames are quantized to palettes that are shared where the colors allow,
+// so the palette is stored once. If all frames fit in the palette size
+// together, their colors are kept exactly. It takes the color options of
+// ToGIF, which writes the optimized frames without quantizing them again.
+// As in a GIF, pixels that are less than half opaque become transparent.
+// Returns the AnimationProcessor for chaining. An error is set if the
+// animation has no frames or an option is invalid.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) OptimizeGIF(opts ...GIFOption) *AnimationProcessor {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if ap.err != nil {
+		return ap
+	}
+	cfg := defaultGIFConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		ap.err = err
+		return ap
+	}
+	if len(ap.frames) == 0 {
+		ap.err = fmt.Errorf("animation has no frames")
+		return ap
+	}
+
+	full := coalesce(ap.frames, ap.canvas)
+	for _, img := range full {
+		gifBinarize(img)
+	}
+
+	// kept holds the index in full of each output frame.
+	kept := []int{0}
+	frames := []Frame{{Delay: ap.frames[0].Delay, Disposal: DisposalNone}}
+	crops := []*image.RGBA{full[0]}
+	for i := 1; i < len(full); i++ {
+		last := len(frames) - 1
+		changed, cleared := changedRect(full[kept[last]], full[i])
+		if changed.Empty() {
+			frames[last].Delay += ap.frames[i].Delay
+			continue
+		}
+		if !cleared.Empty() {
+			// Only disposing of the frame before can make pixels
+			// transparent again: it clears its area, which this frame
+			// then draws again.
+			area := crops[last].Rect.Union(cleared)
+			crops[last] = cropRGBA(full[kept[last]], area)
+			frames[last].Disposal = DisposalBackground
+			changed = changed.Union(area)
+		}
+		kept = append(kept, i)
+		frames = append(frames, Frame{Delay: ap.frames[i].Delay, Disposal: DisposalNone})
+		crops = append(crops, cropRGBA(full[i], changed))
+	}
+
+	var shared color.Palette
+	switch {
+	case cfg.Palette != nil:
+		shared = cfg.Palette
+	case cfg.GlobalPalette:
+		shared = quantize(crops, cfg.Colors)
+	default:
+		shared = exactPalette(crops, cfg.Colors)
+	}
+	var prev color.Palette
+	for i, crop := range crops {
+		p := shared
+		if p == nil {
+			if prev == nil || !coversColors(prev, crop) {
+				prev = quantize(crops[i:i+1], cfg.Colors)
+			}
+			p = prev
+		}
+		frames[i].Image = paletted(crop, p, cfg.Dither)
+	}
+	ap.frames = frames
+	return ap
+}
@@ -0,0 +1,164 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// movingSquareGIF returns a 64×64 animation of a gradient with a 6×6 square
+// moving across it, with its third frame repeating the second.
+func movingSquareGIF(t *testing.T) []byte {
+	t.Helper()
+	var frames []image.Image
+	for _, x := range []int{4, 20, 20, 36} {
+		img := gradientImage(64, 64)
+		for y := 10; y < 16; y++ {
+			for dx := range 6 {
+				img.SetRGBA(x+dx, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+		frames = append(frames, img)
+	}
+	data, err := ToAnimatedGIF(frames, []int{10, 20, 30, 40}, WithGlobalPalette())
+	if err != nil {
+		t.Fatalf("failed to encode test GIF: %v", err)
+	}
+	return data
+}
+
+// shownFrames returns the frames of ap as they are shown.
+func shownFrames(t *testing.T, ap *AnimationProcessor) []Frame {
+	t.Helper()
+	frames, err := ap.Coalesce().Frames()
+	if err != nil {
+		t.Fatalf("Coalesce() should not error, got: %v", err)
+	}
+	return frames
+}
+
+func TestOptimizeGIF(t *testing.T) {
+	identity := func(ip *ImageProcessor) *ImageProcessor { return ip }
+	processed := FromBytesAnimated(movingSquareGIF(t)).Apply(identity)
+	plain, err := processed.ToGIF()
+	if err != nil {
+		t.Fatalf("ToGIF() should not error, got: %v", err)
+	}
+
+	optimized := FromBytesAnimated(movingSquareGIF(t)).Apply(identity).OptimizeGIF()
+	frames, err := optimized.Frames()
+	if err != nil {
+		t.Fatalf("OptimizeGIF() should not error, got: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("OptimizeGIF() kept %d frames, want 3 without the duplicate", len(frames))
+	}
+	if got, want := []int{frames[0].Delay, frames[1].Delay, frames[2].Delay}, []int{10, 50, 40}; !slices.Equal(got, want) {
+		t.Errorf("OptimizeGIF() delays = %v, want %v with the duplicate's delay added", got, want)
+	}
+	if got := frames[0].Image.Bounds(); got != image.Rect(0, 0, 64, 64) {
+		t.Errorf("first frame bounds = %v, want the canvas", got)
+	}
+	// The square moves from x=4 to x=20: the old and new square change.
+	if got := frames[1].Image.Bounds(); got != image.Rect(4, 10, 26, 16) {
+		t.Errorf("second frame bounds = %v, want the changed area (4,10)-(26,16)", got)
+	}
+
+	data, err := optimized.ToGIF()
+	if err != nil {
+		t.Fatalf("ToGIF() after OptimizeGIF() should not error, got: %v", err)
+	}
+	if len(data)*2 > len(plain) {
+		t.Errorf("optimized GIF is %d bytes, want at most half of the %d bytes unoptimized", len(data), len(plain))
+	}
+
+	// The animation looks the same, apart from the merged duplicate: its
+	// few colors are kept exactly.
+	want := shownFrames(t, processed)
+	got := shownFrames(t, FromBytesAnimated(data))
+	for i, j := range []int{0, 1, 3} {
+		a, b := want[j].Image.(*image.RGBA), got[i].Image.(*image.RGBA)
+		if !bytes.Equal(a.Pix, b.Pix) {
+			t.Errorf("optimized frame %d differs from frame %d of the original", i, j)
+		}
+	}
+}
+
+func TestOptimizeGIFTransparency(t *testing.T) {
+	// A red square moving right over a transparent canvas leaves transparent
+	// pixels behind, which only disposal can bring back.
+	var frames []image.Image
+	for _, x := range []int{0, 4} {
+		img := image.NewRGBA(image.Rect(0, 0, 12, 6))
+		for y := range 6 {
+			for dx := range 6 {
+				img.SetRGBA(x+dx, y, color.RGBA{255, 0, 0, 255})
+			}
+		}
+		frames = append(frames, img)
+	}
+	data, err := ToAnimatedGIF(frames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized := FromBytesAnimated(data).Apply(func(ip *ImageProcessor) *ImageProcessor { return ip }).OptimizeGIF()
+	out, err := optimized.Frames()
+	if err != nil {
+		t.Fatalf("OptimizeGIF() should not error, got: %v", err)
+	}
+	if out[0].Disposal != DisposalBackground {
+		t.Errorf("frame before the cleared pixels has disposal %d, want DisposalBackground", out[0].Disposal)
+	}
+	shown := shownFrames(t, optimized)
+	if _, _, _, a := shown[1].Image.At(1, 1).RGBA(); a != 0 {
+		t.Errorf("pixel left behind by the square has alpha %d, want transparent", a>>8)
+	}
+	if got := color.RGBAModel.Convert(shown[1].Image.At(8, 1)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("moved square = %v, want red", got)
+	}
+}
+
+func TestOptimizeGIFPalettes(t *testing.T) {
+	// Few colors in total: one exact palette for every frame.
+	frames, err := FromBytesAnimated(testAnimatedGIF(t)).OptimizeGIF().Frames()
+	if err != nil {
+		t.Fatalf("OptimizeGIF() should not error, got: %v", err)
+	}
+	first := frames[0].Image.(*image.Paletted).Palette
+	for i, f := range frames {
+		p, ok := f.Image.(*image.Paletted)
+		if !ok || !slices.Equal(p.Palette, first) {
+			t.Errorf("frame %d does not use the shared palette", i)
+		}
+	}
+
+	// Too many colors for one exact palette: the frames are quantized.
+	photo := gradientImage(40, 40)
+	same := gradientImage(40, 40)
+	same.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+	data, err := ToAnimatedGIF([]image.Image{photo, same}, nil, WithGIFColors(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err = FromBytesAnimated(data).Apply(func(ip *ImageProcessor) *ImageProcessor { return ip }).OptimizeGIF(WithGIFColors(64)).Frames()
+	if err != nil {
+		t.Fatalf("OptimizeGIF() with 64 colors should not error, got: %v", err)
+	}
+	for i, f := range frames {
+		if n := len(f.Image.(*image.Paletted).Palette); n > 64 {
+			t.Errorf("frame %d has %d colors, want at most 64", i, n)
+		}
+	}
+}
+
+func TestOptimizeGIFInvalidInput(t *testing.T) {
+	// Test case: Invalid input
+	if err := FromBytesAnimated(testAnimatedGIF(t)).OptimizeGIF(WithGIFColors(1)).Err(); err == nil {
+		t.Error("OptimizeGIF() with invalid options should return an error")
+	}
+	if err := FromBytesAnimated(nil).OptimizeGIF().Err(); err == nil {
+		t.Error("OptimizeGIF() should keep the previous error")
+	}
+}
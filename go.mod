@@ -2,6 +2,9 @@ module github.com/TamasGorgics/gopiq
 
 go 1.24.0
 
-require golang.org/x/image v0.28.0
-
-require golang.org/x/text v0.26.0 // indirect
+require (
+	github.com/go-text/typesetting v0.2.1
+	golang.org/x/image v0.28.0
+	golang.org/x/sync v0.15.0
+	golang.org/x/text v0.26.0
+)
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"io"
+	"io/fs"
+	"math"
 	"runtime"
+	"slices"
 	"sync"
 
 	"golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/gofont/goregular" // A basic font for demonstration
-	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -19,10 +22,16 @@ import (
 // and any error that occurred during a chainable operation.
 // It is safe for concurrent use by multiple goroutines.
 type ImageProcessor struct {
-	mu           sync.RWMutex // Protects currentImage and err from concurrent access
+	mu           opMutex // Protects currentImage and err from concurrent access
 	currentImage image.Image
 	err          error // Stores the first error in a chain
 	perfOpts     PerformanceOptions
+	encOpts      EncodeOptions // Defaults for ToBytes, extended by per-call options
+	history      []string      // Names of the operations applied so far
+	timings      []OpTiming    // Timing of the operations applied so far
+	size         image.Point   // Size of currentImage after the last operation, for timings
+	meta         imageMetadata // EXIF and XMP of the decoded image, for WithKeepMetadata
+	upright      bool          // AutoOrient made the pixels upright, so the EXIF orientation no longer applies
 }
 
 // WatermarkPosition defines common positions for the watermark.
@@ -38,16 +47,48 @@ const (
 
 // watermarkConfig holds configuration for adding text watermark.
 type watermarkConfig struct {
-	Text      string
-	FontPath  string  // Optional: path to .ttf or .otf font file
-	FontBytes []byte  // Optional: raw font bytes (preferred for embedding)
-	FontSize  float64 // Font size in points
-	Color     color.Color
-	Position  WatermarkPosition
-	OffsetX   float64 // Offset from chosen position
-	OffsetY   float64
+	Text        string
+	FontPath    string   // Optional: path to .ttf or .otf font file
+	FontFS      fs.FS    // Optional: file system FontPath is read from instead of the OS one
+	FontBytes   []byte   // Optional: raw font bytes (preferred for embedding)
+	FontName    string   // Optional: font registered with RegisterFont; overrides FontBytes
+	Fallbacks   [][]byte // Fonts for glyphs missing from the font, in order
+	FontSize    float64  // Font size in points
+	Color       color.Color
+	Position    WatermarkPosition
+	OffsetX     float64 // Offset from chosen position
+	OffsetY     float64
+	Vertical    bool           // Lay text out top-to-bottom (CJK vertical writing mode)
+	Tile        *WatermarkTile // Repeat across the image instead of placing once
+	PixelSnap   bool           // Round the text origin to whole pixels
+	Logo        image.Image    // Stamped instead of text by PrepareWatermark
+	MaxWidth    float64        // Wrap horizontal text at word boundaries to this width in pixels; 0 disables wrapping
+	LineHeight  float64        // Distance between baselines as a multiple of the font's line height; 1 if 0
+	Align       TextAlign      // Alignment of the lines of multiline text
+	Anchored    bool           // Place at AnchorX, AnchorY instead of Position
+	AnchorX     float64        // Relative anchor in [0, 1] across the image
+	AnchorY     float64        // Relative anchor in [0, 1] down the image
+	StrokeWidth float64        // Outline width in pixels; 0 for none
+	StrokeColor color.Color    // Outline color
+	Shadow      *textShadow    // Drop shadow behind the text
+	Box         *textBox       // Background box behind the text
+	Gradient    *textGradient  // Linear gradient filling the glyphs instead of Color
+
+	// Relative sizing, resolved against the image by scaled.
+	RelativeFontSize float64 // Font size as a fraction of the shorter image side; FontSize is used if 0
+	RelativeOffset   bool    // OffsetX and OffsetY are fractions of the image width and height
 }
 
+// TextAlign defines how the lines of multiline watermark text are aligned
+// with each other.
+type TextAlign int
+
+const (
+	TextAlignLeft TextAlign = iota
+	TextAlignCenter
+	TextAlignRight
+)
+
 // defaultWatermarkConfig provides sane defaults.
 func defaultWatermarkConfig() *watermarkConfig {
 	return &watermarkConfig{
@@ -64,15 +105,23 @@ func defaultWatermarkConfig() *watermarkConfig {
 type WatermarkOption func(*watermarkConfig)
 
 // WithFontPath specifies the font path for the watermark.
-// Use this if the font file is external.
+// Use this if the font file is external. The file is read each time the
+// watermark is drawn; register fonts used repeatedly with RegisterFont.
 func WithFontPath(path string) WatermarkOption {
-	return func(wc *watermarkConfig) { wc.FontPath = path }
+	return func(wc *watermarkConfig) { wc.FontPath, wc.FontFS, wc.FontName = path, nil, "" }
+}
+
+// WithFontFS loads the font from the file at path in fsys, e.g. an embed.FS
+// of bundled fonts or os.DirFS of a font directory, like WithFontPath does
+// from the operating system's file system.
+func WithFontFS(fsys fs.FS, path string) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.FontPath, wc.FontFS, wc.FontName = path, fsys, "" }
 }
 
 // WithFontBytes specifies font data directly (e.g., from an embedded font).
 // This is generally preferred for self-contained libraries.
 func WithFontBytes(data []byte) WatermarkOption {
-	return func(wc *watermarkConfig) { wc.FontBytes = data }
+	return func(wc *watermarkConfig) { wc.FontBytes, wc.FontName, wc.FontPath, wc.FontFS = data, "", "", nil }
 }
 
 // WithFontSize sets the font size for the watermark.
@@ -93,7 +142,79 @@ func WithPosition(pos WatermarkPosition) WatermarkOption {
 // WithOffset sets an additional offset (in pixels) from the chosen position.
 // Positive X moves right, positive Y moves down.
 func WithOffset(x, y float64) WatermarkOption {
-	return func(wc *watermarkConfig) { wc.OffsetX = x; wc.OffsetY = y }
+	return func(wc *watermarkConfig) { wc.OffsetX = x; wc.OffsetY = y; wc.RelativeOffset = false }
+}
+
+// WithRelativeFontSize sets the font size to fraction of the shorter side of
+// the image, so the watermark keeps its proportions from thumbnails to 4K
+// images; e.g. 0.05 gives 54px text on a 1920x1080 image and 10px text on a
+// 200x200 one. It overrides WithFontSize.
+func WithRelativeFontSize(fraction float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.RelativeFontSize = fraction }
+}
+
+// WithRelativeOffset is WithOffset with the offset given as fractions fx of
+// the image width and fy of the image height, so margins scale with the
+// image like WithRelativeFontSize does for the text.
+func WithRelativeOffset(fx, fy float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.OffsetX = fx; wc.OffsetY = fy; wc.RelativeOffset = true }
+}
+
+// WithVerticalText lays the watermark out top-to-bottom in a single column,
+// as used in Japanese and other CJK vertical writing modes. CJK ideographs and
+// kana stay upright, while Latin letters, digits and long-vowel/bracket marks
+// are rotated 90 degrees clockwise.
+func WithVerticalText() WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Vertical = true }
+}
+
+// WithMaxWidth word-wraps horizontal watermark text so that no line is wider
+// than px pixels, e.g. for long copyright notices. Words wider than px are
+// broken between characters. Explicit newlines in the text are always
+// honored.
+func WithMaxWidth(px float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.MaxWidth = px }
+}
+
+// WithLineHeight sets the distance between the baselines of multiline text
+// as a multiple of the font's line height (default 1).
+func WithLineHeight(factor float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.LineHeight = factor }
+}
+
+// WithAlignment aligns the lines of multiline text to the left (default),
+// center or right of the text block.
+func WithAlignment(align TextAlign) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Align = align }
+}
+
+// WithAnchor places the watermark anywhere in the image instead of at one of
+// the fixed positions: the point at fractions x and y (in [0, 1]) of the text
+// block is aligned with the same fractions of the image, so (0, 0) is the
+// top-left corner, (0.5, 0.5) the center and (1, 1) the bottom-right corner.
+// The WithOffset margins move the text inwards from the edges it is anchored
+// to, scaled down towards the middle, so they have no effect at 0.5.
+func WithAnchor(x, y float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Anchored, wc.AnchorX, wc.AnchorY = true, x, y }
+}
+
+// WithPixelSnapping controls whether the text origin is rounded to whole
+// pixels. By default text is positioned with 1/64 pixel precision so margins
+// are exact at any size; snapping trades that for glyph edges that line up
+// with the pixel grid, which can look crisper for small, pixel-hinted text.
+func WithPixelSnapping(snap bool) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.PixelSnap = snap }
+}
+
+// WithTiling repeats the watermark across the whole image in a grid rotated
+// by angle degrees counter-clockwise, with spacingX and spacingY pixels
+// between neighboring copies and alternate rows shifted by half a copy. This
+// is the usual treatment for stock-photo proofs and confidential documents;
+// position and offset are ignored.
+func WithTiling(spacingX, spacingY float64, angle float64) WatermarkOption {
+	return func(wc *watermarkConfig) {
+		wc.Tile = &WatermarkTile{SpacingX: spacingX, SpacingY: spacingY, Angle: angle}
+	}
 }
 
 // rgbaPool is a sync.Pool for reusing RGBA image buffers to reduce allocations
@@ -148,6 +269,7 @@ func New(img image.Image) *ImageProcessor {
 	return &ImageProcessor{
 		currentImage: img,
 		perfOpts:     DefaultPerformanceOptions(),
+		size:         img.Bounds().Size(),
 	}
 }
 
@@ -159,10 +281,13 @@ func NewWithPerformanceOptions(img image.Image, opts PerformanceOptions) *ImageP
 	return &ImageProcessor{
 		currentImage: img,
 		perfOpts:     opts,
+		size:         img.Bounds().Size(),
 	}
 }
 
 // SetPerformanceOptions updates the performance settings for this processor.
+// To use different settings for one request without affecting other users of
+// a shared processor, use WithOptions instead.
 func (ip *ImageProcessor) SetPerformanceOptions(opts PerformanceOptions) *ImageProcessor {
 	ip.mu.Lock()
 	defer ip.mu.Unlock()
@@ -171,27 +296,74 @@ func (ip *ImageProcessor) SetPerformanceOptions(opts PerformanceOptions) *ImageP
 }
 
 // FromBytes creates a new ImageProcessor by decoding an image from a byte slice.
-// It supports JPEG and PNG formats. Returns an error if decoding fails.
-func FromBytes(data []byte) *ImageProcessor {
+// It supports JPEG, PNG, GIF (the first frame; see FromBytesAnimated), WebP
+// (lossy and lossless), Netpbm (PBM, PGM and PPM), TGA, TIFF (the first page; see FromTIFFPage) and ICO
+// (the largest image) formats, and those of RegisterDecoder codecs; decode options such as
+// WithLenientDecode control how decoding proceeds. Returns an error if decoding fails.
+func FromBytes(data []byte, options ...DecodeOption) *ImageProcessor {
 	if len(data) == 0 {
 		return &ImageProcessor{err: fmt.Errorf("input byte slice is empty")}
 	}
-	reader := bytes.NewReader(data)
-	img, err := decodeImage(reader)
+	img, err := decodeWithOptions(data, newDecodeOptions(options))
 	if err != nil {
 		return &ImageProcessor{err: err}
 	}
 	return &ImageProcessor{
 		currentImage: img,
 		perfOpts:     DefaultPerformanceOptions(),
+		size:         img.Bounds().Size(),
+		meta:         readMetadata(bytes.NewReader(data), int64(len(data))),
+	}
+}
+
+// FromReaderAt creates a new ImageProcessor by decoding the size bytes of an
+// image available through r, such as an HTTP Range or S3 ranged-GET backed
+// reader. Use ProbeReaderAt first to inspect the header of large remote
+// objects without fetching them completely.
+// It supports JPEG, PNG, GIF (the first frame; see FromBytesAnimated), WebP
+// (lossy and lossless), Netpbm (PBM, PGM and PPM), TGA, TIFF (the first page; see FromTIFFPage) and ICO
+// (the largest image) formats, and those of RegisterDecoder codecs; decode options such as
+// WithLenientDecode control how decoding proceeds. Returns an error if decoding fails.
+func FromReaderAt(r io.ReaderAt, size int64, options ...DecodeOption) *ImageProcessor {
+	if r == nil {
+		return &ImageProcessor{err: fmt.Errorf("reader cannot be nil")}
+	}
+	if size <= 0 {
+		return &ImageProcessor{err: fmt.Errorf("input size must be positive (got: %d)", size)}
+	}
+	do := newDecodeOptions(options)
+	var img image.Image
+	var err error
+	if do.Lenient {
+		// Salvaging needs the whole file to locate the damage.
+		var data []byte
+		if data, err = io.ReadAll(io.NewSectionReader(r, 0, size)); err != nil {
+			return &ImageProcessor{err: fmt.Errorf("failed to read image: %w", err)}
+		}
+		img, err = decodeWithOptions(data, do)
+	} else if img, err = decodeImage(io.NewSectionReader(r, 0, size)); err == nil {
+		img = do.apply(img)
+	}
+	if err != nil {
+		return &ImageProcessor{err: err}
+	}
+	return &ImageProcessor{
+		currentImage: img,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         img.Bounds().Size(),
+		meta:         readMetadata(r, size),
 	}
 }
 
 // ToBytes converts the current processed image to a byte slice in the specified format.
-// Supports FormatJPEG and FormatPNG. Returns an error if encoding fails or if
+// Supports FormatJPEG, FormatPNG, FormatWebP, FormatPGM, FormatPPM, FormatPBM, FormatTGA, FormatTIFF, FormatICO and the
+// formats of RegisterEncoder codecs; encode
+// options such as WithCodecFallback, WithJPEGQuality or WithWebPQuality control how encoding proceeds.
+// The ICC color profile of JPEG, PNG or WebP input is carried into JPEG, PNG and WebP output whose colors it
+// describes, so wide-gamut photos keep their colors. Returns an error if encoding fails or if
 // a previous error in the chain exists.
 // This method is safe for concurrent use.
-func (ip *ImageProcessor) ToBytes(format ImageFormat) ([]byte, error) {
+func (ip *ImageProcessor) ToBytes(format ImageFormat, options ...EncodeOption) ([]byte, error) {
 	ip.mu.RLock()
 	defer ip.mu.RUnlock()
 
@@ -202,12 +374,11 @@ func (ip *ImageProcessor) ToBytes(format ImageFormat) ([]byte, error) {
 		return nil, fmt.Errorf("no image available to convert to bytes")
 	}
 
-	var buf bytes.Buffer
-	err := encodeImage(&buf, ip.currentImage, format)
+	data, _, err := encodeWithOptions(ip.currentImage, format, newEncodeOptions(ip.encOpts, options), ip.history, ip.outputMetadata())
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode image to bytes: %w", err)
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
 // Image returns the current image.Image and any error encountered in the processing chain.
@@ -237,12 +408,42 @@ func (ip *ImageProcessor) Clone() *ImageProcessor {
 		currentImage: ip.currentImage,
 		err:          ip.err,
 		perfOpts:     ip.perfOpts, // Copy performance options
+		encOpts:      ip.encOpts.clone(),
+		history:      slices.Clone(ip.history),
+		timings:      slices.Clone(ip.timings),
+		size:         ip.size,
+		meta:         ip.meta,
+		upright:      ip.upright,
+	}
+}
+
+// WithOptions returns a derived processor for the current image and error
+// that uses perf and enc instead of the parent's options. Unlike
+// SetPerformanceOptions it leaves the parent untouched, so a processor shared
+// between requests can be given per-request settings safely. Per-call encode
+// options passed to ToBytes are applied on top of enc.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) WithOptions(perf PerformanceOptions, enc EncodeOptions) *ImageProcessor {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	return &ImageProcessor{
+		currentImage: ip.currentImage,
+		err:          ip.err,
+		perfOpts:     perf,
+		encOpts:      enc.clone(),
+		history:      slices.Clone(ip.history),
+		timings:      slices.Clone(ip.timings),
+		size:         ip.size,
+		meta:         ip.meta,
+		upright:      ip.upright,
 	}
 }
 
 // --- Image Processing Chainable Methods ---
 
 // Crop crops the image to the specified rectangle defined by x, y, width, and height.
+// Grayscale (*image.Gray) images stay grayscale.
 // Returns the ImageProcessor for chaining. An error is set if the crop area is out of bounds
 // or dimensions are invalid.
 // This method is safe for concurrent use.
@@ -266,17 +467,133 @@ func (ip *ImageProcessor) Crop(x, y, width, height int) *ImageProcessor {
 		return ip
 	}
 
+	if gray, ok := ip.currentImage.(*image.Gray); ok {
+		// Grayscale images stay at 1 byte per pixel.
+		croppedGray := image.NewGray(image.Rect(0, 0, width, height))
+		copyRows(croppedGray.Pix, croppedGray.Stride, gray.Pix[gray.PixOffset(x, y):], gray.Stride, width, height)
+		ip.currentImage = croppedGray
+		ip.record("Crop")
+		return ip
+	}
+
 	// Create a new RGBA image and draw the cropped portion onto it.
 	croppedImg := newRGBA(image.Rect(0, 0, width, height))
 	draw.Draw(croppedImg, croppedImg.Bounds(), ip.currentImage, cropRect.Min, draw.Src)
 
 	ip.currentImage = croppedImg
+	ip.record("Crop")
+	return ip
+}
+
+// CropView is like Crop but, for the common in-memory image types, returns a
+// view that shares the pixel buffer of the current image instead of copying
+// it (image.SubImage semantics, rebased to the origin as Crop does). This
+// makes read-only work on regions, such as Histogram or hashing, cheap for
+// large images. YCbCr images are shared when x and y are aligned to their
+// chroma subsampling; other images are copied as with Crop.
+// The view must not be modified through Image or ToRGBA, since that would
+// also change the original image.
+// Returns the ImageProcessor for chaining. An error is set if the crop area is out of bounds
+// or dimensions are invalid.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) CropView(rect image.Rectangle) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if rect.Empty() {
+		ip.err = fmt.Errorf("crop dimensions must be positive (width: %d, height: %d)", rect.Dx(), rect.Dy())
+		return ip
+	}
+	bounds := ip.currentImage.Bounds()
+	if !rect.In(bounds) {
+		ip.err = fmt.Errorf("crop rectangle %v is out of image bounds %v", rect, bounds)
+		return ip
+	}
+
+	view := subImageView(ip.currentImage, rect)
+	if view == nil {
+		copied := newRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(copied, copied.Rect, ip.currentImage, rect.Min, draw.Src)
+		view = copied
+	}
+
+	ip.currentImage = view
+	ip.record("CropView")
 	return ip
 }
 
+// subImageView returns the part of img inside r as an image with its origin
+// at (0, 0) that shares img's pixel buffer, or nil if img's type does not
+// support such views.
+func subImageView(img image.Image, r image.Rectangle) image.Image {
+	origin := image.Rectangle{Max: r.Size()}
+	switch src := img.(type) {
+	case *image.RGBA:
+		v := src.SubImage(r).(*image.RGBA)
+		v.Rect = origin
+		return v
+	case *image.NRGBA:
+		v := src.SubImage(r).(*image.NRGBA)
+		v.Rect = origin
+		return v
+	case *image.RGBA64:
+		v := src.SubImage(r).(*image.RGBA64)
+		v.Rect = origin
+		return v
+	case *image.NRGBA64:
+		v := src.SubImage(r).(*image.NRGBA64)
+		v.Rect = origin
+		return v
+	case *image.Gray:
+		v := src.SubImage(r).(*image.Gray)
+		v.Rect = origin
+		return v
+	case *image.Gray16:
+		v := src.SubImage(r).(*image.Gray16)
+		v.Rect = origin
+		return v
+	case *image.Paletted:
+		v := src.SubImage(r).(*image.Paletted)
+		v.Rect = origin
+		return v
+	case *image.YCbCr:
+		// Chroma offsets are computed from the rectangle, so rebasing only
+		// preserves them when r starts on a chroma sample at a non-negative
+		// position.
+		var ax, ay int
+		switch src.SubsampleRatio {
+		case image.YCbCrSubsampleRatio444:
+			ax, ay = 1, 1
+		case image.YCbCrSubsampleRatio422:
+			ax, ay = 2, 1
+		case image.YCbCrSubsampleRatio420:
+			ax, ay = 2, 2
+		case image.YCbCrSubsampleRatio440:
+			ax, ay = 1, 2
+		case image.YCbCrSubsampleRatio411:
+			ax, ay = 4, 1
+		case image.YCbCrSubsampleRatio410:
+			ax, ay = 4, 2
+		default:
+			return nil
+		}
+		if r.Min.X < 0 || r.Min.Y < 0 || r.Min.X%ax != 0 || r.Min.Y%ay != 0 {
+			return nil
+		}
+		v := src.SubImage(r).(*image.YCbCr)
+		v.Rect = origin
+		return v
+	}
+	return nil
+}
+
 // Resize resizes the image to the specified width and height using Catmull-Rom interpolation.
 // Catmull-Rom provides a good balance of quality and performance among standard library options
-// (available in image/draw since Go 1.18).
+// (available in image/draw since Go 1.18). Grayscale (*image.Gray) images are resized at
+// 1 byte per pixel and stay grayscale.
 // Returns the ImageProcessor for chaining. An error is set if dimensions are invalid.
 // This method is safe for concurrent use.
 func (ip *ImageProcessor) Resize(width, height int) *ImageProcessor {
@@ -291,6 +608,18 @@ func (ip *ImageProcessor) Resize(width, height int) *ImageProcessor {
 		return ip
 	}
 
+	if gray, ok := ip.currentImage.(*image.Gray); ok {
+		// Grayscale images stay at 1 byte per pixel.
+		dst, err := ip.resizeGray(gray, width, height)
+		if err != nil {
+			ip.err = err
+			return ip
+		}
+		ip.currentImage = dst
+		ip.record("Resize")
+		return ip
+	}
+
 	originalBounds := ip.currentImage.Bounds()
 	dstRect := image.Rect(0, 0, width, height)
 	newImg := newRGBA(dstRect)
@@ -299,6 +628,7 @@ func (ip *ImageProcessor) Resize(width, height int) *ImageProcessor {
 	draw.CatmullRom.Scale(newImg, dstRect, ip.currentImage, originalBounds, draw.Src, nil)
 
 	ip.currentImage = newImg
+	ip.record("Resize")
 	return ip
 }
 
@@ -354,6 +684,7 @@ func (ip *ImageProcessor) Grayscale() *ImageProcessor {
 	}
 
 	ip.currentImage = dstRGBA
+	ip.record("Grayscale")
 	return ip
 }
 
@@ -374,11 +705,15 @@ func (ip *ImageProcessor) GrayscaleFast() *ImageProcessor {
 
 	// Use parallel processing for large images
 	if ip.perfOpts.EnableParallelProcessing && width*height >= ip.perfOpts.MinSizeForParallel {
-		return ip.grayscaleParallel()
+		ip.grayscaleParallel()
+	} else {
+		// For small images, use direct buffer access but single-threaded
+		ip.grayscaleDirect()
 	}
-
-	// For small images, use direct buffer access but single-threaded
-	return ip.grayscaleDirect()
+	if ip.err == nil {
+		ip.record("GrayscaleFast")
+	}
+	return ip
 }
 
 // grayscaleParallel processes the image using multiple goroutines for better performance.
@@ -397,65 +732,40 @@ func (ip *ImageProcessor) grayscaleParallel() *ImageProcessor {
 	// Create destination image
 	dstRGBA := image.NewRGBA(bounds)
 
-	// Calculate optimal number of goroutines
-	numGoroutines := ip.perfOpts.MaxGoroutines
-	if numGoroutines <= 0 {
-		numGoroutines = runtime.NumCPU()
-	}
-
-	// Don't use more goroutines than we have rows
-	if numGoroutines > height {
-		numGoroutines = height
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(numGoroutines)
-
 	// Process image in horizontal strips
-	rowsPerGoroutine := height / numGoroutines
-
-	for i := 0; i < numGoroutines; i++ {
-		go func(goroutineID int) {
-			defer wg.Done()
-
-			startRow := goroutineID * rowsPerGoroutine
-			endRow := startRow + rowsPerGoroutine
-
-			// Last goroutine handles remaining rows
-			if goroutineID == numGoroutines-1 {
-				endRow = height
-			}
-
-			// Process rows assigned to this goroutine
-			for y := startRow; y < endRow; y++ {
-				rowStart := (y-bounds.Min.Y)*srcRGBA.Stride + (0-bounds.Min.X)*4
-
-				for x := 0; x < width; x++ {
-					pixelIdx := rowStart + x*4
-
-					// Get RGB values directly from buffer
-					r := srcRGBA.Pix[pixelIdx]
-					g := srcRGBA.Pix[pixelIdx+1]
-					b := srcRGBA.Pix[pixelIdx+2]
-					a := srcRGBA.Pix[pixelIdx+3]
-
-					// Calculate grayscale using luminosity formula (ITU-R BT.709)
-					// This is more accurate than simple averaging
-					gray := uint8(0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b))
-
-					// Set grayscale value to all RGB channels
-					dstRowStart := (y-bounds.Min.Y)*dstRGBA.Stride + (0-bounds.Min.X)*4
-					dstPixelIdx := dstRowStart + x*4
-					dstRGBA.Pix[dstPixelIdx] = gray   // R
-					dstRGBA.Pix[dstPixelIdx+1] = gray // G
-					dstRGBA.Pix[dstPixelIdx+2] = gray // B
-					dstRGBA.Pix[dstPixelIdx+3] = a    // A (preserve alpha)
-				}
+	if err := ip.processRowsErr(width, height, func(startRow, endRow int) error {
+		// Process rows assigned to this strip
+		for y := startRow; y < endRow; y++ {
+			rowStart := (y-bounds.Min.Y)*srcRGBA.Stride + (0-bounds.Min.X)*4
+
+			for x := 0; x < width; x++ {
+				pixelIdx := rowStart + x*4
+
+				// Get RGB values directly from buffer
+				r := srcRGBA.Pix[pixelIdx]
+				g := srcRGBA.Pix[pixelIdx+1]
+				b := srcRGBA.Pix[pixelIdx+2]
+				a := srcRGBA.Pix[pixelIdx+3]
+
+				// Calculate grayscale using luminosity formula (ITU-R BT.709)
+				// This is more accurate than simple averaging
+				gray := uint8(0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b))
+
+				// Set grayscale value to all RGB channels
+				dstRowStart := (y-bounds.Min.Y)*dstRGBA.Stride + (0-bounds.Min.X)*4
+				dstPixelIdx := dstRowStart + x*4
+				dstRGBA.Pix[dstPixelIdx] = gray   // R
+				dstRGBA.Pix[dstPixelIdx+1] = gray // G
+				dstRGBA.Pix[dstPixelIdx+2] = gray // B
+				dstRGBA.Pix[dstPixelIdx+3] = a    // A (preserve alpha)
 			}
-		}(i)
+		}
+		return nil
+	}); err != nil {
+		ip.err = err
+		return ip
 	}
 
-	wg.Wait()
 	ip.currentImage = dstRGBA
 	return ip
 }
@@ -528,70 +838,136 @@ func (ip *ImageProcessor) AddTextWatermark(text string, options ...WatermarkOpti
 	for _, opt := range options {
 		opt(cfg)
 	}
-
-	// Load font
-	fnt, err := opentype.Parse(cfg.FontBytes)
-	if err != nil {
-		ip.err = fmt.Errorf("failed to parse font bytes for watermark: %w", err)
+	if err := cfg.validate(); err != nil {
+		ip.err = err
 		return ip
 	}
+	bounds := ip.currentImage.Bounds()
+	cfg = cfg.scaled(bounds)
 
-	face, err := opentype.NewFace(fnt, &opentype.FaceOptions{
-		Size:    cfg.FontSize,
-		DPI:     72, // Standard DPI
-		Hinting: font.HintingNone,
-	})
+	// Load font
+	face, err := cfg.newFace()
 	if err != nil {
-		ip.err = fmt.Errorf("failed to create font face for watermark: %w", err)
+		ip.err = fmt.Errorf("failed to load watermark font: %w", err)
 		return ip
 	}
 	defer face.Close()
 
 	// Create a new RGBA image to draw on to avoid modifying the original directly
-	bounds := ip.currentImage.Bounds()
 	imgWithWatermark := newRGBA(bounds)
 	draw.Draw(imgWithWatermark, bounds, ip.currentImage, bounds.Min, draw.Src) // Copy original image
 
-	dr := &font.Drawer{
-		Dst:  imgWithWatermark,
-		Src:  image.NewUniform(cfg.Color),
-		Face: face,
+	if cfg.Tile != nil {
+		stamp, _ := renderTextStamp(face, cfg)
+		tileStamp(imgWithWatermark, stamp, cfg.Tile.SpacingX, cfg.Tile.SpacingY, cfg.Tile.Angle)
+		ip.currentImage = imgWithWatermark
+		ip.record("AddTextWatermark")
+		return ip
+	}
+
+	if cfg.Vertical {
+		colWidth, colHeight := measureVerticalText(face, cfg.Text)
+		fx, fy := cfg.anchor()
+		x, y := cfg.snap(blockOrigin(fx, fy, bounds, colWidth, colHeight, cfg.OffsetX, cfg.OffsetY))
+		extent := image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Ceil(x+colWidth)), int(math.Ceil(y+colHeight)))
+		drawStyledText(imgWithWatermark, cfg, extent, columnFrame(x, y, colWidth, colHeight), func(dst draw.Image, src image.Image) {
+			drawVerticalText(dst, face, src, cfg.Text, x, y)
+		})
+		ip.currentImage = imgWithWatermark
+		ip.record("AddTextWatermark")
+		return ip
 	}
 
+	block := layoutText(face, cfg)
+	dot := textWatermarkDot(block, cfg, bounds)
+	drawStyledText(imgWithWatermark, cfg, fixedRect(block.ink.Add(dot)), block.frame(dot), func(dst draw.Image, src image.Image) {
+		block.draw(&font.Drawer{Dst: dst, Src: src, Face: face}, dot)
+	})
+
+	ip.currentImage = imgWithWatermark
+	ip.record("AddTextWatermark")
+	return ip
+}
+
+// textWatermarkDot returns the baseline origin of the first line of a
+// horizontal text watermark placed according to cfg in an image with the
+// given bounds.
+func textWatermarkDot(block *textBlock, cfg *watermarkConfig, bounds image.Rectangle) fixed.Point26_6 {
 	// Measure text bounds and position
-	textBounds, _ := dr.BoundString(cfg.Text)                    // Bounds of the text if drawn at (0,0)
-	textWidth := float64(textBounds.Max.X-textBounds.Min.X) / 64 // Convert fixed.Int26_6 to float64 pixels
-	textHeight := float64(face.Metrics().Height) / 64            // Ascent + descent in pixels
+	metrics := block.metrics
+	textWidth := fixedToFloat(block.ink.Max.X - block.ink.Min.X)
+	textHeight := fixedToFloat(block.height())             // First ascent to last descent in pixels
+	extra := fixedToFloat(block.height() - metrics.Height) // Baseline distance from the first to the last line
 
 	var x, y float64
 
+	if cfg.Anchored {
+		// The block extends from the ascent of the first line to the descent
+		// of the last, as for the fixed top and bottom positions.
+		fx, fy := cfg.AnchorX, cfg.AnchorY
+		height := fixedToFloat(metrics.Ascent+metrics.Descent) + extra
+		x = fx*(float64(bounds.Dx())-textWidth) + (1-2*fx)*cfg.OffsetX
+		y = fy*(float64(bounds.Dy())-height) + (1-2*fy)*cfg.OffsetY + fixedToFloat(metrics.Ascent)
+		x, y = cfg.snap(x, y)
+		return fixed.Point26_6{X: floatToFixed(x), Y: floatToFixed(y)}
+	}
+
 	switch cfg.Position {
 	case PositionTopLeft:
 		x = cfg.OffsetX
-		y = cfg.OffsetY + (float64(face.Metrics().Ascent) / 64) // Adjust for baseline
+		y = cfg.OffsetY + (float64(metrics.Ascent) / 64) // Adjust for baseline
 	case PositionTopRight:
 		x = float64(bounds.Dx()) - textWidth - cfg.OffsetX
-		y = cfg.OffsetY + (float64(face.Metrics().Ascent) / 64)
+		y = cfg.OffsetY + (float64(metrics.Ascent) / 64)
 	case PositionBottomLeft:
 		x = cfg.OffsetX
-		y = float64(bounds.Dy()) - cfg.OffsetY - (float64(face.Metrics().Descent) / 64) // Adjust for baseline
+		y = float64(bounds.Dy()) - cfg.OffsetY - (float64(metrics.Descent) / 64) - extra // Adjust for baseline
 	case PositionBottomRight:
 		x = float64(bounds.Dx()) - textWidth - cfg.OffsetX
-		y = float64(bounds.Dy()) - cfg.OffsetY - (float64(face.Metrics().Descent) / 64)
+		y = float64(bounds.Dy()) - cfg.OffsetY - (float64(metrics.Descent) / 64) - extra
 	case PositionCenter:
 		x = (float64(bounds.Dx()) - textWidth) / 2
-		y = (float64(bounds.Dy())-textHeight)/2 + (float64(face.Metrics().Ascent) / 64) // Center of block + ascent
+		y = (float64(bounds.Dy())-textHeight)/2 + (float64(metrics.Ascent) / 64) // Center of block + ascent
 	}
 
-	dr.Dot = fixed.Point26_6{
-		X: fixed.I(int(x)),
-		Y: fixed.I(int(y)),
+	x, y = cfg.snap(x, y)
+	return fixed.Point26_6{
+		X: floatToFixed(x),
+		Y: floatToFixed(y),
 	}
+}
 
-	dr.DrawString(cfg.Text)
+// anchor returns the relative anchor of the watermark: the one set by
+// WithAnchor or that of its position.
+func (cfg *watermarkConfig) anchor() (fx, fy float64) {
+	if cfg.Anchored {
+		return cfg.AnchorX, cfg.AnchorY
+	}
+	return cfg.Position.anchor()
+}
 
-	ip.currentImage = imgWithWatermark
-	return ip
+// anchor returns the relative anchor equivalent to the position.
+func (pos WatermarkPosition) anchor() (fx, fy float64) {
+	switch pos {
+	case PositionTopLeft:
+		return 0, 0
+	case PositionTopRight:
+		return 1, 0
+	case PositionBottomLeft:
+		return 0, 1
+	case PositionCenter:
+		return 0.5, 0.5
+	default: // PositionBottomRight
+		return 1, 1
+	}
+}
+
+// snap rounds a text origin to whole pixels if pixel snapping is enabled.
+func (cfg *watermarkConfig) snap(x, y float64) (float64, float64) {
+	if cfg.PixelSnap {
+		return math.Round(x), math.Round(y)
+	}
+	return x, y
 }
 
 // PerformanceOptions controls optimization settings for image processing.
@@ -6,6 +6,7 @@ import (
 	"image/color"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -203,6 +204,91 @@ func TestCrop(t *testing.T) {
 	}
 }
 
+func TestCropView(t *testing.T) {
+	originalImg := createTestImage(200, 150)
+	rect := image.Rect(50, 40, 150, 115)
+
+	// Test case: The view shares the original buffer and matches Crop
+	view := New(originalImg).CropView(rect)
+	if view.Err() != nil {
+		t.Fatalf("CropView() with valid dimensions should not error, got: %v", view.Err())
+	}
+	rgba, ok := view.currentImage.(*image.RGBA)
+	if !ok || rgba.Rect != image.Rect(0, 0, 100, 75) {
+		t.Fatalf("CropView() produced %T with bounds %v, want an *image.RGBA at 0,0-100,75", view.currentImage, view.currentImage.Bounds())
+	}
+	orig := originalImg.(*image.RGBA)
+	if &rgba.Pix[0] != &orig.Pix[orig.PixOffset(50, 40)] {
+		t.Error("CropView() should share the original pixel buffer")
+	}
+	viewHist, _ := view.Histogram()
+	cropHist, _ := New(originalImg).Crop(50, 40, 100, 75).Histogram()
+	if *viewHist != *cropHist {
+		t.Error("Histogram() of CropView() should match Histogram() of Crop()")
+	}
+
+	// Test case: Pixel operations on a view match those on a copied crop
+	// and leave the original alone
+	before := bytes.Clone(orig.Pix)
+	mask := createTestImage(100, 75)
+	region := image.Rect(10, 10, 60, 40)
+	ops := map[string]func(*ImageProcessor) *ImageProcessor{
+		"Pixelate":     func(ip *ImageProcessor) *ImageProcessor { return ip.Pixelate(7) },
+		"ApplyMask":    func(ip *ImageProcessor) *ImageProcessor { return ip.ApplyMask(mask) },
+		"AddNoise":     func(ip *ImageProcessor) *ImageProcessor { return ip.AddNoise(0, NoiseSaltPepper) },
+		"FilmGrain":    func(ip *ImageProcessor) *ImageProcessor { return ip.FilmGrain(0) },
+		"RedactRegion": func(ip *ImageProcessor) *ImageProcessor { return ip.RedactRegion(region, RedactBlur) },
+		"FocusRegion":  func(ip *ImageProcessor) *ImageProcessor { return ip.FocusRegion(region, 3, 5) },
+	}
+	for name, op := range ops {
+		got := mustImage(t, op(New(originalImg).CropView(rect)))
+		want := mustImage(t, op(New(originalImg).Crop(50, 40, 100, 75)))
+		if !bytes.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+			t.Errorf("%s() after CropView() differs from %s() after Crop()", name, name)
+		}
+	}
+	if !bytes.Equal(orig.Pix, before) {
+		t.Error("Operations after CropView() should not modify the original image")
+	}
+
+	// Test case: YCbCr views are shared when aligned to the chroma samples
+	ycc := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range ycc.Y {
+		ycc.Y[i] = uint8(i * 7)
+	}
+	for i := range ycc.Cb {
+		ycc.Cb[i], ycc.Cr[i] = uint8(i*3), uint8(255-i*5)
+	}
+	for _, r := range []image.Rectangle{image.Rect(10, 8, 40, 30), image.Rect(11, 9, 40, 30)} {
+		got := New(ycc).CropView(r).currentImage
+		want := New(ycc).Crop(r.Min.X, r.Min.Y, r.Dx(), r.Dy()).currentImage
+		_, shared := got.(*image.YCbCr)
+		if shared != (r.Min.X%2 == 0) {
+			t.Errorf("CropView(%v) of a 4:2:0 image produced %T", r, got)
+		}
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				if color.RGBAModel.Convert(got.At(x, y)) != want.At(x, y) {
+					t.Fatalf("CropView(%v) pixel (%d, %d) = %v, want %v", r, x, y, got.At(x, y), want.At(x, y))
+				}
+			}
+		}
+	}
+
+	// Test case: Empty and out of bounds rectangles
+	if New(originalImg).CropView(image.Rect(10, 10, 10, 50)).Err() == nil {
+		t.Fatal("CropView() with zero width should return an error")
+	}
+	if New(originalImg).CropView(image.Rect(150, 0, 250, 50)).Err() == nil {
+		t.Fatal("CropView() out of bounds should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).CropView(rect).Err() == nil {
+		t.Fatal("CropView() on a processor with prior error should propagate that error")
+	}
+}
+
 func TestResize(t *testing.T) {
 	originalImg := createTestImage(200, 150)
 	proc := New(originalImg)
@@ -468,6 +554,90 @@ func TestDecodeImage(t *testing.T) {
 	}
 }
 
+// countingReaderAt records the furthest offset read from an io.ReaderAt
+// and the number of bytes read.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	read  int64
+	total int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read = max(c.read, off+int64(n))
+	c.total += int64(n)
+	return n, err
+}
+
+func TestFromReaderAt(t *testing.T) {
+	pngBytes, _ := imageToPNGBytes(createTestImage(30, 20))
+
+	proc := FromReaderAt(bytes.NewReader(pngBytes), int64(len(pngBytes)))
+	if proc.Err() != nil {
+		t.Fatalf("FromReaderAt() with valid PNG should not error, got: %v", proc.Err())
+	}
+	if img, _ := proc.Image(); img.Bounds() != image.Rect(0, 0, 30, 20) {
+		t.Errorf("FromReaderAt() bounds = %v, want 30x20", img.Bounds())
+	}
+
+	// Invalid input
+	if FromReaderAt(nil, 10).Err() == nil {
+		t.Error("FromReaderAt() with nil reader should return an error")
+	}
+	if FromReaderAt(bytes.NewReader(pngBytes), 0).Err() == nil {
+		t.Error("FromReaderAt() with zero size should return an error")
+	}
+	if FromReaderAt(bytes.NewReader(pngBytes), 40).Err() == nil {
+		t.Error("FromReaderAt() with a truncated size should return an error")
+	}
+}
+
+func TestProbeReaderAt(t *testing.T) {
+	// A large, noisy image so the file is far bigger than its header.
+	pngBytes, _ := imageToPNGBytes(createNoiseImage(800, 600))
+	counter := &countingReaderAt{r: bytes.NewReader(pngBytes)}
+
+	info, err := ProbeReaderAt(counter, int64(len(pngBytes)))
+	if err != nil {
+		t.Fatalf("ProbeReaderAt() should not error, got: %v", err)
+	}
+	if info != (ImageInfo{Width: 800, Height: 600, Format: FormatPNG}) {
+		t.Errorf("ProbeReaderAt() = %+v, want 800x600 png", info)
+	}
+	if counter.read > 64<<10 {
+		t.Errorf("ProbeReaderAt() read %d of %d bytes, want only the header", counter.read, len(pngBytes))
+	}
+
+	jpegBytes, _ := imageToJPEGBytes(createTestImage(40, 30))
+	info, err = ProbeReaderAt(bytes.NewReader(jpegBytes), int64(len(jpegBytes)))
+	if err != nil || info != (ImageInfo{Width: 40, Height: 30, Format: FormatJPEG}) {
+		t.Errorf("ProbeReaderAt() of JPEG = %+v, %v", info, err)
+	}
+
+	// TIFF directories can be at the end of the file; only they are read.
+	tiffBytes, _ := New(createNoiseImage(800, 600)).ToBytes(FormatTIFF)
+	counter = &countingReaderAt{r: bytes.NewReader(tiffBytes)}
+	info, err = ProbeReaderAt(counter, int64(len(tiffBytes)))
+	if err != nil || info != (ImageInfo{Width: 800, Height: 600, Format: FormatTIFF}) {
+		t.Errorf("ProbeReaderAt() of TIFF = %+v, %v", info, err)
+	}
+	if counter.total > 64<<10 {
+		t.Errorf("ProbeReaderAt() of TIFF read %d of %d bytes, want only the header", counter.total, len(tiffBytes))
+	}
+
+	// Invalid input
+	if _, err := ProbeReaderAt(nil, 10); err == nil {
+		t.Error("ProbeReaderAt() with nil reader should return an error")
+	}
+	if _, err := ProbeReaderAt(bytes.NewReader(pngBytes), -1); err == nil {
+		t.Error("ProbeReaderAt() with negative size should return an error")
+	}
+	garbage := []byte("not an image")
+	if _, err := ProbeReaderAt(bytes.NewReader(garbage), int64(len(garbage))); err == nil {
+		t.Error("ProbeReaderAt() with invalid data should return an error")
+	}
+}
+
 // Test case for encodeImage in formats.go
 func TestEncodeImage(t *testing.T) {
 	testImg := createTestImage(20, 20)
@@ -545,6 +715,52 @@ func TestClone(t *testing.T) {
 	}
 }
 
+func TestWithOptions(t *testing.T) {
+	parent := New(createTestImage(40, 40))
+	perf := PerformanceOptions{MaxGoroutines: 2, EnableParallelProcessing: true, MinSizeForParallel: 1}
+	enc := EncodeOptions{Fallback: []ImageFormat{FormatPNG}}
+
+	derived := parent.WithOptions(perf, enc)
+	if derived == parent {
+		t.Fatal("WithOptions() should return a new processor")
+	}
+	if derived.perfOpts != perf {
+		t.Errorf("WithOptions() perf = %+v, want %+v", derived.perfOpts, perf)
+	}
+	if parent.perfOpts != DefaultPerformanceOptions() {
+		t.Error("WithOptions() should not change the parent's performance options")
+	}
+
+	// Encode options become defaults for ToBytes on the derived processor only.
+	data, err := derived.ToBytes(FormatAVIF)
+	if err != nil || DetectFormat(data) != FormatPNG {
+		t.Errorf("ToBytes(FormatAVIF) on derived = %s, %v, want png fallback", DetectFormat(data), err)
+	}
+	if _, err := parent.ToBytes(FormatAVIF); err == nil {
+		t.Error("ToBytes(FormatAVIF) on parent should not use the derived encode options")
+	}
+	// Per-call options take precedence.
+	data, err = derived.ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatJPEG}))
+	if err != nil || DetectFormat(data) != FormatJPEG {
+		t.Errorf("ToBytes() with per-call fallback = %s, %v, want jpeg", DetectFormat(data), err)
+	}
+
+	// Mutating the passed options or the derived processor leaves the parent alone.
+	enc.Fallback[0] = FormatGIF
+	if derived.encOpts.Fallback[0] != FormatPNG {
+		t.Error("WithOptions() should copy the encode options")
+	}
+	derived.Resize(10, 10)
+	if img, _ := parent.Image(); img.Bounds().Dx() != 40 {
+		t.Error("Operations on the derived processor should not affect the parent")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).WithOptions(perf, enc).Err() == nil {
+		t.Fatal("WithOptions() on a processor with prior error should propagate that error")
+	}
+}
+
 func TestConcurrentRead(t *testing.T) {
 	originalImg := createTestImage(100, 100)
 	proc := New(originalImg).Resize(50, 50).Grayscale()
@@ -0,0 +1,171 @@
+// Package gopiqperf provides opt-in performance guardrails for gopiq
+// operations. Guard benchmarks an operation on a deterministic reference image
+// and fails the calling test when it exceeds a time or allocation budget, so
+// regressions are caught in CI rather than in production:
+//
+//	func TestResizePerf(t *testing.T) {
+//		gopiqperf.Guard(t, gopiqperf.Budget{
+//			Op: func(ip *gopiq.ImageProcessor) *gopiq.ImageProcessor {
+//				return ip.Resize(640, 480)
+//			},
+//			MaxTime:   20 * time.Millisecond,
+//			MaxAllocs: 16,
+//		})
+//	}
+//
+// Timings vary between machines, so guards are skipped in -short mode and
+// time budgets can be scaled with the GOPIQPERF_SCALE environment variable
+// (e.g. GOPIQPERF_SCALE=3 on slow CI runners). Allocation budgets are not
+// scaled.
+package gopiqperf
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TamasGorgics/gopiq"
+)
+
+// DefaultSize is the reference image size used when Budget.Size is zero.
+var DefaultSize = image.Pt(1024, 768)
+
+// ScaleEnv is the environment variable that scales all time budgets.
+const ScaleEnv = "GOPIQPERF_SCALE"
+
+// Budget is the performance allowance for one operation.
+type Budget struct {
+	Op        func(*gopiq.ImageProcessor) *gopiq.ImageProcessor // Operation under test
+	Size      image.Point                                       // Reference image size, DefaultSize if zero
+	MaxTime   time.Duration                                     // Maximum time per run, 0 to disable
+	MaxAllocs int64                                             // Maximum allocations per run, 0 to disable
+	MaxBytes  int64                                             // Maximum bytes allocated per run, 0 to disable
+}
+
+// Guard benchmarks budget.Op on a reference image of budget.Size and reports
+// a test error for every limit the operation exceeds. It is skipped when
+// tests run with -short.
+func Guard(t testing.TB, budget Budget) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("gopiqperf: skipping performance guard in short mode")
+		return
+	}
+	if budget.Op == nil {
+		t.Fatalf("gopiqperf: budget has no operation")
+		return
+	}
+	scale, err := timeScale()
+	if err != nil {
+		t.Fatalf("gopiqperf: %v", err)
+		return
+	}
+	size := budget.Size
+	if size == (image.Point{}) {
+		size = DefaultSize
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		t.Fatalf("gopiqperf: reference image size must be positive (got: %v)", size)
+		return
+	}
+
+	img := ReferenceImage(size.X, size.Y)
+	var opErr error
+	res := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N && opErr == nil; i++ {
+			opErr = budget.Op(gopiq.New(img)).Err()
+		}
+	})
+	if opErr != nil {
+		t.Fatalf("gopiqperf: operation failed: %v", opErr)
+		return
+	}
+
+	if budget.MaxTime > 0 {
+		limit := time.Duration(float64(budget.MaxTime) * scale)
+		if got := time.Duration(res.NsPerOp()); got > limit {
+			t.Errorf("gopiqperf: operation took %v per run on %dx%d, budget %v", got, size.X, size.Y, limit)
+		}
+	}
+	if budget.MaxAllocs > 0 {
+		if got := res.AllocsPerOp(); got > budget.MaxAllocs {
+			t.Errorf("gopiqperf: operation made %d allocations per run on %dx%d, budget %d", got, size.X, size.Y, budget.MaxAllocs)
+		}
+	}
+	if budget.MaxBytes > 0 {
+		if got := res.AllocedBytesPerOp(); got > budget.MaxBytes {
+			t.Errorf("gopiqperf: operation allocated %d bytes per run on %dx%d, budget %d", got, size.X, size.Y, budget.MaxBytes)
+		}
+	}
+}
+
+// timeScale returns the time budget multiplier from ScaleEnv, 1 if unset.
+func timeScale() (float64, error) {
+	v := os.Getenv(ScaleEnv)
+	if v == "" {
+		return 1, nil
+	}
+	s, err := strconv.ParseFloat(v, 64)
+	if err != nil || s <= 0 || math.IsInf(s, 0) {
+		return 0, fmt.Errorf("%s must be a positive number (got: %q)", ScaleEnv, v)
+	}
+	return s, nil
+}
+
+var (
+	referenceMu     sync.Mutex
+	referenceImages = map[image.Point]*image.RGBA{}
+)
+
+// ReferenceImage returns a deterministic, photo-like width x height test
+// image: smooth color gradients, hard-edged shapes and fine pseudo-random
+// texture, so that filters see realistic content. Images are cached and
+// shared between calls; callers must not modify them.
+func ReferenceImage(width, height int) *image.RGBA {
+	referenceMu.Lock()
+	defer referenceMu.Unlock()
+
+	key := image.Pt(width, height)
+	if img, ok := referenceImages[key]; ok {
+		return img
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(2463534242)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// xorshift32 noise for texture.
+			seed ^= seed << 13
+			seed ^= seed >> 17
+			seed ^= seed << 5
+			noise := int(seed%32) - 16
+
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			r := 255 * fx
+			g := 255 * fy
+			b := 128 + 127*math.Sin(6*math.Pi*(fx+fy))
+			// A dark disc and a bright bar give strong edges.
+			if math.Hypot(fx-0.35, fy-0.5) < 0.2 {
+				r, g, b = r*0.2, g*0.2, b*0.2
+			}
+			if fx > 0.6 && fx < 0.8 && fy > 0.2 && fy < 0.8 {
+				r, g, b = 240, 230, 210
+			}
+			img.SetRGBA(x, y, color.RGBA{clamp(r, noise), clamp(g, noise), clamp(b, noise), 255})
+		}
+	}
+	referenceImages[key] = img
+	return img
+}
+
+// clamp adds noise to v and clamps the result to a channel value.
+func clamp(v float64, noise int) uint8 {
+	return uint8(min(max(int(v)+noise, 0), 255))
+}
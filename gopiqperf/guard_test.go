@@ -0,0 +1,104 @@
+package gopiqperf
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TamasGorgics/gopiq"
+)
+
+// recorder captures failures reported by Guard instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func grayscale(ip *gopiq.ImageProcessor) *gopiq.ImageProcessor {
+	return ip.Grayscale()
+}
+
+func TestGuard(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping benchmarks in short mode")
+	}
+	small := Budget{Op: grayscale, Size: DefaultSize.Div(8)}
+
+	// A generous budget passes.
+	rec := &recorder{TB: t}
+	generous := small
+	generous.MaxTime, generous.MaxAllocs, generous.MaxBytes = time.Minute, 1<<20, 1<<30
+	Guard(rec, generous)
+	if len(rec.errors) != 0 {
+		t.Errorf("Guard() with a generous budget reported %v", rec.errors)
+	}
+
+	// A tiny budget reports every exceeded limit.
+	rec = &recorder{TB: t}
+	tiny := small
+	tiny.MaxTime, tiny.MaxAllocs, tiny.MaxBytes = time.Nanosecond, 1, 1
+	Guard(rec, tiny)
+	if len(rec.errors) != 3 || rec.fatal {
+		t.Errorf("Guard() with a tiny budget reported %v, want 3 errors", rec.errors)
+	}
+
+	// Time budgets scale with the environment.
+	t.Setenv(ScaleEnv, "1e12")
+	rec = &recorder{TB: t}
+	scaled := small
+	scaled.MaxTime = time.Nanosecond
+	Guard(rec, scaled)
+	if len(rec.errors) != 0 {
+		t.Errorf("Guard() with %s should scale the time budget, got %v", ScaleEnv, rec.errors)
+	}
+
+	t.Setenv(ScaleEnv, "fast")
+	rec = &recorder{TB: t}
+	Guard(rec, small)
+	if !rec.fatal {
+		t.Errorf("Guard() with an invalid %s should fail", ScaleEnv)
+	}
+}
+
+func TestGuardInvalidBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Guard is skipped in short mode")
+	}
+	failing := func(ip *gopiq.ImageProcessor) *gopiq.ImageProcessor { return ip.Resize(0, 0) }
+	for name, b := range map[string]Budget{
+		"no operation":      {},
+		"negative size":     {Op: grayscale, Size: DefaultSize.Mul(-1)},
+		"failing operation": {Op: failing, Size: DefaultSize.Div(8)},
+	} {
+		rec := &recorder{TB: t}
+		Guard(rec, b)
+		if !rec.fatal {
+			t.Errorf("Guard() with %s should fail", name)
+		}
+	}
+}
+
+func TestReferenceImage(t *testing.T) {
+	a, b := ReferenceImage(64, 48), ReferenceImage(64, 48)
+	if a != b {
+		t.Error("ReferenceImage() should cache images by size")
+	}
+	if a.Bounds().Dx() != 64 || a.Bounds().Dy() != 48 {
+		t.Errorf("ReferenceImage() bounds = %v, want 64x48", a.Bounds())
+	}
+	if a.At(0, 0) == a.At(63, 47) {
+		t.Error("ReferenceImage() should not be uniform")
+	}
+}
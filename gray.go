@@ -0,0 +1,196 @@
+package gopiq
+
+import (
+	"image"
+	"math"
+)
+
+// Threshold converts the image to black and white: pixels whose luminance is
+// at least level become white and all others black. The result is an
+// *image.Gray, so following steps that support grayscale images (Crop,
+// Resize, the morphology operations and encoding) stay at 1 byte per pixel.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Threshold(level uint8) *ImageProcessor {
+	return ip.threshold("Threshold", func(*[256]int) int { return int(level) })
+}
+
+// ThresholdAuto is Threshold with the level chosen by Otsu's method, which
+// separates the dark and light pixels of scanned documents without tuning.
+// Returns the ImageProcessor for chaining.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ThresholdAuto() *ImageProcessor {
+	return ip.threshold("ThresholdAuto", func(hist *[256]int) int {
+		// Values up to the Otsu threshold form the dark class.
+		return int(otsuThreshold(hist)) + 1
+	})
+}
+
+// threshold binarizes the image at the level returned by levelFor for its
+// luminance histogram and records it in the history under name.
+func (ip *ImageProcessor) threshold(name string, levelFor func(hist *[256]int) int) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+
+	luma, err := ip.lumaGray(ip.currentImage)
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	width, height := luma.Rect.Dx(), luma.Rect.Dy()
+	var hist [256]int
+	for y := 0; y < height; y++ {
+		for _, v := range luma.Pix[y*luma.Stride : y*luma.Stride+width] {
+			hist[v]++
+		}
+	}
+	level := levelFor(&hist)
+
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	if err := ip.processRowsErr(width, height, func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			s := luma.Pix[y*luma.Stride : y*luma.Stride+width]
+			d := dst.Pix[y*dst.Stride:]
+			for x, v := range s {
+				if int(v) >= level {
+					d[x] = 255
+				} else {
+					d[x] = 0
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		ip.err = err
+		return ip
+	}
+
+	ip.currentImage = dst
+	ip.record(name)
+	return ip
+}
+
+// lumaGray returns the luminance of img as an *image.Gray with its origin at
+// (0, 0). Grayscale images are returned as is (or as a sub-image view) and
+// the luma plane of JPEG-decoded images is used directly, so the result must
+// not be modified.
+func (ip *ImageProcessor) lumaGray(img image.Image) (*image.Gray, error) {
+	b := img.Bounds()
+	rect := image.Rect(0, 0, b.Dx(), b.Dy())
+	switch src := img.(type) {
+	case *image.Gray:
+		return &image.Gray{Pix: src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], Stride: src.Stride, Rect: rect}, nil
+	case *image.YCbCr:
+		return &image.Gray{Pix: src.Y[src.YOffset(b.Min.X, b.Min.Y):], Stride: src.YStride, Rect: rect}, nil
+	}
+
+	rgba := asRGBA(img)
+	dst := image.NewGray(rect)
+	if err := ip.processRowsErr(b.Dx(), b.Dy(), func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			s := rgba.Pix[y*rgba.Stride:]
+			d := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()]
+			for x := range d {
+				a := s[x*4+3]
+				d[x] = clampUint8(luminance(unpremultiply(s[x*4], a), unpremultiply(s[x*4+1], a), unpremultiply(s[x*4+2], a)))
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// resampleSpan lists the weights of the source pixels, starting at first,
+// that contribute to one destination pixel.
+type resampleSpan struct {
+	first   int
+	weights []float32
+}
+
+// catmullRomSpans returns the Catmull-Rom resampling weights for scaling n
+// source pixels to m, widening the kernel when downscaling as
+// draw.CatmullRom does.
+func catmullRomSpans(n, m int) []resampleSpan {
+	scale := float64(n) / float64(m)
+	filterScale := max(scale, 1)
+	support := 2 * filterScale
+	spans := make([]resampleSpan, m)
+	for i := range spans {
+		center := (float64(i) + 0.5) * scale
+		lo := max(0, int(math.Floor(center-support)))
+		hi := min(n-1, int(math.Ceil(center+support)))
+		weights := make([]float32, hi-lo+1)
+		sum := 0.0
+		for j := lo; j <= hi; j++ {
+			t := math.Abs(float64(j)+0.5-center) / filterScale
+			var w float64
+			switch {
+			case t < 1:
+				w = (1.5*t-2.5)*t*t + 1
+			case t < 2:
+				w = ((-0.5*t+2.5)*t-4)*t + 2
+			}
+			weights[j-lo] = float32(w)
+			sum += w
+		}
+		if sum != 0 {
+			for k := range weights {
+				weights[k] /= float32(sum)
+			}
+		}
+		spans[i] = resampleSpan{first: lo, weights: weights}
+	}
+	return spans
+}
+
+// resizeGray scales src to width x height with the Catmull-Rom kernel,
+// keeping 1 byte per pixel instead of going through RGBA.
+func (ip *ImageProcessor) resizeGray(src *image.Gray, width, height int) (*image.Gray, error) {
+	b := src.Rect
+	srcW, srcH := b.Dx(), b.Dy()
+	pix := src.Pix[src.PixOffset(b.Min.X, b.Min.Y):]
+	hSpans, vSpans := catmullRomSpans(srcW, width), catmullRomSpans(srcH, height)
+
+	// Scale rows into a float buffer, then columns into the result.
+	tmp := make([]float32, width*srcH)
+	if err := ip.processRowsErr(width, srcH, func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			row := pix[y*src.Stride:]
+			for x, span := range hSpans {
+				var v float32
+				for k, w := range span.weights {
+					v += w * float32(row[span.first+k])
+				}
+				tmp[y*width+x] = v
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	if err := ip.processRowsErr(width, height, func(startRow, endRow int) error {
+		for y := startRow; y < endRow; y++ {
+			span := vSpans[y]
+			d := dst.Pix[y*dst.Stride:]
+			for x := 0; x < width; x++ {
+				var v float32
+				for k, w := range span.weights {
+					v += w * tmp[(span.first+k)*width+x]
+				}
+				d[x] = clampUint8(float64(v))
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
@@ -0,0 +1,125 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestThreshold(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	for x, v := range []uint8{10, 99, 100, 250} {
+		img.SetRGBA(x, 0, color.RGBA{v, v, v, 255})
+	}
+
+	proc := New(img).Threshold(100)
+	if proc.Err() != nil {
+		t.Fatalf("Threshold() should not error, got: %v", proc.Err())
+	}
+	gray, ok := proc.currentImage.(*image.Gray)
+	if !ok {
+		t.Fatalf("Threshold() produced %T, want *image.Gray", proc.currentImage)
+	}
+	if want := []uint8{0, 0, 255, 255}; string(gray.Pix) != string(want) {
+		t.Errorf("Threshold(100) = %v, want %v", gray.Pix, want)
+	}
+
+	// Otsu's method separates dark text from a light page.
+	page := image.NewGray(image.Rect(0, 0, 20, 20))
+	for i := range page.Pix {
+		page.Pix[i] = 200 + uint8(i%20)
+	}
+	for x := 5; x < 15; x++ {
+		page.SetGray(x, 10, color.Gray{Y: 40 + uint8(x)})
+	}
+	gray = New(page).ThresholdAuto().currentImage.(*image.Gray)
+	if gray.GrayAt(10, 10).Y != 0 || gray.GrayAt(2, 2).Y != 255 || gray.GrayAt(19, 19).Y != 255 {
+		t.Errorf("ThresholdAuto() should make text black and the page white, got text %d page %d",
+			gray.GrayAt(10, 10).Y, gray.GrayAt(2, 2).Y)
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).Threshold(128).Err() == nil {
+		t.Fatal("Threshold() on a processor with prior error should return that error")
+	}
+}
+
+func TestGrayPipeline(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			src.Pix[y*src.Stride+x] = uint8(x*2 + y)
+		}
+	}
+
+	// Resize matches draw.CatmullRom while staying grayscale.
+	for _, size := range []image.Point{{60, 40}, {37, 91}, {240, 160}} {
+		proc := New(src).Resize(size.X, size.Y)
+		gray, ok := proc.currentImage.(*image.Gray)
+		if !ok {
+			t.Fatalf("Resize() of a gray image produced %T, want *image.Gray", proc.currentImage)
+		}
+		want := image.NewRGBA(image.Rectangle{Max: size})
+		draw.CatmullRom.Scale(want, want.Rect, src, src.Rect, draw.Src, nil)
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				if d := abs(int(gray.GrayAt(x, y).Y) - int(want.RGBAAt(x, y).R)); d > 1 {
+					t.Fatalf("Resize(%v) pixel (%d, %d) = %d, want %d", size, x, y, gray.GrayAt(x, y).Y, want.RGBAAt(x, y).R)
+				}
+			}
+		}
+	}
+
+	// Every step of a document pipeline keeps 1 byte per pixel.
+	proc := New(src).Crop(10, 10, 100, 60).Resize(50, 30).Threshold(128).Dilate(1).Erode(1)
+	if proc.Err() != nil {
+		t.Fatalf("gray pipeline should not error, got: %v", proc.Err())
+	}
+	if _, ok := proc.currentImage.(*image.Gray); !ok {
+		t.Fatalf("gray pipeline produced %T, want *image.Gray", proc.currentImage)
+	}
+	if got := New(src).Crop(10, 20, 5, 5).currentImage.(*image.Gray).GrayAt(0, 0).Y; got != src.GrayAt(10, 20).Y {
+		t.Errorf("Crop() of a gray image pixel = %d, want %d", got, src.GrayAt(10, 20).Y)
+	}
+
+	// Morphology on gray images matches the RGBA result.
+	binary := New(src).Threshold(150)
+	grayDilated := binary.Clone().Dilate(2).currentImage.(*image.Gray)
+	rgbaDilated := New(asRGBA(binary.currentImage)).Dilate(2).currentImage.(*image.RGBA)
+	for i, v := range grayDilated.Pix {
+		if rgbaDilated.Pix[4*i] != v {
+			t.Fatalf("Dilate() of a gray image differs from RGBA at %d: %d vs %d", i, v, rgbaDilated.Pix[4*i])
+		}
+	}
+
+	// Gray images encode and decode as gray.
+	for _, format := range []ImageFormat{FormatPNG, FormatJPEG, FormatPGM} {
+		data, err := proc.ToBytes(format)
+		if err != nil {
+			t.Fatalf("ToBytes(%s) of a gray image should not error, got: %v", format, err)
+		}
+		if img, _ := FromBytes(data).Image(); img == nil {
+			t.Errorf("%s output should decode", format)
+		} else if _, ok := img.(*image.Gray); !ok {
+			t.Errorf("%s output decoded as %T, want *image.Gray", format, img)
+		}
+	}
+
+	// WithGrayDecode converts color input on decode.
+	jpegData, _ := imageToJPEGBytes(createTestImage(40, 30))
+	img, err := FromBytes(jpegData, WithGrayDecode()).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() with WithGrayDecode should not error, got: %v", err)
+	}
+	if _, ok := img.(*image.Gray); !ok || img.Bounds().Dx() != 40 {
+		t.Errorf("FromBytes() with WithGrayDecode produced %T %v, want a 40x30 *image.Gray", img, img.Bounds())
+	}
+	pngData, _ := imageToPNGBytes(createTestImage(40, 30))
+	img, _ = FromReaderAt(bytes.NewReader(pngData), int64(len(pngData)), WithGrayDecode()).Image()
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("FromReaderAt() with WithGrayDecode produced %T, want *image.Gray", img)
+	}
+}
@@ -0,0 +1,91 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Guide selects a set of composition guide lines for DrawGuides.
+type Guide int
+
+const (
+	GuideRuleOfThirds Guide = iota // Lines at 1/3 and 2/3 of the width and height
+	GuideGoldenRatio               // Lines at 0.382 and 0.618 of the width and height (the phi grid)
+)
+
+// goldenSection is 1/φ, the larger part of a line divided in the golden
+// ratio.
+var goldenSection = (math.Sqrt(5) - 1) / 2
+
+// guideLines returns the contours of lines across an image of the given size
+// through the pixel columns xs and rows ys.
+func guideLines(size image.Point, xs, ys []int, width float64) [][]vec2 {
+	var contours [][]vec2
+	for _, x := range xs {
+		cx := float64(x) + 0.5
+		contours = append(contours, strokeContours([]vec2{{cx, 0}, {cx, float64(size.Y)}}, width, false)...)
+	}
+	for _, y := range ys {
+		cy := float64(y) + 0.5
+		contours = append(contours, strokeContours([]vec2{{0, cy}, {float64(size.X), cy}}, width, false)...)
+	}
+	return contours
+}
+
+// fractionLines returns the pixels at the given fractions of n.
+func fractionLines(n int, fractions ...float64) []int {
+	out := make([]int, len(fractions))
+	for i, f := range fractions {
+		out[i] = min(n-1, int(float64(n)*f))
+	}
+	return out
+}
+
+// DrawGrid draws lines in color c between cells of cellW×cellH pixels,
+// starting from the image's top-left corner, e.g. to check alignment or
+// debug crop and tiling logic. The lines take up the first pixel column or
+// row of each cell after the first; WithLineWidth widens them both ways.
+// Returns the ImageProcessor for chaining. An error is set if c is nil, the
+// cell size or line width is not positive.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawGrid(cellW, cellH int, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawGrid", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		if cellW <= 0 || cellH <= 0 {
+			return nil, fmt.Errorf("grid cell size must be positive (got: %dx%d)", cellW, cellH)
+		}
+		// drawShape holds the lock.
+		size := ip.currentImage.Bounds().Size()
+		var xs, ys []int
+		for x := cellW; x < size.X; x += cellW {
+			xs = append(xs, x)
+		}
+		for y := cellH; y < size.Y; y += cellH {
+			ys = append(ys, y)
+		}
+		return guideLines(size, xs, ys, cfg.LineWidth), nil
+	})
+}
+
+// DrawGuides draws composition guide lines across the image in color c, for
+// photography tooling or to check where a crop puts the subject.
+// Returns the ImageProcessor for chaining. An error is set if c is nil, the
+// line width is not positive or guide is unknown.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) DrawGuides(guide Guide, c color.Color, opts ...DrawOption) *ImageProcessor {
+	return ip.drawShape("DrawGuides", c, opts, func(cfg *drawConfig) ([][]vec2, error) {
+		var fractions []float64
+		switch guide {
+		case GuideRuleOfThirds:
+			fractions = []float64{1.0 / 3, 2.0 / 3}
+		case GuideGoldenRatio:
+			fractions = []float64{1 - goldenSection, goldenSection}
+		default:
+			return nil, fmt.Errorf("unknown guide: %d", guide)
+		}
+		// drawShape holds the lock.
+		size := ip.currentImage.Bounds().Size()
+		return guideLines(size, fractionLines(size.X, fractions...), fractionLines(size.Y, fractions...), cfg.LineWidth), nil
+	})
+}
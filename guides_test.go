@@ -0,0 +1,97 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// markedColumns returns the columns of row y of img that are not white.
+func markedColumns(img *image.RGBA, y int) []int {
+	var xs []int
+	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+		if img.RGBAAt(x, y) != (color.RGBA{255, 255, 255, 255}) {
+			xs = append(xs, x)
+		}
+	}
+	return xs
+}
+
+// markedRows returns the rows of column x of img that are not white.
+func markedRows(img *image.RGBA, x int) []int {
+	var ys []int
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		if img.RGBAAt(x, y) != (color.RGBA{255, 255, 255, 255}) {
+			ys = append(ys, y)
+		}
+	}
+	return ys
+}
+
+func TestDrawGrid(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	img := mustImage(t, New(createUniformImage(50, 35, white)).DrawGrid(10, 10, black)).(*image.RGBA)
+	if got, want := markedColumns(img, 5), []int{10, 20, 30, 40}; !slices.Equal(got, want) {
+		t.Errorf("DrawGrid() columns = %v, want %v", got, want)
+	}
+	if got, want := markedRows(img, 5), []int{10, 20, 30}; !slices.Equal(got, want) {
+		t.Errorf("DrawGrid() rows = %v, want %v", got, want)
+	}
+	if got := img.RGBAAt(20, 0); got != black {
+		t.Errorf("DrawGrid() lines should span the image, got %v at the top edge", got)
+	}
+	if got := img.RGBAAt(20, 20); got != black {
+		t.Errorf("DrawGrid() crossing = %v, want %v", got, black)
+	}
+
+	wide := mustImage(t, New(createUniformImage(50, 35, white)).DrawGrid(25, 50, black, WithLineWidth(3))).(*image.RGBA)
+	if got, want := markedColumns(wide, 5), []int{24, 25, 26}; !slices.Equal(got, want) {
+		t.Errorf("DrawGrid() 3px columns = %v, want %v", got, want)
+	}
+	if got := markedRows(wide, 5); len(got) != 0 {
+		t.Errorf("DrawGrid() with cells taller than the image should draw no rows, got %v", got)
+	}
+}
+
+func TestDrawGuides(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	thirds := mustImage(t, New(createUniformImage(90, 60, white)).DrawGuides(GuideRuleOfThirds, black)).(*image.RGBA)
+	if got, want := markedColumns(thirds, 5), []int{30, 60}; !slices.Equal(got, want) {
+		t.Errorf("DrawGuides(GuideRuleOfThirds) columns = %v, want %v", got, want)
+	}
+	if got, want := markedRows(thirds, 5), []int{20, 40}; !slices.Equal(got, want) {
+		t.Errorf("DrawGuides(GuideRuleOfThirds) rows = %v, want %v", got, want)
+	}
+
+	golden := mustImage(t, New(createUniformImage(100, 50, white)).DrawGuides(GuideGoldenRatio, black)).(*image.RGBA)
+	if got, want := markedColumns(golden, 5), []int{38, 61}; !slices.Equal(got, want) {
+		t.Errorf("DrawGuides(GuideGoldenRatio) columns = %v, want %v", got, want)
+	}
+	if got, want := markedRows(golden, 5), []int{19, 30}; !slices.Equal(got, want) {
+		t.Errorf("DrawGuides(GuideGoldenRatio) rows = %v, want %v", got, want)
+	}
+}
+
+func TestGuidesInvalidInput(t *testing.T) {
+	img := createTestImage(20, 20)
+
+	// Test case: Invalid input
+	cases := map[string]*ImageProcessor{
+		"zero cell width":     New(img).DrawGrid(0, 10, color.Black),
+		"negative cell":       New(img).DrawGrid(10, -1, color.Black),
+		"nil grid color":      New(img).DrawGrid(5, 5, nil),
+		"unknown guide":       New(img).DrawGuides(Guide(42), color.Black),
+		"nil guide color":     New(img).DrawGuides(GuideRuleOfThirds, nil),
+		"non-positive widths": New(img).DrawGuides(GuideGoldenRatio, color.Black, WithLineWidth(0)),
+	}
+	for name, proc := range cases {
+		if proc.Err() == nil {
+			t.Errorf("%s should return an error", name)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// Histogram holds per-channel value counts of an image. Transparent pixels
+// are not counted.
+type Histogram struct {
+	Red, Green, Blue, Luma [256]int
+	Pixels                 int // Number of counted pixels
+}
+
+// Histogram computes the RGB and luma histograms of the current image.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Histogram() (*Histogram, error) {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return nil, ip.err
+	}
+	return computeHistogram(ip.currentImage), nil
+}
+
+// computeHistogram counts the straight-alpha channel values of img.
+func computeHistogram(img image.Image) *Histogram {
+	src := asRGBA(img)
+	h := &Histogram{}
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < height; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+width*4]
+		for i := 0; i < len(row); i += 4 {
+			a := row[i+3]
+			if a == 0 {
+				continue
+			}
+			r, g, b := unpremultiply(row[i], a), unpremultiply(row[i+1], a), unpremultiply(row[i+2], a)
+			h.Red[r]++
+			h.Green[g]++
+			h.Blue[b]++
+			h.Luma[clampUint8(luminance(r, g, b))]++
+			h.Pixels++
+		}
+	}
+	return h
+}
+
+// HistogramChannels selects which channels RenderHistogram draws.
+type HistogramChannels int
+
+const (
+	HistogramRGB  HistogramChannels = 1 << iota // Red, green and blue overlaid
+	HistogramLuma                               // Luminance (BT.709)
+)
+
+// histogramConfig holds configuration for RenderHistogram.
+type histogramConfig struct {
+	Width, Height int
+	Channels      HistogramChannels
+	Background    color.Color
+	LogScale      bool
+}
+
+// HistogramOption is a functional option for configuring RenderHistogram.
+type HistogramOption func(*histogramConfig)
+
+// WithHistogramSize sets the chart dimensions in pixels (default 512x200).
+// Charts narrower than 256 pixels draw the tallest of the values that share
+// a column.
+func WithHistogramSize(width, height int) HistogramOption {
+	return func(hc *histogramConfig) { hc.Width = width; hc.Height = height }
+}
+
+// WithHistogramChannels selects the channels to draw (default RGB and luma).
+func WithHistogramChannels(ch HistogramChannels) HistogramOption {
+	return func(hc *histogramConfig) { hc.Channels = ch }
+}
+
+// WithHistogramBackground sets the chart background color.
+func WithHistogramBackground(c color.Color) HistogramOption {
+	return func(hc *histogramConfig) { hc.Background = c }
+}
+
+// WithLogScale scales bar heights logarithmically so that small counts stay
+// visible next to dominant values.
+func WithLogScale() HistogramOption {
+	return func(hc *histogramConfig) { hc.LogScale = true }
+}
+
+// RenderHistogram draws the histogram of the current image as a chart and
+// returns it in a new ImageProcessor, leaving this processor unchanged.
+// RGB channels are drawn as translucent overlapping areas, luma as a white
+// outline. The returned processor carries any error of this processor or an
+// error for invalid chart dimensions or a nil background.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) RenderHistogram(options ...HistogramOption) *ImageProcessor {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+
+	if ip.err != nil {
+		return &ImageProcessor{err: ip.err}
+	}
+
+	cfg := &histogramConfig{
+		Width:      512,
+		Height:     200,
+		Channels:   HistogramRGB | HistogramLuma,
+		Background: color.RGBA{20, 20, 24, 255},
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return &ImageProcessor{err: fmt.Errorf("histogram dimensions must be positive (width: %d, height: %d)", cfg.Width, cfg.Height)}
+	}
+	if cfg.Background == nil {
+		return &ImageProcessor{err: fmt.Errorf("histogram background color cannot be nil")}
+	}
+
+	hist := computeHistogram(ip.currentImage)
+	chart := newRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	draw.Draw(chart, chart.Bounds(), image.NewUniform(cfg.Background), image.Point{}, draw.Src)
+
+	var channels []*[256]int
+	if cfg.Channels&HistogramRGB != 0 {
+		channels = append(channels, &hist.Red, &hist.Green, &hist.Blue)
+	}
+	if cfg.Channels&HistogramLuma != 0 {
+		channels = append(channels, &hist.Luma)
+	}
+	peak := 0
+	for _, ch := range channels {
+		for _, n := range ch {
+			peak = max(peak, n)
+		}
+	}
+	if peak == 0 {
+		return &ImageProcessor{currentImage: chart, perfOpts: ip.perfOpts, encOpts: ip.encOpts.clone(), size: chart.Bounds().Size()}
+	}
+
+	scale := func(n int) int {
+		if cfg.LogScale {
+			return int(math.Log1p(float64(n)) / math.Log1p(float64(peak)) * float64(cfg.Height))
+		}
+		return n * cfg.Height / peak
+	}
+
+	// barHeights returns the bar height of every chart column for ch.
+	barHeights := func(ch *[256]int) []int {
+		heights := make([]int, cfg.Width)
+		for x := range heights {
+			// Columns of narrow charts span several values.
+			lo := x * 256 / cfg.Width
+			hi := max((x+1)*256/cfg.Width, lo+1)
+			heights[x] = scale(slices.Max(ch[lo:hi]))
+		}
+		return heights
+	}
+
+	if cfg.Channels&HistogramRGB != 0 {
+		for i, c := range []color.Color{
+			color.NRGBA{255, 40, 40, 110},
+			color.NRGBA{40, 255, 40, 110},
+			color.NRGBA{60, 90, 255, 110},
+		} {
+			src := image.NewUniform(c)
+			for x, h := range barHeights(channels[i]) {
+				draw.Draw(chart, image.Rect(x, cfg.Height-h, x+1, cfg.Height), src, image.Point{}, draw.Over)
+			}
+		}
+	}
+	if cfg.Channels&HistogramLuma != 0 {
+		prev := -1
+		for x, h := range barHeights(&hist.Luma) {
+			y := cfg.Height - max(h, 1)
+			top, bottom := y, y+1
+			if prev >= 0 {
+				// Connect to the previous column so steep edges stay visible.
+				top, bottom = min(y, prev), max(y, prev)+1
+			}
+			draw.Draw(chart, image.Rect(x, top, x+1, bottom), image.White, image.Point{}, draw.Src)
+			prev = y
+		}
+	}
+
+	return &ImageProcessor{currentImage: chart, perfOpts: ip.perfOpts, encOpts: ip.encOpts.clone(), size: chart.Bounds().Size()}
+}
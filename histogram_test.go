@@ -0,0 +1,86 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	originalImg.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	originalImg.Set(1, 0, color.RGBA{255, 0, 0, 255})
+	originalImg.Set(2, 0, color.RGBA{0, 0, 255, 255})
+	// (3,0) stays transparent and is not counted.
+
+	hist, err := New(originalImg).Histogram()
+	if err != nil {
+		t.Fatalf("Histogram() should not error, got: %v", err)
+	}
+	if hist.Pixels != 3 {
+		t.Errorf("Histogram() counted %d pixels, want 3", hist.Pixels)
+	}
+	if hist.Red[255] != 2 || hist.Red[0] != 1 || hist.Blue[255] != 1 || hist.Green[0] != 3 {
+		t.Errorf("Histogram() channel counts are wrong: R255=%d R0=%d B255=%d G0=%d",
+			hist.Red[255], hist.Red[0], hist.Blue[255], hist.Green[0])
+	}
+	if hist.Luma[54] != 2 {
+		t.Errorf("Histogram() luma of pure red should fall in bin 54, got %d", hist.Luma[54])
+	}
+
+	if _, err := New(nil).Histogram(); err == nil {
+		t.Fatal("Histogram() on a processor with prior error should return that error")
+	}
+}
+
+func TestRenderHistogram(t *testing.T) {
+	proc := New(createLargeTestImage(100, 100))
+	chart := proc.RenderHistogram()
+	if chart.Err() != nil {
+		t.Fatalf("RenderHistogram() should not error, got: %v", chart.Err())
+	}
+	if size := chart.currentImage.Bounds().Size(); size != (image.Point{512, 200}) {
+		t.Errorf("RenderHistogram() default size = %v, want 512x200", size)
+	}
+	if proc.currentImage.Bounds().Dx() != 100 {
+		t.Error("RenderHistogram() must not modify the source processor")
+	}
+
+	chart = proc.RenderHistogram(
+		WithHistogramSize(256, 100),
+		WithHistogramChannels(HistogramLuma),
+		WithHistogramBackground(color.Black),
+		WithLogScale(),
+	)
+	if chart.Err() != nil {
+		t.Fatalf("RenderHistogram() with options should not error, got: %v", chart.Err())
+	}
+	white := 0
+	img := chart.currentImage.(*image.RGBA)
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] == 255 && img.Pix[i+1] == 255 && img.Pix[i+2] == 255 {
+			white++
+		}
+	}
+	if white == 0 {
+		t.Error("RenderHistogram() luma chart should draw a white outline")
+	}
+
+	// Narrow charts merge values into columns instead of dropping them.
+	narrow := New(createUniformImage(10, 10, color.RGBA{1, 1, 1, 255})).RenderHistogram(
+		WithHistogramSize(128, 50), WithHistogramChannels(HistogramRGB), WithHistogramBackground(color.Black))
+	if got := color.RGBAModel.Convert(mustImage(t, narrow).At(0, 49)); got == (color.RGBA{0, 0, 0, 255}) {
+		t.Error("RenderHistogram() narrower than 256 pixels should draw the value 1 in the first column")
+	}
+
+	// Test case: Invalid input
+	if proc.RenderHistogram(WithHistogramBackground(nil)).Err() == nil {
+		t.Error("RenderHistogram() with a nil background should return an error")
+	}
+	if proc.RenderHistogram(WithHistogramSize(0, 10)).Err() == nil {
+		t.Error("RenderHistogram() with zero width should return an error")
+	}
+	if New(nil).RenderHistogram().Err() == nil {
+		t.Fatal("RenderHistogram() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,143 @@
+package gopiq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+)
+
+const (
+	// iccPrefix starts JPEG APP2 segments holding a part of an ICC profile,
+	// followed by the 1-based number of the part and the number of parts.
+	iccPrefix = "ICC_PROFILE\x00"
+	// jpegAPP2 is the marker of JPEG segments holding an ICC profile.
+	jpegAPP2 = 0xe2
+	// iccPartSize is the most profile data a JPEG segment holds.
+	iccPartSize = 0xffff - 2 - len(iccPrefix) - 2
+	// webpICCFlag is the flag of the VP8X chunk for an ICCP chunk.
+	webpICCFlag = 0x20
+	// maxICCSize bounds the decompressed size of PNG iCCP profiles.
+	maxICCSize = 16 << 20
+)
+
+// validICC reports whether p looks like an ICC profile: it has a header
+// with the profile file signature.
+func validICC(p []byte) bool {
+	return len(p) >= 128 && string(p[36:40]) == "acsp"
+}
+
+// iccColorSpace returns the data color space of an ICC profile, such as
+// "RGB " or "GRAY".
+func iccColorSpace(icc []byte) string {
+	return string(icc[16:20])
+}
+
+// appendICCPart adds the APP2 segment payload p of a JPEG to the parts of
+// an ICC profile, indexed by their number. Payloads of other APP2 segments
+// are ignored.
+func appendICCPart(parts [][]byte, p []byte) [][]byte {
+	rest, ok := bytes.CutPrefix(p, []byte(iccPrefix))
+	if !ok || len(rest) < 2 || rest[0] == 0 || rest[0] > rest[1] {
+		return parts
+	}
+	if parts == nil {
+		parts = make([][]byte, rest[1])
+	}
+	if int(rest[1]) == len(parts) && parts[rest[0]-1] == nil {
+		parts[rest[0]-1] = rest[2:]
+	}
+	return parts
+}
+
+// joinICCParts returns the ICC profile of the parts collected by
+// appendICCPart, or nil if parts are missing.
+func joinICCParts(parts [][]byte) []byte {
+	if len(parts) == 0 || slices.ContainsFunc(parts, func(p []byte) bool { return p == nil }) {
+		return nil
+	}
+	if icc := slices.Concat(parts...); validICC(icc) {
+		return icc
+	}
+	return nil
+}
+
+// pngICC returns the ICC profile of the data of an iCCP chunk: a profile
+// name, a compression method of 0 and the zlib-compressed profile.
+func pngICC(p []byte) []byte {
+	_, rest, ok := bytes.Cut(p, []byte{0})
+	if !ok || len(rest) < 1 || rest[0] != 0 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest[1:]))
+	if err != nil {
+		return nil
+	}
+	icc, err := io.ReadAll(io.LimitReader(zr, maxICCSize))
+	if err != nil || !validICC(icc) {
+		return nil
+	}
+	return icc
+}
+
+// iccFits reports whether the ICC profile describes the colors of img
+// encoded in format: grayscale JPEG and PNG output of a grayscale image
+// needs a gray profile, and all other output an RGB one.
+func iccFits(icc []byte, img image.Image, format ImageFormat) bool {
+	gray := false
+	switch img.(type) {
+	case *image.Gray:
+		gray = format == FormatJPEG || format == FormatPNG
+	case *image.Gray16:
+		gray = format == FormatPNG
+	}
+	if gray {
+		return iccColorSpace(icc) == "GRAY"
+	}
+	return iccColorSpace(icc) == "RGB "
+}
+
+// embedICC inserts an ICC profile into encoded image data of format: APP2
+// segments right after the SOI marker of a JPEG, an iCCP chunk right after
+// the IHDR chunk of a PNG, and an ICCP chunk right after the VP8X chunk of
+// a WebP file, which gets one if needed. Other formats are returned as
+// they are.
+func embedICC(data []byte, format ImageFormat, icc []byte) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		chunks := slices.Collect(slices.Chunk(icc, iccPartSize))
+		if len(chunks) > 255 {
+			return nil, fmt.Errorf("ICC profile of %d bytes does not fit in JPEG segments", len(icc))
+		}
+		var segments []byte
+		for i, c := range chunks {
+			segments = appendJPEGSegment(segments, jpegAPP2, slices.Concat([]byte(iccPrefix), []byte{byte(i + 1), byte(len(chunks))}, c)...)
+		}
+		return slices.Concat(data[:2], segments, data[2:]), nil
+	case FormatPNG:
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(icc)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		chunk := appendPNGChunk(nil, "iCCP", append([]byte("ICC Profile\x00\x00"), z.Bytes()...))
+		return slices.Concat(data[:pngIHDREnd], chunk, data[pngIHDREnd:]), nil
+	case FormatWebP:
+		chunks, err := readWebPChunks(data[12:])
+		if err != nil || len(chunks) == 0 {
+			return nil, fmt.Errorf("failed to add ICC profile to WebP: %v", err)
+		}
+		if chunks, err = webpWithFlags(chunks, webpICCFlag); err != nil {
+			return nil, err
+		}
+		chunks = slices.Insert(chunks, 1, webpChunk{"ICCP", icc})
+		var buf bytes.Buffer
+		err = writeWebPContainer(&buf, chunks...)
+		return buf.Bytes(), err
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,112 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testICC returns an ICC profile of n bytes for the color space, such as
+// "RGB " or "GRAY", with a header and otherwise patterned data.
+func testICC(space string, n int) []byte {
+	icc := make([]byte, n)
+	for i := range icc {
+		icc[i] = byte(i * 7)
+	}
+	copy(icc[16:], space)
+	copy(icc[36:], "acsp")
+	return icc
+}
+
+func TestICCProfile(t *testing.T) {
+	// Large enough to be split into two JPEG segments.
+	icc := testICC("RGB ", 70000)
+	src, err := embedICC(mustBytes(t, New(gradientImage(24, 16)), FormatJPEG), FormatJPEG, icc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(src, []byte(iccPrefix)); n != 2 {
+		t.Fatalf("embedICC() wrote %d JPEG segments, want 2", n)
+	}
+	proc := FromBytes(src)
+	if !bytes.Equal(proc.meta.icc, icc) {
+		t.Fatal("FromBytes() should read the ICC profile of a JPEG")
+	}
+
+	cases := map[string]struct {
+		format ImageFormat
+		opts   []EncodeOption
+	}{
+		"jpeg":          {FormatJPEG, nil},
+		"png":           {FormatPNG, nil},
+		"stripped png":  {FormatPNG, []EncodeOption{WithStripMetadata()}},
+		"lossy webp":    {FormatWebP, nil},
+		"lossless webp": {FormatWebP, []EncodeOption{WithWebPLossless(), WithKeepMetadata()}},
+	}
+	for name, c := range cases {
+		data := mustBytes(t, proc.Clone().Resize(12, 8), c.format, c.opts...)
+		if !bytes.Equal(metadataOf(data).icc, icc) {
+			t.Errorf("%s output after Resize should keep the ICC profile", name)
+		}
+		var decode func([]byte) (image.Image, error)
+		switch c.format {
+		case FormatJPEG:
+			decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		case FormatPNG:
+			decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		case FormatWebP:
+			decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+		}
+		if img, err := decode(data); err != nil || img.Bounds().Dx() != 12 {
+			t.Errorf("%s output with an ICC profile does not decode: %v", name, err)
+		}
+	}
+	// A PNG profile is read back as well.
+	if got := FromBytes(mustBytes(t, proc, FormatPNG)).meta.icc; !bytes.Equal(got, icc) {
+		t.Error("FromBytes() should read the ICC profile of a PNG")
+	}
+	// Formats without profiles are written as they are.
+	if _, err := proc.ToBytes(FormatTGA); err != nil {
+		t.Errorf("ToBytes(FormatTGA) with an ICC profile should not error, got: %v", err)
+	}
+
+	// A profile is only written for output in its color space.
+	gray := &ImageProcessor{currentImage: image.NewGray(image.Rect(0, 0, 8, 8)), meta: imageMetadata{icc: icc}}
+	if metadataOf(mustBytes(t, gray, FormatPNG)).icc != nil {
+		t.Error("grayscale PNG output should not get an RGB profile")
+	}
+	if metadataOf(mustBytes(t, gray, FormatWebP)).icc == nil {
+		t.Error("WebP output of a grayscale image is RGB and should get an RGB profile")
+	}
+	gray.meta.icc = testICC("GRAY", 300)
+	if !bytes.Equal(metadataOf(mustBytes(t, gray, FormatJPEG)).icc, gray.meta.icc) {
+		t.Error("grayscale JPEG output should get a gray profile")
+	}
+
+	// Test case: Invalid input
+	var last [2]int64
+	jpegSegments(bytes.NewReader(src), int64(len(src)), func(marker byte, off, n int64) {
+		if marker == jpegAPP2 {
+			last = [2]int64{off, off + n}
+		}
+	})
+	if FromBytes(slices.Concat(src[:last[0]], src[last[1]:])).meta.icc != nil {
+		t.Error("FromBytes() should skip an ICC profile with a missing JPEG segment")
+	}
+	bad := appendPNGChunk(nil, "iCCP", []byte("ICC Profile\x00\x00not zlib"))
+	pngData := mustBytes(t, New(gradientImage(4, 4)), FormatPNG)
+	if FromBytes(slices.Concat(pngData[:pngIHDREnd], bad, pngData[pngIHDREnd:])).meta.icc != nil {
+		t.Error("FromBytes() should skip a damaged iCCP chunk")
+	}
+	if joinICCParts([][]byte{make([]byte, 200)}) != nil {
+		t.Error("joinICCParts() should reject data without a profile signature")
+	}
+	if _, err := embedICC(src, FormatJPEG, testICC("RGB ", 256*iccPartSize)); err == nil {
+		t.Error("embedICC() with a profile too large for JPEG should return an error")
+	}
+}
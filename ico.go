@@ -0,0 +1,289 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", decodeICO, decodeICOConfig)
+}
+
+// defaultICOSizes are the icon sizes written unless set with WithICOSizes:
+// those of browser tabs, taskbars and desktop shortcuts.
+var defaultICOSizes = []int{16, 32, 48}
+
+// WithICOSizes sets the square sizes, from 1 to 256 pixels, of the images
+// in ICO output; the default is 16, 32 and 48, as favicons use. The image
+// is scaled to each size, keeping its aspect ratio with transparent
+// margins. Encoding fails for sizes out of range or given twice.
+func WithICOSizes(sizes ...int) EncodeOption {
+	return func(eo *EncodeOptions) { eo.ICOSizes = slices.Clone(sizes) }
+}
+
+// icoEntry is an image of an ICO file as listed in its directory.
+type icoEntry struct {
+	width, height int // 256 when stored as 0
+	bitCount      int
+	data          []byte // A PNG file or a DIB without file header
+}
+
+// readICO reads the directory of an ICO file and the data of its images.
+func readICO(r io.Reader) ([]icoEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 || !bytes.HasPrefix(data, []byte("\x00\x00\x01\x00")) {
+		return nil, fmt.Errorf("ico: not an icon file")
+	}
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if n == 0 || len(data) < 6+16*n {
+		return nil, fmt.Errorf("ico: directory of %d images is empty or truncated", n)
+	}
+	entries := make([]icoEntry, n)
+	for i := range entries {
+		d := data[6+16*i:]
+		size, offset := binary.LittleEndian.Uint32(d[8:]), binary.LittleEndian.Uint32(d[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("ico: image %d lies beyond the end of the file", i)
+		}
+		entries[i] = icoEntry{
+			width:    (int(d[0])+255)%256 + 1,
+			height:   (int(d[1])+255)%256 + 1,
+			bitCount: int(binary.LittleEndian.Uint16(d[6:])),
+			data:     data[offset : offset+size],
+		}
+	}
+	return entries, nil
+}
+
+// largestICOEntry returns the largest image of an ICO file, the one with
+// the most colors among equally large ones.
+func largestICOEntry(r io.Reader) (icoEntry, error) {
+	entries, err := readICO(r)
+	if err != nil {
+		return icoEntry{}, err
+	}
+	return slices.MaxFunc(entries, func(a, b icoEntry) int {
+		if d := a.width*a.height - b.width*b.height; d != 0 {
+			return d
+		}
+		return a.bitCount - b.bitCount
+	}), nil
+}
+
+// dibHeader is the part of a BITMAPINFOHEADER icons use.
+type dibHeader struct {
+	size, width, height, bitCount, colors int
+}
+
+// readDIBHeader parses the header of an icon's DIB, whose height covers
+// the color rows and the transparency mask.
+func readDIBHeader(data []byte) (dibHeader, error) {
+	if len(data) < 40 {
+		return dibHeader{}, fmt.Errorf("ico: truncated bitmap header")
+	}
+	h := dibHeader{
+		size:     int(binary.LittleEndian.Uint32(data)),
+		width:    int(int32(binary.LittleEndian.Uint32(data[4:]))),
+		height:   int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2,
+		bitCount: int(binary.LittleEndian.Uint16(data[14:])),
+		colors:   int(binary.LittleEndian.Uint32(data[32:])),
+	}
+	if h.size < 40 || h.size > len(data) {
+		return h, fmt.Errorf("ico: invalid bitmap header size %d", h.size)
+	}
+	if h.width <= 0 || h.height <= 0 || h.width > 1<<14 || h.height > 1<<14 {
+		return h, fmt.Errorf("ico: invalid bitmap size %dx%d", h.width, h.height)
+	}
+	if compression := binary.LittleEndian.Uint32(data[16:]); compression != 0 && !(compression == 3 && h.bitCount == 32) {
+		return h, fmt.Errorf("ico: unsupported bitmap compression %d", compression)
+	}
+	if !slices.Contains([]int{1, 4, 8, 24, 32}, h.bitCount) {
+		return h, fmt.Errorf("ico: unsupported bitmap depth %d", h.bitCount)
+	}
+	if h.bitCount <= 8 && (h.colors == 0 || h.colors > 1<<h.bitCount) {
+		h.colors = 1 << h.bitCount
+	}
+	return h, nil
+}
+
+// decodeDIB decodes the bottom-up DIB of an icon. Pixels are transparent
+// where the mask that follows the colors says so, unless 32-bit pixels
+// have an alpha channel of their own.
+func decodeDIB(data []byte) (image.Image, error) {
+	h, err := readDIBHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// Bitmaps of more than 8 bits may list colors too, which are unused.
+	if len(data)-h.size < 4*h.colors {
+		return nil, fmt.Errorf("ico: truncated palette")
+	}
+	palette := data[h.size : h.size+4*h.colors]
+	pixels := data[h.size+4*h.colors:]
+	stride := (h.width*h.bitCount + 31) / 32 * 4
+	maskStride := (h.width + 31) / 32 * 4
+	if len(pixels) < stride*h.height {
+		return nil, fmt.Errorf("ico: truncated bitmap")
+	}
+	mask := pixels[stride*h.height:]
+	if len(mask) < maskStride*h.height {
+		mask = nil // Often left out of 32-bit icons, which are then opaque
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, h.width, h.height))
+	hasAlpha := false
+	for y := range h.height {
+		row := pixels[(h.height-1-y)*stride:]
+		for x := range h.width {
+			var c color.NRGBA
+			switch h.bitCount {
+			case 32:
+				c = color.NRGBA{row[4*x+2], row[4*x+1], row[4*x], row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{row[3*x+2], row[3*x+1], row[3*x], 255}
+			default:
+				bit := x * h.bitCount
+				i := int(row[bit/8]>>(8-h.bitCount-bit%8)) & (1<<h.bitCount - 1)
+				if i >= h.colors {
+					return nil, fmt.Errorf("ico: color %d is not in the palette", i)
+				}
+				p := palette[4*i:]
+				c = color.NRGBA{p[2], p[1], p[0], 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	if h.bitCount == 32 && hasAlpha {
+		return img, nil
+	}
+	for y := range h.height {
+		for x := range h.width {
+			a := uint8(255)
+			if mask != nil && mask[(h.height-1-y)*maskStride+x/8]>>(7-x%8)&1 != 0 {
+				a = 0
+			}
+			img.Pix[img.PixOffset(x, y)+3] = a
+		}
+	}
+	return img, nil
+}
+
+// decodeICO decodes the largest image of an ICO file.
+func decodeICO(r io.Reader) (image.Image, error) {
+	e, err := largestICOEntry(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(e.data, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(e.data))
+	}
+	return decodeDIB(e.data)
+}
+
+// decodeICOConfig returns the dimensions of the largest image of an ICO
+// file.
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	e, err := largestICOEntry(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if bytes.HasPrefix(e.data, []byte("\x89PNG")) {
+		return png.DecodeConfig(bytes.NewReader(e.data))
+	}
+	h, err := readDIBHeader(e.data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: h.width, Height: h.height}, nil
+}
+
+// encodeDIB returns img as the 32-bit DIB of an icon, with a mask that
+// marks its fully transparent pixels for readers that ignore alpha.
+func encodeDIB(img *image.RGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	maskStride := (w + 31) / 32 * 4
+	out := make([]byte, 40, 40+4*w*h+maskStride*h)
+	binary.LittleEndian.PutUint32(out, 40)
+	binary.LittleEndian.PutUint32(out[4:], uint32(w))
+	binary.LittleEndian.PutUint32(out[8:], uint32(2*h)) // Colors and mask
+	binary.LittleEndian.PutUint16(out[12:], 1)          // Planes
+	binary.LittleEndian.PutUint16(out[14:], 32)
+	binary.LittleEndian.PutUint32(out[20:], uint32(4*w*h+maskStride*h))
+	for y := h - 1; y >= 0; y-- {
+		row := img.Pix[img.PixOffset(0, y):][:4*w]
+		for i := 0; i < len(row); i += 4 {
+			a := row[i+3]
+			out = append(out, unpremultiply(row[i+2], a), unpremultiply(row[i+1], a), unpremultiply(row[i], a), a)
+		}
+	}
+	for y := h - 1; y >= 0; y-- {
+		mask := make([]byte, maskStride)
+		for x := range w {
+			if img.Pix[img.PixOffset(x, y)+3] == 0 {
+				mask[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		out = append(out, mask...)
+	}
+	return out
+}
+
+// encodeICO writes img as an icon with an image of each of sizes: 32-bit
+// bitmaps for the small ones, which every reader supports, and PNG for 256
+// pixels, where bitmaps would be large. Non-square images are fitted inside
+// each square with transparent margins rather than stretched.
+func encodeICO(w io.Writer, img image.Image, sizes []int) error {
+	if sizes == nil {
+		sizes = defaultICOSizes
+	}
+	if len(sizes) == 0 {
+		return fmt.Errorf("ICO needs at least one size")
+	}
+	for i, s := range sizes {
+		if s < 1 || s > 256 {
+			return fmt.Errorf("ICO sizes must be between 1 and 256 (got: %d)", s)
+		}
+		if slices.Contains(sizes[:i], s) {
+			return fmt.Errorf("ICO size %d is given twice", s)
+		}
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("cannot encode an empty image as ICO")
+	}
+
+	dir := []byte{0, 0, 1, 0, byte(len(sizes)), byte(len(sizes) >> 8)}
+	var images []byte
+	for _, s := range sizes {
+		icon := newRGBA(image.Rect(0, 0, s, s))
+		draw.CatmullRom.Scale(icon, fitRect(b.Size(), icon.Rect), img, b, draw.Over, nil)
+		data := encodeDIB(icon)
+		if s == 256 {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, icon); err != nil {
+				return err
+			}
+			data = buf.Bytes()
+		}
+		dir = append(dir, byte(s), byte(s), 0, 0) // 256 is stored as 0; no palette
+		dir = binary.LittleEndian.AppendUint16(dir, 1)
+		dir = binary.LittleEndian.AppendUint16(dir, 32)
+		dir = binary.LittleEndian.AppendUint32(dir, uint32(len(data)))
+		dir = binary.LittleEndian.AppendUint32(dir, uint32(6+16*len(sizes)+len(images)))
+		images = append(images, data...)
+	}
+	_, err := w.Write(append(dir, images...))
+	return err
+}
@@ -0,0 +1,141 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// paletteICO returns a 2×2 icon of 8-bit palette colors, red and blue, with
+// its top-left pixel made transparent by the mask.
+func paletteICO() []byte {
+	dib := make([]byte, 40)
+	binary.LittleEndian.PutUint32(dib, 40)
+	binary.LittleEndian.PutUint32(dib[4:], 2)
+	binary.LittleEndian.PutUint32(dib[8:], 4)
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], 8)
+	binary.LittleEndian.PutUint32(dib[32:], 2)
+	dib = append(dib, 0, 0, 255, 0, 255, 0, 0, 0) // Red and blue, as BGRX
+	dib = append(dib, 0, 0, 0, 0, 0, 1, 0, 0)     // Rows bottom-up, padded to 4 bytes
+	dib = append(dib, 0, 0, 0, 0, 0x80, 0, 0, 0)  // Mask, bottom-up
+	ico := []byte{0, 0, 1, 0, 1, 0, 2, 2, 2, 0, 1, 0, 8, 0}
+	ico = binary.LittleEndian.AppendUint32(ico, uint32(len(dib)))
+	ico = binary.LittleEndian.AppendUint32(ico, 22)
+	return append(ico, dib...)
+}
+
+func TestToBytesICO(t *testing.T) {
+	data, err := New(createTestImage(64, 64)).ToBytes(FormatICO)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatICO) should not error, got: %v", err)
+	}
+	if DetectFormat(data) != FormatICO || FormatFromString("ico") != FormatICO || FormatICO.String() != "ico" {
+		t.Error("FormatICO should be detected and named ico")
+	}
+	entries, err := readICO(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{16, 32, 48} {
+		if i >= len(entries) || entries[i].width != want || entries[i].height != want {
+			t.Fatalf("icon images = %v, want 16, 32 and 48 pixels", entries)
+		}
+	}
+	info, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil || info != (ImageInfo{Width: 48, Height: 48, Format: FormatICO}) {
+		t.Errorf("ProbeReaderAt() = %+v, %v, want the largest image of 48x48", info, err)
+	}
+
+	// A 256-pixel image is stored as PNG; a wide source gets transparent
+	// margins above and below.
+	data, err = New(createTestImage(80, 40)).ToBytes(FormatICO, WithICOSizes(16, 256))
+	if err != nil {
+		t.Fatalf("ToBytes(FormatICO) with sizes should not error, got: %v", err)
+	}
+	entries, _ = readICO(bytes.NewReader(data))
+	if len(entries) != 2 || !bytes.HasPrefix(entries[1].data, []byte("\x89PNG")) {
+		t.Fatal("256-pixel icon image should be stored as PNG")
+	}
+	img := mustImage(t, FromBytes(data))
+	if img.Bounds() != image.Rect(0, 0, 256, 256) {
+		t.Fatalf("FromBytes() of an icon decoded %v, want the largest image of 256x256", img.Bounds())
+	}
+	if _, _, _, a := img.At(128, 10).RGBA(); a != 0 {
+		t.Errorf("margin above a wide image has alpha %d, want transparent", a>>8)
+	}
+	if _, _, _, a := img.At(128, 128).RGBA(); a != 0xffff {
+		t.Errorf("center of the icon has alpha %d, want opaque", a>>8)
+	}
+
+	// An extreme aspect ratio is kept rather than stretched: a 300x2 strip
+	// becomes a single row across the middle of each icon.
+	data, err = New(createUniformImage(300, 2, color.RGBA{255, 0, 0, 255})).ToBytes(FormatICO)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatICO) of a strip should not error, got: %v", err)
+	}
+	strip := mustImage(t, FromBytes(data))
+	for y := range 48 {
+		want := uint32(0)
+		if y == 23 {
+			want = 255
+		}
+		if _, _, _, a := strip.At(24, y).RGBA(); a>>8 != want {
+			t.Errorf("row %d of a 48-pixel icon of a strip has alpha %d, want %d", y, a>>8, want)
+		}
+	}
+
+	// Test case: Invalid input
+	for _, sizes := range [][]int{{}, {0}, {257}, {16, 16}} {
+		if _, err := New(createTestImage(8, 8)).ToBytes(FormatICO, WithICOSizes(sizes...)); err == nil {
+			t.Errorf("ToBytes(FormatICO) with sizes %v should return an error", sizes)
+		}
+	}
+}
+
+func TestDecodeICO(t *testing.T) {
+	// 32-bit bitmaps keep their alpha.
+	src := createUniformImage(16, 16, color.RGBA{0, 100, 0, 255})
+	src.SetRGBA(3, 3, color.RGBA{0, 50, 0, 128})
+	src.SetRGBA(4, 4, color.RGBA{})
+	data, err := New(src).ToBytes(FormatICO, WithICOSizes(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := mustImage(t, FromBytes(data))
+	for _, p := range []image.Point{{0, 0}, {3, 3}, {4, 4}} {
+		got, want := color.RGBAModel.Convert(img.At(p.X, p.Y)).(color.RGBA), src.RGBAAt(p.X, p.Y)
+		if got.A != want.A || abs(int(got.G)-int(want.G)) > 1 {
+			t.Errorf("icon pixel at %v = %v, want %v", p, got, want)
+		}
+	}
+
+	// Palette bitmaps are transparent where the mask says so.
+	img = mustImage(t, FromBytes(paletteICO()))
+	checks := map[image.Point]color.RGBA{
+		{0, 0}: {},
+		{1, 0}: {0, 0, 255, 255},
+		{0, 1}: {255, 0, 0, 255},
+		{1, 1}: {255, 0, 0, 255},
+	}
+	for p, want := range checks {
+		if got := color.RGBAModel.Convert(img.At(p.X, p.Y)); got != want {
+			t.Errorf("palette icon pixel at %v = %v, want %v", p, got, want)
+		}
+	}
+
+	// Test case: Invalid input
+	bad := paletteICO()
+	bad[70] = 5 // A color beyond the palette
+	for name, data := range map[string][]byte{
+		"truncated": paletteICO()[:40],
+		"no images": {0, 0, 1, 0, 0, 0},
+		"bad color": bad,
+	} {
+		if err := FromBytes(data).Err(); err == nil {
+			t.Errorf("FromBytes() of an icon with %s should return an error", name)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// The JPEG encoder below writes what image/jpeg cannot: progressive files
+// and chroma subsampling other than 4:2:0. It uses the same quantization
+// tables as image/jpeg, so qualities compare. Progressive files send the
+// coefficients in scans that refine the whole image: first the DC (an
+// eighth-size preview), then the lowest luma frequencies, the chroma, and
+// the remaining luma detail. Every scan gets Huffman tables optimized for
+// it, which usually makes the file smaller than one from image/jpeg.
+
+// WithProgressiveJPEG makes JPEG output progressive, so browsers show a
+// coarse version of the whole image after a fraction of the file and refine
+// it as the rest arrives, instead of drawing it top to bottom.
+func WithProgressiveJPEG() EncodeOption {
+	return func(eo *EncodeOptions) { eo.JPEGProgressive = true }
+}
+
+// JPEGSubsampling is the resolution at which JPEG output stores color
+// (chroma), relative to brightness (luma).
+type JPEGSubsampling int
+
+const (
+	JPEGSubsampling420 JPEGSubsampling = iota // Chroma at half width and height: the smallest files, and the default.
+	JPEGSubsampling422                        // Chroma at half width.
+	JPEGSubsampling444                        // Chroma at full resolution: sharp colored text and edges, larger files.
+)
+
+// String returns the name of the JPEGSubsampling, e.g. "4:2:0".
+func (s JPEGSubsampling) String() string {
+	switch s {
+	case JPEGSubsampling420:
+		return "4:2:0"
+	case JPEGSubsampling422:
+		return "4:2:2"
+	case JPEGSubsampling444:
+		return "4:4:4"
+	default:
+		return "unknown"
+	}
+}
+
+// WithJPEGSubsampling sets the chroma subsampling of JPEG output.
+// JPEGSubsampling444 keeps screenshots, text and thin colored lines from
+// smearing; photos rarely benefit. Grayscale images have no chroma and
+// ignore it.
+func WithJPEGSubsampling(s JPEGSubsampling) EncodeOption {
+	return func(eo *EncodeOptions) { eo.JPEGSubsampling = s }
+}
+
+// jpegZigzag maps the zigzag index of a coefficient to its position in a
+// block in natural order.
+var jpegZigzag = [64]uint8{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegBaseQuant are the luminance and chrominance quantization tables of
+// the JPEG specification (Annex K) in natural order, which qualities scale.
+var jpegBaseQuant = [2][64]uint8{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// jpegQuant returns the quantization tables for quality, scaled as
+// image/jpeg and libjpeg do.
+func jpegQuant(quality int) (q [2][64]int32) {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for t := range q {
+		for i, v := range jpegBaseQuant[t] {
+			q[t][i] = int32(min(max((int(v)*scale+50)/100, 1), 255))
+		}
+	}
+	return q
+}
+
+// jpegDCTBasis holds the 8-point DCT basis: C(u)/2·cos((2x+1)uπ/16).
+var jpegDCTBasis = func() (c [8][8]float64) {
+	for u := range 8 {
+		cu := 0.5
+		if u == 0 {
+			cu = 0.5 / math.Sqrt2
+		}
+		for x := range 8 {
+			c[u][x] = cu * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// jpegFDCT transforms an 8×8 block of samples and quantizes the result into
+// coefficients in natural order.
+func jpegFDCT(block *[64]float64, quant *[64]int32) (out [64]int32) {
+	var rows [64]float64
+	for y := range 8 {
+		for u := range 8 {
+			var s float64
+			for x := range 8 {
+				s += jpegDCTBasis[u][x] * (block[y*8+x] - 128)
+			}
+			rows[y*8+u] = s
+		}
+	}
+	for u := range 8 {
+		for v := range 8 {
+			var s float64
+			for y := range 8 {
+				s += jpegDCTBasis[v][y] * rows[y*8+u]
+			}
+			out[v*8+u] = int32(math.Round(s / float64(quant[v*8+u])))
+		}
+	}
+	return out
+}
+
+// jpegComponent is a color component of a JPEG being encoded.
+type jpegComponent struct {
+	h, v         int         // Sampling factors
+	quant        int         // Quantization table
+	blocksW      int         // Blocks per row, padded to whole MCUs
+	usedW, usedH int         // Blocks covering the component itself
+	blocks       [][64]int32 // Quantized coefficients in natural order
+	dcTable      int         // DC Huffman table
+	dcPre        int32       // DC prediction while coding a scan
+}
+
+// jpegScanSpec is a scan of a JPEG to write: components and a band of
+// coefficients in zigzag order. A sequential JPEG has a single scan of all
+// coefficients; progressive ones use spectral selection only.
+type jpegScanSpec struct {
+	comps  []int
+	ss, se int
+}
+
+// jpegSymbolSink receives the Huffman symbols of a scan, with the extra bits
+// that follow them, to count them or to write them. Tables 0 and 1 are DC
+// tables, 2 and 3 the AC tables of the same numbers.
+type jpegSymbolSink func(table int, symbol uint8, extra uint32, nExtra int)
+
+// jpegCategory returns the magnitude category of v and its extra bits.
+func jpegCategory(v int32) (uint8, uint32) {
+	if v < 0 {
+		n := bits.Len32(uint32(-v))
+		return uint8(n), uint32(v-1) & (1<<n - 1)
+	}
+	return uint8(bits.Len32(uint32(v))), uint32(v)
+}
+
+// jpegMCUs returns the blocks of a scan in coding order: MCU by MCU for
+// several components, and in raster order of the component for one.
+func jpegMCUs(comps []jpegComponent, scan jpegScanSpec, mcusW, mcusH int, fn func(c, block int)) {
+	if len(scan.comps) == 1 {
+		c := &comps[scan.comps[0]]
+		for by := range c.usedH {
+			for bx := range c.usedW {
+				fn(scan.comps[0], by*c.blocksW+bx)
+			}
+		}
+		return
+	}
+	for my := range mcusH {
+		for mx := range mcusW {
+			for _, ci := range scan.comps {
+				c := &comps[ci]
+				for v := range c.v {
+					for h := range c.h {
+						fn(ci, (my*c.v+v)*c.blocksW+mx*c.h+h)
+					}
+				}
+			}
+		}
+	}
+}
+
+// jpegScanSymbols sends the symbols of scan to sink: DC differences, and
+// with them the AC coefficients of each block for a sequential scan; or AC
+// coefficients of a single component with runs of empty blocks (EOBRUN)
+// for a progressive AC scan.
+func jpegScanSymbols(comps []jpegComponent, scan jpegScanSpec, mcusW, mcusH int, sink jpegSymbolSink) {
+	if scan.ss == 0 {
+		for _, ci := range scan.comps {
+			comps[ci].dcPre = 0
+		}
+		jpegMCUs(comps, scan, mcusW, mcusH, func(ci, b int) {
+			c := &comps[ci]
+			dc := c.blocks[b][0]
+			s, extra := jpegCategory(dc - c.dcPre)
+			c.dcPre = dc
+			sink(c.dcTable, s, extra, int(s))
+			if scan.se > 0 && jpegACSymbols(&c.blocks[b], 1, scan.se, 2+c.dcTable, sink, func() {}) {
+				sink(2+c.dcTable, 0x00, 0, 0) // EOB
+			}
+		})
+		return
+	}
+	table := 2 + comps[scan.comps[0]].dcTable
+	eobRun := 0
+	flush := func() {
+		if eobRun > 0 {
+			n := bits.Len(uint(eobRun)) - 1
+			sink(table, uint8(n<<4), uint32(eobRun)&(1<<n-1), n)
+			eobRun = 0
+		}
+	}
+	jpegMCUs(comps, scan, mcusW, mcusH, func(ci, b int) {
+		if jpegACSymbols(&comps[ci].blocks[b], scan.ss, scan.se, table, sink, flush) {
+			if eobRun++; eobRun == 0x7fff {
+				flush()
+			}
+		}
+	})
+	flush()
+}
+
+// jpegACSymbols sends the AC coefficients ss to se of block to sink,
+// calling before ahead of each nonzero one, and reports whether trailing
+// zeros remain to be ended by an EOB.
+func jpegACSymbols(block *[64]int32, ss, se, table int, sink jpegSymbolSink, before func()) bool {
+	run := 0
+	for k := ss; k <= se; k++ {
+		v := block[jpegZigzag[k]]
+		if v == 0 {
+			run++
+			continue
+		}
+		before()
+		for ; run > 15; run -= 16 {
+			sink(table, 0xf0, 0, 0)
+		}
+		s, extra := jpegCategory(v)
+		sink(table, uint8(run<<4)|s, extra, int(s))
+		run = 0
+	}
+	return run > 0
+}
+
+// jpegHuffman is a Huffman table as written in a DHT segment, with the
+// codes of its symbols.
+type jpegHuffman struct {
+	counts [16]uint8 // Codes of each length from 1 to 16
+	values []uint8   // Symbols by code length
+	codes  [256]uint16
+	sizes  [256]uint8
+}
+
+// newJPEGHuffman returns an optimal table for symbols with the given counts.
+// A reserved symbol keeps the all-ones code, which JPEG forbids, unused.
+func newJPEGHuffman(counts *[257]uint32) *jpegHuffman {
+	counts[256] = 1
+	lengths := huffmanLengths(counts[:], 16)
+	// The reserved symbol must have one of the longest codes, to be given
+	// the last one; swapping lengths keeps the code complete.
+	longest := slices.Max(lengths)
+	if i := slices.Index(lengths, longest); lengths[256] != longest {
+		lengths[256], lengths[i] = lengths[i], lengths[256]
+	}
+
+	t := &jpegHuffman{}
+	code := uint16(0)
+	for l := uint8(1); l <= 16; l++ {
+		for s, sl := range lengths[:256] {
+			if sl == l {
+				t.counts[l-1]++
+				t.values = append(t.values, uint8(s))
+				t.codes[s], t.sizes[s] = code, l
+				code++
+			}
+		}
+		if lengths[256] == l {
+			code++
+		}
+		code <<= 1
+	}
+	return t
+}
+
+// jpegBitWriter writes entropy-coded data most significant bit first,
+// stuffing a zero byte after each 0xff.
+type jpegBitWriter struct {
+	buf   []byte
+	acc   uint32
+	nBits uint
+}
+
+// write writes the n low bits of v, with n at most 16.
+func (w *jpegBitWriter) write(v uint32, n int) {
+	w.acc = w.acc<<uint(n) | v&(1<<n-1)
+	w.nBits += uint(n)
+	for w.nBits >= 8 {
+		b := byte(w.acc >> (w.nBits - 8))
+		w.buf = append(w.buf, b)
+		if b == 0xff {
+			w.buf = append(w.buf, 0)
+		}
+		w.nBits -= 8
+	}
+}
+
+// flush pads the last byte with ones.
+func (w *jpegBitWriter) flush() {
+	if w.nBits > 0 {
+		w.write(0x7f, int(8-w.nBits))
+	}
+}
+
+// appendJPEGSegment appends a marker segment with its length.
+func appendJPEGSegment(b []byte, marker byte, payload ...byte) []byte {
+	b = append(b, 0xff, marker)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)+2))
+	return append(b, payload...)
+}
+
+// encodeOwnJPEG writes img as a sequential or progressive JPEG: gray for
+// *image.Gray and YCbCr with the given chroma subsampling otherwise, alpha
+// discarded as by image/jpeg.
+func encodeOwnJPEG(w io.Writer, img image.Image, quality int, subsampling JPEGSubsampling, progressive bool) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 || width > 65535 || height > 65535 {
+		return fmt.Errorf("JPEG images must be from 1x1 to 65535x65535 pixels (got: %dx%d)", width, height)
+	}
+
+	// Full-resolution planes; chroma is subsampled per block below.
+	var planes [][]uint8
+	if gray, ok := img.(*image.Gray); ok {
+		y := make([]uint8, width*height)
+		copyRows(y, width, gray.Pix[gray.PixOffset(b.Min.X, b.Min.Y):], gray.Stride, width, height)
+		planes = [][]uint8{y}
+	} else {
+		rgba := asRGBA(img)
+		planes = [][]uint8{make([]uint8, width*height), make([]uint8, width*height), make([]uint8, width*height)}
+		for i := range width * height {
+			p := rgba.Pix[(i/width)*rgba.Stride+(i%width)*4:]
+			planes[0][i], planes[1][i], planes[2][i] = color.RGBToYCbCr(p[0], p[1], p[2])
+		}
+	}
+
+	hMax, vMax := 1, 1
+	comps := []jpegComponent{{h: 1, v: 1}}
+	scans := []jpegScanSpec{{comps: []int{0}, se: 63}}
+	if progressive {
+		scans = []jpegScanSpec{{comps: []int{0}}, {comps: []int{0}, ss: 1, se: 5}, {comps: []int{0}, ss: 6, se: 63}}
+	}
+	if len(planes) == 3 {
+		switch subsampling {
+		case JPEGSubsampling420:
+			hMax, vMax = 2, 2
+		case JPEGSubsampling422:
+			hMax = 2
+		}
+		comps = []jpegComponent{{h: hMax, v: vMax}, {h: 1, v: 1, quant: 1, dcTable: 1}, {h: 1, v: 1, quant: 1, dcTable: 1}}
+		scans = []jpegScanSpec{{comps: []int{0, 1, 2}, se: 63}}
+		if progressive {
+			scans = []jpegScanSpec{
+				{comps: []int{0, 1, 2}},
+				{comps: []int{0}, ss: 1, se: 5},
+				{comps: []int{1}, ss: 1, se: 63},
+				{comps: []int{2}, ss: 1, se: 63},
+				{comps: []int{0}, ss: 6, se: 63},
+			}
+		}
+	}
+	mcusW, mcusH := (width+8*hMax-1)/(8*hMax), (height+8*vMax-1)/(8*vMax)
+	quant := jpegQuant(quality)
+	for ci := range comps {
+		c := &comps[ci]
+		sx, sy := hMax/c.h, vMax/c.v // Pixels per sample
+		c.blocksW = mcusW * c.h
+		c.usedW = ((width+sx-1)/sx + 7) / 8
+		c.usedH = ((height+sy-1)/sy + 7) / 8
+		c.blocks = make([][64]int32, c.blocksW*mcusH*c.v)
+		plane := planes[ci]
+		var block [64]float64
+		for bi := range c.blocks {
+			bx, by := bi%c.blocksW*8, bi/c.blocksW*8
+			for i := range block {
+				// Average sx×sy pixels, repeating the edges into the
+				// padding.
+				sum := 0
+				for dy := range sy {
+					for dx := range sx {
+						x := min((bx+i%8)*sx+dx, width-1)
+						y := min((by+i/8)*sy+dy, height-1)
+						sum += int(plane[y*width+x])
+					}
+				}
+				block[i] = float64(sum) / float64(sx*sy)
+			}
+			c.blocks[bi] = jpegFDCT(&block, &quant[c.quant])
+		}
+	}
+
+	out := []byte{0xff, 0xd8}
+	for t := range min(len(comps), 2) {
+		dqt := []byte{byte(t)}
+		for _, z := range jpegZigzag {
+			dqt = append(dqt, byte(quant[t][z]))
+		}
+		out = appendJPEGSegment(out, 0xdb, dqt...)
+	}
+	sof := []byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(comps))}
+	for ci, c := range comps {
+		sof = append(sof, byte(ci+1), byte(c.h<<4|c.v), byte(c.quant))
+	}
+	marker := byte(0xc0) // Baseline
+	if progressive {
+		marker = 0xc2
+	}
+	out = appendJPEGSegment(out, marker, sof...)
+
+	for _, scan := range scans {
+		var counts [4][257]uint32
+		jpegScanSymbols(comps, scan, mcusW, mcusH, func(t int, s uint8, _ uint32, _ int) { counts[t][s]++ })
+		var tables [4]*jpegHuffman
+		var dht []byte
+		for t := range tables {
+			if counts[t] == [257]uint32{} {
+				continue
+			}
+			tables[t] = newJPEGHuffman(&counts[t])
+			dht = append(dht, byte(t/2<<4|t%2)) // Class and destination
+			dht = append(dht, tables[t].counts[:]...)
+			dht = append(dht, tables[t].values...)
+		}
+		out = appendJPEGSegment(out, 0xc4, dht...)
+
+		sos := []byte{byte(len(scan.comps))}
+		for _, ci := range scan.comps {
+			// Components code AC with the table of the same number as DC.
+			t := comps[ci].dcTable
+			sos = append(sos, byte(ci+1), byte(t<<4|t))
+		}
+		sos = append(sos, byte(scan.ss), byte(scan.se), 0)
+		out = appendJPEGSegment(out, 0xda, sos...)
+
+		bw := &jpegBitWriter{buf: out}
+		jpegScanSymbols(comps, scan, mcusW, mcusH, func(t int, s uint8, extra uint32, n int) {
+			bw.write(uint32(tables[t].codes[s]), int(tables[t].sizes[s]))
+			bw.write(extra, n)
+		})
+		bw.flush()
+		out = bw.buf
+	}
+	out = append(out, 0xff, 0xd9)
+	_, err := w.Write(out)
+	return err
+}
@@ -0,0 +1,196 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// meanDiff returns the mean absolute difference of the RGB channels of two
+// images of the same size.
+func meanDiff(t *testing.T, a, b image.Image) float64 {
+	t.Helper()
+	ra, _ := New(a).ToRGBA()
+	rb, _ := New(b).ToRGBA()
+	if ra.Rect.Size() != rb.Rect.Size() {
+		t.Fatalf("image sizes %v and %v differ", ra.Rect.Size(), rb.Rect.Size())
+	}
+	sum := 0
+	for i := range ra.Pix {
+		if i%4 != 3 {
+			sum += abs(int(ra.Pix[i]) - int(rb.Pix[i]))
+		}
+	}
+	return float64(sum) / float64(len(ra.Pix)*3/4)
+}
+
+func TestProgressiveJPEG(t *testing.T) {
+	// Odd sizes leave partial blocks and MCUs.
+	src := gradientImage(123, 77)
+	for i := range 40 {
+		src.SetRGBA(10+i, 20+i/2, color.RGBA{255, 255, 0, 255})
+	}
+	baseline, _ := New(src).ToBytes(FormatJPEG)
+	data, err := New(src).ToBytes(FormatJPEG, WithProgressiveJPEG())
+	if err != nil {
+		t.Fatalf("ToBytes(FormatJPEG) with WithProgressiveJPEG should not error, got: %v", err)
+	}
+	if DetectFormat(data) != FormatJPEG || !bytes.Contains(data, []byte{0xff, 0xc2}) {
+		t.Fatal("progressive output should be a JPEG with an SOF2 marker")
+	}
+	if n := bytes.Count(data, []byte{0xff, 0xda}); n != 5 {
+		t.Errorf("progressive JPEG has %d scans, want 5", n)
+	}
+	img := mustImage(t, FromBytes(data))
+	if img.Bounds() != src.Bounds() {
+		t.Fatalf("progressive JPEG decoded to %v, want %v", img.Bounds(), src.Bounds())
+	}
+	// As close to the source as a baseline JPEG of the same quality.
+	want := meanDiff(t, src, mustImage(t, FromBytes(baseline)))
+	if got := meanDiff(t, src, img); got > want*1.2+0.5 {
+		t.Errorf("progressive JPEG differs from the source by %.2f on average, baseline by %.2f", got, want)
+	}
+	if len(data) > len(baseline)*11/10 {
+		t.Errorf("progressive JPEG is %d bytes, want no more than 10%% over the %d of baseline", len(data), len(baseline))
+	}
+
+	// Quality applies too.
+	low, _ := New(src).ToBytes(FormatJPEG, WithProgressiveJPEG(), WithJPEGQuality(20))
+	if len(low) >= len(data) {
+		t.Errorf("progressive JPEG at quality 20 is %d bytes, want less than %d", len(low), len(data))
+	}
+
+	// Gray images have a single component in 3 scans.
+	gray, _ := New(src).ToGray()
+	data, err = New(gray).ToBytes(FormatJPEG, WithProgressiveJPEG())
+	if err != nil {
+		t.Fatalf("ToBytes() of a gray image should not error, got: %v", err)
+	}
+	if n := bytes.Count(data, []byte{0xff, 0xda}); n != 3 {
+		t.Errorf("gray progressive JPEG has %d scans, want 3", n)
+	}
+	if img := mustImage(t, FromBytes(data)); meanDiff(t, gray, img) > 2 {
+		t.Error("gray progressive JPEG does not decode close to the source")
+	}
+
+	// A file cut after its first scans still shows the whole image.
+	scans := bytes.Split(data, []byte{0xff, 0xda})
+	cut := data[:len(data)-len(scans[len(scans)-1])-2]
+	if img, err := FromBytes(cut, WithLenientDecode()).Image(); err != nil || img.Bounds() != gray.Bounds() {
+		t.Errorf("lenient decoding of a progressive JPEG without its last scan = %v, want the whole image", err)
+	}
+
+	tiny := mustImage(t, FromBytes(mustBytes(t, New(createUniformImage(1, 1, color.RGBA{200, 10, 10, 255})), FormatJPEG, WithProgressiveJPEG())))
+	if c := color.RGBAModel.Convert(tiny.At(0, 0)).(color.RGBA); c.R < 180 || c.G > 40 {
+		t.Errorf("1x1 progressive JPEG = %v, want red", c)
+	}
+}
+
+func TestNewJPEGHuffman(t *testing.T) {
+	var counts [257]uint32
+	for s := range 200 {
+		counts[s] = uint32(s*s + 1)
+	}
+	table := newJPEGHuffman(&counts)
+	n, last := 0, 0
+	for l, c := range table.counts {
+		n += int(c)
+		if c > 0 {
+			last = l + 1
+		}
+	}
+	if n != 200 || len(table.values) != 200 || last > 16 {
+		t.Fatalf("table has %d codes of up to %d bits, want 200 of at most 16", n, last)
+	}
+	for s := range 200 {
+		if size := table.sizes[s]; table.codes[s] == 1<<size-1 {
+			t.Errorf("symbol %d has the all-ones code of %d bits", s, size)
+		}
+	}
+}
+
+// mustBytes encodes the image of proc or fails the test.
+func mustBytes(t *testing.T, proc *ImageProcessor, format ImageFormat, opts ...EncodeOption) []byte {
+	t.Helper()
+	data, err := proc.ToBytes(format, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// jpegSampling returns the SOF marker of a JPEG and the sampling factors of
+// its components.
+func jpegSampling(t *testing.T, data []byte) (byte, []byte) {
+	t.Helper()
+	for _, marker := range []byte{0xc0, 0xc2} {
+		if i := bytes.Index(data, []byte{0xff, marker}); i >= 0 {
+			var factors []byte
+			for c := range int(data[i+9]) {
+				factors = append(factors, data[i+11+3*c])
+			}
+			return marker, factors
+		}
+	}
+	t.Fatal("JPEG has no SOF0 or SOF2 marker")
+	return 0, nil
+}
+
+func TestJPEGSubsampling(t *testing.T) {
+	// Red text on white, as in a screenshot.
+	src := createUniformImage(64, 32, color.RGBA{255, 255, 255, 255})
+	for y := 4; y < 28; y += 3 {
+		for x := 4; x < 60; x++ {
+			if x%4 != 0 {
+				src.SetRGBA(x, y, color.RGBA{220, 0, 0, 255})
+			}
+		}
+	}
+
+	cases := []struct {
+		opts    []EncodeOption
+		marker  byte
+		factors []byte
+		scans   int
+	}{
+		{nil, 0xc0, []byte{0x22, 0x11, 0x11}, 1},
+		{[]EncodeOption{WithJPEGSubsampling(JPEGSubsampling444)}, 0xc0, []byte{0x11, 0x11, 0x11}, 1},
+		{[]EncodeOption{WithJPEGSubsampling(JPEGSubsampling422)}, 0xc0, []byte{0x21, 0x11, 0x11}, 1},
+		{[]EncodeOption{WithJPEGSubsampling(JPEGSubsampling444), WithProgressiveJPEG()}, 0xc2, []byte{0x11, 0x11, 0x11}, 5},
+	}
+	diffs := make([]float64, len(cases))
+	for i, tc := range cases {
+		data := mustBytes(t, New(src), FormatJPEG, tc.opts...)
+		marker, factors := jpegSampling(t, data)
+		if marker != tc.marker || !bytes.Equal(factors, tc.factors) {
+			t.Errorf("case %d: SOF %#x with sampling factors %#v, want %#x with %#v", i, marker, factors, tc.marker, tc.factors)
+		}
+		if n := bytes.Count(data, []byte{0xff, 0xda}); n != tc.scans {
+			t.Errorf("case %d: JPEG has %d scans, want %d", i, n, tc.scans)
+		}
+		diffs[i] = meanDiff(t, src, mustImage(t, FromBytes(data)))
+	}
+	// Full-resolution chroma keeps the red lines red.
+	if diffs[1] >= diffs[0]*0.7 {
+		t.Errorf("4:4:4 differs from the source by %.2f on average, want well below the %.2f of 4:2:0", diffs[1], diffs[0])
+	}
+	if diffs[2] >= diffs[0] || diffs[3] >= diffs[0]*0.7 {
+		t.Errorf("4:2:2 and progressive 4:4:4 differ by %.2f and %.2f, want less than the %.2f of 4:2:0", diffs[2], diffs[3], diffs[0])
+	}
+
+	// Gray images have no chroma to subsample.
+	gray, _ := New(src).ToGray()
+	if _, factors := jpegSampling(t, mustBytes(t, New(gray), FormatJPEG, WithJPEGSubsampling(JPEGSubsampling444))); !bytes.Equal(factors, []byte{0x11}) {
+		t.Errorf("gray JPEG has sampling factors %#v, want a single 0x11", factors)
+	}
+
+	if JPEGSubsampling444.String() != "4:4:4" || JPEGSubsampling(9).String() != "unknown" {
+		t.Error("JPEGSubsampling.String() should return the J:a:b notation")
+	}
+
+	// Test case: Invalid input
+	if _, err := New(src).ToBytes(FormatJPEG, WithJPEGSubsampling(JPEGSubsampling(9))); err == nil {
+		t.Error("ToBytes() with an unknown JPEG subsampling should return an error")
+	}
+}
@@ -0,0 +1,203 @@
+package gopiq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LUT3D is a three-dimensional color lookup table as exported by color
+// grading tools (DaVinci Resolve, Photoshop, ...). Input colors are mapped
+// from [DomainMin, DomainMax] onto a Size x Size x Size lattice of output
+// colors, with trilinear interpolation between lattice points.
+type LUT3D struct {
+	Title     string
+	Size      int
+	DomainMin [3]float64
+	DomainMax [3]float64
+	// Table holds Size^3 RGB triples in [0, 1], with the red index varying
+	// fastest, then green, then blue (the .cube file order).
+	Table [][3]float64
+}
+
+// maxLUTSize is the largest LUT_3D_SIZE the .cube specification allows;
+// real-world grades use 17, 33 or 65.
+const maxLUTSize = 256
+
+// ParseCubeLUT parses a 3D LUT in the Adobe/Resolve .cube text format.
+// LUT_3D_INPUT_RANGE, which Resolve writes, sets the domain of all three
+// channels. 1D LUTs are not supported.
+func ParseCubeLUT(r io.Reader) (*LUT3D, error) {
+	lut := &LUT3D{DomainMax: [3]float64{1, 1, 1}}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+
+		switch fields[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "TITLE")), `"`)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("cube line %d: malformed LUT_3D_SIZE", lineNo)
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > maxLUTSize {
+				return nil, fmt.Errorf("cube line %d: invalid LUT_3D_SIZE %q", lineNo, fields[1])
+			}
+			// The table grows as rows are read, so that a size line alone
+			// does not allocate the whole table.
+			lut.Size = size
+			lut.Table = nil
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("cube line %d: 1D LUTs are not supported", lineNo)
+		case "LUT_3D_INPUT_RANGE":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("cube line %d: malformed LUT_3D_INPUT_RANGE", lineNo)
+			}
+			lo, errLo := strconv.ParseFloat(fields[1], 64)
+			hi, errHi := strconv.ParseFloat(fields[2], 64)
+			if errLo != nil || errHi != nil {
+				return nil, fmt.Errorf("cube line %d: invalid LUT_3D_INPUT_RANGE %q %q", lineNo, fields[1], fields[2])
+			}
+			lut.DomainMin, lut.DomainMax = [3]float64{lo, lo, lo}, [3]float64{hi, hi, hi}
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseCubeTriple(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("cube line %d: %w", lineNo, err)
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				lut.DomainMin = v
+			} else {
+				lut.DomainMax = v
+			}
+		default:
+			if lut.Size == 0 {
+				return nil, fmt.Errorf("cube line %d: table data before LUT_3D_SIZE", lineNo)
+			}
+			v, err := parseCubeTriple(fields)
+			if err != nil {
+				return nil, fmt.Errorf("cube line %d: %w", lineNo, err)
+			}
+			if n := lut.Size * lut.Size * lut.Size; len(lut.Table) == n {
+				return nil, fmt.Errorf("cube line %d: more than %d table entries", lineNo, n)
+			}
+			lut.Table = append(lut.Table, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cube LUT: %w", err)
+	}
+
+	if lut.Size == 0 {
+		return nil, fmt.Errorf("cube LUT is missing LUT_3D_SIZE")
+	}
+	if want := lut.Size * lut.Size * lut.Size; len(lut.Table) != want {
+		return nil, fmt.Errorf("cube LUT has %d table entries, want %d", len(lut.Table), want)
+	}
+	for c := 0; c < 3; c++ {
+		if lut.DomainMax[c] <= lut.DomainMin[c] {
+			return nil, fmt.Errorf("cube LUT domain is empty for channel %d", c)
+		}
+	}
+	return lut, nil
+}
+
+// parseCubeTriple parses three whitespace-separated floats.
+func parseCubeTriple(fields []string) ([3]float64, error) {
+	var v [3]float64
+	if len(fields) != 3 {
+		return v, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	for i, f := range fields {
+		n, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid number %q", f)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// lookup maps an RGB triple in [0, 255] through the LUT using trilinear
+// interpolation and returns the result in [0, 1].
+func (l *LUT3D) lookup(r, g, b uint8) [3]float64 {
+	n := l.Size - 1
+	var idx [3]int
+	var frac [3]float64
+	for c, v := range [3]uint8{r, g, b} {
+		// Map the 8-bit value into the LUT's domain, then onto lattice coordinates.
+		t := (float64(v)/255 - l.DomainMin[c]) / (l.DomainMax[c] - l.DomainMin[c])
+		pos := min(max(t, 0), 1) * float64(n)
+		i := min(int(pos), n-1)
+		idx[c], frac[c] = i, pos-float64(i)
+	}
+
+	at := func(ri, gi, bi int) [3]float64 {
+		return l.Table[ri+gi*l.Size+bi*l.Size*l.Size]
+	}
+
+	var out [3]float64
+	for c := 0; c < 3; c++ {
+		c000 := at(idx[0], idx[1], idx[2])[c]
+		c100 := at(idx[0]+1, idx[1], idx[2])[c]
+		c010 := at(idx[0], idx[1]+1, idx[2])[c]
+		c110 := at(idx[0]+1, idx[1]+1, idx[2])[c]
+		c001 := at(idx[0], idx[1], idx[2]+1)[c]
+		c101 := at(idx[0]+1, idx[1], idx[2]+1)[c]
+		c011 := at(idx[0], idx[1]+1, idx[2]+1)[c]
+		c111 := at(idx[0]+1, idx[1]+1, idx[2]+1)[c]
+
+		c00 := c000 + (c100-c000)*frac[0]
+		c10 := c010 + (c110-c010)*frac[0]
+		c01 := c001 + (c101-c001)*frac[0]
+		c11 := c011 + (c111-c011)*frac[0]
+		c0 := c00 + (c10-c00)*frac[1]
+		c1 := c01 + (c11-c01)*frac[1]
+		out[c] = c0 + (c1-c0)*frac[2]
+	}
+	return out
+}
+
+// ApplyLUT color grades the image through a 3D lookup table using trilinear
+// interpolation. Large images are processed in parallel according to the
+// processor's PerformanceOptions. Alpha is preserved.
+// Returns the ImageProcessor for chaining. An error is set if the LUT is nil
+// or malformed.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ApplyLUT(lut *LUT3D) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if lut == nil {
+		ip.err = fmt.Errorf("LUT cannot be nil")
+		return ip
+	}
+	if lut.Size < 2 || len(lut.Table) != lut.Size*lut.Size*lut.Size {
+		ip.err = fmt.Errorf("LUT table has %d entries, want %d for size %d", len(lut.Table), lut.Size*lut.Size*lut.Size, lut.Size)
+		return ip
+	}
+
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		out := lut.lookup(r, g, b)
+		return clampUint8(out[0] * 255), clampUint8(out[1] * 255), clampUint8(out[2] * 255)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("ApplyLUT")
+	return ip
+}
@@ -0,0 +1,118 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// cubeLUT renders a .cube file of the given size whose entries are produced by fn.
+func cubeLUT(size int, fn func(r, g, b float64) (float64, float64, float64)) string {
+	var sb strings.Builder
+	sb.WriteString("# generated for tests\nTITLE \"test\"\n")
+	fmt.Fprintf(&sb, "LUT_3D_SIZE %d\n", size)
+	n := float64(size - 1)
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				or, og, ob := fn(float64(r)/n, float64(g)/n, float64(b)/n)
+				fmt.Fprintf(&sb, "%f %f %f\n", or, og, ob)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestParseCubeLUT(t *testing.T) {
+	lut, err := ParseCubeLUT(strings.NewReader(cubeLUT(3, func(r, g, b float64) (float64, float64, float64) { return r, g, b })))
+	if err != nil {
+		t.Fatalf("ParseCubeLUT() should parse a valid file, got: %v", err)
+	}
+	if lut.Title != "test" || lut.Size != 3 || len(lut.Table) != 27 {
+		t.Errorf("ParseCubeLUT() = title %q size %d entries %d, want \"test\" 3 27", lut.Title, lut.Size, len(lut.Table))
+	}
+	if lut.DomainMax != [3]float64{1, 1, 1} {
+		t.Errorf("ParseCubeLUT() default domain max = %v", lut.DomainMax)
+	}
+
+	// The largest grades in use are accepted, and sizes up to the limit of
+	// the specification.
+	if _, err := ParseCubeLUT(strings.NewReader(cubeLUT(65, func(r, g, b float64) (float64, float64, float64) { return r, g, b }))); err != nil {
+		t.Errorf("ParseCubeLUT() of size 65 should not error, got: %v", err)
+	}
+	if _, err := ParseCubeLUT(strings.NewReader("LUT_3D_SIZE 256\n0 0 0\n")); err == nil || strings.Contains(err.Error(), "LUT_3D_SIZE") {
+		t.Errorf("ParseCubeLUT() of size 256 should only reject the short table, got: %v", err)
+	}
+
+	// Resolve's LUT_3D_INPUT_RANGE sets the domain of every channel.
+	lut, err = ParseCubeLUT(strings.NewReader("LUT_3D_INPUT_RANGE 0.0 2.0\n" + cubeLUT(2, func(r, g, b float64) (float64, float64, float64) { return r, g, b })))
+	if err != nil {
+		t.Fatalf("ParseCubeLUT() with LUT_3D_INPUT_RANGE should not error, got: %v", err)
+	}
+	if lut.DomainMin != [3]float64{0, 0, 0} || lut.DomainMax != [3]float64{2, 2, 2} {
+		t.Errorf("ParseCubeLUT() with LUT_3D_INPUT_RANGE 0 2 domain = %v-%v, want 0-2", lut.DomainMin, lut.DomainMax)
+	}
+
+	invalid := map[string]string{
+		"missing size":   "0 0 0\n",
+		"1D LUT":         "LUT_1D_SIZE 4\n",
+		"short table":    "LUT_3D_SIZE 2\n0 0 0\n1 1 1\n",
+		"bad number":     "LUT_3D_SIZE 2\n0 0 x\n",
+		"bad size":       "LUT_3D_SIZE 1\n",
+		"size too large": "LUT_3D_SIZE 257\n",
+		"bad range":      "LUT_3D_INPUT_RANGE 0 x\n",
+		"short range":    "LUT_3D_INPUT_RANGE 1\n",
+		"empty domain":   "DOMAIN_MIN 1 1 1\nDOMAIN_MAX 1 1 1\n" + cubeLUT(2, func(r, g, b float64) (float64, float64, float64) { return r, g, b }),
+		"too many rows":  cubeLUT(2, func(r, g, b float64) (float64, float64, float64) { return r, g, b }) + "0 0 0\n",
+	}
+	for name, data := range invalid {
+		if _, err := ParseCubeLUT(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseCubeLUT() should reject file with %s", name)
+		}
+	}
+}
+
+func TestApplyLUT(t *testing.T) {
+	originalImg := createLargeTestImage(120, 120)
+
+	// An identity LUT must leave the image (almost) untouched.
+	identity, err := ParseCubeLUT(strings.NewReader(cubeLUT(17, func(r, g, b float64) (float64, float64, float64) { return r, g, b })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := New(originalImg).ApplyLUT(identity)
+	if proc.Err() != nil {
+		t.Fatalf("ApplyLUT() should not error, got: %v", proc.Err())
+	}
+	for _, p := range []image.Point{{0, 0}, {37, 81}, {119, 119}} {
+		want := color.RGBAModel.Convert(originalImg.At(p.X, p.Y)).(color.RGBA)
+		got := color.RGBAModel.Convert(proc.currentImage.At(p.X, p.Y)).(color.RGBA)
+		if abs(int(want.R)-int(got.R)) > 1 || abs(int(want.G)-int(got.G)) > 1 || abs(int(want.B)-int(got.B)) > 1 {
+			t.Errorf("Identity LUT changed pixel %v from %v to %v", p, want, got)
+		}
+	}
+
+	// A linear inversion LUT is reproduced exactly by trilinear interpolation.
+	invert, _ := ParseCubeLUT(strings.NewReader(cubeLUT(2, func(r, g, b float64) (float64, float64, float64) { return 1 - r, 1 - g, 1 - b })))
+	single := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	single.Set(0, 0, color.RGBA{10, 100, 200, 255})
+	proc = New(single).ApplyLUT(invert)
+	if got := color.RGBAModel.Convert(proc.currentImage.At(0, 0)); got != (color.RGBA{245, 155, 55, 255}) {
+		t.Errorf("Inversion LUT produced %v, want {245 155 55 255}", got)
+	}
+
+	// Invalid LUTs
+	if New(originalImg).ApplyLUT(nil).Err() == nil {
+		t.Error("ApplyLUT(nil) should return an error")
+	}
+	if New(originalImg).ApplyLUT(&LUT3D{Size: 3}).Err() == nil {
+		t.Error("ApplyLUT() with an incomplete table should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ApplyLUT(identity).Err() == nil {
+		t.Fatal("ApplyLUT() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,61 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestApplyMask(t *testing.T) {
+	red := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(red, red.Rect, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	// A grayscale mask: left half white, right half black, a mid-gray strip.
+	gray := image.NewGray(image.Rect(0, 0, 40, 40))
+	draw.Draw(gray, image.Rect(0, 0, 20, 40), image.White, image.Point{}, draw.Src)
+	draw.Draw(gray, image.Rect(0, 30, 40, 40), image.NewUniform(color.Gray{128}), image.Point{}, draw.Src)
+	proc := New(red).ApplyMask(gray)
+	if proc.Err() != nil {
+		t.Fatalf("ApplyMask() should not error, got: %v", proc.Err())
+	}
+	cases := []struct {
+		x, y  int
+		alpha uint8
+	}{{5, 5, 255}, {35, 5, 0}, {35, 35, 128}}
+	for _, c := range cases {
+		if got := color.NRGBAModel.Convert(proc.currentImage.At(c.x, c.y)).(color.NRGBA); got.A != c.alpha {
+			t.Errorf("ApplyMask(gray) alpha at (%d, %d) = %d, want %d", c.x, c.y, got.A, c.alpha)
+		}
+	}
+
+	// A smaller mask with transparency is stretched and its alpha is used,
+	// even where its color is dark.
+	alpha := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(alpha, image.Rect(0, 0, 2, 4), image.NewUniform(color.NRGBA{0, 0, 0, 255}), image.Point{}, draw.Src)
+	proc = New(red).ApplyMask(alpha)
+	if got := color.NRGBAModel.Convert(proc.currentImage.At(5, 20)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("ApplyMask(alpha) kept area = %v, want opaque red", got)
+	}
+	if _, _, _, a := proc.currentImage.At(35, 20).RGBA(); a != 0 {
+		t.Errorf("ApplyMask(alpha) removed area alpha = %d, want 0", a>>8)
+	}
+
+	// Views whose rows are wider than the image give the same result.
+	wide, compact := wideStrideImage(40, 40)
+	if got, want := mustImage(t, New(wide).ApplyMask(gray)), mustImage(t, New(compact).ApplyMask(gray)); !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("ApplyMask() of a wide-stride view differs from that of a compact copy")
+	}
+
+	// Test case: Invalid mask
+	if New(red).ApplyMask(nil).Err() == nil {
+		t.Error("ApplyMask(nil) should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ApplyMask(gray).Err() == nil {
+		t.Fatal("ApplyMask() on a processor with prior error should return that error")
+	}
+}
@@ -0,0 +1,415 @@
+package gopiq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// MetadataPolicy is what encoding does with the EXIF and XMP metadata of
+// the decoded image, such as camera settings, GPS position, copyright and
+// author.
+type MetadataPolicy int
+
+const (
+	MetadataDefault MetadataPolicy = iota // Metadata is not carried over, and built-in encoders write none.
+	MetadataKeep                          // See WithKeepMetadata.
+	MetadataStrip                         // See WithStripMetadata.
+)
+
+// WithKeepMetadata copies the EXIF and XMP metadata read by FromBytes or
+// FromReaderAt from JPEG, PNG and WebP input into JPEG, PNG and WebP
+// output, e.g. to keep copyright attribution. After AutoOrient the EXIF
+// orientation is reset, as the pixels are upright. Encoding fails if there
+// is metadata to keep and the output format cannot hold it.
+func WithKeepMetadata() EncodeOption {
+	return func(eo *EncodeOptions) { eo.Metadata = MetadataKeep }
+}
+
+// WithStripMetadata guarantees that JPEG, PNG and WebP output has no EXIF
+// or XMP metadata, even from RegisterEncoder codecs, e.g. so photos shared
+// publicly do not reveal where they were taken. ICC color profiles are
+// kept, as they define the colors of the pixels. Encoding fails if a
+// registered encoder produces another format, whose metadata cannot be
+// checked.
+func WithStripMetadata() EncodeOption {
+	return func(eo *EncodeOptions) { eo.Metadata = MetadataStrip }
+}
+
+const (
+	// exifPrefix starts JPEG APP1 segments holding EXIF, and sometimes the
+	// EXIF chunks of WebP files.
+	exifPrefix = "Exif\x00\x00"
+	// xmpPrefix starts JPEG APP1 segments holding XMP.
+	xmpPrefix = "http://ns.adobe.com/xap/1.0/\x00"
+	// pngXMPKeyword is the keyword of the PNG iTXt chunk holding XMP.
+	pngXMPKeyword = "XML:com.adobe.xmp"
+	// jpegAPP1 is the marker of JPEG segments holding EXIF or XMP.
+	jpegAPP1 = 0xe1
+	// Flags of the VP8X chunk for EXIF and XMP chunks in a WebP file.
+	webpEXIFFlag = 0x08
+	webpXMPFlag  = 0x04
+)
+
+// imageMetadata is the metadata of a decoded image.
+type imageMetadata struct {
+	exif []byte     // A TIFF structure, without exifPrefix
+	xmp  []byte     // An XMP packet
+	dpi  [2]float64 // Horizontal and vertical density from JFIF or pHYs
+	icc  []byte     // The ICC color profile
+}
+
+// readMetadata returns the EXIF and XMP metadata, the pixel density and the
+// ICC profile of the JPEG, PNG or WebP image of size bytes in r, reading
+// little more than the headers. Damaged metadata is skipped.
+func readMetadata(r io.ReaderAt, size int64) imageMetadata {
+	var md imageMetadata
+	var iccParts [][]byte
+	head := make([]byte, 16)
+	n, _ := r.ReadAt(head, 0)
+	switch DetectFormat(head[:n]) {
+	case FormatJPEG:
+		jpegSegments(r, size, func(marker byte, off, n int64) {
+			if marker == 0xe0 && n >= 16 { // APP0
+				p := readSection(r, off+4, 12)
+				if jfif, ok := bytes.CutPrefix(p, []byte("JFIF\x00")); ok {
+					x, y := float64(binary.BigEndian.Uint16(jfif[3:])), float64(binary.BigEndian.Uint16(jfif[5:]))
+					switch jfif[2] {
+					case 1: // Dots per inch
+						md.dpi = [2]float64{x, y}
+					case 2: // Dots per centimeter
+						md.dpi = [2]float64{x * 2.54, y * 2.54}
+					}
+				}
+			}
+			if marker == jpegAPP2 && n > 4+int64(len(iccPrefix))+2 {
+				iccParts = appendICCPart(iccParts, readSection(r, off+4, n-4))
+			}
+			if marker != jpegAPP1 {
+				return
+			}
+			p := readSection(r, off+4, n-4)
+			if exif, ok := bytes.CutPrefix(p, []byte(exifPrefix)); ok && md.exif == nil {
+				md.exif = exif
+			} else if xmp, ok := bytes.CutPrefix(p, []byte(xmpPrefix)); ok && md.xmp == nil {
+				md.xmp = xmp
+			}
+		})
+		md.icc = joinICCParts(iccParts)
+	case FormatPNG:
+		pngChunks(r, size, func(typ string, off, n int64) {
+			switch {
+			case typ == "eXIf" && md.exif == nil:
+				md.exif = readSection(r, off+8, n-12)
+			case typ == "iTXt" && md.xmp == nil:
+				md.xmp = pngXMP(readSection(r, off+8, n-12))
+			case typ == "iCCP" && md.icc == nil:
+				md.icc = pngICC(readSection(r, off+8, n-12))
+			case typ == "pHYs" && n == 21:
+				if p := readSection(r, off+8, 9); p != nil && p[8] == 1 { // Pixels per meter
+					md.dpi = [2]float64{float64(binary.BigEndian.Uint32(p)) * 0.0254, float64(binary.BigEndian.Uint32(p[4:])) * 0.0254}
+				}
+			}
+		})
+	case FormatWebP:
+		var h [8]byte
+		for off := int64(12); off+8 <= size; {
+			if _, err := r.ReadAt(h[:], off); err != nil {
+				break
+			}
+			n := int64(binary.LittleEndian.Uint32(h[4:]))
+			if off+8+n > size {
+				break
+			}
+			switch string(h[:4]) {
+			case "EXIF":
+				md.exif = bytes.TrimPrefix(readSection(r, off+8, n), []byte(exifPrefix))
+			case "XMP ":
+				md.xmp = readSection(r, off+8, n)
+			case "ICCP":
+				if icc := readSection(r, off+8, n); validICC(icc) {
+					md.icc = icc
+				}
+			}
+			off += 8 + n + n&1
+		}
+	}
+	return md
+}
+
+// readSection returns the n bytes at off in r, or nil if they cannot be
+// read.
+func readSection(r io.ReaderAt, off, n int64) []byte {
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil
+	}
+	return b
+}
+
+// jpegSegments calls fn with the marker, offset and length of everything
+// between the SOI marker and the first scan of a JPEG: marker segments,
+// markers without a segment and fill bytes. It returns the offset it
+// stopped at, that of the SOS marker unless the JPEG is damaged.
+func jpegSegments(r io.ReaderAt, size int64, fn func(marker byte, off, n int64)) int64 {
+	var h [4]byte
+	off := int64(2)
+	for off+4 <= size {
+		if _, err := r.ReadAt(h[:], off); err != nil || h[0] != 0xff {
+			break
+		}
+		switch m := h[1]; {
+		case m == 0xda || m == 0xd9: // SOS or EOI
+			return off
+		case m == 0xff: // Fill byte
+			fn(m, off, 1)
+			off++
+		case m == 0x01 || m >= 0xd0 && m <= 0xd7: // TEM or RSTn
+			fn(m, off, 2)
+			off += 2
+		default:
+			n := 2 + int64(binary.BigEndian.Uint16(h[2:]))
+			if n < 4 || off+n > size {
+				return off
+			}
+			fn(m, off, n)
+			off += n
+		}
+	}
+	return off
+}
+
+// pngChunks calls fn with the type, offset and length of each chunk of a
+// PNG, the length including its header and CRC. It returns the offset it
+// stopped at, the end of the IEND chunk unless the PNG is damaged.
+func pngChunks(r io.ReaderAt, size int64, fn func(typ string, off, n int64)) int64 {
+	var h [8]byte
+	off := int64(8)
+	for off+12 <= size {
+		if _, err := r.ReadAt(h[:], off); err != nil {
+			break
+		}
+		n := 12 + int64(binary.BigEndian.Uint32(h[:4]))
+		if off+n > size {
+			break
+		}
+		fn(string(h[4:]), off, n)
+		off += n
+		if string(h[4:]) == "IEND" {
+			break
+		}
+	}
+	return off
+}
+
+// pngTextKeyword returns the keyword of a tEXt, zTXt or iTXt chunk.
+func pngTextKeyword(p []byte) string {
+	keyword, _, _ := bytes.Cut(p, []byte{0})
+	return string(keyword)
+}
+
+// pngXMP returns the XMP packet of an iTXt chunk, or nil if it holds other
+// text.
+func pngXMP(p []byte) []byte {
+	if pngTextKeyword(p) != pngXMPKeyword || len(p) < len(pngXMPKeyword)+3 {
+		return nil
+	}
+	compressed := p[len(pngXMPKeyword)+1] == 1
+	// The language tag and translated keyword precede the text.
+	fields := bytes.SplitN(p[len(pngXMPKeyword)+3:], []byte{0}, 3)
+	if len(fields) < 3 {
+		return nil
+	}
+	if !compressed {
+		return fields[2]
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(fields[2]))
+	if err != nil {
+		return nil
+	}
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return nil
+	}
+	return text
+}
+
+// exifWithOrientation returns a copy of exif whose orientation tag, if it
+// has one, is set to o.
+func exifWithOrientation(exif []byte, o uint16) []byte {
+	if len(exif) < 8 {
+		return exif
+	}
+	var order binary.ByteOrder
+	switch string(exif[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return exif
+	}
+	ifd := int64(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > int64(len(exif)) {
+		return exif
+	}
+	out := slices.Clone(exif)
+	for i := range int64(order.Uint16(exif[ifd:])) {
+		e := ifd + 2 + 12*i
+		if e+12 > int64(len(exif)) {
+			break
+		}
+		if order.Uint16(exif[e:]) == 0x0112 && order.Uint16(exif[e+2:]) == 3 { // Orientation, SHORT
+			order.PutUint16(out[e+8:], o)
+		}
+	}
+	return out
+}
+
+// embedMetadata inserts md into encoded image data of format: APP1 segments
+// right after the SOI marker of a JPEG, chunks right after the IHDR chunk of
+// a PNG and at the end of a WebP file, which gets a VP8X chunk if needed.
+func embedMetadata(data []byte, format ImageFormat, md imageMetadata) ([]byte, error) {
+	if md.exif == nil && md.xmp == nil {
+		return data, nil
+	}
+	switch format {
+	case FormatJPEG:
+		var segments []byte
+		for _, p := range []struct{ prefix, data []byte }{{[]byte(exifPrefix), md.exif}, {[]byte(xmpPrefix), md.xmp}} {
+			if p.data == nil {
+				continue
+			}
+			if n := len(p.prefix) + len(p.data); n > 0xffff-2 {
+				return nil, fmt.Errorf("metadata of %d bytes does not fit in a JPEG segment", n)
+			}
+			segments = appendJPEGSegment(segments, jpegAPP1, append(p.prefix, p.data...)...)
+		}
+		return slices.Concat(data[:2], segments, data[2:]), nil
+	case FormatPNG:
+		var chunks []byte
+		if md.exif != nil {
+			chunks = appendPNGChunk(chunks, "eXIf", md.exif)
+		}
+		if md.xmp != nil {
+			// Uncompressed, without language tag or translated keyword.
+			chunks = appendPNGChunk(chunks, "iTXt", append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), md.xmp...))
+		}
+		return slices.Concat(data[:pngIHDREnd], chunks, data[pngIHDREnd:]), nil
+	case FormatWebP:
+		chunks, err := readWebPChunks(data[12:])
+		if err != nil || len(chunks) == 0 {
+			return nil, fmt.Errorf("failed to add metadata to WebP: %v", err)
+		}
+		var flags byte
+		if md.exif != nil {
+			flags |= webpEXIFFlag
+		}
+		if md.xmp != nil {
+			flags |= webpXMPFlag
+		}
+		if chunks, err = webpWithFlags(chunks, flags); err != nil {
+			return nil, err
+		}
+		if md.exif != nil {
+			chunks = append(chunks, webpChunk{"EXIF", md.exif})
+		}
+		if md.xmp != nil {
+			chunks = append(chunks, webpChunk{"XMP ", md.xmp})
+		}
+		var buf bytes.Buffer
+		err = writeWebPContainer(&buf, chunks...)
+		return buf.Bytes(), err
+	default:
+		return nil, fmt.Errorf("metadata cannot be kept in %s output", format)
+	}
+}
+
+// webpWithFlags sets flags in the VP8X chunk of a WebP file's chunks,
+// adding a VP8X chunk to a simple file.
+func webpWithFlags(chunks []webpChunk, flags byte) ([]webpChunk, error) {
+	if chunks[0].id == "VP8X" && len(chunks[0].data) >= 10 {
+		vp8x := slices.Clone(chunks[0].data)
+		vp8x[0] |= flags
+		return append([]webpChunk{{"VP8X", vp8x}}, chunks[1:]...), nil
+	}
+	w, h, alpha, err := webpFrameSize(chunks[0])
+	if err != nil {
+		return nil, err
+	}
+	if alpha {
+		flags |= webpAlphaFlag
+	}
+	return append([]webpChunk{webpVP8X(flags, w, h)}, chunks...), nil
+}
+
+// webpFrameSize returns the size of a VP8 or VP8L chunk's image and, for
+// VP8L, whether it uses alpha.
+func webpFrameSize(c webpChunk) (w, h int, alpha bool, err error) {
+	switch {
+	case c.id == "VP8 " && len(c.data) >= 10:
+		return int(binary.LittleEndian.Uint16(c.data[6:]) & 0x3fff), int(binary.LittleEndian.Uint16(c.data[8:]) & 0x3fff), false, nil
+	case c.id == "VP8L" && len(c.data) >= 5 && c.data[0] == vp8lMagic:
+		bits := binary.LittleEndian.Uint32(c.data[1:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, bits>>28&1 != 0, nil
+	default:
+		return 0, 0, false, fmt.Errorf("unexpected WebP chunk %q", c.id)
+	}
+}
+
+// stripMetadata removes EXIF and XMP metadata from encoded image data of
+// format: APP1 segments of JPEG, eXIf and XMP text chunks of PNG, and EXIF
+// and XMP chunks of WebP. Other formats are returned as they are unless
+// registered, as built-in encoders write no metadata for them.
+func stripMetadata(data []byte, format ImageFormat, registered bool) ([]byte, error) {
+	r, size := bytes.NewReader(data), int64(len(data))
+	switch format {
+	case FormatJPEG:
+		out := slices.Clone(data[:2])
+		end := jpegSegments(r, size, func(marker byte, off, n int64) {
+			if marker != jpegAPP1 {
+				out = append(out, data[off:off+n]...)
+			}
+		})
+		return append(out, data[end:]...), nil
+	case FormatPNG:
+		out := slices.Clone(data[:8])
+		end := pngChunks(r, size, func(typ string, off, n int64) {
+			switch typ {
+			case "eXIf":
+				return
+			case "tEXt", "zTXt", "iTXt":
+				// ImageMagick stores EXIF and XMP as "Raw profile type"
+				// text.
+				if k := pngTextKeyword(data[off+8 : off+n-4]); k == pngXMPKeyword || strings.HasPrefix(k, "Raw profile type ") {
+					return
+				}
+			}
+			out = append(out, data[off:off+n]...)
+		})
+		return append(out, data[end:]...), nil
+	case FormatWebP:
+		chunks, err := readWebPChunks(data[12:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to strip metadata from WebP: %w", err)
+		}
+		chunks = slices.DeleteFunc(chunks, func(c webpChunk) bool { return c.id == "EXIF" || c.id == "XMP " })
+		if len(chunks) > 0 && chunks[0].id == "VP8X" && len(chunks[0].data) > 0 {
+			vp8x := slices.Clone(chunks[0].data)
+			vp8x[0] &^= webpEXIFFlag | webpXMPFlag
+			chunks[0].data = vp8x
+		}
+		var buf bytes.Buffer
+		err = writeWebPContainer(&buf, chunks...)
+		return buf.Bytes(), err
+	default:
+		if registered {
+			return nil, fmt.Errorf("metadata cannot be stripped from %s output of a registered encoder", format)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,164 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"slices"
+	"testing"
+)
+
+// testEXIF is a little-endian TIFF structure with an orientation of 6 and a
+// copyright notice.
+var testEXIF = func() []byte {
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = append(b, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0)  // Orientation: 6
+	b = append(b, 0x98, 0x82, 2, 0, 9, 0, 0, 0, 38, 0, 0, 0) // Copyright at offset 38
+	return append(append(b, 0, 0, 0, 0), "(c) Jane\x00"...)  // No next IFD
+}()
+
+// testXMP is an XMP packet with the creator of an image.
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" dc:creator="Jane"/></rdf:RDF></x:xmpmeta>`
+
+// jpegWithMetadata returns a JPEG of img with testEXIF and testXMP in APP1
+// segments, as cameras and photo editors write them.
+func jpegWithMetadata(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	data, err := imageToJPEGBytes(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app1 := appendJPEGSegment(nil, 0xe1, append([]byte("Exif\x00\x00"), testEXIF...)...)
+	app1 = appendJPEGSegment(app1, 0xe1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), testXMP...)...)
+	return slices.Concat(data[:2], app1, data[2:])
+}
+
+// metadataOf returns the metadata of encoded image data.
+func metadataOf(data []byte) imageMetadata {
+	return readMetadata(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestKeepMetadata(t *testing.T) {
+	src := jpegWithMetadata(t, gradientImage(24, 16))
+	proc := FromBytes(src)
+	if md := proc.meta; !bytes.Equal(md.exif, testEXIF) || string(md.xmp) != testXMP {
+		t.Fatalf("FromBytes() read EXIF %q and XMP %q, want those of the file", md.exif, md.xmp)
+	}
+	if md := FromReaderAt(bytes.NewReader(src), int64(len(src))).meta; !bytes.Equal(md.exif, testEXIF) {
+		t.Error("FromReaderAt() should read the EXIF of the file")
+	}
+
+	// Without an option, metadata is dropped as before.
+	if md := metadataOf(mustBytes(t, proc, FormatJPEG)); md.exif != nil || md.xmp != nil {
+		t.Error("ToBytes() without WithKeepMetadata should not write metadata")
+	}
+
+	cases := map[string][]EncodeOption{
+		"jpeg":          {WithKeepMetadata()},
+		"png":           {WithKeepMetadata()},
+		"lossy webp":    {WithKeepMetadata()},
+		"lossless webp": {WithKeepMetadata(), WithWebPLossless()},
+	}
+	formats := map[string]ImageFormat{"jpeg": FormatJPEG, "png": FormatPNG, "lossy webp": FormatWebP, "lossless webp": FormatWebP}
+	for name, opts := range cases {
+		data, err := proc.ToBytes(formats[name], opts...)
+		if err != nil {
+			t.Fatalf("ToBytes(%s) with WithKeepMetadata should not error, got: %v", name, err)
+		}
+		if md := metadataOf(data); !bytes.Equal(md.exif, testEXIF) || string(md.xmp) != testXMP {
+			t.Errorf("%s output has EXIF %q and XMP %.20q..., want those of the source", name, md.exif, md.xmp)
+		}
+		img := mustImage(t, FromBytes(data))
+		if img.Bounds().Dx() != 24 || img.Bounds().Dy() != 16 {
+			t.Errorf("%s output with metadata decoded to %v, want 24x16", name, img.Bounds())
+		}
+	}
+
+	// Metadata survives operations and formats.
+	resized := mustBytes(t, proc.Clone().Resize(12, 8), FormatPNG, WithKeepMetadata())
+	if md := FromBytes(resized).meta; !bytes.Equal(md.exif, testEXIF) || string(md.xmp) != testXMP {
+		t.Error("metadata kept in a PNG should be read back from it")
+	}
+	// Images without metadata, or not decoded, can be written anywhere.
+	if _, err := New(gradientImage(4, 4)).ToBytes(FormatTGA, WithKeepMetadata()); err != nil {
+		t.Errorf("ToBytes(FormatTGA) with no metadata to keep should not error, got: %v", err)
+	}
+
+	// Test case: Invalid input
+	if _, err := proc.ToBytes(FormatTGA, WithKeepMetadata()); err == nil {
+		t.Error("ToBytes(FormatTGA) with metadata to keep should return an error")
+	}
+	big := &ImageProcessor{currentImage: gradientImage(4, 4), meta: imageMetadata{exif: make([]byte, 70000)}}
+	if _, err := big.ToBytes(FormatJPEG, WithKeepMetadata()); err == nil {
+		t.Error("ToBytes(FormatJPEG) with EXIF too large for a segment should return an error")
+	}
+}
+
+func TestExifWithOrientation(t *testing.T) {
+	exif := exifWithOrientation(testEXIF, 1)
+	if exif[18] != 1 || testEXIF[18] != 6 {
+		t.Errorf("orientation = %d, want 1 without changing the original", exif[18])
+	}
+	if !bytes.Equal(exif[:18], testEXIF[:18]) || !bytes.Equal(exif[19:], testEXIF[19:]) {
+		t.Error("exifWithOrientation() should only change the orientation")
+	}
+	if got := exifWithOrientation([]byte("junk"), 1); string(got) != "junk" {
+		t.Error("exifWithOrientation() should leave data that is not EXIF alone")
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	proc := FromBytes(jpegWithMetadata(t, gradientImage(24, 16)))
+	withMeta := map[ImageFormat][]byte{
+		FormatJPEG: mustBytes(t, proc, FormatJPEG, WithKeepMetadata()),
+		FormatPNG:  mustBytes(t, proc, FormatPNG, WithKeepMetadata()),
+		FormatWebP: mustBytes(t, proc, FormatWebP, WithKeepMetadata(), WithWebPLossless()),
+	}
+	for format, data := range withMeta {
+		stripped, err := stripMetadata(data, format, false)
+		if err != nil {
+			t.Fatalf("stripMetadata(%s) should not error, got: %v", format, err)
+		}
+		if md := metadataOf(stripped); md.exif != nil || md.xmp != nil {
+			t.Errorf("stripped %s still has metadata", format)
+		}
+		if bytes.Contains(stripped, []byte("Jane")) {
+			t.Errorf("stripped %s still names the author", format)
+		}
+		if img := mustImage(t, FromBytes(stripped)); img.Bounds().Dx() != 24 {
+			t.Errorf("stripped %s decoded to %v, want 24x16", format, img.Bounds())
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(mustBytes(t, proc, FormatPNG, WithStripMetadata()))); err != nil {
+		t.Errorf("PNG with WithStripMetadata does not decode: %v", err)
+	}
+
+	// Metadata written by a registered encoder is removed too.
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		defer codecsMu.Unlock()
+		delete(encoders, FormatJPEG)
+	})
+	if err := RegisterEncoder(FormatJPEG, func(w io.Writer, img image.Image) error {
+		_, err := w.Write(jpegWithMetadata(t, img))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if md := metadataOf(mustBytes(t, New(gradientImage(8, 8)), FormatJPEG)); md.exif == nil {
+		t.Fatal("the test encoder should write metadata")
+	}
+	data := mustBytes(t, New(gradientImage(8, 8)), FormatJPEG, WithStripMetadata())
+	if md := metadataOf(data); md.exif != nil || md.xmp != nil {
+		t.Error("WithStripMetadata should remove the metadata written by a registered encoder")
+	}
+
+	// Test case: Invalid input
+	registerTestCodec(t)
+	if _, err := New(gradientImage(8, 8)).ToBytes(FormatJXL, WithStripMetadata()); err == nil {
+		t.Error("WithStripMetadata with a registered encoder of a format that cannot be checked should return an error")
+	}
+}
@@ -0,0 +1,186 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Montage lays out images in a grid of cols columns on a background of bg,
+// with gap pixels between cells and around the edge, and returns a new
+// ImageProcessor holding the result. Every cell is as large as the largest
+// image; smaller images are centered in their cell without scaling, so resize
+// the inputs first for a uniform grid. A nil bg leaves the background
+// transparent.
+// An error is set on the returned processor if images is empty or contains
+// nil, cols is not positive or gap is negative.
+func Montage(images []image.Image, cols int, gap int, bg color.Color) *ImageProcessor {
+	if len(images) == 0 {
+		return &ImageProcessor{err: fmt.Errorf("montage needs at least one image")}
+	}
+	if cols <= 0 {
+		return &ImageProcessor{err: fmt.Errorf("montage columns must be positive (got: %d)", cols)}
+	}
+	if gap < 0 {
+		return &ImageProcessor{err: fmt.Errorf("montage gap must not be negative (got: %d)", gap)}
+	}
+
+	var cell image.Point
+	for i, img := range images {
+		if img == nil {
+			return &ImageProcessor{err: fmt.Errorf("montage image %d is nil", i)}
+		}
+		size := img.Bounds().Size()
+		cell = image.Pt(max(cell.X, size.X), max(cell.Y, size.Y))
+	}
+	cols = min(cols, len(images))
+	rows := (len(images) + cols - 1) / cols
+
+	canvas := newRGBA(image.Rect(0, 0, cols*(cell.X+gap)+gap, rows*(cell.Y+gap)+gap))
+	if bg != nil {
+		draw.Draw(canvas, canvas.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	for i, img := range images {
+		cellRect := image.Rectangle{Max: cell}.Add(image.Pt(gap+(i%cols)*(cell.X+gap), gap+(i/cols)*(cell.Y+gap)))
+		b := img.Bounds()
+		draw.Draw(canvas, AnchorCenter.place(cellRect, b.Size()), img, b.Min, draw.Over)
+	}
+
+	return &ImageProcessor{
+		currentImage: canvas,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         canvas.Rect.Size(),
+	}
+}
+
+// BuildSpriteSheet packs frames into a sprite sheet, row by row with cols
+// frames per row, and returns a new ImageProcessor holding the sheet together
+// with the rectangle each frame occupies in it, for game-asset and icon
+// pipelines. Frames keep their size; each row is as tall as its tallest
+// frame and the unused area is transparent.
+// An error is set on the returned processor, and no rectangles are returned,
+// if frames is empty or contains nil, or cols is not positive.
+func BuildSpriteSheet(frames []image.Image, cols int) (*ImageProcessor, []image.Rectangle) {
+	if len(frames) == 0 {
+		return &ImageProcessor{err: fmt.Errorf("sprite sheet needs at least one frame")}, nil
+	}
+	if cols <= 0 {
+		return &ImageProcessor{err: fmt.Errorf("sprite sheet columns must be positive (got: %d)", cols)}, nil
+	}
+
+	rects := make([]image.Rectangle, len(frames))
+	var x, y, rowHeight, width int
+	for i, frame := range frames {
+		if frame == nil {
+			return &ImageProcessor{err: fmt.Errorf("sprite sheet frame %d is nil", i)}, nil
+		}
+		if i > 0 && i%cols == 0 {
+			x, y, rowHeight = 0, y+rowHeight, 0
+		}
+		size := frame.Bounds().Size()
+		rects[i] = image.Rectangle{Max: size}.Add(image.Pt(x, y))
+		x += size.X
+		rowHeight = max(rowHeight, size.Y)
+		width = max(width, x)
+	}
+
+	sheet := newRGBA(image.Rect(0, 0, width, y+rowHeight))
+	for i, frame := range frames {
+		draw.Draw(sheet, rects[i], frame, frame.Bounds().Min, draw.Src)
+	}
+
+	return &ImageProcessor{
+		currentImage: sheet,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         sheet.Rect.Size(),
+	}, rects
+}
+
+// Align selects how images of different sizes line up across the stacking
+// direction of AppendHorizontal and AppendVertical.
+type Align int
+
+const (
+	// AlignStart aligns top edges (horizontal) or left edges (vertical).
+	AlignStart Align = iota
+	// AlignCenter centers the images.
+	AlignCenter
+	// AlignEnd aligns bottom edges (horizontal) or right edges (vertical).
+	AlignEnd
+)
+
+// offset returns the position of a span of size within total.
+func (a Align) offset(total, size int) int {
+	switch a {
+	case AlignCenter:
+		return (total - size) / 2
+	case AlignEnd:
+		return total - size
+	default:
+		return 0
+	}
+}
+
+// AppendHorizontal places other to the right of the image, e.g. for
+// before/after strips. The result is as tall as the taller of the two; the
+// shorter one is aligned by align and the remaining area is transparent.
+// Returns the ImageProcessor for chaining. An error is set if other is nil or
+// align is unknown.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) AppendHorizontal(other image.Image, align Align) *ImageProcessor {
+	return ip.appendImage(other, align, true)
+}
+
+// AppendVertical places other below the image, e.g. for combining
+// screenshots. The result is as wide as the wider of the two; the narrower
+// one is aligned by align and the remaining area is transparent.
+// Returns the ImageProcessor for chaining. An error is set if other is nil or
+// align is unknown.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) AppendVertical(other image.Image, align Align) *ImageProcessor {
+	return ip.appendImage(other, align, false)
+}
+
+// appendImage implements AppendHorizontal and AppendVertical.
+func (ip *ImageProcessor) appendImage(other image.Image, align Align, horizontal bool) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if other == nil {
+		ip.err = fmt.Errorf("image to append cannot be nil")
+		return ip
+	}
+	if align < AlignStart || align > AlignEnd {
+		ip.err = fmt.Errorf("unknown alignment: %d", align)
+		return ip
+	}
+
+	a, b := ip.currentImage.Bounds(), other.Bounds()
+	var size, posA, posB image.Point
+	if horizontal {
+		size = image.Pt(a.Dx()+b.Dx(), max(a.Dy(), b.Dy()))
+		posA = image.Pt(0, align.offset(size.Y, a.Dy()))
+		posB = image.Pt(a.Dx(), align.offset(size.Y, b.Dy()))
+	} else {
+		size = image.Pt(max(a.Dx(), b.Dx()), a.Dy()+b.Dy())
+		posA = image.Pt(align.offset(size.X, a.Dx()), 0)
+		posB = image.Pt(align.offset(size.X, b.Dx()), a.Dy())
+	}
+
+	dst := newRGBA(image.Rectangle{Max: size})
+	draw.Draw(dst, image.Rectangle{Min: posA, Max: posA.Add(a.Size())}, ip.currentImage, a.Min, draw.Src)
+	draw.Draw(dst, image.Rectangle{Min: posB, Max: posB.Add(b.Size())}, other, b.Min, draw.Src)
+
+	ip.currentImage = dst
+	if horizontal {
+		ip.record("AppendHorizontal")
+	} else {
+		ip.record("AppendVertical")
+	}
+	return ip
+}
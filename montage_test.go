@@ -0,0 +1,178 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestMontage(t *testing.T) {
+	solid := func(w, h int, c color.RGBA) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+		return img
+	}
+	red, green, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	bg := color.RGBA{255, 255, 255, 255}
+	images := []image.Image{solid(20, 20, red), solid(10, 10, green), solid(20, 10, blue)}
+
+	proc := Montage(images, 2, 4, bg)
+	if proc.Err() != nil {
+		t.Fatalf("Montage() should not error, got: %v", proc.Err())
+	}
+	// Two columns and two rows of 20x20 cells with 4px gaps.
+	if size := proc.currentImage.Bounds().Size(); size != image.Pt(52, 52) {
+		t.Fatalf("Montage() produced %v, want 52x52", size)
+	}
+	cases := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 2, bg},      // Outer gap
+		{14, 14, red},   // First cell
+		{35, 14, green}, // Second cell, centered
+		{29, 14, bg},    // Second cell margin around the smaller image
+		{14, 35, blue},  // Third cell on the next row
+		{14, 29, bg},
+		{40, 40, bg}, // Empty last cell
+	}
+	for _, c := range cases {
+		if got := color.RGBAModel.Convert(proc.currentImage.At(c.x, c.y)); got != c.want {
+			t.Errorf("Montage() pixel (%d, %d) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+
+	// More columns than images shrink the grid to one row.
+	if size := Montage(images, 10, 0, nil).currentImage.Bounds().Size(); size != image.Pt(60, 20) {
+		t.Errorf("Montage() with extra columns produced %v, want 60x20", size)
+	}
+
+	// Test case: Invalid parameters
+	if Montage(nil, 2, 0, bg).Err() == nil {
+		t.Error("Montage() with no images should return an error")
+	}
+	if Montage(images, 0, 0, bg).Err() == nil {
+		t.Error("Montage() with zero columns should return an error")
+	}
+	if Montage(images, 2, -1, bg).Err() == nil {
+		t.Error("Montage() with negative gap should return an error")
+	}
+	if Montage([]image.Image{nil}, 2, 0, bg).Err() == nil {
+		t.Error("Montage() with a nil image should return an error")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	solid := func(w, h int, c color.RGBA) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+		return img
+	}
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	none := color.RGBA{}
+
+	cases := []struct {
+		name       string
+		horizontal bool
+		align      Align
+		size       image.Point
+		probes     map[image.Point]color.RGBA
+	}{
+		{"horizontal start", true, AlignStart, image.Pt(30, 20), map[image.Point]color.RGBA{
+			{5, 15}: red, {25, 2}: blue, {25, 15}: none,
+		}},
+		{"horizontal center", true, AlignCenter, image.Pt(30, 20), map[image.Point]color.RGBA{
+			{25, 2}: none, {25, 10}: blue, {25, 17}: none,
+		}},
+		{"horizontal end", true, AlignEnd, image.Pt(30, 20), map[image.Point]color.RGBA{
+			{25, 2}: none, {25, 15}: blue,
+		}},
+		{"vertical start", false, AlignStart, image.Pt(20, 30), map[image.Point]color.RGBA{
+			{15, 5}: red, {2, 25}: blue, {15, 25}: none,
+		}},
+		{"vertical end", false, AlignEnd, image.Pt(20, 30), map[image.Point]color.RGBA{
+			{2, 25}: none, {15, 25}: blue,
+		}},
+	}
+	for _, c := range cases {
+		proc := New(solid(20, 20, red))
+		if c.horizontal {
+			proc.AppendHorizontal(solid(10, 10, blue), c.align)
+		} else {
+			proc.AppendVertical(solid(10, 10, blue), c.align)
+		}
+		if proc.Err() != nil {
+			t.Fatalf("%s: should not error, got: %v", c.name, proc.Err())
+		}
+		if size := proc.currentImage.Bounds().Size(); size != c.size {
+			t.Errorf("%s: size = %v, want %v", c.name, size, c.size)
+		}
+		for p, want := range c.probes {
+			if got := color.RGBAModel.Convert(proc.currentImage.At(p.X, p.Y)); got != want {
+				t.Errorf("%s: pixel %v = %v, want %v", c.name, p, got, want)
+			}
+		}
+	}
+
+	// Test case: Invalid parameters
+	if New(solid(4, 4, red)).AppendHorizontal(nil, AlignStart).Err() == nil {
+		t.Error("AppendHorizontal(nil) should return an error")
+	}
+	if New(solid(4, 4, red)).AppendVertical(solid(4, 4, blue), Align(7)).Err() == nil {
+		t.Error("AppendVertical() with an unknown alignment should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).AppendHorizontal(solid(4, 4, blue), AlignStart).Err() == nil {
+		t.Fatal("AppendHorizontal() on a processor with prior error should return that error")
+	}
+}
+
+func TestBuildSpriteSheet(t *testing.T) {
+	solid := func(w, h int, c color.RGBA) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+		return img
+	}
+	red, green, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	// A frame with a non-zero origin is packed by its size.
+	offset := solid(16, 8, blue).(*image.RGBA).SubImage(image.Rect(4, 2, 12, 8))
+	frames := []image.Image{solid(10, 20, red), solid(30, 10, green), offset}
+
+	proc, rects := BuildSpriteSheet(frames, 2)
+	if proc.Err() != nil {
+		t.Fatalf("BuildSpriteSheet() should not error, got: %v", proc.Err())
+	}
+	want := []image.Rectangle{image.Rect(0, 0, 10, 20), image.Rect(10, 0, 40, 10), image.Rect(0, 20, 8, 26)}
+	if !slices.Equal(rects, want) {
+		t.Fatalf("BuildSpriteSheet() rects = %v, want %v", rects, want)
+	}
+	if size := proc.currentImage.Bounds().Size(); size != image.Pt(40, 26) {
+		t.Fatalf("BuildSpriteSheet() produced %v, want 40x26", size)
+	}
+	for i, c := range []color.RGBA{red, green, blue} {
+		r := rects[i]
+		for _, p := range []image.Point{r.Min, r.Max.Sub(image.Pt(1, 1))} {
+			if got := color.RGBAModel.Convert(proc.currentImage.At(p.X, p.Y)); got != c {
+				t.Errorf("BuildSpriteSheet() frame %d pixel %v = %v, want %v", i, p, got, c)
+			}
+		}
+	}
+	if _, _, _, a := proc.currentImage.At(20, 15).RGBA(); a != 0 {
+		t.Errorf("BuildSpriteSheet() unused area should be transparent, got alpha %d", a>>8)
+	}
+
+	// Test case: Invalid parameters
+	if proc, rects := BuildSpriteSheet(nil, 2); proc.Err() == nil || rects != nil {
+		t.Error("BuildSpriteSheet() with no frames should return an error and no rectangles")
+	}
+	if proc, _ := BuildSpriteSheet(frames, 0); proc.Err() == nil {
+		t.Error("BuildSpriteSheet() with zero columns should return an error")
+	}
+	if proc, _ := BuildSpriteSheet([]image.Image{nil}, 2); proc.Err() == nil {
+		t.Error("BuildSpriteSheet() with a nil frame should return an error")
+	}
+}
@@ -0,0 +1,97 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createBinaryImage returns a black image with the given rectangles in white.
+func createBinaryImage(width, height int, white ...image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{0, 0, 0, 255}
+			for _, r := range white {
+				if image.Pt(x, y).In(r) {
+					c = color.RGBA{255, 255, 255, 255}
+				}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// whiteBounds returns the bounding box and count of white pixels.
+func whiteBounds(img image.Image) (image.Rectangle, int) {
+	var bounds image.Rectangle
+	n := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r == 0xffff {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+				n++
+			}
+		}
+	}
+	return bounds, n
+}
+
+func TestDilateErode(t *testing.T) {
+	square := image.Rect(10, 10, 20, 20)
+	originalImg := createBinaryImage(30, 30, square)
+
+	proc := New(originalImg).Dilate(2)
+	if proc.Err() != nil {
+		t.Fatalf("Dilate() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if got, n := whiteBounds(img); got != square.Inset(-2) || n != 14*14 {
+		t.Errorf("Dilate(2) white area = %v (%d pixels), want %v", got, n, square.Inset(-2))
+	}
+
+	img, _ = New(originalImg).Erode(2).Image()
+	if got, n := whiteBounds(img); got != square.Inset(2) || n != 6*6 {
+		t.Errorf("Erode(2) white area = %v (%d pixels), want %v", got, n, square.Inset(2))
+	}
+
+	// Radius zero is a no-op.
+	if img, _ := New(originalImg).Dilate(0).Image(); img != originalImg {
+		t.Error("Dilate() with radius 0 should leave the image untouched")
+	}
+
+	// Invalid input
+	if New(originalImg).Erode(-1).Err() == nil {
+		t.Error("Erode() with a negative radius should return an error")
+	}
+	if New(nil).Dilate(1).Err() == nil {
+		t.Fatal("Dilate() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestOpenClose(t *testing.T) {
+	square := image.Rect(10, 10, 20, 20)
+
+	// Opening removes a speck but keeps the square.
+	img, _ := New(createBinaryImage(30, 30, square, image.Rect(25, 25, 26, 26))).Open(1).Image()
+	if got, n := whiteBounds(img); got != square || n != 100 {
+		t.Errorf("Open(1) white area = %v (%d pixels), want only %v", got, n, square)
+	}
+
+	// Closing fills a one-pixel gap but keeps the outline.
+	withGap := createBinaryImage(30, 30, image.Rect(10, 10, 15, 20), image.Rect(16, 10, 20, 20))
+	proc := New(withGap).Close(1)
+	if proc.Err() != nil {
+		t.Fatalf("Close() should not error, got: %v", proc.Err())
+	}
+	img, _ = proc.Image()
+	if got, n := whiteBounds(img); got != square || n != 100 {
+		t.Errorf("Close(1) white area = %v (%d pixels), want filled %v", got, n, square)
+	}
+
+	if New(nil).Open(1).Err() == nil || New(nil).Close(1).Err() == nil {
+		t.Fatal("Open()/Close() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,360 @@
+package gopiq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+func init() {
+	for _, f := range []struct{ name, magic string }{
+		{"pbm", "P1"}, {"pbm", "P4"},
+		{"pgm", "P2"}, {"pgm", "P5"},
+		{"ppm", "P3"}, {"ppm", "P6"},
+	} {
+		image.RegisterFormat(f.name, f.magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+}
+
+// netpbmHeader is the header of a Netpbm bitmap (PBM), graymap (PGM) or
+// pixmap (PPM).
+type netpbmHeader struct {
+	magic                 byte // '1' to '6' of P1 to P6
+	width, height, maxVal int  // maxVal is 1 for bitmaps
+}
+
+// plain reports whether samples are ASCII (P1 to P3) rather than binary.
+func (h netpbmHeader) plain() bool { return h.magic <= '3' }
+
+// bitmap reports whether the image is a PBM of 1 bit per pixel.
+func (h netpbmHeader) bitmap() bool { return h.magic == '1' || h.magic == '4' }
+
+// channels returns the number of samples per pixel.
+func (h netpbmHeader) channels() int {
+	if h.magic == '3' || h.magic == '6' {
+		return 3
+	}
+	return 1
+}
+
+// readNetpbmHeader parses the magic number, dimensions and maximum value,
+// and consumes the single whitespace character that precedes binary
+// samples.
+func readNetpbmHeader(r *bufio.Reader) (netpbmHeader, error) {
+	var h netpbmHeader
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return h, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return h, fmt.Errorf("netpbm: bad magic number %q", magic)
+	}
+	h.magic, h.maxVal = magic[1], 1
+	fields := []*int{&h.width, &h.height, &h.maxVal}
+	if h.bitmap() {
+		fields = fields[:2]
+	}
+	for _, field := range fields {
+		v, err := readNetpbmInt(r)
+		if err != nil {
+			return h, err
+		}
+		*field = v
+	}
+	if h.width <= 0 || h.height <= 0 || h.maxVal <= 0 || h.maxVal > 65535 {
+		return h, fmt.Errorf("netpbm: invalid header %dx%d maxval %d", h.width, h.height, h.maxVal)
+	}
+	if !h.plain() {
+		if _, err := r.ReadByte(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// isNetpbmSpace reports whether c separates fields of a Netpbm file.
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// readNetpbmInt reads a decimal number, skipping whitespace and comments.
+func readNetpbmInt(r *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(digits) > 0 {
+				break
+			}
+			return 0, err
+		}
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+			continue
+		case c == '#' && len(digits) == 0:
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return 0, err
+			}
+			continue
+		case isNetpbmSpace(c):
+			if len(digits) == 0 {
+				continue
+			}
+			if err := r.UnreadByte(); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("netpbm: unexpected byte %q", c)
+		}
+		break
+	}
+	v, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return 0, fmt.Errorf("netpbm: bad number %q", digits)
+	}
+	return v, nil
+}
+
+// readNetpbmBit reads a pixel of a plain bitmap, whose pixels need not be
+// separated by whitespace.
+func readNetpbmBit(r *bufio.Reader) (bool, error) {
+	for {
+		c, err := r.ReadByte()
+		switch {
+		case err != nil:
+			return false, err
+		case c == '0' || c == '1':
+			return c == '1', nil
+		case c == '#':
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return false, err
+			}
+		case !isNetpbmSpace(c):
+			return false, fmt.Errorf("netpbm: unexpected byte %q", c)
+		}
+	}
+}
+
+// decodeNetpbmConfig returns the dimensions and color model of a Netpbm
+// image.
+func decodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	h, err := readNetpbmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.GrayModel
+	switch {
+	case h.channels() == 3 && h.maxVal > 255:
+		model = color.RGBA64Model
+	case h.channels() == 3:
+		model = color.RGBAModel
+	case h.maxVal > 255:
+		model = color.Gray16Model
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
+
+// decodeNetpbm decodes a binary or plain Netpbm image row by row: bitmaps
+// into an *image.Gray of black and white, graymaps into an *image.Gray and
+// pixmaps into an *image.RGBA, or an *image.Gray16 and *image.RGBA64 if
+// their maximum value exceeds 255. Samples are scaled to the full range if
+// the maximum value is lower.
+func decodeNetpbm(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readNetpbmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+	if h.bitmap() {
+		return decodePBM(br, h)
+	}
+	if !h.plain() && h.channels() == 1 && h.maxVal == 255 {
+		img := image.NewGray(rect)
+		if _, err := io.ReadFull(br, img.Pix); err != nil {
+			return nil, fmt.Errorf("netpbm: %w", err)
+		}
+		return img, nil
+	}
+
+	var img image.Image
+	var pix []byte
+	var stride int
+	switch wide := h.maxVal > 255; {
+	case h.channels() == 3 && wide:
+		rgba := image.NewRGBA64(rect)
+		img, pix, stride = rgba, rgba.Pix, rgba.Stride
+	case h.channels() == 3:
+		rgba := newRGBA(rect)
+		img, pix, stride = rgba, rgba.Pix, rgba.Stride
+	case wide:
+		gray := image.NewGray16(rect)
+		img, pix, stride = gray, gray.Pix, gray.Stride
+	default:
+		gray := image.NewGray(rect)
+		img, pix, stride = gray, gray.Pix, gray.Stride
+	}
+	// Samples are stored per row in the layout of the image, leaving room
+	// for the alpha of pixmaps.
+	ch, size := h.channels(), 1
+	if h.maxVal > 255 {
+		size = 2
+	}
+	pixel := ch * size
+	if ch == 3 {
+		pixel = 4 * size
+	}
+	samples := make([]int, h.width*ch)
+	raw := make([]byte, len(samples)*size)
+	for y := range h.height {
+		if h.plain() {
+			for i := range samples {
+				if samples[i], err = readNetpbmInt(br); err != nil {
+					return nil, fmt.Errorf("netpbm: %w", err)
+				}
+			}
+		} else {
+			if _, err := io.ReadFull(br, raw); err != nil {
+				return nil, fmt.Errorf("netpbm: %w", err)
+			}
+			for i := range samples {
+				if size == 2 {
+					samples[i] = int(binary.BigEndian.Uint16(raw[2*i:]))
+				} else {
+					samples[i] = int(raw[i])
+				}
+			}
+		}
+		row := pix[y*stride:]
+		for i, v := range samples {
+			o := i/ch*pixel + i%ch*size
+			if size == 2 {
+				binary.BigEndian.PutUint16(row[o:], uint16((min(v, h.maxVal)*65535+h.maxVal/2)/h.maxVal))
+			} else {
+				row[o] = uint8((min(v, h.maxVal)*255 + h.maxVal/2) / h.maxVal)
+			}
+		}
+		if ch == 3 {
+			for x := range h.width {
+				for i := range size {
+					row[x*pixel+3*size+i] = 0xff
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodePBM decodes the pixels of a bitmap, where 1 is black.
+func decodePBM(r *bufio.Reader, h netpbmHeader) (image.Image, error) {
+	img := image.NewGray(image.Rect(0, 0, h.width, h.height))
+	raw := make([]byte, (h.width+7)/8)
+	for y := range h.height {
+		if !h.plain() {
+			if _, err := io.ReadFull(r, raw); err != nil {
+				return nil, fmt.Errorf("netpbm: %w", err)
+			}
+		}
+		row := img.Pix[y*img.Stride:]
+		for x := range h.width {
+			black := raw[x/8]&(0x80>>(x%8)) != 0
+			if h.plain() {
+				var err error
+				if black, err = readNetpbmBit(r); err != nil {
+					return nil, fmt.Errorf("netpbm: %w", err)
+				}
+			}
+			if !black {
+				row[x] = 255
+			}
+		}
+	}
+	return img, nil
+}
+
+// encodePGM writes img as a binary (P5) PGM, with 16-bit samples for
+// *image.Gray16 and 8-bit samples converted with color.GrayModel otherwise.
+func encodePGM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	var pix []byte
+	maxVal := 255
+	switch src := img.(type) {
+	case *image.Gray16:
+		maxVal = 65535
+		pix = make([]byte, 2*b.Dx()*b.Dy())
+		copyRows(pix, 2*b.Dx(), src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, 2*b.Dx(), b.Dy())
+	case *image.Gray:
+		pix = make([]byte, b.Dx()*b.Dy())
+		copyRows(pix, b.Dx(), src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, b.Dx(), b.Dy())
+	default:
+		gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(gray, gray.Rect, img, b.Min, draw.Src)
+		pix = gray.Pix
+	}
+	if _, err := fmt.Fprintf(w, "P5\n%d %d\n%d\n", b.Dx(), b.Dy(), maxVal); err != nil {
+		return err
+	}
+	_, err := w.Write(pix)
+	return err
+}
+
+// encodePPM writes img as a binary (P6) PPM a row at a time, with 16-bit
+// samples for 16-bit images. Pixmaps have no alpha: translucent pixels are
+// written as if over black.
+func encodePPM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	wide := false
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		wide = true
+	}
+	bw := bufio.NewWriter(w)
+	if wide {
+		fmt.Fprintf(bw, "P6\n%d %d\n65535\n", b.Dx(), b.Dy())
+		row := image.NewRGBA64(image.Rect(0, 0, b.Dx(), 1))
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			draw.Draw(row, row.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+			for x := range b.Dx() {
+				bw.Write(row.Pix[8*x : 8*x+6])
+			}
+		}
+		return bw.Flush()
+	}
+	fmt.Fprintf(bw, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	row := newRGBA(image.Rect(0, 0, b.Dx(), 1))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		draw.Draw(row, row.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+		for x := range b.Dx() {
+			bw.Write(row.Pix[4*x : 4*x+3])
+		}
+	}
+	return bw.Flush()
+}
+
+// encodePBM writes img as a binary (P4) PBM a row at a time, with pixels
+// darker than mid gray black.
+func encodePBM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P4\n%d %d\n", b.Dx(), b.Dy())
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), 1))
+	bits := make([]byte, (b.Dx()+7)/8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		draw.Draw(gray, gray.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+		clear(bits)
+		for x, v := range gray.Pix {
+			if v < 128 {
+				bits[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		bw.Write(bits)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,148 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPGM(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(gray.Pix, []uint8{0, 50, 100, 150, 200, 255})
+
+	data, err := New(gray).ToBytes(FormatPGM)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPGM) should not error, got: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("P5\n3 2\n255\n")) || len(data) != 11+6 {
+		t.Errorf("ToBytes(FormatPGM) = %q, want a P5 header and 6 samples", data)
+	}
+	if DetectFormat(data) != FormatPGM || FormatFromString("pgm") != FormatPGM || FormatPGM.String() != "pgm" {
+		t.Error("FormatPGM should be detected and named pgm")
+	}
+	img, err := FromBytes(data).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() of a PGM should not error, got: %v", err)
+	}
+	if got, ok := img.(*image.Gray); !ok || !bytes.Equal(got.Pix, gray.Pix) {
+		t.Errorf("PGM round trip = %v, want %v", img, gray.Pix)
+	}
+
+	// Plain PGM with comments and a lower maximum value.
+	img, err = FromBytes([]byte("P2\n# scanned page\n2 2 # size\n15\n0 5\n10 15\n")).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() of a plain PGM should not error, got: %v", err)
+	}
+	if got := img.(*image.Gray).Pix; !bytes.Equal(got, []uint8{0, 85, 170, 255}) {
+		t.Errorf("plain PGM samples = %v, want them scaled to 0-255", got)
+	}
+
+	// 16-bit samples decode to Gray16 and round-trip.
+	img, err = FromBytes([]byte("P5 1 1 65535 \x12\x34")).Image()
+	if err != nil {
+		t.Fatalf("FromBytes() of a 16-bit PGM should not error, got: %v", err)
+	}
+	if got, ok := img.(*image.Gray16); !ok || got.Gray16At(0, 0).Y != 0x1234 {
+		t.Errorf("16-bit PGM = %v, want Gray16 0x1234", img)
+	}
+	data, _ = New(img).ToBytes(FormatPGM)
+	if !bytes.Equal(data, []byte("P5\n1 1\n65535\n\x12\x34")) {
+		t.Errorf("16-bit PGM encoding = %q", data)
+	}
+
+	// Color images are converted.
+	data, _ = New(createTestImage(20, 10)).ToBytes(FormatPGM)
+	if img, err := FromBytes(data).Image(); err != nil || img.Bounds().Dx() != 20 || img.(*image.Gray).GrayAt(15, 5).Y != 255 {
+		t.Errorf("PGM from a color image = %v, want a 20x10 gray image", err)
+	}
+
+	// Test case: Invalid files
+	for _, bad := range []string{"P5\n0 2\n255\n", "P5\n2 2\n255\n\x00", "P2\n1 1\n255\nx", "P5\n2 2\n70000\n"} {
+		if FromBytes([]byte(bad)).Err() == nil {
+			t.Errorf("FromBytes(%q) should return an error", bad)
+		}
+	}
+}
+
+func TestPPM(t *testing.T) {
+	src := gradientImage(5, 3)
+	data, err := New(src).ToBytes(FormatPPM)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPPM) should not error, got: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("P6\n5 3\n255\n")) || len(data) != 11+5*3*3 {
+		t.Errorf("ToBytes(FormatPPM) = %q, want a P6 header and 45 samples", data)
+	}
+	if DetectFormat(data) != FormatPPM || FormatFromString("ppm") != FormatPPM || FormatPPM.String() != "ppm" {
+		t.Error("FormatPPM should be detected and named ppm")
+	}
+	img := mustImage(t, FromBytes(data))
+	if got, ok := img.(*image.RGBA); !ok || !bytes.Equal(got.Pix, src.Pix) {
+		t.Errorf("PPM round trip = %T, want the same *image.RGBA", img)
+	}
+	info, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil || info != (ImageInfo{Width: 5, Height: 3, Format: FormatPPM}) {
+		t.Errorf("ProbeReaderAt() = %+v, %v, want 5x3 ppm", info, err)
+	}
+
+	// Plain PPM with a lower maximum value.
+	img = mustImage(t, FromBytes([]byte("P3\n# two pixels\n2 1\n3\n3 0 0  1 2 3\n")))
+	if got := img.(*image.RGBA).Pix; !bytes.Equal(got, []uint8{255, 0, 0, 255, 85, 170, 255, 255}) {
+		t.Errorf("plain PPM pixels = %v, want them scaled to 0-255 and opaque", got)
+	}
+
+	// 16-bit samples decode to RGBA64 and round-trip.
+	img = mustImage(t, FromBytes([]byte("P6 1 1 65535 \x12\x34\x56\x78\x9a\xbc")))
+	if got, ok := img.(*image.RGBA64); !ok || got.RGBA64At(0, 0) != (color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff}) {
+		t.Errorf("16-bit PPM = %v, want RGBA64 0x1234 0x5678 0x9abc", img)
+	}
+	data, _ = New(img).ToBytes(FormatPPM)
+	if !bytes.Equal(data, []byte("P6\n1 1\n65535\n\x12\x34\x56\x78\x9a\xbc")) {
+		t.Errorf("16-bit PPM encoding = %q", data)
+	}
+
+	// Test case: Invalid files
+	for _, bad := range []string{"P6\n2 2\n255\n\x00\x00\x00", "P3\n1 1\n255\n1 2", "P6\n1 1\n0\n\x00\x00\x00", "P7\n1 1\n255\n\x00"} {
+		if FromBytes([]byte(bad)).Err() == nil {
+			t.Errorf("FromBytes(%q) should return an error", bad)
+		}
+	}
+}
+
+func TestPBM(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 10, 2))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i%3) * 120 // 0, 120 and 240
+	}
+	data, err := New(src).ToBytes(FormatPBM)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPBM) should not error, got: %v", err)
+	}
+	// Rows are padded to whole bytes.
+	if !bytes.Equal(data, []byte("P4\n10 2\n\xdb\x40\xb6\xc0")) {
+		t.Errorf("ToBytes(FormatPBM) = %q, want dark pixels as set bits", data)
+	}
+	if DetectFormat(data) != FormatPBM || FormatFromString("pbm") != FormatPBM || FormatPBM.String() != "pbm" {
+		t.Error("FormatPBM should be detected and named pbm")
+	}
+	img := mustImage(t, FromBytes(data)).(*image.Gray)
+	for i, v := range src.Pix {
+		if (v < 128) != (img.Pix[i] == 0) {
+			t.Errorf("PBM round trip pixel %d = %d, want black or white for %d", i, img.Pix[i], v)
+		}
+	}
+
+	// Plain PBM pixels need not be separated.
+	img = mustImage(t, FromBytes([]byte("P1\n# corners\n3 2\n101\n0 1 0\n"))).(*image.Gray)
+	if !bytes.Equal(img.Pix, []uint8{0, 255, 0, 255, 0, 255}) {
+		t.Errorf("plain PBM pixels = %v, want 1 as black", img.Pix)
+	}
+
+	// Test case: Invalid files
+	for _, bad := range []string{"P4\n9 2\n\x00\x00\x00", "P1\n2 1\n12", "P1\n2 1\n1"} {
+		if FromBytes([]byte(bad)).Err() == nil {
+			t.Errorf("FromBytes(%q) should return an error", bad)
+		}
+	}
+}
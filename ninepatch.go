@@ -0,0 +1,70 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Insets are distances in pixels from the top, right, bottom and left edges
+// of an image.
+type Insets struct {
+	Top, Right, Bottom, Left int
+}
+
+// NinePatchScale resizes the image to targetW x targetH by nine-patch
+// scaling: the four corners outside insets are copied unscaled, the edges
+// between them are stretched along their length only and the middle is
+// stretched in both directions. This resizes UI chrome, speech bubbles and
+// frames without distorting their borders.
+// Returns the ImageProcessor for chaining. An error is set if an inset is
+// negative, the insets leave no middle region, or the target is not larger
+// than the insets it must hold.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) NinePatchScale(insets Insets, targetW, targetH int) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if insets.Top < 0 || insets.Right < 0 || insets.Bottom < 0 || insets.Left < 0 {
+		ip.err = fmt.Errorf("insets cannot be negative (got: %+v)", insets)
+		return ip
+	}
+	b := ip.currentImage.Bounds()
+	if insets.Left+insets.Right >= b.Dx() || insets.Top+insets.Bottom >= b.Dy() {
+		ip.err = fmt.Errorf("insets %+v leave no middle region in a %dx%d image", insets, b.Dx(), b.Dy())
+		return ip
+	}
+	if targetW <= insets.Left+insets.Right || targetH <= insets.Top+insets.Bottom {
+		ip.err = fmt.Errorf("nine-patch target %dx%d must be larger than the insets %+v", targetW, targetH, insets)
+		return ip
+	}
+
+	srcX := [4]int{b.Min.X, b.Min.X + insets.Left, b.Max.X - insets.Right, b.Max.X}
+	srcY := [4]int{b.Min.Y, b.Min.Y + insets.Top, b.Max.Y - insets.Bottom, b.Max.Y}
+	dstX := [4]int{0, insets.Left, targetW - insets.Right, targetW}
+	dstY := [4]int{0, insets.Top, targetH - insets.Bottom, targetH}
+
+	dst := newRGBA(image.Rect(0, 0, targetW, targetH))
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			sr := image.Rect(srcX[col], srcY[row], srcX[col+1], srcY[row+1])
+			dr := image.Rect(dstX[col], dstY[row], dstX[col+1], dstY[row+1])
+			switch {
+			case sr.Empty():
+				// Zero insets have no corner or edge patches.
+			case sr.Size() == dr.Size():
+				draw.Draw(dst, dr, ip.currentImage, sr.Min, draw.Src)
+			default:
+				draw.CatmullRom.Scale(dst, dr, ip.currentImage, sr, draw.Src, nil)
+			}
+		}
+	}
+
+	ip.currentImage = dst
+	ip.record("NinePatchScale")
+	return ip
+}
@@ -0,0 +1,69 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNinePatchScale(t *testing.T) {
+	// A 30x30 frame: a 10px red border around a green middle, with blue
+	// marker pixels in two corners.
+	src := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	red, green, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 30; x++ {
+			c := red
+			if x >= 10 && x < 20 && y >= 10 && y < 20 {
+				c = green
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	src.SetRGBA(2, 3, blue)
+	src.SetRGBA(27, 26, blue)
+
+	insets := Insets{Top: 10, Right: 10, Bottom: 10, Left: 10}
+	proc := New(src).NinePatchScale(insets, 100, 50)
+	if proc.Err() != nil {
+		t.Fatalf("NinePatchScale() should not error, got: %v", proc.Err())
+	}
+	out := proc.currentImage.(*image.RGBA)
+	if out.Rect.Size() != image.Pt(100, 50) {
+		t.Fatalf("NinePatchScale() size = %v, want 100x50", out.Rect.Size())
+	}
+	// Corners keep their pixels at the same offsets from their edges.
+	if out.RGBAAt(2, 3) != blue || out.RGBAAt(97, 46) != blue {
+		t.Errorf("corner pixels = %v, %v, want blue", out.RGBAAt(2, 3), out.RGBAAt(97, 46))
+	}
+	// The border stays 10px thick and the middle is stretched.
+	for _, c := range []struct {
+		x, y int
+		want color.RGBA
+	}{{50, 5, red}, {50, 45, red}, {5, 25, red}, {95, 25, red}, {10, 10, green}, {50, 25, green}, {89, 39, green}} {
+		if got := out.RGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+
+	// Zero insets behave like a plain resize of the whole image.
+	if err := New(src).NinePatchScale(Insets{}, 15, 15).Err(); err != nil {
+		t.Errorf("NinePatchScale() with zero insets should not error, got: %v", err)
+	}
+
+	// Invalid input
+	if New(src).NinePatchScale(Insets{Top: -1}, 50, 50).Err() == nil {
+		t.Error("NinePatchScale() with a negative inset should return an error")
+	}
+	if New(src).NinePatchScale(Insets{Left: 15, Right: 15}, 50, 50).Err() == nil {
+		t.Error("NinePatchScale() with insets covering the image should return an error")
+	}
+	if New(src).NinePatchScale(insets, 20, 50).Err() == nil {
+		t.Error("NinePatchScale() with a target smaller than the insets should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).NinePatchScale(insets, 100, 50).Err() == nil {
+		t.Fatal("NinePatchScale() on a processor with prior error should propagate that error")
+	}
+}
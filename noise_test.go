@@ -0,0 +1,158 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// createUniformImage returns a width x height image filled with c.
+func createUniformImage(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// channelStats returns the mean and standard deviation of the red channel.
+func channelStats(img *image.RGBA) (mean, std float64) {
+	n := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		mean += float64(img.Pix[i])
+		n++
+	}
+	mean /= float64(n)
+	for i := 0; i < len(img.Pix); i += 4 {
+		std += sq(float64(img.Pix[i]) - mean)
+	}
+	return mean, math.Sqrt(std / float64(n))
+}
+
+func TestAddNoise(t *testing.T) {
+	gray := createUniformImage(100, 100, color.RGBA{128, 128, 128, 255})
+
+	proc := New(gray).AddNoise(0.1, NoiseGaussian)
+	if proc.Err() != nil {
+		t.Fatalf("AddNoise(NoiseGaussian) should not error, got: %v", proc.Err())
+	}
+	img := proc.currentImage.(*image.RGBA)
+	if mean, std := channelStats(img); math.Abs(mean-128) > 2 || math.Abs(std-25.5) > 2 {
+		t.Errorf("AddNoise(0.1, NoiseGaussian) mean %.1f std %.1f, want about 128 and 25.5", mean, std)
+	}
+	if img.Pix[0] == img.Pix[4] && img.Pix[4] == img.Pix[8] && img.Pix[0] == img.Pix[1] {
+		t.Error("AddNoise(NoiseGaussian) should vary between pixels and channels")
+	}
+
+	// Fresh noise on every call.
+	again, _ := New(gray).AddNoise(0.1, NoiseGaussian).Image()
+	if string(again.(*image.RGBA).Pix) == string(img.Pix) {
+		t.Error("AddNoise() should draw new noise on every call")
+	}
+
+	proc = New(gray).AddNoise(0.2, NoiseSaltPepper)
+	if proc.Err() != nil {
+		t.Fatalf("AddNoise(NoiseSaltPepper) should not error, got: %v", proc.Err())
+	}
+	img = proc.currentImage.(*image.RGBA)
+	var salt, pepper int
+	for i := 0; i < len(img.Pix); i += 4 {
+		switch img.Pix[i] {
+		case 255:
+			salt++
+		case 0:
+			pepper++
+		case 128:
+		default:
+			t.Fatalf("AddNoise(NoiseSaltPepper) produced level %d", img.Pix[i])
+		}
+	}
+	if salt < 800 || salt > 1200 || pepper < 800 || pepper > 1200 {
+		t.Errorf("AddNoise(0.2, NoiseSaltPepper) salt %d pepper %d, want about 1000 each", salt, pepper)
+	}
+
+	// Alpha is preserved and colors stay premultiplied.
+	translucent := createUniformImage(20, 20, color.NRGBA{128, 128, 128, 100})
+	img = New(translucent).AddNoise(1, NoiseGaussian).currentImage.(*image.RGBA)
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] != 100 || img.Pix[i] > 100 || img.Pix[i+1] > 100 || img.Pix[i+2] > 100 {
+			t.Fatalf("AddNoise() broke alpha at %d: %v", i/4, img.Pix[i:i+4])
+		}
+	}
+
+	// Views whose rows are wider than the image are read by their own
+	// stride: without noise the result is that of a compact copy.
+	wide, compact := wideStrideImage(60, 50)
+	for _, kind := range []NoiseKind{NoiseGaussian, NoiseSaltPepper} {
+		got, want := mustImage(t, New(wide).AddNoise(0, kind)), mustImage(t, New(compact).AddNoise(0, kind))
+		if !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+			t.Errorf("AddNoise(0, %v) of a wide-stride view differs from that of a compact copy", kind)
+		}
+		if err := New(wide).AddNoise(0.5, kind).Err(); err != nil {
+			t.Errorf("AddNoise(%v) of a wide-stride view should not error, got: %v", kind, err)
+		}
+	}
+
+	// Invalid input
+	if New(gray).AddNoise(1.5, NoiseGaussian).Err() == nil {
+		t.Error("AddNoise() with amount above 1 should return an error")
+	}
+	if New(gray).AddNoise(0.1, NoiseKind(7)).Err() == nil {
+		t.Error("AddNoise() with an unknown kind should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).AddNoise(0.1, NoiseGaussian).Err() == nil {
+		t.Fatal("AddNoise() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestFilmGrain(t *testing.T) {
+	gray := createUniformImage(100, 100, color.RGBA{128, 128, 128, 255})
+
+	proc := New(gray).FilmGrain(0.3)
+	if proc.Err() != nil {
+		t.Fatalf("FilmGrain() should not error, got: %v", proc.Err())
+	}
+	img := proc.currentImage.(*image.RGBA)
+	if mean, std := channelStats(img); math.Abs(mean-128) > 2 || math.Abs(std-12) > 2 {
+		t.Errorf("FilmGrain(0.3) mean %.1f std %.1f, want about 128 and 12", mean, std)
+	}
+	// Grain is monochrome.
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != img.Pix[i+1] || img.Pix[i] != img.Pix[i+2] {
+			t.Fatalf("FilmGrain() should be monochrome, got %v", img.Pix[i:i+4])
+		}
+	}
+
+	// Pure black and white are left alone.
+	for _, c := range []color.RGBA{{0, 0, 0, 255}, {255, 255, 255, 255}} {
+		flat := createUniformImage(20, 20, c)
+		out, _ := New(flat).FilmGrain(1).Image()
+		if string(out.(*image.RGBA).Pix) != string(flat.Pix) {
+			t.Errorf("FilmGrain() should not change %v", c)
+		}
+	}
+
+	// Views whose rows are wider than the image are read by their own
+	// stride: without grain the result is that of a compact copy.
+	wide, compact := wideStrideImage(60, 50)
+	if got, want := mustImage(t, New(wide).FilmGrain(0)), mustImage(t, New(compact).FilmGrain(0)); !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+		t.Error("FilmGrain(0) of a wide-stride view differs from that of a compact copy")
+	}
+	if err := New(wide).FilmGrain(0.5).Err(); err != nil {
+		t.Errorf("FilmGrain() of a wide-stride view should not error, got: %v", err)
+	}
+
+	// Invalid input
+	if New(gray).FilmGrain(-0.1).Err() == nil {
+		t.Error("FilmGrain() with negative intensity should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).FilmGrain(0.3).Err() == nil {
+		t.Fatal("FilmGrain() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,341 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// OrientationHint tells AutoOrient what kind of content to analyze.
+type OrientationHint int
+
+const (
+	// OrientationText detects text lines and the side ascenders point to;
+	// suited to scanned documents, receipts and screenshots.
+	OrientationText OrientationHint = iota
+	// OrientationPhoto assumes the brightest, smoothest border (usually sky)
+	// belongs at the top; suited to outdoor photos.
+	OrientationPhoto
+)
+
+const (
+	// orientMaxSide is the longest side of the downscaled analysis image.
+	orientMaxSide = 1200
+	// orientMinInk is the minimum fraction of ink pixels for text analysis.
+	orientMinInk = 0.005
+	// orientPhotoMargin is how much better (in luma levels) another
+	// orientation must score before a photo is rotated.
+	orientPhotoMargin = 12
+)
+
+// AutoOrient rotates the image by a multiple of 90 degrees so that its content
+// is upright, for scans and photos whose EXIF orientation is missing or wrong.
+// With OrientationText, text lines are found with projection profiles and the
+// ascender/descender asymmetry of Latin script tells top from bottom. With
+// OrientationPhoto, the border region that looks most like sky is moved to
+// the top. Images without a clear signal are left unchanged. Either way the
+// EXIF orientation of output written with WithKeepMetadata is reset to 1.
+// Returns the ImageProcessor for chaining. An error is set if the hint is
+// unknown.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) AutoOrient(contentHint OrientationHint) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+
+	src := asRGBA(ip.currentImage)
+	small := src
+	if side := max(src.Rect.Dx(), src.Rect.Dy()); side > orientMaxSide {
+		s := float64(orientMaxSide) / float64(side)
+		small = image.NewRGBA(image.Rect(0, 0, max(1, int(float64(src.Rect.Dx())*s)), max(1, int(float64(src.Rect.Dy())*s))))
+		draw.ApproxBiLinear.Scale(small, small.Rect, src, src.Rect, draw.Src, nil)
+	}
+
+	var turns int
+	switch contentHint {
+	case OrientationText:
+		turns = textOrientation(small)
+	case OrientationPhoto:
+		turns = photoOrientation(small)
+	default:
+		ip.err = fmt.Errorf("unknown orientation hint: %d", contentHint)
+		return ip
+	}
+	// The pixels are upright now whether or not they were turned, so the
+	// EXIF orientation must not be applied on top.
+	ip.upright = true
+	if turns != 0 {
+		ip.currentImage = rotateQuarter(src, turns)
+		ip.record("AutoOrient")
+	}
+	return ip
+}
+
+// textOrientation returns the clockwise quarter turns that make the text in
+// img upright.
+func textOrientation(img *image.RGBA) int {
+	ink, w, h := binarize(img)
+	count := 0
+	for _, v := range ink {
+		if v {
+			count++
+		}
+	}
+	if float64(count) < orientMinInk*float64(w*h) {
+		return 0
+	}
+
+	// Text lines make the profile across them far more uneven than the
+	// profile along them.
+	rows, cols := make([]float64, h), make([]float64, w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if ink[y*w+x] {
+				rows[y]++
+				cols[x]++
+			}
+		}
+	}
+	candidates := []int{0, 2}
+	if profileContrast(cols) > profileContrast(rows) {
+		candidates = []int{1, 3}
+	}
+
+	best, bestScore := candidates[0], math.Inf(-1)
+	for _, t := range candidates {
+		rotated := rotateBool(ink, w, h, t)
+		rw := w
+		if t%2 == 1 {
+			rw = h
+		}
+		if s := ascenderScore(rotated, rw); s > bestScore {
+			best, bestScore = t, s
+		}
+	}
+	return best
+}
+
+// binarize returns an ink mask of img using Otsu's threshold. Ink is the
+// minority class, so light text on dark backgrounds is handled as well.
+func binarize(img *image.RGBA) (ink []bool, w, h int) {
+	w, h = img.Rect.Dx(), img.Rect.Dy()
+	luma := make([]uint8, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			a := img.Pix[i+3]
+			l := clampUint8(luminance(unpremultiply(img.Pix[i], a), unpremultiply(img.Pix[i+1], a), unpremultiply(img.Pix[i+2], a)))
+			luma[y*w+x] = l
+			hist[l]++
+		}
+	}
+	t := otsuThreshold(&hist)
+	ink = make([]bool, w*h)
+	dark := 0
+	for i, l := range luma {
+		ink[i] = l <= t
+		if ink[i] {
+			dark++
+		}
+	}
+	if 2*dark > len(ink) {
+		for i := range ink {
+			ink[i] = !ink[i]
+		}
+	}
+	return ink, w, h
+}
+
+// otsuThreshold returns the threshold that maximizes the between-class
+// variance of a luma histogram; values <= threshold form the dark class.
+func otsuThreshold(hist *[256]int) uint8 {
+	total, sum := 0, 0.0
+	for v, n := range hist {
+		total += n
+		sum += float64(v * n)
+	}
+	var best uint8
+	bestVar, weightB, sumB := -1.0, 0, 0.0
+	for v, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(v * n)
+		meanB, meanF := sumB/float64(weightB), (sum-sumB)/float64(weightF)
+		if between := float64(weightB) * float64(weightF) * sq(meanB-meanF); between > bestVar {
+			best, bestVar = uint8(v), between
+		}
+	}
+	return best
+}
+
+// profileContrast returns the squared coefficient of variation of a
+// projection profile.
+func profileContrast(p []float64) float64 {
+	mean := 0.0
+	for _, v := range p {
+		mean += v
+	}
+	mean /= float64(len(p))
+	if mean == 0 {
+		return 0
+	}
+	variance := 0.0
+	for _, v := range p {
+		variance += sq(v - mean)
+	}
+	return variance / float64(len(p)) / sq(mean)
+}
+
+// ascenderScore measures how much more ink extends above the dense core of
+// each text line than below it, in [-1, 1]. Latin text has more ascenders
+// than descenders, so upright text scores positive.
+func ascenderScore(ink []bool, w int) float64 {
+	h := len(ink) / w
+	rows := make([]float64, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if ink[y*w+x] {
+				rows[y]++
+			}
+		}
+	}
+
+	var above, below float64
+	for y0 := 0; y0 < h; {
+		if rows[y0] == 0 {
+			y0++
+			continue
+		}
+		y1, peak := y0, 0.0
+		for y1 < h && rows[y1] > 0 {
+			peak = max(peak, rows[y1])
+			y1++
+		}
+		// The core (x-height band) is where the profile exceeds half its peak.
+		top, bottom := y0, y1-1
+		for rows[top] < peak/2 {
+			top++
+		}
+		for rows[bottom] < peak/2 {
+			bottom--
+		}
+		for y := y0; y < top; y++ {
+			above += rows[y]
+		}
+		for y := bottom + 1; y < y1; y++ {
+			below += rows[y]
+		}
+		y0 = y1
+	}
+	if above+below == 0 {
+		return 0
+	}
+	return (above - below) / (above + below)
+}
+
+// photoOrientation returns the clockwise quarter turns that move the most
+// sky-like border band of img to the top.
+func photoOrientation(img *image.RGBA) int {
+	best, bestScore := 0, math.Inf(-1)
+	scores := [4]float64{}
+	for t := 0; t < 4; t++ {
+		scores[t] = skyScore(rotateQuarter(img, t))
+		if scores[t] > bestScore {
+			best, bestScore = t, scores[t]
+		}
+	}
+	if bestScore-scores[0] < orientPhotoMargin {
+		return 0
+	}
+	return best
+}
+
+// skyScore rates how much the top quarter of img looks like sky compared to
+// the bottom quarter: brighter and smoother.
+func skyScore(img *image.RGBA) float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	band := max(1, h/4)
+	stats := func(y0, y1 int) (mean, texture float64) {
+		n := 0
+		for y := y0; y < y1; y++ {
+			prev := 0.0
+			for x := 0; x < w; x++ {
+				i := y*img.Stride + x*4
+				a := img.Pix[i+3]
+				l := luminance(unpremultiply(img.Pix[i], a), unpremultiply(img.Pix[i+1], a), unpremultiply(img.Pix[i+2], a))
+				mean += l
+				if x > 0 {
+					texture += math.Abs(l - prev)
+				}
+				prev = l
+				n++
+			}
+		}
+		return mean / float64(n), texture / float64(n)
+	}
+	topMean, topTexture := stats(0, band)
+	bottomMean, bottomTexture := stats(h-band, h)
+	return (topMean - bottomMean) - (topTexture - bottomTexture)
+}
+
+// rotateQuarter rotates an origin-based image clockwise by turns quarter
+// turns (0-3).
+func rotateQuarter(src *image.RGBA, turns int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	turns = ((turns % 4) + 4) % 4
+	dw, dh := w, h
+	if turns%2 == 1 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := quarterTurn(x, y, w, h, turns)
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:])
+		}
+	}
+	return dst
+}
+
+// rotateBool rotates a w x h mask clockwise by turns quarter turns.
+func rotateBool(mask []bool, w, h, turns int) []bool {
+	dw := w
+	if turns%2 == 1 {
+		dw = h
+	}
+	out := make([]bool, len(mask))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := quarterTurn(x, y, w, h, turns)
+			out[dy*dw+dx] = mask[y*w+x]
+		}
+	}
+	return out
+}
+
+// quarterTurn maps (x, y) of a w x h image to its position after turns
+// clockwise quarter turns.
+func quarterTurn(x, y, w, h, turns int) (int, int) {
+	switch turns {
+	case 1:
+		return h - 1 - y, x
+	case 2:
+		return w - 1 - x, h - 1 - y
+	case 3:
+		return y, w - 1 - x
+	default:
+		return x, y
+	}
+}
@@ -0,0 +1,147 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// createTextPage returns a white page with several lines of black text.
+func createTextPage(t *testing.T) *image.RGBA {
+	t.Helper()
+	face, err := newFontFace(goregular.TTF, 16)
+	if err != nil {
+		t.Fatalf("failed to load font: %v", err)
+	}
+	defer face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, 420, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	lines := []string{
+		"The quick brown fox jumps over the lazy dog.",
+		"Pack my box with five dozen liquor jugs.",
+		"Sphinx of black quartz, judge my vow.",
+		"How vexingly quick daft zebras jump!",
+		"The five boxing wizards jump quickly.",
+		"Bright vixens jump; dozy fowl quack.",
+		"Jackdaws love my big sphinx of quartz.",
+	}
+	dr := &font.Drawer{Dst: img, Src: image.Black, Face: face}
+	for i, line := range lines {
+		dr.Dot = fixed.P(20, 40+i*34)
+		dr.DrawString(line)
+	}
+	return img
+}
+
+func TestAutoOrientText(t *testing.T) {
+	page := createTextPage(t)
+	for turns := 0; turns < 4; turns++ {
+		proc := New(rotateQuarter(page, turns)).AutoOrient(OrientationText)
+		if proc.Err() != nil {
+			t.Fatalf("AutoOrient() should not error, got: %v", proc.Err())
+		}
+		res, err := proc.Compare(page)
+		if err != nil || !res.Equal() {
+			t.Errorf("AutoOrient() did not restore a page rotated by %d quarter turns", turns)
+		}
+	}
+
+	// A blank page has nothing to detect and stays as is.
+	blank := image.NewRGBA(image.Rect(0, 0, 40, 80))
+	if img, _ := New(blank).AutoOrient(OrientationText).Image(); img.Bounds() != blank.Bounds() {
+		t.Errorf("AutoOrient() rotated a blank page to %v", img.Bounds())
+	}
+}
+
+func TestAutoOrientPhoto(t *testing.T) {
+	// Smooth bright sky above textured dark ground.
+	photo := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			c := color.RGBA{170, 200, 240, 255}
+			if y >= 70 {
+				v := uint8(40 + (x*7+y*13)%50)
+				c = color.RGBA{v, v + 20, v / 2, 255}
+			}
+			photo.SetRGBA(x, y, c)
+		}
+	}
+	for turns := 0; turns < 4; turns++ {
+		res, err := New(rotateQuarter(photo, turns)).AutoOrient(OrientationPhoto).Compare(photo)
+		if err != nil || !res.Equal() {
+			t.Errorf("AutoOrient() did not restore a photo rotated by %d quarter turns", turns)
+		}
+	}
+
+	// Invalid input
+	if New(photo).AutoOrient(OrientationHint(42)).Err() == nil {
+		t.Error("AutoOrient() with an unknown hint should return an error")
+	}
+	if New(nil).AutoOrient(OrientationText).Err() == nil {
+		t.Fatal("AutoOrient() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestAutoOrientResetsEXIFOrientation(t *testing.T) {
+	orientation := func(proc *ImageProcessor) int {
+		t.Helper()
+		md, err := FromBytes(mustBytes(t, proc, FormatJPEG, WithKeepMetadata())).Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return md.Orientation
+	}
+	// A uniform image gives no signal, so AutoOrient leaves its pixels
+	// alone; they are still what it judged upright.
+	src := jpegWithMetadata(t, createUniformImage(32, 24, color.RGBA{90, 120, 150, 255}))
+	if got := orientation(FromBytes(src)); got != 6 {
+		t.Fatalf("kept orientation without AutoOrient = %d, want 6", got)
+	}
+	proc := FromBytes(src).AutoOrient(OrientationPhoto)
+	if slices.Contains(proc.Operations(), "AutoOrient") {
+		t.Fatal("AutoOrient() should not turn a uniform image")
+	}
+	if got := orientation(proc); got != 1 {
+		t.Errorf("kept orientation after AutoOrient = %d, want 1", got)
+	}
+	if got := orientation(proc.Clone().Resize(16, 12)); got != 1 {
+		t.Errorf("kept orientation of a clone after AutoOrient = %d, want 1", got)
+	}
+
+	// Test case: Invalid input
+	if FromBytes(src).AutoOrient(OrientationHint(42)).upright {
+		t.Error("AutoOrient() with an unknown hint should not mark the pixels upright")
+	}
+}
+
+func TestRotateQuarter(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	cases := []struct {
+		turns int
+		size  image.Point
+		red   image.Point
+	}{
+		{0, image.Pt(3, 2), image.Pt(0, 0)},
+		{1, image.Pt(2, 3), image.Pt(1, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 1)},
+		{3, image.Pt(2, 3), image.Pt(0, 2)},
+	}
+	for _, c := range cases {
+		dst := rotateQuarter(src, c.turns)
+		if dst.Rect.Size() != c.size {
+			t.Errorf("rotateQuarter(%d) size = %v, want %v", c.turns, dst.Rect.Size(), c.size)
+		}
+		if dst.RGBAAt(c.red.X, c.red.Y).R != 255 {
+			t.Errorf("rotateQuarter(%d) moved the corner pixel away from %v", c.turns, c.red)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestComposite(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 50, 50))
+	draw.Draw(base, base.Rect, image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	// A non-origin overlay: opaque red on the left, transparent on the right.
+	overlay := image.NewRGBA(image.Rect(100, 100, 120, 110))
+	draw.Draw(overlay, image.Rect(100, 100, 110, 110), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	proc := New(base).Composite(overlay, 10, 20, 1)
+	if proc.Err() != nil {
+		t.Fatalf("Composite() should not error, got: %v", proc.Err())
+	}
+	cases := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{12, 22, color.RGBA{255, 0, 0, 255}}, // Opaque overlay
+		{25, 22, color.RGBA{0, 0, 255, 255}}, // Transparent overlay
+		{5, 5, color.RGBA{0, 0, 255, 255}},   // Outside the overlay
+	}
+	for _, c := range cases {
+		if got := color.RGBAModel.Convert(proc.currentImage.At(c.x, c.y)); got != c.want {
+			t.Errorf("Composite() pixel (%d, %d) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+
+	// Half opacity blends; overlays hanging off the edge are clipped.
+	proc = New(base).Composite(overlay, 45, -5, 0.5)
+	if proc.Err() != nil {
+		t.Fatalf("Composite() partly outside the image should not error, got: %v", proc.Err())
+	}
+	r, _, b, _ := proc.currentImage.At(47, 2).RGBA()
+	if r>>8 < 120 || r>>8 > 135 || b>>8 < 120 || b>>8 > 135 {
+		t.Errorf("Composite() at half opacity = r%d b%d, want an even blend", r>>8, b>>8)
+	}
+
+	// Test case: Invalid parameters
+	if New(base).Composite(nil, 0, 0, 1).Err() == nil {
+		t.Error("Composite() with nil overlay should return an error")
+	}
+	if New(base).Composite(overlay, 0, 0, 1.5).Err() == nil {
+		t.Error("Composite() with opacity above 1 should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).Composite(overlay, 0, 0, 1).Err() == nil {
+		t.Fatal("Composite() on a processor with prior error should return that error")
+	}
+}
+
+func TestCompositeAt(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	draw.Draw(base, base.Rect, image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	overlay := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(overlay, overlay.Rect, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	// Half-pixel positions blend the overlay's edges with the background.
+	proc := New(base).CompositeAt(overlay, 10.5, 10, 1)
+	if proc.Err() != nil {
+		t.Fatalf("CompositeAt() should not error, got: %v", proc.Err())
+	}
+	if r, _, b, _ := proc.currentImage.At(10, 14).RGBA(); r>>8 < 100 || r>>8 > 155 || b>>8 < 100 || b>>8 > 155 {
+		t.Errorf("CompositeAt() left edge = r%d b%d, want a half blend", r>>8, b>>8)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(14, 14)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("CompositeAt() interior = %v, want red", got)
+	}
+
+	// Whole-pixel positions match Composite exactly.
+	want, _ := New(base).Composite(overlay, 3, 4, 0.7).Image()
+	got, _ := New(base).CompositeAt(overlay, 3, 4, 0.7).Image()
+	if !bytesEqualRGBA(got, want) {
+		t.Error("CompositeAt() at whole pixels should match Composite()")
+	}
+
+	// Test case: Invalid parameters
+	if New(base).CompositeAt(nil, 0.5, 0, 1).Err() == nil {
+		t.Error("CompositeAt() with nil overlay should return an error")
+	}
+	if New(base).CompositeAt(overlay, 0.5, 0, -0.1).Err() == nil {
+		t.Error("CompositeAt() with negative opacity should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).CompositeAt(overlay, 0.5, 0.5, 1).Err() == nil {
+		t.Fatal("CompositeAt() on a processor with prior error should return that error")
+	}
+}
+
+// bytesEqualRGBA reports whether two RGBA images have identical bounds and pixels.
+func bytesEqualRGBA(a, b image.Image) bool {
+	ra, ok1 := a.(*image.RGBA)
+	rb, ok2 := b.(*image.RGBA)
+	return ok1 && ok2 && ra.Rect == rb.Rect && bytes.Equal(ra.Pix, rb.Pix)
+}
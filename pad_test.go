@@ -0,0 +1,103 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestPadAuto(t *testing.T) {
+	// A mostly green image with a dark red frame and a few noisy edge pixels.
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{120, 10, 10, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 10, 90, 90), image.NewUniform(color.RGBA{0, 200, 0, 255}), image.Point{}, draw.Src)
+	for y := 0; y < 100; y += 7 {
+		img.SetRGBA(0, y, color.RGBA{255, 255, 255, 255})
+	}
+
+	proc := New(img).PadAuto(200, 100)
+	if proc.Err() != nil {
+		t.Fatalf("PadAuto() should not error, got: %v", proc.Err())
+	}
+	if size := proc.currentImage.Bounds().Size(); size != image.Pt(200, 100) {
+		t.Fatalf("PadAuto() produced %v, want 200x100", size)
+	}
+	for _, x := range []int{5, 195} {
+		if got := color.RGBAModel.Convert(proc.currentImage.At(x, 50)); got != (color.RGBA{120, 10, 10, 255}) {
+			t.Errorf("PadAuto() bar at x=%d = %v, want the frame color", x, got)
+		}
+	}
+	if _, g, _, _ := proc.currentImage.At(100, 50).RGBA(); g>>8 != 200 {
+		t.Errorf("PadAuto() should keep the image centered, got green %d", g>>8)
+	}
+
+	// Bars above and below sample the top and bottom edges.
+	draw.Draw(img, image.Rect(0, 0, 100, 5), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 95, 100, 100), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	proc = New(img).PadAuto(50, 80)
+	if got := color.RGBAModel.Convert(proc.currentImage.At(25, 2)); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("PadAuto() top bar = %v, want the top edge color", got)
+	}
+
+	// Test case: Invalid dimensions
+	if New(img).PadAuto(0, 100).Err() == nil {
+		t.Error("PadAuto() with zero width should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).PadAuto(100, 100).Err() == nil {
+		t.Fatal("PadAuto() on a processor with prior error should return that error")
+	}
+}
+
+func TestExtendBlurred(t *testing.T) {
+	// Vertical red and blue halves.
+	img := image.NewRGBA(image.Rect(0, 0, 60, 100))
+	draw.Draw(img, image.Rect(0, 0, 30, 100), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(30, 0, 60, 100), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+
+	proc := New(img).ExtendBlurred(300, 100, 20)
+	if proc.Err() != nil {
+		t.Fatalf("ExtendBlurred() should not error, got: %v", proc.Err())
+	}
+	if size := proc.currentImage.Bounds().Size(); size != image.Pt(300, 100) {
+		t.Fatalf("ExtendBlurred() produced %v, want 300x100", size)
+	}
+	// The centered image is sharp.
+	if got := color.RGBAModel.Convert(proc.currentImage.At(125, 50)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("ExtendBlurred() image area = %v, want red", got)
+	}
+	// The bars come from the cover-scaled image: reddish on the left and
+	// bluish on the right.
+	r, _, b, _ := proc.currentImage.At(10, 50).RGBA()
+	if r <= b {
+		t.Errorf("ExtendBlurred() left bar should be reddish, got r=%d b=%d", r>>8, b>>8)
+	}
+	r, _, b, _ = proc.currentImage.At(290, 50).RGBA()
+	if b <= r {
+		t.Errorf("ExtendBlurred() right bar should be bluish, got r=%d b=%d", r>>8, b>>8)
+	}
+	// Blue from the hidden seam in the middle bleeds into the left bar.
+	if _, _, b, _ := proc.currentImage.At(115, 50).RGBA(); b>>8 < 10 {
+		t.Errorf("ExtendBlurred() should blur the background, got blue %d near the seam", b>>8)
+	}
+	sharp, _ := New(img).ExtendBlurred(300, 100, 0).Image()
+	if got := color.RGBAModel.Convert(sharp.At(115, 50)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("ExtendBlurred() with zero sigma should not blur, got %v", got)
+	}
+
+	// Test case: Invalid parameters
+	if New(img).ExtendBlurred(0, 100, 5).Err() == nil {
+		t.Error("ExtendBlurred() with zero width should return an error")
+	}
+	if New(img).ExtendBlurred(100, 100, -1).Err() == nil {
+		t.Error("ExtendBlurred() with negative sigma should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ExtendBlurred(100, 100, 5).Err() == nil {
+		t.Fatal("ExtendBlurred() on a processor with prior error should return that error")
+	}
+}
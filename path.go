@@ -0,0 +1,268 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// PathOp identifies the kind of a PathSegment.
+type PathOp int
+
+const (
+	PathMoveTo PathOp = iota // Start a new sub-path at Points[0]
+	PathLineTo               // Straight line to Points[0]
+	PathQuadTo               // Quadratic Bézier with control Points[0] ending at Points[1]
+	PathCubeTo               // Cubic Bézier with controls Points[0], Points[1] ending at Points[2]
+	PathClose                // Close the current sub-path
+)
+
+// PathSegment is a single command of a vector path. Coordinates are in image
+// pixel space.
+type PathSegment struct {
+	Op     PathOp
+	Points []image.Point
+}
+
+// MoveTo returns a PathSegment that starts a new sub-path at (x, y).
+func MoveTo(x, y int) PathSegment {
+	return PathSegment{Op: PathMoveTo, Points: []image.Point{{x, y}}}
+}
+
+// LineTo returns a PathSegment that draws a straight line to (x, y).
+func LineTo(x, y int) PathSegment {
+	return PathSegment{Op: PathLineTo, Points: []image.Point{{x, y}}}
+}
+
+// QuadTo returns a PathSegment that draws a quadratic Bézier curve with
+// control point (cx, cy) ending at (x, y).
+func QuadTo(cx, cy, x, y int) PathSegment {
+	return PathSegment{Op: PathQuadTo, Points: []image.Point{{cx, cy}, {x, y}}}
+}
+
+// CubeTo returns a PathSegment that draws a cubic Bézier curve with control
+// points (c1x, c1y) and (c2x, c2y) ending at (x, y).
+func CubeTo(c1x, c1y, c2x, c2y, x, y int) PathSegment {
+	return PathSegment{Op: PathCubeTo, Points: []image.Point{{c1x, c1y}, {c2x, c2y}, {x, y}}}
+}
+
+// ClosePath returns a PathSegment that closes the current sub-path.
+func ClosePath() PathSegment {
+	return PathSegment{Op: PathClose}
+}
+
+// validatePath checks that path starts with a MoveTo and that every segment
+// carries the number of points its operation requires.
+func validatePath(path []PathSegment) error {
+	if len(path) == 0 {
+		return fmt.Errorf("path cannot be empty")
+	}
+	if path[0].Op != PathMoveTo {
+		return fmt.Errorf("path must start with a MoveTo segment")
+	}
+	for i, seg := range path {
+		want := 0
+		switch seg.Op {
+		case PathMoveTo, PathLineTo:
+			want = 1
+		case PathQuadTo:
+			want = 2
+		case PathCubeTo:
+			want = 3
+		case PathClose:
+			want = 0
+		default:
+			return fmt.Errorf("path segment %d has unknown operation %d", i, seg.Op)
+		}
+		if len(seg.Points) != want {
+			return fmt.Errorf("path segment %d needs %d points, got %d", i, want, len(seg.Points))
+		}
+	}
+	return nil
+}
+
+// pathBounds returns the bounding box of all points in path. Bézier curves
+// lie within the hull of their control points, so the box contains the
+// whole shape.
+func pathBounds(path []PathSegment) image.Rectangle {
+	var r image.Rectangle
+	first := true
+	for _, seg := range path {
+		for _, p := range seg.Points {
+			pr := image.Rectangle{Min: p, Max: p.Add(image.Point{1, 1})}
+			if first {
+				r, first = pr, false
+			} else {
+				r = r.Union(pr)
+			}
+		}
+	}
+	return r
+}
+
+// subpath is a flattened sub-path of a vector path.
+type subpath struct {
+	points []vec2
+	closed bool
+}
+
+// flattenPath approximates the sub-paths of path by polylines within
+// curveTolerance, with every point moved by offset. As in SVG, a segment
+// after a ClosePath starts from the point the closed sub-path started at.
+func flattenPath(path []PathSegment, offset vec2) []subpath {
+	pt := func(p image.Point) vec2 {
+		return vec2{float64(p.X), float64(p.Y)}.add(offset)
+	}
+	var out []subpath
+	var cur []vec2
+	var start vec2
+	flush := func(closed bool) {
+		if len(cur) > 0 {
+			out = append(out, subpath{points: cur, closed: closed})
+		}
+		cur = nil
+	}
+	for _, seg := range path {
+		if len(cur) == 0 && seg.Op != PathMoveTo && seg.Op != PathClose {
+			cur = []vec2{start}
+		}
+		switch seg.Op {
+		case PathMoveTo:
+			flush(false)
+			start = pt(seg.Points[0])
+			cur = []vec2{start}
+		case PathLineTo:
+			cur = append(cur, pt(seg.Points[0]))
+		case PathQuadTo:
+			p0, c, p1 := cur[len(cur)-1], pt(seg.Points[0]), pt(seg.Points[1])
+			// A quadratic's chords of 1/n of it deviate by at most
+			// |p0-2c+p1|/(8n²).
+			n := curveSteps(p0.sub(c.scale(2)).add(p1).length() / 8)
+			for i := 1; i <= n; i++ {
+				t := float64(i) / float64(n)
+				u := 1 - t
+				cur = append(cur, p0.scale(u*u).add(c.scale(2*u*t)).add(p1.scale(t*t)))
+			}
+		case PathCubeTo:
+			p0, c0, c1, p1 := cur[len(cur)-1], pt(seg.Points[0]), pt(seg.Points[1]), pt(seg.Points[2])
+			// Likewise a cubic's by at most 3/4 of its larger second
+			// difference over n².
+			dd := max(p0.sub(c0.scale(2)).add(c1).length(), c0.sub(c1.scale(2)).add(p1).length())
+			n := curveSteps(dd * 3 / 4)
+			for i := 1; i <= n; i++ {
+				t := float64(i) / float64(n)
+				u := 1 - t
+				cur = append(cur, p0.scale(u*u*u).add(c0.scale(3*u*u*t)).add(c1.scale(3*u*t*t)).add(p1.scale(t*t*t)))
+			}
+		case PathClose:
+			flush(true)
+		}
+	}
+	flush(false)
+	return out
+}
+
+// curveSteps returns the number of chords that approximate a curve within
+// curveTolerance, given its deviation from a single chord times n².
+func curveSteps(deviation float64) int {
+	return max(1, min(1024, int(math.Ceil(math.Sqrt(deviation/curveTolerance)))))
+}
+
+// rasterizePath fills path (using the non-zero winding rule) into an alpha
+// mask covering rect. As in SVG, every sub-path is closed for filling. Without antialiasing every mask pixel is either fully
+// opaque or fully transparent.
+func rasterizePath(path []PathSegment, rect image.Rectangle, antialias bool) *image.Alpha {
+	z := vector.NewRasterizer(rect.Dx(), rect.Dy())
+	pt := func(p image.Point) (float32, float32) {
+		return float32(p.X - rect.Min.X), float32(p.Y - rect.Min.Y)
+	}
+	for _, seg := range path {
+		switch seg.Op {
+		case PathMoveTo:
+			// The rasterizer would join the open sub-path to this one.
+			z.ClosePath()
+			z.MoveTo(pt(seg.Points[0]))
+		case PathLineTo:
+			z.LineTo(pt(seg.Points[0]))
+		case PathQuadTo:
+			cx, cy := pt(seg.Points[0])
+			x, y := pt(seg.Points[1])
+			z.QuadTo(cx, cy, x, y)
+		case PathCubeTo:
+			c1x, c1y := pt(seg.Points[0])
+			c2x, c2y := pt(seg.Points[1])
+			x, y := pt(seg.Points[2])
+			z.CubeTo(c1x, c1y, c2x, c2y, x, y)
+		case PathClose:
+			z.ClosePath()
+		}
+	}
+	z.ClosePath()
+
+	mask := image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+
+	if !antialias {
+		for i, a := range mask.Pix {
+			if a >= 128 {
+				mask.Pix[i] = 255
+			} else {
+				mask.Pix[i] = 0
+			}
+		}
+	}
+	return mask
+}
+
+// CropToPath crops the image to the bounding box of path and makes every
+// pixel outside the path fully transparent, e.g. to cut a sticker out of a
+// photo along a user-drawn outline. With antialias enabled, edge pixels are
+// partially transparent for a smooth outline; otherwise the edge is hard.
+// Returns the ImageProcessor for chaining. An error is set if the path is
+// malformed or does not overlap the image.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) CropToPath(path []PathSegment, antialias bool) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if err := validatePath(path); err != nil {
+		ip.err = fmt.Errorf("invalid crop path: %w", err)
+		return ip
+	}
+
+	bounds := ip.currentImage.Bounds()
+	cropRect := pathBounds(path).Add(bounds.Min).Intersect(bounds)
+	if cropRect.Empty() {
+		ip.err = fmt.Errorf("crop path %v does not overlap image bounds %v", pathBounds(path), bounds)
+		return ip
+	}
+
+	// Path coordinates are relative to the image's top-left corner.
+	rel := cropRect.Sub(bounds.Min)
+	mask := rasterizePath(path, rel, antialias)
+	src := asRGBA(ip.currentImage)
+
+	dst := newRGBA(image.Rect(0, 0, rel.Dx(), rel.Dy()))
+	for y := 0; y < rel.Dy(); y++ {
+		for x := 0; x < rel.Dx(); x++ {
+			m := uint32(mask.Pix[y*mask.Stride+x])
+			if m == 0 {
+				continue
+			}
+			si := (rel.Min.Y+y)*src.Stride + (rel.Min.X+x)*4
+			di := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[di+c] = uint8((uint32(src.Pix[si+c])*m + 127) / 255)
+			}
+		}
+	}
+
+	ip.currentImage = dst
+	ip.record("CropToPath")
+	return ip
+}
@@ -0,0 +1,95 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	valid := []PathSegment{MoveTo(0, 0), LineTo(10, 0), QuadTo(15, 5, 10, 10), CubeTo(5, 15, 0, 15, 0, 10), ClosePath()}
+	if err := validatePath(valid); err != nil {
+		t.Errorf("validatePath() on a valid path returned %v", err)
+	}
+
+	invalid := map[string][]PathSegment{
+		"empty":            nil,
+		"no initial move":  {LineTo(1, 1)},
+		"missing points":   {MoveTo(0, 0), {Op: PathQuadTo, Points: []image.Point{{1, 1}}}},
+		"unknown op":       {MoveTo(0, 0), {Op: PathOp(42)}},
+		"points for close": {MoveTo(0, 0), {Op: PathClose, Points: []image.Point{{1, 1}}}},
+	}
+	for name, path := range invalid {
+		if err := validatePath(path); err == nil {
+			t.Errorf("validatePath() should reject %s path", name)
+		}
+	}
+}
+
+func TestCropToPath(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for i := 0; i < len(originalImg.Pix); i += 4 {
+		copy(originalImg.Pix[i:], []uint8{200, 100, 50, 255})
+	}
+
+	// Triangle with its right angle in the top-left corner of the 20..80 box.
+	triangle := []PathSegment{MoveTo(20, 20), LineTo(80, 20), LineTo(20, 80), ClosePath()}
+
+	for _, antialias := range []bool{true, false} {
+		proc := New(originalImg).CropToPath(triangle, antialias)
+		if proc.Err() != nil {
+			t.Fatalf("CropToPath(antialias=%v) should not error, got: %v", antialias, proc.Err())
+		}
+		img := proc.currentImage
+		if img.Bounds().Dx() != 61 || img.Bounds().Dy() != 61 {
+			t.Errorf("CropToPath() should crop to the path bounds, got %v", img.Bounds())
+		}
+		if got := color.RGBAModel.Convert(img.At(5, 5)); got != (color.RGBA{200, 100, 50, 255}) {
+			t.Errorf("CropToPath() inside pixel = %v, want original color", got)
+		}
+		if _, _, _, a := img.At(55, 55).RGBA(); a != 0 {
+			t.Errorf("CropToPath() outside pixel should be transparent, got alpha %d", a>>8)
+		}
+		if !antialias {
+			for i := 3; i < len(img.(*image.RGBA).Pix); i += 4 {
+				if a := img.(*image.RGBA).Pix[i]; a != 0 && a != 255 {
+					t.Fatalf("CropToPath() without antialiasing produced partial alpha %d", a)
+				}
+			}
+		}
+	}
+
+	// Sub-paths left open are closed each on their own, not joined into one
+	// outline.
+	squares := []PathSegment{
+		MoveTo(10, 10), LineTo(30, 10), LineTo(30, 30), LineTo(10, 30),
+		MoveTo(60, 60), LineTo(80, 60), LineTo(80, 80), LineTo(60, 80),
+	}
+	img := mustImage(t, New(originalImg).CropToPath(squares, false))
+	for _, p := range []image.Point{{10, 10}, {60, 60}} {
+		if _, _, _, a := img.At(p.X, p.Y).RGBA(); a != 0xffff {
+			t.Errorf("CropToPath() of two open squares: pixel %v inside a square has alpha %d, want opaque", p, a>>8)
+		}
+	}
+	for _, p := range []image.Point{{35, 10}, {10, 60}, {35, 35}, {60, 10}} {
+		if _, _, _, a := img.At(p.X, p.Y).RGBA(); a != 0 {
+			t.Errorf("CropToPath() of two open squares: pixel %v between them has alpha %d, want transparent", p, a>>8)
+		}
+	}
+
+	// Test case: Path outside of the image
+	proc := New(originalImg).CropToPath([]PathSegment{MoveTo(200, 200), LineTo(300, 200), LineTo(200, 300)}, true)
+	if proc.Err() == nil {
+		t.Error("CropToPath() with a path outside the image should return an error")
+	}
+
+	// Test case: Malformed path
+	if New(originalImg).CropToPath([]PathSegment{LineTo(1, 1)}, true).Err() == nil {
+		t.Error("CropToPath() with a malformed path should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).CropToPath(triangle, true).Err() == nil {
+		t.Fatal("CropToPath() on a processor with prior error should propagate that error")
+	}
+}
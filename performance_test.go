@@ -221,6 +221,30 @@ func BenchmarkConcurrentProcessing(b *testing.B) {
 	})
 }
 
+// Compare rendering a watermark per image with applying a prepared stamp
+func BenchmarkWatermarkStamp(b *testing.B) {
+	img := createLargeTestImage(800, 600)
+
+	b.Run("add_text_watermark", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			New(img).AddTextWatermark("© gopiq", WithFontSize(32))
+		}
+	})
+
+	b.Run("apply_stamp", func(b *testing.B) {
+		stamp, err := PrepareWatermark(WithText("© gopiq"), WithFontSize(32))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			New(img).ApplyStamp(stamp)
+		}
+	})
+}
+
 // Performance test that prints detailed timing information
 func TestPerformanceComparison(t *testing.T) {
 	if testing.Short() {
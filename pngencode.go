@@ -0,0 +1,273 @@
+package gopiq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// pngIHDREnd is the offset of the chunk after IHDR, which is always first.
+const pngIHDREnd = 8 + 4 + 4 + 13 + 4 // Signature, IHDR length, type, data, CRC
+
+// PNGFilter is the filter PNG output applies to each row before compression.
+// Filters predict a byte from its neighbors and store the difference, which
+// compresses better for photos and gradients than for flat graphics.
+type PNGFilter int
+
+const (
+	PNGFilterDefault  PNGFilter = iota // As image/png: none at png.NoCompression and png.BestSpeed, adaptive otherwise.
+	PNGFilterNone                      // Rows as they are: the fastest, and often the smallest for flat graphics.
+	PNGFilterSub                       // Difference from the pixel to the left.
+	PNGFilterUp                        // Difference from the pixel above.
+	PNGFilterAverage                   // Difference from the mean of the pixels to the left and above.
+	PNGFilterPaeth                     // Difference from the left, upper or upper-left pixel, whichever is closest.
+	PNGFilterAdaptive                  // Per row, the filter whose output has the smallest sum of absolute values.
+)
+
+// String returns the name of the PNGFilter.
+func (f PNGFilter) String() string {
+	switch f {
+	case PNGFilterDefault:
+		return "default"
+	case PNGFilterNone:
+		return "none"
+	case PNGFilterSub:
+		return "sub"
+	case PNGFilterUp:
+		return "up"
+	case PNGFilterAverage:
+		return "average"
+	case PNGFilterPaeth:
+		return "paeth"
+	case PNGFilterAdaptive:
+		return "adaptive"
+	default:
+		return "unknown"
+	}
+}
+
+// WithPNGFilter sets the row filter of PNG output. PNGFilterNone with
+// png.BestSpeed is the cheapest to encode, e.g. for bulk thumbnails;
+// PNGFilterAdaptive with png.BestCompression usually gives the smallest
+// files. Encoding fails for unknown filters.
+func WithPNGFilter(f PNGFilter) EncodeOption {
+	return func(eo *EncodeOptions) { eo.PNGFilter = f }
+}
+
+// WithPNGColors writes PNG output as an indexed PNG-8 of at most n colors,
+// from 2 to 256, chosen by the same quantizer as GIF output. Icons, sprites
+// and flat graphics usually shrink by well over half. As in GIF, pixels are
+// either opaque or transparent, with one color taken for transparency if
+// there are transparent pixels. Paletted images that already have at most n
+// colors are written as they are.
+func WithPNGColors(n int) EncodeOption {
+	return func(eo *EncodeOptions) { eo.PNGColors = n }
+}
+
+// pngPaletted returns img mapped to a palette of at most n colors.
+func pngPaletted(img image.Image, n int) *image.Paletted {
+	if p, ok := img.(*image.Paletted); ok && len(p.Palette) <= n {
+		return p
+	}
+	rgba := asRGBA(img)
+	return paletted(rgba, quantize([]*image.RGBA{rgba}, n), false)
+}
+
+// encodeFilteredPNG writes img as a PNG with every row filtered by filter,
+// which image/png does not allow choosing. Gray, paletted and 16-bit images
+// keep their color type and depth; others are written as 8-bit RGB, or RGBA
+// unless opaque.
+func encodeFilteredPNG(w io.Writer, img image.Image, level png.CompressionLevel, filter PNGFilter) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 {
+		return fmt.Errorf("invalid PNG image size %dx%d", width, height)
+	}
+	opaque := false
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+
+	// row copies row y of the image, as PNG stores it, to dst.
+	var row func(dst []byte, y int)
+	var depth, colorType, bpp byte
+	var plte, trns []byte
+	switch src := img.(type) {
+	case *image.Gray:
+		depth, colorType, bpp = 8, 0, 1
+		row = func(dst []byte, y int) { copy(dst, src.Pix[src.PixOffset(b.Min.X, y):]) }
+	case *image.Gray16:
+		depth, colorType, bpp = 16, 0, 2
+		row = func(dst []byte, y int) { copy(dst, src.Pix[src.PixOffset(b.Min.X, y):]) }
+	case *image.Paletted:
+		if len(src.Palette) == 0 || len(src.Palette) > 256 {
+			return fmt.Errorf("PNG palettes must have 1 to 256 colors (got: %d)", len(src.Palette))
+		}
+		depth, colorType, bpp = 8, 3, 1
+		for _, c := range src.Palette {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			plte = append(plte, n.R, n.G, n.B)
+			trns = append(trns, n.A)
+		}
+		// Only entries up to the last translucent one need an alpha.
+		for len(trns) > 0 && trns[len(trns)-1] == 255 {
+			trns = trns[:len(trns)-1]
+		}
+		row = func(dst []byte, y int) { copy(dst, src.Pix[src.PixOffset(b.Min.X, y):]) }
+	case *image.RGBA64, *image.NRGBA64:
+		depth, colorType, bpp = 16, 6, 8
+		if opaque {
+			colorType, bpp = 2, 6
+		}
+		line := image.NewNRGBA64(image.Rect(0, 0, width, 1))
+		row = func(dst []byte, y int) {
+			draw.Draw(line, line.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+			for x := range width {
+				copy(dst[x*int(bpp):], line.Pix[8*x:8*x+int(bpp)])
+			}
+		}
+	default:
+		depth, colorType, bpp = 8, 6, 4
+		if opaque {
+			colorType, bpp = 2, 3
+		}
+		line := image.NewNRGBA(image.Rect(0, 0, width, 1))
+		row = func(dst []byte, y int) {
+			draw.Draw(line, line.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+			for x := range width {
+				copy(dst[x*int(bpp):], line.Pix[4*x:4*x+int(bpp)])
+			}
+		}
+	}
+
+	var idat bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&idat, pngZlibLevel(level))
+	if err != nil {
+		return err
+	}
+	stride := width * int(bpp)
+	prev, cur := make([]byte, stride), make([]byte, stride)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, 1+stride)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row(cur, y)
+		out := pngFilterRow(&filtered, filter, cur, prev, int(bpp))
+		if _, err := zw.Write(out); err != nil {
+			return err
+		}
+		prev, cur = cur, prev
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	out := []byte("\x89PNG\r\n\x1a\n")
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	out = appendPNGChunk(out, "IHDR", append(ihdr, depth, colorType, 0, 0, 0))
+	if plte != nil {
+		out = appendPNGChunk(out, "PLTE", plte)
+		if len(trns) > 0 {
+			out = appendPNGChunk(out, "tRNS", trns)
+		}
+	}
+	out = appendPNGChunk(out, "IDAT", idat.Bytes())
+	out = appendPNGChunk(out, "IEND", nil)
+	_, err = w.Write(out)
+	return err
+}
+
+// pngZlibLevel returns the zlib level of a png.CompressionLevel.
+func pngZlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+// pngFilterRow filters cur, whose previous row is prev, into one of the
+// buffers and returns it with its leading filter type byte. Adaptive
+// filtering tries every filter.
+func pngFilterRow(filtered *[5][]byte, filter PNGFilter, cur, prev []byte, bpp int) []byte {
+	if filter != PNGFilterAdaptive {
+		t := int(filter - PNGFilterNone)
+		pngFilter(filtered[t], t, cur, prev, bpp)
+		return filtered[t]
+	}
+	best, bestSum := 0, -1
+	for t := range filtered {
+		pngFilter(filtered[t], t, cur, prev, bpp)
+		sum := 0
+		for _, v := range filtered[t][1:] {
+			sum += absInt(int(int8(v)))
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = t, sum
+		}
+	}
+	return filtered[best]
+}
+
+// pngFilter writes filter type t and cur filtered with it to dst.
+func pngFilter(dst []byte, t int, cur, prev []byte, bpp int) {
+	dst[0] = byte(t)
+	d := dst[1:]
+	for i, x := range cur {
+		var a, c byte // Left and upper-left
+		if i >= bpp {
+			a, c = cur[i-bpp], prev[i-bpp]
+		}
+		up := prev[i]
+		switch t {
+		case 0:
+			d[i] = x
+		case 1:
+			d[i] = x - a
+		case 2:
+			d[i] = x - up
+		case 3:
+			d[i] = x - byte((int(a)+int(up))/2)
+		case 4:
+			d[i] = x - pngPaeth(a, up, c)
+		}
+	}
+}
+
+// pngPaeth returns whichever of a (left), b (up) and c (upper left) is
+// closest to a+b-c.
+func pngPaeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+// appendPNGChunk appends a chunk with its length and CRC.
+func appendPNGChunk(b []byte, typ string, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	start := len(b)
+	b = append(b, typ...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+}
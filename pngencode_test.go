@@ -0,0 +1,175 @@
+package gopiq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"testing"
+)
+
+// pngRowFilters returns the filter type byte of each row of a PNG with a
+// single IDAT chunk, whose rows are stride bytes long.
+func pngRowFilters(t *testing.T, data []byte, stride int) []byte {
+	t.Helper()
+	i := bytes.Index(data, []byte("IDAT"))
+	if i < 4 {
+		t.Fatal("PNG has no IDAT chunk")
+	}
+	n := binary.BigEndian.Uint32(data[i-4:])
+	zr, err := zlib.NewReader(bytes.NewReader(data[i+4 : i+4+int(n)]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filters []byte
+	for off := 0; off < len(raw); off += 1 + stride {
+		filters = append(filters, raw[off])
+	}
+	return filters
+}
+
+// sameNRGBA64 reports whether two images have the same pixels at 16 bits
+// per channel.
+func sameNRGBA64(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := range ab.Dy() {
+		for x := range ab.Dx() {
+			ca := color.NRGBA64Model.Convert(a.At(ab.Min.X+x, ab.Min.Y+y))
+			cb := color.NRGBA64Model.Convert(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if ca != cb {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestPNGFilter(t *testing.T) {
+	src := gradientImage(40, 24)
+	translucent := image.NewNRGBA(image.Rect(0, 0, 9, 5))
+	wide := image.NewNRGBA64(image.Rect(0, 0, 9, 5))
+	gray16 := image.NewGray16(image.Rect(0, 0, 9, 5))
+	paletted := image.NewPaletted(image.Rect(0, 0, 9, 5), color.Palette{color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 128}, color.NRGBA{0, 255, 0, 255}})
+	for i := range 45 {
+		translucent.SetNRGBA(i%9, i/9, color.NRGBA{uint8(i * 5), uint8(i * 3), 9, uint8(i * 5)})
+		wide.SetNRGBA64(i%9, i/9, color.NRGBA64{uint16(i * 1111), 300, uint16(i * 7), uint16(65535 - i*99)})
+		gray16.SetGray16(i%9, i/9, color.Gray16{uint16(i * 1234)})
+		paletted.SetColorIndex(i%9, i/9, uint8(i%3))
+	}
+	gray, _ := New(src).ToGray()
+	images := map[string]image.Image{"opaque": src, "translucent": translucent, "16-bit": wide, "gray": gray, "gray16": gray16, "paletted": paletted}
+
+	for f := PNGFilterNone; f <= PNGFilterAdaptive; f++ {
+		for name, img := range images {
+			data, err := New(img).ToBytes(FormatPNG, WithPNGFilter(f))
+			if err != nil {
+				t.Fatalf("ToBytes(FormatPNG) of %s with filter %s should not error, got: %v", name, f, err)
+			}
+			decoded, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("PNG of %s with filter %s does not decode: %v", name, f, err)
+			}
+			if !sameNRGBA64(img, decoded) {
+				t.Errorf("PNG of %s with filter %s does not round-trip", name, f)
+			}
+		}
+	}
+
+	// A fixed filter applies to every row; adaptive picks per row.
+	paeth := mustBytes(t, New(src), FormatPNG, WithPNGFilter(PNGFilterPaeth))
+	if filters := pngRowFilters(t, paeth, 40*3); !bytes.Equal(filters, bytes.Repeat([]byte{4}, 24)) {
+		t.Errorf("Paeth-filtered PNG has row filters %v, want 4 for all 24 rows", filters)
+	}
+	none := mustBytes(t, New(src), FormatPNG, WithPNGFilter(PNGFilterNone), WithPNGCompression(png.BestSpeed))
+	adaptive := mustBytes(t, New(src), FormatPNG, WithPNGFilter(PNGFilterAdaptive), WithPNGCompression(png.BestCompression))
+	if len(adaptive) >= len(none) {
+		t.Errorf("adaptive PNG of a gradient is %d bytes, want less than the %d of no filter", len(adaptive), len(none))
+	}
+
+	if PNGFilterPaeth.String() != "paeth" || PNGFilter(42).String() != "unknown" {
+		t.Error("PNGFilter.String() should return the name of the filter")
+	}
+
+	// Test case: Invalid input
+	if _, err := New(src).ToBytes(FormatPNG, WithPNGFilter(PNGFilter(42))); err == nil {
+		t.Error("ToBytes(FormatPNG) with an unknown filter should return an error")
+	}
+}
+
+func TestPNGPaeth(t *testing.T) {
+	cases := []struct{ a, b, c, want byte }{
+		{10, 20, 10, 20}, // p = 20: b is exact
+		{20, 10, 10, 20}, // p = 20: a is exact
+		{10, 10, 20, 10}, // p = 0: a and b tie, a wins
+		{30, 40, 50, 30}, // p = 20: a is closest
+		{200, 10, 100, 100},
+	}
+	for _, tc := range cases {
+		if got := pngPaeth(tc.a, tc.b, tc.c); got != tc.want {
+			t.Errorf("pngPaeth(%d, %d, %d) = %d, want %d", tc.a, tc.b, tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestPNGColors(t *testing.T) {
+	// Pixel art of 16 colors, dithered by hand, on a transparent
+	// background.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	seed := uint32(1)
+	for y := range 64 {
+		for x := range 64 {
+			seed = seed*1664525 + 1013904223
+			if (x-32)*(x-32)+(y-32)*(y-32) <= 30*30 {
+				i := seed >> 28
+				src.SetRGBA(x, y, color.RGBA{uint8(i * 16), uint8(255 - i*12), uint8(i * i), 255})
+			}
+		}
+	}
+
+	truecolor := mustBytes(t, New(src), FormatPNG)
+	data, err := New(src).ToBytes(FormatPNG, WithPNGColors(32))
+	if err != nil {
+		t.Fatalf("ToBytes(FormatPNG) with WithPNGColors(32) should not error, got: %v", err)
+	}
+	if len(data) > len(truecolor)/2 {
+		t.Errorf("PNG-8 is %d bytes, want at most half of the %d of truecolor", len(data), len(truecolor))
+	}
+	img := mustImage(t, FromBytes(data))
+	p, ok := img.(*image.Paletted)
+	if !ok || len(p.Palette) > 32 {
+		t.Fatalf("PNG-8 decoded to %T, want *image.Paletted of at most 32 colors", img)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Error("PNG-8 should keep the transparent background")
+	}
+	if d := meanDiff(t, src, img); d > 0 {
+		t.Errorf("PNG-8 of 16 colors differs from the source by %.2f on average, want 0", d)
+	}
+
+	// Filters apply to the indices, and small palettes are kept as they are.
+	filtered := mustBytes(t, New(src), FormatPNG, WithPNGColors(32), WithPNGFilter(PNGFilterAdaptive))
+	if !sameNRGBA64(img, mustImage(t, FromBytes(filtered))) {
+		t.Error("filtered PNG-8 should decode to the same pixels")
+	}
+	if got := mustImage(t, FromBytes(mustBytes(t, New(p), FormatPNG, WithPNGColors(256)))).(*image.Paletted); !slices.Equal(got.Palette, p.Palette) {
+		t.Error("WithPNGColors() should keep the palette of a paletted image with few enough colors")
+	}
+
+	// Test case: Invalid input
+	for _, n := range []int{-1, 1, 257} {
+		if _, err := New(src).ToBytes(FormatPNG, WithPNGColors(n)); err == nil {
+			t.Errorf("ToBytes(FormatPNG) with WithPNGColors(%d) should return an error", n)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package gopiq
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"maps"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PipelineStep is a single operation of a Pipeline: the operation name and
+// its parameters by name. Colors are given as "#rrggbb" or "#rrggbbaa" hex
+// strings.
+type PipelineStep struct {
+	Op     string         `json:"op"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// Pipeline is a serializable sequence of operations. Its JSON form is an array
+// of steps, for example:
+//
+//	[{"op": "grayscale"}, {"op": "sharpen", "params": {"amount": 0.5}}]
+//
+// Supported operations and their parameters:
+//
+//	resize          width, height
+//	crop            x, y, width, height
+//	grayscale
+//	sharpen         amount
+//	medianFilter    radius
+//	bilateralFilter sigmaSpace, sigmaColor
+//	motionBlur      angle, distance
+//	radialBlur      centerX, centerY, strength
+//	emboss          strength, angle
+//	pixelate        blockSize
+//	solarize        threshold
+//	duotone         shadow, highlight
+//	colorize        color, strength
+//	splitTone       shadow, highlight, balance
+//	enhanceLowLight strength
+//	filmGrain       intensity
+//	padAuto         width, height
+//	extendBlurred   width, height, blurSigma
+//	tone            brightness, contrast, saturation (each in [-1, 1], default 0)
+//
+// Numeric parameters that are omitted default to zero. Parameters an
+// operation does not take, and values of the wrong type such as 10.5 for an
+// integer, are rejected.
+type Pipeline []PipelineStep
+
+// ParsePipeline decodes a Pipeline from its JSON form and checks that every
+// operation and parameter is known and every value has the right type.
+func ParsePipeline(data []byte) (Pipeline, error) {
+	var p Pipeline
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode pipeline: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// validate returns an error if the pipeline is empty, uses an unknown
+// operation or has a parameter that the operation does not take or that has
+// the wrong type.
+func (p Pipeline) validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("pipeline has no steps")
+	}
+	for i, step := range p {
+		op, ok := pipelineOps[step.Op]
+		if !ok {
+			return fmt.Errorf("pipeline step %d: unknown operation %q", i, step.Op)
+		}
+		for name, v := range step.Params {
+			kind, ok := op.params[name]
+			if !ok {
+				return fmt.Errorf("pipeline step %d (%s): unknown parameter %q", i, step.Op, name)
+			}
+			if err := kind.check(v); err != nil {
+				return fmt.Errorf("pipeline step %d (%s): parameter %q %w", i, step.Op, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of p that shares no parameter maps with it. Valid
+// parameter values are numbers and strings, so copying the maps suffices.
+func (p Pipeline) clone() Pipeline {
+	out := make(Pipeline, len(p))
+	for i, step := range p {
+		out[i] = PipelineStep{Op: step.Op, Params: maps.Clone(step.Params)}
+	}
+	return out
+}
+
+// paramKind is the type of a pipeline step parameter.
+type paramKind int
+
+const (
+	paramFloat paramKind = iota // A number
+	paramInt                    // A number without a fractional part
+	paramColor                  // A "#rrggbb" or "#rrggbbaa" string
+)
+
+// check returns an error if v is not a valid value of kind k.
+func (k paramKind) check(v any) error {
+	switch k {
+	case paramColor:
+		if s, ok := v.(string); ok {
+			if _, err := parseHexColor(s); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf(`must be a "#rrggbb" or "#rrggbbaa" color (got: %v)`, v)
+	case paramInt:
+		if f, ok := paramNumber(v); ok && f == math.Trunc(f) && math.Abs(f) <= math.MaxInt32 {
+			return nil
+		}
+		return fmt.Errorf("must be an integer (got: %v)", v)
+	default:
+		if _, ok := paramNumber(v); ok {
+			return nil
+		}
+		return fmt.Errorf("must be a number (got: %v)", v)
+	}
+}
+
+// paramNumber returns v as a float64 if it is a number, as decoded from JSON
+// or given as an int by Go callers.
+func paramNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// pipelineOp is an operation of a Pipeline: the types of its parameters by
+// name, and how it is applied once they are validated.
+type pipelineOp struct {
+	params map[string]paramKind
+	apply  func(ip *ImageProcessor, p stepParams) *ImageProcessor
+}
+
+// pipelineOps maps operation names to the processor methods they invoke.
+var pipelineOps = map[string]pipelineOp{
+	"resize": {
+		params: map[string]paramKind{"width": paramInt, "height": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Resize(p.int("width"), p.int("height"))
+		},
+	},
+	"crop": {
+		params: map[string]paramKind{"x": paramInt, "y": paramInt, "width": paramInt, "height": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Crop(p.int("x"), p.int("y"), p.int("width"), p.int("height"))
+		},
+	},
+	"grayscale": {
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Grayscale()
+		},
+	},
+	"sharpen": {
+		params: map[string]paramKind{"amount": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Sharpen(p.float("amount"))
+		},
+	},
+	"medianFilter": {
+		params: map[string]paramKind{"radius": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.MedianFilter(p.int("radius"))
+		},
+	},
+	"bilateralFilter": {
+		params: map[string]paramKind{"sigmaSpace": paramFloat, "sigmaColor": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.BilateralFilter(p.float("sigmaSpace"), p.float("sigmaColor"))
+		},
+	},
+	"motionBlur": {
+		params: map[string]paramKind{"angle": paramFloat, "distance": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.MotionBlur(p.float("angle"), p.int("distance"))
+		},
+	},
+	"radialBlur": {
+		params: map[string]paramKind{"centerX": paramFloat, "centerY": paramFloat, "strength": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.RadialBlur(p.float("centerX"), p.float("centerY"), p.float("strength"))
+		},
+	},
+	"emboss": {
+		params: map[string]paramKind{"strength": paramFloat, "angle": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Emboss(p.float("strength"), p.float("angle"))
+		},
+	},
+	"pixelate": {
+		params: map[string]paramKind{"blockSize": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Pixelate(p.int("blockSize"))
+		},
+	},
+	"solarize": {
+		params: map[string]paramKind{"threshold": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Solarize(clampUint8(p.float("threshold")))
+		},
+	},
+	"duotone": {
+		params: map[string]paramKind{"shadow": paramColor, "highlight": paramColor},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Duotone(p.color("shadow"), p.color("highlight"))
+		},
+	},
+	"colorize": {
+		params: map[string]paramKind{"color": paramColor, "strength": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.Colorize(p.color("color"), p.float("strength"))
+		},
+	},
+	"splitTone": {
+		params: map[string]paramKind{"shadow": paramColor, "highlight": paramColor, "balance": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.SplitTone(p.color("shadow"), p.color("highlight"), p.float("balance"))
+		},
+	},
+	"enhanceLowLight": {
+		params: map[string]paramKind{"strength": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.EnhanceLowLight(p.float("strength"))
+		},
+	},
+	"filmGrain": {
+		params: map[string]paramKind{"intensity": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.FilmGrain(p.float("intensity"))
+		},
+	},
+	"padAuto": {
+		params: map[string]paramKind{"width": paramInt, "height": paramInt},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.PadAuto(p.int("width"), p.int("height"))
+		},
+	},
+	"extendBlurred": {
+		params: map[string]paramKind{"width": paramInt, "height": paramInt, "blurSigma": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.ExtendBlurred(p.int("width"), p.int("height"), p.float("blurSigma"))
+		},
+	},
+	"tone": {
+		params: map[string]paramKind{"brightness": paramFloat, "contrast": paramFloat, "saturation": paramFloat},
+		apply: func(ip *ImageProcessor, p stepParams) *ImageProcessor {
+			return ip.adjustTone(p.float("brightness"), p.float("contrast"), p.float("saturation"))
+		},
+	},
+}
+
+// stepParams are the parameters of one step, already checked against the
+// types its operation takes.
+type stepParams map[string]any
+
+// float returns the named number, or 0 if it is missing.
+func (p stepParams) float(name string) float64 {
+	f, _ := paramNumber(p[name])
+	return f
+}
+
+// int returns the named integer, or 0 if it is missing.
+func (p stepParams) int(name string) int {
+	return int(p.float(name))
+}
+
+// color returns the named hex color, or transparent black if it is missing.
+func (p stepParams) color(name string) color.Color {
+	s, ok := p[name].(string)
+	if !ok {
+		return color.RGBA{}
+	}
+	c, _ := parseHexColor(s)
+	return c
+}
+
+// parseHexColor parses "#rrggbb" or "#rrggbbaa".
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || (len(hex) != 6 && len(hex) != 8) {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// ApplyPipeline runs the steps of p in order. Each step is applied like the
+// corresponding chained method call, so other goroutines using the processor
+// may interleave between steps. All steps are checked before the first one
+// is applied.
+// Returns the ImageProcessor for chaining. An error is set if a step uses an
+// unknown operation or parameter, a parameter has the wrong type or a step
+// fails.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ApplyPipeline(p Pipeline) *ImageProcessor {
+	if err := ip.Err(); err != nil {
+		return ip
+	}
+	if err := p.validate(); err != nil {
+		ip.setErr(err)
+		return ip
+	}
+	for _, step := range p {
+		if pipelineOps[step.Op].apply(ip, step.Params).Err() != nil {
+			return ip
+		}
+	}
+	return ip
+}
+
+// setErr records err unless an error is already set.
+func (ip *ImageProcessor) setErr(err error) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	if ip.err == nil {
+		ip.err = err
+	}
+}
+
+// adjustTone shifts brightness, scales contrast around mid-gray and scales
+// saturation around luma. Each amount is in [-1, 1]; 0 leaves the image
+// unchanged and -1 contrast or saturation flattens it completely.
+func (ip *ImageProcessor) adjustTone(brightness, contrast, saturation float64) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	for _, v := range []float64{brightness, contrast, saturation} {
+		if v < -1 || v > 1 {
+			ip.err = fmt.Errorf("tone adjustments must be in [-1, 1] (brightness: %g, contrast: %g, saturation: %g)",
+				brightness, contrast, saturation)
+			return ip
+		}
+	}
+
+	shift, k, s := brightness*128, 1+contrast, 1+saturation
+	dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+		l := luminance(r, g, b)
+		adjust := func(v uint8) uint8 {
+			sat := l + (float64(v)-l)*s
+			return clampUint8((sat-128)*k + 128 + shift)
+		}
+		return adjust(r), adjust(g), adjust(b)
+	})
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	ip.currentImage = dst
+	ip.record("Tone")
+	return ip
+}
+
+// builtinPresets defines the looks available to ApplyPreset out of the box.
+var builtinPresets = map[string]string{
+	"mono":   `[{"op": "grayscale"}, {"op": "tone", "params": {"contrast": 0.15}}]`,
+	"fade":   `[{"op": "tone", "params": {"brightness": 0.06, "contrast": -0.3, "saturation": -0.3}}, {"op": "splitTone", "params": {"shadow": "#3c5a78", "highlight": "#f0dcb4", "balance": 0}}]`,
+	"warm":   `[{"op": "colorize", "params": {"color": "#ff9a3c", "strength": 0.15}}, {"op": "tone", "params": {"saturation": 0.1}}]`,
+	"cool":   `[{"op": "colorize", "params": {"color": "#3c8cff", "strength": 0.15}}, {"op": "tone", "params": {"saturation": -0.05}}]`,
+	"punchy": `[{"op": "tone", "params": {"contrast": 0.25, "saturation": 0.35}}, {"op": "sharpen", "params": {"amount": 0.4}}]`,
+}
+
+var (
+	presetsMu sync.RWMutex
+	presets   = func() map[string]Pipeline {
+		m := make(map[string]Pipeline, len(builtinPresets))
+		for name, src := range builtinPresets {
+			p, err := ParsePipeline([]byte(src))
+			if err != nil {
+				panic(fmt.Sprintf("invalid built-in preset %q: %v", name, err))
+			}
+			m[name] = p
+		}
+		return m
+	}()
+)
+
+// RegisterPreset makes pipeline available to ApplyPreset under name,
+// replacing any existing preset (including built-in ones) with that name.
+// Pipelines can be loaded with ParsePipeline to share looks across services.
+// The pipeline is copied, so later changes to it or its parameter maps do
+// not affect the preset.
+// Returns an error if name is empty or the pipeline is empty, uses an
+// unknown operation or parameter or has a parameter of the wrong type.
+// This function is safe for concurrent use.
+func RegisterPreset(name string, pipeline Pipeline) error {
+	if name == "" {
+		return fmt.Errorf("preset name cannot be empty")
+	}
+	if err := pipeline.validate(); err != nil {
+		return err
+	}
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	presets[name] = pipeline.clone()
+	return nil
+}
+
+// LookupPreset returns the pipeline registered under name.
+func LookupPreset(name string) (Pipeline, bool) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	p, ok := presets[name]
+	if !ok {
+		return nil, false
+	}
+	return p.clone(), true
+}
+
+// PresetNames returns the names of all registered presets in alphabetical
+// order.
+func PresetNames() []string {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyPreset applies the look registered under name. Built-in looks are
+// "mono", "fade", "warm", "cool" and "punchy"; more can be added with
+// RegisterPreset.
+// Returns the ImageProcessor for chaining. An error is set if the preset name
+// is unknown or one of its steps fails.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ApplyPreset(name string) *ImageProcessor {
+	if ip.Err() != nil {
+		return ip
+	}
+	p, ok := LookupPreset(name)
+	if !ok {
+		ip.setErr(fmt.Errorf("unknown preset %q", name))
+		return ip
+	}
+	return ip.ApplyPipeline(p)
+}
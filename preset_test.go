@@ -0,0 +1,202 @@
+package gopiq
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestParsePipeline(t *testing.T) {
+	p, err := ParsePipeline([]byte(`[{"op": "grayscale"}, {"op": "sharpen", "params": {"amount": 0.5}}]`))
+	if err != nil {
+		t.Fatalf("ParsePipeline() should not error, got: %v", err)
+	}
+	if len(p) != 2 || p[1].Op != "sharpen" || p[1].Params["amount"] != 0.5 {
+		t.Errorf("ParsePipeline() = %+v", p)
+	}
+
+	// Round trip through JSON.
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal() should not error, got: %v", err)
+	}
+	if again, err := ParsePipeline(data); err != nil || len(again) != 2 {
+		t.Errorf("ParsePipeline(%s) = %+v, %v", data, again, err)
+	}
+
+	for _, bad := range []string{
+		`{}`, `[]`, `[{"op": "explode"}]`,
+		`[{"op": "sharpen", "params": {"ammount": 0.5}}]`,
+		`[{"op": "resize", "params": {"width": 10.5, "height": 4}}]`,
+		`[{"op": "crop", "params": {"x": "1", "y": 0, "width": 2, "height": 2}}]`,
+	} {
+		if _, err := ParsePipeline([]byte(bad)); err == nil {
+			t.Errorf("ParsePipeline(%s) should return an error", bad)
+		}
+	}
+}
+
+func TestApplyPipeline(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range originalImg.Pix {
+		originalImg.Pix[i] = 255
+	}
+	originalImg.Set(0, 0, color.RGBA{0, 0, 0, 255})
+
+	p := Pipeline{
+		{Op: "duotone", Params: map[string]any{"shadow": "#102030", "highlight": "#f0e0d0"}},
+		{Op: "resize", Params: map[string]any{"width": 2.0, "height": 2.0}},
+	}
+	proc := New(originalImg).ApplyPipeline(p)
+	if proc.Err() != nil {
+		t.Fatalf("ApplyPipeline() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Errorf("ApplyPipeline() bounds = %v, want 2x2", img.Bounds())
+	}
+	if got := color.RGBAModel.Convert(img.At(1, 1)); got != (color.RGBA{0xf0, 0xe0, 0xd0, 255}) {
+		t.Errorf("ApplyPipeline() highlight = %v, want #f0e0d0", got)
+	}
+
+	// Invalid steps
+	bad := []Pipeline{
+		{{Op: "sharpen", Params: map[string]any{"amount": "lots"}}},
+		{{Op: "pixelate", Params: map[string]any{"blockSize": 2.5}}},
+		{{Op: "colorize", Params: map[string]any{"color": "red", "strength": 0.5}}},
+		{{Op: "resize"}},
+		{{Op: "tone", Params: map[string]any{"contrast": 2.0}}},
+		{{Op: "explode"}},
+		{{Op: "sharpen", Params: map[string]any{"ammount": 0.5}}},
+		{{Op: "resize", Params: map[string]any{"width": 10.5, "height": 2}}},
+	}
+	for _, p := range bad {
+		if New(originalImg).ApplyPipeline(p).Err() == nil {
+			t.Errorf("ApplyPipeline(%+v) should return an error", p)
+		}
+	}
+
+	// No step is applied if a later one has an invalid parameter.
+	invalid := Pipeline{
+		{Op: "grayscale"},
+		{Op: "crop", Params: map[string]any{"x": "1", "y": 0, "width": 2, "height": 2}},
+	}
+	proc = New(originalImg).ApplyPipeline(invalid)
+	if proc.Err() == nil {
+		t.Error("ApplyPipeline() with a string for an integer should return an error")
+	}
+	if ops := proc.Operations(); len(ops) != 0 {
+		t.Errorf("ApplyPipeline() with an invalid step applied %v, want nothing", ops)
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ApplyPipeline(p).Err() == nil {
+		t.Fatal("ApplyPipeline() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestAdjustTone(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	originalImg.Set(0, 0, color.RGBA{200, 100, 50, 255})
+	originalImg.Set(1, 0, color.RGBA{64, 64, 64, 255})
+
+	// Zero adjustments leave the image unchanged.
+	img, _ := New(originalImg).adjustTone(0, 0, 0).Image()
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != (color.RGBA{200, 100, 50, 255}) {
+		t.Errorf("adjustTone(0, 0, 0) = %v, want unchanged", got)
+	}
+
+	// Full desaturation yields gray; full contrast reduction yields mid-gray.
+	img, _ = New(originalImg).adjustTone(0, 0, -1).Image()
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != g || g != b {
+		t.Errorf("adjustTone(0, 0, -1) = (%d,%d,%d), want gray", r>>8, g>>8, b>>8)
+	}
+	img, _ = New(originalImg).adjustTone(0, -1, 0).Image()
+	if got := color.RGBAModel.Convert(img.At(1, 0)); got != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("adjustTone(0, -1, 0) = %v, want mid-gray", got)
+	}
+
+	// Positive contrast pushes dark values further down.
+	img, _ = New(originalImg).adjustTone(0, 0.5, 0).Image()
+	if r, _, _, _ := img.At(1, 0).RGBA(); r>>8 >= 64 {
+		t.Errorf("adjustTone(0, 0.5, 0) of 64 = %d, want darker", r>>8)
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	originalImg := createTestImage(40, 40)
+	for _, name := range []string{"mono", "fade", "warm", "cool", "punchy"} {
+		proc := New(originalImg).ApplyPreset(name)
+		if proc.Err() != nil {
+			t.Errorf("ApplyPreset(%q) should not error, got: %v", name, proc.Err())
+		}
+	}
+
+	// Mono output is gray.
+	img, _ := New(originalImg).ApplyPreset("mono").Image()
+	if r, g, b, _ := img.At(5, 5).RGBA(); r != g || g != b {
+		t.Errorf("ApplyPreset(mono) = (%d,%d,%d), want gray", r>>8, g>>8, b>>8)
+	}
+
+	// Warm shifts light gray towards orange, cool towards blue.
+	light := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	draw.Draw(light, light.Rect, image.NewUniform(color.RGBA{200, 200, 200, 255}), image.Point{}, draw.Src)
+	img, _ = New(light).ApplyPreset("warm").Image()
+	if r, _, b, _ := img.At(0, 0).RGBA(); r <= b {
+		t.Errorf("ApplyPreset(warm) = r %d, b %d, want r > b", r>>8, b>>8)
+	}
+	img, _ = New(light).ApplyPreset("cool").Image()
+	if r, _, b, _ := img.At(0, 0).RGBA(); b <= r {
+		t.Errorf("ApplyPreset(cool) = r %d, b %d, want b > r", r>>8, b>>8)
+	}
+
+	if New(originalImg).ApplyPreset("nope").Err() == nil {
+		t.Error("ApplyPreset() with an unknown name should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ApplyPreset("mono").Err() == nil {
+		t.Fatal("ApplyPreset() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestRegisterPreset(t *testing.T) {
+	p, err := ParsePipeline([]byte(`[{"op": "pixelate", "params": {"blockSize": 4}}]`))
+	if err != nil {
+		t.Fatalf("ParsePipeline() should not error, got: %v", err)
+	}
+	if err := RegisterPreset("test_blocky", p); err != nil {
+		t.Fatalf("RegisterPreset() should not error, got: %v", err)
+	}
+	if _, ok := LookupPreset("test_blocky"); !ok {
+		t.Error("LookupPreset() should find a registered preset")
+	}
+
+	img, _ := New(createTestImage(8, 8)).ApplyPreset("test_blocky").Image()
+	if img.At(0, 0) != img.At(3, 3) {
+		t.Error("ApplyPreset() should apply the registered pipeline")
+	}
+
+	// The registered preset is a copy.
+	p[0].Params["blockSize"] = 0.5
+	if got, _ := LookupPreset("test_blocky"); got[0].Params["blockSize"] != 4.0 {
+		t.Errorf("changing the parameters after RegisterPreset() changed the preset to %v", got[0].Params)
+	}
+	got, _ := LookupPreset("test_blocky")
+	got[0].Params["blockSize"] = 0.5
+	if again, _ := LookupPreset("test_blocky"); again[0].Params["blockSize"] != 4.0 {
+		t.Errorf("changing the parameters returned by LookupPreset() changed the preset to %v", again[0].Params)
+	}
+
+	if err := RegisterPreset("", p); err == nil {
+		t.Error("RegisterPreset() with an empty name should return an error")
+	}
+	if err := RegisterPreset("test_bad", Pipeline{{Op: "explode"}}); err == nil {
+		t.Error("RegisterPreset() with an unknown operation should return an error")
+	}
+	if _, ok := LookupPreset("test_bad"); ok {
+		t.Error("RegisterPreset() should not register an invalid pipeline")
+	}
+}
@@ -0,0 +1,282 @@
+package gopiq
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"slices"
+	"time"
+)
+
+// record appends op to the processor's operation history and timings. The
+// caller must hold the write lock and have stored the result.
+func (ip *ImageProcessor) record(op string) {
+	ip.history = append(ip.history, op)
+	size := ip.currentImage.Bounds().Size()
+	ip.timings = append(ip.timings, OpTiming{
+		Op:          op,
+		Duration:    time.Since(ip.mu.start),
+		Input:       ip.size,
+		Output:      size,
+		Parallelism: int(ip.mu.parallelism.Load()),
+	})
+	ip.size = size
+}
+
+// Operations returns the names of the operations applied to the image so far,
+// in order, e.g. ["Resize", "Sharpen"]. Operations that failed or left the
+// image unchanged are not listed.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Operations() []string {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+	return slices.Clone(ip.history)
+}
+
+// WithProvenance embeds a C2PA (Content Credentials) manifest in the output
+// whose actions assertion lists the operations applied to the image (see
+// Operations), with claimGenerator (e.g. "myservice/1.4") as the claim
+// generator. The manifest is stored in an APP11 segment for JPEG and a caBX
+// chunk for PNG.
+//
+// The manifest is not signed: gopiq has no access to a signing certificate,
+// so C2PA validators will report the credentials as untrusted. Sign the
+// output with a C2PA tool if verifiable provenance is required.
+func WithProvenance(claimGenerator string) EncodeOption {
+	return func(eo *EncodeOptions) { eo.Provenance = claimGenerator }
+}
+
+// c2paActions maps operation names to C2PA action identifiers; operations
+// not listed are reported as "c2pa.edited".
+var c2paActions = map[string]string{
+	"Resize":            "c2pa.resized",
+	"SocialPreset":      "c2pa.resized",
+	"Crop":              "c2pa.cropped",
+	"CropToPath":        "c2pa.cropped",
+	"AutoOrient":        "c2pa.orientation",
+	"Grayscale":         "c2pa.color_adjustments",
+	"GrayscaleFast":     "c2pa.color_adjustments",
+	"Solarize":          "c2pa.color_adjustments",
+	"Duotone":           "c2pa.color_adjustments",
+	"Colorize":          "c2pa.color_adjustments",
+	"SplitTone":         "c2pa.color_adjustments",
+	"ApplyLUT":          "c2pa.color_adjustments",
+	"Tone":              "c2pa.color_adjustments",
+	"EnhanceLowLight":   "c2pa.color_adjustments",
+	"EnhanceWhiteboard": "c2pa.color_adjustments",
+	"CleanDocument":     "c2pa.filtered",
+	"MotionBlur":        "c2pa.filtered",
+	"RadialBlur":        "c2pa.filtered",
+	"FocusRegion":       "c2pa.filtered",
+	"Sharpen":           "c2pa.filtered",
+	"MedianFilter":      "c2pa.filtered",
+	"BilateralFilter":   "c2pa.filtered",
+	"Emboss":            "c2pa.filtered",
+	"Pixelate":          "c2pa.filtered",
+	"RedactRegion":      "c2pa.filtered",
+	"AddNoise":          "c2pa.filtered",
+	"FilmGrain":         "c2pa.filtered",
+	"Sobel":             "c2pa.filtered",
+	"Prewitt":           "c2pa.filtered",
+	"Canny":             "c2pa.filtered",
+	"Dilate":            "c2pa.filtered",
+	"Erode":             "c2pa.filtered",
+	"Open":              "c2pa.filtered",
+	"Close":             "c2pa.filtered",
+	"AddTextWatermark":  "c2pa.drawing",
+	"OverlayQRCode":     "c2pa.drawing",
+	"Composite":         "c2pa.placed",
+	"CompositeAt":       "c2pa.placed",
+}
+
+// JUMBF type UUIDs defined by the C2PA specification. All share the suffix
+// 0011-0010-8000-00AA00389B71 after a four-character prefix.
+var (
+	c2paStoreUUID      = c2paUUID("c2pa")
+	c2paManifestUUID   = c2paUUID("c2ma")
+	c2paAssertionsUUID = c2paUUID("c2as")
+	c2paClaimUUID      = c2paUUID("c2cl")
+	c2paCBORUUID       = c2paUUID("cbor")
+)
+
+func c2paUUID(prefix string) [16]byte {
+	var u [16]byte
+	copy(u[:4], prefix)
+	copy(u[4:], []byte{0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71})
+	return u
+}
+
+// buildManifest returns a JUMBF C2PA manifest store with an actions assertion
+// for history and an unsigned claim.
+func buildManifest(claimGenerator string, format ImageFormat, history []string) []byte {
+	actions := make([]any, 0, len(history))
+	for _, op := range history {
+		action, ok := c2paActions[op]
+		if !ok {
+			action = "c2pa.edited"
+		}
+		actions = append(actions, cborMap{
+			{"action", action},
+			{"softwareAgent", claimGenerator},
+			{"parameters", cborMap{{"operation", op}}},
+		})
+	}
+	actionsBox := jumbfSuperbox(c2paCBORUUID, "c2pa.actions",
+		jumbfBox("cbor", cborEncode(cborMap{{"actions", actions}})))
+	actionsHash := sha256.Sum256(actionsBox)
+
+	manifestID := "urn:uuid:" + newUUID()
+	claim := cborMap{
+		{"claim_generator", claimGenerator},
+		{"dc:format", "image/" + format.String()},
+		{"instanceID", "xmp:iid:" + newUUID()},
+		{"assertions", []any{cborMap{
+			{"url", "self#jumbf=c2pa.assertions/c2pa.actions"},
+			{"hash", actionsHash[:]},
+		}}},
+		{"alg", "sha256"},
+	}
+
+	manifest := jumbfSuperbox(c2paManifestUUID, manifestID,
+		jumbfSuperbox(c2paAssertionsUUID, "c2pa.assertions", actionsBox),
+		jumbfSuperbox(c2paClaimUUID, "c2pa.claim", jumbfBox("cbor", cborEncode(claim))),
+	)
+	return jumbfSuperbox(c2paStoreUUID, "c2pa", manifest)
+}
+
+// newUUID returns a random (version 4) UUID string.
+func newUUID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// jumbfBox returns an ISO BMFF style box: 32-bit size, type, payload.
+func jumbfBox(boxType string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], boxType)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// jumbfSuperbox returns a JUMBF superbox with a requestable, labelled
+// description box followed by contents.
+func jumbfSuperbox(typeUUID [16]byte, label string, contents ...[]byte) []byte {
+	desc := append(typeUUID[:], 0x03) // Requestable, label present
+	desc = append(desc, label...)
+	desc = append(desc, 0)
+	return jumbfBox("jumb", append([][]byte{jumbfBox("jumd", desc)}, contents...)...)
+}
+
+// embedManifest inserts a JUMBF manifest store into encoded image data.
+func embedManifest(data []byte, format ImageFormat, store []byte) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		return embedManifestJPEG(data, store), nil
+	case FormatPNG:
+		return embedManifestPNG(data, store), nil
+	default:
+		return nil, fmt.Errorf("provenance manifests are not supported for %s", format)
+	}
+}
+
+// embedManifestJPEG stores the manifest in JPEG XT APP11 segments right after
+// the SOI marker. Every segment repeats the superbox header, as required
+// for JUMBF boxes split across segments.
+func embedManifestJPEG(data, store []byte) []byte {
+	const maxChunk = math.MaxUint16 - 2 - 2 - 2 - 4 - 8 // Length, CI, En, Z, box header
+	header, payload := store[:8], store[8:]
+	var out bytes.Buffer
+	out.Write(data[:2]) // SOI
+	for seq := uint32(1); seq == 1 || len(payload) > 0; seq++ {
+		n := min(len(payload), maxChunk)
+		out.Write([]byte{0xff, 0xeb})
+		_ = binary.Write(&out, binary.BigEndian, uint16(2+2+2+4+8+n))
+		out.Write([]byte{'J', 'P', 0x00, 0x01}) // Common identifier and box instance
+		_ = binary.Write(&out, binary.BigEndian, seq)
+		out.Write(header)
+		out.Write(payload[:n])
+		payload = payload[n:]
+	}
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+// embedManifestPNG stores the manifest in a caBX chunk right after IHDR.
+func embedManifestPNG(data, store []byte) []byte {
+	chunk := make([]byte, 8, 12+len(store))
+	binary.BigEndian.PutUint32(chunk, uint32(len(store)))
+	copy(chunk[4:], "caBX")
+	chunk = append(chunk, store...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:pngIHDREnd]...)
+	out = append(out, chunk...)
+	return append(out, data[pngIHDREnd:]...)
+}
+
+// cborMap is a CBOR map with string keys that keeps its key order.
+type cborMap []struct {
+	key   string
+	value any
+}
+
+// cborEncode encodes strings, byte slices, arrays and cborMaps as CBOR
+// (RFC 8949), which is all the manifest needs.
+func cborEncode(v any) []byte {
+	var buf []byte
+	var enc func(v any)
+	head := func(major byte, n int) {
+		switch {
+		case n < 24:
+			buf = append(buf, major<<5|byte(n))
+		case n <= math.MaxUint8:
+			buf = append(buf, major<<5|24, byte(n))
+		case n <= math.MaxUint16:
+			buf = append(buf, major<<5|25)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+		default:
+			buf = append(buf, major<<5|26)
+			buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+		}
+	}
+	enc = func(v any) {
+		switch v := v.(type) {
+		case []byte:
+			head(2, len(v))
+			buf = append(buf, v...)
+		case string:
+			head(3, len(v))
+			buf = append(buf, v...)
+		case []any:
+			head(4, len(v))
+			for _, item := range v {
+				enc(item)
+			}
+		case cborMap:
+			head(5, len(v))
+			for _, kv := range v {
+				enc(kv.key)
+				enc(kv.value)
+			}
+		default:
+			panic(fmt.Sprintf("cborEncode: unsupported type %T", v))
+		}
+	}
+	enc(v)
+	return buf
+}
@@ -0,0 +1,79 @@
+package gopiq
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestOperations(t *testing.T) {
+	proc := New(createTestImage(40, 40)).Resize(20, 20).Grayscale().Sobel()
+	want := []string{"Resize", "Grayscale", "Sobel"}
+	if got := proc.Operations(); !slices.Equal(got, want) {
+		t.Errorf("Operations() = %v, want %v", got, want)
+	}
+
+	// Failed operations are not recorded and clones have their own history.
+	clone := proc.Clone().Crop(0, 0, 10, 10)
+	proc.Resize(-1, 10)
+	if got := proc.Operations(); !slices.Equal(got, want) {
+		t.Errorf("Operations() after a failed operation = %v, want %v", got, want)
+	}
+	if got := clone.Operations(); !slices.Equal(got, append(want, "Crop")) {
+		t.Errorf("clone Operations() = %v, want %v", got, append(want, "Crop"))
+	}
+
+	if got := New(createTestImage(10, 10)).Operations(); len(got) != 0 {
+		t.Errorf("Operations() on a fresh processor = %v, want none", got)
+	}
+}
+
+func TestWithProvenance(t *testing.T) {
+	proc := New(createTestImage(40, 40)).Resize(30, 30).Crop(0, 0, 20, 20).Sharpen(1)
+
+	for _, format := range []ImageFormat{FormatPNG, FormatJPEG} {
+		data, err := proc.ToBytes(format, WithProvenance("gopiq-test/1.0"))
+		if err != nil {
+			t.Fatalf("ToBytes(%s) with provenance should not error, got: %v", format, err)
+		}
+		img, err := FromBytes(data).Image()
+		if err != nil {
+			t.Fatalf("%s output with provenance should decode, got: %v", format, err)
+		}
+		if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 20 {
+			t.Errorf("%s output with provenance has bounds %v, want 20x20", format, img.Bounds())
+		}
+		for _, s := range []string{"c2pa.actions", "c2pa.claim", "c2pa.resized", "c2pa.cropped", "c2pa.filtered", "gopiq-test/1.0", "image/" + format.String()} {
+			if !bytes.Contains(data, []byte(s)) {
+				t.Errorf("%s output with provenance should contain %q", format, s)
+			}
+		}
+
+		plain, _ := proc.ToBytes(format)
+		if bytes.Contains(plain, []byte("c2pa")) {
+			t.Errorf("%s output without provenance should not contain a manifest", format)
+		}
+	}
+
+	// The manifest is embedded in the fallback format actually produced.
+	data, err := proc.ToBytes(FormatAVIF, WithCodecFallback([]ImageFormat{FormatPNG}), WithProvenance("x"))
+	if err != nil || !bytes.Contains(data, []byte("image/png")) {
+		t.Errorf("ToBytes() with fallback and provenance = %v, want a png manifest", err)
+	}
+
+	// Manifests larger than one APP11 segment are split and still decode.
+	large := bytes.Repeat([]byte("Resize "), 20000)
+	jpegData, _ := imageToJPEGBytes(createTestImage(8, 8))
+	data = embedManifestJPEG(jpegData, jumbfBox("jumb", large))
+	if n := bytes.Count(data, []byte{0xff, 0xeb}); n < 3 {
+		t.Errorf("large manifest should span at least 3 APP11 segments, got %d", n)
+	}
+	if _, err := FromBytes(data).Image(); err != nil {
+		t.Errorf("JPEG with a multi-segment manifest should decode, got: %v", err)
+	}
+
+	// Test case: Processor with a prior error
+	if _, err := New(nil).ToBytes(FormatPNG, WithProvenance("x")); err == nil {
+		t.Fatal("ToBytes() on a processor with prior error should return that error")
+	}
+}
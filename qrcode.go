@@ -0,0 +1,509 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// QR codes are generated in byte mode with error correction level M, which
+// recovers from roughly 15% damage and suits printed tickets and labels.
+const (
+	qrMinVersion = 1
+	qrMaxVersion = 40
+	qrQuietZone  = 4 // Light border in modules required around the symbol
+	qrFormatECLM = 0 // Format bits for error correction level M
+)
+
+// qrECCPerBlock and qrNumBlocks give the error correction codewords per block
+// and the number of blocks of each version at level M (index 0 is unused).
+var (
+	qrECCPerBlock = [41]int{0,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	qrNumBlocks = [41]int{0,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+// qrCode is a generated QR symbol without quiet zone.
+type qrCode struct {
+	size     int
+	modules  [][]bool // [y][x], true is dark
+	function [][]bool // Modules reserved for function patterns
+}
+
+// OverlayQRCode generates a QR code for content and composites it onto the
+// image at the given anchor. size is the edge length in pixels of the code
+// including its quiet zone; modules are drawn at a whole number of pixels
+// each so the code stays crisp, with any remainder added to the quiet zone.
+// The smallest QR version that holds content is used, with error correction
+// level M.
+// Returns the ImageProcessor for chaining. An error is set if content is
+// empty or too long, or if size is too small for one pixel per module.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) OverlayQRCode(content string, size int, at Anchor) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if content == "" {
+		ip.err = fmt.Errorf("QR code content cannot be empty")
+		return ip
+	}
+
+	qr, err := encodeQR([]byte(content))
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	code, err := qr.render(size)
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+
+	bounds := ip.currentImage.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	r := at.place(bounds, code.Bounds().Size())
+	draw.Draw(dst, r, code, image.Point{}, draw.Src)
+
+	ip.currentImage = dst
+	ip.record("OverlayQRCode")
+	return ip
+}
+
+// render draws the code with its quiet zone into a size x size gray image.
+func (qr *qrCode) render(size int) (*image.Gray, error) {
+	total := qr.size + 2*qrQuietZone
+	scale := size / total
+	if scale < 1 {
+		return nil, fmt.Errorf("QR code size %d is too small, need at least %d pixels", size, total)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	offset := (size - qr.size*scale) / 2
+	for y, row := range qr.modules {
+		for x, dark := range row {
+			if dark {
+				r := image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale).Add(image.Pt(offset, offset))
+				draw.Draw(img, r, image.NewUniform(color.Black), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img, nil
+}
+
+// encodeQR encodes data in byte mode at the smallest version that fits and
+// applies the mask with the lowest penalty.
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := qrMinVersion; v <= qrMaxVersion; v++ {
+		if 4+qrCountBits(v)+8*len(data) <= 8*qrDataCodewords(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("QR code content too long (%d bytes)", len(data))
+	}
+
+	// Mode indicator, character count and data, then terminator and padding.
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * qrDataCodewords(version)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := qrInterleave(version, bits.bytes())
+
+	best, bestPenalty := (*qrCode)(nil), -1
+	for mask := 0; mask < 8; mask++ {
+		qr := newQRCode(version, codewords, mask)
+		if p := qr.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = qr, p
+		}
+	}
+	return best, nil
+}
+
+// newQRCode lays out the function patterns and codewords of a symbol with the
+// given mask.
+func newQRCode(version int, codewords []byte, mask int) *qrCode {
+	size := 4*version + 17
+	qr := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range qr.modules {
+		qr.modules[y] = make([]bool, size)
+		qr.function[y] = make([]bool, size)
+	}
+
+	// Timing patterns, finder patterns and alignment patterns.
+	for i := 0; i < size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(absInt(dx), absInt(dy))
+					qr.setFunction(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	pos := qrAlignmentPositions(version)
+	for i, cy := range pos {
+		for j, cx := range pos {
+			last := len(pos) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // Overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(cx+dx, cy+dy, max(absInt(dx), absInt(dy)) != 1)
+				}
+			}
+		}
+	}
+	qr.drawFormat(mask)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		v := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (v>>i)&1 != 0
+			a, b := size-11+i%3, i/3
+			qr.setFunction(a, b, dark)
+			qr.setFunction(b, a, dark)
+		}
+	}
+
+	// Codewords in the two-column zigzag from the bottom-right corner.
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if qr.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				qr.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !qr.function[y][x] && qrMaskBit(mask, x, y) {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+	return qr
+}
+
+// setFunction sets a function pattern module.
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// drawFormat draws both copies of the BCH-protected format information.
+func (qr *qrCode) drawFormat(mask int) {
+	data := qrFormatECLM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // Always-dark module
+}
+
+// qrMaskBit reports whether mask pattern m inverts the module at (x, y).
+func qrMaskBit(m, x, y int) bool {
+	switch m {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores the symbol according to the four mask evaluation rules of
+// ISO/IEC 18004; lower is better.
+func (qr *qrCode) penalty() int {
+	n := qr.size
+	// at reads module x of line y, where lines are columns if vertical.
+	at := func(x, y int, vertical bool) bool {
+		if x < 0 || x >= n {
+			return false // Outside the symbol counts as light
+		}
+		if vertical {
+			return qr.modules[x][y]
+		}
+		return qr.modules[y][x]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+
+	p := 0
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			// Rule 1: runs of five or more same-colored modules.
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += run - 2
+				}
+				run = 1
+			}
+			// Rule 3: finder-like 1:1:3:1:1 patterns with four light modules
+			// on either side.
+			for x := 0; x+len(finder) <= n; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, vertical) != dark {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				before, after := true, true
+				for k := 1; k <= 4; k++ {
+					before = before && !at(x-k, y, vertical)
+					after = after && !at(x+len(finder)-1+k, y, vertical)
+				}
+				if before || after {
+					p += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			c := qr.modules[y][x]
+			if c {
+				dark++
+			}
+			// Rule 2: 2x2 blocks of one color.
+			if x+1 < n && y+1 < n && c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+				p += 3
+			}
+		}
+	}
+	// Rule 4: deviation of the dark ratio from 50% in steps of 5%.
+	total := n * n
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	return p + 10*k
+}
+
+// qrCountBits returns the width of the byte mode character count field.
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// qrRawModules returns the number of modules available for data and error
+// correction codewords, including remainder bits.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCodewords returns the number of data codewords of a version.
+func qrDataCodewords(version int) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[version]*qrNumBlocks[version]
+}
+
+// qrAlignmentPositions returns the centre coordinates of alignment patterns.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	num := version/7 + 2
+	step := (version*8 + num*3 + 5) / (num*4 - 4) * 2
+	pos := make([]int, num)
+	pos[0] = 6
+	for i, p := num-1, 4*version+17-7; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// qrInterleave splits data into blocks, appends Reed-Solomon error
+// correction to each and interleaves the result.
+func qrInterleave(version int, data []byte) []byte {
+	numBlocks, eccLen := qrNumBlocks[version], qrECCPerBlock[version]
+	raw := qrRawModules(version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0) // Placeholder, skipped when interleaving
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	out := make([]byte, 0, raw)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree
+// over GF(256), highest coefficient first and leading 1 omitted.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords of data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrBitBuffer accumulates bits most significant first.
+type qrBitBuffer []bool
+
+// append adds the low n bits of v.
+func (b *qrBitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (v>>i)&1 != 0)
+	}
+}
+
+// bytes packs the bits, whose count must be a multiple of 8, into bytes.
+func (b qrBitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// absInt returns |v|.
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,189 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// Version 1-M "HELLO WORLD" from the ISO/IEC 18004 worked example.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("reedSolomonRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestQRAlignmentPositions(t *testing.T) {
+	cases := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range cases {
+		got := qrAlignmentPositions(version)
+		if len(got) != len(want) {
+			t.Errorf("qrAlignmentPositions(%d) = %v, want %v", version, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("qrAlignmentPositions(%d) = %v, want %v", version, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	cases := []struct {
+		length, version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{2331, 40},
+	}
+	for _, c := range cases {
+		qr, err := encodeQR(bytes.Repeat([]byte("a"), c.length))
+		if err != nil {
+			t.Fatalf("encodeQR(%d bytes) should not error, got: %v", c.length, err)
+		}
+		if want := 4*c.version + 17; qr.size != want {
+			t.Errorf("encodeQR(%d bytes) size = %d, want %d (version %d)", c.length, qr.size, want, c.version)
+		}
+
+		// The finder pattern in the top-left corner: dark ring, light ring,
+		// dark 3x3 centre and light separator.
+		for i, want := range []bool{true, false, true, true, true, false, true, false} {
+			if qr.modules[3][i] != want || qr.modules[i][3] != want {
+				t.Errorf("encodeQR(%d bytes) has a broken finder pattern at %d", c.length, i)
+			}
+		}
+		if !qr.modules[qr.size-8][8] {
+			t.Errorf("encodeQR(%d bytes) is missing the dark module", c.length)
+		}
+	}
+
+	if _, err := encodeQR(bytes.Repeat([]byte("a"), 2332)); err == nil {
+		t.Error("encodeQR() with content beyond version 40 should return an error")
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	// Both format copies must encode level M and the chosen mask.
+	for mask := 0; mask < 8; mask++ {
+		qr := newQRCode(1, make([]byte, 26), mask)
+		bits := 0
+		for i := 0; i <= 5; i++ {
+			if qr.modules[i][8] {
+				bits |= 1 << i
+			}
+		}
+		for i, p := range []image.Point{{8, 7}, {8, 8}, {7, 8}} {
+			if qr.modules[p.Y][p.X] {
+				bits |= 1 << (6 + i)
+			}
+		}
+		for i := 9; i < 15; i++ {
+			if qr.modules[8][14-i] {
+				bits |= 1 << i
+			}
+		}
+		decoded := (bits ^ 0x5412) >> 10
+		if decoded != qrFormatECLM<<3|mask {
+			t.Errorf("mask %d: format bits decode to %05b", mask, decoded)
+		}
+
+		second := 0
+		for i := 0; i < 8; i++ {
+			if qr.modules[8][qr.size-1-i] {
+				second |= 1 << i
+			}
+		}
+		for i := 8; i < 15; i++ {
+			if qr.modules[qr.size-15+i][8] {
+				second |= 1 << i
+			}
+		}
+		if second != bits {
+			t.Errorf("mask %d: format copies differ: %015b vs %015b", mask, bits, second)
+		}
+	}
+}
+
+func TestOverlayQRCode(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	for i := range originalImg.Pix {
+		originalImg.Pix[i] = 255
+	}
+
+	proc := New(originalImg).OverlayQRCode("https://example.com/ticket/42", 100, AnchorBottomRight)
+	if proc.Err() != nil {
+		t.Fatalf("OverlayQRCode() should not error, got: %v", proc.Err())
+	}
+	img, _ := proc.Image()
+	if img.Bounds() != originalImg.Bounds() {
+		t.Errorf("OverlayQRCode() changed bounds to %v", img.Bounds())
+	}
+
+	// Version 3 (29 modules + quiet zone = 37) at 2px per module, centred in
+	// the 100px square anchored at the bottom-right corner.
+	dark := image.Rectangle{}
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r < 0x8000 {
+				dark = dark.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if want := image.Rect(121, 71, 179, 129); dark != want {
+		t.Errorf("OverlayQRCode() dark area = %v, want %v", dark, want)
+	}
+	if c := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("OverlayQRCode() changed pixels outside the code: %v", c)
+	}
+	if originalImg.Pix[len(originalImg.Pix)-4*30] != 255 {
+		t.Error("OverlayQRCode() should not modify the source image")
+	}
+
+	// Invalid input
+	if New(originalImg).OverlayQRCode("", 100, AnchorCenter).Err() == nil {
+		t.Error("OverlayQRCode() with empty content should return an error")
+	}
+	if New(originalImg).OverlayQRCode("hello", 20, AnchorCenter).Err() == nil {
+		t.Error("OverlayQRCode() with a size below one pixel per module should return an error")
+	}
+	if New(originalImg).OverlayQRCode(strings.Repeat("x", 3000), 400, AnchorCenter).Err() == nil {
+		t.Error("OverlayQRCode() with too much content should return an error")
+	}
+	if New(nil).OverlayQRCode("hello", 100, AnchorCenter).Err() == nil {
+		t.Fatal("OverlayQRCode() on a processor with prior error should propagate that error")
+	}
+}
+
+func TestAnchorPlace(t *testing.T) {
+	outer := image.Rect(10, 10, 110, 60)
+	size := image.Pt(20, 10)
+	cases := map[Anchor]image.Point{
+		AnchorTopLeft:     {10, 10},
+		AnchorTop:         {50, 10},
+		AnchorTopRight:    {90, 10},
+		AnchorLeft:        {10, 30},
+		AnchorCenter:      {50, 30},
+		AnchorRight:       {90, 30},
+		AnchorBottomLeft:  {10, 50},
+		AnchorBottom:      {50, 50},
+		AnchorBottomRight: {90, 50},
+	}
+	for a, want := range cases {
+		if got := a.place(outer, size); got.Min != want || got.Size() != size {
+			t.Errorf("Anchor(%d).place() = %v, want min %v", a, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+)
+
+// PixelLayout is the arrangement of 8-bit samples in the buffers of ToRaw
+// and FromRaw. Rows run top to bottom without padding.
+type PixelLayout int
+
+const (
+	PixelRGBA              PixelLayout = iota // Non-premultiplied alpha, as most GPU texture uploads expect.
+	PixelRGBAPremultiplied                    // As stored by image.RGBA; no conversion for most images.
+	PixelBGRA                                 // Non-premultiplied alpha, as Windows bitmaps and Cairo-style C libraries use.
+	PixelRGB                                  // Alpha is dropped on export and opaque on import.
+	PixelBGR                                  // As OpenCV stores color images; alpha as for PixelRGB.
+	PixelGray                                 // One luma sample per pixel; see ToGray.
+	PixelRGBPlanar                            // All red samples, then green, then blue: the CHW tensors of ML models.
+)
+
+// String returns the name of the PixelLayout.
+func (l PixelLayout) String() string {
+	switch l {
+	case PixelRGBA:
+		return "rgba"
+	case PixelRGBAPremultiplied:
+		return "rgba-premultiplied"
+	case PixelBGRA:
+		return "bgra"
+	case PixelRGB:
+		return "rgb"
+	case PixelBGR:
+		return "bgr"
+	case PixelGray:
+		return "gray"
+	case PixelRGBPlanar:
+		return "rgb-planar"
+	default:
+		return "unknown"
+	}
+}
+
+// bytesPerPixel returns the number of samples per pixel of the layout, or 0
+// if it is not a valid layout.
+func (l PixelLayout) bytesPerPixel() int {
+	switch l {
+	case PixelRGBA, PixelRGBAPremultiplied, PixelBGRA:
+		return 4
+	case PixelRGB, PixelBGR, PixelRGBPlanar:
+		return 3
+	case PixelGray:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ToRaw returns the pixels of the current image as a new buffer in layout,
+// with its width and height, to hand to GPU texture uploads, ML tensors or
+// C libraries without an encode/decode round trip.
+// Returns an error if a previous error in the chain exists or the layout is
+// unknown.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ToRaw(layout PixelLayout) ([]byte, int, int, error) {
+	switch layout {
+	case PixelGray:
+		gray, err := ip.ToGray()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return gray.Pix, gray.Rect.Dx(), gray.Rect.Dy(), nil
+	case PixelRGBAPremultiplied:
+		rgba, err := ip.ToRGBA()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return rgba.Pix, rgba.Rect.Dx(), rgba.Rect.Dy(), nil
+	case PixelRGBA, PixelBGRA, PixelRGB, PixelBGR, PixelRGBPlanar:
+	default:
+		if err := ip.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		return nil, 0, 0, fmt.Errorf("unknown pixel layout %d", layout)
+	}
+
+	nrgba, err := ip.ToNRGBA()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	w, h := nrgba.Rect.Dx(), nrgba.Rect.Dy()
+	if layout == PixelRGBA {
+		return nrgba.Pix, w, h, nil
+	}
+	n := w * h
+	out := make([]byte, n*layout.bytesPerPixel())
+	for i := range n {
+		p := nrgba.Pix[4*i : 4*i+4]
+		switch layout {
+		case PixelBGRA:
+			out[4*i], out[4*i+1], out[4*i+2], out[4*i+3] = p[2], p[1], p[0], p[3]
+		case PixelRGB:
+			out[3*i], out[3*i+1], out[3*i+2] = p[0], p[1], p[2]
+		case PixelBGR:
+			out[3*i], out[3*i+1], out[3*i+2] = p[2], p[1], p[0]
+		case PixelRGBPlanar:
+			out[i], out[n+i], out[2*n+i] = p[0], p[1], p[2]
+		}
+	}
+	return out, w, h, nil
+}
+
+// FromRaw creates a new ImageProcessor from a w×h buffer of pixels in
+// layout, such as a GPU readback, an ML model's output tensor or a C
+// library's image. The pixels are copied, so data can be reused.
+// Returns an error if the size is not positive, the layout is unknown or
+// data does not hold exactly w*h pixels.
+func FromRaw(data []byte, w, h int, layout PixelLayout) *ImageProcessor {
+	if w <= 0 || h <= 0 {
+		return &ImageProcessor{err: fmt.Errorf("raw image size must be positive (got: %dx%d)", w, h)}
+	}
+	bpp := layout.bytesPerPixel()
+	if bpp == 0 {
+		return &ImageProcessor{err: fmt.Errorf("unknown pixel layout %d", layout)}
+	}
+	if len(data) != w*h*bpp {
+		return &ImageProcessor{err: fmt.Errorf("raw %s image of %dx%d needs %d bytes (got: %d)", layout, w, h, w*h*bpp, len(data))}
+	}
+
+	var img image.Image
+	switch layout {
+	case PixelGray:
+		gray := image.NewGray(image.Rect(0, 0, w, h))
+		copy(gray.Pix, data)
+		img = gray
+	case PixelRGBAPremultiplied:
+		rgba := newRGBA(image.Rect(0, 0, w, h))
+		copy(rgba.Pix, data)
+		img = rgba
+	default:
+		rgba := newRGBA(image.Rect(0, 0, w, h))
+		n := w * h
+		for i := range n {
+			var r, g, b, a uint8 = 0, 0, 0, 255
+			switch layout {
+			case PixelRGBA:
+				r, g, b, a = data[4*i], data[4*i+1], data[4*i+2], data[4*i+3]
+			case PixelBGRA:
+				r, g, b, a = data[4*i+2], data[4*i+1], data[4*i], data[4*i+3]
+			case PixelRGB:
+				r, g, b = data[3*i], data[3*i+1], data[3*i+2]
+			case PixelBGR:
+				r, g, b = data[3*i+2], data[3*i+1], data[3*i]
+			case PixelRGBPlanar:
+				r, g, b = data[i], data[n+i], data[2*n+i]
+			}
+			d := rgba.Pix[4*i : 4*i+4]
+			d[0], d[1], d[2], d[3] = premultiply(r, a), premultiply(g, a), premultiply(b, a), a
+		}
+		img = rgba
+	}
+	return &ImageProcessor{
+		currentImage: img,
+		perfOpts:     DefaultPerformanceOptions(),
+		size:         img.Bounds().Size(),
+	}
+}
@@ -0,0 +1,92 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToRaw(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{10, 20, 30, 255})
+	src.SetRGBA(1, 0, color.RGBA{40, 0, 20, 128}) // Straight {79 0 39 128}
+
+	cases := map[PixelLayout][]byte{
+		PixelRGBA:              {10, 20, 30, 255, 79, 0, 39, 128},
+		PixelRGBAPremultiplied: {10, 20, 30, 255, 40, 0, 20, 128},
+		PixelBGRA:              {30, 20, 10, 255, 39, 0, 79, 128},
+		PixelRGB:               {10, 20, 30, 79, 0, 39},
+		PixelBGR:               {30, 20, 10, 39, 0, 79},
+		PixelGray:              {18, 14},
+		PixelRGBPlanar:         {10, 79, 20, 0, 30, 39},
+	}
+	for layout, want := range cases {
+		data, w, h, err := New(src).ToRaw(layout)
+		if err != nil {
+			t.Fatalf("ToRaw(%s) should not error, got: %v", layout, err)
+		}
+		if w != 2 || h != 1 || !bytes.Equal(data, want) {
+			t.Errorf("ToRaw(%s) = %v of %dx%d, want %v of 2x1", layout, data, w, h, want)
+		}
+	}
+
+	// The buffer belongs to the caller.
+	data, _, _, _ := New(src).ToRaw(PixelRGBAPremultiplied)
+	data[0] = 99
+	if src.Pix[0] != 10 {
+		t.Error("ToRaw() should return a copy of the pixels")
+	}
+
+	// Test case: Invalid input
+	if _, _, _, err := New(src).ToRaw(PixelLayout(42)); err == nil {
+		t.Error("ToRaw() with an unknown layout should return an error")
+	}
+	if _, _, _, err := New(nil).ToRaw(PixelRGB); err == nil {
+		t.Error("ToRaw() on a processor with prior error should return that error")
+	}
+}
+
+func TestFromRaw(t *testing.T) {
+	src := gradientImage(16, 8)
+	for layout := PixelRGBA; layout <= PixelRGBPlanar; layout++ {
+		data, w, h, err := New(src).ToRaw(layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := mustImage(t, FromRaw(data, w, h, layout))
+		if img.Bounds() != src.Bounds() {
+			t.Fatalf("FromRaw(%s) bounds = %v, want %v", layout, img.Bounds(), src.Bounds())
+		}
+		if layout == PixelGray {
+			if _, ok := img.(*image.Gray); !ok {
+				t.Errorf("FromRaw(gray) = %T, want *image.Gray", img)
+			}
+			continue
+		}
+		if got := img.(*image.RGBA); !bytes.Equal(got.Pix, src.Pix) {
+			t.Errorf("FromRaw(%s) of ToRaw(%s) does not round-trip", layout, layout)
+		}
+	}
+
+	// Straight alpha is premultiplied, and the data is copied.
+	data := []byte{30, 20, 10, 128}
+	img := mustImage(t, FromRaw(data, 1, 1, PixelBGRA)).(*image.RGBA)
+	data[0] = 0
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{5, 10, 15, 128}) {
+		t.Errorf("FromRaw(bgra) pixel = %v, want premultiplied {5 10 15 128}", got)
+	}
+
+	// Test case: Invalid input
+	cases := map[string]*ImageProcessor{
+		"zero width":     FromRaw(nil, 0, 1, PixelRGB),
+		"unknown layout": FromRaw([]byte{1}, 1, 1, PixelLayout(-1)),
+		"short data":     FromRaw([]byte{1, 2}, 1, 1, PixelRGB),
+		"long data":      FromRaw([]byte{1, 2, 3, 4}, 1, 1, PixelRGB),
+	}
+	for name, ip := range cases {
+		if ip.Err() == nil {
+			t.Errorf("FromRaw() with %s should return an error", name)
+		}
+	}
+}
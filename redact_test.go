@@ -0,0 +1,77 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestRedactRegion(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			originalImg.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 6), 128, 255})
+		}
+	}
+	region := image.Rect(10, 10, 40, 30)
+
+	for _, mode := range []RedactMode{RedactPixelate, RedactBlur, RedactSolid} {
+		proc := New(originalImg).RedactRegion(region, mode)
+		if proc.Err() != nil {
+			t.Fatalf("RedactRegion(mode %d) should not error, got: %v", mode, proc.Err())
+		}
+		img, _ := proc.Image()
+
+		changed := 0
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 60; x++ {
+				same := img.At(x, y) == originalImg.At(x, y)
+				inside := image.Pt(x, y).In(region)
+				if !inside && !same {
+					t.Fatalf("RedactRegion(mode %d) changed pixel (%d,%d) outside the region", mode, x, y)
+				}
+				if inside && !same {
+					changed++
+				}
+			}
+		}
+		if changed < region.Dx()*region.Dy()/2 {
+			t.Errorf("RedactRegion(mode %d) changed only %d pixels inside the region", mode, changed)
+		}
+	}
+
+	img, _ := New(originalImg).RedactRegion(region, RedactSolid).Image()
+	if got := color.RGBAModel.Convert(img.At(20, 20)); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("RedactRegion(RedactSolid) = %v, want opaque black", got)
+	}
+
+	// Regions are clipped to the image.
+	proc := New(originalImg).RedactRegion(image.Rect(50, 30, 100, 100), RedactBlur)
+	if proc.Err() != nil {
+		t.Errorf("RedactRegion() with a partially outside region should not error, got: %v", proc.Err())
+	}
+
+	// Views whose rows are wider than the image give the same result.
+	wide, compact := wideStrideImage(60, 50)
+	for _, mode := range []RedactMode{RedactPixelate, RedactBlur, RedactSolid} {
+		got := mustImage(t, New(wide).RedactRegion(region, mode))
+		want := mustImage(t, New(compact).RedactRegion(region, mode))
+		if !slices.Equal(asRGBA(got).Pix, asRGBA(want).Pix) {
+			t.Errorf("RedactRegion(%v) of a wide-stride view differs from that of a compact copy", mode)
+		}
+	}
+
+	// Invalid input
+	if New(originalImg).RedactRegion(image.Rect(100, 100, 120, 120), RedactSolid).Err() == nil {
+		t.Error("RedactRegion() with a region outside the image should return an error")
+	}
+	if New(originalImg).RedactRegion(region, RedactMode(99)).Err() == nil {
+		t.Error("RedactRegion() with an unknown mode should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).RedactRegion(region, RedactSolid).Err() == nil {
+		t.Fatal("RedactRegion() on a processor with prior error should propagate that error")
+	}
+}
@@ -0,0 +1,299 @@
+package gopiq
+
+import (
+	"image"
+	"slices"
+	"strings"
+
+	"github.com/go-text/typesetting/di"
+	gotext "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Lines in scripts whose glyphs depend on their neighbors, such as Arabic
+// joining, Devanagari conjuncts and reordered vowel signs, or Hebrew marks,
+// are shaped with HarfBuzz (the go-text/typesetting port) from the GSUB and
+// GPOS tables of the font: each line is split into runs of one direction
+// with the Unicode bidirectional algorithm, the runs are shaped in visual
+// order and the resulting glyphs are drawn from their outlines. Other lines
+// are drawn rune by rune with the kerning of the face.
+
+// simpleScripts are the scripts whose letters keep their shape and place
+// next to any neighbor, so text in them is drawn rune by rune.
+var simpleScripts = []language.Script{
+	language.Common, language.Inherited, language.Latin, language.Greek, language.Cyrillic,
+	language.Han, language.Hiragana, language.Katakana, language.Hangul,
+}
+
+// needsShaping reports whether line contains a letter of a script that
+// needs shaping.
+func needsShaping(line string) bool {
+	return strings.ContainsFunc(line, func(c rune) bool {
+		return !slices.Contains(simpleScripts, language.LookupScript(c))
+	})
+}
+
+// shapedGlyph is a glyph of a shaped line, with dot its origin relative to
+// the origin of the line.
+type shapedGlyph struct {
+	face *fontFace
+	id   sfnt.GlyphIndex
+	dot  fixed.Point26_6
+}
+
+// glyphRun is a shaped line of glyphs in visual order.
+type glyphRun struct {
+	glyphs  []shapedGlyph
+	ink     fixed.Rectangle26_6 // Union of the glyph bounds
+	advance fixed.Int26_6
+}
+
+// shapingFontmap picks the first face that has a glyph for a rune, or else
+// the first face, like fallbackFace does.
+type shapingFontmap []*gotext.Face
+
+func (m shapingFontmap) ResolveFace(r rune) *gotext.Face {
+	for _, f := range m {
+		if _, ok := f.NominalGlyph(r); ok {
+			return f
+		}
+	}
+	return m[0]
+}
+
+// shapingFaces returns the fonts face draws with, primary first, or nil if
+// it is not made from parsed font data.
+func shapingFaces(face font.Face) []*fontFace {
+	switch f := face.(type) {
+	case *fontFace:
+		return []*fontFace{f}
+	case *fallbackFace:
+		faces := make([]*fontFace, len(f.faces))
+		for i, face := range f.faces {
+			ff, ok := face.(*fontFace)
+			if !ok {
+				return nil
+			}
+			faces[i] = ff
+		}
+		return faces
+	}
+	return nil
+}
+
+// shapeLine shapes line with the fonts of face. It returns nil if the line
+// does not need shaping or face has no font data to shape with, in which
+// case the line is drawn rune by rune.
+func shapeLine(face font.Face, line string) *glyphRun {
+	if !needsShaping(line) {
+		return nil
+	}
+	faces := shapingFaces(face)
+	if faces == nil {
+		return nil
+	}
+	fontmap := make(shapingFontmap, len(faces))
+	for i, f := range faces {
+		fnt, err := f.src.shapingFont()
+		if err != nil {
+			return nil
+		}
+		fontmap[i] = gotext.NewFace(fnt)
+	}
+
+	runes := []rune(line)
+	run := &glyphRun{}
+	var (
+		seg    shaping.Segmenter
+		shaper shaping.HarfbuzzShaper
+		buf    sfnt.Buffer
+	)
+	for _, r := range bidiRuns(runes) {
+		dir := di.DirectionLTR
+		if r.rtl {
+			dir = di.DirectionRTL
+		}
+		inputs := seg.Split(shaping.Input{Text: runes, RunStart: r.start, RunEnd: r.end, Direction: dir}, fontmap)
+		if r.rtl {
+			slices.Reverse(inputs)
+		}
+		for _, in := range inputs {
+			f := faces[slices.Index(fontmap, in.Face)]
+			// Shaping at one pixel per font unit keeps the positions exact;
+			// they are scaled to the size of the face here.
+			upem := int(in.Face.Upem())
+			in.Size = fixed.I(upem)
+			scale := func(v fixed.Int26_6) fixed.Int26_6 {
+				return fixed.Int26_6(int64(v) * int64(f.ppem) / int64(fixed.I(upem)))
+			}
+			out := shaper.Shape(in)
+			for _, g := range out.Glyphs {
+				dot := fixed.Point26_6{X: run.advance + scale(g.XOffset), Y: -scale(g.YOffset)}
+				id := sfnt.GlyphIndex(g.GlyphID)
+				if bounds, _, err := f.src.font.GlyphBounds(&buf, id, f.ppem, font.HintingNone); err == nil && !bounds.Empty() {
+					run.ink = run.ink.Union(bounds.Add(dot))
+				}
+				run.glyphs = append(run.glyphs, shapedGlyph{face: f, id: id, dot: dot})
+				run.advance += scale(g.XAdvance)
+			}
+		}
+	}
+	return run
+}
+
+// draw draws the glyphs of the run with src onto dst, placing the origin
+// of the line at dot.
+func (r *glyphRun) draw(dst draw.Image, src image.Image, dot fixed.Point26_6) {
+	var (
+		buf  sfnt.Buffer
+		rast vector.Rasterizer
+	)
+	for _, g := range r.glyphs {
+		segments, err := g.face.src.font.LoadGlyph(&buf, g.id, g.face.ppem, nil)
+		if err != nil {
+			continue
+		}
+		origin := dot.Add(g.dot)
+		b := segments.Bounds().Add(origin)
+		dr := image.Rect(b.Min.X.Floor(), b.Min.Y.Floor(), b.Max.X.Ceil(), b.Max.Y.Ceil())
+		if dr.Empty() {
+			continue
+		}
+		// Segments are relative to the glyph origin; the rasterizer wants
+		// them relative to the top-left corner of dr.
+		bias := origin.Sub(fixed.P(dr.Min.X, dr.Min.Y))
+		pt := func(p fixed.Point26_6) (float32, float32) {
+			return float32(p.X+bias.X) / 64, float32(p.Y+bias.Y) / 64
+		}
+		rast.Reset(dr.Dx(), dr.Dy())
+		rast.DrawOp = draw.Src
+		for _, s := range segments {
+			switch s.Op {
+			case sfnt.SegmentOpMoveTo:
+				rast.MoveTo(pt(s.Args[0]))
+			case sfnt.SegmentOpLineTo:
+				rast.LineTo(pt(s.Args[0]))
+			case sfnt.SegmentOpQuadTo:
+				x1, y1 := pt(s.Args[0])
+				x2, y2 := pt(s.Args[1])
+				rast.QuadTo(x1, y1, x2, y2)
+			case sfnt.SegmentOpCubeTo:
+				x1, y1 := pt(s.Args[0])
+				x2, y2 := pt(s.Args[1])
+				x3, y3 := pt(s.Args[2])
+				rast.CubeTo(x1, y1, x2, y2, x3, y3)
+			}
+		}
+		mask := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+		rast.Draw(mask, mask.Rect, image.Opaque, image.Point{})
+		draw.DrawMask(dst, dr, src, dr.Min, mask, image.Point{}, draw.Over)
+	}
+}
+
+// bidiRun is the runes from start to end of a line, in a single direction.
+type bidiRun struct {
+	start, end int
+	rtl        bool
+}
+
+// bidiRuns splits a line into runs of a single direction with the Unicode
+// bidirectional algorithm and returns them in visual order. A line without
+// right-to-left characters is a single left-to-right run.
+func bidiRuns(runes []rune) []bidiRun {
+	whole := []bidiRun{{start: 0, end: len(runes)}}
+	base, rtl := bidi.LeftToRight, false
+	strongFound := false
+	for _, c := range runes {
+		switch p, _ := bidi.LookupRune(c); p.Class() {
+		case bidi.R, bidi.AL:
+			rtl = true
+			if !strongFound {
+				base, strongFound = bidi.RightToLeft, true
+			}
+		case bidi.L:
+			strongFound = true
+		}
+	}
+	if !rtl {
+		return whole
+	}
+
+	var p bidi.Paragraph
+	if _, err := p.SetString(string(runes)); err != nil {
+		return whole
+	}
+	o, err := p.Order()
+	if err != nil {
+		return whole
+	}
+	runs := make([]bidiRun, o.NumRuns())
+	for i := range runs {
+		r := o.Run(i)
+		start, end := r.Pos()
+		runs[i] = bidiRun{start: start, end: end + 1, rtl: r.Direction() == bidi.RightToLeft}
+	}
+
+	if base == bidi.RightToLeft {
+		// All left-to-right runs are embedded in the right-to-left line.
+		slices.Reverse(runs)
+		return runs
+	}
+	visual := make([]bidiRun, 0, len(runs))
+	for i := 0; i < len(runs); {
+		if !runs[i].rtl {
+			visual = append(visual, runs[i])
+			i++
+			continue
+		}
+		// A right-to-left embedding also takes the numbers between its
+		// runs, which keep their own order inside it.
+		end := i + 1
+		for end+1 < len(runs) && !runs[end].rtl && !hasStrongLTR(string(runes[runs[end].start:runs[end].end])) && runs[end+1].rtl {
+			end += 2
+		}
+		for k := end - 1; k >= i; k-- {
+			visual = append(visual, runs[k])
+		}
+		i = end
+	}
+	return visual
+}
+
+// visualOrder returns line reordered from logical to visual order with the
+// Unicode bidirectional algorithm, mirroring brackets in right-to-left runs.
+// It is how lines are drawn that cannot be shaped. Lines without
+// right-to-left characters are returned unchanged.
+func visualOrder(line string) string {
+	runes := []rune(line)
+	runs := bidiRuns(runes)
+	if len(runs) == 1 && !runs[0].rtl {
+		return line
+	}
+	var b strings.Builder
+	for _, r := range runs {
+		s := string(runes[r.start:r.end])
+		if r.rtl {
+			s = bidi.ReverseString(s)
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// hasStrongLTR reports whether s contains a strongly left-to-right
+// character, such as a Latin letter.
+func hasStrongLTR(s string) bool {
+	for _, c := range s {
+		if p, _ := bidi.LookupRune(c); p.Class() == bidi.L {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package gopiq
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// dejaVuSans returns the DejaVu Sans font, which has Arabic and Hebrew
+// shaping tables, or skips the test if it is not installed.
+func dejaVuSans(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf")
+	if err != nil {
+		t.Skip("DejaVu Sans is not installed")
+	}
+	return data
+}
+
+// glyphIDs returns the glyphs of run.
+func glyphIDs(run *glyphRun) []sfnt.GlyphIndex {
+	ids := make([]sfnt.GlyphIndex, len(run.glyphs))
+	for i, g := range run.glyphs {
+		ids[i] = g.id
+	}
+	return ids
+}
+
+func TestNeedsShaping(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"hello, world", false},
+		{"Привет 123 καλημέρα", false},
+		{"東京 ソウル 서울", false},
+		{"سلام", true},
+		{"abc שלום", true},
+		{"नमस्ते", true},
+		{"สวัสดี", true},
+	}
+	for _, tc := range tests {
+		if got := needsShaping(tc.text); got != tc.want {
+			t.Errorf("needsShaping(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestShapeLine(t *testing.T) {
+	data := dejaVuSans(t)
+	face, err := newFontFace(data, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+	fnt := face.(*fontFace).src.font
+	var buf sfnt.Buffer
+	nominal := func(r rune) sfnt.GlyphIndex {
+		id, err := fnt.GlyphIndex(&buf, r)
+		if err != nil || id == 0 {
+			t.Fatalf("DejaVu Sans has no glyph for %q", r)
+		}
+		return id
+	}
+
+	// Separate letters keep their isolated forms, in visual order.
+	isolated := glyphIDs(shapeLine(face, "ب ي ت"))
+	if len(isolated) != 5 || isolated[0] != nominal('ت') || isolated[4] != nominal('ب') {
+		t.Fatalf("shapeLine() of separate letters = %v, want isolated forms right to left", isolated)
+	}
+	// Joined letters take their contextual forms.
+	joined := glyphIDs(shapeLine(face, "بيت"))
+	if len(joined) != 3 {
+		t.Fatalf("shapeLine() of a word = %v, want 3 glyphs", joined)
+	}
+	for i, id := range joined {
+		if id == isolated[2*i] {
+			t.Errorf("glyph %d of a joined word is the isolated form %d", i, id)
+		}
+	}
+	// Lam and alef make a ligature.
+	if ids := glyphIDs(shapeLine(face, "لا")); len(ids) != 1 {
+		t.Errorf("shapeLine() of lam-alef = %v, want a single ligature", ids)
+	}
+
+	// Right-to-left runs are reversed inside left-to-right text.
+	mixed := glyphIDs(shapeLine(face, "abc שלום"))
+	if len(mixed) != 8 || mixed[0] != nominal('a') || mixed[4] != nominal('ם') || mixed[7] != nominal('ש') {
+		t.Errorf("shapeLine() of mixed text = %v, want Latin then Hebrew in visual order", mixed)
+	}
+
+	// Marks are placed on their base without advancing.
+	if marked, bare := shapeLine(face, "שָׁ"), shapeLine(face, "ש"); marked.advance != bare.advance || len(marked.glyphs) < 3 {
+		t.Errorf("shapeLine() with marks: advance %v and %d glyphs, want advance %v and the marks as glyphs", marked.advance, len(marked.glyphs), bare.advance)
+	}
+
+	// Lines without complex scripts are drawn rune by rune.
+	if run := shapeLine(face, "hello"); run != nil {
+		t.Error("shapeLine() of Latin text should return nil")
+	}
+
+	// Glyphs missing from the primary font come from the fallback.
+	cfg := &watermarkConfig{Fallbacks: [][]byte{data}}
+	regular, err := fontFor(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFallback, err := cfg.faceWithFallbacks(regular, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer withFallback.Close()
+	run := shapeLine(withFallback, "ab بيت")
+	if len(run.glyphs) != 6 {
+		t.Fatalf("shapeLine() with a fallback = %v, want 6 glyphs", glyphIDs(run))
+	}
+	faces := shapingFaces(withFallback)
+	if run.glyphs[0].face != faces[0] || run.glyphs[5].face != faces[1] {
+		t.Error("Latin glyphs should come from the primary font and Arabic ones from the fallback")
+	}
+	if !slices.Equal(glyphIDs(run)[3:], joined) {
+		t.Errorf("Arabic from the fallback = %v, want %v as with the font itself", glyphIDs(run)[3:], joined)
+	}
+}
+
+func TestAddTextWatermarkShaped(t *testing.T) {
+	data := dejaVuSans(t)
+	img := createTestImage(200, 60)
+	opts := []WatermarkOption{WithFontBytes(data), WithPosition(PositionTopLeft), WithFontSize(28)}
+
+	// The joined word is drawn from its shaped glyphs, which differ from
+	// the separate letters.
+	joined := mustImage(t, New(img).AddTextWatermark("بيت", opts...))
+	separate := mustImage(t, New(img).AddTextWatermark("ب ي ت", opts...))
+	if bytes.Equal(asRGBA(joined).Pix, asRGBA(img).Pix) {
+		t.Fatal("AddTextWatermark() should draw shaped text")
+	}
+	if bytes.Equal(asRGBA(joined).Pix, asRGBA(separate).Pix) {
+		t.Error("joined letters should be drawn differently from separate ones")
+	}
+
+	// Measurements use the shaped glyphs.
+	face, err := newFontFace(data, 28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+	w, _, err := MeasureText("بيت", WithFontBytes(data), WithFontSize(28))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := shapeLine(face, "بيت"); w < fixedToFloat(run.ink.Max.X-run.ink.Min.X)-1 {
+		t.Errorf("MeasureText() = %g, want the width of the shaped glyphs %v", w, run.ink)
+	}
+
+	// Test case: Invalid input
+	if New(img).AddTextWatermark("بيت", WithFontBytes([]byte("not a font"))).Err() == nil {
+		t.Error("AddTextWatermark() with an invalid font should return an error")
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	tests := []struct {
+		name, line, want string
+	}{
+		{"left-to-right text is unchanged", "hello (world)", "hello (world)"},
+		{"right-to-left word in left-to-right text", "abc שלום def", "abc םולש def"},
+		{"right-to-left text with a number", "שלום 123 עולם", "םלוע 123 םולש"},
+		{"embedded numbers stay in the right-to-left run", "x שלום 12 עולם", "x םלוע 12 םולש"},
+		{"brackets are mirrored", "שלום (abc) עולם!", "!םלוע (abc) םולש"},
+		{"bracketed right-to-left word", "a (שלום) b", "a (םולש) b"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := visualOrder(tc.line); got != tc.want {
+				t.Errorf("visualOrder(%q) = %q, want %q", tc.line, got, tc.want)
+			}
+		})
+	}
+
+	// Watermark layout shapes lines in complex scripts and leaves the
+	// others to be drawn rune by rune.
+	face, err := newFontFace(goregular.TTF, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+	block := layoutText(face, &watermarkConfig{Text: "abc שלום\nabc"})
+	if block.runs[0] == nil || block.runs[1] != nil {
+		t.Errorf("layoutText() runs = %v, want only the first line shaped", block.runs)
+	}
+}
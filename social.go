@@ -0,0 +1,176 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// SocialFormat describes the exact output dimensions a social platform
+// expects and the region that is guaranteed not to be covered by platform UI
+// (profile pictures, buttons, captions).
+type SocialFormat struct {
+	Width    int
+	Height   int
+	SafeZone image.Rectangle // In output pixel coordinates
+}
+
+// socialPresets encodes the platform specifications used by SocialPreset.
+var socialPresets = map[string]SocialFormat{
+	// Stories reserve roughly 250px at the top and bottom for UI.
+	"instagram_story":    {1080, 1920, image.Rect(0, 250, 1080, 1670)},
+	"instagram_post":     {1080, 1080, image.Rect(0, 0, 1080, 1080)},
+	"instagram_portrait": {1080, 1350, image.Rect(0, 0, 1080, 1350)},
+	// Open Graph previews are cropped to a 1.91:1 center area by some clients.
+	"og_image":     {1200, 630, image.Rect(60, 15, 1140, 615)},
+	"twitter_card": {1200, 675, image.Rect(0, 23, 1200, 652)},
+	// The cover photo is shown cropped to 640px wide on mobile.
+	"facebook_cover":    {820, 312, image.Rect(90, 0, 730, 312)},
+	"linkedin_post":     {1200, 627, image.Rect(0, 0, 1200, 627)},
+	"youtube_thumbnail": {1280, 720, image.Rect(0, 0, 1100, 640)}, // Duration badge sits bottom-right
+}
+
+// LookupSocialPreset returns the format registered under name.
+func LookupSocialPreset(name string) (SocialFormat, bool) {
+	f, ok := socialPresets[name]
+	return f, ok
+}
+
+// SocialPresetNames returns the names of all available social presets in
+// alphabetical order.
+func SocialPresetNames() []string {
+	names := make([]string, 0, len(socialPresets))
+	for name := range socialPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// socialConfig holds configuration for SocialPreset.
+type socialConfig struct {
+	Letterbox  bool
+	Background color.Color
+	Guides     bool
+}
+
+// SocialOption is a functional option for configuring SocialPreset.
+type SocialOption func(*socialConfig)
+
+// WithLetterbox fits the whole image inside the target format and pads the
+// remaining area with bg instead of cropping.
+func WithLetterbox(bg color.Color) SocialOption {
+	return func(sc *socialConfig) { sc.Letterbox = true; sc.Background = bg }
+}
+
+// WithSafeZoneGuides overlays the platform's unsafe area in translucent red
+// and outlines the safe zone. Intended for debugging layouts only.
+func WithSafeZoneGuides() SocialOption {
+	return func(sc *socialConfig) { sc.Guides = true }
+}
+
+// SocialPreset crops (or, with WithLetterbox, pads) and resizes the image to
+// the exact dimensions of a social platform format such as "instagram_story",
+// "og_image" or "twitter_card". See SocialPresetNames for the full list.
+// Returns the ImageProcessor for chaining. An error is set if the preset name
+// is unknown or the letterbox color is nil.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) SocialPreset(name string, options ...SocialOption) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	format, ok := socialPresets[name]
+	if !ok {
+		ip.err = fmt.Errorf("unknown social preset %q", name)
+		return ip
+	}
+
+	cfg := &socialConfig{Background: color.Black}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	if cfg.Letterbox && cfg.Background == nil {
+		ip.err = fmt.Errorf("letterbox color cannot be nil")
+		return ip
+	}
+
+	dstRect := image.Rect(0, 0, format.Width, format.Height)
+	dst := newRGBA(dstRect)
+	src := ip.currentImage
+	srcBounds := src.Bounds()
+
+	if cfg.Letterbox {
+		draw.Draw(dst, dstRect, image.NewUniform(cfg.Background), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, fitRect(srcBounds.Size(), dstRect), src, srcBounds, draw.Over, nil)
+	} else {
+		draw.CatmullRom.Scale(dst, dstRect, src, coverRect(srcBounds, dstRect.Size()), draw.Src, nil)
+	}
+
+	if cfg.Guides {
+		drawSafeZoneGuides(dst, format.SafeZone)
+	}
+
+	ip.currentImage = dst
+	ip.record("SocialPreset")
+	return ip
+}
+
+// fitRect returns the largest rectangle with the aspect ratio of size that
+// fits centered inside dst.
+func fitRect(size image.Point, dst image.Rectangle) image.Rectangle {
+	w, h := dst.Dx(), dst.Dy()
+	if size.X*h > size.Y*w {
+		h = max(1, size.Y*w/size.X)
+	} else {
+		w = max(1, size.X*h/size.Y)
+	}
+	x := dst.Min.X + (dst.Dx()-w)/2
+	y := dst.Min.Y + (dst.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// coverRect returns the largest centered sub-rectangle of src that has the
+// aspect ratio of size, i.e. the source area to scale for a crop-to-fill.
+func coverRect(src image.Rectangle, size image.Point) image.Rectangle {
+	w, h := src.Dx(), src.Dy()
+	if w*size.Y > h*size.X {
+		w = max(1, h*size.X/size.Y)
+	} else {
+		h = max(1, w*size.Y/size.X)
+	}
+	x := src.Min.X + (src.Dx()-w)/2
+	y := src.Min.Y + (src.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// drawSafeZoneGuides tints everything outside safe and outlines it.
+func drawSafeZoneGuides(dst *image.RGBA, safe image.Rectangle) {
+	tint := image.NewUniform(color.NRGBA{255, 0, 0, 80})
+	outline := image.NewUniform(color.RGBA{255, 0, 0, 255})
+	b := dst.Bounds()
+
+	for _, r := range []image.Rectangle{
+		image.Rect(b.Min.X, b.Min.Y, b.Max.X, safe.Min.Y),
+		image.Rect(b.Min.X, safe.Max.Y, b.Max.X, b.Max.Y),
+		image.Rect(b.Min.X, safe.Min.Y, safe.Min.X, safe.Max.Y),
+		image.Rect(safe.Max.X, safe.Min.Y, b.Max.X, safe.Max.Y),
+	} {
+		draw.Draw(dst, r.Intersect(b), tint, image.Point{}, draw.Over)
+	}
+
+	inner := safe.Inset(1)
+	for _, r := range []image.Rectangle{
+		image.Rect(safe.Min.X, safe.Min.Y, safe.Max.X, inner.Min.Y),
+		image.Rect(safe.Min.X, inner.Max.Y, safe.Max.X, safe.Max.Y),
+		image.Rect(safe.Min.X, safe.Min.Y, inner.Min.X, safe.Max.Y),
+		image.Rect(inner.Max.X, safe.Min.Y, safe.Max.X, safe.Max.Y),
+	} {
+		draw.Draw(dst, r.Intersect(b), outline, image.Point{}, draw.Src)
+	}
+}
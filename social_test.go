@@ -0,0 +1,68 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSocialPreset(t *testing.T) {
+	originalImg := createTestImage(400, 300)
+
+	for _, name := range SocialPresetNames() {
+		format, ok := LookupSocialPreset(name)
+		if !ok {
+			t.Fatalf("LookupSocialPreset(%q) should find a listed preset", name)
+		}
+		if !format.SafeZone.In(image.Rect(0, 0, format.Width, format.Height)) {
+			t.Errorf("Preset %q safe zone %v exceeds its %dx%d canvas", name, format.SafeZone, format.Width, format.Height)
+		}
+
+		proc := New(originalImg).SocialPreset(name)
+		if proc.Err() != nil {
+			t.Fatalf("SocialPreset(%q) should not error, got: %v", name, proc.Err())
+		}
+		if size := proc.currentImage.Bounds().Size(); size != (image.Point{format.Width, format.Height}) {
+			t.Errorf("SocialPreset(%q) produced %v, want %dx%d", name, size, format.Width, format.Height)
+		}
+	}
+
+	// Letterboxing pads a wide image with the background color.
+	bg := color.RGBA{0, 0, 255, 255}
+	proc := New(originalImg).SocialPreset("instagram_story", WithLetterbox(bg))
+	if proc.Err() != nil {
+		t.Fatalf("SocialPreset with letterbox should not error, got: %v", proc.Err())
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(540, 5)); got != bg {
+		t.Errorf("Letterboxed story top edge = %v, want background %v", got, bg)
+	}
+
+	// Guides tint the unsafe area.
+	white := image.NewRGBA(image.Rect(0, 0, 108, 192))
+	for i := range white.Pix {
+		white.Pix[i] = 255
+	}
+	proc = New(white).SocialPreset("instagram_story", WithSafeZoneGuides())
+	r, g, _, _ := proc.currentImage.At(540, 100).RGBA()
+	if r>>8 != 255 || g>>8 == 255 {
+		t.Errorf("Safe zone guides should tint the unsafe area red, got r=%d g=%d", r>>8, g>>8)
+	}
+	if got := color.RGBAModel.Convert(proc.currentImage.At(540, 960)); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Safe zone guides should leave the safe area untouched, got %v", got)
+	}
+
+	// Test case: Unknown preset
+	if New(originalImg).SocialPreset("myspace_banner").Err() == nil {
+		t.Error("SocialPreset() with unknown name should return an error")
+	}
+
+	// Test case: Nil letterbox color
+	if New(originalImg).SocialPreset("og_image", WithLetterbox(nil)).Err() == nil {
+		t.Error("SocialPreset() with a nil letterbox color should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).SocialPreset("og_image").Err() == nil {
+		t.Fatal("SocialPreset() on a processor with prior error should propagate that error")
+	}
+}
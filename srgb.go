@@ -0,0 +1,547 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+)
+
+// ConvertToSRGB converts the pixels from the color space of the ICC profile
+// read by FromBytes or FromReaderAt, such as Display P3, Adobe RGB or a CMYK
+// press profile, to the sRGB that operations and output without a profile
+// assume, and drops the profile. Call it before other operations, as they
+// treat the pixels as sRGB. Images without a profile are taken to be sRGB
+// already and left as they are. Alpha is preserved.
+// Returns the ImageProcessor for chaining. An error is set if the profile is
+// malformed or not supported, or if a CMYK profile is applied to an image
+// that is no longer CMYK. RGB, gray and CMYK profiles are supported, with
+// matrix and tone curves or lookup tables.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ConvertToSRGB() *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if ip.meta.icc == nil {
+		return ip
+	}
+	t, err := parseICC(ip.meta.icc)
+	if err != nil {
+		ip.err = fmt.Errorf("unsupported ICC profile: %w", err)
+		return ip
+	}
+
+	switch t.space {
+	case "CMYK":
+		src, ok := ip.currentImage.(*image.CMYK)
+		if !ok {
+			ip.err = fmt.Errorf("CMYK profile cannot be applied to a %T image", ip.currentImage)
+			return ip
+		}
+		bounds := src.Bounds()
+		dst := image.NewRGBA(bounds)
+		width := bounds.Dx()
+		if err := ip.processRowsErr(width, bounds.Dy(), func(startRow, endRow int) error {
+			for y := startRow; y < endRow; y++ {
+				srcRow := src.Pix[y*src.Stride : y*src.Stride+width*4]
+				dstRow := dst.Pix[y*dst.Stride : y*dst.Stride+width*4]
+				for i := 0; i < len(srcRow); i += 4 {
+					rgb := xyzToSRGB(t.toXYZ([4]float64{
+						float64(srcRow[i]) / 255, float64(srcRow[i+1]) / 255, float64(srcRow[i+2]) / 255, float64(srcRow[i+3]) / 255,
+					}))
+					copy(dstRow[i:], rgb[:])
+					dstRow[i+3] = 255
+				}
+			}
+			return nil
+		}); err != nil {
+			ip.err = err
+			return ip
+		}
+		ip.currentImage = dst
+	case "GRAY":
+		dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+			// The luma weights of color.GrayModel.
+			y := (19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16
+			rgb := xyzToSRGB(t.toXYZ([4]float64{float64(y) / 255}))
+			return rgb[0], rgb[1], rgb[2]
+		})
+		if err != nil {
+			ip.err = err
+			return ip
+		}
+		ip.currentImage = dst
+	default:
+		dst, err := ip.mapColors(func(r, g, b uint8) (uint8, uint8, uint8) {
+			rgb := xyzToSRGB(t.toXYZ([4]float64{float64(r) / 255, float64(g) / 255, float64(b) / 255}))
+			return rgb[0], rgb[1], rgb[2]
+		})
+		if err != nil {
+			ip.err = err
+			return ip
+		}
+		ip.currentImage = dst
+	}
+	ip.meta.icc = nil
+	ip.record("ConvertToSRGB")
+	return ip
+}
+
+// iccTransform converts the colors of an ICC profile's color space to the
+// XYZ profile connection space, relative to the D50 white point.
+type iccTransform struct {
+	space string                         // The data color space: "RGB ", "GRAY" or "CMYK"
+	toXYZ func(in [4]float64) [3]float64 // Components in [0, 1]
+}
+
+// iccChannels maps the supported data color spaces of ICC profiles to their
+// number of components.
+var iccChannels = map[string]int{"GRAY": 1, "RGB ": 3, "CMYK": 4}
+
+// d50White is the XYZ of the D50 white point of the profile connection
+// space.
+var d50White = [3]float64{0.9642, 1, 0.8249}
+
+// parseICC returns the transform of an ICC profile: its perceptual lookup
+// table (A2B0) if it has one, or else its matrix and tone curves (RGB) or
+// tone curve (gray).
+func parseICC(icc []byte) (*iccTransform, error) {
+	if !validICC(icc) {
+		return nil, fmt.Errorf("missing profile header")
+	}
+	t := &iccTransform{space: iccColorSpace(icc)}
+	channels, ok := iccChannels[t.space]
+	if !ok {
+		return nil, fmt.Errorf("color space %q", t.space)
+	}
+	pcs := string(icc[20:24])
+	if pcs != "XYZ " && pcs != "Lab " {
+		return nil, fmt.Errorf("profile connection space %q", pcs)
+	}
+	if len(icc) < 132 {
+		return nil, fmt.Errorf("missing tag table")
+	}
+	n := int64(binary.BigEndian.Uint32(icc[128:]))
+	if 132+12*n > int64(len(icc)) {
+		return nil, fmt.Errorf("tag table of %d tags is truncated", n)
+	}
+	tags := make(map[string][]byte, n)
+	for i := range n {
+		e := icc[132+12*i:]
+		off, size := int64(binary.BigEndian.Uint32(e[4:])), int64(binary.BigEndian.Uint32(e[8:]))
+		if off+size <= int64(len(icc)) && size >= 8 {
+			tags[string(e[:4])] = icc[off : off+size]
+		}
+	}
+
+	if a2b0, ok := tags["A2B0"]; ok {
+		lut, legacy, err := parseICCLut(a2b0, channels)
+		if err != nil {
+			return nil, fmt.Errorf("A2B0: %w", err)
+		}
+		t.toXYZ = func(in [4]float64) [3]float64 { return pcsToXYZ(lut(in), pcs == "Lab ", legacy) }
+		return t, nil
+	}
+	switch t.space {
+	case "RGB ":
+		var trc [3]func(float64) float64
+		var cols [3][3]float64
+		for c, name := range []string{"r", "g", "b"} {
+			curve, _, err := parseICCCurve(tags[name+"TRC"])
+			if err != nil {
+				return nil, fmt.Errorf("%sTRC: %w", name, err)
+			}
+			xyz, err := parseICCXYZ(tags[name+"XYZ"])
+			if err != nil {
+				return nil, fmt.Errorf("%sXYZ: %w", name, err)
+			}
+			trc[c], cols[c] = curve, xyz
+		}
+		t.toXYZ = func(in [4]float64) [3]float64 {
+			var out [3]float64
+			for c := range 3 {
+				v := trc[c](in[c])
+				for i := range 3 {
+					out[i] += cols[c][i] * v
+				}
+			}
+			return out
+		}
+	case "GRAY":
+		curve, _, err := parseICCCurve(tags["kTRC"])
+		if err != nil {
+			return nil, fmt.Errorf("kTRC: %w", err)
+		}
+		t.toXYZ = func(in [4]float64) [3]float64 {
+			y := curve(in[0])
+			return [3]float64{d50White[0] * y, y, d50White[2] * y}
+		}
+	default:
+		return nil, fmt.Errorf("%s profile without A2B0 lookup table", t.space)
+	}
+	return t, nil
+}
+
+// s15Fixed16 returns the ICC fixed-point number in b.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parseICCXYZ returns the value of an XYZ tag.
+func parseICCXYZ(b []byte) ([3]float64, error) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("missing or malformed XYZ tag")
+	}
+	return [3]float64{s15Fixed16(b[8:]), s15Fixed16(b[12:]), s15Fixed16(b[16:])}, nil
+}
+
+// iccParaParams maps the function types of parametric curves to their
+// number of parameters.
+var iccParaParams = []int{1, 3, 4, 5, 7}
+
+// parseICCCurve returns the function of a curv or para tag, mapping [0, 1]
+// to [0, 1], and the size of the tag.
+func parseICCCurve(b []byte) (func(float64) float64, int, error) {
+	if len(b) < 12 {
+		return nil, 0, fmt.Errorf("missing or malformed curve")
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		size := 12 + 2*n
+		if size > len(b) {
+			return nil, 0, fmt.Errorf("curve of %d entries is truncated", n)
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, size, nil
+		case 1:
+			g := float64(binary.BigEndian.Uint16(b[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, g) }, size, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(b[12+2*i:])) / 65535
+		}
+		return func(x float64) float64 { return interpolate(table, x) }, size, nil
+	case "para":
+		typ := int(binary.BigEndian.Uint16(b[8:]))
+		if typ >= len(iccParaParams) {
+			return nil, 0, fmt.Errorf("parametric curve of unknown type %d", typ)
+		}
+		size := 12 + 4*iccParaParams[typ]
+		if size > len(b) {
+			return nil, 0, fmt.Errorf("parametric curve is truncated")
+		}
+		// g, a, b, c, d, e, f as in Y = (aX+b)^g + e for X >= d, else cX + f.
+		var p [7]float64
+		for i := range iccParaParams[typ] {
+			p[i] = s15Fixed16(b[12+4*i:])
+		}
+		g, a, bb, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch typ {
+		case 0: // X^g
+			a, d = 1, math.Inf(-1)
+		case 1: // (aX+b)^g for X >= -b/a, else 0
+			d = -bb / a
+		case 2: // (aX+b)^g + c for X >= -b/a, else c
+			d, e, f, c = -bb/a, c, c, 0
+		}
+		return func(x float64) float64 {
+			if x >= d {
+				return math.Pow(max(a*x+bb, 0), g) + e
+			}
+			return c*x + f
+		}, size, nil
+	default:
+		return nil, 0, fmt.Errorf("curve of unknown type %q", b[:4])
+	}
+}
+
+// interpolate returns the value at x in [0, 1] of the curve sampled evenly
+// by table.
+func interpolate(table []float64, x float64) float64 {
+	pos := min(max(x, 0), 1) * float64(len(table)-1)
+	i := min(int(pos), len(table)-2)
+	return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+}
+
+// iccCLUT is the color lookup table of an ICC lut tag, with 3 outputs.
+type iccCLUT struct {
+	grid  []int     // Grid points of each input, the first varying slowest
+	table []float64 // Outputs in [0, 1]
+}
+
+// newICCCLUT reads a table with grid points per input of 3 outputs of the
+// given size in bytes from b, reporting whether b holds it.
+func newICCCLUT(b []byte, grid []int, bytesPer int) (*iccCLUT, bool) {
+	n := 3
+	for _, g := range grid {
+		if g < 2 {
+			return nil, false
+		}
+		n *= g
+	}
+	if n*bytesPer > len(b) {
+		return nil, false
+	}
+	c := &iccCLUT{grid: grid, table: make([]float64, n)}
+	for i := range c.table {
+		if bytesPer == 1 {
+			c.table[i] = float64(b[i]) / 255
+		} else {
+			c.table[i] = float64(binary.BigEndian.Uint16(b[2*i:])) / 65535
+		}
+	}
+	return c, true
+}
+
+// lookup returns the outputs at the inputs in [0, 1], interpolated
+// multilinearly between the grid points.
+func (c *iccCLUT) lookup(in [4]float64) [3]float64 {
+	var idx, stride [4]int
+	var frac [4]float64
+	s := 3
+	for d := len(c.grid) - 1; d >= 0; d-- {
+		pos := min(max(in[d], 0), 1) * float64(c.grid[d]-1)
+		idx[d] = min(int(pos), c.grid[d]-2)
+		frac[d], stride[d] = pos-float64(idx[d]), s
+		s *= c.grid[d]
+	}
+	var out [3]float64
+	for corner := range 1 << len(c.grid) {
+		w, off := 1.0, 0
+		for d := range c.grid {
+			if corner>>d&1 == 1 {
+				w *= frac[d]
+				off += (idx[d] + 1) * stride[d]
+			} else {
+				w *= 1 - frac[d]
+				off += idx[d] * stride[d]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+		for i := range 3 {
+			out[i] += w * c.table[off+i]
+		}
+	}
+	return out
+}
+
+// parseICCLut returns the function of an mft1, mft2 or mAB lut tag with
+// the given number of inputs, mapping them to the encoded profile
+// connection space in [0, 1], and whether that uses the legacy 16-bit Lab
+// encoding of ICC version 2.
+func parseICCLut(b []byte, channels int) (func([4]float64) [3]float64, bool, error) {
+	if len(b) < 32 {
+		return nil, false, fmt.Errorf("lookup table is truncated")
+	}
+	if int(b[8]) != channels || b[9] != 3 {
+		return nil, false, fmt.Errorf("lookup table maps %d to %d channels, want %d to 3", b[8], b[9], channels)
+	}
+	switch typ := string(b[:4]); typ {
+	case "mft1", "mft2":
+		// Input tables, the table and output tables, of 8 or 16 bits. The
+		// matrix only applies to XYZ input.
+		inEntries, outEntries, bytesPer, off := 256, 256, 1, 48
+		if typ == "mft2" {
+			if len(b) < 52 {
+				return nil, false, fmt.Errorf("lookup table is truncated")
+			}
+			inEntries, outEntries = int(binary.BigEndian.Uint16(b[48:])), int(binary.BigEndian.Uint16(b[50:]))
+			bytesPer, off = 2, 52
+		}
+		if inEntries < 2 || outEntries < 2 {
+			return nil, false, fmt.Errorf("lookup table curves have too few entries")
+		}
+		readTables := func(count, entries int) ([][]float64, bool) {
+			if off+count*entries*bytesPer > len(b) {
+				return nil, false
+			}
+			tables := make([][]float64, count)
+			for i := range tables {
+				tables[i] = make([]float64, entries)
+				for j := range tables[i] {
+					if bytesPer == 1 {
+						tables[i][j] = float64(b[off]) / 255
+					} else {
+						tables[i][j] = float64(binary.BigEndian.Uint16(b[off:])) / 65535
+					}
+					off += bytesPer
+				}
+			}
+			return tables, true
+		}
+		inTables, ok := readTables(channels, inEntries)
+		if !ok {
+			return nil, false, fmt.Errorf("lookup table input curves are truncated")
+		}
+		grid := make([]int, channels)
+		for i := range grid {
+			grid[i] = int(b[10])
+		}
+		clut, ok := newICCCLUT(b[off:], grid, bytesPer)
+		if !ok {
+			return nil, false, fmt.Errorf("lookup table of %d grid points is truncated", b[10])
+		}
+		off += len(clut.table) * bytesPer
+		outTables, ok := readTables(3, outEntries)
+		if !ok {
+			return nil, false, fmt.Errorf("lookup table output curves are truncated")
+		}
+		return func(in [4]float64) [3]float64 {
+			for i := range channels {
+				in[i] = interpolate(inTables[i], in[i])
+			}
+			out := clut.lookup(in)
+			for i := range out {
+				out[i] = interpolate(outTables[i], out[i])
+			}
+			return out
+		}, typ == "mft2", nil
+	case "mAB ":
+		// A curves, the table, M curves, the matrix and B curves, each
+		// optional but for the B curves.
+		curves := func(at uint32, count int) ([]func(float64) float64, error) {
+			if at == 0 {
+				return nil, nil
+			}
+			fns := make([]func(float64) float64, count)
+			for i := range fns {
+				if int64(at) >= int64(len(b)) {
+					return nil, fmt.Errorf("lookup table curves are truncated")
+				}
+				fn, size, err := parseICCCurve(b[at:])
+				if err != nil {
+					return nil, err
+				}
+				fns[i], at = fn, at+uint32(size+3)&^3
+			}
+			return fns, nil
+		}
+		offB, offMatrix, offM := binary.BigEndian.Uint32(b[12:]), binary.BigEndian.Uint32(b[16:]), binary.BigEndian.Uint32(b[20:])
+		offCLUT, offA := binary.BigEndian.Uint32(b[24:]), binary.BigEndian.Uint32(b[28:])
+		if offB == 0 {
+			return nil, false, fmt.Errorf("lookup table without B curves")
+		}
+		bCurves, err := curves(offB, 3)
+		if err != nil {
+			return nil, false, err
+		}
+		aCurves, err := curves(offA, channels)
+		if err != nil {
+			return nil, false, err
+		}
+		mCurves, err := curves(offM, 3)
+		if err != nil {
+			return nil, false, err
+		}
+		var clut *iccCLUT
+		if offCLUT != 0 {
+			if int64(offCLUT)+20 > int64(len(b)) {
+				return nil, false, fmt.Errorf("lookup table is truncated")
+			}
+			grid := make([]int, channels)
+			for i := range grid {
+				grid[i] = int(b[offCLUT+uint32(i)])
+			}
+			precision := int(b[offCLUT+16])
+			if precision != 1 && precision != 2 {
+				return nil, false, fmt.Errorf("lookup table grid of %d-byte values", precision)
+			}
+			var ok bool
+			if clut, ok = newICCCLUT(b[offCLUT+20:], grid, precision); !ok {
+				return nil, false, fmt.Errorf("lookup table grid is truncated")
+			}
+		} else if channels != 3 {
+			return nil, false, fmt.Errorf("lookup table without grid maps %d channels", channels)
+		}
+		var matrix []float64
+		if offMatrix != 0 {
+			if int64(offMatrix)+48 > int64(len(b)) {
+				return nil, false, fmt.Errorf("lookup table matrix is truncated")
+			}
+			matrix = make([]float64, 12)
+			for i := range matrix {
+				matrix[i] = s15Fixed16(b[offMatrix+4*uint32(i):])
+			}
+		}
+		return func(in [4]float64) [3]float64 {
+			for i, fn := range aCurves {
+				in[i] = fn(in[i])
+			}
+			out := [3]float64{in[0], in[1], in[2]}
+			if clut != nil {
+				out = clut.lookup(in)
+			}
+			for i, fn := range mCurves {
+				out[i] = fn(out[i])
+			}
+			if matrix != nil {
+				// A 3x3 matrix followed by offsets.
+				var m [3]float64
+				for i := range 3 {
+					m[i] = matrix[3*i]*out[0] + matrix[3*i+1]*out[1] + matrix[3*i+2]*out[2] + matrix[9+i]
+				}
+				out = m
+			}
+			for i, fn := range bCurves {
+				out[i] = fn(out[i])
+			}
+			return out
+		}, false, nil
+	default:
+		return nil, false, fmt.Errorf("lookup table of unknown type %q", typ)
+	}
+}
+
+// pcsToXYZ returns the D50 XYZ of the encoded profile connection space
+// values of a lookup table.
+func pcsToXYZ(v [3]float64, lab, legacy bool) [3]float64 {
+	if !lab {
+		// u1Fixed15 numbers: 0xffff is 1 + 32767/32768.
+		return [3]float64{v[0] * 65535 / 32768, v[1] * 65535 / 32768, v[2] * 65535 / 32768}
+	}
+	if legacy {
+		// 0xff00 is 100 for L* and 127 for a* and b*.
+		for i := range v {
+			v[i] *= 65535.0 / 65280
+		}
+	}
+	l, a, b := v[0]*100, v[1]*255-128, v[2]*255-128
+	fy := (l + 16) / 116
+	f := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * 36.0 / 841 * (t - 4.0/29)
+	}
+	return [3]float64{d50White[0] * f(fy+a/500), d50White[1] * f(fy), d50White[2] * f(fy-b/200)}
+}
+
+// xyzToSRGB returns the 8-bit sRGB color of a D50 XYZ color, adapted to the
+// D65 white point of sRGB with the Bradford transform and clipped to the
+// sRGB gamut.
+func xyzToSRGB(xyz [3]float64) [3]uint8 {
+	m := [3][3]float64{
+		{3.1338561, -1.6168667, -0.4906146},
+		{-0.9787684, 1.9161415, 0.0334540},
+		{0.0719453, -0.2289914, 1.4052427},
+	}
+	var out [3]uint8
+	for i, row := range m {
+		v := min(max(row[0]*xyz[0]+row[1]*xyz[1]+row[2]*xyz[2], 0), 1)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		out[i] = clampUint8(v * 255)
+	}
+	return out
+}
@@ -0,0 +1,227 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// iccTag is a tag of a profile built by buildICC.
+type iccTag struct {
+	sig  string
+	data []byte
+}
+
+// buildICC returns an ICC profile of the data color space and profile
+// connection space with the tags.
+func buildICC(space, pcs string, tags ...iccTag) []byte {
+	header := make([]byte, 128)
+	copy(header[16:], space)
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	for _, t := range tags {
+		off := 128 + 4 + 12*len(tags) + len(data)
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(off))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		data = append(data, t.data...)
+		data = append(data, make([]byte, -len(data)&3)...)
+	}
+	icc := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(icc, uint32(len(icc)))
+	return icc
+}
+
+func iccFixed(b []byte, vs ...float64) []byte {
+	for _, v := range vs {
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
+
+func iccXYZTag(x, y, z float64) []byte {
+	return iccFixed([]byte("XYZ \x00\x00\x00\x00"), x, y, z)
+}
+
+// iccSRGBCurve is the sRGB tone curve as a parametric curve.
+var iccSRGBCurve = iccFixed([]byte("para\x00\x00\x00\x00\x00\x03\x00\x00"), 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+// iccIdentityCurve is a curve that leaves values as they are.
+var iccIdentityCurve = []byte("curv\x00\x00\x00\x00\x00\x00\x00\x00")
+
+// displayP3 is a Display P3 profile: the P3 primaries adapted to D50, with
+// the sRGB tone curve.
+var displayP3 = buildICC("RGB ", "XYZ ",
+	iccTag{"rXYZ", iccXYZTag(0.515102, 0.241182, -0.001050)},
+	iccTag{"gXYZ", iccXYZTag(0.291965, 0.692236, 0.041882)},
+	iccTag{"bXYZ", iccXYZTag(0.157153, 0.066582, 0.784168)},
+	iccTag{"rTRC", iccSRGBCurve}, iccTag{"gTRC", iccSRGBCurve}, iccTag{"bTRC", iccSRGBCurve},
+)
+
+// cmykLab returns the L*a*b* a test CMYK profile maps a corner of its
+// lookup table to: cyan ink is cyan, black ink is black, and other inks
+// darken without color.
+func cmykLab(c, m, y, k int) [3]float64 {
+	if k == 1 {
+		return [3]float64{0, 0, 0}
+	}
+	if c == 1 && m == 0 && y == 0 {
+		return [3]float64{55, -37, -50}
+	}
+	return [3]float64{100 * (1 - 0.3*float64(c+m+y)), 0, 0}
+}
+
+// cmykGrid returns the 16-bit lookup table of cmykLab on a grid of 2 points
+// per ink, encoding L* as scale*L/100 and a* and b* as scale*(a+128)/255.
+func cmykGrid(scale float64) []byte {
+	var b []byte
+	for i := range 16 {
+		lab := cmykLab(i>>3&1, i>>2&1, i>>1&1, i&1)
+		for _, v := range []float64{lab[0] / 100, (lab[1] + 128) / 255, (lab[2] + 128) / 255} {
+			b = binary.BigEndian.AppendUint16(b, uint16(math.Round(v*scale)))
+		}
+	}
+	return b
+}
+
+// cmykLUTs are lookup tables of CMYK profiles mapping to cmykLab: an ICC
+// version 2 lut16Type and a version 4 lutAtoBType.
+var cmykLUTs = func() map[string][]byte {
+	mft2 := []byte("mft2\x00\x00\x00\x00\x04\x03\x02\x00")
+	mft2 = iccFixed(mft2, 1, 0, 0, 0, 1, 0, 0, 0, 1)
+	mft2 = append(mft2, 0, 2, 0, 2) // Two entries per curve
+	for range 4 {
+		mft2 = append(mft2, 0, 0, 0xff, 0xff)
+	}
+	mft2 = append(mft2, cmykGrid(65280)...)
+	for range 3 {
+		mft2 = append(mft2, 0, 0, 0xff, 0xff)
+	}
+
+	mAB := []byte("mAB \x00\x00\x00\x00\x04\x03\x00\x00")
+	bAt, clutAt := 32, 32+3*len(iccIdentityCurve)
+	aAt := clutAt + 20 + len(cmykGrid(65535))
+	mAB = binary.BigEndian.AppendUint32(mAB, uint32(bAt))
+	mAB = append(mAB, make([]byte, 8)...) // No matrix or M curves
+	mAB = binary.BigEndian.AppendUint32(mAB, uint32(clutAt))
+	mAB = binary.BigEndian.AppendUint32(mAB, uint32(aAt))
+	for range 3 {
+		mAB = append(mAB, iccIdentityCurve...)
+	}
+	mAB = append(mAB, 2, 2, 2, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0)
+	mAB = append(mAB, cmykGrid(65535)...)
+	for range 4 {
+		mAB = append(mAB, iccIdentityCurve...)
+	}
+	return map[string][]byte{"mft2": mft2, "mAB": mAB}
+}()
+
+// p3ToSRGB returns the sRGB value of a Display P3 color, converting between
+// the linear values of the D65 primaries.
+func p3ToSRGB(p3 [3]uint8) [3]float64 {
+	m := [3][3]float64{{1.2249, -0.2247, 0}, {-0.0420, 1.0419, 0}, {-0.0197, -0.0786, 1.0979}}
+	var lin [3]float64
+	for i, v := range p3 {
+		if x := float64(v) / 255; x <= 0.04045 {
+			lin[i] = x / 12.92
+		} else {
+			lin[i] = math.Pow((x+0.055)/1.055, 2.4)
+		}
+	}
+	var out [3]float64
+	for i, row := range m {
+		if v := min(max(row[0]*lin[0]+row[1]*lin[1]+row[2]*lin[2], 0), 1); v <= 0.0031308 {
+			out[i] = v * 12.92 * 255
+		} else {
+			out[i] = (1.055*math.Pow(v, 1/2.4) - 0.055) * 255
+		}
+	}
+	return out
+}
+
+func TestConvertToSRGB(t *testing.T) {
+	// Display P3, read from a PNG.
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	p3 := [][3]uint8{{200, 100, 50}, {128, 128, 128}, {40, 180, 220}}
+	for x, c := range p3 {
+		img.SetRGBA(x, 0, color.RGBA{c[0], c[1], c[2], 255})
+	}
+	data, err := embedICC(mustBytes(t, New(img), FormatPNG), FormatPNG, displayP3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := FromBytes(data).ConvertToSRGB()
+	out := mustImage(t, proc)
+	for x, c := range p3 {
+		want := p3ToSRGB(c)
+		got := color.RGBAModel.Convert(out.At(x, 0)).(color.RGBA)
+		if math.Abs(float64(got.R)-want[0]) > 1.5 || math.Abs(float64(got.G)-want[1]) > 1.5 || math.Abs(float64(got.B)-want[2]) > 1.5 {
+			t.Errorf("ConvertToSRGB() of Display P3 %v = %v, want %.1f", c, got, want)
+		}
+	}
+	if proc.meta.icc != nil || metadataOf(mustBytes(t, proc, FormatPNG)).icc != nil {
+		t.Error("ConvertToSRGB() should drop the profile, as the pixels are sRGB")
+	}
+
+	// CMYK, as decoded from a press-ready JPEG.
+	cmyk := image.NewCMYK(image.Rect(0, 0, 4, 1))
+	inks := []color.CMYK{{0, 0, 0, 0}, {0, 0, 0, 255}, {255, 0, 0, 0}, {0, 0, 0, 128}}
+	for x, c := range inks {
+		cmyk.SetCMYK(x, 0, c)
+	}
+	for name, lut := range cmykLUTs {
+		proc := &ImageProcessor{currentImage: cmyk, meta: imageMetadata{icc: buildICC("CMYK", "Lab ", iccTag{"A2B0", lut})}}
+		out := mustImage(t, proc.ConvertToSRGB())
+		px := func(x int) color.RGBA { return color.RGBAModel.Convert(out.At(x, 0)).(color.RGBA) }
+		if px(0) != (color.RGBA{255, 255, 255, 255}) || px(1) != (color.RGBA{0, 0, 0, 255}) {
+			t.Errorf("%s: paper and black ink = %v and %v, want white and black", name, px(0), px(1))
+		}
+		if c := px(2); c.R > 50 || c.G < 120 || c.B < 180 {
+			t.Errorf("%s: cyan ink = %v, want cyan", name, c)
+		}
+		// L* 50 is sRGB 119.
+		if c := px(3); c.R != c.G || c.G != c.B || c.R < 117 || c.R > 121 {
+			t.Errorf("%s: half black ink = %v, want a gray of about 119", name, c)
+		}
+	}
+
+	// Gray, with a linear tone curve.
+	gray := buildICC("GRAY", "XYZ ", iccTag{"kTRC", []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x01\x00")})
+	proc = &ImageProcessor{currentImage: createUniformImage(2, 2, color.RGBA{128, 128, 128, 255}), meta: imageMetadata{icc: gray}}
+	if c := color.RGBAModel.Convert(mustImage(t, proc.ConvertToSRGB()).At(0, 0)).(color.RGBA); c.R != 188 || c.G != 188 {
+		t.Errorf("ConvertToSRGB() of linear gray 128 = %v, want sRGB 188", c)
+	}
+
+	// Images without a profile are sRGB already.
+	plain := New(createUniformImage(2, 2, color.RGBA{10, 20, 30, 255})).ConvertToSRGB()
+	if c := color.RGBAModel.Convert(mustImage(t, plain).At(0, 0)); c != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("ConvertToSRGB() without a profile changed the color to %v", c)
+	}
+
+	// Test case: Invalid input
+	invalid := map[string][]byte{
+		"no tags":      buildICC("RGB ", "XYZ "),
+		"Lab data":     buildICC("Lab ", "Lab "),
+		"CMYK no LUT":  buildICC("CMYK", "Lab "),
+		"bad curve":    buildICC("GRAY", "XYZ ", iccTag{"kTRC", []byte("curv\x00\x00\x00\x00\xff\xff\xff\xff")}),
+		"bad LUT":      buildICC("CMYK", "Lab ", iccTag{"A2B0", []byte("mft2\x00\x00\x00\x00\x04\x03\x02\x00")}),
+		"wrong inputs": buildICC("RGB ", "Lab ", iccTag{"A2B0", cmykLUTs["mft2"]}),
+	}
+	for name, icc := range invalid {
+		proc := &ImageProcessor{currentImage: createUniformImage(2, 2, color.RGBA{1, 2, 3, 255}), meta: imageMetadata{icc: icc}}
+		if _, err := proc.ConvertToSRGB().Image(); err == nil {
+			t.Errorf("ConvertToSRGB() with a profile with %s should set an error", name)
+		}
+	}
+	proc = &ImageProcessor{currentImage: createUniformImage(2, 2, color.RGBA{1, 2, 3, 255}), meta: imageMetadata{icc: buildICC("CMYK", "Lab ", iccTag{"A2B0", cmykLUTs["mft2"]})}}
+	if _, err := proc.ConvertToSRGB().Image(); err == nil {
+		t.Error("ConvertToSRGB() with a CMYK profile for an RGB image should set an error")
+	}
+	if _, err := New(nil).ConvertToSRGB().Image(); err == nil {
+		t.Error("ConvertToSRGB() on a processor with prior error should keep the error")
+	}
+}
@@ -0,0 +1,504 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// fitTextPrecision is the font size resolution (in points) of FitText.
+const fitTextPrecision = 0.25
+
+// FitText finds the largest font size in [minSize, maxSize] at which text,
+// word-wrapped to the width of box, fits inside box. It is meant for
+// templated layouts with variable-length copy, e.g. card titles.
+// The font is taken from opts (WithFontBytes or WithFontName); other watermark options are
+// ignored. An error is returned if the text does not fit even at minSize or
+// the arguments are invalid.
+func FitText(text string, box image.Rectangle, minSize, maxSize float64, opts ...WatermarkOption) (float64, error) {
+	if text == "" {
+		return 0, fmt.Errorf("text cannot be empty")
+	}
+	if box.Empty() {
+		return 0, fmt.Errorf("text box %v is empty", box)
+	}
+	if minSize <= 0 || maxSize < minSize {
+		return 0, fmt.Errorf("invalid font size range [%g, %g]", minSize, maxSize)
+	}
+
+	cfg := defaultWatermarkConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	fnt, err := cfg.font()
+	if err != nil {
+		return 0, err
+	}
+
+	fits := func(size float64) (bool, error) {
+		face, err := cfg.faceWithFallbacks(fnt, size)
+		if err != nil {
+			return false, err
+		}
+		defer face.Close()
+		return textFits(face, text, box), nil
+	}
+
+	ok, err := fits(minSize)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("text does not fit in %v even at the minimum size %g", box, minSize)
+	}
+	if ok, err = fits(maxSize); err != nil || ok {
+		return maxSize, err
+	}
+
+	// Invariant: lo fits, hi does not.
+	lo, hi := minSize, maxSize
+	for hi-lo > fitTextPrecision {
+		mid := (lo + hi) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// MeasureText returns the size in pixels of text laid out by
+// AddTextWatermark with the given options, so callers can work out layouts
+// before rendering, e.g. whether a caption fits or how tall a caption bar
+// must be. Horizontal text measures the ink of its widest line across and
+// the line boxes from the ascent of the first line to the descent of the
+// last down, with WithMaxWidth, WithLineHeight and newlines applied;
+// vertical text measures its column. Text effects are not included.
+// Returns an error if text is empty, the options are invalid (including
+// WithRelativeFontSize, which depends on the image) or the font fails to
+// load.
+func MeasureText(text string, opts ...WatermarkOption) (width, height float64, err error) {
+	if text == "" {
+		return 0, 0, fmt.Errorf("text cannot be empty")
+	}
+	cfg := defaultWatermarkConfig()
+	cfg.Text = text
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return 0, 0, err
+	}
+	if cfg.RelativeFontSize > 0 {
+		return 0, 0, fmt.Errorf("relative font size depends on the image and cannot be measured")
+	}
+
+	face, err := cfg.newFace()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer face.Close()
+
+	if cfg.Vertical {
+		width, height = measureVerticalText(face, cfg.Text)
+		return width, height, nil
+	}
+	frame := layoutText(face, cfg).frame(fixed.Point26_6{})
+	return fixedToFloat(frame.Max.X - frame.Min.X), fixedToFloat(frame.Max.Y - frame.Min.Y), nil
+}
+
+// WatermarkBounds returns the rectangle that AddTextWatermark(text, opts...)
+// would draw into on an image with bounds imgBounds, clipped to the image, so
+// callers can check that a watermark does not cover faces or other regions
+// found by their own detectors. For horizontal text the rectangle is the ink
+// extent of the glyphs, including kerning; for vertical text it is the text
+// column, and with WithTiling it is the whole image. Text effects such as
+// WithStroke, WithTextShadow and WithBackgroundBox are included.
+// Returns an error if text is empty or the options are invalid.
+func WatermarkBounds(text string, imgBounds image.Rectangle, opts ...WatermarkOption) (image.Rectangle, error) {
+	if text == "" {
+		return image.Rectangle{}, fmt.Errorf("watermark text cannot be empty")
+	}
+	cfg := defaultWatermarkConfig()
+	cfg.Text = text
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return image.Rectangle{}, err
+	}
+	if cfg.Tile != nil {
+		return imgBounds, nil
+	}
+	cfg = cfg.scaled(imgBounds)
+
+	face, err := cfg.newFace()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	defer face.Close()
+
+	var r image.Rectangle
+	var frame fixed.Rectangle26_6
+	if cfg.Vertical {
+		w, h := measureVerticalText(face, cfg.Text)
+		fx, fy := cfg.anchor()
+		x, y := cfg.snap(blockOrigin(fx, fy, imgBounds, w, h, cfg.OffsetX, cfg.OffsetY))
+		r = image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Ceil(x+w)), int(math.Ceil(y+h)))
+		frame = columnFrame(x, y, w, h)
+	} else {
+		block := layoutText(face, cfg)
+		dot := textWatermarkDot(block, cfg, imgBounds)
+		r = fixedRect(block.ink.Add(dot))
+		frame = block.frame(dot)
+	}
+	return cfg.textEffectBounds(r, frame).Intersect(imgBounds), nil
+}
+
+// textBlock is horizontal watermark text broken into lines and measured
+// with the baseline origin of the first line at (0, 0).
+type textBlock struct {
+	lines      []string
+	runs       []*glyphRun         // Shaped glyphs of each line, nil for lines drawn rune by rune
+	shifts     []fixed.Int26_6     // Horizontal offset of each line for its alignment
+	ink        fixed.Rectangle26_6 // Union of the ink bounds of all lines
+	advance    fixed.Int26_6       // Largest advance width of a line
+	metrics    font.Metrics
+	lineHeight fixed.Int26_6 // Distance between baselines
+}
+
+// layoutText breaks cfg.Text into lines at newlines and, if cfg.MaxWidth is
+// set, at word boundaries so no line is wider than cfg.MaxWidth. Lines
+// that need it are shaped and right-to-left text is put in visual order.
+func layoutText(face font.Face, cfg *watermarkConfig) *textBlock {
+	metrics := face.Metrics()
+	b := &textBlock{metrics: metrics, lineHeight: metrics.Height}
+	if cfg.LineHeight > 0 {
+		b.lineHeight = floatToFixed(fixedToFloat(metrics.Height) * cfg.LineHeight)
+	}
+	if cfg.MaxWidth > 0 {
+		b.lines = wrapText(face, cfg.Text, cfg.MaxWidth)
+	} else {
+		b.lines = strings.Split(cfg.Text, "\n")
+	}
+	b.runs = make([]*glyphRun, len(b.lines))
+	inks := make([]fixed.Rectangle26_6, len(b.lines))
+	advances := make([]fixed.Int26_6, len(b.lines))
+	var left, right fixed.Int26_6
+	for i, line := range b.lines {
+		if run := shapeLine(face, line); run != nil {
+			b.runs[i] = run
+			inks[i], advances[i] = run.ink, run.advance
+		} else {
+			b.lines[i] = visualOrder(line)
+			inks[i], advances[i] = font.BoundString(face, b.lines[i])
+		}
+		if i == 0 || inks[i].Min.X < left {
+			left = inks[i].Min.X
+		}
+		right = max(right, inks[i].Max.X)
+	}
+
+	b.shifts = make([]fixed.Int26_6, len(b.lines))
+	for i, ink := range inks {
+		if !ink.Empty() {
+			switch cfg.Align {
+			case TextAlignCenter:
+				b.shifts[i] = (left + right - ink.Min.X - ink.Max.X) / 2
+			case TextAlignRight:
+				b.shifts[i] = right - ink.Max.X
+			}
+		}
+		shift := fixed.Point26_6{X: b.shifts[i], Y: b.lineHeight * fixed.Int26_6(i)}
+		b.ink = b.ink.Union(ink.Add(shift))
+		b.advance = max(b.advance, advances[i]+b.shifts[i])
+	}
+	return b
+}
+
+// height returns the height of the block from the ascent of the first line
+// to the descent of the last.
+func (b *textBlock) height() fixed.Int26_6 {
+	return b.metrics.Height + b.lineHeight*fixed.Int26_6(len(b.lines)-1)
+}
+
+// frame returns the measured bounds of the block with the baseline origin
+// of the first line at dot: the ink extent across and the line boxes from
+// the ascent of the first line to the descent of the last down.
+func (b *textBlock) frame(dot fixed.Point26_6) fixed.Rectangle26_6 {
+	return fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: dot.X + b.ink.Min.X, Y: dot.Y - b.metrics.Ascent},
+		Max: fixed.Point26_6{X: dot.X + b.ink.Max.X, Y: dot.Y - b.metrics.Ascent + b.height()},
+	}
+}
+
+// draw draws the lines with dr, placing the baseline origin of the first
+// line at dot.
+func (b *textBlock) draw(dr *font.Drawer, dot fixed.Point26_6) {
+	for i, line := range b.lines {
+		dr.Dot = fixed.Point26_6{X: dot.X + b.shifts[i], Y: dot.Y + b.lineHeight*fixed.Int26_6(i)}
+		if b.runs[i] != nil {
+			b.runs[i].draw(dr.Dst, dr.Src, dr.Dot)
+		} else {
+			dr.DrawString(line)
+		}
+	}
+}
+
+// textFits reports whether text, wrapped to the width of box, fits inside it.
+func textFits(face font.Face, text string, box image.Rectangle) bool {
+	maxWidth := float64(box.Dx())
+	lines := wrapText(face, text, maxWidth)
+	if len(lines)*face.Metrics().Height.Ceil() > box.Dy() {
+		return false
+	}
+	for _, line := range lines {
+		if fixedToFloat(measureLine(face, line)) > maxWidth {
+			return false
+		}
+	}
+	return true
+}
+
+// measureLine returns the advance width of a line of text, shaped if it
+// needs shaping.
+func measureLine(face font.Face, line string) fixed.Int26_6 {
+	if run := shapeLine(face, line); run != nil {
+		return run.advance
+	}
+	return font.MeasureString(face, line)
+}
+
+// wrapText breaks text into lines no wider than maxWidth pixels, breaking at
+// spaces and honoring explicit newlines. Words wider than maxWidth are broken
+// between characters.
+func wrapText(face font.Face, text string, maxWidth float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := ""
+		for _, word := range words {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if fixedToFloat(measureLine(face, candidate)) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Break words that do not fit on a line of their own.
+			for fixedToFloat(measureLine(face, word)) > maxWidth {
+				head := truncateRunes(face, word, maxWidth)
+				lines = append(lines, head)
+				word = word[len(head):]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncateRunes returns the longest prefix of s (at least one rune) that is
+// no wider than maxWidth pixels.
+func truncateRunes(face font.Face, s string, maxWidth float64) string {
+	end := 0
+	for i, r := range s {
+		next := i + len(string(r))
+		if end > 0 && fixedToFloat(measureLine(face, s[:next])) > maxWidth {
+			break
+		}
+		end = next
+	}
+	return s[:end]
+}
+
+// truncateText shortens s with a trailing ellipsis so that it fits within
+// maxWidth pixels. Strings that already fit are returned unchanged.
+func truncateText(face font.Face, s string, maxWidth float64) string {
+	if fixedToFloat(font.MeasureString(face, s)) <= maxWidth {
+		return s
+	}
+	const ellipsis = "…"
+	s = strings.TrimSuffix(s, ellipsis)
+	budget := maxWidth - fixedToFloat(font.MeasureString(face, ellipsis))
+	if budget <= 0 {
+		return ellipsis
+	}
+	return strings.TrimRight(truncateRunes(face, s, budget), " ") + ellipsis
+}
+
+// verticalOrientation describes how a rune is placed in a vertical column.
+type verticalOrientation int
+
+const (
+	verticalUpright     verticalOrientation = iota // Drawn as-is (ideographs, kana, hangul)
+	verticalRotated                                // Rotated 90 degrees clockwise (Latin, digits, dashes)
+	verticalPunctuation                            // Upright, but moved to the top-right of its cell
+)
+
+// verticalRotatedRunes are full-width characters that are conventionally
+// rotated in vertical text even though they belong to CJK blocks.
+var verticalRotatedRunes = map[rune]bool{
+	'ー': true, '〜': true, '～': true, '…': true, '‥': true, '—': true, '―': true,
+	'（': true, '）': true, '「': true, '」': true, '『': true, '』': true,
+	'【': true, '】': true, '〔': true, '〕': true, '《': true, '》': true,
+	'〈': true, '〉': true, '［': true, '］': true, '｛': true, '｝': true,
+}
+
+// verticalPunctuationRunes sit in the bottom-left corner of the em box in
+// horizontal text and move to the top-right corner in vertical text.
+var verticalPunctuationRunes = map[rune]bool{
+	'、': true, '。': true, '，': true, '．': true, '､': true, '｡': true,
+}
+
+// verticalOrientationOf returns the orientation used for r in vertical text.
+func verticalOrientationOf(r rune) verticalOrientation {
+	switch {
+	case verticalRotatedRunes[r]:
+		return verticalRotated
+	case verticalPunctuationRunes[r]:
+		return verticalPunctuation
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo):
+		return verticalUpright
+	case r >= 0x3000 && r <= 0x303F, r >= 0xFF00 && r <= 0xFFEF: // CJK symbols, full-width forms
+		return verticalUpright
+	default:
+		return verticalRotated
+	}
+}
+
+// verticalAdvance returns the distance (in pixels) r occupies along the column.
+func verticalAdvance(face font.Face, r rune) float64 {
+	if verticalOrientationOf(r) == verticalRotated {
+		adv, _ := face.GlyphAdvance(r)
+		return fixedToFloat(adv)
+	}
+	return fixedToFloat(face.Metrics().Height)
+}
+
+// measureVerticalText returns the width and height of text laid out as a
+// single vertical column.
+func measureVerticalText(face font.Face, text string) (width, height float64) {
+	width = fixedToFloat(face.Metrics().Height)
+	for _, r := range text {
+		height += verticalAdvance(face, r)
+	}
+	return width, height
+}
+
+// drawVerticalText draws text top-to-bottom in a single column whose top-left
+// corner is at (x, y).
+func drawVerticalText(dst draw.Image, face font.Face, src image.Image, text string, x, y float64) {
+	metrics := face.Metrics()
+	em := fixedToFloat(metrics.Height)
+	ascent := fixedToFloat(metrics.Ascent)
+
+	dr := &font.Drawer{Dst: dst, Src: src, Face: face}
+	for _, r := range text {
+		adv := verticalAdvance(face, r)
+		switch verticalOrientationOf(r) {
+		case verticalRotated:
+			drawRotatedGlyph(dst, face, src, r, x, y)
+		case verticalPunctuation:
+			glyphAdv, _ := face.GlyphAdvance(r)
+			dr.Dot = fixed.Point26_6{
+				X: floatToFixed(x + (em-fixedToFloat(glyphAdv))/2 + em/2),
+				Y: floatToFixed(y + ascent - em/2),
+			}
+			dr.DrawString(string(r))
+		default:
+			glyphAdv, _ := face.GlyphAdvance(r)
+			dr.Dot = fixed.Point26_6{
+				X: floatToFixed(x + (em-fixedToFloat(glyphAdv))/2),
+				Y: floatToFixed(y + ascent),
+			}
+			dr.DrawString(string(r))
+		}
+		y += adv
+	}
+}
+
+// drawRotatedGlyph renders r horizontally into an alpha mask, rotates the mask
+// 90 degrees clockwise and composites it with its top-left corner at (x, y).
+func drawRotatedGlyph(dst draw.Image, face font.Face, src image.Image, r rune, x, y float64) {
+	metrics := face.Metrics()
+	adv, _ := face.GlyphAdvance(r)
+	w := adv.Ceil()
+	h := metrics.Height.Ceil()
+	if w <= 0 || h <= 0 {
+		return
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	dr := &font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	dr.DrawString(string(r))
+
+	// Rotate clockwise: the glyph's baseline runs downwards and its top faces right.
+	rotated := image.NewAlpha(image.Rect(0, 0, h, w))
+	for my := 0; my < h; my++ {
+		for mx := 0; mx < w; mx++ {
+			rotated.Pix[mx*rotated.Stride+(h-1-my)] = mask.Pix[my*mask.Stride+mx]
+		}
+	}
+
+	dstRect := image.Rect(int(x), int(y), int(x)+h, int(y)+w)
+	draw.DrawMask(dst, dstRect, src, image.Point{}, rotated, image.Point{}, draw.Over)
+}
+
+// blockOrigin returns the top-left corner of a width x height block whose
+// point at fractions (fx, fy) of its size is aligned with the same fractions
+// of bounds, moved inwards from the edges it is anchored to by the given
+// offsets.
+func blockOrigin(fx, fy float64, bounds image.Rectangle, width, height, offsetX, offsetY float64) (x, y float64) {
+	x = fx*(float64(bounds.Dx())-width) + (1-2*fx)*offsetX
+	y = fy*(float64(bounds.Dy())-height) + (1-2*fy)*offsetY
+	return x + float64(bounds.Min.X), y + float64(bounds.Min.Y)
+}
+
+// fixedRect returns the smallest integer rectangle containing r.
+func fixedRect(r fixed.Rectangle26_6) image.Rectangle {
+	return image.Rect(r.Min.X.Floor(), r.Min.Y.Floor(), r.Max.X.Ceil(), r.Max.Y.Ceil())
+}
+
+// columnFrame returns the bounds of a vertical text column of size w x h
+// with its top-left corner at (x, y).
+func columnFrame(x, y, w, h float64) fixed.Rectangle26_6 {
+	return fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: floatToFixed(x), Y: floatToFixed(y)},
+		Max: fixed.Point26_6{X: floatToFixed(x + w), Y: floatToFixed(y + h)},
+	}
+}
+
+// fixedToFloat converts a 26.6 fixed-point value to float64 pixels.
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// floatToFixed converts float64 pixels to a 26.6 fixed-point value.
+func floatToFixed(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(v * 64)
+}
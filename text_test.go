@@ -0,0 +1,473 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestVerticalOrientationOf(t *testing.T) {
+	cases := []struct {
+		r    rune
+		want verticalOrientation
+	}{
+		{'日', verticalUpright},
+		{'か', verticalUpright},
+		{'カ', verticalUpright},
+		{'A', verticalRotated},
+		{'1', verticalRotated},
+		{'ー', verticalRotated},
+		{'「', verticalRotated},
+		{'。', verticalPunctuation},
+		{'、', verticalPunctuation},
+	}
+	for _, c := range cases {
+		if got := verticalOrientationOf(c.r); got != c.want {
+			t.Errorf("verticalOrientationOf(%q) = %d, want %d", c.r, got, c.want)
+		}
+	}
+}
+
+func TestAddTextWatermarkVertical(t *testing.T) {
+	originalImg := image.NewRGBA(image.Rect(0, 0, 100, 300))
+	proc := New(originalImg).AddTextWatermark("GOPIQ",
+		WithVerticalText(),
+		WithFontSize(20),
+		WithColor(color.RGBA{255, 0, 0, 255}),
+		WithPosition(PositionTopLeft),
+		WithOffset(0, 0),
+	)
+	if proc.Err() != nil {
+		t.Fatalf("AddTextWatermark with vertical text should not error: %v", proc.Err())
+	}
+
+	img, _ := proc.Image()
+	if img.Bounds() != originalImg.Bounds() {
+		t.Fatalf("Vertical watermark changed bounds: got %v", img.Bounds())
+	}
+
+	// All ink must sit in a narrow column on the left, spread over more
+	// vertical than horizontal space.
+	minX, minY, maxX, maxY := img.Bounds().Max.X, img.Bounds().Max.Y, -1, -1
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 100; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a > 0 {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < 0 {
+		t.Fatal("Vertical watermark drew nothing")
+	}
+	if maxX-minX >= maxY-minY {
+		t.Errorf("Vertical watermark should be taller than wide, got ink box %dx%d", maxX-minX, maxY-minY)
+	}
+	if maxX > 30 {
+		t.Errorf("Vertical watermark column should stay within one line height, got maxX=%d", maxX)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	face, err := newFontFace(goregular.TTF, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+
+	lines := wrapText(face, "the quick brown fox jumps over the lazy dog\nsecond paragraph", 120)
+	if len(lines) < 4 {
+		t.Fatalf("wrapText() should produce several lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if w := fixedToFloat(font.MeasureString(face, line)); w > 120 {
+			t.Errorf("wrapText() line %q is %.1fpx wide, exceeds 120px", line, w)
+		}
+	}
+	if lines[len(lines)-1] != "second paragraph" && lines[len(lines)-2] != "second" {
+		t.Errorf("wrapText() should start a new line at explicit newlines, got %q", lines)
+	}
+
+	// A single word wider than the limit is broken between characters.
+	lines = wrapText(face, "Supercalifragilisticexpialidocious", 60)
+	if len(lines) < 2 || strings.Join(lines, "") != "Supercalifragilisticexpialidocious" {
+		t.Errorf("wrapText() should split an overlong word, got %q", lines)
+	}
+
+	if got := truncateText(face, "short", 200); got != "short" {
+		t.Errorf("truncateText() changed a fitting string to %q", got)
+	}
+	if got := truncateText(face, "a much longer string than fits", 80); !strings.HasSuffix(got, "…") {
+		t.Errorf("truncateText() should add an ellipsis, got %q", got)
+	}
+}
+
+func TestFitText(t *testing.T) {
+	box := image.Rect(0, 0, 300, 100)
+
+	short, err := FitText("Hi", box, 8, 48)
+	if err != nil {
+		t.Fatalf("FitText() should fit short text, got: %v", err)
+	}
+	if short != 48 {
+		t.Errorf("FitText() of short text = %g, want the maximum 48", short)
+	}
+
+	long := "A considerably longer headline that has to wrap over multiple lines"
+	size, err := FitText(long, box, 8, 48)
+	if err != nil {
+		t.Fatalf("FitText() should fit long text, got: %v", err)
+	}
+	if size >= 48 || size < 8 {
+		t.Errorf("FitText() of long text = %g, want a size in [8, 48)", size)
+	}
+	// The chosen size fits and a slightly larger one does not.
+	fits := func(s float64) bool {
+		face, _ := newFontFace(goregular.TTF, s)
+		defer face.Close()
+		return textFits(face, long, box)
+	}
+	if !fits(size) || fits(size+2*fitTextPrecision) {
+		t.Errorf("FitText() = %g is not the largest fitting size", size)
+	}
+
+	// Invalid input
+	if _, err := FitText(long, image.Rect(0, 0, 20, 5), 8, 48); err == nil {
+		t.Error("FitText() should fail when text does not fit at the minimum size")
+	}
+	if _, err := FitText("", box, 8, 48); err == nil {
+		t.Error("FitText() with empty text should return an error")
+	}
+	if _, err := FitText(long, box, 20, 10); err == nil {
+		t.Error("FitText() with an inverted size range should return an error")
+	}
+	if _, err := FitText(long, box, 8, 48, WithFontBytes([]byte{1})); err == nil {
+		t.Error("FitText() with invalid font bytes should return an error")
+	}
+}
+
+func TestWatermarkBounds(t *testing.T) {
+	// inkBounds returns the bounding box of the pixels AddTextWatermark draws.
+	inkBounds := func(bounds image.Rectangle, text string, opts ...WatermarkOption) image.Rectangle {
+		img, err := New(image.NewRGBA(bounds)).AddTextWatermark(text, opts...).Image()
+		if err != nil {
+			t.Fatalf("AddTextWatermark() should not error, got: %v", err)
+		}
+		var ink image.Rectangle
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+					ink = ink.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		return ink
+	}
+
+	bounds := image.Rect(0, 0, 400, 200)
+	for _, pos := range []WatermarkPosition{PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter} {
+		opts := []WatermarkOption{WithPosition(pos), WithFontSize(32), WithColor(color.White)}
+		got, err := WatermarkBounds("AVATAR Wj", bounds, opts...)
+		if err != nil {
+			t.Fatalf("WatermarkBounds() should not error, got: %v", err)
+		}
+		ink := inkBounds(bounds, "AVATAR Wj", opts...)
+		if !ink.In(got) {
+			t.Errorf("position %d: drawn pixels %v exceed WatermarkBounds() %v", pos, ink, got)
+		}
+		if got.Dx()-ink.Dx() > 2 || got.Dy()-ink.Dy() > 2 {
+			t.Errorf("position %d: WatermarkBounds() %v is not tight around drawn pixels %v", pos, got, ink)
+		}
+	}
+
+	// Vertical text stays within its column; tiling covers the image.
+	opts := []WatermarkOption{WithVerticalText(), WithColor(color.White)}
+	got, err := WatermarkBounds("縦書きA", bounds, opts...)
+	if err != nil {
+		t.Fatalf("WatermarkBounds() with vertical text should not error, got: %v", err)
+	}
+	if ink := inkBounds(bounds, "縦書きA", opts...); !ink.In(got) {
+		t.Errorf("vertical text pixels %v exceed WatermarkBounds() %v", ink, got)
+	}
+	if got, _ := WatermarkBounds("x", bounds, WithTiling(10, 10, 30)); got != bounds {
+		t.Errorf("WatermarkBounds() with tiling = %v, want the image bounds", got)
+	}
+
+	// Test case: Invalid input
+	if _, err := WatermarkBounds("", bounds); err == nil {
+		t.Error("WatermarkBounds() with empty text should return an error")
+	}
+	if _, err := WatermarkBounds("x", bounds, WithFontBytes([]byte("not a font"))); err == nil {
+		t.Error("WatermarkBounds() with an invalid font should return an error")
+	}
+}
+
+func TestWithPixelSnapping(t *testing.T) {
+	render := func(offset float64, opts ...WatermarkOption) image.Image {
+		opts = append([]WatermarkOption{WithPosition(PositionTopLeft), WithOffset(offset, 10), WithColor(color.White)}, opts...)
+		img, err := New(image.NewRGBA(image.Rect(0, 0, 80, 40))).AddTextWatermark("Il", opts...).Image()
+		if err != nil {
+			t.Fatalf("AddTextWatermark() should not error, got: %v", err)
+		}
+		return img
+	}
+
+	// Fractional offsets move the text by less than a pixel.
+	if bytesEqualRGBA(render(10), render(10.5)) {
+		t.Error("a half-pixel offset should change the rendered text")
+	}
+	// Snapping rounds the origin to whole pixels.
+	if !bytesEqualRGBA(render(10, WithPixelSnapping(true)), render(10.3, WithPixelSnapping(true))) {
+		t.Error("with pixel snapping, a 0.3 pixel offset should not change the rendered text")
+	}
+
+	// WatermarkBounds follows the same positioning.
+	b1, _ := WatermarkBounds("Il", image.Rect(0, 0, 80, 40), WithPosition(PositionTopLeft), WithOffset(10.75, 10))
+	b2, _ := WatermarkBounds("Il", image.Rect(0, 0, 80, 40), WithPosition(PositionTopLeft), WithOffset(10.75, 10), WithPixelSnapping(true))
+	if b1 == b2 {
+		t.Errorf("WatermarkBounds() should reflect pixel snapping, got %v for both", b1)
+	}
+}
+
+// alphaBounds returns the bounding box of the non-transparent pixels of img.
+func alphaBounds(img image.Image) image.Rectangle {
+	var r image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestAddTextWatermarkMultiline(t *testing.T) {
+	bounds := image.Rect(0, 0, 300, 200)
+	render := func(text string, opts ...WatermarkOption) image.Rectangle {
+		opts = append([]WatermarkOption{WithColor(color.White), WithFontSize(20)}, opts...)
+		img, err := New(image.NewRGBA(bounds)).AddTextWatermark(text, opts...).Image()
+		if err != nil {
+			t.Fatalf("AddTextWatermark(%q) should not error, got: %v", text, err)
+		}
+		ink := alphaBounds(img)
+		if wb, _ := WatermarkBounds(text, bounds, opts...); !ink.In(wb) {
+			t.Errorf("AddTextWatermark(%q) pixels %v exceed WatermarkBounds() %v", text, ink, wb)
+		}
+		return ink
+	}
+
+	single := render("Copyright")
+	double := render("Copyright\nExample Inc.")
+	if double.Dy() < single.Dy()+15 {
+		t.Errorf("two lines should be taller than one: %v vs %v", double, single)
+	}
+	// Bottom positions keep the last line at the margin.
+	if abs(double.Max.Y-single.Max.Y) > 2 {
+		t.Errorf("last line bottom = %d, want close to single line bottom %d", double.Max.Y, single.Max.Y)
+	}
+	if spaced := render("Copyright\nExample Inc.", WithLineHeight(2)); spaced.Dy() < double.Dy()+15 {
+		t.Errorf("WithLineHeight(2) should spread the lines: %v vs %v", spaced, double)
+	}
+
+	// Long text wraps to the maximum width instead of overflowing.
+	long := "© 2025 Example Photography Inc. All rights reserved worldwide."
+	if unwrapped := render(long, WithPosition(PositionTopLeft)); unwrapped.Dx() < 250 {
+		t.Fatalf("unwrapped text should be wide, got %v", unwrapped)
+	}
+	wrapped := render(long, WithPosition(PositionTopLeft), WithMaxWidth(150))
+	if wrapped.Dx() > 150 || wrapped.Dy() < 2*single.Dy() {
+		t.Errorf("WithMaxWidth(150) ink = %v, want at most 150px wide over several lines", wrapped)
+	}
+
+	// Prepared stamps lay out the same lines.
+	opts := []WatermarkOption{WithColor(color.White), WithFontSize(20), WithMaxWidth(150), WithPosition(PositionCenter)}
+	stamp, err := PrepareWatermark(append(opts, WithText(long))...)
+	if err != nil {
+		t.Fatalf("PrepareWatermark() with wrapping should not error, got: %v", err)
+	}
+	stamped, _ := New(image.NewRGBA(bounds)).ApplyStamp(stamp).Image()
+	drawn, _ := New(image.NewRGBA(bounds)).AddTextWatermark(long, opts...).Image()
+	if got, want := alphaBounds(stamped), alphaBounds(drawn); abs(got.Min.X-want.Min.X) > 1 || abs(got.Min.Y-want.Min.Y) > 1 || abs(got.Dy()-want.Dy()) > 1 {
+		t.Errorf("ApplyStamp() ink %v, want close to AddTextWatermark ink %v", got, want)
+	}
+
+	// Test case: Invalid input
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithMaxWidth(-1)).Err() == nil {
+		t.Error("AddTextWatermark() with a negative max width should return an error")
+	}
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithLineHeight(-1)).Err() == nil {
+		t.Error("AddTextWatermark() with a negative line height should return an error")
+	}
+}
+
+func TestWatermarkAlignmentAndAnchor(t *testing.T) {
+	bounds := image.Rect(0, 0, 300, 200)
+	render := func(text string, opts ...WatermarkOption) image.Image {
+		opts = append([]WatermarkOption{WithColor(color.White), WithFontSize(20)}, opts...)
+		img, err := New(image.NewRGBA(bounds)).AddTextWatermark(text, opts...).Image()
+		if err != nil {
+			t.Fatalf("AddTextWatermark(%q) should not error, got: %v", text, err)
+		}
+		return img
+	}
+	subBounds := func(img image.Image, r image.Rectangle) image.Rectangle {
+		return alphaBounds(img.(*image.RGBA).SubImage(r))
+	}
+
+	// Lines line up on the chosen side; with line height 3 the lines are far
+	// enough apart to be measured separately.
+	for _, tc := range []struct {
+		align TextAlign
+		edge  func(r image.Rectangle) int
+	}{
+		{TextAlignLeft, func(r image.Rectangle) int { return r.Min.X }},
+		{TextAlignCenter, func(r image.Rectangle) int { return (r.Min.X + r.Max.X) / 2 }},
+		{TextAlignRight, func(r image.Rectangle) int { return r.Max.X }},
+	} {
+		img := render("A much longer line\nshort", WithPosition(PositionTopLeft), WithLineHeight(3), WithAlignment(tc.align))
+		first := subBounds(img, image.Rect(0, 0, 300, 40))
+		second := subBounds(img, image.Rect(0, 40, 300, 200))
+		if first.Empty() || second.Empty() {
+			t.Fatalf("alignment %d: expected two lines of ink, got %v and %v", tc.align, first, second)
+		}
+		if d := abs(tc.edge(first) - tc.edge(second)); d > 2 {
+			t.Errorf("alignment %d: lines are %dpx apart on the aligned side (%v, %v)", tc.align, d, first, second)
+		}
+	}
+
+	// Anchors at the corners match the fixed positions.
+	for _, tc := range []struct {
+		pos    WatermarkPosition
+		ax, ay float64
+	}{{PositionTopLeft, 0, 0}, {PositionTopRight, 1, 0}, {PositionBottomLeft, 0, 1}, {PositionBottomRight, 1, 1}} {
+		want := alphaBounds(render("Anchor", WithPosition(tc.pos)))
+		got := alphaBounds(render("Anchor", WithAnchor(tc.ax, tc.ay)))
+		if got != want {
+			t.Errorf("WithAnchor(%g, %g) ink = %v, want %v as for position %d", tc.ax, tc.ay, got, want, tc.pos)
+		}
+	}
+
+	// Intermediate anchors place the text proportionally.
+	ink := alphaBounds(render("Anchor", WithAnchor(0.5, 0.25), WithOffset(0, 0)))
+	if cx := (ink.Min.X + ink.Max.X) / 2; abs(cx-150) > 3 {
+		t.Errorf("WithAnchor(0.5, 0.25) centre x = %d, want about 150", cx)
+	}
+	if ink.Min.Y < 30 || ink.Max.Y > 70 {
+		t.Errorf("WithAnchor(0.5, 0.25) ink = %v, want a quarter of the way down", ink)
+	}
+	if wb, _ := WatermarkBounds("Anchor", bounds, WithAnchor(0.5, 0.25), WithOffset(0, 0), WithFontSize(20)); !ink.In(wb) {
+		t.Errorf("WatermarkBounds() %v should contain the anchored text %v", wb, ink)
+	}
+
+	// Test case: Invalid input
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithAnchor(1.5, 0)).Err() == nil {
+		t.Error("AddTextWatermark() with an anchor outside [0, 1] should return an error")
+	}
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithAlignment(TextAlign(7))).Err() == nil {
+		t.Error("AddTextWatermark() with an unknown alignment should return an error")
+	}
+}
+
+func TestRelativeWatermarkSizing(t *testing.T) {
+	// Relative sizes resolve against the image to the equivalent pixel sizes.
+	bounds := image.Rect(0, 0, 400, 300)
+	rel, err := WatermarkBounds("Scaled", bounds, WithRelativeFontSize(0.1), WithRelativeOffset(0.05, 0.1))
+	if err != nil {
+		t.Fatalf("WatermarkBounds() with relative sizes should not error, got: %v", err)
+	}
+	want, _ := WatermarkBounds("Scaled", bounds, WithFontSize(30), WithOffset(20, 30))
+	if rel != want {
+		t.Errorf("relative bounds = %v, want %v as with WithFontSize(30), WithOffset(20, 30)", rel, want)
+	}
+
+	// The watermark keeps its proportions across image sizes.
+	small, _ := WatermarkBounds("Scaled", image.Rect(0, 0, 200, 200), WithRelativeFontSize(0.1))
+	large, _ := WatermarkBounds("Scaled", image.Rect(0, 0, 800, 800), WithRelativeFontSize(0.1))
+	if ratio := float64(large.Dx()) / float64(small.Dx()); ratio < 3.5 || ratio > 4.5 {
+		t.Errorf("text on a 4x larger image should be about 4x wider, got %v and %v", small, large)
+	}
+
+	// The last of WithOffset and WithRelativeOffset wins.
+	px, _ := WatermarkBounds("Scaled", bounds, WithRelativeOffset(0.5, 0.5), WithOffset(20, 30))
+	if want, _ := WatermarkBounds("Scaled", bounds, WithOffset(20, 30)); px != want {
+		t.Errorf("WithOffset() after WithRelativeOffset() should use pixels, got %v", px)
+	}
+
+	// Prepared stamps resolve relative offsets for each image.
+	stamp, err := PrepareWatermark(WithText("Stamp"), WithRelativeOffset(0.1, 0.1))
+	if err != nil {
+		t.Fatalf("PrepareWatermark() with a relative offset should not error, got: %v", err)
+	}
+	for _, b := range []image.Rectangle{image.Rect(0, 0, 200, 100), image.Rect(0, 0, 600, 400)} {
+		want := alphaBounds(mustImage(t, New(image.NewRGBA(b)).AddTextWatermark("Stamp", WithRelativeOffset(0.1, 0.1))))
+		got := alphaBounds(mustImage(t, New(image.NewRGBA(b)).ApplyStamp(stamp)))
+		if d := got.Min.Sub(want.Min); d.X < -1 || d.X > 1 || d.Y < -1 || d.Y > 1 {
+			t.Errorf("ApplyStamp() on %v ink = %v, want close to %v", b, got, want)
+		}
+	}
+
+	// Test case: Invalid input
+	if _, err := PrepareWatermark(WithText("x"), WithRelativeFontSize(0.1)); err == nil {
+		t.Error("PrepareWatermark() with a relative font size should return an error")
+	}
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithRelativeFontSize(-0.1)).Err() == nil {
+		t.Error("AddTextWatermark() with a negative relative font size should return an error")
+	}
+}
+
+func TestMeasureText(t *testing.T) {
+	bounds := image.Rect(0, 0, 400, 300)
+
+	// The width is that of the ink; the height spans the line boxes.
+	w, h, err := MeasureText("Measure me", WithFontSize(30))
+	if err != nil {
+		t.Fatalf("MeasureText() should not error, got: %v", err)
+	}
+	wb, _ := WatermarkBounds("Measure me", bounds, WithFontSize(30))
+	if math.Abs(w-float64(wb.Dx())) > 2 {
+		t.Errorf("MeasureText() width = %g, want about the ink width %d", w, wb.Dx())
+	}
+	if h < float64(wb.Dy()) || h > 2*30 {
+		t.Errorf("MeasureText() height = %g, want between the ink height %d and two lines", h, wb.Dy())
+	}
+
+	// A caption bar sized from the measurement fits the background box.
+	box, _ := WatermarkBounds("Measure me", bounds, WithFontSize(30), WithBackgroundBox(color.Black, 8, 4, 0))
+	if math.Abs(w+16-float64(box.Dx())) > 2 || math.Abs(h+8-float64(box.Dy())) > 2 {
+		t.Errorf("background box %v, want about %gx%g", box, w+16, h+8)
+	}
+
+	// Line breaks, line height and wrapping are applied.
+	_, h2, _ := MeasureText("Measure\nme", WithFontSize(30))
+	_, h3, _ := MeasureText("Measure\nme", WithFontSize(30), WithLineHeight(2))
+	if h2 <= h || h3 <= h2 {
+		t.Errorf("heights for 1 line, 2 lines and 2 double-spaced lines = %g, %g, %g, want increasing", h, h2, h3)
+	}
+	if ww, _, _ := MeasureText("a long line of text to wrap", WithMaxWidth(100)); ww > 100 {
+		t.Errorf("MeasureText() with WithMaxWidth(100) width = %g, want at most 100", ww)
+	}
+
+	// Vertical text measures its column.
+	vw, vh, _ := MeasureText("縦書き", WithVerticalText())
+	if vh <= vw {
+		t.Errorf("vertical text should be taller than wide, got %gx%g", vw, vh)
+	}
+
+	// Test case: Invalid input
+	if _, _, err := MeasureText(""); err == nil {
+		t.Error("MeasureText() with empty text should return an error")
+	}
+	if _, _, err := MeasureText("x", WithRelativeFontSize(0.1)); err == nil {
+		t.Error("MeasureText() with a relative font size should return an error")
+	}
+	if _, _, err := MeasureText("x", WithFontName("missing")); err == nil {
+		t.Error("MeasureText() with an unregistered font should return an error")
+	}
+}
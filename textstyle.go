@@ -0,0 +1,287 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// WithStroke outlines watermark text with a stroke width pixels wide in
+// color c, so that it stays readable on both light and dark backgrounds,
+// e.g. white text with a thin black outline.
+func WithStroke(width float64, c color.Color) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.StrokeWidth, wc.StrokeColor = width, c }
+}
+
+// textShadow is a drop shadow drawn behind watermark text.
+type textShadow struct {
+	DX, DY float64 // Offset from the text in pixels
+	Blur   float64 // Gaussian standard deviation in pixels; 0 for a hard shadow
+	Color  color.Color
+}
+
+// maxShadowBlur is the largest shadow blur in pixels. The blurred mask
+// grows with the blur on every side, so larger values would need gigabytes.
+const maxShadowBlur = 100
+
+// WithTextShadow draws a shadow of the text (including any stroke) in color
+// c behind it, offset by dx, dy pixels and softened by a Gaussian blur with a
+// standard deviation of blur pixels (0 for a hard shadow, at most 100).
+func WithTextShadow(dx, dy, blur float64, c color.Color) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Shadow = &textShadow{DX: dx, DY: dy, Blur: blur, Color: c} }
+}
+
+// textBox is a filled box drawn behind watermark text.
+type textBox struct {
+	Color              color.Color
+	PaddingX, PaddingY float64 // Space between the text bounds and the box edges in pixels
+	Radius             float64 // Corner radius in pixels; 0 for square corners
+}
+
+// WithBackgroundBox draws a box filled with color c behind the text,
+// extending paddingX pixels beyond its bounds on the left and right and
+// paddingY pixels above and below, with corners rounded to cornerRadius
+// pixels. It makes caption bars and badge-style labels; a cornerRadius of
+// half the box height gives a pill. The bounds span the ink of the text
+// across and its line boxes from ascent to descent down, so labels keep the
+// same height whatever letters they contain.
+func WithBackgroundBox(c color.Color, paddingX, paddingY, cornerRadius float64) WatermarkOption {
+	return func(wc *watermarkConfig) {
+		wc.Box = &textBox{Color: c, PaddingX: paddingX, PaddingY: paddingY, Radius: cornerRadius}
+	}
+}
+
+// bounds returns the box drawn around text with the given bounds.
+func (b *textBox) bounds(frame fixed.Rectangle26_6) (x0, y0, x1, y1 float64) {
+	return fixedToFloat(frame.Min.X) - b.PaddingX, fixedToFloat(frame.Min.Y) - b.PaddingY,
+		fixedToFloat(frame.Max.X) + b.PaddingX, fixedToFloat(frame.Max.Y) + b.PaddingY
+}
+
+// rect returns the pixels covered by the box drawn around text with the
+// given bounds.
+func (b *textBox) rect(frame fixed.Rectangle26_6) image.Rectangle {
+	x0, y0, x1, y1 := b.bounds(frame)
+	return image.Rect(int(math.Floor(x0)), int(math.Floor(y0)), int(math.Ceil(x1)), int(math.Ceil(y1)))
+}
+
+// textGradient is a linear gradient filling watermark glyphs.
+type textGradient struct {
+	Start, End color.Color
+	Angle      float64 // Direction in degrees counter-clockwise from left-to-right
+}
+
+// WithGradientFill fills the glyphs with a linear gradient from start to end
+// instead of the uniform WithColor, e.g. for branded title cards. The
+// gradient runs across the text bounds in the direction of angle degrees
+// counter-clockwise: 0 runs from left to right, 90 from bottom to top and
+// 270 from top to bottom.
+func WithGradientFill(start, end color.Color, angle float64) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Gradient = &textGradient{Start: start, End: end, Angle: angle} }
+}
+
+// image renders the gradient over r so that it runs from one edge of the
+// text bounds frame to the opposite one, clamped beyond them.
+func (g *textGradient) image(r image.Rectangle, frame fixed.Rectangle26_6) *image.RGBA {
+	sin, cos := math.Sincos(g.Angle * math.Pi / 180)
+	x0, y0 := fixedToFloat(frame.Min.X), fixedToFloat(frame.Min.Y)
+	x1, y1 := fixedToFloat(frame.Max.X), fixedToFloat(frame.Max.Y)
+	cx, cy := (x0+x1)/2, (y0+y1)/2
+	// The projection of the frame onto the gradient direction, which points
+	// up for positive angles as y grows downwards.
+	length := math.Max(math.Abs((x1-x0)*cos)+math.Abs((y1-y0)*sin), 1)
+
+	start := color.NRGBA64Model.Convert(g.Start).(color.NRGBA64)
+	end := color.NRGBA64Model.Convert(g.End).(color.NRGBA64)
+	lerp := func(a, b uint16, t float64) uint16 {
+		return uint16(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			t := ((float64(x)+0.5-cx)*cos-(float64(y)+0.5-cy)*sin)/length + 0.5
+			t = math.Max(0, math.Min(1, t))
+			img.Set(x, y, color.NRGBA64{
+				R: lerp(start.R, end.R, t),
+				G: lerp(start.G, end.G, t),
+				B: lerp(start.B, end.B, t),
+				A: lerp(start.A, end.A, t),
+			})
+		}
+	}
+	return img
+}
+
+// offset returns the shadow offset rounded to whole pixels.
+func (s *textShadow) offset() image.Point {
+	return image.Pt(int(math.Round(s.DX)), int(math.Round(s.DY)))
+}
+
+// radius returns how far the blur spreads the shadow in pixels.
+func (s *textShadow) radius() int {
+	if s.Blur == 0 {
+		return 0
+	}
+	return len(gaussianKernel(s.Blur)) / 2
+}
+
+// hasTextEffects reports whether text drawn with cfg needs more than its
+// glyphs filled with a uniform color.
+func (cfg *watermarkConfig) hasTextEffects() bool {
+	return cfg.StrokeWidth > 0 || cfg.Shadow != nil || cfg.Box != nil || cfg.Gradient != nil
+}
+
+// textEffectBounds returns the rectangle covered by text whose glyphs cover
+// r and whose measured bounds are frame once the effects of cfg are drawn.
+func (cfg *watermarkConfig) textEffectBounds(r image.Rectangle, frame fixed.Rectangle26_6) image.Rectangle {
+	stroke := int(math.Ceil(cfg.StrokeWidth))
+	out := r.Inset(-stroke)
+	if cfg.Shadow != nil {
+		out = out.Union(r.Inset(-stroke - cfg.Shadow.radius()).Add(cfg.Shadow.offset()))
+	}
+	if cfg.Box != nil {
+		out = out.Union(cfg.Box.rect(frame))
+	}
+	return out
+}
+
+// glyphMargin returns how many pixels the stroke and shadow blur of cfg
+// extend beyond the glyphs on every side, which the mask they are derived
+// from needs around the glyphs.
+func (cfg *watermarkConfig) glyphMargin() int {
+	m := int(math.Ceil(cfg.StrokeWidth))
+	if cfg.Shadow != nil {
+		m += cfg.Shadow.radius()
+	}
+	return m
+}
+
+// drawStyledText draws text onto dst with the fill and effects of cfg.
+// glyphs draws the text with src onto a destination using dst's coordinates,
+// extent bounds the pixels it covers and frame is its measured bounds. Text
+// with effects is first drawn into an alpha mask around extent from which
+// the effect layers are derived.
+func drawStyledText(dst draw.Image, cfg *watermarkConfig, extent image.Rectangle, frame fixed.Rectangle26_6, glyphs func(dst draw.Image, src image.Image)) {
+	if !cfg.hasTextEffects() {
+		glyphs(dst, image.NewUniform(cfg.Color))
+		return
+	}
+
+	// Layers are composited from the back: box, shadow, stroke, fill.
+	if cfg.Box != nil {
+		drawTextBox(dst, cfg.Box, frame)
+	}
+	mask := image.NewAlpha(extent.Inset(-cfg.glyphMargin()))
+	glyphs(mask, image.Opaque)
+	shape := mask
+	var outline *image.Alpha
+	if cfg.StrokeWidth > 0 {
+		outline = dilateAlpha(mask, cfg.StrokeWidth)
+		shape = outline
+	}
+	if s := cfg.Shadow; s != nil {
+		shadow := shape
+		if s.Blur > 0 {
+			shadow = blurAlpha(shape, s.Blur)
+		}
+		r := mask.Rect.Add(s.offset())
+		draw.DrawMask(dst, r, image.NewUniform(s.Color), image.Point{}, shadow, mask.Rect.Min, draw.Over)
+	}
+	if outline != nil {
+		draw.DrawMask(dst, mask.Rect, image.NewUniform(cfg.StrokeColor), image.Point{}, outline, mask.Rect.Min, draw.Over)
+	}
+	// font.Drawer samples its source relative to each glyph, so a gradient
+	// is only applied through the mask.
+	var fill image.Image = image.NewUniform(cfg.Color)
+	if cfg.Gradient != nil {
+		fill = cfg.Gradient.image(extent.Union(fixedRect(frame)), frame)
+	}
+	draw.DrawMask(dst, mask.Rect, fill, mask.Rect.Min, mask, mask.Rect.Min, draw.Over)
+}
+
+// drawTextBox draws box around text with the measured bounds frame onto
+// dst, anti-aliasing its edges and rounded corners.
+func drawTextBox(dst draw.Image, box *textBox, frame fixed.Rectangle26_6) {
+	x0, y0, x1, y1 := box.bounds(frame)
+	r := box.rect(frame).Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+	// The coverage of a pixel is estimated from the signed distance of its
+	// center to the edge of the rounded rectangle.
+	cx, cy := (x0+x1)/2, (y0+y1)/2
+	radius := min(box.Radius, (x1-x0)/2, (y1-y0)/2)
+	hw, hh := (x1-x0)/2-radius, (y1-y0)/2-radius
+	mask := image.NewAlpha(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		qy := math.Abs(float64(y)+0.5-cy) - hh
+		row := mask.Pix[(y-r.Min.Y)*mask.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			qx := math.Abs(float64(x)+0.5-cx) - hw
+			d := math.Hypot(max(qx, 0), max(qy, 0)) + min(max(qx, qy), 0) - radius
+			row[x-r.Min.X] = clampUint8(255 * (0.5 - d))
+		}
+	}
+	draw.DrawMask(dst, r, image.NewUniform(box.Color), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// blurAlpha returns mask blurred with a Gaussian of the given standard
+// deviation. The mask needs a transparent margin of the blur radius.
+func blurAlpha(mask *image.Alpha, sigma float64) *image.Alpha {
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	plane := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x, a := range mask.Pix[y*mask.Stride : y*mask.Stride+w] {
+			plane[y*w+x] = float64(a)
+		}
+	}
+	plane = gaussianSmooth(plane, w, h, sigma)
+	out := image.NewAlpha(mask.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Pix[y*out.Stride+x] = clampUint8(plane[y*w+x])
+		}
+	}
+	return out
+}
+
+// dilateAlpha returns mask grown by radius pixels in every direction with
+// anti-aliased round edges. Pixels near the border of mask are clipped, so
+// the mask needs a margin of at least ceil(radius) around its content.
+func dilateAlpha(mask *image.Alpha, radius float64) *image.Alpha {
+	// kernel holds the coverage of each neighbor offset by a disk of the
+	// given radius.
+	r := int(math.Ceil(radius))
+	size := 2*r + 1
+	kernel := make([]float64, size*size)
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			kernel[(dy+r)*size+dx+r] = min(max(radius+0.5-math.Hypot(float64(dx), float64(dy)), 0), 1)
+		}
+	}
+
+	// Text masks are mostly empty, so spread each covered pixel over its
+	// neighborhood instead of gathering for every output pixel.
+	out := image.NewAlpha(mask.Rect)
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := float64(mask.Pix[y*mask.Stride+x])
+			if a == 0 {
+				continue
+			}
+			for ky := max(-r, -y); ky <= min(r, h-1-y); ky++ {
+				row := out.Pix[(y+ky)*out.Stride:]
+				weights := kernel[(ky+r)*size : (ky+r+1)*size]
+				for kx := max(-r, -x); kx <= min(r, w-1-x); kx++ {
+					if v := uint8(a*weights[kx+r] + 0.5); v > row[x+kx] {
+						row[x+kx] = v
+					}
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,308 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestWithStroke(t *testing.T) {
+	bounds := image.Rect(0, 0, 240, 120)
+	white := image.NewRGBA(bounds)
+	draw.Draw(white, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	// White text vanishes on a white image unless it is outlined.
+	darkPixels := func(img image.Image) int {
+		n := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if r, _, _, _ := img.At(x, y).RGBA(); r>>8 < 128 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	plain, _ := New(white).AddTextWatermark("Visible", WithColor(color.White), WithFontSize(32)).Image()
+	if n := darkPixels(plain); n != 0 {
+		t.Fatalf("white text on white should have no dark pixels, got %d", n)
+	}
+	stroked, err := New(white).AddTextWatermark("Visible", WithColor(color.White), WithFontSize(32), WithStroke(2, color.Black)).Image()
+	if err != nil {
+		t.Fatalf("AddTextWatermark() with a stroke should not error, got: %v", err)
+	}
+	if n := darkPixels(stroked); n < 200 {
+		t.Errorf("WithStroke() should outline the text, got %d dark pixels", n)
+	}
+
+	// The outline extends the ink by the stroke width on every side.
+	for _, tc := range []struct {
+		text string
+		opts []WatermarkOption
+	}{
+		{"Outline", []WatermarkOption{WithPosition(PositionCenter)}},
+		{"Wrapped outline text", []WatermarkOption{WithPosition(PositionTopLeft), WithMaxWidth(100)}},
+		{"Outline", []WatermarkOption{WithVerticalText()}},
+	} {
+		opts := append([]WatermarkOption{WithColor(color.White), WithFontSize(24)}, tc.opts...)
+		text := tc.text
+		plainInk := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark(text, opts...)))
+		opts = append(opts, WithStroke(3, color.Black))
+		strokedInk := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark(text, opts...)))
+		want := plainInk.Inset(-3)
+		if abs(strokedInk.Min.X-want.Min.X) > 1 || abs(strokedInk.Min.Y-want.Min.Y) > 1 ||
+			abs(strokedInk.Max.X-want.Max.X) > 1 || abs(strokedInk.Max.Y-want.Max.Y) > 1 {
+			t.Errorf("stroked ink = %v, want about %v", strokedInk, want)
+		}
+		if wb, _ := WatermarkBounds(text, bounds, opts...); !strokedInk.In(wb) {
+			t.Errorf("stroked ink %v exceeds WatermarkBounds() %v", strokedInk, wb)
+		}
+
+		// Prepared stamps carry the outline and land in the same place.
+		stamp, err := PrepareWatermark(append(opts, WithText(text))...)
+		if err != nil {
+			t.Fatalf("PrepareWatermark() with a stroke should not error, got: %v", err)
+		}
+		stampInk := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).ApplyStamp(stamp)))
+		if abs(stampInk.Min.X-strokedInk.Min.X) > 1 || abs(stampInk.Min.Y-strokedInk.Min.Y) > 1 ||
+			abs(stampInk.Dx()-strokedInk.Dx()) > 1 || abs(stampInk.Dy()-strokedInk.Dy()) > 1 {
+			t.Errorf("ApplyStamp() ink %v, want close to AddTextWatermark ink %v", stampInk, strokedInk)
+		}
+	}
+
+	// Test case: Invalid input
+	if New(white).AddTextWatermark("x", WithStroke(-1, color.Black)).Err() == nil {
+		t.Error("AddTextWatermark() with a negative stroke width should return an error")
+	}
+	if New(white).AddTextWatermark("x", WithStroke(2, nil)).Err() == nil {
+		t.Error("AddTextWatermark() with a nil stroke color should return an error")
+	}
+}
+
+// mustImage returns the current image of proc, failing the test on error.
+func mustImage(t *testing.T, proc *ImageProcessor) image.Image {
+	t.Helper()
+	img, err := proc.Image()
+	if err != nil {
+		t.Fatalf("unexpected processing error: %v", err)
+	}
+	return img
+}
+
+func TestWithTextShadow(t *testing.T) {
+	bounds := image.Rect(0, 0, 240, 120)
+	opts := []WatermarkOption{WithColor(color.White), WithFontSize(32), WithPosition(PositionCenter)}
+	plain := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark("Shadow", opts...)))
+
+	// A hard shadow is the text moved by the offset, behind the text.
+	hardOpts := append(opts, WithTextShadow(4, 5, 0, color.Black))
+	hard := mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark("Shadow", hardOpts...)).(*image.RGBA)
+	if got, want := alphaBounds(hard), plain.Union(plain.Add(image.Pt(4, 5))); got != want {
+		t.Errorf("hard shadow ink = %v, want %v", got, want)
+	}
+	var black, white int
+	for i := 0; i < len(hard.Pix); i += 4 {
+		switch {
+		case hard.Pix[i+3] == 255 && hard.Pix[i] == 0:
+			black++
+		case hard.Pix[i+3] == 255 && hard.Pix[i] == 255:
+			white++
+		}
+	}
+	if black == 0 || white == 0 {
+		t.Errorf("shadowed text should have opaque white text and black shadow pixels, got %d white and %d black", white, black)
+	}
+
+	// A blurred shadow spreads further with partial coverage.
+	softOpts := append(opts, WithTextShadow(4, 5, 3, color.Black))
+	soft := mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark("Shadow", softOpts...))
+	softInk := alphaBounds(soft)
+	if !alphaBounds(hard).In(softInk) || softInk.Max.Y < plain.Max.Y+10 {
+		t.Errorf("blurred shadow ink %v should extend beyond the hard shadow %v", softInk, alphaBounds(hard))
+	}
+	if wb, _ := WatermarkBounds("Shadow", bounds, softOpts...); !softInk.In(wb) {
+		t.Errorf("shadow ink %v exceeds WatermarkBounds() %v", softInk, wb)
+	}
+	stamp, err := PrepareWatermark(append(softOpts, WithText("Shadow"))...)
+	if err != nil {
+		t.Fatalf("PrepareWatermark() with a shadow should not error, got: %v", err)
+	}
+	if got := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).ApplyStamp(stamp))); abs(got.Min.X-softInk.Min.X) > 1 || abs(got.Min.Y-softInk.Min.Y) > 1 {
+		t.Errorf("ApplyStamp() shadow ink %v, want close to %v", got, softInk)
+	}
+
+	// Test case: Invalid input
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithTextShadow(1, 1, -2, color.Black)).Err() == nil {
+		t.Error("AddTextWatermark() with a negative shadow blur should return an error")
+	}
+	for name, opt := range map[string]WatermarkOption{
+		"nil color":       WithTextShadow(1, 1, 2, nil),
+		"NaN blur":        WithTextShadow(1, 1, math.NaN(), color.Black),
+		"huge blur":       WithTextShadow(1, 1, 1e4, color.Black),
+		"NaN offset":      WithTextShadow(math.NaN(), 1, 2, color.Black),
+		"infinite offset": WithTextShadow(1, math.Inf(-1), 2, color.Black),
+	} {
+		if New(image.NewRGBA(bounds)).AddTextWatermark("x", opt).Err() == nil {
+			t.Errorf("AddTextWatermark() with a shadow with a %s should return an error", name)
+		}
+	}
+}
+
+func TestWithBackgroundBox(t *testing.T) {
+	bounds := image.Rect(0, 0, 240, 120)
+	red := color.RGBA{R: 255, A: 255}
+
+	// The box surrounds the text bounds by the padding and is drawn behind
+	// the glyphs.
+	for _, tc := range []struct {
+		text string
+		opts []WatermarkOption
+	}{
+		{"Caption", []WatermarkOption{WithPosition(PositionCenter)}},
+		{"Two\nlines", []WatermarkOption{WithPosition(PositionTopLeft), WithAlignment(TextAlignCenter)}},
+		{"Badge", []WatermarkOption{WithVerticalText()}},
+	} {
+		opts := append([]WatermarkOption{WithColor(color.White), WithFontSize(24)}, tc.opts...)
+		plainInk := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark(tc.text, opts...)))
+		opts = append(opts, WithBackgroundBox(red, 8, 4, 0))
+		img := mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark(tc.text, opts...))
+		box := alphaBounds(img)
+		if !plainInk.Inset(-4).In(box) {
+			t.Errorf("%q: box %v should surround the text %v by the padding", tc.text, box, plainInk)
+		}
+		if r, g, _, a := img.At(box.Min.X+1, box.Min.Y+1).RGBA(); r>>8 != 255 || g>>8 != 0 || a>>8 != 255 {
+			t.Errorf("%q: box corner should be opaque red, got %v", tc.text, img.At(box.Min.X+1, box.Min.Y+1))
+		}
+		white := 0
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				if _, g, _, _ := img.At(x, y).RGBA(); g>>8 > 200 {
+					white++
+				}
+			}
+		}
+		if white == 0 {
+			t.Errorf("%q: text should be drawn over the box", tc.text)
+		}
+		if wb, _ := WatermarkBounds(tc.text, bounds, opts...); wb != box {
+			t.Errorf("%q: WatermarkBounds() = %v, want the box %v", tc.text, wb, box)
+		}
+
+		stamp, err := PrepareWatermark(append(opts, WithText(tc.text))...)
+		if err != nil {
+			t.Fatalf("PrepareWatermark() with a box should not error, got: %v", err)
+		}
+		stampBox := alphaBounds(mustImage(t, New(image.NewRGBA(bounds)).ApplyStamp(stamp)))
+		if abs(stampBox.Min.X-box.Min.X) > 1 || abs(stampBox.Min.Y-box.Min.Y) > 1 ||
+			abs(stampBox.Dx()-box.Dx()) > 1 || abs(stampBox.Dy()-box.Dy()) > 1 {
+			t.Errorf("%q: ApplyStamp() box %v, want close to AddTextWatermark box %v", tc.text, stampBox, box)
+		}
+	}
+
+	// Rounded corners leave the corner pixels of the box transparent.
+	opts := []WatermarkOption{WithPosition(PositionCenter), WithBackgroundBox(red, 12, 6, 10)}
+	img := mustImage(t, New(image.NewRGBA(bounds)).AddTextWatermark("Pill", opts...))
+	box := alphaBounds(img)
+	if _, _, _, a := img.At(box.Min.X, box.Min.Y).RGBA(); a != 0 {
+		t.Errorf("rounded box corner should be transparent, got alpha %d", a>>8)
+	}
+	if _, _, _, a := img.At(box.Min.X+box.Dx()/2, box.Min.Y).RGBA(); a>>8 < 128 {
+		t.Errorf("rounded box edge should be filled, got alpha %d", a>>8)
+	}
+
+	// Test case: Invalid input
+	for _, opt := range []WatermarkOption{
+		WithBackgroundBox(red, -1, 0, 0),
+		WithBackgroundBox(red, 0, -1, 0),
+		WithBackgroundBox(red, 0, 0, -1),
+	} {
+		if New(image.NewRGBA(bounds)).AddTextWatermark("x", opt).Err() == nil {
+			t.Error("AddTextWatermark() with a negative box padding or radius should return an error")
+		}
+	}
+	for _, opt := range []WatermarkOption{
+		WithBackgroundBox(red, math.NaN(), 0, 0),
+		WithBackgroundBox(red, 0, math.NaN(), 0),
+		WithBackgroundBox(red, 0, 0, math.NaN()),
+		WithBackgroundBox(red, math.Inf(1), 0, 0),
+	} {
+		if New(image.NewRGBA(bounds)).AddTextWatermark("x", opt).Err() == nil {
+			t.Error("AddTextWatermark() with a NaN or infinite box padding or radius should return an error")
+		}
+	}
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithBackgroundBox(nil, 4, 4, 0)).Err() == nil {
+		t.Error("AddTextWatermark() with a nil box color should return an error")
+	}
+}
+
+func TestWithGradientFill(t *testing.T) {
+	bounds := image.Rect(0, 0, 300, 120)
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+
+	// redness returns the mean red minus blue of the opaque pixels in the
+	// left and right or top and bottom thirds of the text.
+	redness := func(img image.Image, horizontal bool) (first, last float64) {
+		ink := alphaBounds(img)
+		var sums [2]float64
+		var counts [2]int
+		for y := ink.Min.Y; y < ink.Max.Y; y++ {
+			for x := ink.Min.X; x < ink.Max.X; x++ {
+				r, _, b, a := img.At(x, y).RGBA()
+				if a>>8 < 250 {
+					continue
+				}
+				pos, size := x-ink.Min.X, ink.Dx()
+				if !horizontal {
+					pos, size = y-ink.Min.Y, ink.Dy()
+				}
+				for i, in := range []bool{3*pos < size, 3*pos >= 2*size} {
+					if in {
+						sums[i] += float64(r>>8) - float64(b>>8)
+						counts[i]++
+					}
+				}
+			}
+		}
+		return sums[0] / float64(max(counts[0], 1)), sums[1] / float64(max(counts[1], 1))
+	}
+
+	for _, tc := range []struct {
+		name       string
+		angle      float64
+		opts       []WatermarkOption
+		horizontal bool
+	}{
+		{"left to right", 0, nil, true},
+		{"top to bottom", 270, []WatermarkOption{WithMaxWidth(120)}, false},
+		{"with a stroke", 0, []WatermarkOption{WithStroke(1, color.White)}, true},
+		{"vertical text", 270, []WatermarkOption{WithVerticalText()}, false},
+	} {
+		opts := append([]WatermarkOption{WithFontSize(36), WithPosition(PositionCenter), WithGradientFill(red, blue, tc.angle)}, tc.opts...)
+		img, err := New(image.NewRGBA(bounds)).AddTextWatermark("Gradient text", opts...).Image()
+		if err != nil {
+			t.Fatalf("%s: AddTextWatermark() with a gradient should not error, got: %v", tc.name, err)
+		}
+		first, last := redness(img, tc.horizontal)
+		if first < 50 || last > -50 {
+			t.Errorf("%s: gradient should run from red to blue, got redness %g then %g", tc.name, first, last)
+		}
+
+		// Prepared stamps fill the same way.
+		stamp, err := PrepareWatermark(append(opts, WithText("Gradient text"))...)
+		if err != nil {
+			t.Fatalf("%s: PrepareWatermark() with a gradient should not error, got: %v", tc.name, err)
+		}
+		first, last = redness(mustImage(t, New(image.NewRGBA(bounds)).ApplyStamp(stamp)), tc.horizontal)
+		if first < 50 || last > -50 {
+			t.Errorf("%s: stamp gradient should run from red to blue, got redness %g then %g", tc.name, first, last)
+		}
+	}
+
+	// Test case: Invalid input
+	if New(image.NewRGBA(bounds)).AddTextWatermark("x", WithGradientFill(nil, blue, 0)).Err() == nil {
+		t.Error("AddTextWatermark() with a nil gradient color should return an error")
+	}
+}
@@ -0,0 +1,330 @@
+package gopiq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// tgaHeaderSize is the size of the fixed TGA header.
+const tgaHeaderSize = 18
+
+// tgaSignature ends the footer of TGA 2.0 files.
+const tgaSignature = "TRUEVISION-XFILE.\x00"
+
+// TGA image types; the run-length encoded variants add 8.
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGray        = 3
+	tgaRLE         = 8
+)
+
+// WithTGARLE makes TGA output run-length encoded, which shrinks textures
+// with flat areas; all common tools read it, but some engines load only
+// uncompressed files, which are the default.
+func WithTGARLE() EncodeOption {
+	return func(eo *EncodeOptions) { eo.TGARLE = true }
+}
+
+// tgaHeader is the fixed header of a TGA file.
+type tgaHeader struct {
+	idLength                      int
+	hasColorMap                   bool
+	imageType                     int // Without tgaRLE
+	rle                           bool
+	mapFirst, mapLength, mapDepth int
+	width, height, depth          int
+	alphaBits                     int
+	rightToLeft, topDown          bool
+}
+
+// parseTGAHeader parses and validates the fixed TGA header at the start of
+// data. TGA files have no signature, so this is also how they are
+// detected.
+func parseTGAHeader(data []byte) (tgaHeader, error) {
+	if len(data) < tgaHeaderSize {
+		return tgaHeader{}, fmt.Errorf("tga: truncated header")
+	}
+	h := tgaHeader{
+		idLength:    int(data[0]),
+		hasColorMap: data[1] == 1,
+		imageType:   int(data[2] &^ tgaRLE),
+		rle:         data[2]&tgaRLE != 0,
+		mapFirst:    int(binary.LittleEndian.Uint16(data[3:])),
+		mapLength:   int(binary.LittleEndian.Uint16(data[5:])),
+		mapDepth:    int(data[7]),
+		width:       int(binary.LittleEndian.Uint16(data[12:])),
+		height:      int(binary.LittleEndian.Uint16(data[14:])),
+		depth:       int(data[16]),
+		alphaBits:   int(data[17] & 0x0f),
+		rightToLeft: data[17]&0x10 != 0,
+		topDown:     data[17]&0x20 != 0,
+	}
+	if data[1] > 1 || data[2] > tgaRLE+tgaGray || h.imageType < tgaColorMapped || h.imageType > tgaGray || data[17]&0xc0 != 0 {
+		return h, fmt.Errorf("tga: unsupported image type %d", data[2])
+	}
+	if h.hasColorMap && (h.mapLength == 0 || !slices.Contains([]int{15, 16, 24, 32}, h.mapDepth)) {
+		return h, fmt.Errorf("tga: invalid color map of %d %d-bit entries", h.mapLength, h.mapDepth)
+	}
+	var depths []int
+	switch h.imageType {
+	case tgaColorMapped:
+		if !h.hasColorMap {
+			return h, fmt.Errorf("tga: color-mapped image without a color map")
+		}
+		depths = []int{8, 16}
+	case tgaTrueColor:
+		depths = []int{15, 16, 24, 32}
+	case tgaGray:
+		depths = []int{8}
+	}
+	if !slices.Contains(depths, h.depth) {
+		return h, fmt.Errorf("tga: unsupported depth %d for image type %d", h.depth, h.imageType)
+	}
+	if h.width == 0 || h.height == 0 {
+		return h, fmt.Errorf("tga: invalid size %dx%d", h.width, h.height)
+	}
+	return h, nil
+}
+
+// isTGA reports whether data starts with a valid TGA header.
+func isTGA(data []byte) bool {
+	_, err := parseTGAHeader(data)
+	return err == nil
+}
+
+// tgaColor converts a little-endian TGA pixel or color map entry of depth
+// bits. The alpha of 32-bit and 16-bit colors is only used if alpha is
+// set, as the header of files with alpha says.
+func tgaColor(p []byte, depth int, alpha bool) color.NRGBA {
+	switch depth {
+	case 32:
+		c := color.NRGBA{p[2], p[1], p[0], 255}
+		if alpha {
+			c.A = p[3]
+		}
+		return c
+	case 24:
+		return color.NRGBA{p[2], p[1], p[0], 255}
+	default: // 15 or 16: 5 bits per channel and an attribute bit
+		v := binary.LittleEndian.Uint16(p)
+		scale := func(c uint16) uint8 { return uint8(c<<3 | c>>2) }
+		c := color.NRGBA{scale(v >> 10 & 31), scale(v >> 5 & 31), scale(v & 31), 255}
+		if depth == 16 && alpha && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	}
+}
+
+// readTGARLE expands run-length encoded pixels of bpp bytes into pix.
+func readTGARLE(r *bufio.Reader, pix []byte, bpp int) error {
+	for i := 0; i < len(pix); {
+		packet, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		n := (int(packet&0x7f) + 1) * bpp
+		if i+n > len(pix) {
+			return fmt.Errorf("run-length packet runs past the end of the image")
+		}
+		if packet&0x80 == 0 {
+			if _, err := io.ReadFull(r, pix[i:i+n]); err != nil {
+				return err
+			}
+		} else {
+			if _, err := io.ReadFull(r, pix[i:i+bpp]); err != nil {
+				return err
+			}
+			for j := i + bpp; j < i+n; j += bpp {
+				copy(pix[j:j+bpp], pix[i:i+bpp])
+			}
+		}
+		i += n
+	}
+	return nil
+}
+
+// decodeTGA decodes a TGA image, uncompressed or run-length encoded: gray
+// images into an *image.Gray and others into an *image.NRGBA.
+func decodeTGA(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, tgaHeaderSize)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, fmt.Errorf("tga: %w", err)
+	}
+	h, err := parseTGAHeader(head)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := br.Discard(h.idLength); err != nil {
+		return nil, fmt.Errorf("tga: %w", err)
+	}
+	alpha := h.alphaBits > 0
+	var palette []color.NRGBA
+	if h.hasColorMap {
+		size := (h.mapDepth + 7) / 8
+		entries := make([]byte, h.mapLength*size)
+		if _, err := io.ReadFull(br, entries); err != nil {
+			return nil, fmt.Errorf("tga: %w", err)
+		}
+		palette = make([]color.NRGBA, h.mapLength)
+		for i := range palette {
+			palette[i] = tgaColor(entries[i*size:], h.mapDepth, alpha)
+		}
+	}
+
+	bpp := (h.depth + 7) / 8
+	pix := make([]byte, h.width*h.height*bpp)
+	if h.rle {
+		err = readTGARLE(br, pix, bpp)
+	} else {
+		_, err = io.ReadFull(br, pix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tga: %w", err)
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	var gray *image.Gray
+	var nrgba *image.NRGBA
+	if h.imageType == tgaGray {
+		gray = image.NewGray(rect)
+	} else {
+		nrgba = image.NewNRGBA(rect)
+	}
+	for i := range h.width * h.height {
+		x, y := i%h.width, i/h.width
+		if h.rightToLeft {
+			x = h.width - 1 - x
+		}
+		if !h.topDown {
+			y = h.height - 1 - y
+		}
+		p := pix[i*bpp:]
+		switch h.imageType {
+		case tgaGray:
+			gray.Pix[y*gray.Stride+x] = p[0]
+		case tgaColorMapped:
+			index := int(p[0])
+			if bpp == 2 {
+				index = int(binary.LittleEndian.Uint16(p))
+			}
+			if index -= h.mapFirst; index < 0 || index >= len(palette) {
+				return nil, fmt.Errorf("tga: color %d is not in the color map", index+h.mapFirst)
+			}
+			nrgba.SetNRGBA(x, y, palette[index])
+		default:
+			nrgba.SetNRGBA(x, y, tgaColor(p, h.depth, alpha))
+		}
+	}
+	if gray != nil {
+		return gray, nil
+	}
+	return nrgba, nil
+}
+
+// appendTGARLE appends the pixels of bpp bytes of row as run-length packets,
+// which TGA 2.0 keeps within a row.
+func appendTGARLE(dst, row []byte, bpp int) []byte {
+	n := len(row) / bpp
+	same := func(i, j int) bool { return bytes.Equal(row[i*bpp:(i+1)*bpp], row[j*bpp:(j+1)*bpp]) }
+	for i := 0; i < n; {
+		run := 1
+		for i+run < n && run < 128 && same(i, i+run) {
+			run++
+		}
+		if run > 1 {
+			dst = append(dst, byte(0x80|(run-1)))
+			dst = append(dst, row[i*bpp:(i+1)*bpp]...)
+			i += run
+			continue
+		}
+		start := i
+		for i < n && i-start < 128 && !(i+1 < n && same(i, i+1)) {
+			i++
+		}
+		dst = append(dst, byte(i-start-1))
+		dst = append(dst, row[start*bpp:i*bpp]...)
+	}
+	return dst
+}
+
+// encodeTGA writes img as a top-down TGA 2.0 file a row at a time: 8-bit
+// gray for *image.Gray, 24-bit for opaque images and 32-bit with alpha
+// otherwise, run-length encoded if rle is set.
+func encodeTGA(w io.Writer, img image.Image, rle bool) error {
+	b := img.Bounds()
+	if b.Empty() || b.Dx() > 65535 || b.Dy() > 65535 {
+		return fmt.Errorf("TGA images must be from 1x1 to 65535x65535 pixels (got: %dx%d)", b.Dx(), b.Dy())
+	}
+	imageType, depth, alphaBits := tgaTrueColor, 32, 8
+	if _, ok := img.(*image.Gray); ok {
+		imageType, depth, alphaBits = tgaGray, 8, 0
+	} else if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		depth, alphaBits = 24, 0
+	}
+	if rle {
+		imageType |= tgaRLE
+	}
+	head := make([]byte, tgaHeaderSize)
+	head[2] = byte(imageType)
+	binary.LittleEndian.PutUint16(head[12:], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(head[14:], uint16(b.Dy()))
+	head[16] = byte(depth)
+	head[17] = byte(alphaBits) | 0x20 // Top-down
+
+	bw := bufio.NewWriter(w)
+	bw.Write(head)
+	bpp := depth / 8
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), 1))
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), 1))
+	row := make([]byte, b.Dx()*bpp)
+	var packed []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if bpp == 1 {
+			draw.Draw(gray, gray.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+			copy(row, gray.Pix)
+		} else {
+			// Straight-alpha pixels are copied and premultiplied ones
+			// converted with rounding, so that alpha round-trips exactly.
+			switch m := img.(type) {
+			case *image.NRGBA:
+				copy(nrgba.Pix, m.Pix[m.PixOffset(b.Min.X, y):])
+			case *image.RGBA:
+				s := m.Pix[m.PixOffset(b.Min.X, y):][:4*b.Dx()]
+				for i := 0; i < len(s); i += 4 {
+					a := s[i+3]
+					nrgba.Pix[i], nrgba.Pix[i+1], nrgba.Pix[i+2], nrgba.Pix[i+3] = unpremultiply(s[i], a), unpremultiply(s[i+1], a), unpremultiply(s[i+2], a), a
+				}
+			default:
+				draw.Draw(nrgba, nrgba.Rect, img, image.Pt(b.Min.X, y), draw.Src)
+			}
+			for x := range b.Dx() {
+				p, q := nrgba.Pix[4*x:], row[x*bpp:]
+				q[0], q[1], q[2] = p[2], p[1], p[0]
+				if bpp == 4 {
+					q[3] = p[3]
+				}
+			}
+		}
+		if rle {
+			packed = appendTGARLE(packed[:0], row, bpp)
+			bw.Write(packed)
+		} else {
+			bw.Write(row)
+		}
+	}
+	// No extension or developer areas.
+	bw.Write(make([]byte, 8))
+	bw.WriteString(tgaSignature)
+	return bw.Flush()
+}
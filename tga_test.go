@@ -0,0 +1,148 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// colorMappedTGA returns a bottom-up, run-length encoded 3×2 TGA with a
+// color map of red and blue starting at index 1: a red bottom row, and a
+// top row of red, blue and blue.
+func colorMappedTGA() []byte {
+	return []byte{
+		0, 1, tgaColorMapped | tgaRLE, 1, 0, 2, 0, 24, 0, 0, 0, 0, 3, 0, 2, 0, 8, 0,
+		0, 0, 255, 255, 0, 0, // Red and blue, as BGR
+		0x83, 1, // A run of four red pixels, across rows
+		0x01, 2, 2, // Two blue pixels as they are
+	}
+}
+
+func TestToBytesTGA(t *testing.T) {
+	src := gradientImage(40, 30)
+	data, err := New(src).ToBytes(FormatTGA)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatTGA) should not error, got: %v", err)
+	}
+	if DetectFormat(data) != FormatTGA || FormatFromString("tga") != FormatTGA || FormatTGA.String() != "tga" {
+		t.Error("FormatTGA should be detected and named tga")
+	}
+	if data[16] != 24 || len(data) != tgaHeaderSize+40*30*3+26 || !bytes.HasSuffix(data, []byte(tgaSignature)) {
+		t.Errorf("opaque TGA has depth %d and %d bytes, want a 24-bit TGA 2.0 file", data[16], len(data))
+	}
+	got, err := FromBytes(data).ToRGBA()
+	if err != nil || !bytes.Equal(got.Pix, src.Pix) {
+		t.Errorf("TGA round trip differs, error %v", err)
+	}
+	info, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil || info != (ImageInfo{Width: 40, Height: 30, Format: FormatTGA}) {
+		t.Errorf("ProbeReaderAt() = %+v, %v, want 40x30 tga", info, err)
+	}
+
+	// Textures keep their alpha; run-length encoding shrinks flat areas.
+	texture := createUniformImage(64, 64, color.RGBA{0, 0, 0, 0})
+	texture.SetRGBA(10, 10, color.RGBA{100, 50, 0, 128})
+	texture.SetRGBA(11, 10, color.RGBA{200, 100, 50, 255})
+	raw, _ := New(texture).ToBytes(FormatTGA)
+	data, err = New(texture).ToBytes(FormatTGA, WithTGARLE())
+	if err != nil {
+		t.Fatalf("ToBytes(FormatTGA) with WithTGARLE should not error, got: %v", err)
+	}
+	if data[2] != tgaTrueColor|tgaRLE || data[16] != 32 || data[17]&0x0f != 8 {
+		t.Errorf("RLE TGA header has type %d, depth %d and descriptor %#x, want 32-bit RLE with alpha", data[2], data[16], data[17])
+	}
+	if len(data)*10 > len(raw) {
+		t.Errorf("RLE TGA of a flat texture is %d bytes, want a tenth of the %d bytes uncompressed", len(data), len(raw))
+	}
+	img := mustImage(t, FromBytes(data))
+	if c := img.(*image.NRGBA).NRGBAAt(10, 10); c != (color.NRGBA{199, 100, 0, 128}) {
+		t.Errorf("translucent pixel = %v, want straight alpha {199 100 0 128}", c)
+	}
+	if got, err := FromBytes(data).ToRGBA(); err != nil || !bytes.Equal(got.Pix, texture.Pix) {
+		t.Errorf("premultiplied TGA round trip differs, error %v", err)
+	}
+	// Straight alpha is written as it is.
+	straight := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range straight.Pix {
+		straight.Pix[i] = uint8(i * 37 % 251)
+	}
+	data, _ = New(straight).ToBytes(FormatTGA, WithTGARLE())
+	if got, ok := mustImage(t, FromBytes(data)).(*image.NRGBA); !ok || !bytes.Equal(got.Pix, straight.Pix) {
+		t.Error("straight-alpha TGA round trip differs")
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 7, 3))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 12)
+	}
+	data, _ = New(gray).ToBytes(FormatTGA, WithTGARLE())
+	if got, ok := mustImage(t, FromBytes(data)).(*image.Gray); !ok || !bytes.Equal(got.Pix, gray.Pix) {
+		t.Error("gray TGA does not decode to the same *image.Gray")
+	}
+
+	// Test case: Invalid input
+	if _, err := New(image.NewRGBA(image.Rect(0, 0, 70000, 1))).ToBytes(FormatTGA); err == nil {
+		t.Error("ToBytes(FormatTGA) of an image wider than 65535 pixels should return an error")
+	}
+	valid, _ := New(src).ToBytes(FormatTGA)
+	badDepth := bytes.Clone(valid)
+	badDepth[16] = 12
+	for name, data := range map[string][]byte{"truncated": valid[:tgaHeaderSize-1], "invalid": badDepth} {
+		if info, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("ProbeReaderAt() of a TGA with a %s header = %+v, want an error", name, info)
+		}
+	}
+}
+
+func TestDecodeTGA(t *testing.T) {
+	img := mustImage(t, FromBytes(colorMappedTGA()))
+	if img.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("color-mapped TGA bounds = %v, want 3x2", img.Bounds())
+	}
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	for p, want := range map[image.Point]color.NRGBA{{0, 1}: red, {2, 1}: red, {0, 0}: red, {1, 0}: blue, {2, 0}: blue} {
+		if c := img.(*image.NRGBA).NRGBAAt(p.X, p.Y); c != want {
+			t.Errorf("color-mapped pixel at %v = %v, want %v", p, c, want)
+		}
+	}
+
+	// 16-bit pixels with an attribute bit for alpha, top-down and right to left.
+	data := []byte{0, 0, tgaTrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 1, 0, 16, 0x31, 0x00, 0xfc, 0x1f, 0x00}
+	img = mustImage(t, FromBytes(data))
+	if c := img.(*image.NRGBA).NRGBAAt(1, 0); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("first 16-bit pixel, drawn right to left = %v, want opaque red", c)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(0, 0); c.A != 0 || c.B != 255 {
+		t.Errorf("second 16-bit pixel = %v, want transparent blue", c)
+	}
+
+	// Test case: Invalid input
+	badIndex := colorMappedTGA()
+	badIndex[len(badIndex)-1] = 0
+	overrun := colorMappedTGA()
+	overrun[len(overrun)-5] = 0x86
+	for name, data := range map[string][]byte{
+		"truncated pixels":    colorMappedTGA()[:len(colorMappedTGA())-1],
+		"index out of map":    badIndex,
+		"run past the end":    overrun,
+		"unsupported depth":   {0, 0, tgaGray, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 24, 0, 0, 0, 0},
+		"truncated color map": colorMappedTGA()[:20],
+	} {
+		if err := FromBytes(data).Err(); err == nil {
+			t.Errorf("FromBytes() of a TGA with %s should return an error", name)
+		}
+	}
+}
+
+func TestAppendTGARLE(t *testing.T) {
+	row := []byte{1, 1, 1, 2, 3, 4, 4}
+	want := []byte{0x82, 1, 0x01, 2, 3, 0x81, 4}
+	if got := appendTGARLE(nil, row, 1); !bytes.Equal(got, want) {
+		t.Errorf("appendTGARLE(%v) = %v, want %v", row, got, want)
+	}
+	long := bytes.Repeat([]byte{9, 8}, 200)
+	if got := appendTGARLE(nil, long, 2); !bytes.Equal(got, []byte{0xff, 9, 8, 0xc7, 9, 8}) {
+		t.Errorf("appendTGARLE() of 200 equal pixels = %v, want runs of 128 and 72", got)
+	}
+}
@@ -0,0 +1,442 @@
+package gopiq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"slices"
+
+	"golang.org/x/image/tiff" // Also registers TIFF decoding
+)
+
+// TIFFCompression selects how the pages of TIFF output are compressed. All
+// of them are lossless.
+type TIFFCompression int
+
+const (
+	TIFFDeflate      TIFFCompression = iota // zlib with a horizontal predictor; the default
+	TIFFUncompressed                        // Raw samples, for the simplest readers
+	TIFFPackBits                            // Run-length coding; fast, and suits scans with flat areas
+)
+
+// WithTIFFCompression sets the compression of TIFF output; the default is
+// TIFFDeflate, which gives the smallest files.
+func WithTIFFCompression(c TIFFCompression) EncodeOption {
+	return func(eo *EncodeOptions) { eo.TIFFCompression = c }
+}
+
+// TIFF field types and tags written by encodeTIFF.
+const (
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+
+	tiffTagWidth           = 256
+	tiffTagHeight          = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagXResolution     = 282
+	tiffTagYResolution     = 283
+	tiffTagResolutionUnit  = 296
+	tiffTagPredictor       = 317
+	tiffTagExtraSamples    = 338
+
+	// tiffStripSize is the size that strips of uncompressed samples are
+	// kept below, so readers can decode a page piece by piece.
+	tiffStripSize = 64 << 10
+)
+
+// tiffEntry is a field of a TIFF image file directory.
+type tiffEntry struct {
+	tag, typ uint16
+	values   []uint32 // Rationals take two values each
+}
+
+// tiffSamples returns a copy of the samples of img row by row, 16-bit ones
+// little-endian, with the fields that describe them, BitsPerSample first:
+// gray for *image.Gray and *image.Gray16, RGB for opaque images and RGB
+// with associated (premultiplied) alpha otherwise.
+func tiffSamples(img image.Image) (pix []byte, rowBytes int, fields []tiffEntry) {
+	b := img.Bounds()
+	switch src := img.(type) {
+	case *image.Gray:
+		pix = make([]byte, b.Dx()*b.Dy())
+		copyRows(pix, b.Dx(), src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, b.Dx(), b.Dy())
+		return pix, b.Dx(), []tiffEntry{
+			{tiffTagBitsPerSample, tiffShort, []uint32{8}},
+			{tiffTagPhotometric, tiffShort, []uint32{1}}, // Black is zero
+			{tiffTagSamplesPerPixel, tiffShort, []uint32{1}},
+		}
+	case *image.Gray16:
+		pix = make([]byte, 2*b.Dx()*b.Dy())
+		copyRows(pix, 2*b.Dx(), src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, 2*b.Dx(), b.Dy())
+		for i := 0; i < len(pix); i += 2 {
+			pix[i], pix[i+1] = pix[i+1], pix[i]
+		}
+		return pix, 2 * b.Dx(), []tiffEntry{
+			{tiffTagBitsPerSample, tiffShort, []uint32{16}},
+			{tiffTagPhotometric, tiffShort, []uint32{1}},
+			{tiffTagSamplesPerPixel, tiffShort, []uint32{1}},
+		}
+	}
+
+	rgba := asRGBA(img)
+	pix = make([]byte, 4*b.Dx()*b.Dy())
+	copyRows(pix, 4*b.Dx(), rgba.Pix, rgba.Stride, 4*b.Dx(), b.Dy())
+	opaque := true
+	for i := 3; i < len(pix) && opaque; i += 4 {
+		opaque = pix[i] == 255
+	}
+	if !opaque {
+		return pix, 4 * b.Dx(), []tiffEntry{
+			{tiffTagBitsPerSample, tiffShort, []uint32{8, 8, 8, 8}},
+			{tiffTagPhotometric, tiffShort, []uint32{2}}, // RGB
+			{tiffTagSamplesPerPixel, tiffShort, []uint32{4}},
+			{tiffTagExtraSamples, tiffShort, []uint32{1}}, // Associated alpha
+		}
+	}
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	for i := 0; i < len(pix); i += 4 {
+		rgb = append(rgb, pix[i:i+3]...)
+	}
+	return rgb, 3 * b.Dx(), []tiffEntry{
+		{tiffTagBitsPerSample, tiffShort, []uint32{8, 8, 8}},
+		{tiffTagPhotometric, tiffShort, []uint32{2}},
+		{tiffTagSamplesPerPixel, tiffShort, []uint32{3}},
+	}
+}
+
+// tiffPredict replaces the samples of each row of pix, from the second
+// pixel on, with their difference to the same sample of the pixel before.
+// sampleBytes is 1 or 2, for 16-bit little-endian samples.
+func tiffPredict(pix []byte, rowBytes, pixelBytes, sampleBytes int) {
+	for row := 0; row < len(pix); row += rowBytes {
+		r := pix[row : row+rowBytes]
+		for i := len(r) - sampleBytes; i >= pixelBytes; i -= sampleBytes {
+			if sampleBytes == 2 {
+				v := binary.LittleEndian.Uint16(r[i:]) - binary.LittleEndian.Uint16(r[i-pixelBytes:])
+				binary.LittleEndian.PutUint16(r[i:], v)
+			} else {
+				r[i] -= r[i-pixelBytes]
+			}
+		}
+	}
+}
+
+// packBits appends the PackBits coding of row to dst: runs of three or more
+// equal bytes are stored once with their length, other bytes as they are.
+func packBits(dst, row []byte) []byte {
+	for len(row) > 0 {
+		run := 1
+		for run < len(row) && run < 128 && row[run] == row[0] {
+			run++
+		}
+		if run >= 3 {
+			dst = append(dst, byte(1-run), row[0]) // Repeat the next byte 1-n times
+			row = row[run:]
+			continue
+		}
+		n := 0
+		for n < len(row) && n < 128 && !(n+2 < len(row) && row[n] == row[n+1] && row[n] == row[n+2]) {
+			n++
+		}
+		dst = append(dst, byte(n-1)) // Copy the next n bytes
+		dst = append(dst, row[:n]...)
+		row = row[n:]
+	}
+	return dst
+}
+
+// tiffStrips splits the samples of a page into compressed strips and returns
+// them with the fields of the page that describe them, apart from the strip
+// offsets.
+func tiffStrips(img image.Image, compression TIFFCompression) ([][]byte, []tiffEntry, error) {
+	pix, rowBytes, fields := tiffSamples(img)
+	b := img.Bounds()
+	rowsPerStrip := max(1, min(b.Dy(), tiffStripSize/rowBytes))
+	var code uint32
+	switch compression {
+	case TIFFDeflate:
+		code = 8
+		bits := fields[0].values // BitsPerSample
+		samples, sampleBytes := len(bits), int(bits[0]/8)
+		tiffPredict(pix, rowBytes, samples*sampleBytes, sampleBytes)
+		fields = append(fields, tiffEntry{tiffTagPredictor, tiffShort, []uint32{2}}) // Horizontal differencing
+	case TIFFUncompressed:
+		code = 1
+	case TIFFPackBits:
+		code = 32773
+	default:
+		return nil, nil, fmt.Errorf("unknown TIFF compression %d", compression)
+	}
+
+	var strips [][]byte
+	var counts []uint32
+	stripBytes := rowsPerStrip * rowBytes
+	for start := 0; start < len(pix); start += stripBytes {
+		raw := pix[start:min(start+stripBytes, len(pix))]
+		var strip []byte
+		switch compression {
+		case TIFFDeflate:
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			if _, err := zw.Write(raw); err != nil {
+				return nil, nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, nil, err
+			}
+			strip = buf.Bytes()
+		case TIFFPackBits:
+			// Rows are packed separately.
+			for row := 0; row < len(raw); row += rowBytes {
+				strip = packBits(strip, raw[row:row+rowBytes])
+			}
+		default:
+			strip = raw
+		}
+		strips = append(strips, strip)
+		counts = append(counts, uint32(len(strip)))
+	}
+	fields = append(fields,
+		tiffEntry{tiffTagWidth, tiffLong, []uint32{uint32(b.Dx())}},
+		tiffEntry{tiffTagHeight, tiffLong, []uint32{uint32(b.Dy())}},
+		tiffEntry{tiffTagCompression, tiffShort, []uint32{code}},
+		tiffEntry{tiffTagRowsPerStrip, tiffLong, []uint32{uint32(rowsPerStrip)}},
+		tiffEntry{tiffTagStripByteCounts, tiffLong, counts},
+		// Readers expect a resolution; there is none to keep.
+		tiffEntry{tiffTagXResolution, tiffRational, []uint32{72, 1}},
+		tiffEntry{tiffTagYResolution, tiffRational, []uint32{72, 1}},
+		tiffEntry{tiffTagResolutionUnit, tiffShort, []uint32{2}}, // Inch
+	)
+	return strips, fields, nil
+}
+
+// appendTIFFDirectory appends an image file directory of fields to out,
+// at an even offset, and stores that offset at next. It returns out and
+// where the offset of the directory that follows goes.
+func appendTIFFDirectory(out []byte, next int, fields []tiffEntry) ([]byte, int) {
+	slices.SortFunc(fields, func(a, b tiffEntry) int { return int(a.tag) - int(b.tag) })
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+	binary.LittleEndian.PutUint32(out[next:], uint32(len(out)))
+	var data []byte
+	dataStart := len(out) + 2 + 12*len(fields) + 4
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(fields)))
+	for _, f := range fields {
+		var value []byte
+		for _, v := range f.values {
+			if f.typ == tiffShort {
+				value = binary.LittleEndian.AppendUint16(value, uint16(v))
+			} else {
+				value = binary.LittleEndian.AppendUint32(value, v)
+			}
+		}
+		count := len(f.values)
+		if f.typ == tiffRational {
+			count /= 2
+		}
+		out = binary.LittleEndian.AppendUint16(out, f.tag)
+		out = binary.LittleEndian.AppendUint16(out, f.typ)
+		out = binary.LittleEndian.AppendUint32(out, uint32(count))
+		if len(value) <= 4 {
+			out = append(out, value...)
+			out = append(out, make([]byte, 4-len(value))...)
+			continue
+		}
+		// Longer values follow the directory, at even offsets.
+		out = binary.LittleEndian.AppendUint32(out, uint32(dataStart+len(data)))
+		data = append(data, value...)
+		if len(data)%2 != 0 {
+			data = append(data, 0)
+		}
+	}
+	next = len(out)
+	out = append(out, 0, 0, 0, 0) // No further directory, until one is added
+	return append(out, data...), next
+}
+
+// encodeTIFF writes pages as a little-endian TIFF file with an image file
+// directory for each page.
+func encodeTIFF(w io.Writer, pages []image.Image, compression TIFFCompression) error {
+	out := []byte("II*\x00\x00\x00\x00\x00")
+	next := 4 // Where the offset of the next directory goes
+	for i, img := range pages {
+		if img.Bounds().Empty() {
+			return fmt.Errorf("cannot encode an empty image as TIFF page %d", i)
+		}
+		strips, fields, err := tiffStrips(img, compression)
+		if err != nil {
+			return err
+		}
+		offsets := make([]uint32, len(strips))
+		for j, s := range strips {
+			offsets[j] = uint32(len(out))
+			out = append(out, s...)
+		}
+		fields = append(fields, tiffEntry{tiffTagStripOffsets, tiffLong, offsets})
+		out, next = appendTIFFDirectory(out, next, fields)
+		if len(out) > math.MaxUint32 {
+			return fmt.Errorf("TIFF output exceeds the 4 GiB limit of the format")
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// tiffDirectories returns the offsets of the image file directories of a
+// TIFF file, one per page, and its byte order.
+func tiffDirectories(data []byte) ([]uint32, binary.ByteOrder, error) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("truncated TIFF header")
+	}
+	var dirs []uint32
+	for off := order.Uint32(data[4:]); off != 0; {
+		if slices.Contains(dirs, off) {
+			return nil, nil, fmt.Errorf("TIFF page %d refers back to an earlier page", len(dirs))
+		}
+		if int64(off)+2 > int64(len(data)) {
+			return nil, nil, fmt.Errorf("TIFF page %d lies beyond the end of the file", len(dirs))
+		}
+		end := int64(off) + 2 + 12*int64(order.Uint16(data[off:])) + 4
+		if end > int64(len(data)) {
+			return nil, nil, fmt.Errorf("TIFF page %d is truncated", len(dirs))
+		}
+		dirs = append(dirs, off)
+		off = order.Uint32(data[end-4:])
+	}
+	if len(dirs) == 0 {
+		return nil, nil, fmt.Errorf("TIFF file has no pages")
+	}
+	return dirs, order, nil
+}
+
+// tiffPageReader reads a TIFF file as if the directory at the offset in
+// header were its first one, so any page can be decoded like the first.
+type tiffPageReader struct {
+	data   []byte
+	header [8]byte
+}
+
+func (r *tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off < int64(len(r.header)) {
+		copy(p[:n], r.header[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// decodeTIFFPage decodes the page of data whose directory is at offset dir.
+func decodeTIFFPage(data []byte, dir uint32, order binary.ByteOrder, do *DecodeOptions) (image.Image, error) {
+	r := &tiffPageReader{data: data}
+	copy(r.header[:], data[:8])
+	order.PutUint32(r.header[4:], dir)
+	img, err := tiff.Decode(io.NewSectionReader(r, 0, int64(len(data))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return do.apply(img), nil
+}
+
+// TIFFPageCount returns the number of pages of a TIFF file, e.g. a scanned
+// multi-page document, without decoding them.
+// Returns an error if data is not a TIFF file or its page list is corrupt.
+func TIFFPageCount(data []byte) (int, error) {
+	dirs, _, err := tiffDirectories(data)
+	return len(dirs), err
+}
+
+// FromTIFFPage creates a new ImageProcessor by decoding page (counted from
+// 0) of a multi-page TIFF file, where FromBytes decodes the first page.
+// Decode options such as WithGrayDecode apply as in FromBytes.
+// Returns an error if data is not a TIFF file, the page does not exist or
+// decoding fails.
+func FromTIFFPage(data []byte, page int, options ...DecodeOption) *ImageProcessor {
+	dirs, order, err := tiffDirectories(data)
+	if err != nil {
+		return &ImageProcessor{err: err}
+	}
+	if page < 0 || page >= len(dirs) {
+		return &ImageProcessor{err: fmt.Errorf("TIFF page %d does not exist: the file has %d pages", page, len(dirs))}
+	}
+	img, err := decodeTIFFPage(data, dirs[page], order, newDecodeOptions(options))
+	if err != nil {
+		return &ImageProcessor{err: err}
+	}
+	return New(img)
+}
+
+// ForEachTIFFPage decodes the pages of a multi-page TIFF file in order and
+// calls fn with the page number and a processor for each, e.g. to process
+// and encode every page of a scanned document. Pages are decoded one at a
+// time, so long documents need not fit in memory at once. Decode options
+// such as WithGrayDecode apply as in FromBytes.
+// Returns an error if data is not a TIFF file, a page cannot be decoded or
+// fn returns an error, which stops the iteration.
+func ForEachTIFFPage(data []byte, fn func(page int, ip *ImageProcessor) error, options ...DecodeOption) error {
+	if fn == nil {
+		return fmt.Errorf("page function cannot be nil")
+	}
+	dirs, order, err := tiffDirectories(data)
+	if err != nil {
+		return err
+	}
+	do := newDecodeOptions(options)
+	for i, dir := range dirs {
+		img, err := decodeTIFFPage(data, dir, order, do)
+		if err != nil {
+			return fmt.Errorf("TIFF page %d: %w", i, err)
+		}
+		if err := fn(i, New(img)); err != nil {
+			return fmt.Errorf("TIFF page %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ToMultiPageTIFF encodes pages as one multi-page TIFF file, e.g. after
+// processing the pages of a document with ForEachTIFFPage. Gray images are
+// stored as gray, other images as RGB with alpha only if they have
+// transparent pixels. WithTIFFCompression sets the compression; other
+// encode options are ignored.
+// Returns an error if there are no pages, a page is nil or empty, or the
+// compression is unknown.
+func ToMultiPageTIFF(pages []image.Image, opts ...EncodeOption) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("TIFF needs at least one page")
+	}
+	if i := slices.Index(pages, nil); i >= 0 {
+		return nil, fmt.Errorf("page %d cannot be nil", i)
+	}
+	eo := newEncodeOptions(EncodeOptions{}, opts)
+	var buf bytes.Buffer
+	if err := encodeTIFF(&buf, pages, eo.TIFFCompression); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,221 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// bigEndianTIFF returns a big-endian TIFF with a 1×1 uncompressed gray page
+// of each value, as written by other tools.
+func bigEndianTIFF(values ...uint8) []byte {
+	data := []byte("MM\x00*\x00\x00\x00\x00")
+	next := 4
+	for _, v := range values {
+		data = append(data, v, 0)
+		binary.BigEndian.PutUint32(data[next:], uint32(len(data)))
+		fields := [][3]uint32{{256, 3, 1}, {257, 3, 1}, {258, 3, 8}, {259, 3, 1}, {262, 3, 1}, {273, 4, uint32(len(data) - 2)}, {278, 3, 1}, {279, 4, 1}}
+		data = binary.BigEndian.AppendUint16(data, uint16(len(fields)))
+		for _, f := range fields {
+			data = binary.BigEndian.AppendUint16(data, uint16(f[0]))
+			data = binary.BigEndian.AppendUint16(data, uint16(f[1]))
+			data = binary.BigEndian.AppendUint32(data, 1)
+			if f[1] == 3 {
+				data = binary.BigEndian.AppendUint16(data, uint16(f[2]))
+				data = append(data, 0, 0)
+			} else {
+				data = binary.BigEndian.AppendUint32(data, f[2])
+			}
+		}
+		next = len(data)
+		data = append(data, 0, 0, 0, 0)
+	}
+	return data
+}
+
+func TestDecodeTIFFCorruptOffset(t *testing.T) {
+	// BitsPerSample with its values at an offset near 4 GiB, which a
+	// buffering reader would try to read up to.
+	data := bigEndianTIFF(1)
+	binary.BigEndian.PutUint32(data[40:], 3)
+	binary.BigEndian.PutUint32(data[44:], 0xffffff8c)
+
+	// Test case: Invalid input
+	if FromBytes(data).Err() == nil {
+		t.Error("FromBytes() with a TIFF offset past the end should return an error")
+	}
+	if FromReaderAt(bytes.NewReader(data), int64(len(data))).Err() == nil {
+		t.Error("FromReaderAt() with a TIFF offset past the end should return an error")
+	}
+	if _, err := ProbeReaderAt(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("ProbeReaderAt() with a TIFF offset past the end should return an error")
+	}
+}
+
+func TestToBytesTIFF(t *testing.T) {
+	// Tall enough for several strips.
+	src := gradientImage(300, 300)
+	translucent := gradientImage(40, 30)
+	translucent.SetRGBA(5, 5, color.RGBA{10, 20, 30, 128})
+	translucent.SetRGBA(6, 5, color.RGBA{})
+	gray := image.NewGray(image.Rect(0, 0, 50, 20))
+	gray16 := image.NewGray16(image.Rect(0, 0, 50, 20))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+	for i := range 50 * 20 {
+		gray16.SetGray16(i%50, i/50, color.Gray16{Y: uint16(i * 997)})
+	}
+
+	sizes := map[TIFFCompression]int{}
+	for name, c := range map[string]TIFFCompression{"deflate": TIFFDeflate, "uncompressed": TIFFUncompressed, "packbits": TIFFPackBits} {
+		for _, img := range []image.Image{src, translucent, gray, gray16} {
+			data, err := New(img).ToBytes(FormatTIFF, WithTIFFCompression(c))
+			if err != nil {
+				t.Fatalf("%s ToBytes(FormatTIFF) should not error, got: %v", name, err)
+			}
+			if got := DetectFormat(data); got != FormatTIFF {
+				t.Fatalf("%s TIFF detected as %s", name, got)
+			}
+			decoded := mustImage(t, FromBytes(data))
+			switch want := img.(type) {
+			case *image.Gray:
+				if got, ok := decoded.(*image.Gray); !ok || !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("%s gray TIFF does not decode to the same *image.Gray", name)
+				}
+			case *image.Gray16:
+				if got, ok := decoded.(*image.Gray16); !ok || !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("%s 16-bit gray TIFF does not decode to the same *image.Gray16", name)
+				}
+			case *image.RGBA:
+				got, _ := New(decoded).ToRGBA()
+				if !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("%s TIFF of %v does not decode to the same pixels", name, want.Rect)
+				}
+				if want == src {
+					sizes[c] = len(data)
+				}
+			}
+		}
+	}
+	if sizes[TIFFDeflate]*10 > sizes[TIFFUncompressed] {
+		t.Errorf("deflate TIFF of a gradient is %d bytes, want a tenth of the %d bytes uncompressed", sizes[TIFFDeflate], sizes[TIFFUncompressed])
+	}
+	// PackBits only shrinks runs, such as the margins of a scanned page.
+	page := createUniformImage(200, 100, color.RGBA{255, 255, 255, 255})
+	packed, _ := New(page).ToBytes(FormatTIFF, WithTIFFCompression(TIFFPackBits))
+	raw, _ := New(page).ToBytes(FormatTIFF, WithTIFFCompression(TIFFUncompressed))
+	if len(packed)*10 > len(raw) {
+		t.Errorf("packbits TIFF of a blank page is %d bytes, want a tenth of the %d bytes uncompressed", len(packed), len(raw))
+	}
+	if FormatFromString("tif") != FormatTIFF || FormatTIFF.String() != "tiff" {
+		t.Error("FormatTIFF should be named tiff")
+	}
+
+	// Test case: Invalid input
+	if _, err := New(src).ToBytes(FormatTIFF, WithTIFFCompression(TIFFCompression(9))); err == nil {
+		t.Error("ToBytes(FormatTIFF) with an unknown compression should return an error")
+	}
+}
+
+func TestPackBits(t *testing.T) {
+	row := []byte{1, 1, 1, 1, 2, 3, 3, 4, 5, 5, 5}
+	want := []byte{0xfd, 1, 3, 2, 3, 3, 4, 0xfe, 5}
+	if got := packBits(nil, row); !bytes.Equal(got, want) {
+		t.Errorf("packBits(%v) = %v, want %v", row, got, want)
+	}
+	long := bytes.Repeat([]byte{7}, 300)
+	if got := packBits(nil, long); !bytes.Equal(got, []byte{0x81, 7, 0x81, 7, 0xd5, 7}) {
+		t.Errorf("packBits() of 300 equal bytes = %v, want runs of 128, 128 and 44", got)
+	}
+}
+
+func TestMultiPageTIFF(t *testing.T) {
+	pages := []image.Image{createTestImage(20, 10), gradientImage(16, 16), createUniformImage(8, 4, color.RGBA{0, 0, 255, 255})}
+	data, err := ToMultiPageTIFF(pages)
+	if err != nil {
+		t.Fatalf("ToMultiPageTIFF() should not error, got: %v", err)
+	}
+	if n, err := TIFFPageCount(data); n != 3 || err != nil {
+		t.Fatalf("TIFFPageCount() = %d, %v, want 3 pages", n, err)
+	}
+	if got := mustImage(t, FromBytes(data)).Bounds(); got != pages[0].Bounds() {
+		t.Errorf("FromBytes() of a multi-page TIFF decoded %v, want the first page", got)
+	}
+	second, err := FromTIFFPage(data, 1).ToRGBA()
+	if err != nil {
+		t.Fatalf("FromTIFFPage(1) should not error, got: %v", err)
+	}
+	if !bytes.Equal(second.Pix, pages[1].(*image.RGBA).Pix) {
+		t.Error("FromTIFFPage(1) does not decode to the second page")
+	}
+
+	// Process every page and write the document back.
+	var processed []image.Image
+	err = ForEachTIFFPage(data, func(page int, ip *ImageProcessor) error {
+		img, err := ip.Grayscale().Image()
+		processed = append(processed, img)
+		return err
+	})
+	if err != nil || len(processed) != 3 {
+		t.Fatalf("ForEachTIFFPage() processed %d pages with error %v, want 3 pages", len(processed), err)
+	}
+	out, err := ToMultiPageTIFF(processed, WithTIFFCompression(TIFFPackBits))
+	if err != nil {
+		t.Fatalf("ToMultiPageTIFF() of processed pages should not error, got: %v", err)
+	}
+	if c := color.RGBAModel.Convert(mustImage(t, FromTIFFPage(out, 2)).At(3, 3)).(color.RGBA); c.R != c.G || c.G != c.B {
+		t.Errorf("processed page 2 = %v, want gray", c)
+	}
+
+	// Pages written by other tools, big-endian.
+	be := bigEndianTIFF(10, 200)
+	var values []uint8
+	err = ForEachTIFFPage(be, func(page int, ip *ImageProcessor) error {
+		img, err := ip.Image()
+		if err == nil {
+			values = append(values, img.(*image.Gray).Pix[0])
+		}
+		return err
+	})
+	if err != nil || !bytes.Equal(values, []uint8{10, 200}) {
+		t.Errorf("big-endian pages = %v, %v, want [10 200]", values, err)
+	}
+}
+
+func TestMultiPageTIFFInvalidInput(t *testing.T) {
+	data, err := ToMultiPageTIFF([]image.Image{createTestImage(4, 4), createTestImage(4, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	looped := bigEndianTIFF(1, 2)
+	binary.BigEndian.PutUint32(looped[len(looped)-4:], binary.BigEndian.Uint32(looped[4:]))
+	stop := errors.New("stop")
+
+	// Test case: Invalid input
+	cases := map[string]error{
+		"page out of range": FromTIFFPage(data, 2).Err(),
+		"negative page":     FromTIFFPage(data, -1).Err(),
+		"not a TIFF":        FromTIFFPage([]byte("GIF89a"), 0).Err(),
+		"truncated":         FromTIFFPage(data[:20], 1).Err(),
+		"page loop":         ForEachTIFFPage(looped, func(int, *ImageProcessor) error { return nil }),
+		"nil function":      ForEachTIFFPage(data, nil),
+	}
+	_, cases["no pages"] = ToMultiPageTIFF(nil)
+	_, cases["nil page"] = ToMultiPageTIFF([]image.Image{createTestImage(4, 4), nil})
+	_, cases["empty page"] = ToMultiPageTIFF([]image.Image{image.NewRGBA(image.Rectangle{})})
+	for name, err := range cases {
+		if err == nil {
+			t.Errorf("%s should return an error", name)
+		}
+	}
+
+	calls := 0
+	err = ForEachTIFFPage(data, func(int, *ImageProcessor) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("ForEachTIFFPage() returned %v after %d calls, want the error of the first call", err, calls)
+	}
+}
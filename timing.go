@@ -0,0 +1,56 @@
+package gopiq
+
+import (
+	"image"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OpTiming describes the cost of one operation applied by a processor.
+type OpTiming struct {
+	Op          string        // Operation name, as listed by Operations
+	Duration    time.Duration // From acquiring the processor to storing the result
+	Input       image.Point   // Image size before the operation
+	Output      image.Point   // Image size after the operation
+	Parallelism int           // Most goroutines a step of the operation used; 1 if it ran serially
+}
+
+// Timings returns how long each operation applied to the image so far took,
+// in order, with the image sizes and parallelism involved, so per-request
+// latency budgets can be attributed to specific steps. Like Operations, it
+// lists only operations that changed the image. Durations include time
+// spent waiting for the parallel workers but not for the processor lock.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) Timings() []OpTiming {
+	ip.mu.RLock()
+	defer ip.mu.RUnlock()
+	return slices.Clone(ip.timings)
+}
+
+// opMutex is the processor lock. Taking the write lock starts the timing of
+// an operation, which record completes.
+type opMutex struct {
+	sync.RWMutex
+	start       time.Time
+	parallelism atomic.Int32
+}
+
+// Lock acquires the write lock and starts timing an operation.
+func (m *opMutex) Lock() {
+	m.RWMutex.Lock()
+	m.start = time.Now()
+	m.parallelism.Store(1)
+}
+
+// noteParallelism records that a step of the current operation ran on n
+// goroutines.
+func (m *opMutex) noteParallelism(n int) {
+	for {
+		cur := m.parallelism.Load()
+		if int32(n) <= cur || m.parallelism.CompareAndSwap(cur, int32(n)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package gopiq
+
+import (
+	"image"
+	"testing"
+)
+
+func TestTimings(t *testing.T) {
+	proc := New(createTestImage(200, 100)).Resize(100, 50).Grayscale()
+	timings := proc.Timings()
+	if len(timings) != 2 {
+		t.Fatalf("Timings() returned %d entries, want 2", len(timings))
+	}
+	want := []OpTiming{
+		{Op: "Resize", Input: image.Pt(200, 100), Output: image.Pt(100, 50)},
+		{Op: "Grayscale", Input: image.Pt(100, 50), Output: image.Pt(100, 50)},
+	}
+	for i, w := range want {
+		got := timings[i]
+		if got.Op != w.Op || got.Input != w.Input || got.Output != w.Output {
+			t.Errorf("Timings()[%d] = %+v, want %s %v -> %v", i, got, w.Op, w.Input, w.Output)
+		}
+		if got.Duration <= 0 || got.Parallelism < 1 {
+			t.Errorf("Timings()[%d] = %+v, want a positive duration and parallelism", i, got)
+		}
+	}
+
+	// Failed operations are not recorded and clones keep their own timings.
+	clone := proc.Clone().Crop(0, 0, 10, 10)
+	proc.Resize(-1, 10)
+	if n := len(proc.Timings()); n != 2 {
+		t.Errorf("Timings() after a failed operation has %d entries, want 2", n)
+	}
+	if got := clone.Timings(); len(got) != 3 || got[2].Input != image.Pt(100, 50) || got[2].Output != image.Pt(10, 10) {
+		t.Errorf("clone Timings() = %+v, want a third Crop entry", got)
+	}
+
+	// Parallelism reports the goroutines used by parallel steps.
+	opts := PerformanceOptions{MaxGoroutines: 3, EnableParallelProcessing: true}
+	timings = NewWithPerformanceOptions(createTestImage(60, 60), opts).Dilate(1).Timings()
+	if timings[0].Parallelism != 3 {
+		t.Errorf("parallel Dilate() parallelism = %d, want 3", timings[0].Parallelism)
+	}
+	opts.EnableParallelProcessing = false
+	timings = NewWithPerformanceOptions(createTestImage(60, 60), opts).Dilate(1).Timings()
+	if timings[0].Parallelism != 1 {
+		t.Errorf("serial Dilate() parallelism = %d, want 1", timings[0].Parallelism)
+	}
+
+	// Processors created by other operations start with their own size.
+	sheet, _ := BuildSpriteSheet([]image.Image{createTestImage(10, 10), createTestImage(10, 10)}, 2)
+	if got := sheet.Resize(10, 5).Timings(); got[0].Input != image.Pt(20, 10) {
+		t.Errorf("sprite sheet Timings() input = %v, want 20x10", got[0].Input)
+	}
+
+	if got := New(createTestImage(10, 10)).Timings(); len(got) != 0 {
+		t.Errorf("Timings() on a fresh processor = %v, want none", got)
+	}
+}
@@ -0,0 +1,514 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// WatermarkTemplate describes a text or logo watermark and its styling, so
+// that it can be kept in JSON and changed without code deploys:
+//
+//	{
+//	  "text": "© Example Inc.",
+//	  "fontSize": 32,
+//	  "color": "#ffffff",
+//	  "position": "bottom-right",
+//	  "offsetX": 16, "offsetY": 16,
+//	  "opacity": 0.6,
+//	  "tile": {"spacingX": 120, "spacingY": 80, "angle": 30}
+//	}
+//
+// Byte fields (logo and font) are base64-encoded in JSON. An empty font, size
+// or color falls back to the default of AddTextWatermark.
+type WatermarkTemplate struct {
+	Text      string         `json:"text,omitempty"`      // Watermark text; exactly one of Text and Logo must be set
+	Logo      []byte         `json:"logo,omitempty"`      // Encoded PNG or JPEG logo
+	LogoWidth int            `json:"logoWidth,omitempty"` // Logo width in pixels keeping the aspect ratio, natural size if 0
+	Font      []byte         `json:"font,omitempty"`      // TrueType/OpenType font, Go Regular if empty
+	FontSize  float64        `json:"fontSize,omitempty"`  // Font size in points, 24 if 0
+	Color     string         `json:"color,omitempty"`     // Text color as "#rrggbb" or "#rrggbbaa", translucent white if empty
+	Position  string         `json:"position,omitempty"`  // top-left, top-right, bottom-left, bottom-right (default) or center
+	OffsetX   float64        `json:"offsetX,omitempty"`   // Offset from the chosen position in pixels
+	OffsetY   float64        `json:"offsetY,omitempty"`
+	Opacity   float64        `json:"opacity,omitempty"` // In (0, 1], multiplies the text color or logo alpha; 1 if 0
+	Tile      *WatermarkTile `json:"tile,omitempty"`    // Repeat across the image instead of placing once
+}
+
+// WatermarkTile repeats a watermark across the whole image in a grid rotated
+// by Angle degrees counter-clockwise, with alternate rows shifted by half a
+// cell. Spacing is the gap in pixels between neighboring copies.
+type WatermarkTile struct {
+	SpacingX float64 `json:"spacingX"`
+	SpacingY float64 `json:"spacingY"`
+	Angle    float64 `json:"angle"`
+}
+
+// validate returns an error if the spacing is negative. A nil tile is valid.
+func (t *WatermarkTile) validate() error {
+	if t != nil && (t.SpacingX < 0 || t.SpacingY < 0) {
+		return fmt.Errorf("watermark tile spacing must not be negative (got: %g, %g)", t.SpacingX, t.SpacingY)
+	}
+	return nil
+}
+
+// validate returns an error if the watermark options are out of range.
+func (cfg *watermarkConfig) validate() error {
+	if cfg.MaxWidth < 0 {
+		return fmt.Errorf("watermark max width must not be negative (got: %g)", cfg.MaxWidth)
+	}
+	if cfg.LineHeight < 0 {
+		return fmt.Errorf("watermark line height must not be negative (got: %g)", cfg.LineHeight)
+	}
+	if cfg.Align < TextAlignLeft || cfg.Align > TextAlignRight {
+		return fmt.Errorf("unknown text alignment: %d", cfg.Align)
+	}
+	if cfg.StrokeWidth < 0 {
+		return fmt.Errorf("watermark stroke width must not be negative (got: %g)", cfg.StrokeWidth)
+	}
+	if s := cfg.Shadow; s != nil {
+		if s.Color == nil {
+			return fmt.Errorf("watermark shadow color cannot be nil")
+		}
+		if !(s.Blur >= 0 && s.Blur <= maxShadowBlur) {
+			return fmt.Errorf("watermark shadow blur must be between 0 and %d (got: %g)", maxShadowBlur, s.Blur)
+		}
+		if math.IsNaN(s.DX) || math.IsNaN(s.DY) || math.IsInf(s.DX, 0) || math.IsInf(s.DY, 0) {
+			return fmt.Errorf("watermark shadow offset must be finite (got: %g, %g)", s.DX, s.DY)
+		}
+	}
+	if b := cfg.Box; b != nil {
+		if b.Color == nil {
+			return fmt.Errorf("watermark background box color cannot be nil")
+		}
+		for _, v := range []float64{b.PaddingX, b.PaddingY, b.Radius} {
+			if !(v >= 0) || math.IsInf(v, 0) {
+				return fmt.Errorf("watermark background box padding and corner radius must be finite and not negative (got: %g, %g, %g)", b.PaddingX, b.PaddingY, b.Radius)
+			}
+		}
+	}
+	if cfg.StrokeWidth > 0 && cfg.StrokeColor == nil {
+		return fmt.Errorf("watermark stroke color cannot be nil")
+	}
+	if g := cfg.Gradient; g != nil && (g.Start == nil || g.End == nil) {
+		return fmt.Errorf("watermark gradient colors cannot be nil")
+	}
+	if cfg.RelativeFontSize < 0 {
+		return fmt.Errorf("watermark relative font size must not be negative (got: %g)", cfg.RelativeFontSize)
+	}
+	if cfg.Anchored && (cfg.AnchorX < 0 || cfg.AnchorX > 1 || cfg.AnchorY < 0 || cfg.AnchorY > 1) {
+		return fmt.Errorf("watermark anchor must be between 0 and 1 (got: %g, %g)", cfg.AnchorX, cfg.AnchorY)
+	}
+	return cfg.Tile.validate()
+}
+
+// scaled returns cfg with the relative font size and offsets resolved to
+// pixels for an image with the given bounds, or cfg itself if it has none.
+func (cfg *watermarkConfig) scaled(bounds image.Rectangle) *watermarkConfig {
+	if cfg.RelativeFontSize == 0 && !cfg.RelativeOffset {
+		return cfg
+	}
+	c := *cfg
+	if c.RelativeFontSize > 0 {
+		c.FontSize = c.RelativeFontSize * float64(min(bounds.Dx(), bounds.Dy()))
+		c.RelativeFontSize = 0
+	}
+	if c.RelativeOffset {
+		c.OffsetX *= float64(bounds.Dx())
+		c.OffsetY *= float64(bounds.Dy())
+		c.RelativeOffset = false
+	}
+	return &c
+}
+
+// watermarkPositions maps template position names to positions.
+var watermarkPositions = map[string]WatermarkPosition{
+	"top-left":     PositionTopLeft,
+	"top-right":    PositionTopRight,
+	"bottom-left":  PositionBottomLeft,
+	"bottom-right": PositionBottomRight,
+	"center":       PositionCenter,
+}
+
+// LoadWatermarkTemplate reads a JSON watermark template from r and checks
+// that it can be rendered.
+// Returns an error if the JSON is malformed or the template is invalid.
+func LoadWatermarkTemplate(r io.Reader) (*WatermarkTemplate, error) {
+	var tpl WatermarkTemplate
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tpl); err != nil {
+		return nil, fmt.Errorf("failed to decode watermark template: %w", err)
+	}
+	if _, err := tpl.stamp(); err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// AddWatermarkFromTemplate draws the watermark described by tpl.
+// Returns the ImageProcessor for chaining. An error is set if tpl is nil or
+// invalid, e.g. it has both or neither text and logo, an unknown position or
+// an undecodable logo or font.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) AddWatermarkFromTemplate(tpl *WatermarkTemplate) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if tpl == nil {
+		ip.err = fmt.Errorf("watermark template cannot be nil")
+		return ip
+	}
+	stamp, err := tpl.stamp()
+	if err != nil {
+		ip.err = err
+		return ip
+	}
+	pos, _ := tpl.position()
+
+	bounds := ip.currentImage.Bounds()
+	dst := newRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	fx, fy := pos.anchor()
+	drawStamp(dst, stamp, stamp.Rect, fx, fy, tpl.OffsetX, tpl.OffsetY, tpl.Tile)
+
+	ip.currentImage = dst
+	ip.record("AddWatermarkFromTemplate")
+	return ip
+}
+
+// stamp validates the template and renders the text or logo, with opacity
+// applied, into a tightly sized image.
+func (tpl *WatermarkTemplate) stamp() (*image.RGBA, error) {
+	if (tpl.Text == "") == (len(tpl.Logo) == 0) {
+		return nil, fmt.Errorf("watermark template must have exactly one of text and logo")
+	}
+	if _, err := tpl.position(); err != nil {
+		return nil, err
+	}
+	opacity := tpl.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+	if opacity < 0 || opacity > 1 {
+		return nil, fmt.Errorf("watermark opacity must be between 0 and 1 (got: %g)", tpl.Opacity)
+	}
+	if err := tpl.Tile.validate(); err != nil {
+		return nil, err
+	}
+
+	var stamp *image.RGBA
+	if len(tpl.Logo) > 0 {
+		if tpl.LogoWidth < 0 {
+			return nil, fmt.Errorf("watermark logo width must not be negative (got: %d)", tpl.LogoWidth)
+		}
+		logo, err := decodeImage(bytes.NewReader(tpl.Logo))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode watermark logo: %w", err)
+		}
+		lb := logo.Bounds()
+		size := lb.Size()
+		if tpl.LogoWidth > 0 {
+			size = image.Pt(tpl.LogoWidth, max(1, lb.Dy()*tpl.LogoWidth/max(1, lb.Dx())))
+		}
+		stamp = image.NewRGBA(image.Rectangle{Max: size})
+		draw.CatmullRom.Scale(stamp, stamp.Rect, logo, lb, draw.Src, nil)
+	} else {
+		var err error
+		if stamp, err = tpl.textStamp(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opacity < 1 {
+		// Premultiplied channels all scale with alpha.
+		for i, v := range stamp.Pix {
+			stamp.Pix[i] = uint8(math.Round(float64(v) * opacity))
+		}
+	}
+	return stamp, nil
+}
+
+// position returns the template position, PositionBottomRight if unset.
+func (tpl *WatermarkTemplate) position() (WatermarkPosition, error) {
+	if tpl.Position == "" {
+		return PositionBottomRight, nil
+	}
+	pos, ok := watermarkPositions[tpl.Position]
+	if !ok {
+		return 0, fmt.Errorf("unknown watermark position %q", tpl.Position)
+	}
+	return pos, nil
+}
+
+// textStamp renders the template text on a transparent background.
+func (tpl *WatermarkTemplate) textStamp() (*image.RGBA, error) {
+	cfg := defaultWatermarkConfig()
+	if len(tpl.Font) > 0 {
+		cfg.FontBytes = tpl.Font
+	}
+	if tpl.FontSize < 0 {
+		return nil, fmt.Errorf("watermark font size must be positive (got: %g)", tpl.FontSize)
+	}
+	if tpl.FontSize > 0 {
+		cfg.FontSize = tpl.FontSize
+	}
+	if tpl.Color != "" {
+		c, err := parseHexColor(tpl.Color)
+		if err != nil {
+			return nil, fmt.Errorf("watermark color: %w", err)
+		}
+		cfg.Color = c
+	}
+
+	face, err := cfg.newFace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+	defer face.Close()
+
+	cfg.Text = tpl.Text
+	stamp, _ := renderTextStamp(face, cfg)
+	return stamp, nil
+}
+
+// renderTextStamp renders cfg.Text with the fill and effects of cfg on a
+// transparent background sized to them, laid out horizontally or, if
+// cfg.Vertical is set, in a single column. It also returns the part of the
+// stamp taken up by the text itself, by which the stamp is placed.
+func renderTextStamp(face font.Face, cfg *watermarkConfig) (*image.RGBA, image.Rectangle) {
+	if !cfg.Vertical {
+		block := layoutText(face, cfg)
+		stamp, origin := renderTextBlock(face, block, cfg)
+		return stamp, block.stampRect().Sub(origin)
+	}
+	w, h := measureVerticalText(face, cfg.Text)
+	column := image.Rect(0, 0, max(1, int(math.Ceil(w))), max(1, int(math.Ceil(h))))
+	cover := column.Union(cfg.textEffectBounds(column, columnFrame(0, 0, w, h)))
+	stamp := image.NewRGBA(image.Rectangle{Max: cover.Size()})
+	x, y := float64(-cover.Min.X), float64(-cover.Min.Y)
+	column = column.Sub(cover.Min)
+	drawStyledText(stamp, cfg, column, columnFrame(x, y, w, h), func(dst draw.Image, src image.Image) {
+		drawVerticalText(dst, face, src, cfg.Text, x, y)
+	})
+	return stamp, column
+}
+
+// renderTextBlock renders block with the fill and effects of cfg on a
+// transparent background sized to them, and returns it with the position of
+// its top-left corner relative to the baseline origin of the first line.
+func renderTextBlock(face font.Face, block *textBlock, cfg *watermarkConfig) (*image.RGBA, image.Point) {
+	ink := fixedRect(block.ink)
+	cover := block.stampRect().Union(cfg.textEffectBounds(ink, block.frame(fixed.Point26_6{})))
+	stamp := image.NewRGBA(image.Rectangle{Max: cover.Size()})
+	dot := fixed.P(-cover.Min.X, -cover.Min.Y)
+	drawStyledText(stamp, cfg, ink.Sub(cover.Min), block.frame(dot), func(dst draw.Image, src image.Image) {
+		block.draw(&font.Drawer{Dst: dst, Src: src, Face: face}, dot)
+	})
+	return stamp, cover.Min
+}
+
+// stampRect returns the pixels a stamp of the block spans without text
+// effects, relative to the baseline origin of its first line: its ink and
+// advance across and its line boxes down.
+func (b *textBlock) stampRect() image.Rectangle {
+	top := -b.metrics.Ascent
+	return image.Rect(b.ink.Min.X.Floor(), top.Floor(), max(b.ink.Max.X, b.advance).Ceil(), (top + b.height()).Ceil())
+}
+
+// Stamp is a watermark rendered once by PrepareWatermark and drawn with
+// ApplyStamp, so that applying the same watermark to many images does not
+// parse the font and rasterize the glyphs every time. A Stamp is immutable
+// and may be shared between goroutines and processors.
+type Stamp struct {
+	img              *image.RGBA
+	anchorX, anchorY float64
+	offsetX, offsetY float64
+	relativeOffset   bool            // Offsets are fractions of the image size
+	content          image.Rectangle // Part of img placed by the anchor, without text effects
+	tile             *WatermarkTile
+
+	// Horizontal text is placed by its baseline like AddTextWatermark does,
+	// which needs the placement options and the text measurements. origin
+	// is the top-left corner of img relative to the baseline origin.
+	text   *watermarkConfig
+	block  *textBlock
+	origin image.Point
+}
+
+// Size returns the size of the rendered watermark in pixels.
+func (s *Stamp) Size() image.Point {
+	return s.img.Rect.Size()
+}
+
+// WithText sets the watermark text for PrepareWatermark. AddTextWatermark
+// takes its text as an argument instead.
+func WithText(text string) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Text = text }
+}
+
+// WithLogo makes PrepareWatermark stamp logo instead of text. The logo is
+// drawn at its own size; font and color options are ignored.
+func WithLogo(logo image.Image) WatermarkOption {
+	return func(wc *watermarkConfig) { wc.Logo = logo }
+}
+
+// PrepareWatermark renders a text (WithText) or logo (WithLogo) watermark
+// once, together with its position, offset and tiling options, for drawing on
+// many images with ApplyStamp. The stamp is placed as a bitmap, so its
+// position is rounded to whole pixels. WithRelativeOffset margins are
+// resolved for each image, but the text is rendered at a fixed size, so
+// WithRelativeFontSize is not supported.
+// Returns an error if neither or both of text and logo are set, the font
+// fails to load or the options are invalid.
+func PrepareWatermark(opts ...WatermarkOption) (*Stamp, error) {
+	cfg := defaultWatermarkConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if (cfg.Text == "") == (cfg.Logo == nil) {
+		return nil, fmt.Errorf("watermark needs exactly one of text and logo")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.RelativeFontSize > 0 {
+		return nil, fmt.Errorf("relative font size depends on the image and cannot be prepared")
+	}
+
+	s := &Stamp{offsetX: cfg.OffsetX, offsetY: cfg.OffsetY, relativeOffset: cfg.RelativeOffset}
+	s.anchorX, s.anchorY = cfg.anchor()
+	if cfg.Tile != nil {
+		tile := *cfg.Tile
+		s.tile = &tile
+	}
+	if cfg.Logo != nil {
+		// Copy the logo so later changes by the caller do not affect the stamp.
+		b := cfg.Logo.Bounds()
+		s.img = image.NewRGBA(image.Rectangle{Max: b.Size()})
+		draw.Draw(s.img, s.img.Rect, cfg.Logo, b.Min, draw.Src)
+		s.content = s.img.Rect
+		return s, nil
+	}
+
+	face, err := cfg.newFace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+	defer face.Close()
+	if cfg.Vertical {
+		s.img, s.content = renderTextStamp(face, cfg)
+		return s, nil
+	}
+	s.text = cfg
+	s.block = layoutText(face, cfg)
+	s.img, s.origin = renderTextBlock(face, s.block, cfg)
+	return s, nil
+}
+
+// ApplyStamp draws a watermark prepared by PrepareWatermark.
+// Returns the ImageProcessor for chaining. An error is set if s is nil.
+// This method is safe for concurrent use.
+func (ip *ImageProcessor) ApplyStamp(s *Stamp) *ImageProcessor {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	if ip.err != nil {
+		return ip
+	}
+	if s == nil {
+		ip.err = fmt.Errorf("stamp cannot be nil")
+		return ip
+	}
+
+	bounds := ip.currentImage.Bounds()
+	dst := newRGBA(bounds)
+	draw.Draw(dst, bounds, ip.currentImage, bounds.Min, draw.Src)
+	if s.text != nil && s.tile == nil {
+		dot := textWatermarkDot(s.block, s.text.scaled(bounds), bounds)
+		x, y := math.Round(fixedToFloat(dot.X)), math.Round(fixedToFloat(dot.Y))
+		r := s.img.Rect.Add(image.Pt(int(x), int(y)).Add(s.origin))
+		draw.Draw(dst, r, s.img, image.Point{}, draw.Over)
+	} else {
+		offsetX, offsetY := s.offsetX, s.offsetY
+		if s.relativeOffset {
+			offsetX *= float64(bounds.Dx())
+			offsetY *= float64(bounds.Dy())
+		}
+		drawStamp(dst, s.img, s.content, s.anchorX, s.anchorY, offsetX, offsetY, s.tile)
+	}
+
+	ip.currentImage = dst
+	ip.record("ApplyStamp")
+	return ip
+}
+
+// drawStamp draws stamp over dst once at the relative anchor (fx, fy), moved
+// inwards by the offsets, or repeatedly if tile is not nil. The stamp is
+// placed by its content rectangle, so text effects around it may extend
+// beyond the offsets.
+func drawStamp(dst, stamp *image.RGBA, content image.Rectangle, fx, fy, offsetX, offsetY float64, tile *WatermarkTile) {
+	if tile != nil {
+		tileStamp(dst, stamp, tile.SpacingX, tile.SpacingY, tile.Angle)
+		return
+	}
+	size := content.Size()
+	x, y := blockOrigin(fx, fy, dst.Rect, float64(size.X), float64(size.Y), offsetX, offsetY)
+	r := stamp.Rect.Add(image.Pt(int(math.Round(x)), int(math.Round(y))).Sub(content.Min))
+	draw.Draw(dst, r, stamp, image.Point{}, draw.Over)
+}
+
+// tileStamp draws copies of stamp over dst on a grid rotated by angle degrees
+// counter-clockwise around the image center, spacingX and spacingY pixels
+// apart, shifting alternate rows by half a cell so the copies do not line up
+// in columns.
+func tileStamp(dst *image.RGBA, stamp *image.RGBA, spacingX, spacingY, angle float64) {
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	w, h := float64(stamp.Rect.Dx()), float64(stamp.Rect.Dy())
+
+	// Rotate the stamp once into its bounding box.
+	rw := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	rh := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	rotated := image.NewRGBA(image.Rect(0, 0, rw, rh))
+	cx, cy := float64(rw)/2, float64(rh)/2
+	draw.BiLinear.Transform(rotated, f64.Aff3{
+		cos, sin, cx - cos*w/2 - sin*h/2,
+		-sin, cos, cy + sin*w/2 - cos*h/2,
+	}, stamp, stamp.Rect, draw.Src, nil)
+
+	// Walk the grid in the stamp's rotated frame far enough to cover the
+	// image corners.
+	b := dst.Rect
+	centerX, centerY := float64(b.Min.X+b.Max.X)/2, float64(b.Min.Y+b.Max.Y)/2
+	cellW, cellH := w+spacingX, h+spacingY
+	reach := math.Hypot(float64(b.Dx()), float64(b.Dy()))/2 + max(cellW, cellH)
+	cols, rows := int(math.Ceil(reach/cellW)), int(math.Ceil(reach/cellH))
+	for j := -rows; j <= rows; j++ {
+		shift := 0.0
+		if j%2 != 0 {
+			shift = cellW / 2
+		}
+		v := float64(j) * cellH
+		for i := -cols; i <= cols; i++ {
+			u := float64(i)*cellW + shift
+			x := centerX + u*cos + v*sin - cx
+			y := centerY - u*sin + v*cos - cy
+			r := rotated.Rect.Add(image.Pt(int(math.Round(x)), int(math.Round(y))))
+			if r.Overlaps(b) {
+				draw.Draw(dst, r, rotated, image.Point{}, draw.Over)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// brightPixels counts pixels of img within r whose red channel exceeds 32.
+func brightPixels(img image.Image, r image.Rectangle) int {
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if red, _, _, _ := img.At(x, y).RGBA(); red>>8 > 32 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestAddWatermarkFromTemplate(t *testing.T) {
+	black := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 120))
+		draw.Draw(img, img.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+		return img
+	}
+
+	tpl, err := LoadWatermarkTemplate(strings.NewReader(`{
+		"text": "PROOF", "fontSize": 20, "color": "#ffffff",
+		"position": "top-left", "offsetX": 5, "offsetY": 5, "opacity": 0.5
+	}`))
+	if err != nil {
+		t.Fatalf("LoadWatermarkTemplate() should not error, got: %v", err)
+	}
+	img, err := New(black()).AddWatermarkFromTemplate(tpl).Image()
+	if err != nil {
+		t.Fatalf("AddWatermarkFromTemplate() should not error, got: %v", err)
+	}
+	if brightPixels(img, image.Rect(0, 0, 100, 40)) == 0 {
+		t.Error("text watermark should be drawn in the top-left corner")
+	}
+	if brightPixels(img, image.Rect(100, 40, 200, 120)) != 0 {
+		t.Error("text watermark should not be drawn outside the top-left corner")
+	}
+	maxRed := uint32(0)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 100; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			maxRed = max(maxRed, r>>8)
+		}
+	}
+	if maxRed < 100 || maxRed > 140 {
+		t.Errorf("half-opaque white text should peak near 128, got %d", maxRed)
+	}
+
+	// A tiled logo covers every quadrant of the image.
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	draw.Draw(logo, logo.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	logoData, _ := imageToPNGBytes(logo)
+	data, _ := json.Marshal(WatermarkTemplate{Logo: logoData, LogoWidth: 20, Tile: &WatermarkTile{SpacingX: 10, SpacingY: 10, Angle: 30}})
+	tpl, err = LoadWatermarkTemplate(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadWatermarkTemplate() with a logo should not error, got: %v", err)
+	}
+	img, err = New(black()).AddWatermarkFromTemplate(tpl).Image()
+	if err != nil {
+		t.Fatalf("AddWatermarkFromTemplate() with tiling should not error, got: %v", err)
+	}
+	for _, q := range []image.Rectangle{image.Rect(0, 0, 100, 60), image.Rect(100, 0, 200, 60), image.Rect(0, 60, 100, 120), image.Rect(100, 60, 200, 120)} {
+		if brightPixels(img, q) == 0 {
+			t.Errorf("tiled watermark should cover quadrant %v", q)
+		}
+	}
+
+	// Invalid templates are rejected when loading and when drawing.
+	for _, js := range []string{
+		`{"text": "a"`,
+		`{}`,
+		`{"text": "a", "logo": "iVBORw0KGgo="}`,
+		`{"text": "a", "position": "middle"}`,
+		`{"text": "a", "color": "white"}`,
+		`{"text": "a", "opacity": 1.5}`,
+		`{"text": "a", "tile": {"spacingX": -1}}`,
+		`{"logo": "bm90IGFuIGltYWdl"}`,
+		`{"text": "a", "size": 12}`,
+	} {
+		if _, err := LoadWatermarkTemplate(strings.NewReader(js)); err == nil {
+			t.Errorf("LoadWatermarkTemplate(%s) should return an error", js)
+		}
+	}
+	if err := New(black()).AddWatermarkFromTemplate(&WatermarkTemplate{Text: "a", Position: "middle"}).Err(); err == nil {
+		t.Error("AddWatermarkFromTemplate() with an invalid template should set an error")
+	}
+	if err := New(black()).AddWatermarkFromTemplate(nil).Err(); err == nil {
+		t.Error("AddWatermarkFromTemplate(nil) should set an error")
+	}
+
+	// Test case: Processor with a prior error
+	if err := New(nil).AddWatermarkFromTemplate(tpl).Err(); err == nil {
+		t.Fatal("AddWatermarkFromTemplate() on a processor with prior error should return that error")
+	}
+}
+
+func TestAddTextWatermarkTiling(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, img.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	proc := New(img).AddTextWatermark("SAMPLE", WithTiling(20, 20, 45), WithColor(color.White), WithFontSize(16))
+	if proc.Err() != nil {
+		t.Fatalf("AddTextWatermark() with tiling should not error, got: %v", proc.Err())
+	}
+	for _, q := range []image.Rectangle{image.Rect(0, 0, 150, 100), image.Rect(150, 0, 300, 100), image.Rect(0, 100, 150, 200), image.Rect(150, 100, 300, 200)} {
+		if brightPixels(proc.currentImage, q) == 0 {
+			t.Errorf("tiled text should cover quadrant %v", q)
+		}
+	}
+
+	// Vertical text can be tiled too.
+	if err := New(img).AddTextWatermark("縦書き", WithTiling(10, 10, 0), WithVerticalText()).Err(); err != nil {
+		t.Errorf("AddTextWatermark() with vertical tiled text should not error, got: %v", err)
+	}
+
+	// Test case: Negative spacing
+	if New(img).AddTextWatermark("SAMPLE", WithTiling(-5, 10, 0)).Err() == nil {
+		t.Error("AddTextWatermark() with negative tile spacing should return an error")
+	}
+}
+
+func TestPrepareWatermark(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(black, black.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	opts := []WatermarkOption{WithFontSize(20), WithColor(color.White), WithPosition(PositionBottomRight)}
+
+	stamp, err := PrepareWatermark(append(opts, WithText("SAMPLE"))...)
+	if err != nil {
+		t.Fatalf("PrepareWatermark() should not error, got: %v", err)
+	}
+	if size := stamp.Size(); size.X == 0 || size.Y == 0 {
+		t.Fatalf("PrepareWatermark() produced an empty stamp: %v", size)
+	}
+
+	// The stamp lands where AddTextWatermark draws the same text.
+	ink := func(img image.Image) image.Rectangle {
+		var r image.Rectangle
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if red, _, _, _ := img.At(x, y).RGBA(); red>>8 > 64 {
+					r = r.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		return r
+	}
+	stamped, err := New(black).ApplyStamp(stamp).Image()
+	if err != nil {
+		t.Fatalf("ApplyStamp() should not error, got: %v", err)
+	}
+	drawn, _ := New(black).AddTextWatermark("SAMPLE", opts...).Image()
+	got, want := ink(stamped), ink(drawn)
+	if abs(got.Min.X-want.Min.X) > 2 || abs(got.Min.Y-want.Min.Y) > 2 || abs(got.Max.X-want.Max.X) > 2 || abs(got.Max.Y-want.Max.Y) > 2 {
+		t.Errorf("ApplyStamp() ink %v, want close to AddTextWatermark ink %v", got, want)
+	}
+
+	// Logo stamps copy the logo; stamps can be reused concurrently.
+	logo := image.NewRGBA(image.Rect(5, 5, 15, 15))
+	draw.Draw(logo, logo.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	logoStamp, err := PrepareWatermark(WithLogo(logo), WithPosition(PositionTopLeft), WithOffset(3, 4))
+	if err != nil {
+		t.Fatalf("PrepareWatermark() with a logo should not error, got: %v", err)
+	}
+	draw.Draw(logo, logo.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img, err := New(black).ApplyStamp(logoStamp).Image()
+			if err != nil {
+				t.Errorf("ApplyStamp() with a logo should not error, got: %v", err)
+				return
+			}
+			if got := ink(img); got != image.Rect(3, 4, 13, 14) {
+				t.Errorf("logo stamp drawn at %v, want (3,4)-(13,14)", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Tiled stamps cover the image.
+	tiled, _ := PrepareWatermark(WithText("x"), WithColor(color.White), WithTiling(5, 5, 0))
+	if img, _ := New(black).ApplyStamp(tiled).Image(); ink(img).Dx() < 150 {
+		t.Errorf("tiled stamp should cover the image, ink %v", ink(img))
+	}
+
+	// Test case: Invalid options
+	if _, err := PrepareWatermark(); err == nil {
+		t.Error("PrepareWatermark() without text or logo should return an error")
+	}
+	if _, err := PrepareWatermark(WithText("a"), WithLogo(logo)); err == nil {
+		t.Error("PrepareWatermark() with both text and logo should return an error")
+	}
+	if _, err := PrepareWatermark(WithText("a"), WithFontBytes([]byte("bad"))); err == nil {
+		t.Error("PrepareWatermark() with an invalid font should return an error")
+	}
+	if New(black).ApplyStamp(nil).Err() == nil {
+		t.Error("ApplyStamp(nil) should return an error")
+	}
+
+	// Test case: Chaining with a prior error
+	if New(nil).ApplyStamp(stamp).Err() == nil {
+		t.Fatal("ApplyStamp() on a processor with prior error should return that error")
+	}
+}
@@ -0,0 +1,220 @@
+package gopiq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// defaultWebPQuality is the quality of lossy WebP output unless set
+	// with WithWebPQuality, the same as cwebp's.
+	defaultWebPQuality = 75
+	// webpMaxSize is the largest width and height of a WebP image.
+	webpMaxSize = 1 << 14
+	// webpAlphaFlag marks images with an alpha channel in the VP8X chunk.
+	webpAlphaFlag = 0x10
+)
+
+// WithWebPQuality sets the quality of lossy WebP output from 1 (smallest
+// file) to 100 (best quality); the default is 75, as with cwebp. Encoding
+// fails for qualities outside that range.
+func WithWebPQuality(quality int) EncodeOption {
+	return func(eo *EncodeOptions) { eo.WebPQuality = quality }
+}
+
+// WithWebPLossless makes WebP output lossless: every pixel is kept exactly,
+// which suits graphics, screenshots and images with few colors, where it
+// also tends to be smaller than lossy output.
+func WithWebPLossless() EncodeOption {
+	return func(eo *EncodeOptions) { eo.WebPLossless = true }
+}
+
+// webpChunk is a chunk of the RIFF container of WebP files.
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// writeWebPContainer writes chunks in a RIFF WEBP container.
+func writeWebPContainer(w io.Writer, chunks ...webpChunk) error {
+	body := appendWebPChunks([]byte("WEBP"), chunks...)
+	out := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)))
+	_, err := w.Write(append(out, body...))
+	return err
+}
+
+// appendWebPChunks appends chunks to b, each padded to an even size.
+func appendWebPChunks(b []byte, chunks ...webpChunk) []byte {
+	for _, c := range chunks {
+		b = append(b, c.id...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c.data)))
+		b = append(b, c.data...)
+		if len(c.data)&1 != 0 {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// webpVP8X returns the extended format chunk of a w×h canvas with flags.
+func webpVP8X(flags byte, w, h int) webpChunk {
+	data := []byte{flags, 0, 0, 0}
+	data = append(data, byte(w-1), byte((w-1)>>8), byte((w-1)>>16))
+	data = append(data, byte(h-1), byte((h-1)>>8), byte((h-1)>>16))
+	return webpChunk{"VP8X", data}
+}
+
+// argbPixels returns the straight-alpha ARGB pixels of img, and whether
+// any of them is not opaque. Straight-alpha images are read as they are,
+// so that lossless output keeps their colors exactly at partial alpha;
+// only premultiplied colors are converted.
+func argbPixels(img image.Image) (pix []uint32, hasAlpha bool) {
+	b := img.Bounds()
+	var src *image.NRGBA
+	switch m := img.(type) {
+	case *image.NRGBA:
+		src = m
+	case *image.RGBA:
+		pix = make([]uint32, 0, b.Dx()*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(b.Min.X, y):][:4*b.Dx()]
+			for i := 0; i < len(row); i += 4 {
+				a := row[i+3]
+				hasAlpha = hasAlpha || a != 255
+				pix = append(pix, uint32(a)<<24|uint32(unpremultiply(row[i], a))<<16|
+					uint32(unpremultiply(row[i+1], a))<<8|uint32(unpremultiply(row[i+2], a)))
+			}
+		}
+		return pix, hasAlpha
+	default:
+		src = image.NewNRGBA(b)
+		draw.Draw(src, b, img, b.Min, draw.Src)
+	}
+	pix = make([]uint32, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, y):][:4*b.Dx()]
+		for i := 0; i < len(row); i += 4 {
+			hasAlpha = hasAlpha || row[i+3] != 255
+			pix = append(pix, uint32(row[i+3])<<24|uint32(row[i])<<16|uint32(row[i+1])<<8|uint32(row[i+2]))
+		}
+	}
+	return pix, hasAlpha
+}
+
+// webpFrame returns the chunks of img as a lossless VP8L bit stream, or as
+// a lossy VP8 frame at quality with the alpha channel, if any, compressed
+// losslessly in an ALPH chunk before it, and whether it has alpha.
+func webpFrame(img image.Image, quality int, lossless bool) ([]webpChunk, bool, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	pix, hasAlpha := argbPixels(img)
+	if lossless {
+		return []webpChunk{{"VP8L", encodeVP8L(pix, w, h, hasAlpha)}}, hasAlpha, nil
+	}
+	frame, err := encodeVP8(asRGBA(img), quality)
+	if err != nil {
+		return nil, false, err
+	}
+	if !hasAlpha {
+		return []webpChunk{{"VP8 ", frame}}, false, nil
+	}
+	// The alpha values are the green channel of a VP8L image stored
+	// without its 5-byte header, after a byte for the compression method
+	// (1: lossless) and no filtering.
+	alpha := make([]uint32, len(pix))
+	for i, c := range pix {
+		alpha[i] = 0xff000000 | c>>24<<8
+	}
+	alph := append([]byte{1}, encodeVP8L(alpha, w, h, false)[5:]...)
+	return []webpChunk{{"ALPH", alph}, {"VP8 ", frame}}, true, nil
+}
+
+// checkWebPSize returns an error if a w×h image cannot be stored as WebP.
+func checkWebPSize(w, h int) error {
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("cannot encode an empty image as WebP")
+	}
+	if w > webpMaxSize || h > webpMaxSize {
+		return fmt.Errorf("image of %dx%d is too large for WebP, which allows at most %d pixels per side", w, h, webpMaxSize)
+	}
+	return nil
+}
+
+// webpQuality returns the lossy WebP quality to use for quality, where 0
+// means the default, or an error if it is out of range.
+func webpQuality(quality int) (int, error) {
+	if quality == 0 {
+		return defaultWebPQuality, nil
+	}
+	if quality < 1 || quality > 100 {
+		return 0, fmt.Errorf("invalid WebP quality %d: must be between 1 and 100", quality)
+	}
+	return quality, nil
+}
+
+// encodeWebP encodes img as a lossless or lossy WebP file; a quality of 0
+// means the default.
+func encodeWebP(w io.Writer, img image.Image, quality int, lossless bool) error {
+	quality, err := webpQuality(quality)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	if err := checkWebPSize(b.Dx(), b.Dy()); err != nil {
+		return err
+	}
+	chunks, hasAlpha, err := webpFrame(img, quality, lossless)
+	if err != nil {
+		return err
+	}
+	if hasAlpha && !lossless {
+		// An ALPH chunk needs the extended format.
+		chunks = append([]webpChunk{webpVP8X(webpAlphaFlag, b.Dx(), b.Dy())}, chunks...)
+	}
+	return writeWebPContainer(w, chunks...)
+}
+
+// webpToRGBA converts the Y'CbCr images of lossy WebP files to RGBA with
+// the limited range conversion of libwebp, which encoders assume; the
+// conversion of image/color would lighten shadows and darken highlights.
+// Other images are returned as is. Returns an error if the planes are too
+// short for the image, as x/image/webp returns for some corrupt files.
+func webpToRGBA(img image.Image) (image.Image, error) {
+	var ycc *image.YCbCr
+	var alpha *image.NYCbCrA
+	switch m := img.(type) {
+	case *image.YCbCr:
+		ycc = m
+	case *image.NYCbCrA:
+		ycc, alpha = &m.YCbCr, m
+	default:
+		return img, nil
+	}
+	b := ycc.Rect
+	// The offsets grow towards the last pixel, which bounds the planes.
+	if last := b.Max.Sub(image.Pt(1, 1)); !b.Empty() && (ycc.YOffset(last.X, last.Y) >= len(ycc.Y) ||
+		ycc.COffset(last.X, last.Y) >= min(len(ycc.Cb), len(ycc.Cr)) ||
+		alpha != nil && alpha.AOffset(last.X, last.Y) >= len(alpha.A)) {
+		return nil, fmt.Errorf("WebP planes are too short for a %dx%d image", b.Dx(), b.Dy())
+	}
+	mulHi := func(v uint8, c int32) int32 { return int32(v) * c >> 8 }
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yy, u, v := mulHi(ycc.Y[ycc.YOffset(x, y)], 19077), ycc.Cb[ycc.COffset(x, y)], ycc.Cr[ycc.COffset(x, y)]
+			a := uint8(255)
+			if alpha != nil {
+				a = alpha.A[alpha.AOffset(x, y)]
+			}
+			px := out.Pix[out.PixOffset(x, y):][:4:4]
+			px[0] = premultiply(clamp255((yy+mulHi(v, 26149)-14234)>>6), a)
+			px[1] = premultiply(clamp255((yy-mulHi(u, 6419)-mulHi(v, 13320)+8708)>>6), a)
+			px[2] = premultiply(clamp255((yy+mulHi(u, 33050)-17685)>>6), a)
+			px[3] = a
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestToBytesWebP(t *testing.T) {
+	src := gradientImage(48, 32)
+	proc := New(src)
+
+	lossless, err := proc.ToBytes(FormatWebP, WithWebPLossless())
+	if err != nil {
+		t.Fatalf("ToBytes(FormatWebP) lossless should not error, got: %v", err)
+	}
+	if got := DetectFormat(lossless); got != FormatWebP {
+		t.Fatalf("lossless output detected as %s, want webp", got)
+	}
+	img, err := FromBytes(lossless).ToRGBA()
+	if err != nil {
+		t.Fatalf("FromBytes() of lossless WebP should not error, got: %v", err)
+	}
+	if !bytes.Equal(img.Pix, src.Pix) {
+		t.Error("lossless WebP should decode to the exact source pixels")
+	}
+
+	lossy, err := proc.ToBytes(FormatWebP)
+	if err != nil {
+		t.Fatalf("ToBytes(FormatWebP) should not error, got: %v", err)
+	}
+	if got := DetectFormat(lossy); got != FormatWebP {
+		t.Fatalf("lossy output detected as %s, want webp", got)
+	}
+	decoded := mustImage(t, FromBytes(lossy))
+	if got := decoded.Bounds(); got != src.Bounds() {
+		t.Fatalf("lossy WebP bounds = %v, want %v", got, src.Bounds())
+	}
+	for _, p := range []image.Point{{0, 0}, {24, 16}, {47, 31}} {
+		r, g, b, _ := decoded.At(p.X, p.Y).RGBA()
+		want := src.RGBAAt(p.X, p.Y)
+		if abs(int(r>>8)-int(want.R)) > 12 || abs(int(g>>8)-int(want.G)) > 12 || abs(int(b>>8)-int(want.B)) > 12 {
+			t.Errorf("lossy WebP at %v = %d,%d,%d, want close to %v", p, r>>8, g>>8, b>>8, want)
+		}
+	}
+}
+
+func TestWithWebPQuality(t *testing.T) {
+	src := createTestImage(64, 64)
+	for y := range 64 {
+		for x := range 64 {
+			src.(*image.RGBA).SetRGBA(x, y, color.RGBA{uint8(x * 4), uint8(x * y), uint8(y * 4), 255})
+		}
+	}
+	proc := New(src)
+	low, err := proc.ToBytes(FormatWebP, WithWebPQuality(10))
+	if err != nil {
+		t.Fatalf("ToBytes() at quality 10 should not error, got: %v", err)
+	}
+	high, err := proc.ToBytes(FormatWebP, WithWebPQuality(100))
+	if err != nil {
+		t.Fatalf("ToBytes() at quality 100 should not error, got: %v", err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("quality 10 gives %d bytes, want fewer than the %d bytes of quality 100", len(low), len(high))
+	}
+
+	// Test case: Invalid input
+	for _, q := range []int{-1, 101} {
+		if _, err := proc.ToBytes(FormatWebP, WithWebPQuality(q)); err == nil {
+			t.Errorf("ToBytes() at quality %d should return an error", q)
+		}
+	}
+	if _, err := New(image.NewRGBA(image.Rect(0, 0, 0, 0))).ToBytes(FormatWebP); err == nil {
+		t.Error("ToBytes(FormatWebP) of an empty image should return an error")
+	}
+	if _, err := New(image.NewRGBA(image.Rect(0, 0, webpMaxSize+1, 1))).ToBytes(FormatWebP); err == nil {
+		t.Error("ToBytes(FormatWebP) of an image wider than WebP allows should return an error")
+	}
+}
+
+func TestWebPLosslessStraightAlpha(t *testing.T) {
+	// Colors at low alpha do not survive premultiplication, so straight
+	// alpha input must be encoded as it is.
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 37 % 251)
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 15, 33})
+
+	data, err := New(img).ToBytes(FormatWebP, WithWebPLossless())
+	if err != nil {
+		t.Fatalf("ToBytes(FormatWebP) should not error, got: %v", err)
+	}
+	decoded, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding lossless WebP should not error, got: %v", err)
+	}
+	got, ok := decoded.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("decoded lossless WebP is %T, want *image.NRGBA", decoded)
+	}
+	if !bytes.Equal(got.Pix, img.Pix) {
+		t.Errorf("lossless WebP changed straight-alpha pixels: (0, 0) = %v, want %v", got.NRGBAAt(0, 0), img.NRGBAAt(0, 0))
+	}
+}
+
+func TestToBytesWebPAlpha(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for y := range 10 {
+		for x := range 10 {
+			img.SetRGBA(x, y, color.RGBA{0, 0, 200, 255}) // Opaque blue next to transparent
+		}
+	}
+	img.SetRGBA(15, 5, color.RGBA{64, 0, 0, 128}) // Half transparent red
+
+	for name, opts := range map[string][]EncodeOption{"lossy": nil, "lossless": {WithWebPLossless()}} {
+		data, err := New(img).ToBytes(FormatWebP, opts...)
+		if err != nil {
+			t.Fatalf("%s ToBytes(FormatWebP) with alpha should not error, got: %v", name, err)
+		}
+		decoded := mustImage(t, FromBytes(data))
+		if _, _, _, a := decoded.At(3, 3).RGBA(); a != 0xffff {
+			t.Errorf("%s: opaque pixel has alpha %d, want opaque", name, a>>8)
+		}
+		if _, _, _, a := decoded.At(12, 2).RGBA(); a != 0 {
+			t.Errorf("%s: transparent pixel has alpha %d, want transparent", name, a>>8)
+		}
+		if _, _, _, a := decoded.At(15, 5).RGBA(); a>>8 != 128 {
+			t.Errorf("%s: half transparent pixel has alpha %d, want 128", name, a>>8)
+		}
+	}
+	// Test case: Invalid input
+	// A VP8X canvas narrower than the frame leaves x/image/webp with an
+	// alpha plane too short for the image.
+	noisy := image.NewNRGBA(image.Rect(0, 0, 17, 15))
+	for i := range noisy.Pix {
+		noisy.Pix[i] = uint8(i * 37)
+	}
+	data := mustBytes(t, New(noisy), FormatWebP)
+	data[24] = 0 // Canvas width 1
+	if err := FromBytes(data).Err(); err == nil {
+		t.Error("FromBytes() of a WebP with an alpha plane too short for the image should return an error")
+	}
+}
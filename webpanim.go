@@ -0,0 +1,274 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"runtime"
+	"slices"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// webpAnimationFlag marks animated images in the VP8X chunk.
+	webpAnimationFlag = 0x02
+	// webpMaxDuration is the longest a WebP frame can be shown, in ms.
+	webpMaxDuration = 1<<24 - 1
+)
+
+// isAnimatedWebP reports whether data is a WebP file with the animation
+// flag set.
+func isAnimatedWebP(data []byte) bool {
+	return len(data) >= 21 && DetectFormat(data) == FormatWebP &&
+		string(data[12:16]) == "VP8X" && data[20]&webpAnimationFlag != 0
+}
+
+// readWebPChunks splits the body of a RIFF container, or of an ANMF chunk,
+// into chunks.
+func readWebPChunks(b []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("truncated WebP chunk header")
+		}
+		size := binary.LittleEndian.Uint32(b[4:8])
+		if uint64(size) > uint64(len(b)-8) {
+			return nil, fmt.Errorf("WebP chunk %q of %d bytes is truncated", b[:4], size)
+		}
+		chunks = append(chunks, webpChunk{string(b[:4]), b[8 : 8+size]})
+		b = b[min(8+int(size)+int(size&1), len(b)):]
+	}
+	return chunks, nil
+}
+
+// uint24 returns the little-endian 24-bit number at the start of b.
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// decodeWebPFrame decodes the image chunks of an ANMF chunk.
+func decodeWebPFrame(chunks []webpChunk, w, h int) (image.Image, error) {
+	var alph, frame *webpChunk
+	for i, c := range chunks {
+		switch c.id {
+		case "ALPH":
+			alph = &chunks[i]
+		case "VP8 ", "VP8L":
+			frame = &chunks[i]
+		}
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("no image data")
+	}
+	// Frames are decoded as stills of their own.
+	still := []webpChunk{*frame}
+	if alph != nil && frame.id == "VP8 " {
+		still = []webpChunk{webpVP8X(webpAlphaFlag, w, h), *alph, *frame}
+	}
+	var buf bytes.Buffer
+	if err := writeWebPContainer(&buf, still...); err != nil {
+		return nil, err
+	}
+	img, err := decodeImage(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if img.Bounds().Size() != image.Pt(w, h) {
+		return nil, fmt.Errorf("image is %v, but the frame header says %dx%d", img.Bounds().Size(), w, h)
+	}
+	return img, nil
+}
+
+// decodeAnimatedWebP decodes the frames of an animated WebP file, placed
+// at their canvas position. Durations are rounded to hundredths of a
+// second, and the loop count is converted to the image/gif convention.
+func decodeAnimatedWebP(data []byte) *AnimationProcessor {
+	fail := func(format string, args ...any) *AnimationProcessor {
+		return &AnimationProcessor{err: fmt.Errorf("failed to decode animated WebP: "+format, args...)}
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 4 {
+		return fail("RIFF size %d is too small for the WEBP header", size)
+	}
+	chunks, err := readWebPChunks(data[12:min(8+size, len(data))])
+	if err != nil {
+		return fail("%w", err)
+	}
+	ap := &AnimationProcessor{}
+	for _, c := range chunks {
+		switch c.id {
+		case "VP8X":
+			if len(c.data) < 10 {
+				return fail("VP8X chunk is too short")
+			}
+			ap.canvas = image.Rect(0, 0, uint24(c.data[4:])+1, uint24(c.data[7:])+1)
+		case "ANIM":
+			if len(c.data) < 6 {
+				return fail("ANIM chunk is too short")
+			}
+			// WebP counts how often the animation plays, 0 meaning forever.
+			switch loops := int(binary.LittleEndian.Uint16(c.data[4:])); loops {
+			case 0:
+				ap.loopCount = 0
+			case 1:
+				ap.loopCount = -1
+			default:
+				ap.loopCount = loops - 1
+			}
+		case "ANMF":
+			if len(c.data) < 16 {
+				return fail("frame %d header is too short", len(ap.frames))
+			}
+			x, y := 2*uint24(c.data), 2*uint24(c.data[3:])
+			w, h := uint24(c.data[6:])+1, uint24(c.data[9:])+1
+			r := image.Rect(x, y, x+w, y+h)
+			if !r.In(ap.canvas) {
+				return fail("frame %d at %v is not within the canvas %v", len(ap.frames), r, ap.canvas)
+			}
+			sub, err := readWebPChunks(c.data[16:])
+			if err != nil {
+				return fail("frame %d: %w", len(ap.frames), err)
+			}
+			img, err := decodeWebPFrame(sub, w, h)
+			if err != nil {
+				return fail("frame %d: %w", len(ap.frames), err)
+			}
+			f := Frame{Image: img, Delay: (uint24(c.data[12:]) + 5) / 10}
+			flags := c.data[15]
+			if flags&0x01 != 0 {
+				f.Disposal = DisposalBackground
+			}
+			// Not blending only makes a difference where the frame is not
+			// opaque.
+			if o, ok := img.(interface{ Opaque() bool }); flags&0x02 != 0 && !(ok && o.Opaque()) {
+				f.Blend = BlendSource
+			}
+			placed := newRGBA(r)
+			draw.Draw(placed, r, img, img.Bounds().Min, draw.Src)
+			f.Image = placed
+			ap.frames = append(ap.frames, f)
+		}
+	}
+	if ap.canvas.Empty() {
+		return fail("no VP8X chunk")
+	}
+	if len(ap.frames) == 0 {
+		return fail("animation has no frames")
+	}
+	return ap
+}
+
+// encodeAnimatedWebP encodes frames on canvas as an animated WebP file, the
+// frames in parallel. Frames that WebP cannot place or dispose of as they
+// are, such as those with DisposalPrevious, are drawn in full instead.
+func encodeAnimatedWebP(frames []Frame, canvas image.Rectangle, loopCount, quality int, lossless bool) ([]byte, error) {
+	quality, err := webpQuality(quality)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWebPSize(canvas.Dx(), canvas.Dy()); err != nil {
+		return nil, err
+	}
+	for i, f := range frames {
+		if !f.Image.Bounds().In(canvas) || f.Image.Bounds().Empty() {
+			return nil, fmt.Errorf("frame %d bounds %v are not within the canvas %v", i, f.Image.Bounds(), canvas)
+		}
+		if f.Delay < 0 || f.Delay*10 > webpMaxDuration {
+			return nil, fmt.Errorf("frame %d delay must be between 0 and %d (got: %d)", i, webpMaxDuration/10, f.Delay)
+		}
+	}
+	if slices.ContainsFunc(frames, func(f Frame) bool {
+		// Frame offsets are stored halved.
+		off := f.Image.Bounds().Min.Sub(canvas.Min)
+		return f.Disposal == DisposalPrevious || off.X%2 != 0 || off.Y%2 != 0
+	}) {
+		frames = coalescedFrames(frames, canvas)
+	}
+
+	anmf := make([][]byte, len(frames))
+	alpha := make([]bool, len(frames))
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	for i, f := range frames {
+		g.Go(func() error {
+			r := f.Image.Bounds().Sub(canvas.Min)
+			chunks, hasAlpha, err := webpFrame(f.Image, quality, lossless)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", i, err)
+			}
+			var flags byte
+			if f.Disposal == DisposalBackground {
+				flags |= 0x01
+			}
+			if f.Blend == BlendSource {
+				flags |= 0x02
+			}
+			header := []byte{
+				byte(r.Min.X / 2), byte(r.Min.X / 2 >> 8), byte(r.Min.X / 2 >> 16),
+				byte(r.Min.Y / 2), byte(r.Min.Y / 2 >> 8), byte(r.Min.Y / 2 >> 16),
+				byte(r.Dx() - 1), byte((r.Dx() - 1) >> 8), byte((r.Dx() - 1) >> 16),
+				byte(r.Dy() - 1), byte((r.Dy() - 1) >> 8), byte((r.Dy() - 1) >> 16),
+				byte(f.Delay * 10), byte(f.Delay * 10 >> 8), byte(f.Delay * 10 >> 16),
+				flags,
+			}
+			anmf[i] = appendWebPChunks(header, chunks...)
+			alpha[i] = hasAlpha || r != canvas.Sub(canvas.Min)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var flags byte = webpAnimationFlag
+	if slices.Contains(alpha, true) {
+		flags |= webpAlphaFlag
+	}
+	// The background color is a hint that viewers ignore; the canvas starts
+	// out transparent.
+	loops := 0
+	switch {
+	case loopCount < 0:
+		loops = 1
+	case loopCount > 0:
+		loops = min(loopCount+1, 0xffff)
+	}
+	chunks := []webpChunk{
+		webpVP8X(flags, canvas.Dx(), canvas.Dy()),
+		{"ANIM", []byte{0, 0, 0, 0, byte(loops), byte(loops >> 8)}},
+	}
+	for _, data := range anmf {
+		chunks = append(chunks, webpChunk{"ANMF", data})
+	}
+	var buf bytes.Buffer
+	if err := writeWebPContainer(&buf, chunks...); err != nil {
+		return nil, fmt.Errorf("failed to encode animated WebP: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ToWebP encodes the animation as an animated WebP with the delays,
+// disposal and blending methods and loop count of its frames, e.g. to
+// convert an animated GIF to a smaller file. Frames are lossy at the
+// quality set with WithWebPQuality, or lossless with WithWebPLossless;
+// other encode options are ignored. Delays keep their hundredths of a
+// second.
+// Returns an error if any previous operation in the chain failed, the
+// animation has no frames, is too large for WebP or an option is invalid.
+// This method is safe for concurrent use.
+func (ap *AnimationProcessor) ToWebP(opts ...EncodeOption) ([]byte, error) {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+
+	if ap.err != nil {
+		return nil, ap.err
+	}
+	if len(ap.frames) == 0 {
+		return nil, fmt.Errorf("animation has no frames")
+	}
+	eo := newEncodeOptions(EncodeOptions{}, opts)
+	return encodeAnimatedWebP(ap.frames, ap.canvas, ap.loopCount, eo.WebPQuality, eo.WebPLossless)
+}
@@ -0,0 +1,160 @@
+package gopiq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// blendingAnimation returns an 8×8 animation of an opaque red frame, a
+// frame that replaces the center with transparent and half transparent
+// blue pixels and is then disposed of, and an opaque corner.
+func blendingAnimation() *AnimationProcessor {
+	center := image.NewRGBA(image.Rect(2, 2, 6, 6))
+	center.SetRGBA(4, 4, color.RGBA{0, 0, 128, 128})
+	return &AnimationProcessor{
+		frames: []Frame{
+			{Image: createUniformImage(8, 8, color.RGBA{255, 0, 0, 255}), Delay: 10},
+			{Image: center, Delay: 20, Disposal: DisposalBackground, Blend: BlendSource},
+			{Image: createUniformImage(2, 2, color.RGBA{0, 255, 0, 255}), Delay: 30},
+		},
+		canvas:    image.Rect(0, 0, 8, 8),
+		loopCount: 4,
+	}
+}
+
+func TestToWebPAnimated(t *testing.T) {
+	data, err := FromBytesAnimated(testAnimatedGIF(t)).ToWebP(WithWebPLossless())
+	if err != nil {
+		t.Fatalf("ToWebP() should not error, got: %v", err)
+	}
+	if got := DetectFormat(data); got != FormatWebP {
+		t.Fatalf("ToWebP() output detected as %s, want webp", got)
+	}
+	ap := FromBytesAnimated(data)
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("FromBytesAnimated() on the encoded WebP should not error, got: %v", err)
+	}
+	if len(frames) != 3 || ap.Size() != image.Pt(20, 10) || ap.LoopCount() != 2 {
+		t.Fatalf("encoded WebP has %d frames of %v looping %d times, want 3 of (20,10) looping 2 times", len(frames), ap.Size(), ap.LoopCount())
+	}
+	for i, want := range []int{10, 20, 30} {
+		if frames[i].Delay != want {
+			t.Errorf("frame %d delay = %d, want %d", i, frames[i].Delay, want)
+		}
+	}
+	// Lossless frames look exactly like those of the GIF, DisposalPrevious
+	// included.
+	want := shownFrames(t, FromBytesAnimated(testAnimatedGIF(t)))
+	for i, f := range shownFrames(t, ap) {
+		if !bytes.Equal(f.Image.(*image.RGBA).Pix, want[i].Image.(*image.RGBA).Pix) {
+			t.Errorf("WebP frame %d differs from the GIF", i)
+		}
+	}
+
+	// Lossy frames come close.
+	data, err = FromBytesAnimated(testAnimatedGIF(t)).ToWebP(WithWebPQuality(90))
+	if err != nil {
+		t.Fatalf("ToWebP() with quality 90 should not error, got: %v", err)
+	}
+	lossy := shownFrames(t, FromBytesAnimated(data))
+	for i, f := range lossy {
+		for _, p := range []image.Point{{2, 2}, {12, 7}, {18, 2}} {
+			got, want := f.Image.(*image.RGBA).RGBAAt(p.X, p.Y), want[i].Image.(*image.RGBA).RGBAAt(p.X, p.Y)
+			if abs(int(got.R)-int(want.R)) > 16 || abs(int(got.G)-int(want.G)) > 16 || abs(int(got.B)-int(want.B)) > 16 || got.A != want.A {
+				t.Errorf("lossy frame %d at %v = %v, want close to %v", i, p, got, want)
+			}
+		}
+	}
+}
+
+func TestToWebPBlending(t *testing.T) {
+	data, err := blendingAnimation().ToWebP(WithWebPLossless())
+	if err != nil {
+		t.Fatalf("ToWebP() should not error, got: %v", err)
+	}
+	ap := FromBytesAnimated(data)
+	frames, err := ap.Frames()
+	if err != nil {
+		t.Fatalf("FromBytesAnimated() should not error, got: %v", err)
+	}
+	if ap.LoopCount() != 4 {
+		t.Errorf("LoopCount() = %d, want 4", ap.LoopCount())
+	}
+	// Partial frames keep their position, blending and disposal.
+	if got := frames[1].Image.Bounds(); got != image.Rect(2, 2, 6, 6) {
+		t.Errorf("frame 1 bounds = %v, want (2,2)-(6,6)", got)
+	}
+	if frames[1].Blend != BlendSource || frames[1].Disposal != DisposalBackground {
+		t.Errorf("frame 1 blend %d and disposal %d, want BlendSource and DisposalBackground", frames[1].Blend, frames[1].Disposal)
+	}
+
+	shown := shownFrames(t, ap)
+	checks := []struct {
+		frame int
+		at    image.Point
+		want  color.RGBA
+	}{
+		{1, image.Pt(3, 3), color.RGBA{}},               // Replaced with transparent
+		{1, image.Pt(4, 4), color.RGBA{0, 0, 128, 128}}, // Not blended with the red below
+		{1, image.Pt(7, 7), color.RGBA{255, 0, 0, 255}}, // Outside the frame
+		{2, image.Pt(4, 4), color.RGBA{}},               // Disposed of to transparent
+		{2, image.Pt(1, 1), color.RGBA{0, 255, 0, 255}}, // Drawn over the red
+		{2, image.Pt(7, 7), color.RGBA{255, 0, 0, 255}}, // Kept from frame 0
+	}
+	for _, c := range checks {
+		if got := shown[c.frame].Image.(*image.RGBA).RGBAAt(c.at.X, c.at.Y); got != c.want {
+			t.Errorf("frame %d at %v = %v, want %v", c.frame, c.at, got, c.want)
+		}
+	}
+
+	// GIF has no blending: the frames are written in full to look the same,
+	// apart from partial transparency.
+	gifData, err := ap.ToGIF()
+	if err != nil {
+		t.Fatalf("ToGIF() of a WebP animation should not error, got: %v", err)
+	}
+	converted := shownFrames(t, FromBytesAnimated(gifData))
+	if _, _, _, a := converted[1].Image.At(3, 3).RGBA(); a != 0 {
+		t.Errorf("GIF frame 1 at (3,3) has alpha %d, want transparent", a>>8)
+	}
+	if got := color.RGBAModel.Convert(converted[2].Image.At(7, 7)); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("GIF frame 2 at (7,7) = %v, want red", got)
+	}
+}
+
+func TestToWebPAnimatedInvalidInput(t *testing.T) {
+	data, err := blendingAnimation().ToWebP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case: Invalid input
+	if err := FromBytesAnimated(data[:len(data)-20]).Err(); err == nil {
+		t.Error("FromBytesAnimated() of a truncated WebP should return an error")
+	}
+	tiny := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(tiny[4:], 2)
+	if err := FromBytesAnimated(tiny).Err(); err == nil {
+		t.Error("FromBytesAnimated() of a WebP with a RIFF size below 4 should return an error")
+	}
+	still := mustBytes(t, New(createTestImage(10, 10)), FormatWebP)
+	binary.LittleEndian.PutUint32(still[4:], 2)
+	if err := FromBytesAnimated(still).Err(); err == nil {
+		t.Error("FromBytesAnimated() of a still WebP with a RIFF size below 4 should return an error")
+	}
+	if _, err := blendingAnimation().ToWebP(WithWebPQuality(101)); err == nil {
+		t.Error("ToWebP() with an invalid quality should return an error")
+	}
+	negative := blendingAnimation()
+	negative.frames[0].Delay = -1
+	if _, err := negative.ToWebP(); err == nil {
+		t.Error("ToWebP() with a negative delay should return an error")
+	}
+	if _, err := FromBytesAnimated(nil).ToWebP(); err == nil {
+		t.Error("ToWebP() should keep the previous error")
+	}
+}
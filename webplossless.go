@@ -0,0 +1,665 @@
+package gopiq
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// This file implements a VP8L (lossless WebP) encoder: pixels go through the
+// color-indexing transform when they have few colors, and the subtract-green
+// and predictor transforms otherwise, and are then written with LZ77
+// backward references and canonical prefix codes.
+
+const (
+	vp8lMagic        = 0x2f
+	vp8lTileBits     = 4 // Predictor tiles of 16×16 pixels
+	vp8lMinMatch     = 3
+	vp8lMaxMatch     = 4096
+	vp8lMaxDistance  = 1<<20 - 120
+	vp8lHashBits     = 16
+	vp8lMaxChain     = 24
+	vp8lLiteralCodes = 256
+	vp8lLengthCodes  = 24
+	vp8lDistCodes    = 40
+)
+
+// vp8lDistanceMap lists the (dy, 8-dx) pixel offsets of the short distance
+// codes 1 to 120, so that nearby pixels above cost fewer bits.
+var vp8lDistanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// vp8lCodeLengthOrder is the order in which the lengths of the code length
+// code are written.
+var vp8lCodeLengthOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// lsbWriter writes a bit stream least significant bit first.
+type lsbWriter struct {
+	buf   []byte
+	bits  uint64
+	nBits uint
+}
+
+// write writes the n low bits of v, with n at most 32.
+func (w *lsbWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nBits -= 8
+	}
+}
+
+// bytes flushes the pending bits and returns the stream.
+func (w *lsbWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nBits = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical prefix code over an alphabet.
+type prefixCode struct {
+	lengths []uint8  // Code lengths as written in the stream; 0 for unused symbols
+	codes   []uint16 // Bit-reversed codes, ready to be written LSB first
+	nBits   []uint8  // Bits written per symbol: 0 when only one symbol is used
+}
+
+// huffmanLengths returns code lengths of at most maxLen bits for symbols
+// with the given counts, 0 for unused symbols. A single used symbol gets
+// length 1. When the optimal code is too deep, rare symbols are counted as
+// more frequent until it fits.
+func huffmanLengths(counts []uint32, maxLen int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var syms []int
+	for s, c := range counts {
+		if c > 0 {
+			syms = append(syms, s)
+		}
+	}
+	switch len(syms) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[syms[0]] = 1
+		return lengths
+	}
+	n := len(syms)
+	weight := make([]uint64, 2*n-1)
+	parent := make([]int, 2*n-1)
+	depth := make([]uint8, 2*n-1)
+	for floor := uint64(1); ; floor *= 2 {
+		w := func(s int) uint64 { return max(uint64(counts[s]), floor) }
+		slices.SortStableFunc(syms, func(a, b int) int { return cmp.Compare(w(a), w(b)) })
+		for i, s := range syms {
+			weight[i] = w(s)
+		}
+		// Leaves are nodes 0..n-1 by weight, inner nodes follow in the order
+		// they are made, which is also by weight: take the two lightest.
+		leaf, inner := 0, n
+		lightest := func(next int) int {
+			if leaf < n && (inner == next || weight[leaf] <= weight[inner]) {
+				leaf++
+				return leaf - 1
+			}
+			inner++
+			return inner - 1
+		}
+		for next := n; next < 2*n-1; next++ {
+			a := lightest(next)
+			b := lightest(next)
+			weight[next] = weight[a] + weight[b]
+			parent[a], parent[b] = next, next
+		}
+		fits := true
+		depth[2*n-2] = 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			if i < n && int(depth[i]) > maxLen {
+				fits = false
+			}
+		}
+		if fits {
+			for i, s := range syms {
+				lengths[s] = depth[i]
+			}
+			return lengths
+		}
+	}
+}
+
+// newPrefixCode returns the canonical prefix code for symbols with the given
+// counts, with codes of at most maxLen bits.
+func newPrefixCode(counts []uint32, maxLen int) *prefixCode {
+	c := &prefixCode{
+		lengths: huffmanLengths(counts, maxLen),
+		codes:   make([]uint16, len(counts)),
+		nBits:   make([]uint8, len(counts)),
+	}
+	var perLength [16]int
+	used := 0
+	for _, l := range c.lengths {
+		if l > 0 {
+			perLength[l]++
+			used++
+		}
+	}
+	if used == 1 {
+		// A lone symbol is decoded without reading any bits.
+		return c
+	}
+	var next [16]int
+	code := 0
+	for l := 1; l < len(next); l++ {
+		code = (code + perLength[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range c.lengths {
+		if l > 0 {
+			c.codes[s] = uint16(bits.Reverse16(uint16(next[l])) >> (16 - l))
+			c.nBits[s] = l
+			next[l]++
+		}
+	}
+	return c
+}
+
+// put writes symbol s.
+func (c *prefixCode) put(w *lsbWriter, s int) {
+	w.write(uint32(c.codes[s]), uint(c.nBits[s]))
+}
+
+// writeTo writes the code lengths of c: as a simple code when at most two
+// symbols below 256 are used, and otherwise run-length coded with a code
+// length code.
+func (c *prefixCode) writeTo(w *lsbWriter) {
+	var syms []int
+	for s, l := range c.lengths {
+		if l > 0 {
+			syms = append(syms, s)
+		}
+	}
+	if len(syms) == 0 {
+		// An alphabet that is never used still needs a valid code.
+		syms = []int{0}
+	}
+	if len(syms) <= 2 && syms[len(syms)-1] < 256 {
+		w.write(1, 1)
+		w.write(uint32(len(syms)-1), 1)
+		if syms[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(syms[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(syms[0]), 8)
+		}
+		if len(syms) == 2 {
+			w.write(uint32(syms[1]), 8)
+		}
+		return
+	}
+
+	tokens := rleCodeLengths(c.lengths)
+	var counts [19]uint32
+	for _, t := range tokens {
+		counts[t.code]++
+	}
+	lengthCode := newPrefixCode(counts[:], 7)
+	n := 4
+	for i, s := range vp8lCodeLengthOrder {
+		if lengthCode.lengths[s] != 0 {
+			n = max(n, i+1)
+		}
+	}
+	w.write(0, 1)
+	w.write(uint32(n-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[s]), 3)
+	}
+	w.write(0, 1) // Lengths for the whole alphabet follow
+	for _, t := range tokens {
+		lengthCode.put(w, int(t.code))
+		switch t.code {
+		case 16:
+			w.write(uint32(t.extra), 2)
+		case 17:
+			w.write(uint32(t.extra), 3)
+		case 18:
+			w.write(uint32(t.extra), 7)
+		}
+	}
+}
+
+// codeLengthToken is a symbol of the code length code: a length up to 15,
+// 16 to repeat the previous non-zero length 3-6 times, or 17 and 18 to
+// repeat zero 3-10 and 11-138 times, with the repeat count in extra.
+type codeLengthToken struct {
+	code, extra uint8
+}
+
+// rleCodeLengths run-length codes lengths.
+func rleCodeLengths(lengths []uint8) []codeLengthToken {
+	var out []codeLengthToken
+	prev := uint8(8) // The length 16 repeats before any non-zero length
+	for i := 0; i < len(lengths); {
+		l, run := lengths[i], 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					out = append(out, codeLengthToken{18, uint8(n - 11)})
+					run -= n
+				} else {
+					n := min(run, 10)
+					out = append(out, codeLengthToken{17, uint8(n - 3)})
+					run -= n
+				}
+			}
+		} else {
+			if l != prev {
+				out = append(out, codeLengthToken{l, 0})
+				prev = l
+				run--
+			}
+			for run >= 3 {
+				n := min(run, 6)
+				out = append(out, codeLengthToken{16, uint8(n - 3)})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			out = append(out, codeLengthToken{l, 0})
+		}
+	}
+	return out
+}
+
+// vp8lPrefix splits an LZ77 length or distance code v into a prefix
+// symbol and extra bits.
+func vp8lPrefix(v int) (sym int, nExtra uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := bits.Len(uint(d)) - 1
+	second := (d >> (h - 1)) & 1
+	return 2*h + second, uint(h - 1), uint32(d & (1<<(h-1) - 1))
+}
+
+// vp8lRef is a literal pixel or, when length is not zero, a copy of length
+// pixels from distance code dist back.
+type vp8lRef struct {
+	argb   uint32
+	length int32
+	dist   int32
+}
+
+// vp8lBackwardRefs finds LZ77 copies in pix, a w pixels wide image, with
+// hash chains and greedy matching.
+func vp8lBackwardRefs(pix []uint32, w int) []vp8lRef {
+	n := len(pix)
+	// Distances to the pixels just above get the short codes.
+	distCodes := make(map[int]int32, len(vp8lDistanceMap))
+	for i := len(vp8lDistanceMap) - 1; i >= 0; i-- {
+		c := vp8lDistanceMap[i]
+		if d := int(c>>4)*w + 8 - int(c&0xf); d >= 1 {
+			distCodes[d] = int32(i + 1)
+		}
+	}
+	distCode := func(d int) int32 {
+		if c, ok := distCodes[d]; ok {
+			return c
+		}
+		return int32(d + len(vp8lDistanceMap))
+	}
+
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i], head[h] = head[h], int32(i)
+		}
+	}
+
+	refs := make([]vp8lRef, 0, n/2)
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		limit := min(n-i, vp8lMaxMatch)
+		try := func(j int) {
+			if bestLen == limit || j < 0 || j >= i || i-j > vp8lMaxDistance || pix[j+bestLen] != pix[i+bestLen] {
+				return
+			}
+			l := 0
+			for l < limit && pix[j+l] == pix[i+l] {
+				l++
+			}
+			if l > bestLen {
+				bestLen, bestDist = l, i-j
+			}
+		}
+		if limit >= vp8lMinMatch {
+			try(i - 1)
+			try(i - w)
+			if i+1 < n {
+				for j, k := head[hash(i)], 0; j >= 0 && k < vp8lMaxChain && bestLen < limit; j, k = prev[j], k+1 {
+					try(int(j))
+				}
+			}
+		}
+		if bestLen < vp8lMinMatch {
+			refs = append(refs, vp8lRef{argb: pix[i]})
+			insert(i)
+			i++
+			continue
+		}
+		refs = append(refs, vp8lRef{length: int32(bestLen), dist: distCode(bestDist)})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+	}
+	return refs
+}
+
+// writeVP8LPixels writes pix, a w pixels wide image, as an entropy-coded
+// image without color cache; the top-level image also says it uses a single
+// set of prefix codes.
+func writeVP8LPixels(bw *lsbWriter, pix []uint32, w int, topLevel bool) {
+	bw.write(0, 1) // No color cache
+	if topLevel {
+		bw.write(0, 1) // No meta prefix codes
+	}
+	refs := vp8lBackwardRefs(pix, w)
+	green := make([]uint32, vp8lLiteralCodes+vp8lLengthCodes)
+	red := make([]uint32, 256)
+	blue := make([]uint32, 256)
+	alpha := make([]uint32, 256)
+	dist := make([]uint32, vp8lDistCodes)
+	for _, r := range refs {
+		if r.length == 0 {
+			green[r.argb>>8&0xff]++
+			red[r.argb>>16&0xff]++
+			blue[r.argb&0xff]++
+			alpha[r.argb>>24]++
+			continue
+		}
+		l, _, _ := vp8lPrefix(int(r.length))
+		d, _, _ := vp8lPrefix(int(r.dist))
+		green[vp8lLiteralCodes+l]++
+		dist[d]++
+	}
+	codes := [5]*prefixCode{}
+	for i, counts := range [][]uint32{green, red, blue, alpha, dist} {
+		codes[i] = newPrefixCode(counts, 15)
+		codes[i].writeTo(bw)
+	}
+	for _, r := range refs {
+		if r.length == 0 {
+			codes[0].put(bw, int(r.argb>>8&0xff))
+			codes[1].put(bw, int(r.argb>>16&0xff))
+			codes[2].put(bw, int(r.argb&0xff))
+			codes[3].put(bw, int(r.argb>>24))
+			continue
+		}
+		sym, n, extra := vp8lPrefix(int(r.length))
+		codes[0].put(bw, vp8lLiteralCodes+sym)
+		bw.write(extra, n)
+		sym, n, extra = vp8lPrefix(int(r.dist))
+		codes[4].put(bw, sym)
+		bw.write(extra, n)
+	}
+}
+
+// subPixels subtracts b from a per channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	ag := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	rb := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// average2 returns the per channel average of a and b, rounded down.
+func average2(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// channel returns the channel of v at bit shift s.
+func channel(v uint32, s uint) int32 {
+	return int32(v >> s & 0xff)
+}
+
+// vp8lPredict returns the prediction of predictor mode from the left, top,
+// top-right and top-left pixels.
+func vp8lPredict(mode int, l, t, tr, tl uint32) uint32 {
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		var dl, dt int32
+		for s := uint(0); s < 32; s += 8 {
+			dl += abs32(channel(tl, s) - channel(t, s))
+			dt += abs32(channel(tl, s) - channel(l, s))
+		}
+		if dl < dt {
+			return l
+		}
+		return t
+	case 12:
+		var p uint32
+		for s := uint(0); s < 32; s += 8 {
+			p |= uint32(clamp255(channel(l, s)+channel(t, s)-channel(tl, s))) << s
+		}
+		return p
+	default:
+		a := average2(l, t)
+		var p uint32
+		for s := uint(0); s < 32; s += 8 {
+			p |= uint32(clamp255(channel(a, s)+(channel(a, s)-channel(tl, s))/2)) << s
+		}
+		return p
+	}
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clamp255(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// vp8lPredictorResiduals picks the predictor mode of each tile of pix that
+// leaves the smallest residuals, and returns the residuals and the modes as
+// an image with a pixel per tile.
+func vp8lPredictorResiduals(pix []uint32, w, h int) (residuals, modes []uint32) {
+	const size = 1 << vp8lTileBits
+	tw, th := (w+size-1)/size, (h+size-1)/size
+	residuals = make([]uint32, len(pix))
+	modes = make([]uint32, tw*th)
+	neighbors := func(i int) (l, t, tr, tl uint32) {
+		return pix[i-1], pix[i-w], pix[i-w+1], pix[i-w-1]
+	}
+	for ty := range th {
+		for tx := range tw {
+			best, bestCost := 0, int32(-1)
+			for mode := range 14 {
+				var cost int32
+				for y := max(ty*size, 1); y < min((ty+1)*size, h); y++ {
+					for x := max(tx*size, 1); x < min((tx+1)*size, w); x++ {
+						i := y*w + x
+						l, t, tr, tl := neighbors(i)
+						r := subPixels(pix[i], vp8lPredict(mode, l, t, tr, tl))
+						for s := uint(0); s < 32; s += 8 {
+							cost += abs32(int32(int8(r >> s)))
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tw+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+	for y := range h {
+		for x := range w {
+			i := y*w + x
+			var p uint32
+			switch {
+			case i == 0:
+				p = 0xff000000
+			case y == 0:
+				p = pix[i-1]
+			case x == 0:
+				p = pix[i-w]
+			default:
+				mode := int(modes[(y/size)*tw+x/size] >> 8 & 0xf)
+				l, t, tr, tl := neighbors(i)
+				p = vp8lPredict(mode, l, t, tr, tl)
+			}
+			residuals[i] = subPixels(pix[i], p)
+		}
+	}
+	return residuals, modes
+}
+
+// vp8lPalette returns the sorted colors of pix, or nil if it has more than
+// 256.
+func vp8lPalette(pix []uint32) []uint32 {
+	seen := make(map[uint32]bool)
+	for _, c := range pix {
+		if !seen[c] {
+			if len(seen) == 256 {
+				return nil
+			}
+			seen[c] = true
+		}
+	}
+	palette := make([]uint32, 0, len(seen))
+	for c := range seen {
+		palette = append(palette, c)
+	}
+	slices.Sort(palette)
+	return palette
+}
+
+// encodeVP8L encodes pix, w×h ARGB pixels, as a VP8L bit stream. hasAlpha
+// is recorded in the header as a hint to decoders.
+func encodeVP8L(pix []uint32, w, h int, hasAlpha bool) []byte {
+	bw := &lsbWriter{}
+	bw.write(vp8lMagic, 8)
+	bw.write(uint32(w-1), 14)
+	bw.write(uint32(h-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // Version
+
+	if palette := vp8lPalette(pix); palette != nil {
+		// Color-indexing transform: a palette, delta coded, and the indices
+		// packed up to 8 per pixel when there are few colors.
+		bw.write(1, 1)
+		bw.write(3, 2)
+		bw.write(uint32(len(palette)-1), 8)
+		deltas := make([]uint32, len(palette))
+		index := make(map[uint32]uint32, len(palette))
+		for i, c := range palette {
+			deltas[i] = c
+			if i > 0 {
+				deltas[i] = subPixels(c, palette[i-1])
+			}
+			index[c] = uint32(i)
+		}
+		writeVP8LPixels(bw, deltas, len(deltas), false)
+
+		shift := 0
+		switch {
+		case len(palette) <= 2:
+			shift = 3
+		case len(palette) <= 4:
+			shift = 2
+		case len(palette) <= 16:
+			shift = 1
+		}
+		pw := (w + 1<<shift - 1) >> shift
+		packed := make([]uint32, pw*h)
+		for y := range h {
+			for x := range w {
+				bit := uint(8 + (x&(1<<shift-1))*(8>>shift))
+				packed[y*pw+x>>shift] |= index[pix[y*w+x]] << bit
+			}
+		}
+		for i := range packed {
+			packed[i] |= 0xff000000
+		}
+		pix, w = packed, pw
+	} else {
+		// Subtract-green transform, then the predictor transform; decoders
+		// undo them in reverse order.
+		green := make([]uint32, len(pix))
+		for i, c := range pix {
+			g := c >> 8 & 0xff
+			green[i] = c&0xff00ff00 | (c>>16-g)&0xff<<16 | (c-g)&0xff
+		}
+		bw.write(1, 1)
+		bw.write(2, 2)
+
+		residuals, modes := vp8lPredictorResiduals(green, w, h)
+		bw.write(1, 1)
+		bw.write(0, 2)
+		bw.write(vp8lTileBits-2, 3)
+		writeVP8LPixels(bw, modes, (w+1<<vp8lTileBits-1)>>vp8lTileBits, false)
+		pix = residuals
+	}
+	bw.write(0, 1) // No more transforms
+	writeVP8LPixels(bw, pix, w, true)
+	return bw.bytes()
+}
@@ -0,0 +1,84 @@
+package gopiq
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// decodeVP8L decodes a VP8L bit stream of a w×h image to straight-alpha
+// ARGB pixels.
+func decodeVP8L(t *testing.T, stream []byte, w, h int) []uint32 {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeWebPContainer(&buf, webpChunk{"VP8L", stream}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("VP8L stream of %dx%d does not decode: %v", w, h, err)
+	}
+	m := img.(*image.NRGBA)
+	pix := make([]uint32, 0, w*h)
+	for i := 0; i < len(m.Pix); i += 4 {
+		pix = append(pix, uint32(m.Pix[i+3])<<24|uint32(m.Pix[i])<<16|uint32(m.Pix[i+1])<<8|uint32(m.Pix[i+2]))
+	}
+	return pix
+}
+
+func TestEncodeVP8L(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	images := map[string]func(x, y int) uint32{
+		"gradient": func(x, y int) uint32 { return 0xff000000 | uint32(x*3)<<16 | uint32(y*5)<<8 | uint32(x+y) },
+		"noise":    func(x, y int) uint32 { return rng.Uint32() | 0xff000000 },
+		"alpha":    func(x, y int) uint32 { return uint32(x*4)<<24 | uint32(y)<<16 | 0x8040 },
+		"few colors": func(x, y int) uint32 {
+			return []uint32{0xffff0000, 0xff00ff00, 0x800000ff}[(x/3+y/2)%3]
+		},
+		"one color": func(x, y int) uint32 { return 0xff123456 },
+	}
+	for name, color := range images {
+		for _, size := range []image.Point{{1, 1}, {3, 2}, {17, 33}, {60, 45}} {
+			pix := make([]uint32, 0, size.X*size.Y)
+			hasAlpha := false
+			for y := range size.Y {
+				for x := range size.X {
+					c := color(x, y)
+					pix = append(pix, c)
+					hasAlpha = hasAlpha || c>>24 != 0xff
+				}
+			}
+			got := decodeVP8L(t, encodeVP8L(pix, size.X, size.Y, hasAlpha), size.X, size.Y)
+			for i := range pix {
+				if got[i] != pix[i] {
+					t.Errorf("%s %v: pixel %d = %08x, want %08x", name, size, i, got[i], pix[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// Fibonacci counts make the optimal code as deep as there are symbols.
+	counts := []uint32{1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89, 144, 233, 377, 610, 987, 1597, 2584}
+	for _, maxLen := range []int{7, 15} {
+		lengths := huffmanLengths(counts, maxLen)
+		kraft := 0
+		for s, l := range lengths {
+			if l == 0 || int(l) > maxLen {
+				t.Fatalf("symbol %d has length %d, want 1..%d", s, l, maxLen)
+			}
+			kraft += 1 << (maxLen - int(l))
+		}
+		if kraft != 1<<maxLen {
+			t.Errorf("lengths %v of at most %d bits do not make a complete code", lengths, maxLen)
+		}
+	}
+	if got := huffmanLengths([]uint32{0, 7, 0}, 15); got[1] != 1 || got[0] != 0 || got[2] != 0 {
+		t.Errorf("lone symbol lengths = %v, want [0 1 0]", got)
+	}
+}
@@ -0,0 +1,1177 @@
+package gopiq
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+)
+
+// This file implements a VP8 (lossy WebP) key frame encoder following RFC
+// 6386: every macroblock is predicted as a whole (16×16 luma and 8×8
+// chroma modes), its residuals are transformed and quantized, and the
+// coefficient tokens are arithmetic coded with probabilities adapted to the
+// image.
+
+// Prediction modes of macroblocks, numbered as in the decoder.
+const (
+	vp8PredDC = iota
+	vp8PredTM
+	vp8PredVE
+	vp8PredHE
+)
+
+// Coefficient planes of the token probabilities: luma AC with the DCs in
+// Y2, the Y2 block itself, and chroma.
+const (
+	vp8PlaneYAC = iota
+	vp8PlaneY2
+	vp8PlaneUV
+)
+
+const (
+	vp8MaxLevel = 2047
+	// Rounding biases of the quantizer in 1/256 of a step, for DC and AC
+	// coefficients: rounding down a little more often saves bits.
+	vp8BiasDC = 96
+	vp8BiasAC = 110
+	// vp8MaxPartition is the largest partition the bit stream can describe.
+	vp8MaxPartition = 1<<24 - 1
+)
+
+var (
+	vp8Bands  = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	vp8Zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// vp8Cat3456 holds the probabilities of the extra bits of the large
+	// coefficient categories.
+	vp8Cat3456 = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+// boolEncoder is the boolean arithmetic coder of VP8 (RFC 6386, section 7).
+type boolEncoder struct {
+	buf    []byte
+	rng    uint32
+	bottom uint32
+	nBits  int // Shifts left before the next byte is complete
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, nBits: 24}
+}
+
+// put writes bit, which is false with probability prob/256.
+func (e *boolEncoder) put(prob uint8, bit bool) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			// Carry into the bytes already written.
+			i := len(e.buf) - 1
+			for ; e.buf[i] == 255; i-- {
+				e.buf[i] = 0
+			}
+			e.buf[i]++
+		}
+		e.bottom <<= 1
+		if e.nBits--; e.nBits == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.nBits = 8
+		}
+	}
+}
+
+// putLiteral writes the n low bits of v, most significant first.
+func (e *boolEncoder) putLiteral(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.put(128, v>>i&1 != 0)
+	}
+}
+
+// bytes flushes the coder and returns its output.
+func (e *boolEncoder) bytes() []byte {
+	for range 32 {
+		e.put(128, false)
+	}
+	return e.buf
+}
+
+// vp8QualityToQuant maps a quality of 1 to 100 to a quantizer index of 127
+// to 0 with the curve libwebp uses, so that qualities mean about the same
+// as with cwebp.
+func vp8QualityToQuant(quality int) int {
+	c := float64(quality) / 100
+	linear := c * 2 / 3
+	if c >= 0.75 {
+		linear = 2*c - 1
+	}
+	return int(math.Round(127 * (1 - math.Cbrt(linear))))
+}
+
+// vp8Macroblock holds the modes and quantized coefficients, in zigzag order,
+// of a macroblock.
+type vp8Macroblock struct {
+	yMode, uvMode uint8
+	y2            [16]int16
+	y             [16][16]int16
+	uv            [8][16]int16 // Four U blocks, then four V blocks
+	skip          bool
+}
+
+// vp8Encoder encodes a frame.
+type vp8Encoder struct {
+	w, h, mbw, mbh int
+	// Source and reconstructed planes, padded to whole macroblocks.
+	y, u, v    []uint8
+	ry, ru, rv []uint8
+	// Dequantization factors for DC and AC coefficients.
+	y1, y2, uvq [2]int32
+	mbs         []vp8Macroblock
+}
+
+// convert converts img to limited range Y'CbCr planes with 4:2:0
+// chroma, as libwebp does, repeating the edge pixels to fill whole
+// macroblocks.
+func (e *vp8Encoder) convert(img *image.RGBA) {
+	yw, cw := e.mbw*16, e.mbw*8
+	e.y = make([]uint8, yw*e.mbh*16)
+	e.u = make([]uint8, cw*e.mbh*8)
+	e.v = make([]uint8, cw*e.mbh*8)
+	rgb := func(x, y int) (r, g, b int32) {
+		i := img.PixOffset(min(x, e.w-1), min(y, e.h-1))
+		a := img.Pix[i+3]
+		return int32(unpremultiply(img.Pix[i], a)), int32(unpremultiply(img.Pix[i+1], a)), int32(unpremultiply(img.Pix[i+2], a))
+	}
+	for y := range e.mbh * 16 {
+		for x := range yw {
+			r, g, b := rgb(x, y)
+			e.y[y*yw+x] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+		}
+	}
+	for y := range e.mbh * 8 {
+		for x := range cw {
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			e.u[y*cw+x] = clamp255((-9719*r - 19081*g + 28800*b + 1<<17 + 128<<18) >> 18)
+			e.v[y*cw+x] = clamp255((28800*r - 24116*g - 4684*b + 1<<17 + 128<<18) >> 18)
+		}
+	}
+	e.ry = make([]uint8, len(e.y))
+	e.ru = make([]uint8, len(e.u))
+	e.rv = make([]uint8, len(e.v))
+}
+
+// vp8Edges returns the reconstructed pixels above and left of the size×size
+// block at (x, y) of plane, with the values decoders assume outside the
+// image, and which of them are inside.
+func vp8Edges(plane []uint8, stride, x, y, size int) (top, left []uint8, corner uint8, hasTop, hasLeft bool) {
+	top, left = make([]uint8, size), make([]uint8, size)
+	hasTop, hasLeft = y > 0, x > 0
+	for i := range size {
+		top[i], left[i] = 127, 129
+		if hasTop {
+			top[i] = plane[(y-1)*stride+x+i]
+		}
+		if hasLeft {
+			left[i] = plane[(y+i)*stride+x-1]
+		}
+	}
+	switch {
+	case !hasTop:
+		corner = 127
+	case !hasLeft:
+		corner = 129
+	default:
+		corner = plane[(y-1)*stride+x-1]
+	}
+	return top, left, corner, hasTop, hasLeft
+}
+
+// vp8Predict fills pred, a size×size block, with the prediction of mode.
+func vp8Predict(pred []uint8, size int, mode uint8, top, left []uint8, corner uint8, hasTop, hasLeft bool) {
+	switch mode {
+	case vp8PredDC:
+		var sum, n int
+		if hasTop {
+			for _, v := range top {
+				sum += int(v)
+			}
+			n += size
+		}
+		if hasLeft {
+			for _, v := range left {
+				sum += int(v)
+			}
+			n += size
+		}
+		dc := uint8(128)
+		if n > 0 {
+			dc = uint8((sum + n/2) / n)
+		}
+		for i := range pred[:size*size] {
+			pred[i] = dc
+		}
+	case vp8PredTM:
+		for j := range size {
+			for i := range size {
+				pred[j*size+i] = clamp255(int32(left[j]) + int32(top[i]) - int32(corner))
+			}
+		}
+	case vp8PredVE:
+		for j := range size {
+			copy(pred[j*size:(j+1)*size], top)
+		}
+	case vp8PredHE:
+		for j := range size {
+			for i := range size {
+				pred[j*size+i] = left[j]
+			}
+		}
+	}
+}
+
+// blockSSE returns the sum of squared differences of the size×size block at
+// (x, y) of plane and block.
+func blockSSE(plane []uint8, stride, x, y, size int, block []uint8) int {
+	sum := 0
+	for j := range size {
+		for i := range size {
+			d := int(plane[(y+j)*stride+x+i]) - int(block[j*size+i])
+			sum += d * d
+		}
+	}
+	return sum
+}
+
+// forwardDCT returns the transform of the 4×4 residual of src, a block of
+// the plane at offset, and pred, a block of predStride.
+func forwardDCT(src []uint8, offset, stride int, pred []uint8, predOffset, predStride int) (out [16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		s, p := src[offset+i*stride:], pred[predOffset+i*predStride:]
+		d0, d1 := int32(s[0])-int32(p[0]), int32(s[1])-int32(p[1])
+		d2, d3 := int32(s[2])-int32(p[2]), int32(s[3])-int32(p[3])
+		a0, a1, a2, a3 := d0+d3, d1+d2, d1-d2, d0-d3
+		tmp[0+i*4] = (a0 + a1) * 8
+		tmp[1+i*4] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[2+i*4] = (a0 - a1) * 8
+		tmp[3+i*4] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := range 4 {
+		a0, a1 := tmp[0+i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[0+i]-tmp[12+i]
+		out[0+i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// inverseDCT adds the inverse transform of coeffs to the 4×4 block of dst at
+// offset, exactly as decoders do.
+func inverseDCT(coeffs *[16]int32, dst []uint8, offset, stride int) {
+	const c1, c2 = 85627, 35468
+	var m [4][4]int32
+	for i := range 4 {
+		a := coeffs[i] + coeffs[8+i]
+		b := coeffs[i] - coeffs[8+i]
+		c := (coeffs[4+i]*c2)>>16 - (coeffs[12+i]*c1)>>16
+		d := (coeffs[4+i]*c1)>>16 + (coeffs[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a, b := dc+m[2][j], dc-m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		row := dst[offset+j*stride:]
+		row[0] = clamp255(int32(row[0]) + (a+d)>>3)
+		row[1] = clamp255(int32(row[1]) + (b+c)>>3)
+		row[2] = clamp255(int32(row[2]) + (b-c)>>3)
+		row[3] = clamp255(int32(row[3]) + (a-d)>>3)
+	}
+}
+
+// forwardWHT returns the Walsh-Hadamard transform of the DCs of the 16
+// luma blocks.
+func forwardWHT(dc *[16]int32) (out [16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		in := dc[i*4:]
+		a0, a1 := in[0]+in[2], in[1]+in[3]
+		a2, a3 := in[1]-in[3], in[0]-in[2]
+		tmp[0+i*4] = a0 + a1
+		tmp[1+i*4] = a3 + a2
+		tmp[2+i*4] = a3 - a2
+		tmp[3+i*4] = a0 - a1
+	}
+	for i := range 4 {
+		a0, a1 := tmp[0+i]+tmp[8+i], tmp[4+i]+tmp[12+i]
+		a2, a3 := tmp[4+i]-tmp[12+i], tmp[0+i]-tmp[8+i]
+		out[0+i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+	return out
+}
+
+// inverseWHT returns the DCs of the 16 luma blocks from their transform,
+// exactly as decoders do.
+func inverseWHT(in *[16]int32) (dc [16]int32) {
+	var m [16]int32
+	for i := range 4 {
+		a0, a1 := in[0+i]+in[12+i], in[4+i]+in[8+i]
+		a2, a3 := in[4+i]-in[8+i], in[0+i]-in[12+i]
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := range 4 {
+		d := m[0+i*4] + 3
+		a0, a1 := d+m[3+i*4], m[1+i*4]+m[2+i*4]
+		a2, a3 := m[1+i*4]-m[2+i*4], d-m[3+i*4]
+		dc[i*4+0] = (a0 + a1) >> 3
+		dc[i*4+1] = (a3 + a2) >> 3
+		dc[i*4+2] = (a0 - a1) >> 3
+		dc[i*4+3] = (a3 - a2) >> 3
+	}
+	return dc
+}
+
+// vp8Quantize returns the level of coefficient c for step q and rounding bias,
+// and the coefficient decoders get back from it.
+func vp8Quantize(c, q, bias int32) (level int16, dequantized int32) {
+	a := c
+	if a < 0 {
+		a = -a
+	}
+	l := min((a*256+q*bias)/(q*256), vp8MaxLevel)
+	if c < 0 {
+		l = -l
+	}
+	return int16(l), l * q
+}
+
+// encodeMacroblock chooses the modes of the macroblock at (mbx, mby),
+// quantizes its residuals and reconstructs it as decoders will.
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) vp8Macroblock {
+	var mb vp8Macroblock
+	yStride, x, y := e.mbw*16, mbx*16, mby*16
+
+	// Luma: the mode closest to the source, then the residual of each 4×4
+	// block, with the block DCs in the Y2 block.
+	pred := make([]uint8, 256)
+	top, left, corner, hasTop, hasLeft := vp8Edges(e.ry, yStride, x, y, 16)
+	best := -1
+	for mode := uint8(vp8PredDC); mode <= vp8PredHE; mode++ {
+		vp8Predict(pred, 16, mode, top, left, corner, hasTop, hasLeft)
+		if d := blockSSE(e.y, yStride, x, y, 16, pred); best < 0 || d < best {
+			best, mb.yMode = d, mode
+		}
+	}
+	vp8Predict(pred, 16, mb.yMode, top, left, corner, hasTop, hasLeft)
+	var coeffs [16][16]int32
+	var dcs [16]int32
+	for n := range 16 {
+		bx, by := n%4*4, n/4*4
+		coeffs[n] = forwardDCT(e.y, (y+by)*yStride+x+bx, yStride, pred, by*16+bx, 16)
+		dcs[n] = coeffs[n][0]
+	}
+	wht := forwardWHT(&dcs)
+	var dq [16]int32
+	for k, z := range vp8Zigzag {
+		mb.y2[k], dq[z] = vp8Quantize(wht[z], e.y2[min(z, 1)], vp8BiasDC)
+	}
+	dcs = inverseWHT(&dq)
+	for n := range 16 {
+		bx, by := n%4*4, n/4*4
+		c := &coeffs[n]
+		c[0] = dcs[n]
+		for k := 1; k < 16; k++ {
+			z := vp8Zigzag[k]
+			mb.y[n][k], c[z] = vp8Quantize(c[z], e.y1[1], vp8BiasAC)
+		}
+		for j := range 4 {
+			copy(e.ry[(y+by+j)*yStride+x+bx:][:4], pred[(by+j)*16+bx:][:4])
+		}
+		inverseDCT(c, e.ry, (y+by)*yStride+x+bx, yStride)
+	}
+
+	// Chroma: one mode for both planes, and all coefficients in 4×4
+	// blocks.
+	cStride, cx, cy := e.mbw*8, mbx*8, mby*8
+	predU, predV := make([]uint8, 64), make([]uint8, 64)
+	uTop, uLeft, uCorner, _, _ := vp8Edges(e.ru, cStride, cx, cy, 8)
+	vTop, vLeft, vCorner, _, _ := vp8Edges(e.rv, cStride, cx, cy, 8)
+	best = -1
+	for mode := uint8(vp8PredDC); mode <= vp8PredHE; mode++ {
+		vp8Predict(predU, 8, mode, uTop, uLeft, uCorner, hasTop, hasLeft)
+		vp8Predict(predV, 8, mode, vTop, vLeft, vCorner, hasTop, hasLeft)
+		if d := blockSSE(e.u, cStride, cx, cy, 8, predU) + blockSSE(e.v, cStride, cx, cy, 8, predV); best < 0 || d < best {
+			best, mb.uvMode = d, mode
+		}
+	}
+	vp8Predict(predU, 8, mb.uvMode, uTop, uLeft, uCorner, hasTop, hasLeft)
+	vp8Predict(predV, 8, mb.uvMode, vTop, vLeft, vCorner, hasTop, hasLeft)
+	for p, plane := range [2]struct{ src, rec, pred []uint8 }{{e.u, e.ru, predU}, {e.v, e.rv, predV}} {
+		for n := range 4 {
+			bx, by := n%2*4, n/2*4
+			c := forwardDCT(plane.src, (cy+by)*cStride+cx+bx, cStride, plane.pred, by*8+bx, 8)
+			for k, z := range vp8Zigzag {
+				bias := int32(vp8BiasAC)
+				if z == 0 {
+					bias = vp8BiasDC
+				}
+				mb.uv[p*4+n][k], c[z] = vp8Quantize(c[z], e.uvq[min(z, 1)], bias)
+			}
+			for j := range 4 {
+				copy(plane.rec[(cy+by+j)*cStride+cx+bx:][:4], plane.pred[(by+j)*8+bx:][:4])
+			}
+			inverseDCT(&c, plane.rec, (cy+by)*cStride+cx+bx, cStride)
+		}
+	}
+
+	mb.skip = mb.y2 == [16]int16{} && mb.y == [16][16]int16{} && mb.uv == [8][16]int16{}
+	return mb
+}
+
+// vp8TokenSink receives the bits of coefficient tokens: bits coded with
+// the token probability i of plane, band and context, and bits with fixed
+// probabilities.
+type vp8TokenSink interface {
+	token(plane, band, ctx, i int, bit bool)
+	fixed(prob uint8, bit bool)
+}
+
+// vp8TokenStats counts the token bits to adapt the probabilities.
+type vp8TokenStats [3][8][3][11][2]uint32
+
+func (s *vp8TokenStats) token(plane, band, ctx, i int, bit bool) {
+	if bit {
+		s[plane][band][ctx][i][1]++
+	} else {
+		s[plane][band][ctx][i][0]++
+	}
+}
+
+func (s *vp8TokenStats) fixed(uint8, bool) {}
+
+// vp8TokenWriter writes token bits with the frame's probabilities.
+type vp8TokenWriter struct {
+	e     *boolEncoder
+	probs *[4][8][3][11]uint8
+}
+
+func (w vp8TokenWriter) token(plane, band, ctx, i int, bit bool) {
+	w.e.put(w.probs[plane][band][ctx][i], bit)
+}
+
+func (w vp8TokenWriter) fixed(prob uint8, bit bool) {
+	w.e.put(prob, bit)
+}
+
+// putCoeffs sends the tokens of levels, a block in zigzag order starting at
+// first, and reports whether it has any non-zero level.
+func putCoeffs(s vp8TokenSink, plane, ctx int, levels *[16]int16, first int) uint8 {
+	last := -1
+	for i := 15; i >= first; i-- {
+		if levels[i] != 0 {
+			last = i
+			break
+		}
+	}
+	band := int(vp8Bands[first])
+	if last < 0 {
+		s.token(plane, band, ctx, 0, false) // End of block
+		return 0
+	}
+	s.token(plane, band, ctx, 0, true)
+	for n := first; n <= last; {
+		l := int(levels[n])
+		n++
+		if l == 0 {
+			s.token(plane, band, ctx, 1, false)
+			band, ctx = int(vp8Bands[n]), 0
+			continue
+		}
+		s.token(plane, band, ctx, 1, true)
+		v := max(l, -l)
+		put := func(i int, bit bool) { s.token(plane, band, ctx, i, bit) }
+		switch {
+		case v == 1:
+			put(2, false)
+		case v <= 4:
+			put(2, true)
+			put(3, false)
+			if v == 2 {
+				put(4, false)
+			} else {
+				put(4, true)
+				put(5, v == 4)
+			}
+		case v <= 10:
+			put(2, true)
+			put(3, true)
+			put(6, false)
+			if v <= 6 {
+				put(7, false)
+				s.fixed(159, v == 6)
+			} else {
+				put(7, true)
+				s.fixed(165, (v-7)&2 != 0)
+				s.fixed(145, (v-7)&1 != 0)
+			}
+		default:
+			put(2, true)
+			put(3, true)
+			put(6, true)
+			cat := 0
+			for cat < 3 && v >= 3+8<<(cat+1) {
+				cat++
+			}
+			put(8, cat >= 2)
+			put(9+cat/2, cat&1 != 0)
+			probs := vp8Cat3456[cat]
+			extra := v - (3 + 8<<cat)
+			for i, p := range probs {
+				s.fixed(p, extra>>(len(probs)-1-i)&1 != 0)
+			}
+		}
+		s.fixed(128, l < 0)
+		band, ctx = int(vp8Bands[n]), 1
+		if v > 1 {
+			ctx = 2
+		}
+		if n == 16 {
+			return 1
+		}
+		s.token(plane, band, ctx, 0, n <= last)
+	}
+	return 1
+}
+
+// vp8Context holds whether the blocks along an edge of a macroblock had
+// non-zero levels: four luma, two U, two V and the Y2 block.
+type vp8Context struct {
+	y    [4]uint8
+	u, v [2]uint8
+	y2   uint8
+}
+
+// putTokens sends the tokens of every macroblock to the sink of its row;
+// skip tells whether macroblocks without levels are skipped.
+func (e *vp8Encoder) putTokens(sink func(mby int) vp8TokenSink, skip bool) {
+	above := make([]vp8Context, e.mbw)
+	for mby := range e.mbh {
+		s := sink(mby)
+		var left vp8Context
+		for mbx := range e.mbw {
+			mb, up := &e.mbs[mby*e.mbw+mbx], &above[mbx]
+			if skip && mb.skip {
+				*up, left = vp8Context{}, vp8Context{}
+				continue
+			}
+			nz := putCoeffs(s, vp8PlaneY2, int(left.y2+up.y2), &mb.y2, 0)
+			left.y2, up.y2 = nz, nz
+			for j := range 4 {
+				for i := range 4 {
+					nz := putCoeffs(s, vp8PlaneYAC, int(left.y[j]+up.y[i]), &mb.y[j*4+i], 1)
+					left.y[j], up.y[i] = nz, nz
+				}
+			}
+			for p, ctx := range [2][2]*[2]uint8{{&left.u, &up.u}, {&left.v, &up.v}} {
+				for j := range 2 {
+					for i := range 2 {
+						nz := putCoeffs(s, vp8PlaneUV, int(ctx[0][j]+ctx[1][i]), &mb.uv[p*4+j*2+i], 0)
+						ctx[0][j], ctx[1][i] = nz, nz
+					}
+				}
+			}
+		}
+	}
+}
+
+// bitCost returns the bits needed to code n0 false and n1 true bits with
+// probability prob.
+func bitCost(n0, n1 uint32, prob uint8) float64 {
+	p := float64(prob) / 256
+	return -float64(n0)*math.Log2(p) - float64(n1)*math.Log2(1-p)
+}
+
+// encodeVP8 encodes img as a VP8 key frame at quality from 1 to 100.
+func encodeVP8(img *image.RGBA, quality int) ([]byte, error) {
+	b := img.Bounds()
+	e := &vp8Encoder{w: b.Dx(), h: b.Dy(), mbw: (b.Dx() + 15) / 16, mbh: (b.Dy() + 15) / 16}
+	e.convert(img)
+	q := vp8QualityToQuant(quality)
+	e.y1 = [2]int32{int32(vp8DCTable[q]), int32(vp8ACTable[q])}
+	e.y2 = [2]int32{int32(vp8DCTable[q]) * 2, max(int32(vp8ACTable[q])*155/100, 8)}
+	e.uvq = [2]int32{int32(vp8DCTable[min(q, 117)]), int32(vp8ACTable[q])}
+
+	e.mbs = make([]vp8Macroblock, 0, e.mbw*e.mbh)
+	skipped := 0
+	for mby := range e.mbh {
+		for mbx := range e.mbw {
+			mb := e.encodeMacroblock(mbx, mby)
+			if mb.skip {
+				skipped++
+			}
+			e.mbs = append(e.mbs, mb)
+		}
+	}
+
+	// Token probabilities: replace the defaults where coding the counted
+	// bits with the best probability saves more than the update costs.
+	var stats vp8TokenStats
+	e.putTokens(func(int) vp8TokenSink { return &stats }, skipped > 0)
+	probs := vp8DefaultTokenProb
+	var update [4][8][3][11]bool
+	for i := range stats {
+		for j := range stats[i] {
+			for k := range stats[i][j] {
+				for l, n := range stats[i][j][k] {
+					total := n[0] + n[1]
+					if total == 0 {
+						continue
+					}
+					p := uint8(min(max((uint64(n[0])*256+uint64(total)/2)/uint64(total), 1), 255))
+					u := vp8TokenUpdateProb[i][j][k][l]
+					keep := bitCost(n[0], n[1], probs[i][j][k][l]) + bitCost(1, 0, u)
+					if bitCost(n[0], n[1], p)+bitCost(0, 1, u)+8 < keep {
+						probs[i][j][k][l], update[i][j][k][l] = p, true
+					}
+				}
+			}
+		}
+	}
+
+	// Tokens go to one partition per row in turn; more partitions are only
+	// needed when one would be too large.
+	var partitions [][]byte
+	for n := 1; ; n *= 2 {
+		coders := make([]*boolEncoder, n)
+		for i := range coders {
+			coders[i] = newBoolEncoder()
+		}
+		e.putTokens(func(mby int) vp8TokenSink { return vp8TokenWriter{coders[mby%n], &probs} }, skipped > 0)
+		partitions = partitions[:0]
+		fits := true
+		for _, c := range coders {
+			partitions = append(partitions, c.bytes())
+			fits = fits && len(c.buf) <= vp8MaxPartition
+		}
+		if fits {
+			break
+		}
+		if n == 8 {
+			return nil, fmt.Errorf("image of %dx%d is too large for lossy WebP at quality %d", e.w, e.h, quality)
+		}
+	}
+
+	// The first partition holds the frame header and the macroblock modes.
+	fp := newBoolEncoder()
+	fp.put(128, false)  // Color space
+	fp.put(128, false)  // Clamping required
+	fp.put(128, false)  // No segmentation
+	fp.put(128, false)  // Normal loop filter
+	fp.putLiteral(0, 6) // Loop filter level: off
+	fp.putLiteral(0, 3) // Sharpness
+	fp.put(128, false)  // No loop filter adjustments
+	fp.putLiteral(uint32(bits.TrailingZeros(uint(len(partitions)))), 2)
+	fp.putLiteral(uint32(q), 7)
+	for range 5 {
+		fp.put(128, false) // No quantizer deltas
+	}
+	fp.put(128, false) // Refresh entropy probabilities
+	for i := range probs[:3] {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l, p := range probs[i][j][k] {
+					fp.put(vp8TokenUpdateProb[i][j][k][l], update[i][j][k][l])
+					if update[i][j][k][l] {
+						fp.putLiteral(uint32(p), 8)
+					}
+				}
+			}
+		}
+	}
+	// The probabilities of the fourth plane, luma blocks coded with their
+	// DCs, are never updated: only 16×16 prediction is used.
+	for j := range probs[3] {
+		for k := range probs[3][j] {
+			for l := range probs[3][j][k] {
+				fp.put(vp8TokenUpdateProb[3][j][k][l], false)
+			}
+		}
+	}
+	skipProb := uint8(0)
+	if skipped > 0 {
+		skipProb = uint8(min(max((len(e.mbs)-skipped)*256/len(e.mbs), 1), 255))
+		fp.put(128, true)
+		fp.putLiteral(uint32(skipProb), 8)
+	} else {
+		fp.put(128, false)
+	}
+	for _, mb := range e.mbs {
+		if skipped > 0 {
+			fp.put(skipProb, mb.skip)
+		}
+		fp.put(145, true) // 16×16 luma prediction
+		switch mb.yMode {
+		case vp8PredDC:
+			fp.put(156, false)
+			fp.put(163, false)
+		case vp8PredVE:
+			fp.put(156, false)
+			fp.put(163, true)
+		case vp8PredHE:
+			fp.put(156, true)
+			fp.put(128, false)
+		case vp8PredTM:
+			fp.put(156, true)
+			fp.put(128, true)
+		}
+		switch mb.uvMode {
+		case vp8PredDC:
+			fp.put(142, false)
+		case vp8PredVE:
+			fp.put(142, true)
+			fp.put(114, false)
+		case vp8PredHE:
+			fp.put(142, true)
+			fp.put(114, true)
+			fp.put(183, false)
+		case vp8PredTM:
+			fp.put(142, true)
+			fp.put(114, true)
+			fp.put(183, true)
+		}
+	}
+	first := fp.bytes()
+	if len(first) >= 1<<19 {
+		return nil, fmt.Errorf("image of %dx%d is too large for lossy WebP", e.w, e.h)
+	}
+
+	// Frame tag of a shown key frame, start code and size.
+	tag := uint32(len(first))<<5 | 1<<4
+	out := []byte{
+		byte(tag), byte(tag >> 8), byte(tag >> 16),
+		0x9d, 0x01, 0x2a,
+		byte(e.w), byte(e.w >> 8), byte(e.h), byte(e.h >> 8),
+	}
+	out = append(out, first...)
+	for _, p := range partitions[:len(partitions)-1] {
+		out = append(out, byte(len(p)), byte(len(p)>>8), byte(len(p)>>16))
+	}
+	for _, p := range partitions {
+		out = append(out, p...)
+	}
+	return out, nil
+}
+
+// The quantizer steps of DC and AC coefficients by quantizer index (RFC
+// 6386, section 14.1).
+var (
+	vp8DCTable = [128]uint16{
+		4, 5, 6, 7, 8, 9, 10, 10,
+		11, 12, 13, 14, 15, 16, 17, 17,
+		18, 19, 20, 20, 21, 21, 22, 22,
+		23, 23, 24, 25, 25, 26, 27, 28,
+		29, 30, 31, 32, 33, 34, 35, 36,
+		37, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 46, 47, 48, 49, 50,
+		51, 52, 53, 54, 55, 56, 57, 58,
+		59, 60, 61, 62, 63, 64, 65, 66,
+		67, 68, 69, 70, 71, 72, 73, 74,
+		75, 76, 76, 77, 78, 79, 80, 81,
+		82, 83, 84, 85, 86, 87, 88, 89,
+		91, 93, 95, 96, 98, 100, 101, 102,
+		104, 106, 108, 110, 112, 114, 116, 118,
+		122, 124, 126, 128, 130, 132, 134, 136,
+		138, 140, 143, 145, 148, 151, 154, 157,
+	}
+	vp8ACTable = [128]uint16{
+		4, 5, 6, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27,
+		28, 29, 30, 31, 32, 33, 34, 35,
+		36, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 47, 48, 49, 50, 51,
+		52, 53, 54, 55, 56, 57, 58, 60,
+		62, 64, 66, 68, 70, 72, 74, 76,
+		78, 80, 82, 84, 86, 88, 90, 92,
+		94, 96, 98, 100, 102, 104, 106, 108,
+		110, 112, 114, 116, 119, 122, 125, 128,
+		131, 134, 137, 140, 143, 146, 149, 152,
+		155, 158, 161, 164, 167, 170, 173, 177,
+		181, 185, 189, 193, 197, 201, 205, 209,
+		213, 217, 221, 225, 229, 234, 239, 245,
+		249, 254, 259, 264, 269, 274, 279, 284,
+	}
+)
+
+// vp8TokenUpdateProb holds the probabilities that a token probability is
+// updated in the frame header (RFC 6386, section 13.4).
+var vp8TokenUpdateProb = [4][8][3][11]uint8{
+	{
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{176, 246, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 241, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 244, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 246, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{239, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 254, 255, 255, 255, 255, 255, 255},
+			{250, 255, 254, 255, 254, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{217, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{225, 252, 241, 253, 255, 255, 254, 255, 255, 255, 255},
+			{234, 250, 241, 250, 253, 255, 253, 254, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{223, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{238, 253, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 248, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{247, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{186, 251, 250, 255, 255, 255, 255, 255, 255, 255, 255},
+			{234, 251, 244, 254, 255, 255, 255, 255, 255, 255, 255},
+			{251, 251, 243, 253, 254, 255, 254, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{236, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{251, 253, 253, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+	{
+		{
+			{248, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 254, 252, 254, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 249, 253, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{246, 253, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 254, 251, 254, 254, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 254, 252, 255, 255, 255, 255, 255, 255, 255, 255},
+			{248, 254, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 255, 254, 254, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{245, 251, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{253, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 251, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{252, 253, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 254, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 252, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{249, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 254, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 253, 255, 255, 255, 255, 255, 255, 255, 255},
+			{250, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{254, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+			{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255},
+		},
+	},
+}
+
+// vp8DefaultTokenProb holds the token probabilities of a frame that updates
+// none (RFC 6386, section 13.5).
+var vp8DefaultTokenProb = [4][8][3][11]uint8{
+	{
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{253, 136, 254, 255, 228, 219, 128, 128, 128, 128, 128},
+			{189, 129, 242, 255, 227, 213, 255, 219, 128, 128, 128},
+			{106, 126, 227, 252, 214, 209, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 98, 248, 255, 236, 226, 255, 255, 128, 128, 128},
+			{181, 133, 238, 254, 221, 234, 255, 154, 128, 128, 128},
+			{78, 134, 202, 247, 198, 180, 255, 219, 128, 128, 128},
+		},
+		{
+			{1, 185, 249, 255, 243, 255, 128, 128, 128, 128, 128},
+			{184, 150, 247, 255, 236, 224, 128, 128, 128, 128, 128},
+			{77, 110, 216, 255, 236, 230, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 101, 251, 255, 241, 255, 128, 128, 128, 128, 128},
+			{170, 139, 241, 252, 236, 209, 255, 255, 128, 128, 128},
+			{37, 116, 196, 243, 228, 255, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 204, 254, 255, 245, 255, 128, 128, 128, 128, 128},
+			{207, 160, 250, 255, 238, 128, 128, 128, 128, 128, 128},
+			{102, 103, 231, 255, 211, 171, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 152, 252, 255, 240, 255, 128, 128, 128, 128, 128},
+			{177, 135, 243, 255, 234, 225, 128, 128, 128, 128, 128},
+			{80, 129, 211, 255, 194, 224, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{246, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{255, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{198, 35, 237, 223, 193, 187, 162, 160, 145, 155, 62},
+			{131, 45, 198, 221, 172, 176, 220, 157, 252, 221, 1},
+			{68, 47, 146, 208, 149, 167, 221, 162, 255, 223, 128},
+		},
+		{
+			{1, 149, 241, 255, 221, 224, 255, 255, 128, 128, 128},
+			{184, 141, 234, 253, 222, 220, 255, 199, 128, 128, 128},
+			{81, 99, 181, 242, 176, 190, 249, 202, 255, 255, 128},
+		},
+		{
+			{1, 129, 232, 253, 214, 197, 242, 196, 255, 255, 128},
+			{99, 121, 210, 250, 201, 198, 255, 202, 128, 128, 128},
+			{23, 91, 163, 242, 170, 187, 247, 210, 255, 255, 128},
+		},
+		{
+			{1, 200, 246, 255, 234, 255, 128, 128, 128, 128, 128},
+			{109, 178, 241, 255, 231, 245, 255, 255, 128, 128, 128},
+			{44, 130, 201, 253, 205, 192, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 132, 239, 251, 219, 209, 255, 165, 128, 128, 128},
+			{94, 136, 225, 251, 218, 190, 255, 255, 128, 128, 128},
+			{22, 100, 174, 245, 186, 161, 255, 199, 128, 128, 128},
+		},
+		{
+			{1, 182, 249, 255, 232, 235, 128, 128, 128, 128, 128},
+			{124, 143, 241, 255, 227, 234, 128, 128, 128, 128, 128},
+			{35, 77, 181, 251, 193, 211, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 157, 247, 255, 236, 231, 255, 255, 128, 128, 128},
+			{121, 141, 235, 255, 225, 227, 255, 255, 128, 128, 128},
+			{45, 99, 188, 251, 195, 217, 255, 224, 128, 128, 128},
+		},
+		{
+			{1, 1, 251, 255, 213, 255, 128, 128, 128, 128, 128},
+			{203, 1, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{137, 1, 177, 255, 224, 255, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{253, 9, 248, 251, 207, 208, 255, 192, 128, 128, 128},
+			{175, 13, 224, 243, 193, 185, 249, 198, 255, 255, 128},
+			{73, 17, 171, 221, 161, 179, 236, 167, 255, 234, 128},
+		},
+		{
+			{1, 95, 247, 253, 212, 183, 255, 255, 128, 128, 128},
+			{239, 90, 244, 250, 211, 209, 255, 255, 128, 128, 128},
+			{155, 77, 195, 248, 188, 195, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 24, 239, 251, 218, 219, 255, 205, 128, 128, 128},
+			{201, 51, 219, 255, 196, 186, 128, 128, 128, 128, 128},
+			{69, 46, 190, 239, 201, 218, 255, 228, 128, 128, 128},
+		},
+		{
+			{1, 191, 251, 255, 255, 128, 128, 128, 128, 128, 128},
+			{223, 165, 249, 255, 213, 255, 128, 128, 128, 128, 128},
+			{141, 124, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 16, 248, 255, 255, 128, 128, 128, 128, 128, 128},
+			{190, 36, 230, 255, 236, 255, 128, 128, 128, 128, 128},
+			{149, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 226, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{247, 192, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{240, 128, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{1, 134, 252, 255, 255, 128, 128, 128, 128, 128, 128},
+			{213, 62, 250, 255, 255, 128, 128, 128, 128, 128, 128},
+			{55, 93, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+		{
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+			{128, 128, 128, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+	{
+		{
+			{202, 24, 213, 235, 186, 191, 220, 160, 240, 175, 255},
+			{126, 38, 182, 232, 169, 184, 228, 174, 255, 187, 128},
+			{61, 46, 138, 219, 151, 178, 240, 170, 255, 216, 128},
+		},
+		{
+			{1, 112, 230, 250, 199, 191, 247, 159, 255, 255, 128},
+			{166, 109, 228, 252, 211, 215, 255, 174, 128, 128, 128},
+			{39, 77, 162, 232, 172, 180, 245, 178, 255, 255, 128},
+		},
+		{
+			{1, 52, 220, 246, 198, 199, 249, 220, 255, 255, 128},
+			{124, 74, 191, 243, 183, 193, 250, 221, 255, 255, 128},
+			{24, 71, 130, 219, 154, 170, 243, 182, 255, 255, 128},
+		},
+		{
+			{1, 182, 225, 249, 219, 240, 255, 224, 128, 128, 128},
+			{149, 150, 226, 252, 216, 205, 255, 171, 128, 128, 128},
+			{28, 108, 170, 242, 183, 194, 254, 223, 255, 255, 128},
+		},
+		{
+			{1, 81, 230, 252, 204, 203, 255, 192, 128, 128, 128},
+			{123, 102, 209, 247, 188, 196, 255, 233, 128, 128, 128},
+			{20, 95, 153, 243, 164, 173, 255, 203, 128, 128, 128},
+		},
+		{
+			{1, 222, 248, 255, 216, 213, 128, 128, 128, 128, 128},
+			{168, 175, 246, 252, 235, 205, 255, 255, 128, 128, 128},
+			{47, 116, 215, 255, 211, 212, 255, 255, 128, 128, 128},
+		},
+		{
+			{1, 121, 236, 253, 212, 214, 255, 255, 128, 128, 128},
+			{141, 84, 213, 252, 201, 202, 255, 219, 128, 128, 128},
+			{42, 80, 160, 240, 162, 185, 255, 205, 128, 128, 128},
+		},
+		{
+			{1, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{244, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+			{238, 1, 255, 128, 128, 128, 128, 128, 128, 128, 128},
+		},
+	},
+}
@@ -0,0 +1,61 @@
+package gopiq
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDCTRoundTrip(t *testing.T) {
+	src := make([]uint8, 16)
+	pred := make([]uint8, 16)
+	for i := range src {
+		src[i] = uint8(i * 37 % 251)
+		pred[i] = uint8(128 + i)
+	}
+	coeffs := forwardDCT(src, 0, 4, pred, 0, 4)
+	out := append([]uint8(nil), pred...)
+	inverseDCT(&coeffs, out, 0, 4)
+	for i := range src {
+		if abs(int(out[i])-int(src[i])) > 1 {
+			t.Errorf("pixel %d after the transforms = %d, want %d", i, out[i], src[i])
+		}
+	}
+
+	var dc [16]int32
+	for i := range dc {
+		dc[i] = int32(i*97%200) - 100
+	}
+	wht := forwardWHT(&dc)
+	if got := inverseWHT(&wht); got != dc {
+		t.Errorf("Walsh-Hadamard round trip = %v, want %v", got, dc)
+	}
+}
+
+func TestVP8QualityToQuant(t *testing.T) {
+	prev := 128
+	for q := 1; q <= 100; q++ {
+		quant := vp8QualityToQuant(q)
+		if quant < 0 || quant > 127 || quant > prev {
+			t.Fatalf("quality %d gives quantizer index %d, want 0..127 falling with quality", q, quant)
+		}
+		prev = quant
+	}
+}
+
+func TestEncodeVP8(t *testing.T) {
+	// Sizes that are not multiples of the 16×16 macroblocks are padded.
+	for _, size := range []image.Point{{1, 1}, {17, 9}, {40, 40}} {
+		img := createUniformImage(size.X, size.Y, color.RGBA{200, 100, 50, 255})
+		frame, err := encodeVP8(img, 90)
+		if err != nil {
+			t.Fatalf("encodeVP8() of %v should not error, got: %v", size, err)
+		}
+		if frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+			t.Fatalf("frame of %v has no VP8 start code", size)
+		}
+		if w, h := int(frame[6])|int(frame[7])<<8, int(frame[8])|int(frame[9])<<8; w != size.X || h != size.Y {
+			t.Errorf("frame header size = %dx%d, want %v", w, h, size)
+		}
+	}
+}